@@ -0,0 +1,79 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/microsoft"
+)
+
+// MicrosoftScopes are the Microsoft Graph permissions the Outlook backend asks for.
+// MailboxSettings covers inbox rules, the Outlook equivalent of Gmail filters.
+var MicrosoftScopes = []string{"offline_access", "User.Read", "Mail.ReadWrite", "Mail.Send", "MailboxSettings.ReadWrite"}
+
+// NewMicrosoftOAuthConfig builds the OAuth config for an Azure app registration from
+// GMAIL_MCP_OUTLOOK_CLIENT_ID and GMAIL_MCP_OUTLOOK_TENANT (default "common"). The
+// registration must allow public client flows, since sign-in uses a device code.
+func NewMicrosoftOAuthConfig() (*oauth2.Config, error) {
+	clientID := os.Getenv("GMAIL_MCP_OUTLOOK_CLIENT_ID")
+	if clientID == "" {
+		return nil, fmt.Errorf("GMAIL_MCP_OUTLOOK_CLIENT_ID environment variable not set")
+	}
+	return &oauth2.Config{
+		ClientID: clientID,
+		Scopes:   MicrosoftScopes,
+		Endpoint: microsoft.AzureADEndpoint(os.Getenv("GMAIL_MCP_OUTLOOK_TENANT")),
+	}, nil
+}
+
+// MicrosoftHTTPClient returns an HTTP client authorized for Microsoft Graph. It uses
+// the token saved in tokenFile, or signs in with a device code logged to stderr, and
+// saves refreshed tokens back to tokenFile.
+func MicrosoftHTTPClient(ctx context.Context, config *oauth2.Config, tokenFile string) (*http.Client, error) {
+	token, err := TokenFromFile(tokenFile)
+	if err != nil {
+		device, err := config.DeviceAuth(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to start Microsoft sign-in: %v", err)
+		}
+		// Log instead of printing: stdout carries the MCP stdio protocol
+		log.Printf("🔐 To sign in to Outlook, open %s and enter the code %s", device.VerificationURI, device.UserCode)
+		token, err = config.DeviceAccessToken(ctx, device)
+		if err != nil {
+			return nil, fmt.Errorf("Microsoft sign-in failed: %v", err)
+		}
+		SaveToken(tokenFile, token)
+		log.Println("✅ Outlook authorization successful! Token saved.")
+	}
+
+	source := &savingTokenSource{next: config.TokenSource(context.Background(), token), file: tokenFile, last: token.AccessToken}
+	return oauth2.NewClient(context.Background(), oauth2.ReuseTokenSource(token, source)), nil
+}
+
+// savingTokenSource saves each refreshed token, since Microsoft rotates refresh tokens
+type savingTokenSource struct {
+	next oauth2.TokenSource
+	file string
+
+	mu   sync.Mutex
+	last string
+}
+
+func (s *savingTokenSource) Token() (*oauth2.Token, error) {
+	token, err := s.next.Token()
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if token.AccessToken != s.last {
+		s.last = token.AccessToken
+		SaveToken(s.file, token)
+	}
+	return token, nil
+}
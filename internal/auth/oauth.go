@@ -0,0 +1,264 @@
+// Package auth implements the Google OAuth flow and token storage used to
+// authorize Gmail API access.
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+	"google.golang.org/api/gmail/v1"
+	googleOption "google.golang.org/api/option"
+)
+
+// Scopes are the Gmail permissions the server asks for. Modify covers reading
+// and labeling mail; settings.basic is needed to create filters.
+var Scopes = []string{gmail.GmailModifyScope, gmail.GmailComposeScope, gmail.GmailSettingsBasicScope}
+
+// NewOAuthConfig builds the OAuth client config from environment variables
+func NewOAuthConfig() (*oauth2.Config, error) {
+	// Get credentials from separate environment variables
+	clientID := os.Getenv("GMAIL_CLIENT_ID")
+	clientSecret := os.Getenv("GMAIL_CLIENT_SECRET")
+	redirecturl := os.Getenv("REDIRECT_URL")
+
+	if clientID == "" {
+		return nil, fmt.Errorf("GMAIL_CLIENT_ID environment variable not set")
+	}
+	if clientSecret == "" {
+		return nil, fmt.Errorf("GMAIL_CLIENT_SECRET environment variable not set")
+	}
+
+	// Create OAuth config from the client ID and secret
+	return &oauth2.Config{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		RedirectURL:  redirecturl,
+		Scopes:       Scopes,
+		Endpoint:     google.Endpoint,
+	}, nil
+}
+
+// LoadToken retrieves a valid token from the local token file.
+// It never starts the OAuth flow; use PerformOAuthFlow for that.
+func LoadToken(tokenFile string) (*oauth2.Token, error) {
+	// Try to load existing token
+	token, err := TokenFromFile(tokenFile)
+	if err != nil {
+		return nil, fmt.Errorf("no valid token file found: %v", err)
+	}
+
+	// Validate the token by testing it with a simple Gmail API call
+	log.Println("Validating existing token...")
+	if !IsTokenValid(token) {
+		return nil, fmt.Errorf("existing token is invalid or expired")
+	}
+
+	log.Println("✅ Using existing valid token")
+	return token, nil
+}
+
+// IsTokenValid tests if a token is valid by making a simple API call
+func IsTokenValid(token *oauth2.Token) bool {
+	// Create a temporary client to test the token
+	config := &oauth2.Config{
+		ClientID:     "",
+		ClientSecret: "",
+		Endpoint:     google.Endpoint,
+		Scopes:       Scopes,
+	}
+
+	client := config.Client(context.Background(), token)
+	service, err := gmail.NewService(context.Background(), googleOption.WithHTTPClient(client))
+	if err != nil {
+		return false
+	}
+
+	// Try a simple API call to verify the token works
+	_, err = service.Users.GetProfile("me").Fields("emailAddress").Do()
+	return err == nil
+}
+
+// tokenInfoURL is Google's endpoint describing an access token
+const tokenInfoURL = "https://oauth2.googleapis.com/tokeninfo"
+
+// GrantedScopes asks Google which scopes an access token was actually granted,
+// which can be fewer than Scopes if the user unticked some at consent
+func GrantedScopes(ctx context.Context, token *oauth2.Token) ([]string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, tokenInfoURL+"?access_token="+url.QueryEscape(token.AccessToken), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("tokeninfo returned %s", resp.Status)
+	}
+
+	var info struct {
+		Scope string `json:"scope"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		return nil, fmt.Errorf("invalid tokeninfo response: %v", err)
+	}
+	return strings.Fields(info.Scope), nil
+}
+
+// PerformOAuthFlow runs the browser OAuth flow and saves the token to tokenFile
+func PerformOAuthFlow(config *oauth2.Config, tokenFile string) (*oauth2.Token, error) {
+	token, err := getTokenFromWeb(config)
+	if err != nil {
+		return nil, err
+	}
+
+	// Save token for next time
+	SaveToken(tokenFile, token)
+	return token, nil
+}
+
+// getTokenFromWeb requests a token from the web, then returns the retrieved token
+func getTokenFromWeb(config *oauth2.Config) (*oauth2.Token, error) {
+	// Create a channel to receive the authorization code
+	codeChan := make(chan string, 1)
+	errChan := make(chan error, 1)
+
+	// Start a temporary HTTP server to catch the OAuth callback.
+	// Use a private mux so the flow can be retried without re-registering handlers.
+	mux := http.NewServeMux()
+	server := &http.Server{Addr: ":8080", Handler: mux}
+
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		code := r.URL.Query().Get("code")
+		if code == "" {
+			errChan <- fmt.Errorf("no code in callback")
+			return
+		}
+
+		// Send success page to user
+		fmt.Fprint(w, `
+<!DOCTYPE html>
+<html>
+<head>
+    <title>Gmail MCP Server - Authorization Complete</title>
+    <style>
+        body { font-family: Arial, sans-serif; text-align: center; margin-top: 50px; }
+        .success { color: green; font-size: 18px; }
+    </style>
+</head>
+<body>
+    <h1>Authorization Successful!</h1>
+    <p class="success">✅ You can now close this browser window and return to your terminal.</p>
+    <p>Your Gmail MCP Server is now configured.</p>
+</body>
+</html>`)
+
+		// Send the code back to the main flow
+		codeChan <- code
+	})
+
+	// Start server in a goroutine
+	go func() {
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			errChan <- fmt.Errorf("failed to start callback server: %v", err)
+		}
+	}()
+
+	// Always release the callback port, including on error or timeout, so a later retry can bind it
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(ctx)
+	}()
+
+	// Wait a moment for server to start
+	time.Sleep(100 * time.Millisecond)
+
+	// Update the redirect URI to point to our local server
+	config.RedirectURL = os.Getenv("REDIRECT_URL")
+
+	// Generate the authorization URL
+	authURL := config.AuthCodeURL("state-token", oauth2.AccessTypeOffline)
+
+	// Log instead of printing: stdout carries the MCP stdio protocol
+	log.Println("Opening browser for authorization...")
+	log.Printf("If browser doesn't open automatically, go to: %v", authURL)
+
+	// Try to open browser automatically
+	openBrowser(authURL)
+
+	// Wait for either the code or an error
+	var authCode string
+	select {
+	case authCode = <-codeChan:
+		// Success! We got the code
+	case err := <-errChan:
+		return nil, fmt.Errorf("authorization failed: %v", err)
+	case <-time.After(5 * time.Minute):
+		return nil, fmt.Errorf("authorization timed out after 5 minutes")
+	}
+
+	// Exchange the code for a token
+	token, err := config.Exchange(context.TODO(), authCode)
+	if err != nil {
+		return nil, fmt.Errorf("unable to retrieve token from web: %v", err)
+	}
+
+	log.Println("✅ Authorization successful! Token saved.")
+	return token, nil
+}
+
+// openBrowser tries to open the URL in the default browser
+func openBrowser(url string) {
+	var err error
+	switch runtime.GOOS {
+	case "linux":
+		err = exec.Command("xdg-open", url).Start()
+	case "windows":
+		err = exec.Command("rundll32", "url.dll,FileProtocolHandler", url).Start()
+	case "darwin":
+		err = exec.Command("open", url).Start()
+	default:
+		err = fmt.Errorf("unsupported platform")
+	}
+
+	if err != nil {
+		log.Printf("Could not open browser automatically: %v", err)
+	}
+}
+
+// TokenFromFile retrieves a token from a local file
+func TokenFromFile(file string) (*oauth2.Token, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	token := &oauth2.Token{}
+	err = json.NewDecoder(f).Decode(token)
+	return token, err
+}
+
+// SaveToken saves a token to a file path
+func SaveToken(path string, token *oauth2.Token) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		log.Printf("Unable to cache oauth token: %v", err)
+		return
+	}
+	defer f.Close()
+	json.NewEncoder(f).Encode(token)
+}
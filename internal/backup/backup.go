@@ -0,0 +1,464 @@
+// Package backup saves Gmail labels to disk as mbox files, with every attachment
+// also written out as a plain file. The first run of a label exports it in full;
+// later runs only fetch what Gmail's history says was added since. A manifest
+// records what is saved, and RESTORE.md explains how to get it back.
+package backup
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"auto-gmail/internal/gmailclient"
+
+	"google.golang.org/api/googleapi"
+)
+
+// Files in the backup directory
+const (
+	ManifestFile   = "manifest.json"
+	RestoreFile    = "RESTORE.md"
+	AttachmentsDir = "attachments"
+)
+
+// manifestVersion is bumped when the manifest format changes incompatibly
+const manifestVersion = 1
+
+// saveEvery is how many messages are backed up between manifest saves, so an
+// interrupted run loses little
+const saveEvery = 50
+
+// Manifest records what a backup directory holds and where incremental runs continue
+type Manifest struct {
+	Version int    `json:"version"`
+	Account string `json:"account,omitempty"`
+	// HistoryID is where the next incremental run lists changes from
+	HistoryID uint64                   `json:"historyId,omitempty"`
+	Created   time.Time                `json:"created"`
+	Updated   time.Time                `json:"updated"`
+	Labels    map[string]*LabelState   `json:"labels"`   // by label ID
+	Messages  map[string]*MessageEntry `json:"messages"` // by message ID
+}
+
+// LabelState is one backed-up label
+type LabelState struct {
+	Name string `json:"name"`
+	// File is the label's mbox, relative to the backup directory
+	File string `json:"file"`
+	// Complete is set once the full export finished; later runs are incremental
+	Complete bool `json:"complete"`
+	Messages int  `json:"messages"`
+}
+
+// MessageEntry is one backed-up message
+type MessageEntry struct {
+	Mboxes  []string `json:"mboxes"`
+	Date    string   `json:"date,omitempty"`
+	From    string   `json:"from,omitempty"`
+	Subject string   `json:"subject,omitempty"`
+	// Attachments are paths relative to the backup directory
+	Attachments []string `json:"attachments,omitempty"`
+}
+
+// Label is a label to back up
+type Label struct {
+	ID   string
+	Name string
+}
+
+// Options control one backup run
+type Options struct {
+	Labels []Label
+	// Full lists every message again instead of using history; messages already
+	// saved are still skipped
+	Full bool
+	// MaxMessages stops the run after this many new messages (0 for no limit); the
+	// next run picks up where it stopped
+	MaxMessages int
+}
+
+// LabelResult is what one run did for a label
+type LabelResult struct {
+	Name  string `json:"name"`
+	File  string `json:"file"`
+	Mode  string `json:"mode"` // "full" or "incremental"
+	Added int    `json:"added"`
+	Total int    `json:"total"`
+}
+
+// Result is the outcome of a backup run
+type Result struct {
+	Dir       string         `json:"dir"`
+	Manifest  string         `json:"manifest"`
+	Restore   string         `json:"restoreInstructions"`
+	Added     int            `json:"added"`
+	Labels    []*LabelResult `json:"labels"`
+	Remaining bool           `json:"remaining,omitempty"`
+	Failed    []string       `json:"failed,omitempty"`
+	HistoryID uint64         `json:"historyId,omitempty"`
+}
+
+// LoadManifest reads the manifest in dir; a directory without one gets an empty manifest
+func LoadManifest(dir string) (*Manifest, error) {
+	manifest := &Manifest{Version: manifestVersion, Labels: map[string]*LabelState{}, Messages: map[string]*MessageEntry{}}
+	data, err := os.ReadFile(filepath.Join(dir, ManifestFile))
+	if os.IsNotExist(err) {
+		return manifest, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, manifest); err != nil {
+		return nil, fmt.Errorf("invalid backup manifest %s: %v", filepath.Join(dir, ManifestFile), err)
+	}
+	if manifest.Version > manifestVersion {
+		return nil, fmt.Errorf("backup manifest %s is from a newer version of the server", filepath.Join(dir, ManifestFile))
+	}
+	if manifest.Labels == nil {
+		manifest.Labels = map[string]*LabelState{}
+	}
+	if manifest.Messages == nil {
+		manifest.Messages = map[string]*MessageEntry{}
+	}
+	return manifest, nil
+}
+
+// save writes the manifest atomically
+func (m *Manifest) save(dir string) error {
+	m.Updated = time.Now().UTC()
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(dir, ManifestFile+".tmp")
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(dir, ManifestFile))
+}
+
+// Run backs the labels up into dir. Labels never backed up before, and every label
+// when history is unavailable or has expired, are listed in full; the rest only
+// fetch messages added since the last run. Messages already in a label's mbox are
+// never written twice.
+func Run(ctx context.Context, client gmailclient.Client, dir string, opts Options) (*Result, error) {
+	syncer, ok := client.(gmailclient.MailboxSyncer)
+	if !ok {
+		return nil, fmt.Errorf("this mailbox can't be backed up: it can't list messages by label")
+	}
+	if err := os.MkdirAll(filepath.Join(dir, AttachmentsDir), 0700); err != nil {
+		return nil, err
+	}
+	manifest, err := LoadManifest(dir)
+	if err != nil {
+		return nil, err
+	}
+	profile, err := client.GetProfile(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if manifest.Account != "" && !strings.EqualFold(manifest.Account, profile.EmailAddress) {
+		return nil, fmt.Errorf("%s holds a backup of %s, not %s", dir, manifest.Account, profile.EmailAddress)
+	}
+	manifest.Account = profile.EmailAddress
+	if manifest.Created.IsZero() {
+		manifest.Created = time.Now().UTC()
+	}
+
+	result := &Result{
+		Dir:      dir,
+		Manifest: filepath.Join(dir, ManifestFile),
+		Restore:  filepath.Join(dir, RestoreFile),
+	}
+	sinceSave := 0
+	for _, label := range opts.Labels {
+		state, ok := manifest.Labels[label.ID]
+		if !ok {
+			state = &LabelState{File: mboxFileName(label.Name, manifest.Labels)}
+			manifest.Labels[label.ID] = state
+		}
+		state.Name = label.Name
+		labelResult := &LabelResult{Name: label.Name, File: state.File, Mode: "incremental"}
+		result.Labels = append(result.Labels, labelResult)
+
+		var ids []string
+		if state.Complete && !opts.Full && manifest.HistoryID != 0 {
+			ids, _, err = syncer.ListHistory(ctx, manifest.HistoryID, label.ID)
+		}
+		if !state.Complete || opts.Full || manifest.HistoryID == 0 || errors.Is(err, gmailclient.ErrHistoryExpired) {
+			labelResult.Mode = "full"
+			ids, err = syncer.ListLabelMessages(ctx, label.ID)
+			// Oldest first, so the mbox reads in order
+			slices.Reverse(ids)
+		}
+		if err != nil {
+			manifest.save(dir)
+			return nil, fmt.Errorf("failed to list %s: %v", label.Name, err)
+		}
+
+		stopped := false
+		for _, id := range ids {
+			if entry, ok := manifest.Messages[id]; ok && slices.Contains(entry.Mboxes, state.File) {
+				continue
+			}
+			if opts.MaxMessages > 0 && result.Added >= opts.MaxMessages {
+				stopped = true
+				break
+			}
+			if err := ctx.Err(); err != nil {
+				manifest.save(dir)
+				return nil, err
+			}
+			saved, err := backupMessage(ctx, client, dir, manifest, id, state.File)
+			if err != nil {
+				result.Failed = append(result.Failed, fmt.Sprintf("%s: %v", id, err))
+				continue
+			}
+			if !saved {
+				continue
+			}
+			state.Messages++
+			labelResult.Added++
+			result.Added++
+			if sinceSave++; sinceSave >= saveEvery {
+				if err := manifest.save(dir); err != nil {
+					return nil, err
+				}
+				sinceSave = 0
+			}
+		}
+		labelResult.Total = state.Messages
+		if stopped {
+			result.Remaining = true
+		} else if labelResult.Mode == "full" && len(result.Failed) == 0 {
+			state.Complete = true
+		}
+	}
+
+	// Only move on in history once everything before this point is saved
+	if !result.Remaining && len(result.Failed) == 0 {
+		manifest.HistoryID = profile.HistoryId
+	}
+	result.HistoryID = manifest.HistoryID
+	if err := manifest.save(dir); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(filepath.Join(dir, RestoreFile), []byte(restoreInstructions(manifest)), 0600); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// backupMessage appends one message to an mbox and, the first time it's seen, saves
+// its attachments. It reports false for a message deleted since it was listed.
+func backupMessage(ctx context.Context, client gmailclient.Client, dir string, manifest *Manifest, id, mbox string) (bool, error) {
+	message, err := client.GetMessage(ctx, id, gmailclient.GetOptions{Format: "raw"})
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) && apiErr.Code == http.StatusNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if message.Raw == "" {
+		return false, fmt.Errorf("the mailbox returned no raw message")
+	}
+	raw, err := base64.URLEncoding.DecodeString(message.Raw)
+	if err != nil {
+		if raw, err = base64.RawURLEncoding.DecodeString(strings.TrimRight(message.Raw, "=")); err != nil {
+			return false, fmt.Errorf("invalid raw message: %v", err)
+		}
+	}
+
+	entry, known := manifest.Messages[id]
+	if !known {
+		entry = &MessageEntry{}
+		if parsed, err := mail.ReadMessage(bytes.NewReader(raw)); err == nil {
+			decoder := &mime.WordDecoder{}
+			entry.From, entry.Subject = parsed.Header.Get("From"), parsed.Header.Get("Subject")
+			if decoded, err := decoder.DecodeHeader(entry.From); err == nil {
+				entry.From = decoded
+			}
+			if decoded, err := decoder.DecodeHeader(entry.Subject); err == nil {
+				entry.Subject = decoded
+			}
+		}
+		if message.InternalDate > 0 {
+			entry.Date = time.UnixMilli(message.InternalDate).UTC().Format(time.RFC3339)
+		}
+	}
+
+	if err := appendMbox(filepath.Join(dir, mbox), raw, envelopeSender(entry.From), time.UnixMilli(message.InternalDate)); err != nil {
+		return false, err
+	}
+	if !known {
+		if entry.Attachments, err = saveAttachments(dir, id, raw); err != nil {
+			return false, err
+		}
+		manifest.Messages[id] = entry
+	}
+	entry.Mboxes = append(entry.Mboxes, mbox)
+	return true, nil
+}
+
+// fromLine matches body lines that mboxrd escapes with one more '>'
+var fromLine = regexp.MustCompile(`^>*From `)
+
+// appendMbox adds a message to an mbox file in mboxrd format: a "From " separator
+// line, the message with LF line endings and "From " lines quoted, and a blank line
+func appendMbox(path string, raw []byte, sender string, date time.Time) error {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(file)
+	fmt.Fprintf(w, "From %s %s\n", sender, date.UTC().Format(time.ANSIC))
+	text := strings.TrimRight(strings.ReplaceAll(string(raw), "\r\n", "\n"), "\n")
+	for _, line := range strings.Split(text, "\n") {
+		if fromLine.MatchString(line) {
+			w.WriteByte('>')
+		}
+		w.WriteString(line)
+		w.WriteByte('\n')
+	}
+	w.WriteByte('\n')
+	if err := w.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// envelopeSender is the address for an mbox "From " line
+func envelopeSender(from string) string {
+	if address, err := mail.ParseAddress(from); err == nil && !strings.ContainsAny(address.Address, " \t") {
+		return address.Address
+	}
+	return "MAILER-DAEMON"
+}
+
+// unsafeNameChars are replaced in file names built from labels and attachments
+var unsafeNameChars = regexp.MustCompile(`[^\p{L}\p{N}._ -]`)
+
+// mboxFileName names a label's mbox after the label, e.g. "Clients-Acme.mbox",
+// avoiding the files other labels already use
+func mboxFileName(label string, labels map[string]*LabelState) string {
+	base := strings.Trim(unsafeNameChars.ReplaceAllString(strings.ReplaceAll(label, "/", "-"), "_"), ". ")
+	if base == "" {
+		base = "label"
+	}
+	used := map[string]bool{}
+	for _, state := range labels {
+		used[strings.ToLower(state.File)] = true
+	}
+	name := base + ".mbox"
+	for i := 2; used[strings.ToLower(name)]; i++ {
+		name = base + "-" + strconv.Itoa(i) + ".mbox"
+	}
+	return name
+}
+
+// saveAttachments writes a message's named attachments to attachments/<message ID>/
+// and returns their paths relative to the backup directory
+func saveAttachments(dir, messageID string, raw []byte) ([]string, error) {
+	attachments, err := gmailclient.MIMEAttachments(raw)
+	if err != nil || len(attachments) == 0 {
+		// The message itself is in the mbox either way
+		return nil, nil
+	}
+	messageDir := filepath.Join(AttachmentsDir, unsafeNameChars.ReplaceAllString(messageID, "_"))
+	if err := os.MkdirAll(filepath.Join(dir, messageDir), 0700); err != nil {
+		return nil, err
+	}
+	var paths []string
+	used := map[string]bool{}
+	for _, attachment := range attachments {
+		name := strings.Trim(unsafeNameChars.ReplaceAllString(filepath.Base(attachment.Filename), "_"), ". ")
+		if name == "" {
+			name = "attachment"
+		}
+		unique := name
+		for i := 2; used[strings.ToLower(unique)]; i++ {
+			extension := filepath.Ext(name)
+			unique = strings.TrimSuffix(name, extension) + "-" + strconv.Itoa(i) + extension
+		}
+		used[strings.ToLower(unique)] = true
+		path := filepath.Join(messageDir, unique)
+		if err := os.WriteFile(filepath.Join(dir, path), attachment.Data, 0600); err != nil {
+			return nil, err
+		}
+		paths = append(paths, filepath.ToSlash(path))
+	}
+	return paths, nil
+}
+
+// restoreInstructions explains the backup's layout and how to restore from it
+func restoreInstructions(manifest *Manifest) string {
+	var out strings.Builder
+	fmt.Fprintf(&out, "# Mail backup of %s\n\n", manifest.Account)
+	fmt.Fprintf(&out, "Last updated %s. %d messages are saved.\n\n", manifest.Updated.Format(time.RFC1123), len(manifest.Messages))
+	out.WriteString("## What's here\n\n")
+	ids := make([]string, 0, len(manifest.Labels))
+	for id := range manifest.Labels {
+		ids = append(ids, id)
+	}
+	slices.SortFunc(ids, func(a, b string) int { return strings.Compare(manifest.Labels[a].Name, manifest.Labels[b].Name) })
+	for _, id := range ids {
+		state := manifest.Labels[id]
+		status := "complete"
+		if !state.Complete {
+			status = "partial; the next backup run continues it"
+		}
+		fmt.Fprintf(&out, "- `%s`: the %q label, %d messages (%s)\n", state.File, state.Name, state.Messages, status)
+	}
+	out.WriteString(`- ` + "`attachments/<message ID>/`" + `: every attachment as a plain file, for browsing without a mail client
+- ` + "`manifest.json`" + `: every saved message with its date, sender, subject, mbox files and attachments, and the history ID the next incremental run starts from
+
+A message with several backed-up labels is in each of their mbox files. The mbox files use the mboxrd format: messages are separated by "From " lines and body lines starting with "From " are quoted with ">".
+
+## Restoring
+
+**Into a mail client:** Thunderbird (with the ImportExportTools NG add-on), Apple Mail (File > Import Mailboxes) and most other clients open mbox files directly. To put the mail back into Gmail, connect that client to the Gmail account over IMAP and drag the messages into the matching folder.
+
+**One message at a time with this server:** split an mbox into .eml files, copy the ones you need into the server's import directory and call ` + "`import_eml`" + ` with each file name (mode ` + "`import`" + ` and the label to restore to):
+
+` + "```" + `bash
+python3 - <<'EOF'
+import mailbox, os
+os.makedirs("eml", exist_ok=True)
+for i, message in enumerate(mailbox.mbox("INBOX.mbox")):
+    with open(os.path.join("eml", f"{i:06}.eml"), "wb") as f:
+        f.write(message.as_bytes())
+EOF
+` + "```" + `
+
+` + "`import_eml`" + ` skips messages whose Message-ID is already in the mailbox, so restoring more than needed is safe.
+
+**Keeping it current:** run the backup again (the ` + "`backup_mailbox`" + ` tool, or ` + "`gmail-mcp-server --backup`" + `). It only fetches mail added since the last run. Don't edit the mbox files or the manifest by hand; copy them elsewhere first.
+`)
+	return out.String()
+}
+
+// LabelIDs lists the IDs of the labels a manifest has backed up
+func (m *Manifest) LabelIDs() []string {
+	ids := make([]string, 0, len(m.Labels))
+	for id := range m.Labels {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	return ids
+}
@@ -0,0 +1,142 @@
+// Package config holds process-wide settings: command line options, the .env file
+// and the application data directory where tokens, style guides and caches live.
+package config
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+	// Time zone names must resolve on systems without a zoneinfo database, e.g. Windows
+	_ "time/tzdata"
+
+	"github.com/joho/godotenv"
+)
+
+// Version is reported to MCP clients and on the HTTP health endpoint. Release
+// builds set it, and Commit and BuildDate, with
+// -ldflags "-X auto-gmail/internal/config.Version=1.2.0 -X auto-gmail/internal/config.Commit=..."
+var Version = "1.0.0"
+
+// Commit and BuildDate identify the build; when not set at build time they are read
+// from the VCS information Go embeds in binaries built from a checkout
+var (
+	Commit    = ""
+	BuildDate = ""
+)
+
+// Options are the command line settings of the server binary
+type Options struct {
+	// UseHTTP serves MCP over HTTP instead of stdio
+	UseHTTP bool
+	// Port is the HTTP listen port
+	Port string
+	// Demo serves a generated mailbox instead of connecting to Gmail
+	Demo bool
+	// Backup runs one backup of BackupLabels (comma-separated; empty for the labels
+	// backed up before) and exits instead of serving
+	Backup       bool
+	BackupLabels string
+}
+
+// ParseArgs reads "[--http [port]] [--demo] [--backup [labels]]" from the command line arguments (without the program name)
+func ParseArgs(args []string) Options {
+	opts := Options{Port: "8080"}
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--http":
+			opts.UseHTTP = true
+			if i+1 < len(args) && !strings.HasPrefix(args[i+1], "--") {
+				opts.Port = args[i+1]
+				i++
+			}
+		case "--demo":
+			opts.Demo = true
+		case "--backup":
+			opts.Backup = true
+			if i+1 < len(args) && !strings.HasPrefix(args[i+1], "--") {
+				opts.BackupLabels = args[i+1]
+				i++
+			}
+		}
+	}
+	return opts
+}
+
+// LoadEnv loads environment variables from a .env file in the working directory, if it exists
+func LoadEnv() {
+	if err := godotenv.Load(); err == nil {
+		log.Printf("Loaded .env file")
+	}
+}
+
+// AppDataDir returns the application data directory, creating it if needed
+func AppDataDir() string {
+	var appDataDir string
+
+	if runtime.GOOS == "windows" {
+		// Windows: %APPDATA%\auto-gmail
+		appDataDir = filepath.Join(os.Getenv("APPDATA"), "auto-gmail")
+	} else {
+		// Mac/Linux: ~/.auto-gmail
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			log.Printf("Warning: Could not get home directory: %v", err)
+			return "."
+		}
+		appDataDir = filepath.Join(homeDir, ".auto-gmail")
+	}
+
+	// Ensure the directory exists
+	if err := os.MkdirAll(appDataDir, 0755); err != nil {
+		log.Printf("Warning: Could not create app data directory: %v", err)
+		return "."
+	}
+
+	return appDataDir
+}
+
+// AppFilePath returns an absolute path in the app data directory
+func AppFilePath(filename string) string {
+	return filepath.Join(AppDataDir(), filename)
+}
+
+var (
+	timeZoneOnce sync.Once
+	timeZone     *time.Location
+)
+
+// TimeZone returns the user's time zone: GMAIL_MCP_TIMEZONE (an IANA name such as
+// "Europe/Berlin") or else the system's. Timestamps in results are written in it and
+// dates in searches are read in it.
+func TimeZone() *time.Location {
+	timeZoneOnce.Do(func() {
+		timeZone = time.Local
+		name := strings.TrimSpace(os.Getenv("GMAIL_MCP_TIMEZONE"))
+		if name == "" {
+			return
+		}
+		location, err := time.LoadLocation(name)
+		if err != nil {
+			log.Printf("Warning: Invalid GMAIL_MCP_TIMEZONE %q, using %s", name, time.Local)
+			return
+		}
+		timeZone = location
+	})
+	return timeZone
+}
+
+// Provider returns the mail backend chosen with GMAIL_MCP_PROVIDER: "gmail" (the
+// default), "imap" or "outlook". Setting GMAIL_MCP_IMAP_HOST alone also selects IMAP.
+func Provider() string {
+	if provider := strings.ToLower(strings.TrimSpace(os.Getenv("GMAIL_MCP_PROVIDER"))); provider != "" {
+		return provider
+	}
+	if os.Getenv("GMAIL_MCP_IMAP_HOST") != "" {
+		return "imap"
+	}
+	return "gmail"
+}
@@ -0,0 +1,106 @@
+package extract
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// defaultCacheTTL is how long extracted attachment text is reused
+const defaultCacheTTL = 24 * time.Hour
+
+// CacheEntry is the on-disk record of one attachment's extracted text
+type CacheEntry struct {
+	MessageID   string    `json:"messageId"`
+	Filename    string    `json:"filename"`
+	Size        int64     `json:"size"`
+	MimeType    string    `json:"mimeType"`
+	TextContent string    `json:"textContent"`
+	ExtractedAt time.Time `json:"extractedAt"`
+}
+
+// Cache stores extracted attachment text in a directory, one file per attachment
+type Cache struct {
+	dir string
+}
+
+// NewCache creates a cache in dir; the directory is created on first write
+func NewCache(dir string) *Cache {
+	return &Cache{dir: dir}
+}
+
+// CacheTTL reads the cache lifetime from GMAIL_MCP_EXTRACT_CACHE_TTL (e.g. "12h", "0" disables)
+func CacheTTL() time.Duration {
+	value := os.Getenv("GMAIL_MCP_EXTRACT_CACHE_TTL")
+	if value == "" {
+		return defaultCacheTTL
+	}
+	if value == "0" {
+		return 0
+	}
+	ttl, err := time.ParseDuration(value)
+	if err != nil || ttl < 0 {
+		log.Printf("Warning: Invalid GMAIL_MCP_EXTRACT_CACHE_TTL %q, using %v", value, defaultCacheTTL)
+		return defaultCacheTTL
+	}
+	return ttl
+}
+
+// path returns the cache file for an attachment, keyed by message, filename and size
+func (c *Cache) path(messageID, filename string, size int64) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s\x00%s\x00%d", messageID, filename, size)))
+	return filepath.Join(c.dir, hex.EncodeToString(sum[:])+".json")
+}
+
+// Load returns a cached extraction that is still within its TTL
+func (c *Cache) Load(messageID, filename string, size int64) (*CacheEntry, bool) {
+	ttl := CacheTTL()
+	if ttl == 0 {
+		return nil, false
+	}
+
+	entry, ok := c.LoadStale(messageID, filename, size)
+	if !ok || time.Since(entry.ExtractedAt) > ttl {
+		return nil, false
+	}
+	return entry, true
+}
+
+// LoadStale returns a cached extraction regardless of its age, for use when the
+// attachment can't be downloaded again (e.g. while Gmail is unavailable)
+func (c *Cache) LoadStale(messageID, filename string, size int64) (*CacheEntry, bool) {
+	data, err := os.ReadFile(c.path(messageID, filename, size))
+	if err != nil {
+		return nil, false
+	}
+	var entry CacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, false
+	}
+	return &entry, true
+}
+
+// Save stores extracted text; failures only cost a future re-extraction
+func (c *Cache) Save(entry *CacheEntry) {
+	if CacheTTL() == 0 {
+		return
+	}
+	if err := os.MkdirAll(c.dir, 0700); err != nil {
+		log.Printf("Warning: Could not create extraction cache directory: %v", err)
+		return
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	// Extracted text is mailbox content, keep it private to the user
+	if err := os.WriteFile(c.path(entry.MessageID, entry.Filename, entry.Size), data, 0600); err != nil {
+		log.Printf("Warning: Could not write extraction cache: %v", err)
+	}
+}
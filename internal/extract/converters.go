@@ -0,0 +1,326 @@
+package extract
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"auto-gmail/internal/toolerr"
+)
+
+// Limits applied to every external conversion, overridable with
+// GMAIL_MCP_CONVERTER_TIMEOUT (seconds) and GMAIL_MCP_CONVERTER_MAX_BYTES
+const (
+	defaultConverterTimeout  = 60 * time.Second
+	defaultConverterMaxBytes = 25 << 20
+	// converterMaxOutput caps the text read back from a converter
+	converterMaxOutput = 10 << 20
+)
+
+// converterFormat is a format an external converter reads: its MIME types, extension
+// and the converter-specific name of the format (a pandoc reader or LibreOffice filter)
+type converterFormat struct {
+	mimeTypes []string
+	extension string
+	format    string
+}
+
+// converter is an Extractor that runs an external tool or service for formats the
+// native parsers don't handle
+type converter struct {
+	name     string
+	formats  []converterFormat
+	timeout  time.Duration
+	maxBytes int
+	// convert turns the input file into text; dir is a private temp directory
+	convert func(ctx context.Context, dir, input string, format converterFormat, data []byte) (string, error)
+}
+
+var _ FileExtractor = (*converter)(nil)
+
+func (c *converter) Name() string { return c.name }
+
+func (c *converter) MIMETypes() []string {
+	var mimeTypes []string
+	for _, format := range c.formats {
+		mimeTypes = append(mimeTypes, format.mimeTypes...)
+	}
+	return mimeTypes
+}
+
+func (c *converter) Extensions() []string {
+	var extensions []string
+	for _, format := range c.formats {
+		extensions = append(extensions, format.extension)
+	}
+	return extensions
+}
+
+// Extract converts data without knowing its format; ExtractFile is used instead
+// whenever the MIME type or filename is known
+func (c *converter) Extract(data []byte) (string, error) {
+	return c.ExtractFile(data, "", "")
+}
+
+// ExtractFile writes the attachment to a fresh temp directory, converts it within the
+// timeout and size limits, and removes the directory again
+func (c *converter) ExtractFile(data []byte, mimeType, filename string) (string, error) {
+	if len(data) > c.maxBytes {
+		return "", toolerr.Errorf(toolerr.InvalidInput, "too_large", "%s is %d bytes, over the %d byte limit for %s conversion", filename, len(data), c.maxBytes, c.name)
+	}
+	format, ok := c.formatFor(mimeType, filename)
+	if !ok {
+		return "", toolerr.Errorf(toolerr.ParseFailure, "unsupported_file_type", "%s can't convert %s (%s)", c.name, filename, mimeType)
+	}
+
+	dir, err := os.MkdirTemp("", "gmail-mcp-convert-")
+	if err != nil {
+		return "", fmt.Errorf("failed to create conversion directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	// Never pass the attachment's own name to a tool; it could be anything
+	input := filepath.Join(dir, "input"+format.extension)
+	if err := os.WriteFile(input, data, 0600); err != nil {
+		return "", fmt.Errorf("failed to write conversion input: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+	text, err := c.convert(ctx, dir, input, format, data)
+	if ctx.Err() == context.DeadlineExceeded {
+		return "", toolerr.Errorf(toolerr.Unavailable, "timeout", "%s conversion of %s timed out after %s", c.name, filename, c.timeout)
+	}
+	if err != nil {
+		return "", toolerr.Errorf(toolerr.ParseFailure, "conversion_failed", "%s conversion of %s failed: %v", c.name, filename, err)
+	}
+	if strings.TrimSpace(text) == "" {
+		return "", toolerr.Errorf(toolerr.ParseFailure, "no_text", "no text could be extracted from %s", filename)
+	}
+	return text, nil
+}
+
+// formatFor picks the format by MIME type, then by extension
+func (c *converter) formatFor(mimeType, filename string) (converterFormat, bool) {
+	extension := strings.ToLower(filepath.Ext(filename))
+	for _, format := range c.formats {
+		if containsFold(format.mimeTypes, mimeType) {
+			return format, true
+		}
+	}
+	for _, format := range c.formats {
+		if extension == format.extension {
+			return format, true
+		}
+	}
+	return converterFormat{}, false
+}
+
+// runSandboxed runs a converter command in dir with a minimal environment (HOME and
+// TMPDIR pointing at dir) and returns its stdout, capped at converterMaxOutput
+func runSandboxed(ctx context.Context, dir string, name string, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Dir = dir
+	cmd.Env = []string{"PATH=" + os.Getenv("PATH"), "HOME=" + dir, "TMPDIR=" + dir, "LANG=C.UTF-8"}
+	// Don't wait forever for children that keep the pipes open after a kill
+	cmd.WaitDelay = 5 * time.Second
+	var stdout, stderr limitedBuffer
+	stdout.limit, stderr.limit = converterMaxOutput, 4096
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return nil, fmt.Errorf("%v: %s", err, message)
+		}
+		return nil, err
+	}
+	return stdout.Bytes(), nil
+}
+
+// limitedBuffer keeps the first limit bytes written and discards the rest
+type limitedBuffer struct {
+	bytes.Buffer
+	limit int
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := b.limit - b.Len(); room > 0 {
+		b.Buffer.Write(p[:min(len(p), room)])
+	}
+	return len(p), nil
+}
+
+// readCapped reads at most converterMaxOutput bytes of a converter's output file
+func readCapped(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	data, err := io.ReadAll(io.LimitReader(f, converterMaxOutput))
+	return string(data), err
+}
+
+// Formats each converter claims. PDF, DOCX and plain text stay with the native parsers.
+var (
+	officeDocumentFormats = []converterFormat{
+		{[]string{"application/msword"}, ".doc", "txt:Text"},
+		{[]string{"application/rtf", "text/rtf"}, ".rtf", "txt:Text"},
+		{[]string{"application/vnd.oasis.opendocument.text"}, ".odt", "txt:Text"},
+		{[]string{"application/vnd.ms-excel"}, ".xls", "csv"},
+		{[]string{"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"}, ".xlsx", "csv"},
+		{[]string{"application/vnd.oasis.opendocument.spreadsheet"}, ".ods", "csv"},
+		{[]string{"application/vnd.ms-powerpoint"}, ".ppt", "pdf"},
+		{[]string{"application/vnd.openxmlformats-officedocument.presentationml.presentation"}, ".pptx", "pdf"},
+		{[]string{"application/vnd.oasis.opendocument.presentation"}, ".odp", "pdf"},
+	}
+	pandocFormats = []converterFormat{
+		{[]string{"application/epub+zip"}, ".epub", "epub"},
+		{[]string{"application/rtf", "text/rtf"}, ".rtf", "rtf"},
+		{[]string{"application/vnd.oasis.opendocument.text"}, ".odt", "odt"},
+		{[]string{"text/html"}, ".html", "html"},
+		{[]string{"text/markdown"}, ".md", "markdown"},
+		{[]string{"text/x-rst"}, ".rst", "rst"},
+		{[]string{"text/x-org"}, ".org", "org"},
+		{[]string{"application/x-latex", "text/x-tex"}, ".tex", "latex"},
+	}
+	tikaFormats = append(append([]converterFormat{
+		{[]string{"application/vnd.ms-outlook"}, ".msg", ""},
+		{[]string{"message/rfc822"}, ".eml", ""},
+		{[]string{"application/vnd.apple.pages"}, ".pages", ""},
+		{[]string{"application/vnd.visio"}, ".vsd", ""},
+	}, officeDocumentFormats...), pandocFormats...)
+)
+
+// convertersFromEnv builds the external converters that are configured:
+//
+//	GMAIL_MCP_TIKA_URL      Apache Tika server, e.g. http://localhost:9998
+//	GMAIL_MCP_LIBREOFFICE   path to soffice, or 1 to find it on PATH
+//	GMAIL_MCP_PANDOC        path to pandoc, or 1 to find it on PATH
+//
+// When several handle a format, Tika is preferred over LibreOffice over pandoc.
+func convertersFromEnv() []Extractor {
+	timeout, maxBytes := converterLimits()
+
+	// Lookup prefers later entries
+	var converters []Extractor
+	if pandoc := converterBinary("GMAIL_MCP_PANDOC", "pandoc"); pandoc != "" {
+		converters = append(converters, &converter{name: "pandoc", formats: pandocFormats, timeout: timeout, maxBytes: maxBytes, convert: pandocConvert(pandoc)})
+	}
+	if soffice := converterBinary("GMAIL_MCP_LIBREOFFICE", "soffice", "libreoffice"); soffice != "" {
+		converters = append(converters, &converter{name: "libreoffice", formats: officeDocumentFormats, timeout: timeout, maxBytes: maxBytes, convert: libreOfficeConvert(soffice)})
+	}
+	if tikaURL := strings.TrimSuffix(os.Getenv("GMAIL_MCP_TIKA_URL"), "/"); tikaURL != "" {
+		converters = append(converters, &converter{name: "tika", formats: tikaFormats, timeout: timeout, maxBytes: maxBytes, convert: tikaConvert(tikaURL)})
+	}
+	for _, c := range converters {
+		log.Printf("📄 Using %s for extra attachment formats", c.Name())
+	}
+	return converters
+}
+
+// converterLimits returns the timeout and input size cap for external tools
+func converterLimits() (time.Duration, int) {
+	timeout, maxBytes := defaultConverterTimeout, defaultConverterMaxBytes
+	if seconds, err := strconv.Atoi(os.Getenv("GMAIL_MCP_CONVERTER_TIMEOUT")); err == nil && seconds > 0 {
+		timeout = time.Duration(seconds) * time.Second
+	}
+	if limit, err := strconv.Atoi(os.Getenv("GMAIL_MCP_CONVERTER_MAX_BYTES")); err == nil && limit > 0 {
+		maxBytes = limit
+	}
+	return timeout, maxBytes
+}
+
+// converterBinary resolves a converter setting: a path, or "1" to look the command up
+func converterBinary(envVar string, commands ...string) string {
+	value := strings.TrimSpace(os.Getenv(envVar))
+	if value == "" || value == "0" {
+		return ""
+	}
+	if value != "1" {
+		return value
+	}
+	for _, command := range commands {
+		if path, err := exec.LookPath(command); err == nil {
+			return path
+		}
+	}
+	log.Printf("Warning: %s=1 but %s isn't on PATH", envVar, commands[0])
+	return ""
+}
+
+// pandocConvert runs pandoc with --sandbox, which stops it reading other files or the network
+func pandocConvert(pandoc string) func(context.Context, string, string, converterFormat, []byte) (string, error) {
+	return func(ctx context.Context, dir, input string, format converterFormat, data []byte) (string, error) {
+		output, err := runSandboxed(ctx, dir, pandoc, "--sandbox", "-f", format.format, "-t", "plain", "--wrap=none", input)
+		return string(output), err
+	}
+}
+
+// libreOfficeConvert runs headless LibreOffice with a throwaway profile. Spreadsheets
+// become CSV and presentations PDF, which is then read by the native PDF parser.
+func libreOfficeConvert(soffice string) func(context.Context, string, string, converterFormat, []byte) (string, error) {
+	return func(ctx context.Context, dir, input string, format converterFormat, data []byte) (string, error) {
+		output, err := libreOfficeExport(ctx, soffice, dir, input, format.format)
+		if err != nil {
+			return "", err
+		}
+		if strings.HasSuffix(output, ".pdf") {
+			pdfData, err := os.ReadFile(output)
+			if err != nil {
+				return "", err
+			}
+			return extractPDFText(pdfData)
+		}
+		return readCapped(output)
+	}
+}
+
+// libreOfficeExport converts input (named "input.<ext>" in dir) with a LibreOffice
+// export filter such as "pdf" and returns the output file's path
+func libreOfficeExport(ctx context.Context, soffice, dir, input, filter string) (string, error) {
+	outDir := filepath.Join(dir, "out")
+	_, err := runSandboxed(ctx, dir, soffice,
+		"--headless", "--norestore", "--nolockcheck",
+		"-env:UserInstallation=file://"+filepath.ToSlash(filepath.Join(dir, "profile")),
+		"--convert-to", filter, "--outdir", outDir, input)
+	if err != nil {
+		return "", err
+	}
+	extension, _, _ := strings.Cut(filter, ":")
+	return filepath.Join(outDir, "input."+extension), nil
+}
+
+// tikaConvert sends the file to a Tika server's /tika endpoint for plain text
+func tikaConvert(tikaURL string) func(context.Context, string, string, converterFormat, []byte) (string, error) {
+	return func(ctx context.Context, dir, input string, format converterFormat, data []byte) (string, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPut, tikaURL+"/tika", bytes.NewReader(data))
+		if err != nil {
+			return "", err
+		}
+		req.Header.Set("Accept", "text/plain")
+		if len(format.mimeTypes) > 0 {
+			req.Header.Set("Content-Type", format.mimeTypes[0])
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+		text, err := io.ReadAll(io.LimitReader(resp.Body, converterMaxOutput))
+		if err != nil {
+			return "", err
+		}
+		if resp.StatusCode != http.StatusOK {
+			return "", toolerr.Errorf(toolerr.Unavailable, "converter_unavailable", "Tika returned %s", resp.Status)
+		}
+		return string(text), nil
+	}
+}
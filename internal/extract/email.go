@@ -0,0 +1,281 @@
+package extract
+
+import (
+	"encoding/base64"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+
+	htmltomarkdown "github.com/JohannesKaufmann/html-to-markdown/v2"
+	"google.golang.org/api/gmail/v1"
+)
+
+// EmailBody extracts readable text from a Gmail message, preserving links and semantic information
+func EmailBody(msg *gmail.Message) string {
+	if msg.Payload == nil {
+		return ""
+	}
+
+	// Try to get content from message body or parts
+	var plainTextContent, htmlContent string
+
+	// Check if there's direct body content
+	if msg.Payload.Body != nil && msg.Payload.Body.Data != "" {
+		decoded, err := DecodeEmailContent(msg.Payload.Body.Data)
+		if err == nil {
+			if msg.Payload.MimeType == "text/html" {
+				htmlContent = decoded
+			} else {
+				plainTextContent = decoded
+			}
+		}
+	}
+
+	// For multipart messages, extract from parts
+	if len(msg.Payload.Parts) > 0 {
+		plainFromParts, htmlFromParts := extractFromParts(msg.Payload.Parts)
+		if plainFromParts != "" {
+			plainTextContent = plainFromParts
+		}
+		if htmlFromParts != "" {
+			htmlContent = htmlFromParts
+		}
+	}
+
+	// Prefer HTML content when available since it contains more semantic information
+	if htmlContent != "" {
+		return HTMLToMarkdown(htmlContent)
+	}
+
+	return plainTextContent
+}
+
+// extractFromParts recursively extracts both plain text and HTML content from message parts
+func extractFromParts(parts []*gmail.MessagePart) (plainText, htmlText string) {
+	for _, part := range parts {
+		if part.Body != nil && part.Body.Data != "" {
+			decoded, err := DecodeEmailContent(part.Body.Data)
+			if err != nil {
+				continue
+			}
+
+			switch part.MimeType {
+			case "text/plain":
+				if plainText == "" { // Take the first plain text part
+					plainText = decoded
+				}
+			case "text/html":
+				if htmlText == "" { // Take the first HTML part
+					htmlText = decoded
+				}
+			}
+		}
+
+		// Recursively check nested parts
+		if len(part.Parts) > 0 {
+			nestedPlain, nestedHTML := extractFromParts(part.Parts)
+			if plainText == "" && nestedPlain != "" {
+				plainText = nestedPlain
+			}
+			if htmlText == "" && nestedHTML != "" {
+				htmlText = nestedHTML
+			}
+		}
+	}
+	return plainText, htmlText
+}
+
+// DecodeEmailContent decodes base64url or base64 encoded email content
+func DecodeEmailContent(data string) (string, error) {
+	// Try base64url decoding first (Gmail's preferred encoding)
+	decoded, err := base64.URLEncoding.DecodeString(data)
+	if err != nil {
+		// Try standard base64 if URL encoding fails
+		decoded, err = base64.StdEncoding.DecodeString(data)
+		if err != nil {
+			return "", err
+		}
+	}
+	return string(decoded), nil
+}
+
+// HTMLToMarkdown uses html-to-markdown library to convert HTML to proper markdown with preserved links
+func HTMLToMarkdown(htmlContent string) (result string) {
+	// Malformed HTML must not crash the server; fall back to the raw HTML like other conversion failures
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("Recovered from panic while converting HTML to markdown: %v", r)
+			result = htmlContent
+		}
+	}()
+
+	// Use JohannesKaufmann/html-to-markdown/v2 library for proper markdown conversion
+	markdown, err := htmltomarkdown.ConvertString(htmlContent)
+	if err != nil {
+		// Fallback to returning the HTML as-is if conversion fails
+		return htmlContent
+	}
+
+	return strings.TrimSpace(markdown)
+}
+
+// AttachmentInfo extracts attachment information from a Gmail message
+func AttachmentInfo(message *gmail.Message) []map[string]interface{} {
+	var attachments []map[string]interface{}
+
+	if message.Payload == nil {
+		return attachments
+	}
+
+	// Check payload parts for attachments
+	extractAttachmentsFromParts(message.Payload.Parts, &attachments)
+
+	return attachments
+}
+
+// DedupeAttachments collapses copies of the same file across the messages of a thread
+// (signature logos, contracts re-sent in every reply) into the first occurrence, which
+// gets "copies" and "copyMessageIds" listing where the others are. Gmail doesn't expose
+// content hashes without downloading, so copies are matched by filename, MIME type and
+// exact byte size. Each attachment must carry a "messageId".
+func DedupeAttachments(attachments []map[string]interface{}) []map[string]interface{} {
+	var deduped []map[string]interface{}
+	first := map[string]map[string]interface{}{}
+	for _, attachment := range attachments {
+		key := fmt.Sprintf("%v\x00%v\x00%v", attachment["filename"], attachment["mimeType"], attachment["size"])
+		original, seen := first[key]
+		if !seen {
+			first[key] = attachment
+			deduped = append(deduped, attachment)
+			continue
+		}
+		ids, _ := original["copyMessageIds"].([]string)
+		if messageID, _ := attachment["messageId"].(string); messageID != original["messageId"] && !slices.Contains(ids, messageID) {
+			ids = append(ids, messageID)
+		}
+		original["copyMessageIds"] = ids
+		copies, _ := original["copies"].(int)
+		original["copies"] = max(copies, 1) + 1
+	}
+	return deduped
+}
+
+// tinyImageSize is the size below which an image is treated as an icon or tracking pixel
+const tinyImageSize = 10 * 1024
+
+// noiseMimeTypes are attachment types that carry no content for the reader
+var noiseMimeTypes = map[string]bool{
+	"application/pkcs7-signature":   true,
+	"application/x-pkcs7-signature": true,
+	"application/pgp-signature":     true,
+	"application/pgp-keys":          true,
+	"application/ms-tnef":           true,
+}
+
+// IsNoiseAttachment reports whether an attachment from AttachmentInfo is clutter
+// rather than a file someone meant to send: S/MIME and PGP signatures, winmail.dat,
+// images embedded inline in the body, and tiny images such as icons and pixels.
+func IsNoiseAttachment(attachment map[string]interface{}) bool {
+	mimeType, _ := attachment["mimeType"].(string)
+	mimeType = strings.ToLower(mimeType)
+	filename, _ := attachment["filename"].(string)
+	filename = strings.ToLower(filename)
+	if noiseMimeTypes[mimeType] || filename == "smime.p7s" || filename == "winmail.dat" {
+		return true
+	}
+	if !strings.HasPrefix(mimeType, "image/") {
+		return false
+	}
+	if inline, _ := attachment["inline"].(bool); inline {
+		return true
+	}
+	size, _ := attachment["size"].(int64)
+	return size > 0 && size < tinyImageSize
+}
+
+// FilterNoiseAttachments drops the attachments IsNoiseAttachment flags and returns how many were hidden
+func FilterNoiseAttachments(attachments []map[string]interface{}) ([]map[string]interface{}, int) {
+	var kept []map[string]interface{}
+	for _, attachment := range attachments {
+		if !IsNoiseAttachment(attachment) {
+			kept = append(kept, attachment)
+		}
+	}
+	return kept, len(attachments) - len(kept)
+}
+
+// isInlinePart reports whether a part is meant to be shown in the body rather than
+// offered as a download: an inline Content-Disposition, or a Content-ID (referenced
+// by cid: URLs in the HTML) without an attachment disposition
+func isInlinePart(part *gmail.MessagePart) bool {
+	var disposition, contentID string
+	for _, header := range part.Headers {
+		switch strings.ToLower(header.Name) {
+		case "content-disposition":
+			disposition = strings.ToLower(strings.TrimSpace(header.Value))
+		case "content-id":
+			contentID = header.Value
+		}
+	}
+	if strings.HasPrefix(disposition, "inline") {
+		return true
+	}
+	return contentID != "" && !strings.HasPrefix(disposition, "attachment")
+}
+
+// extractAttachmentsFromParts recursively extracts attachment info from message parts
+func extractAttachmentsFromParts(parts []*gmail.MessagePart, attachments *[]map[string]interface{}) {
+	for _, part := range parts {
+		// Check if this part is an attachment
+		if part.Body != nil && part.Body.AttachmentId != "" {
+			filename := part.Filename
+			if filename == "" {
+				filename = "unnamed_attachment"
+			}
+
+			attachment := map[string]interface{}{
+				"attachmentId": part.Body.AttachmentId,
+				"filename":     filename,
+				"mimeType":     part.MimeType,
+				"size":         part.Body.Size,
+			}
+
+			// Mark if this is a document we can extract text from
+			if IsExtractableDocument(part.MimeType, filename) {
+				attachment["extractable"] = true
+			}
+
+			// Mark parts shown in the body (signature logos, embedded screenshots)
+			if isInlinePart(part) {
+				attachment["inline"] = true
+			}
+
+			*attachments = append(*attachments, attachment)
+		}
+
+		// Recursively check nested parts
+		if len(part.Parts) > 0 {
+			extractAttachmentsFromParts(part.Parts, attachments)
+		}
+	}
+}
+
+// IsExtractableDocument checks if an enabled extractor handles this document type
+func IsExtractableDocument(mimeType, filename string) bool {
+	_, enabled := Lookup(mimeType, filename)
+	return enabled
+}
+
+// FindAttachmentPart recursively finds the attachment part by attachment ID
+func FindAttachmentPart(parts []*gmail.MessagePart, attachmentID string, result **gmail.MessagePart) {
+	for _, part := range parts {
+		if part.Body != nil && part.Body.AttachmentId == attachmentID {
+			*result = part
+			return
+		}
+		if len(part.Parts) > 0 {
+			FindAttachmentPart(part.Parts, attachmentID, result)
+		}
+	}
+}
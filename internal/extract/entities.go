@@ -0,0 +1,276 @@
+package extract
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Entities is the structured data found in an email or attachment
+type Entities struct {
+	Amounts         []Amount         `json:"amounts,omitempty"`
+	Dates           []Date           `json:"dates,omitempty"`
+	References      []Reference      `json:"references,omitempty"`
+	TrackingNumbers []TrackingNumber `json:"trackingNumbers,omitempty"`
+	Flights         []string         `json:"flights,omitempty"`
+	Addresses       []string         `json:"addresses,omitempty"`
+}
+
+// Amount is a money amount; Label says what it is ("total", "amount due", ...) when the text does
+type Amount struct {
+	Value    float64 `json:"value"`
+	Currency string  `json:"currency"`
+	Label    string  `json:"label,omitempty"`
+	Text     string  `json:"text"`
+}
+
+// Date is a calendar date normalized to YYYY-MM-DD; Label is e.g. "due" or "departure"
+type Date struct {
+	Date  string `json:"date"`
+	Label string `json:"label,omitempty"`
+	Text  string `json:"text"`
+}
+
+// Reference is an order, invoice or booking confirmation number
+type Reference struct {
+	Kind  string `json:"kind"`
+	Value string `json:"value"`
+}
+
+// TrackingNumber is a parcel tracking number; Carrier is "" when it can't be told from the format
+type TrackingNumber struct {
+	Carrier string `json:"carrier,omitempty"`
+	Number  string `json:"number"`
+}
+
+var (
+	currencySymbols = map[string]string{"$": "USD", "€": "EUR", "£": "GBP", "₹": "INR", "¥": "JPY"}
+	amountPattern   = regexp.MustCompile(`(?i)(?:\b(USD|EUR|GBP|INR|CAD|AUD|JPY|CHF)\s?|([$€£₹¥]))\s?(\d{1,3}(?:[,.' ]\d{3})+(?:[.,]\d{1,2})?|\d+(?:[.,]\d{1,2})?)\b`)
+	amountSuffix    = regexp.MustCompile(`(?i)\b(\d{1,3}(?:[,.' ]\d{3})+(?:[.,]\d{1,2})?|\d+(?:[.,]\d{1,2})?)\s?(USD|EUR|GBP|INR|CAD|AUD|JPY|CHF|€)`)
+	amountLabels    = []string{"amount due", "balance due", "total due", "subtotal", "grand total", "total", "tax", "shipping", "balance", "refund", "paid", "price", "fee"}
+
+	monthNames   = `(?:jan|feb|mar|apr|may|jun|jul|aug|sep|sept|oct|nov|dec)[a-z]*\.?`
+	datePatterns = []struct {
+		pattern *regexp.Regexp
+		layouts []string
+	}{
+		{regexp.MustCompile(`\b\d{4}-\d{2}-\d{2}\b`), []string{"2006-01-02"}},
+		{regexp.MustCompile(`(?i)\b` + monthNames + `\s+\d{1,2}(?:st|nd|rd|th)?,?\s+\d{4}\b`), []string{"January 2 2006", "Jan 2 2006"}},
+		{regexp.MustCompile(`(?i)\b\d{1,2}(?:st|nd|rd|th)?\s+` + monthNames + `,?\s+\d{4}\b`), []string{"2 January 2006", "2 Jan 2006"}},
+		{regexp.MustCompile(`\b\d{1,2}/\d{1,2}/\d{4}\b`), []string{"1/2/2006"}}, // US order
+	}
+	dateLabels = map[string]string{
+		"due": "due", "pay by": "due", "deliver": "delivery", "arriv": "arrival", "depart": "departure",
+		"check-in": "check-in", "check in": "check-in", "check-out": "check-out", "expir": "expiry",
+		"renew": "renewal", "ship": "shipping", "invoice date": "invoice", "order date": "order",
+		"pick-up": "pick-up", "pick up": "pick-up", "pickup": "pick-up", "drop-off": "drop-off", "drop off": "drop-off",
+	}
+	ordinalSuffix = regexp.MustCompile(`(?i)(\d)(st|nd|rd|th)`)
+
+	referencePatterns = []struct {
+		kind    string
+		pattern *regexp.Regexp
+	}{
+		{"order", regexp.MustCompile(`(?i)\border\s*(?:number|no\.?|#|id)?\s*[:#]?\s*([A-Z0-9][A-Z0-9-]{4,})`)},
+		{"invoice", regexp.MustCompile(`(?i)\binvoice\s*(?:number|no\.?|#|id)?\s*[:#]?\s*([A-Z0-9][A-Z0-9-]{3,})`)},
+		{"confirmation", regexp.MustCompile(`(?i)\b(?:confirmation|booking|reservation|record locator|pnr)\s*(?:code|number|no\.?|#)?\s*[:#]?\s*([A-Z0-9]{5,10})\b`)},
+	}
+
+	trackingPatterns = []struct {
+		carrier string
+		pattern *regexp.Regexp
+	}{
+		{"UPS", regexp.MustCompile(`\b1Z[0-9A-Z]{16}\b`)},
+		{"USPS", regexp.MustCompile(`\b9[2-5]\d{20}\b`)},
+		{"", regexp.MustCompile(`(?i)\btracking\s*(?:number|no\.?|#|id)?\s*[:#]?\s*([A-Z0-9]{10,30})\b`)},
+	}
+	trackingContext  = regexp.MustCompile(`(?i)\b(fedex|dhl|ups|usps|royal mail|canada post)\b`)
+	trackingCarriers = map[string]string{"fedex": "FedEx", "dhl": "DHL", "ups": "UPS", "usps": "USPS", "royal mail": "Royal Mail", "canada post": "Canada Post"}
+
+	flightPattern  = regexp.MustCompile(`(?i)\bflight\s*(?:number|no\.?|#)?\s*:?\s*([A-Z][A-Z0-9]|[0-9][A-Z])\s?(\d{1,4})\b`)
+	addressPattern = regexp.MustCompile(`\b\d{1,6}\s+(?:[A-Z][A-Za-z0-9.'-]*\s+){1,4}(?:Street|St|Avenue|Ave|Road|Rd|Boulevard|Blvd|Lane|Ln|Drive|Dr|Court|Ct|Way|Place|Pl|Parkway|Pkwy|Highway|Hwy)\.?(?:,?\s+(?:Suite|Ste|Apt|Unit|#)\.?\s*[A-Za-z0-9-]+)?(?:,\s*[A-Z][A-Za-z .]+,\s*[A-Z]{2}\s+\d{5}(?:-\d{4})?)?`)
+)
+
+// ExtractEntities finds money amounts, dates, order/invoice/confirmation numbers,
+// tracking numbers, flight numbers and street addresses in text with regular expressions
+func ExtractEntities(text string) *Entities {
+	entities := &Entities{
+		Amounts:         findAmounts(text),
+		Dates:           findDates(text),
+		References:      findReferences(text),
+		TrackingNumbers: findTrackingNumbers(text),
+	}
+
+	seen := map[string]bool{}
+	for _, match := range flightPattern.FindAllStringSubmatch(text, -1) {
+		flight := strings.ToUpper(match[1]) + match[2]
+		if !seen[flight] {
+			seen[flight] = true
+			entities.Flights = append(entities.Flights, flight)
+		}
+	}
+	for _, match := range addressPattern.FindAllString(text, -1) {
+		address := strings.Join(strings.Fields(match), " ")
+		if !seen[address] {
+			seen[address] = true
+			entities.Addresses = append(entities.Addresses, address)
+		}
+	}
+	return entities
+}
+
+// findAmounts returns currency amounts in the order they appear, labeled by the text before them
+func findAmounts(text string) []Amount {
+	var amounts []Amount
+	seen := map[string]bool{}
+	add := func(start int, match, number, currency string) {
+		value, ok := parseAmount(number)
+		if !ok {
+			return
+		}
+		label := labelBefore(text, start, amountLabels)
+		key := currency + strconv.FormatFloat(value, 'f', 2, 64) + label
+		if seen[key] {
+			return
+		}
+		seen[key] = true
+		amounts = append(amounts, Amount{Value: value, Currency: currency, Label: label, Text: strings.TrimSpace(match)})
+	}
+
+	for _, loc := range amountPattern.FindAllStringSubmatchIndex(text, -1) {
+		currency := strings.ToUpper(submatch(text, loc, 1))
+		if symbol := submatch(text, loc, 2); symbol != "" {
+			currency = currencySymbols[symbol]
+		}
+		add(loc[0], text[loc[0]:loc[1]], submatch(text, loc, 3), currency)
+	}
+	for _, loc := range amountSuffix.FindAllStringSubmatchIndex(text, -1) {
+		currency := strings.ToUpper(submatch(text, loc, 2))
+		if symbol, ok := currencySymbols[currency]; ok {
+			currency = symbol
+		}
+		add(loc[0], text[loc[0]:loc[1]], submatch(text, loc, 1), currency)
+	}
+	return amounts
+}
+
+// parseAmount reads "1,234.56", "1.234,56" or "1 234" as a number; a separator
+// followed by one or two final digits is the decimal point
+func parseAmount(number string) (float64, bool) {
+	decimal := ""
+	if i := strings.LastIndexAny(number, ".,"); i >= 0 && len(number)-i-1 <= 2 {
+		number, decimal = number[:i], number[i+1:]
+	}
+	number = strings.NewReplacer(",", "", ".", "", "'", "", " ", "").Replace(number)
+	if decimal != "" {
+		number += "." + decimal
+	}
+	value, err := strconv.ParseFloat(number, 64)
+	return value, err == nil
+}
+
+// findDates returns the dates in text normalized to YYYY-MM-DD, labeled by the text before them
+func findDates(text string) []Date {
+	var dates []Date
+	seen := map[string]bool{}
+	for _, format := range datePatterns {
+		for _, loc := range format.pattern.FindAllStringIndex(text, -1) {
+			match := text[loc[0]:loc[1]]
+			normalized := ordinalSuffix.ReplaceAllString(strings.NewReplacer(",", "", ".", "").Replace(match), "$1")
+			// Parse matches month names case-insensitively but wants "Sep", not "Sept"
+			normalized = strings.Replace(strings.Join(strings.Fields(strings.ToLower(normalized)), " ")+" ", "sept ", "sep ", 1)
+			normalized = strings.TrimSpace(normalized)
+			for _, layout := range format.layouts {
+				parsed, err := time.Parse(layout, normalized)
+				if err != nil {
+					continue
+				}
+				var label, labelKeyword string
+				before := strings.ToLower(lineBefore(text, loc[0]))
+				for keyword, name := range dateLabels {
+					if strings.Contains(before, keyword) && (len(keyword) > len(labelKeyword) || (len(keyword) == len(labelKeyword) && keyword < labelKeyword)) {
+						label, labelKeyword = name, keyword
+					}
+				}
+				date := Date{Date: parsed.Format("2006-01-02"), Label: label, Text: match}
+				if !seen[date.Date+label] {
+					seen[date.Date+label] = true
+					dates = append(dates, date)
+				}
+				break
+			}
+		}
+	}
+	return dates
+}
+
+// findReferences returns order, invoice and booking confirmation numbers; values must contain a digit
+func findReferences(text string) []Reference {
+	var references []Reference
+	seen := map[string]bool{}
+	for _, ref := range referencePatterns {
+		for _, match := range ref.pattern.FindAllStringSubmatch(text, -1) {
+			value := strings.ToUpper(strings.TrimRight(match[1], "-"))
+			if !strings.ContainsAny(value, "0123456789") || seen[ref.kind+value] {
+				continue
+			}
+			seen[ref.kind+value] = true
+			references = append(references, Reference{Kind: ref.kind, Value: value})
+		}
+	}
+	return references
+}
+
+// findTrackingNumbers returns parcel tracking numbers, naming the carrier from the format or nearby text
+func findTrackingNumbers(text string) []TrackingNumber {
+	var numbers []TrackingNumber
+	seen := map[string]bool{}
+	for _, tracking := range trackingPatterns {
+		for _, loc := range tracking.pattern.FindAllStringSubmatchIndex(text, -1) {
+			number := text[loc[0]:loc[1]]
+			if len(loc) > 2 && loc[2] >= 0 {
+				number = text[loc[2]:loc[3]]
+			}
+			number = strings.ToUpper(number)
+			if seen[number] || !strings.ContainsAny(number, "0123456789") {
+				continue
+			}
+			seen[number] = true
+
+			carrier := tracking.carrier
+			if carrier == "" {
+				match := trackingContext.FindString(lineBefore(text, loc[0]))
+				carrier = trackingCarriers[strings.ToLower(match)]
+			}
+			numbers = append(numbers, TrackingNumber{Carrier: carrier, Number: number})
+		}
+	}
+	return numbers
+}
+
+// labelBefore returns the longest label that appears earlier on the same line as position start
+func labelBefore(text string, start int, labels []string) string {
+	before := strings.ToLower(lineBefore(text, start))
+	var best string
+	for _, label := range labels {
+		if strings.Contains(before, label) && len(label) > len(best) {
+			best = label
+		}
+	}
+	return best
+}
+
+// lineBefore returns the text from the start of the line containing position start up to it
+func lineBefore(text string, start int) string {
+	lineStart := strings.LastIndex(text[:start], "\n") + 1
+	return text[lineStart:start]
+}
+
+// submatch returns group n of a FindAllStringSubmatchIndex match, or ""
+func submatch(text string, loc []int, n int) string {
+	if loc[2*n] < 0 {
+		return ""
+	}
+	return text[loc[2*n]:loc[2*n+1]]
+}
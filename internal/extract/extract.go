@@ -0,0 +1,187 @@
+// Package extract turns Gmail message parts and attachments (PDF, DOCX, plain text,
+// HTML, and any format added with Register) into plain text, and caches extracted
+// attachment text on disk.
+package extract
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+
+	"auto-gmail/internal/toolerr"
+
+	"github.com/ledongthuc/pdf"
+)
+
+// ErrMalformedFile is returned when a parser panics on a corrupt attachment
+var ErrMalformedFile = errors.New("extraction failed: malformed file")
+
+// TextFromBytes extracts text from attachment bytes based on MIME type.
+// The PDF and DOCX parsers can panic on malformed input, so any panic is turned into ErrMalformedFile.
+func TextFromBytes(data []byte, mimeType, filename string) (text string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("Recovered from panic while extracting %s (%s): %v", filename, mimeType, r)
+			text = ""
+			err = toolerr.Errorf(toolerr.ParseFailure, "malformed_file", "%w: %s could not be parsed as %s", ErrMalformedFile, filename, mimeType)
+		}
+	}()
+	return extractTextByType(data, mimeType, filename)
+}
+
+// extractTextByType dispatches to the registered extractor for the attachment's MIME type or extension
+func extractTextByType(data []byte, mimeType, filename string) (string, error) {
+	extractor, enabled := Lookup(mimeType, filename)
+	if extractor == nil {
+		return "", toolerr.Errorf(toolerr.ParseFailure, "unsupported_file_type", "unsupported file type: %s", mimeType)
+	}
+	if !enabled {
+		return "", toolerr.Errorf(toolerr.ParseFailure, "extraction_disabled", "%s extraction is disabled", extractor.Name())
+	}
+	if fileExtractor, ok := extractor.(FileExtractor); ok {
+		return fileExtractor.ExtractFile(data, mimeType, filename)
+	}
+	return extractor.Extract(data)
+}
+
+// extractPDFText safely extracts text from PDF bytes
+func extractPDFText(data []byte) (string, error) {
+	reader := bytes.NewReader(data)
+
+	// Open PDF reader
+	pdfReader, err := pdf.NewReader(reader, int64(len(data)))
+	if err != nil {
+		return "", toolerr.Errorf(toolerr.ParseFailure, "parse_failed", "failed to open PDF: %v", err)
+	}
+
+	var textContent strings.Builder
+	numPages := pdfReader.NumPage()
+
+	// Limit to first 50 pages to avoid excessive processing
+	maxPages := numPages
+	if maxPages > 50 {
+		maxPages = 50
+	}
+
+	for i := 1; i <= maxPages; i++ {
+		page := pdfReader.Page(i)
+		if page.V.IsNull() {
+			continue
+		}
+
+		// Extract text with empty font map (safe extraction)
+		text, err := page.GetPlainText(map[string]*pdf.Font{})
+		if err != nil {
+			// Continue with other pages if one fails
+			continue
+		}
+
+		textContent.WriteString(text)
+		textContent.WriteString("\n\n")
+	}
+
+	extractedText := textContent.String()
+	if len(extractedText) == 0 {
+		return "", toolerr.Errorf(toolerr.ParseFailure, "no_text", "no text could be extracted from PDF")
+	}
+
+	// Add truncation notice if we hit the page limit
+	if numPages > 50 {
+		extractedText += fmt.Sprintf("\n\n[Note: PDF has %d pages total, but only first 50 pages were processed for safety]", numPages)
+	}
+
+	return extractedText, nil
+}
+
+// maxDOCXDocumentSize caps how much of word/document.xml is read, guarding against zip bombs
+const maxDOCXDocumentSize = 50 << 20
+
+// extractDOCXText safely extracts text from DOCX bytes.
+// A DOCX file is a zip archive, so word/document.xml is read straight from memory
+// without writing the (possibly sensitive) attachment to a temp file.
+func extractDOCXText(data []byte) (string, error) {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return "", toolerr.Errorf(toolerr.ParseFailure, "parse_failed", "failed to open DOCX: %v", err)
+	}
+
+	var documentXML []byte
+	for _, file := range archive.File {
+		if file.Name != "word/document.xml" {
+			continue
+		}
+		rc, err := file.Open()
+		if err != nil {
+			return "", toolerr.Errorf(toolerr.ParseFailure, "parse_failed", "failed to open DOCX document body: %v", err)
+		}
+		documentXML, err = io.ReadAll(io.LimitReader(rc, maxDOCXDocumentSize))
+		rc.Close()
+		if err != nil {
+			return "", toolerr.Errorf(toolerr.ParseFailure, "parse_failed", "failed to read DOCX document body: %v", err)
+		}
+		break
+	}
+	if documentXML == nil {
+		return "", toolerr.Errorf(toolerr.ParseFailure, "parse_failed", "failed to open DOCX: word/document.xml not found")
+	}
+
+	plainText := extractTextFromXML(string(documentXML))
+	if len(plainText) == 0 {
+		return "", toolerr.Errorf(toolerr.ParseFailure, "no_text", "no text could be extracted from DOCX")
+	}
+
+	return plainText, nil
+}
+
+// extractTextFromXML extracts plain text content from DOCX XML
+func extractTextFromXML(xmlContent string) string {
+	var textParts []string
+
+	// Create a decoder for the XML content
+	decoder := xml.NewDecoder(strings.NewReader(xmlContent))
+
+	// Track if we're inside a <w:t> element
+	var insideTextElement bool
+
+	for {
+		// Read the next token
+		token, err := decoder.Token()
+		if err != nil {
+			break // End of document or error
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			// Check if this is a text element
+			if t.Name.Local == "t" && t.Name.Space == "http://schemas.openxmlformats.org/wordprocessingml/2006/main" {
+				insideTextElement = true
+			}
+		case xml.EndElement:
+			// Check if we're leaving a text element
+			if t.Name.Local == "t" && t.Name.Space == "http://schemas.openxmlformats.org/wordprocessingml/2006/main" {
+				insideTextElement = false
+			}
+		case xml.CharData:
+			// If we're inside a text element, collect the text
+			if insideTextElement {
+				text := strings.TrimSpace(string(t))
+				if text != "" {
+					textParts = append(textParts, text)
+				}
+			}
+		}
+	}
+
+	// Join all text parts with spaces and clean up
+	result := strings.Join(textParts, " ")
+
+	// Clean up extra whitespace while preserving meaningful breaks
+	// Split by multiple spaces and rejoin with single spaces
+	words := strings.Fields(result)
+	return strings.Join(words, " ")
+}
@@ -0,0 +1,180 @@
+package extract
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"auto-gmail/internal/toolerr"
+)
+
+const (
+	pdfMIME  = "application/pdf"
+	docxMIME = "application/vnd.openxmlformats-officedocument.wordprocessingml.document"
+	htmlMIME = "text/html"
+)
+
+// samplePDF builds a one-page PDF that says text, with a correct cross-reference table
+func samplePDF(text string) []byte {
+	stream := fmt.Sprintf("BT /F1 12 Tf 72 720 Td (%s) Tj ET", text)
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] /Contents 4 0 R /Resources << /Font << /F1 5 0 R >> >> >>",
+		fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(stream), stream),
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica >>",
+	}
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, object := range objects {
+		offsets[i] = buf.Len()
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", i+1, object)
+	}
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	return buf.Bytes()
+}
+
+// sampleDOCX builds a minimal DOCX whose body is one paragraph saying text
+func sampleDOCX(text string) []byte {
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	files := []struct{ name, content string }{
+		{"[Content_Types].xml", `<?xml version="1.0" encoding="UTF-8"?><Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types"><Override PartName="/word/document.xml" ContentType="application/vnd.openxmlformats-officedocument.wordprocessingml.document.main+xml"/></Types>`},
+		{"word/document.xml", `<?xml version="1.0" encoding="UTF-8"?><w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"><w:body><w:p><w:r><w:t>` + text + `</w:t></w:r></w:p></w:body></w:document>`},
+	}
+	for _, file := range files {
+		w, _ := archive.Create(file.name)
+		w.Write([]byte(file.content))
+	}
+	archive.Close()
+	return buf.Bytes()
+}
+
+const sampleHTML = `<html><head><title>Invoice</title></head><body><h1>Invoice 42</h1><p>Total due: <b>$1,200</b> by <a href="https://example.com/pay">March 5</a></p><table><tr><td>Item</td><td>Price</td></tr></table></body></html>`
+
+func TestTextFromBytes(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     []byte
+		mimeType string
+		filename string
+		want     string
+	}{
+		{"pdf", samplePDF("Quarterly report"), pdfMIME, "report.pdf", "Quarterly report"},
+		{"docx", sampleDOCX("Meeting notes"), docxMIME, "notes.docx", "Meeting notes"},
+		{"text", []byte("plain words"), "text/plain", "notes.txt", "plain words"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			text, err := TextFromBytes(tt.data, tt.mimeType, tt.filename)
+			if err != nil {
+				t.Fatalf("TextFromBytes() error = %v", err)
+			}
+			if !strings.Contains(text, tt.want) {
+				t.Errorf("TextFromBytes() = %q, want it to contain %q", text, tt.want)
+			}
+		})
+	}
+}
+
+// truncatedBody cuts a PDF's objects off at fraction percent but keeps its
+// cross-reference table and trailer, like a download damaged in the middle
+func truncatedBody(pdf []byte, fraction int) []byte {
+	xref := bytes.Index(pdf, []byte("xref"))
+	return append(append([]byte{}, pdf[:xref*fraction/100]...), pdf[xref:]...)
+}
+
+func TestTextFromBytesTruncated(t *testing.T) {
+	pdf, docx := samplePDF("Quarterly report"), sampleDOCX("Meeting notes")
+	tests := []struct {
+		name     string
+		data     []byte
+		mimeType string
+		// wantMalformed is set where the parser panics, so the recovered ErrMalformedFile is expected
+		wantMalformed bool
+	}{
+		{"pdf cut at the start", pdf[:5], pdfMIME, false},
+		{"pdf cut in half", pdf[:len(pdf)/2], pdfMIME, false},
+		{"pdf without its trailer", pdf[:len(pdf)-10], pdfMIME, false},
+		{"pdf with a quarter of its objects", truncatedBody(pdf, 25), pdfMIME, true},
+		{"pdf with half its objects", truncatedBody(pdf, 50), pdfMIME, true},
+		{"pdf with a tenth of its objects", truncatedBody(pdf, 10), pdfMIME, true},
+		{"docx cut at the start", docx[:4], docxMIME, false},
+		{"docx cut in half", docx[:len(docx)/2], docxMIME, false},
+		{"docx without its directory end", docx[:len(docx)-10], docxMIME, false},
+		{"html cut in half", []byte(sampleHTML[:len(sampleHTML)/2]), htmlMIME, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			text, err := TextFromBytes(tt.data, tt.mimeType, "truncated")
+			if err == nil {
+				t.Fatalf("TextFromBytes() = %q, want an error", text)
+			}
+			if text != "" {
+				t.Errorf("TextFromBytes() = %q with error %v, want no text", text, err)
+			}
+			if malformed := errors.Is(err, ErrMalformedFile); malformed != tt.wantMalformed {
+				t.Errorf("TextFromBytes() error = %v, ErrMalformedFile = %v, want %v", err, malformed, tt.wantMalformed)
+			}
+			if classified := toolerr.Classify(err); classified.Category != toolerr.ParseFailure {
+				t.Errorf("TextFromBytes() error %v classified as %s, want %s", err, classified.Category, toolerr.ParseFailure)
+			}
+		})
+	}
+}
+
+func TestTextFromBytesRecoversPanics(t *testing.T) {
+	Register(NewExtractor("panicking", []string{"application/x-panicking"}, []string{".panic"}, func(data []byte) (string, error) {
+		return string(data[len(data)+1:]), nil
+	}))
+
+	text, err := TextFromBytes([]byte("truncated"), "application/x-panicking", "broken.panic")
+	if !errors.Is(err, ErrMalformedFile) {
+		t.Fatalf("TextFromBytes() error = %v, want ErrMalformedFile", err)
+	}
+	if text != "" {
+		t.Errorf("TextFromBytes() = %q, want no text", text)
+	}
+	if !strings.HasPrefix(err.Error(), "extraction failed: malformed file") {
+		t.Errorf("TextFromBytes() error = %q, want it to start with %q", err, ErrMalformedFile)
+	}
+	if classified := toolerr.Classify(err); classified.Category != toolerr.ParseFailure || classified.Code != "malformed_file" {
+		t.Errorf("TextFromBytes() error classified as %s/%s, want %s/malformed_file", classified.Category, classified.Code, toolerr.ParseFailure)
+	}
+}
+
+func TestHTMLToMarkdownTruncated(t *testing.T) {
+	for _, length := range []int{strings.Index(sampleHTML, "<p>") + 1, len(sampleHTML) / 2, len(sampleHTML) - 20} {
+		if markdown := HTMLToMarkdown(sampleHTML[:length]); !strings.Contains(markdown, "Invoice 42") {
+			t.Errorf("HTMLToMarkdown() of %d bytes = %q, want the heading kept", length, markdown)
+		}
+	}
+}
+
+func FuzzExtractTextFromBytes(f *testing.F) {
+	mimeTypes := []string{pdfMIME, docxMIME, htmlMIME, "text/plain"}
+	for i, seed := range [][]byte{samplePDF("Quarterly report"), sampleDOCX("Meeting notes"), []byte(sampleHTML)} {
+		f.Add(seed, uint8(i))
+		f.Add(seed[:len(seed)/2], uint8(i))
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte, kind uint8) {
+		mimeType := mimeTypes[int(kind)%len(mimeTypes)]
+		text, err := TextFromBytes(data, mimeType, "fuzz")
+		if err != nil && text != "" {
+			t.Errorf("TextFromBytes() = %q with error %v, want no text", text, err)
+		}
+		if mimeType == htmlMIME {
+			HTMLToMarkdown(string(data))
+		}
+	})
+}
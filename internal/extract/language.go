@@ -0,0 +1,117 @@
+package extract
+
+import (
+	"strings"
+	"unicode"
+)
+
+// minLanguageWords is how many stopword hits a Latin-script guess needs to be trusted
+const minLanguageWords = 3
+
+// scriptLanguages maps writing systems used by a single common language to its ISO 639-1 code
+var scriptLanguages = []struct {
+	table    *unicode.RangeTable
+	language string
+}{
+	{unicode.Hangul, "ko"},
+	{unicode.Hiragana, "ja"},
+	{unicode.Katakana, "ja"},
+	{unicode.Han, "zh"},
+	{unicode.Arabic, "ar"},
+	{unicode.Hebrew, "he"},
+	{unicode.Greek, "el"},
+	{unicode.Thai, "th"},
+	{unicode.Devanagari, "hi"},
+	{unicode.Cyrillic, "ru"},
+}
+
+// stopwords are frequent short words that tell Latin-script languages apart
+var stopwords = map[string][]string{
+	"en": {"the", "and", "is", "are", "you", "that", "for", "with", "this", "have", "will", "not"},
+	"es": {"el", "los", "que", "por", "para", "con", "una", "está", "gracias", "como", "pero", "del"},
+	"fr": {"le", "les", "est", "vous", "pour", "avec", "une", "des", "dans", "merci", "pas", "sur"},
+	"de": {"der", "die", "und", "ist", "sie", "nicht", "mit", "für", "ein", "eine", "auf", "danke"},
+	"it": {"il", "che", "per", "con", "una", "sono", "della", "grazie", "non", "gli", "anche", "questo"},
+	"pt": {"o", "os", "que", "não", "para", "com", "uma", "você", "obrigado", "está", "mas", "dos"},
+	"nl": {"de", "het", "een", "en", "is", "niet", "met", "voor", "van", "dank", "ook", "zijn"},
+	"sv": {"och", "att", "det", "är", "inte", "med", "för", "på", "tack", "som", "jag", "till"},
+}
+
+// languageNames are the English names of the languages DetectLanguage reports
+var languageNames = map[string]string{
+	"en": "English", "es": "Spanish", "fr": "French", "de": "German", "it": "Italian",
+	"pt": "Portuguese", "nl": "Dutch", "sv": "Swedish", "ko": "Korean", "ja": "Japanese",
+	"zh": "Chinese", "ar": "Arabic", "he": "Hebrew", "el": "Greek", "th": "Thai",
+	"hi": "Hindi", "ru": "Russian", "uk": "Ukrainian",
+}
+
+// LanguageName returns the English name of an ISO 639-1 code from DetectLanguage,
+// or the code itself when it isn't known
+func LanguageName(code string) string {
+	if name, ok := languageNames[code]; ok {
+		return name
+	}
+	return code
+}
+
+// DetectLanguage guesses the ISO 639-1 code of the main language of text, or returns
+// "" when there is too little text to tell. Non-Latin scripts are identified by their
+// characters and Latin-script languages by common words.
+func DetectLanguage(text string) string {
+	scripts := map[string]int{}
+	letters := 0
+	for _, r := range text {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		letters++
+		for _, script := range scriptLanguages {
+			if unicode.Is(script.table, r) {
+				scripts[script.language]++
+				break
+			}
+		}
+	}
+	if letters == 0 {
+		return ""
+	}
+
+	// Kana marks Japanese even though most of the characters may be Han
+	if scripts["ja"] > 0 && scripts["ja"]+scripts["zh"] > letters/3 {
+		return "ja"
+	}
+	best, bestCount := "", 0
+	for language, count := range scripts {
+		if count > bestCount || (count == bestCount && language < best) {
+			best, bestCount = language, count
+		}
+	}
+	if bestCount > letters/3 {
+		if best == "ru" && strings.ContainsAny(text, "іїєґІЇЄҐ") {
+			return "uk"
+		}
+		return best
+	}
+
+	counts := map[string]int{}
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool { return !unicode.IsLetter(r) }) {
+		for language, words := range stopwords {
+			for _, stopword := range words {
+				if word == stopword {
+					counts[language]++
+					break
+				}
+			}
+		}
+	}
+	best, bestCount = "", 0
+	for language, count := range counts {
+		if count > bestCount || (count == bestCount && language < best) {
+			best, bestCount = language, count
+		}
+	}
+	if bestCount < minLanguageWords {
+		return ""
+	}
+	return best
+}
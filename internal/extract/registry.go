@@ -0,0 +1,157 @@
+package extract
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Extractor turns one kind of attachment into plain text. It's picked by MIME type
+// first, then by file extension.
+type Extractor interface {
+	// Name identifies the extractor, e.g. "pdf"; GMAIL_MCP_DISABLED_EXTRACTORS lists names
+	Name() string
+	// MIMETypes are the exact MIME types it handles
+	MIMETypes() []string
+	// Extensions are the lowercase file extensions it handles, with the dot (".pdf")
+	Extensions() []string
+	// Extract returns the text of an attachment. Panics are recovered by TextFromBytes.
+	Extract(data []byte) (string, error)
+}
+
+// FileExtractor is an Extractor that also needs the attachment's MIME type and
+// filename, e.g. to tell an external converter the input format
+type FileExtractor interface {
+	Extractor
+	ExtractFile(data []byte, mimeType, filename string) (string, error)
+}
+
+// funcExtractor is an Extractor built by NewExtractor
+type funcExtractor struct {
+	name       string
+	mimeTypes  []string
+	extensions []string
+	extract    func(data []byte) (string, error)
+}
+
+func (e *funcExtractor) Name() string                        { return e.name }
+func (e *funcExtractor) MIMETypes() []string                 { return e.mimeTypes }
+func (e *funcExtractor) Extensions() []string                { return e.extensions }
+func (e *funcExtractor) Extract(data []byte) (string, error) { return e.extract(data) }
+
+// NewExtractor creates an Extractor from a function
+func NewExtractor(name string, mimeTypes, extensions []string, extract func(data []byte) (string, error)) Extractor {
+	return &funcExtractor{name: name, mimeTypes: mimeTypes, extensions: extensions, extract: extract}
+}
+
+// registry holds the extractors by name, in registration order
+var registry = struct {
+	sync.RWMutex
+	extractors []Extractor
+	disabled   map[string]bool
+	loaded     bool
+}{
+	extractors: []Extractor{
+		NewExtractor("pdf", []string{"application/pdf"}, []string{".pdf"}, extractPDFText),
+		NewExtractor("docx", []string{"application/vnd.openxmlformats-officedocument.wordprocessingml.document"}, []string{".docx"}, extractDOCXText),
+		NewExtractor("text", []string{"text/plain"}, []string{".txt"}, func(data []byte) (string, error) { return string(data), nil }),
+	},
+	disabled: map[string]bool{},
+}
+
+// Register adds an extractor, replacing any registered under the same name. Later
+// registrations win when two extractors claim the same MIME type or extension.
+func Register(extractor Extractor) {
+	loadEnv()
+	registry.Lock()
+	defer registry.Unlock()
+	for i, existing := range registry.extractors {
+		if existing.Name() == extractor.Name() {
+			registry.extractors = append(registry.extractors[:i], registry.extractors[i+1:]...)
+			break
+		}
+	}
+	registry.extractors = append(registry.extractors, extractor)
+}
+
+// Disable turns extractors off by name, e.g. to skip heavy PDF parsing. Extractors
+// named in GMAIL_MCP_DISABLED_EXTRACTORS (comma-separated) are disabled too.
+func Disable(names ...string) {
+	loadEnv()
+	registry.Lock()
+	defer registry.Unlock()
+	for _, name := range names {
+		registry.disabled[strings.ToLower(strings.TrimSpace(name))] = true
+	}
+}
+
+// Enabled reports whether the extractor named name is enabled
+func Enabled(name string) bool {
+	loadEnv()
+	registry.RLock()
+	defer registry.RUnlock()
+	return !registry.disabled[strings.ToLower(name)]
+}
+
+// loadEnv reads GMAIL_MCP_DISABLED_EXTRACTORS and the external converter settings the
+// first time the registry is used, after the .env file has been loaded. Converters go
+// first, so built-in and embedder-registered extractors take precedence over them.
+func loadEnv() {
+	registry.Lock()
+	defer registry.Unlock()
+	if registry.loaded {
+		return
+	}
+	registry.loaded = true
+	for _, name := range strings.Split(os.Getenv("GMAIL_MCP_DISABLED_EXTRACTORS"), ",") {
+		if name = strings.ToLower(strings.TrimSpace(name)); name != "" {
+			registry.disabled[name] = true
+		}
+	}
+	registry.extractors = append(convertersFromEnv(), registry.extractors...)
+}
+
+// Extractors returns every registered extractor, enabled or not, sorted by name
+func Extractors() []Extractor {
+	loadEnv()
+	registry.RLock()
+	defer registry.RUnlock()
+	extractors := append([]Extractor(nil), registry.extractors...)
+	sort.Slice(extractors, func(i, j int) bool { return extractors[i].Name() < extractors[j].Name() })
+	return extractors
+}
+
+// Lookup returns the extractor for an attachment, matching the MIME type first and
+// the file extension second. It returns nil when no extractor matches; a disabled
+// match is returned with enabled set to false.
+func Lookup(mimeType, filename string) (extractor Extractor, enabled bool) {
+	loadEnv()
+	registry.RLock()
+	defer registry.RUnlock()
+
+	mimeType = strings.ToLower(mimeType)
+	extension := strings.ToLower(filepath.Ext(filename))
+	for _, match := range []func(Extractor) bool{
+		func(e Extractor) bool { return containsFold(e.MIMETypes(), mimeType) },
+		func(e Extractor) bool { return extension != "" && containsFold(e.Extensions(), extension) },
+	} {
+		// Later registrations take precedence
+		for i := len(registry.extractors) - 1; i >= 0; i-- {
+			if candidate := registry.extractors[i]; match(candidate) {
+				return candidate, !registry.disabled[strings.ToLower(candidate.Name())]
+			}
+		}
+	}
+	return nil, false
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
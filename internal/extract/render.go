@@ -0,0 +1,264 @@
+package extract
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"auto-gmail/internal/toolerr"
+)
+
+// RenderedPage is one page image of a document preview
+type RenderedPage struct {
+	MIMEType string
+	Data     []byte
+}
+
+// Renderer turns a document into at most maxPages page images. It's the hook behind
+// render_attachment_preview; embedders can replace the default with SetRenderer.
+type Renderer func(ctx context.Context, data []byte, mimeType, filename string, maxPages int) ([]RenderedPage, error)
+
+var renderer = struct {
+	sync.RWMutex
+	render Renderer
+}{render: renderPages}
+
+// SetRenderer replaces the page renderer; nil restores the default
+func SetRenderer(r Renderer) {
+	renderer.Lock()
+	defer renderer.Unlock()
+	if r == nil {
+		r = renderPages
+	}
+	renderer.render = r
+}
+
+// imageMIMETypes are attachment types that are already page images
+var imageMIMETypes = map[string]string{
+	".png":  "image/png",
+	".jpg":  "image/jpeg",
+	".jpeg": "image/jpeg",
+	".gif":  "image/gif",
+	".webp": "image/webp",
+}
+
+// RenderPages renders the first maxPages pages of an attachment as images, within the
+// converter timeout and size limits
+func RenderPages(ctx context.Context, data []byte, mimeType, filename string, maxPages int) ([]RenderedPage, error) {
+	_, maxBytes := converterLimits()
+	if len(data) > maxBytes {
+		return nil, toolerr.Errorf(toolerr.InvalidInput, "too_large", "%s is %d bytes, over the %d byte limit for rendering", filename, len(data), maxBytes)
+	}
+	renderer.RLock()
+	render := renderer.render
+	renderer.RUnlock()
+	return render(ctx, data, mimeType, filename, max(maxPages, 1))
+}
+
+// RenderPDF returns the attachment as a PDF, converting office documents with
+// LibreOffice when GMAIL_MCP_LIBREOFFICE is set
+func RenderPDF(ctx context.Context, data []byte, mimeType, filename string) ([]byte, error) {
+	if isPDF(mimeType, filename) {
+		return data, nil
+	}
+	timeout, maxBytes := converterLimits()
+	if len(data) > maxBytes {
+		return nil, toolerr.Errorf(toolerr.InvalidInput, "too_large", "%s is %d bytes, over the %d byte limit for rendering", filename, len(data), maxBytes)
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	return withRenderDir(filename, data, func(dir, input string) ([]byte, error) {
+		return convertToPDF(ctx, dir, input, mimeType, filename)
+	})
+}
+
+// HTMLToPDF prints an HTML document to PDF with GMAIL_MCP_HTML_PDF_COMMAND when set
+// (e.g. wkhtmltopdf or headless Chromium), otherwise with LibreOffice
+func HTMLToPDF(ctx context.Context, html []byte) ([]byte, error) {
+	timeout, _ := converterLimits()
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	pdf, err := withRenderDir("document.html", html, func(dir, input string) ([]byte, error) {
+		if command := strings.TrimSpace(os.Getenv("GMAIL_MCP_HTML_PDF_COMMAND")); command != "" {
+			output := filepath.Join(dir, "document.pdf")
+			replacer := strings.NewReplacer("{input}", input, "{output}", output)
+			fields := strings.Fields(command)
+			args := make([]string, 0, len(fields)-1)
+			for _, field := range fields[1:] {
+				args = append(args, replacer.Replace(field))
+			}
+			if _, err := runSandboxed(ctx, dir, fields[0], args...); err != nil {
+				return nil, err
+			}
+			return os.ReadFile(output)
+		}
+		soffice := converterBinary("GMAIL_MCP_LIBREOFFICE", "soffice", "libreoffice")
+		if soffice == "" {
+			return nil, toolerr.Errorf(toolerr.Internal, "renderer_missing", "no HTML to PDF renderer: set GMAIL_MCP_HTML_PDF_COMMAND or GMAIL_MCP_LIBREOFFICE")
+		}
+		output, err := libreOfficeExport(ctx, soffice, dir, input, "pdf:writer_web_pdf_Export")
+		if err != nil {
+			return nil, err
+		}
+		return os.ReadFile(output)
+	})
+	if ctx.Err() == context.DeadlineExceeded {
+		return nil, toolerr.Errorf(toolerr.Unavailable, "timeout", "rendering PDF timed out after %s", timeout)
+	}
+	return pdf, err
+}
+
+// renderPages is the default Renderer. Images pass through unchanged. Anything else
+// goes to GMAIL_MCP_RENDER_COMMAND when set, otherwise it's converted to PDF (via
+// LibreOffice for office documents) and rasterized with pdftoppm.
+func renderPages(ctx context.Context, data []byte, mimeType, filename string, maxPages int) ([]RenderedPage, error) {
+	extension := strings.ToLower(filepath.Ext(filename))
+	if imageType, ok := imageMIMETypes[extension]; ok || strings.HasPrefix(strings.ToLower(mimeType), "image/") {
+		if imageType == "" {
+			imageType = strings.ToLower(mimeType)
+		}
+		return []RenderedPage{{MIMEType: imageType, Data: data}}, nil
+	}
+
+	timeout, _ := converterLimits()
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	pages, err := withRenderDir(filename, data, func(dir, input string) ([]RenderedPage, error) {
+		outDir := filepath.Join(dir, "pages")
+		if err := os.Mkdir(outDir, 0700); err != nil {
+			return nil, err
+		}
+		if command := strings.TrimSpace(os.Getenv("GMAIL_MCP_RENDER_COMMAND")); command != "" {
+			if err := runRenderCommand(ctx, dir, command, input, outDir, maxPages); err != nil {
+				return nil, err
+			}
+			return collectPages(outDir, maxPages)
+		}
+
+		pdftoppm := renderBinary("GMAIL_MCP_PDFTOPPM", "pdftoppm")
+		if pdftoppm == "" {
+			return nil, toolerr.Errorf(toolerr.Internal, "renderer_missing", "no page renderer: install pdftoppm (poppler) or set GMAIL_MCP_RENDER_COMMAND")
+		}
+		pdf := input
+		if !isPDF(mimeType, filename) {
+			pdfData, err := convertToPDF(ctx, dir, input, mimeType, filename)
+			if err != nil {
+				return nil, err
+			}
+			pdf = filepath.Join(dir, "preview.pdf")
+			if err := os.WriteFile(pdf, pdfData, 0600); err != nil {
+				return nil, err
+			}
+		}
+		if _, err := runSandboxed(ctx, dir, pdftoppm, "-png", "-r", "80", "-f", "1", "-l", strconv.Itoa(maxPages), pdf, filepath.Join(outDir, "page")); err != nil {
+			return nil, err
+		}
+		return collectPages(outDir, maxPages)
+	})
+	if ctx.Err() == context.DeadlineExceeded {
+		return nil, toolerr.Errorf(toolerr.Unavailable, "timeout", "rendering %s timed out after %s", filename, timeout)
+	}
+	if err != nil {
+		return nil, toolerr.Errorf(toolerr.ParseFailure, "render_failed", "rendering %s failed: %v", filename, err)
+	}
+	if len(pages) == 0 {
+		return nil, toolerr.Errorf(toolerr.ParseFailure, "no_pages", "rendering %s produced no pages", filename)
+	}
+	return pages, nil
+}
+
+// withRenderDir writes data to a fresh temp directory, calls fn with the directory and
+// input path, and removes the directory again
+func withRenderDir[T any](filename string, data []byte, fn func(dir, input string) (T, error)) (T, error) {
+	var zero T
+	dir, err := os.MkdirTemp("", "gmail-mcp-render-")
+	if err != nil {
+		return zero, fmt.Errorf("failed to create render directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	// Never pass the attachment's own name to a tool; it could be anything
+	input := filepath.Join(dir, "input"+strings.ToLower(filepath.Ext(filename)))
+	if err := os.WriteFile(input, data, 0600); err != nil {
+		return zero, fmt.Errorf("failed to write render input: %v", err)
+	}
+	return fn(dir, input)
+}
+
+// convertToPDF exports an office document to PDF with LibreOffice
+func convertToPDF(ctx context.Context, dir, input, mimeType, filename string) ([]byte, error) {
+	soffice := converterBinary("GMAIL_MCP_LIBREOFFICE", "soffice", "libreoffice")
+	if soffice == "" {
+		return nil, toolerr.Errorf(toolerr.ParseFailure, "unsupported_file_type", "can't convert %s (%s) to PDF: set GMAIL_MCP_LIBREOFFICE", filename, mimeType)
+	}
+	output, err := libreOfficeExport(ctx, soffice, dir, input, "pdf")
+	if err != nil {
+		return nil, err
+	}
+	return os.ReadFile(output)
+}
+
+// runRenderCommand runs GMAIL_MCP_RENDER_COMMAND, splitting it on spaces and filling in
+// the {input}, {output_dir} and {max_pages} placeholders
+func runRenderCommand(ctx context.Context, dir, command, input, outDir string, maxPages int) error {
+	replacer := strings.NewReplacer("{input}", input, "{output_dir}", outDir, "{max_pages}", strconv.Itoa(maxPages))
+	fields := strings.Fields(command)
+	args := make([]string, 0, len(fields)-1)
+	for _, field := range fields[1:] {
+		args = append(args, replacer.Replace(field))
+	}
+	_, err := runSandboxed(ctx, dir, fields[0], args...)
+	return err
+}
+
+// collectPages reads the PNG and JPEG files in dir in name order
+func collectPages(dir string, maxPages int) ([]RenderedPage, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, entry := range entries {
+		if imageType := imageMIMETypes[strings.ToLower(filepath.Ext(entry.Name()))]; imageType == "image/png" || imageType == "image/jpeg" {
+			names = append(names, entry.Name())
+		}
+	}
+	// Shorter names first, so page-2 sorts before page-10 when a renderer doesn't zero-pad
+	sort.Slice(names, func(i, j int) bool {
+		if len(names[i]) != len(names[j]) {
+			return len(names[i]) < len(names[j])
+		}
+		return names[i] < names[j]
+	})
+
+	var pages []RenderedPage
+	for _, name := range names[:min(len(names), maxPages)] {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+		pages = append(pages, RenderedPage{MIMEType: imageMIMETypes[strings.ToLower(filepath.Ext(name))], Data: data})
+	}
+	return pages, nil
+}
+
+// renderBinary resolves a renderer setting: a path, or the command found on PATH
+func renderBinary(envVar, command string) string {
+	if value := strings.TrimSpace(os.Getenv(envVar)); value != "" {
+		return value
+	}
+	path, err := exec.LookPath(command)
+	if err != nil {
+		return ""
+	}
+	return path
+}
+
+func isPDF(mimeType, filename string) bool {
+	return strings.EqualFold(mimeType, "application/pdf") || strings.EqualFold(filepath.Ext(filename), ".pdf")
+}
@@ -0,0 +1,306 @@
+// Package gmailclient abstracts the Gmail API behind the Client interface, with a
+// REST implementation (APIClient), an in-memory one (Fake) for offline use, and
+// IMAPClient and GraphClient for IMAP/SMTP and Outlook mailboxes.
+package gmailclient
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+
+	"google.golang.org/api/gmail/v1"
+	"google.golang.org/api/googleapi"
+	googleOption "google.golang.org/api/option"
+)
+
+// Client is the subset of the Gmail API used by the server.
+// APIClient implements it against the real API; Fake is an
+// in-memory backend so server logic can run without live credentials.
+type Client interface {
+	GetProfile(ctx context.Context) (*gmail.Profile, error)
+
+	ListThreads(ctx context.Context, query string, maxResults int64) (*gmail.ListThreadsResponse, error)
+	GetThread(ctx context.Context, threadID string, opts GetOptions) (*gmail.Thread, error)
+	ModifyThread(ctx context.Context, threadID string, req *gmail.ModifyThreadRequest) (*gmail.Thread, error)
+
+	ListMessages(ctx context.Context, query string, maxResults int64) (*gmail.ListMessagesResponse, error)
+	GetMessage(ctx context.Context, messageID string, opts GetOptions) (*gmail.Message, error)
+	GetAttachment(ctx context.Context, messageID, attachmentID string) (*gmail.MessagePartBody, error)
+
+	ListDrafts(ctx context.Context) (*gmail.ListDraftsResponse, error)
+	GetDraft(ctx context.Context, draftID string, opts GetOptions) (*gmail.Draft, error)
+	CreateDraft(ctx context.Context, draft *gmail.Draft) (*gmail.Draft, error)
+	UpdateDraft(ctx context.Context, draftID string, draft *gmail.Draft) (*gmail.Draft, error)
+
+	ListLabels(ctx context.Context) (*gmail.ListLabelsResponse, error)
+	CreateLabel(ctx context.Context, label *gmail.Label) (*gmail.Label, error)
+
+	CreateFilter(ctx context.Context, filter *gmail.Filter) (*gmail.Filter, error)
+
+	// SendMessage sends a raw RFC 822 message, through the outbox and its send limits.
+	// Reports and digests mail the user themselves; mail_merge sends to any recipient,
+	// but only after the user confirmed its dry run.
+	SendMessage(ctx context.Context, message *gmail.Message) (*gmail.Message, error)
+}
+
+// GetOptions controls how much of a thread, message or draft is returned
+type GetOptions struct {
+	Format          string          // "full" (default), "metadata" or "minimal"
+	MetadataHeaders []string        // headers to include with Format "metadata"
+	Fields          googleapi.Field // partial-response field mask
+	ETag            string          // sent as If-None-Match; a 304 surfaces as googleapi.IsNotModified
+}
+
+// BatchGetter is implemented by clients that can send many GETs in one HTTP round trip
+type BatchGetter interface {
+	BatchGet(ctx context.Context, requests []BatchRequest) ([]BatchResponse, error)
+}
+
+// MessageImporter is implemented by clients that can add a raw RFC 822 message to the
+// mailbox without sending it, with the given label IDs. Import treats it like received
+// mail (spam and filter checks); insert stores it verbatim, as IMAP APPEND does.
+type MessageImporter interface {
+	ImportMessage(ctx context.Context, raw []byte, labelIDs []string, insert bool) (*gmail.Message, error)
+}
+
+// MailboxSyncer is implemented by clients that can list every message with a label
+// and what was added since a point in the mailbox's history, for full and then
+// incremental backups
+type MailboxSyncer interface {
+	// ListLabelMessages returns the IDs of every message with the label, newest first
+	ListLabelMessages(ctx context.Context, labelID string) ([]string, error)
+	// ListHistory returns the IDs of messages added to the label since startHistoryID,
+	// oldest first, and the history ID to continue from. It fails with
+	// ErrHistoryExpired when startHistoryID is too old to list from.
+	ListHistory(ctx context.Context, startHistoryID uint64, labelID string) ([]string, uint64, error)
+}
+
+// BulkModifier is implemented by clients that can list every message matching a
+// query, past the first page, and change the labels of many messages in one request
+type BulkModifier interface {
+	// ListAllMessageIDs returns the IDs of the messages matching query, newest first,
+	// stopping after limit (0 for no limit)
+	ListAllMessageIDs(ctx context.Context, query string, limit int) ([]string, error)
+	// BatchModifyMessages changes the labels of up to MaxBatchModify messages
+	BatchModifyMessages(ctx context.Context, messageIDs []string, req *gmail.BatchModifyMessagesRequest) error
+}
+
+// MaxBatchModify is the most messages one BatchModifyMessages call may change
+const MaxBatchModify = 1000
+
+// errEnoughListed stops paging once a listing reached its limit
+var errEnoughListed = errors.New("enough messages listed")
+
+// ErrHistoryExpired means a history ID is too old for incremental sync; list in full instead
+var ErrHistoryExpired = errors.New("the history ID has expired; a full sync is needed")
+
+// APIClient implements Client with the Gmail REST API
+type APIClient struct {
+	service *gmail.Service
+	userID  string
+	// httpClient is the authorized client behind service, used for batch requests
+	httpClient *http.Client
+}
+
+var (
+	_ Client          = (*APIClient)(nil)
+	_ BatchGetter     = (*APIClient)(nil)
+	_ MessageImporter = (*APIClient)(nil)
+	_ MailboxSyncer   = (*APIClient)(nil)
+	_ BulkModifier    = (*APIClient)(nil)
+)
+
+// NewAPIClient wraps an authorized HTTP client. userID is usually "me".
+func NewAPIClient(ctx context.Context, httpClient *http.Client, userID string) (*APIClient, error) {
+	service, err := gmail.NewService(ctx, googleOption.WithHTTPClient(httpClient))
+	if err != nil {
+		return nil, err
+	}
+	return &APIClient{service: service, userID: userID, httpClient: httpClient}, nil
+}
+
+func (c *APIClient) GetProfile(ctx context.Context) (*gmail.Profile, error) {
+	return c.service.Users.GetProfile(c.userID).Context(ctx).Do()
+}
+
+func (c *APIClient) ListThreads(ctx context.Context, query string, maxResults int64) (*gmail.ListThreadsResponse, error) {
+	return c.service.Users.Threads.List(c.userID).Q(ZonedQuery(query)).MaxResults(maxResults).
+		Fields("threads(id,historyId),nextPageToken,resultSizeEstimate").
+		Context(ctx).
+		Do()
+}
+
+func (c *APIClient) GetThread(ctx context.Context, threadID string, opts GetOptions) (*gmail.Thread, error) {
+	call := c.service.Users.Threads.Get(c.userID, threadID).Context(ctx)
+	if opts.Format != "" {
+		call.Format(opts.Format)
+	}
+	if len(opts.MetadataHeaders) > 0 {
+		call.MetadataHeaders(opts.MetadataHeaders...)
+	}
+	if opts.Fields != "" {
+		call.Fields(opts.Fields)
+	}
+	if opts.ETag != "" {
+		call.IfNoneMatch(opts.ETag)
+	}
+	return call.Do()
+}
+
+func (c *APIClient) ModifyThread(ctx context.Context, threadID string, req *gmail.ModifyThreadRequest) (*gmail.Thread, error) {
+	return c.service.Users.Threads.Modify(c.userID, threadID, req).Fields("id,historyId").Context(ctx).Do()
+}
+
+func (c *APIClient) ListMessages(ctx context.Context, query string, maxResults int64) (*gmail.ListMessagesResponse, error) {
+	return c.service.Users.Messages.List(c.userID).Q(ZonedQuery(query)).MaxResults(maxResults).
+		Fields("messages(id,threadId),nextPageToken,resultSizeEstimate").
+		Context(ctx).
+		Do()
+}
+
+func (c *APIClient) GetMessage(ctx context.Context, messageID string, opts GetOptions) (*gmail.Message, error) {
+	call := c.service.Users.Messages.Get(c.userID, messageID).Context(ctx)
+	if opts.Format != "" {
+		call.Format(opts.Format)
+	}
+	if len(opts.MetadataHeaders) > 0 {
+		call.MetadataHeaders(opts.MetadataHeaders...)
+	}
+	if opts.Fields != "" {
+		call.Fields(opts.Fields)
+	}
+	if opts.ETag != "" {
+		call.IfNoneMatch(opts.ETag)
+	}
+	return call.Do()
+}
+
+func (c *APIClient) GetAttachment(ctx context.Context, messageID, attachmentID string) (*gmail.MessagePartBody, error) {
+	return c.service.Users.Messages.Attachments.Get(c.userID, messageID, attachmentID).Fields("data,size").Context(ctx).Do()
+}
+
+func (c *APIClient) ListDrafts(ctx context.Context) (*gmail.ListDraftsResponse, error) {
+	// The listing already carries each draft's message and thread ID
+	return c.service.Users.Drafts.List(c.userID).Fields("drafts(id,message(id,threadId)),nextPageToken").Context(ctx).Do()
+}
+
+func (c *APIClient) GetDraft(ctx context.Context, draftID string, opts GetOptions) (*gmail.Draft, error) {
+	call := c.service.Users.Drafts.Get(c.userID, draftID).Context(ctx)
+	if opts.Format != "" {
+		call.Format(opts.Format)
+	}
+	if opts.Fields != "" {
+		call.Fields(opts.Fields)
+	}
+	return call.Do()
+}
+
+func (c *APIClient) CreateDraft(ctx context.Context, draft *gmail.Draft) (*gmail.Draft, error) {
+	return c.service.Users.Drafts.Create(c.userID, draft).Fields("id,message(id,threadId)").Context(ctx).Do()
+}
+
+func (c *APIClient) UpdateDraft(ctx context.Context, draftID string, draft *gmail.Draft) (*gmail.Draft, error) {
+	return c.service.Users.Drafts.Update(c.userID, draftID, draft).Fields("id,message(id,threadId)").Context(ctx).Do()
+}
+
+func (c *APIClient) ListLabels(ctx context.Context) (*gmail.ListLabelsResponse, error) {
+	return c.service.Users.Labels.List(c.userID).Context(ctx).Do()
+}
+
+func (c *APIClient) CreateLabel(ctx context.Context, label *gmail.Label) (*gmail.Label, error) {
+	return c.service.Users.Labels.Create(c.userID, label).Context(ctx).Do()
+}
+
+func (c *APIClient) CreateFilter(ctx context.Context, filter *gmail.Filter) (*gmail.Filter, error) {
+	return c.service.Users.Settings.Filters.Create(c.userID, filter).Context(ctx).Do()
+}
+
+func (c *APIClient) SendMessage(ctx context.Context, message *gmail.Message) (*gmail.Message, error) {
+	return c.service.Users.Messages.Send(c.userID, message).Fields("id,threadId,labelIds").Context(ctx).Do()
+}
+
+// ImportMessage uploads the message as media, which allows larger messages than a raw
+// field, dated by its Date header rather than the time of the upload
+func (c *APIClient) ImportMessage(ctx context.Context, raw []byte, labelIDs []string, insert bool) (*gmail.Message, error) {
+	metadata := &gmail.Message{LabelIds: labelIDs}
+	media := googleapi.ContentType("message/rfc822")
+	if insert {
+		return c.service.Users.Messages.Insert(c.userID, metadata).Media(bytes.NewReader(raw), media).
+			InternalDateSource("dateHeader").Fields("id,threadId,labelIds").Context(ctx).Do()
+	}
+	return c.service.Users.Messages.Import(c.userID, metadata).Media(bytes.NewReader(raw), media).
+		InternalDateSource("dateHeader").NeverMarkSpam(true).Fields("id,threadId,labelIds").Context(ctx).Do()
+}
+
+func (c *APIClient) ListLabelMessages(ctx context.Context, labelID string) ([]string, error) {
+	var ids []string
+	call := c.service.Users.Messages.List(c.userID).LabelIds(labelID).MaxResults(500).
+		IncludeSpamTrash(labelID == "SPAM" || labelID == "TRASH").Fields("messages(id),nextPageToken")
+	err := call.Pages(ctx, func(resp *gmail.ListMessagesResponse) error {
+		for _, message := range resp.Messages {
+			ids = append(ids, message.Id)
+		}
+		return nil
+	})
+	return ids, err
+}
+
+// ListHistory counts both new messages and messages that were given the label later
+func (c *APIClient) ListHistory(ctx context.Context, startHistoryID uint64, labelID string) ([]string, uint64, error) {
+	var ids []string
+	seen := map[string]bool{}
+	add := func(message *gmail.Message, labelIDs []string) {
+		if message != nil && !seen[message.Id] && containsString(labelIDs, labelID) {
+			seen[message.Id] = true
+			ids = append(ids, message.Id)
+		}
+	}
+
+	latest := startHistoryID
+	call := c.service.Users.History.List(c.userID).StartHistoryId(startHistoryID).LabelId(labelID).
+		HistoryTypes("messageAdded", "labelAdded").MaxResults(500).
+		Fields("history(messagesAdded(message(id,labelIds)),labelsAdded(message(id),labelIds)),historyId,nextPageToken")
+	err := call.Pages(ctx, func(resp *gmail.ListHistoryResponse) error {
+		for _, record := range resp.History {
+			for _, added := range record.MessagesAdded {
+				if added.Message != nil {
+					add(added.Message, added.Message.LabelIds)
+				}
+			}
+			for _, labeled := range record.LabelsAdded {
+				add(labeled.Message, labeled.LabelIds)
+			}
+		}
+		latest = max(latest, resp.HistoryId)
+		return nil
+	})
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) && apiErr.Code == http.StatusNotFound {
+		return nil, 0, ErrHistoryExpired
+	}
+	return ids, latest, err
+}
+
+func (c *APIClient) ListAllMessageIDs(ctx context.Context, query string, limit int) ([]string, error) {
+	var ids []string
+	call := c.service.Users.Messages.List(c.userID).Q(ZonedQuery(query)).MaxResults(500).Fields("messages(id),nextPageToken")
+	err := call.Pages(ctx, func(resp *gmail.ListMessagesResponse) error {
+		for _, message := range resp.Messages {
+			if limit > 0 && len(ids) >= limit {
+				return errEnoughListed
+			}
+			ids = append(ids, message.Id)
+		}
+		return nil
+	})
+	if errors.Is(err, errEnoughListed) {
+		err = nil
+	}
+	return ids, err
+}
+
+func (c *APIClient) BatchModifyMessages(ctx context.Context, messageIDs []string, req *gmail.BatchModifyMessagesRequest) error {
+	req.Ids = messageIDs
+	return c.service.Users.Messages.BatchModify(c.userID, req).Context(ctx).Do()
+}
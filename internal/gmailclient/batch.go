@@ -0,0 +1,128 @@
+package gmailclient
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"auto-gmail/internal/usage"
+)
+
+const (
+	// gmailBatchEndpoint accepts up to maxBatchSize sub-requests per HTTP round trip
+	gmailBatchEndpoint = "https://gmail.googleapis.com/batch/gmail/v1"
+	maxBatchSize       = 100
+)
+
+// BatchRequest is one GET sub-request of a Gmail batch call
+type BatchRequest struct {
+	Path string // relative to the user, e.g. threads/123?format=full
+	ETag string // sent as If-None-Match when set
+}
+
+// BatchResponse is the HTTP response to one sub-request
+type BatchResponse struct {
+	Status int
+	Header http.Header
+	Body   []byte
+}
+
+// BatchGet sends GET sub-requests through the Gmail batch endpoint, maxBatchSize per round trip.
+// Responses are returned in the same order as requests; a missing response has status 0.
+func (c *APIClient) BatchGet(ctx context.Context, requests []BatchRequest) ([]BatchResponse, error) {
+	responses := make([]BatchResponse, len(requests))
+	for start := 0; start < len(requests); start += maxBatchSize {
+		end := start + maxBatchSize
+		if end > len(requests) {
+			end = len(requests)
+		}
+		if err := c.sendBatch(ctx, requests[start:end], responses[start:end]); err != nil {
+			return nil, err
+		}
+	}
+	return responses, nil
+}
+
+// sendBatch performs one multipart/mixed batch round trip
+func (c *APIClient) sendBatch(ctx context.Context, requests []BatchRequest, responses []BatchResponse) error {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	for i, req := range requests {
+		partHeader := textproto.MIMEHeader{}
+		partHeader.Set("Content-Type", "application/http")
+		partHeader.Set("Content-ID", fmt.Sprintf("<item%d>", i))
+		part, err := writer.CreatePart(partHeader)
+		if err != nil {
+			return fmt.Errorf("failed to build batch request: %v", err)
+		}
+		path := fmt.Sprintf("/gmail/v1/users/%s/%s", url.PathEscape(c.userID), req.Path)
+		fmt.Fprintf(part, "GET %s\r\n", path)
+		// Each sub-request costs quota like a request of its own
+		usage.AddGmailRequest(ctx, http.MethodGet, path)
+		if req.ETag != "" {
+			fmt.Fprintf(part, "If-None-Match: %s\r\n", req.ETag)
+		}
+		fmt.Fprint(part, "\r\n")
+	}
+	writer.Close()
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, gmailBatchEndpoint, &body)
+	if err != nil {
+		return fmt.Errorf("failed to build batch request: %v", err)
+	}
+	httpReq.Header.Set("Content-Type", "multipart/mixed; boundary="+writer.Boundary())
+
+	resp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return fmt.Errorf("batch request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("batch request failed with status %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+
+	_, params, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if err != nil || params["boundary"] == "" {
+		return fmt.Errorf("batch response is not multipart: %v", err)
+	}
+
+	reader := multipart.NewReader(resp.Body, params["boundary"])
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read batch response: %v", err)
+		}
+
+		// Content-ID is echoed back as <response-itemN>
+		contentID := strings.Trim(part.Header.Get("Content-ID"), "<>")
+		index, err := strconv.Atoi(strings.TrimPrefix(contentID, "response-item"))
+		if err != nil || index < 0 || index >= len(responses) {
+			continue
+		}
+
+		itemResp, err := http.ReadResponse(bufio.NewReader(part), nil)
+		if err != nil {
+			continue
+		}
+		itemBody, err := io.ReadAll(itemResp.Body)
+		itemResp.Body.Close()
+		if err != nil {
+			continue
+		}
+		responses[index] = BatchResponse{Status: itemResp.StatusCode, Header: itemResp.Header, Body: itemBody}
+	}
+	return nil
+}
@@ -0,0 +1,230 @@
+package gmailclient
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"html"
+	"math/rand"
+	"strings"
+	"time"
+
+	"google.golang.org/api/gmail/v1"
+)
+
+// demoAddress is the mailbox owner in demo mode
+const demoAddress = "demo@example.com"
+
+// demoContacts send and receive the generated mail
+var demoContacts = []string{
+	"Alice Nguyen <alice@example.com>",
+	"Bob Martins <bob@example.org>",
+	"Carla Rossi <carla@example.net>",
+	"Dev Patel <dev@example.com>",
+	"Erin O'Brien <erin@example.org>",
+	"Finance Team <finance@example.com>",
+}
+
+// demoTopic is a conversation template: an opening message, optional replies
+// and an optional attachment of the given kind ("txt" or "docx"). Topics with a
+// listID are sent by a mailing list from a fixed sender.
+type demoTopic struct {
+	subject    string
+	body       string
+	replies    []string
+	attachment string
+	filename   string
+	labels     []string
+	listID     string
+	sender     string
+}
+
+var demoTopics = []demoTopic{
+	{
+		subject:    "Q3 planning notes",
+		body:       "Hi,\n\nAttaching my notes for Q3 planning. Can you review before Friday?\n\nThanks",
+		replies:    []string{"Thanks, I'll take a look tomorrow.", "Left a few comments on the hiring section."},
+		attachment: "docx",
+		filename:   "q3-planning.docx",
+		labels:     []string{"INBOX", "IMPORTANT"},
+	},
+	{
+		subject: "Lunch on Thursday?",
+		body:    "Are you free for lunch on Thursday? The new place on 5th street has great reviews.",
+		replies: []string{"Sounds good, 12:30 works for me."},
+		labels:  []string{"INBOX"},
+	},
+	{
+		subject:    "Invoice #2041",
+		body:       "Please find attached the invoice for last month's consulting work. Payment is due within 30 days.",
+		attachment: "txt",
+		filename:   "invoice-2041.txt",
+		labels:     []string{"INBOX", "UNREAD"},
+	},
+	{
+		subject: "Weekly product update",
+		body:    "<h1>This week</h1><p>We shipped <b>offline search</b> and fixed 14 bugs.</p><ul><li>Faster sync</li><li>New onboarding flow</li></ul>",
+		labels:  []string{"INBOX", "CATEGORY_UPDATES"},
+		listID:  "product-updates.example.com",
+		sender:  "Example Product <updates@example.com>",
+	},
+	{
+		subject: "Re: contract renewal",
+		body:    "Following up on the renewal. Legal approved the new terms, we just need your signature.",
+		replies: []string{"Great news. I'll sign it today.", "Perfect, thanks!"},
+		labels:  []string{"INBOX", "UNREAD", "IMPORTANT"},
+	},
+	{
+		subject:    "Trip itinerary",
+		body:       "Here is the itinerary for next week's offsite. Flights are booked, hotel confirmation is attached.",
+		attachment: "txt",
+		filename:   "itinerary.txt",
+		labels:     []string{"INBOX"},
+	},
+	{
+		subject: "50% off everything this weekend",
+		body:    "<p>Don't miss our biggest sale of the year! <a href=\"https://shop.example.com\">Shop now</a>.</p>",
+		labels:  []string{"INBOX", "CATEGORY_PROMOTIONS", "UNREAD"},
+		listID:  "deals.shop.example.com",
+		sender:  "Example Shop <deals@shop.example.com>",
+	},
+	{
+		subject: "Code review: retry logic",
+		body:    "Could you review the retry changes? I mostly want a second pair of eyes on the backoff limits.",
+		replies: []string{"Looks good overall, one question about the jitter.", "Good catch, updated."},
+		labels:  []string{"INBOX"},
+	},
+}
+
+// NewDemo generates a synthetic mailbox with threadCount threads, including
+// replies, sent mail, HTML bodies, TXT and DOCX attachments and drafts. The
+// content is the same on every run; dates are relative to now.
+func NewDemo(threadCount int) *Fake {
+	c := NewFake(demoAddress)
+	rng := rand.New(rand.NewSource(1))
+	now := time.Now()
+	historyID := uint64(1000)
+
+	for i := 0; i < threadCount; i++ {
+		topic := demoTopics[i%len(demoTopics)]
+		subject := topic.subject
+		if i >= len(demoTopics) {
+			subject = fmt.Sprintf("%s (%d)", topic.subject, i/len(demoTopics)+1)
+		}
+		contact := demoContacts[rng.Intn(len(demoContacts))]
+		if topic.sender != "" {
+			contact = topic.sender
+		}
+		threadID := fmt.Sprintf("demo-thread-%03d", i+1)
+		sentAt := now.Add(-time.Duration(i*11+rng.Intn(10)) * time.Hour)
+
+		// Opening message from the contact
+		historyID++
+		opening := demoMessage(fmt.Sprintf("%s-msg-1", threadID), contact, demoAddress, subject, topic.body, sentAt, historyID, topic.labels)
+		if topic.listID != "" {
+			opening.Payload.Headers = append(opening.Payload.Headers,
+				&gmail.MessagePartHeader{Name: "List-Id", Value: fmt.Sprintf("<%s>", topic.listID)},
+				&gmail.MessagePartHeader{Name: "List-Unsubscribe", Value: fmt.Sprintf("<https://%s/unsubscribe>", topic.listID)},
+			)
+		}
+		if topic.attachment != "" {
+			attachmentID := fmt.Sprintf("demo-att-%03d", i+1)
+			data := demoAttachment(topic, subject)
+			opening.Payload = &gmail.MessagePart{
+				MimeType: "multipart/mixed",
+				Headers:  opening.Payload.Headers,
+				Body:     &gmail.MessagePartBody{},
+				Parts: []*gmail.MessagePart{
+					{PartId: "0", MimeType: opening.Payload.MimeType, Body: opening.Payload.Body},
+					{PartId: "1", MimeType: demoMimeTypes[topic.attachment], Filename: topic.filename, Body: &gmail.MessagePartBody{AttachmentId: attachmentID, Size: int64(len(data))}},
+				},
+			}
+			c.AddAttachment(opening.Id, attachmentID, data)
+		}
+		messages := []*gmail.Message{opening}
+
+		// Replies alternate between the mailbox owner (sent) and the contact
+		for j, reply := range topic.replies {
+			historyID++
+			from, to, labels := demoAddress, contact, []string{"SENT"}
+			if j%2 == 1 {
+				from, to, labels = contact, demoAddress, []string{"INBOX"}
+			}
+			sentAt = sentAt.Add(time.Duration(1+rng.Intn(5)) * time.Hour)
+			messages = append(messages, demoMessage(fmt.Sprintf("%s-msg-%d", threadID, j+2), from, to, "Re: "+subject, reply, sentAt, historyID, labels))
+		}
+
+		c.AddThread(&gmail.Thread{Id: threadID, Snippet: messages[len(messages)-1].Snippet, Messages: messages})
+
+		// Every third thread has a reply in progress
+		if i%3 == 0 {
+			draftID := fmt.Sprintf("r-demo-%03d", i+1)
+			draft := demoMessage(draftID+"-msg", demoAddress, contact, "Re: "+subject, "Thanks for the update, I'll get back to you by end of day.", now, historyID, []string{"DRAFT"})
+			draft.ThreadId = threadID
+			c.AddDraft(&gmail.Draft{Id: draftID, Message: draft})
+		}
+	}
+	return c
+}
+
+// demoMimeTypes maps attachment kinds to their MIME types
+var demoMimeTypes = map[string]string{
+	"txt":  "text/plain",
+	"docx": "application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+}
+
+// demoMessage builds a single-part message; bodies starting with "<" are sent as HTML
+func demoMessage(id, from, to, subject, body string, sentAt time.Time, historyID uint64, labels []string) *gmail.Message {
+	mimeType := "text/plain"
+	snippet := body
+	if strings.HasPrefix(body, "<") {
+		mimeType = "text/html"
+		snippet = subject
+	}
+	if len(snippet) > 100 {
+		snippet = snippet[:100]
+	}
+	return &gmail.Message{
+		Id:           id,
+		HistoryId:    historyID,
+		InternalDate: sentAt.UnixMilli(),
+		LabelIds:     labels,
+		Snippet:      strings.ReplaceAll(snippet, "\n", " "),
+		Payload: &gmail.MessagePart{
+			MimeType: mimeType,
+			Headers: []*gmail.MessagePartHeader{
+				{Name: "From", Value: from},
+				{Name: "To", Value: to},
+				{Name: "Subject", Value: subject},
+				{Name: "Date", Value: sentAt.Format(time.RFC1123Z)},
+				{Name: "Message-ID", Value: fmt.Sprintf("<%s@demo.example.com>", id)},
+			},
+			Body: &gmail.MessagePartBody{
+				Size: int64(len(body)),
+				Data: base64.URLEncoding.EncodeToString([]byte(body)),
+			},
+		},
+	}
+}
+
+// demoAttachment renders an attachment's content in the topic's format
+func demoAttachment(topic demoTopic, subject string) []byte {
+	text := fmt.Sprintf("%s\n\nThis is a generated demo attachment.\n\n- Item one: agreed\n- Item two: pending review\n- Item three: owner TBD\n", subject)
+	if topic.attachment != "docx" {
+		return []byte(text)
+	}
+
+	// A minimal DOCX: one paragraph per line in word/document.xml
+	var paragraphs strings.Builder
+	for _, line := range strings.Split(text, "\n") {
+		fmt.Fprintf(&paragraphs, "<w:p><w:r><w:t>%s</w:t></w:r></w:p>", html.EscapeString(line))
+	}
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	if w, err := archive.Create("word/document.xml"); err == nil {
+		fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?><w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"><w:body>%s</w:body></w:document>`, paragraphs.String())
+	}
+	archive.Close()
+	return buf.Bytes()
+}
@@ -0,0 +1,790 @@
+package gmailclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"auto-gmail/internal/config"
+
+	"google.golang.org/api/gmail/v1"
+	"google.golang.org/api/googleapi"
+)
+
+// Fake is an in-memory Client. It understands a small subset of
+// Gmail search syntax (from:, to:, subject:, is:unread, has:attachment, in:sent,
+// category:, newer_than:/older_than:, after:/before:, filename:, larger:, rfc822msgid: and free text) and
+// honors ETags so cache revalidation can be exercised too.
+type Fake struct {
+	mu          sync.Mutex
+	profile     *gmail.Profile
+	threads     map[string]*gmail.Thread
+	drafts      map[string]*gmail.Draft
+	attachments map[string]*gmail.MessagePartBody // keyed by messageID + "/" + attachmentID
+	labels      map[string]*gmail.Label
+	filters     []*gmail.Filter
+	nextID      int
+}
+
+// Mailbox is the fixture format read by LoadFake. Threads and drafts
+// are stored exactly as the Gmail API returns them with format=full.
+type Mailbox struct {
+	Profile     *gmail.Profile                    `json:"profile"`
+	Threads     []*gmail.Thread                   `json:"threads"`
+	Drafts      []*gmail.Draft                    `json:"drafts"`
+	Attachments map[string]*gmail.MessagePartBody `json:"attachments"`
+}
+
+var (
+	_ Client          = (*Fake)(nil)
+	_ MessageImporter = (*Fake)(nil)
+	_ MailboxSyncer   = (*Fake)(nil)
+	_ BulkModifier    = (*Fake)(nil)
+)
+
+// NewFake creates an empty mailbox for the given address
+func NewFake(emailAddress string) *Fake {
+	return &Fake{
+		profile:     &gmail.Profile{EmailAddress: emailAddress},
+		threads:     make(map[string]*gmail.Thread),
+		drafts:      make(map[string]*gmail.Draft),
+		attachments: make(map[string]*gmail.MessagePartBody),
+		labels:      make(map[string]*gmail.Label),
+	}
+}
+
+// LoadFake builds a mailbox from every *.json fixture in dir (e.g. testdata/gmail)
+func LoadFake(dir string) (*Fake, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+
+	c := NewFake("me@example.com")
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read fixture %s: %v", file, err)
+		}
+		var mailbox Mailbox
+		if err := json.Unmarshal(data, &mailbox); err != nil {
+			return nil, fmt.Errorf("failed to parse fixture %s: %v", file, err)
+		}
+		if mailbox.Profile != nil {
+			c.profile = mailbox.Profile
+		}
+		for _, thread := range mailbox.Threads {
+			c.AddThread(thread)
+		}
+		for _, draft := range mailbox.Drafts {
+			c.drafts[draft.Id] = draft
+		}
+		for key, body := range mailbox.Attachments {
+			c.attachments[key] = body
+		}
+	}
+	return c, nil
+}
+
+// AddThread stores a thread, filling in thread IDs on its messages
+func (c *Fake) AddThread(thread *gmail.Thread) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, message := range thread.Messages {
+		message.ThreadId = thread.Id
+		if message.HistoryId > thread.HistoryId {
+			thread.HistoryId = message.HistoryId
+		}
+	}
+	c.threads[thread.Id] = thread
+}
+
+// AddDraft stores a draft as Drafts.Get would return it
+func (c *Fake) AddDraft(draft *gmail.Draft) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.drafts[draft.Id] = draft
+}
+
+// AddAttachment stores the content served for a message's attachment
+func (c *Fake) AddAttachment(messageID, attachmentID string, data []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.attachments[messageID+"/"+attachmentID] = &gmail.MessagePartBody{
+		AttachmentId: attachmentID,
+		Size:         int64(len(data)),
+		Data:         base64.URLEncoding.EncodeToString(data),
+	}
+}
+
+func (c *Fake) GetProfile(ctx context.Context) (*gmail.Profile, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	profile := *c.profile
+	profile.ThreadsTotal = int64(len(c.threads))
+	return &profile, nil
+}
+
+func (c *Fake) ListThreads(ctx context.Context, query string, maxResults int64) (*gmail.ListThreadsResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Like Gmail, the estimate counts every match, not just the page returned
+	resp := &gmail.ListThreadsResponse{}
+	for _, thread := range c.sortedThreads() {
+		if !c.threadMatches(thread, query) {
+			continue
+		}
+		resp.ResultSizeEstimate++
+		if maxResults > 0 && int64(len(resp.Threads)) >= maxResults {
+			continue
+		}
+		resp.Threads = append(resp.Threads, &gmail.Thread{Id: thread.Id, HistoryId: thread.HistoryId, Snippet: thread.Snippet})
+	}
+	return resp, nil
+}
+
+func (c *Fake) GetThread(ctx context.Context, threadID string, opts GetOptions) (*gmail.Thread, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	thread, ok := c.threads[threadID]
+	if !ok {
+		return nil, notFound("thread", threadID)
+	}
+	etag := fakeETag(thread.HistoryId)
+	if opts.ETag != "" && opts.ETag == etag {
+		return nil, &googleapi.Error{Code: http.StatusNotModified}
+	}
+
+	copied := *thread
+	copied.ServerResponse = googleapi.ServerResponse{HTTPStatusCode: http.StatusOK, Header: http.Header{"Etag": []string{etag}}}
+	return &copied, nil
+}
+
+func (c *Fake) ModifyThread(ctx context.Context, threadID string, req *gmail.ModifyThreadRequest) (*gmail.Thread, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	thread, ok := c.threads[threadID]
+	if !ok {
+		return nil, notFound("thread", threadID)
+	}
+	thread.HistoryId++
+	for _, message := range thread.Messages {
+		var labels []string
+		for _, id := range message.LabelIds {
+			if !containsString(req.RemoveLabelIds, id) {
+				labels = append(labels, id)
+			}
+		}
+		for _, id := range req.AddLabelIds {
+			if !containsString(labels, id) {
+				labels = append(labels, id)
+			}
+		}
+		message.LabelIds = labels
+		message.HistoryId = thread.HistoryId
+	}
+	return &gmail.Thread{Id: thread.Id, HistoryId: thread.HistoryId}, nil
+}
+
+func (c *Fake) ListMessages(ctx context.Context, query string, maxResults int64) (*gmail.ListMessagesResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Like Gmail, the estimate counts every match, not just the page returned
+	resp := &gmail.ListMessagesResponse{}
+	for _, thread := range c.sortedThreads() {
+		for _, message := range thread.Messages {
+			if !messageMatches(message, query) {
+				continue
+			}
+			resp.ResultSizeEstimate++
+			if maxResults > 0 && int64(len(resp.Messages)) >= maxResults {
+				continue
+			}
+			resp.Messages = append(resp.Messages, &gmail.Message{Id: message.Id, ThreadId: thread.Id})
+		}
+	}
+	return resp, nil
+}
+
+func (c *Fake) GetMessage(ctx context.Context, messageID string, opts GetOptions) (*gmail.Message, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	message := c.findMessage(messageID)
+	if message == nil {
+		return nil, notFound("message", messageID)
+	}
+	etag := fakeETag(message.HistoryId)
+	if opts.ETag != "" && opts.ETag == etag {
+		return nil, &googleapi.Error{Code: http.StatusNotModified}
+	}
+
+	copied := *message
+	copied.ServerResponse = googleapi.ServerResponse{HTTPStatusCode: http.StatusOK, Header: http.Header{"Etag": []string{etag}}}
+	return &copied, nil
+}
+
+func (c *Fake) GetAttachment(ctx context.Context, messageID, attachmentID string) (*gmail.MessagePartBody, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	body, ok := c.attachments[messageID+"/"+attachmentID]
+	if !ok {
+		return nil, notFound("attachment", attachmentID)
+	}
+	return body, nil
+}
+
+func (c *Fake) ListDrafts(ctx context.Context) (*gmail.ListDraftsResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ids := make([]string, 0, len(c.drafts))
+	for id := range c.drafts {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	resp := &gmail.ListDraftsResponse{}
+	for _, id := range ids {
+		draft := c.drafts[id]
+		listed := &gmail.Draft{Id: draft.Id}
+		if draft.Message != nil {
+			listed.Message = &gmail.Message{Id: draft.Message.Id, ThreadId: draft.Message.ThreadId}
+		}
+		resp.Drafts = append(resp.Drafts, listed)
+	}
+	return resp, nil
+}
+
+func (c *Fake) GetDraft(ctx context.Context, draftID string, opts GetOptions) (*gmail.Draft, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	draft, ok := c.drafts[draftID]
+	if !ok {
+		return nil, notFound("draft", draftID)
+	}
+	return draft, nil
+}
+
+func (c *Fake) CreateDraft(ctx context.Context, draft *gmail.Draft) (*gmail.Draft, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.nextID++
+	stored := &gmail.Draft{
+		Id:      fmt.Sprintf("r-fake-%d", c.nextID),
+		Message: fakeDraftMessage(draft.Message, fmt.Sprintf("fake-draft-msg-%d", c.nextID)),
+	}
+	c.drafts[stored.Id] = stored
+	return stored, nil
+}
+
+func (c *Fake) UpdateDraft(ctx context.Context, draftID string, draft *gmail.Draft) (*gmail.Draft, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	existing, ok := c.drafts[draftID]
+	if !ok {
+		return nil, notFound("draft", draftID)
+	}
+	messageID := draftID + "-msg"
+	if existing.Message != nil {
+		messageID = existing.Message.Id
+	}
+	stored := &gmail.Draft{Id: draftID, Message: fakeDraftMessage(draft.Message, messageID)}
+	c.drafts[draftID] = stored
+	return stored, nil
+}
+
+func (c *Fake) ListLabels(ctx context.Context) (*gmail.ListLabelsResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	resp := &gmail.ListLabelsResponse{}
+	for _, id := range fakeSystemLabels {
+		resp.Labels = append(resp.Labels, &gmail.Label{Id: id, Name: id, Type: "system"})
+	}
+	ids := make([]string, 0, len(c.labels))
+	for id := range c.labels {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		resp.Labels = append(resp.Labels, c.labels[id])
+	}
+	return resp, nil
+}
+
+func (c *Fake) CreateLabel(ctx context.Context, label *gmail.Label) (*gmail.Label, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, existing := range c.labels {
+		if strings.EqualFold(existing.Name, label.Name) {
+			return nil, &googleapi.Error{Code: http.StatusConflict, Message: "Label name exists or conflicts"}
+		}
+	}
+	c.nextID++
+	stored := *label
+	stored.Id = fmt.Sprintf("Label_%d", c.nextID)
+	stored.Type = "user"
+	c.labels[stored.Id] = &stored
+	return &stored, nil
+}
+
+func (c *Fake) CreateFilter(ctx context.Context, filter *gmail.Filter) (*gmail.Filter, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.nextID++
+	stored := *filter
+	stored.Id = fmt.Sprintf("fake-filter-%d", c.nextID)
+	c.filters = append(c.filters, &stored)
+	return &stored, nil
+}
+
+// SendMessage stores the message as a new sent thread. A message the mailbox sends to
+// itself also lands in the inbox, unread, like in Gmail.
+func (c *Fake) SendMessage(ctx context.Context, message *gmail.Message) (*gmail.Message, error) {
+	raw, err := base64.URLEncoding.DecodeString(message.Raw)
+	if err != nil {
+		return nil, &googleapi.Error{Code: http.StatusBadRequest, Message: fmt.Sprintf("invalid raw message: %v", err)}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	sent, parsed, err := c.storeRaw(raw, "fake-sent", message.ThreadId)
+	if err != nil {
+		return nil, err
+	}
+	sent.LabelIds = []string{"SENT"}
+	if strings.Contains(strings.ToLower(parsed.Header.Get("To")), strings.ToLower(c.profile.EmailAddress)) {
+		sent.LabelIds = append(sent.LabelIds, "INBOX", "UNREAD")
+	}
+	return &gmail.Message{Id: sent.Id, ThreadId: sent.ThreadId, LabelIds: sent.LabelIds}, nil
+}
+
+// ImportMessage stores the message in a new thread with the given labels, dated by
+// its Date header when it has one
+func (c *Fake) ImportMessage(ctx context.Context, raw []byte, labelIDs []string, insert bool) (*gmail.Message, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	imported, parsed, err := c.storeRaw(raw, "fake-imported", "")
+	if err != nil {
+		return nil, err
+	}
+	imported.LabelIds = append([]string(nil), labelIDs...)
+	if date, err := parsed.Header.Date(); err == nil {
+		imported.InternalDate = date.UnixMilli()
+	}
+	return &gmail.Message{Id: imported.Id, ThreadId: imported.ThreadId, LabelIds: imported.LabelIds}, nil
+}
+
+// ListLabelMessages returns the messages with the label, newest first
+func (c *Fake) ListLabelMessages(ctx context.Context, labelID string) ([]string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var messages []*gmail.Message
+	for _, thread := range c.threads {
+		for _, message := range thread.Messages {
+			if hasLabel(message, labelID) {
+				messages = append(messages, message)
+			}
+		}
+	}
+	sort.Slice(messages, func(i, j int) bool { return messages[i].InternalDate > messages[j].InternalDate })
+	ids := make([]string, len(messages))
+	for i, message := range messages {
+		ids[i] = message.Id
+	}
+	return ids, nil
+}
+
+// ListHistory always asks for a full sync; the fake keeps no history
+func (c *Fake) ListHistory(ctx context.Context, startHistoryID uint64, labelID string) ([]string, uint64, error) {
+	return nil, 0, ErrHistoryExpired
+}
+
+// ListAllMessageIDs returns the matching messages in the same order as ListMessages
+func (c *Fake) ListAllMessageIDs(ctx context.Context, query string, limit int) ([]string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var ids []string
+	for _, thread := range c.sortedThreads() {
+		for _, message := range thread.Messages {
+			if limit > 0 && len(ids) >= limit {
+				return ids, nil
+			}
+			if messageMatches(message, query) {
+				ids = append(ids, message.Id)
+			}
+		}
+	}
+	return ids, nil
+}
+
+// BatchModifyMessages changes the labels of each message; unknown IDs are skipped, as Gmail does
+func (c *Fake) BatchModifyMessages(ctx context.Context, messageIDs []string, req *gmail.BatchModifyMessagesRequest) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, id := range messageIDs {
+		message := c.findMessage(id)
+		if message == nil {
+			continue
+		}
+		var labels []string
+		for _, label := range message.LabelIds {
+			if !containsString(req.RemoveLabelIds, label) {
+				labels = append(labels, label)
+			}
+		}
+		for _, label := range req.AddLabelIds {
+			if !containsString(labels, label) {
+				labels = append(labels, label)
+			}
+		}
+		message.LabelIds = labels
+		if thread, ok := c.threads[message.ThreadId]; ok {
+			thread.HistoryId++
+			message.HistoryId = thread.HistoryId
+		}
+	}
+	return nil
+}
+
+// storeRaw parses a raw message into a text/plain message without labels and adds it
+// to threadID or a new thread, returning the stored message for the caller to label.
+// c.mu must be held.
+func (c *Fake) storeRaw(raw []byte, idPrefix, threadID string) (*gmail.Message, *mail.Message, error) {
+	parsed, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return nil, nil, &googleapi.Error{Code: http.StatusBadRequest, Message: fmt.Sprintf("invalid raw message: %v", err)}
+	}
+	body, _ := io.ReadAll(parsed.Body)
+
+	c.nextID++
+	stored := &gmail.Message{
+		Id:           fmt.Sprintf("%s-%d", idPrefix, c.nextID),
+		ThreadId:     threadID,
+		InternalDate: time.Now().UnixMilli(),
+		HistoryId:    1,
+		Snippet:      truncateSnippet(string(body)),
+		Payload: &gmail.MessagePart{
+			MimeType: "text/plain",
+			Body:     &gmail.MessagePartBody{Data: base64.URLEncoding.EncodeToString(body), Size: int64(len(body))},
+		},
+	}
+	for name, values := range parsed.Header {
+		for _, value := range values {
+			stored.Payload.Headers = append(stored.Payload.Headers, &gmail.MessagePartHeader{Name: name, Value: value})
+		}
+	}
+
+	thread, ok := c.threads[stored.ThreadId]
+	if !ok {
+		stored.ThreadId = fmt.Sprintf("fake-thread-%d", c.nextID)
+		thread = &gmail.Thread{Id: stored.ThreadId}
+		c.threads[thread.Id] = thread
+	}
+	thread.HistoryId++
+	stored.HistoryId = thread.HistoryId
+	thread.Messages = append(thread.Messages, stored)
+	return stored, parsed, nil
+}
+
+// truncateSnippet shortens a body to a Gmail-style one-line snippet
+func truncateSnippet(body string) string {
+	snippet := strings.Join(strings.Fields(body), " ")
+	if runes := []rune(snippet); len(runes) > 150 {
+		snippet = string(runes[:150])
+	}
+	return snippet
+}
+
+// sortedThreads returns threads newest first, like the Gmail API
+func (c *Fake) sortedThreads() []*gmail.Thread {
+	threads := make([]*gmail.Thread, 0, len(c.threads))
+	for _, thread := range c.threads {
+		threads = append(threads, thread)
+	}
+	sort.Slice(threads, func(i, j int) bool {
+		return threadDate(threads[i]) > threadDate(threads[j])
+	})
+	return threads
+}
+
+func (c *Fake) threadMatches(thread *gmail.Thread, query string) bool {
+	for _, message := range thread.Messages {
+		if messageMatches(message, query) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Fake) findMessage(messageID string) *gmail.Message {
+	for _, thread := range c.threads {
+		for _, message := range thread.Messages {
+			if message.Id == messageID {
+				return message
+			}
+		}
+	}
+	return nil
+}
+
+// messageMatches reports whether every term of a Gmail-style query matches the message
+func messageMatches(message *gmail.Message, query string) bool {
+	for _, term := range strings.Fields(strings.ToLower(query)) {
+		// A leading '-' excludes what the rest of the term matches
+		if len(term) > 1 && term[0] == '-' {
+			if messageMatches(message, term[1:]) {
+				return false
+			}
+			continue
+		}
+		key, value, hasKey := strings.Cut(term, ":")
+		switch {
+		case hasKey && key == "from":
+			if !strings.Contains(strings.ToLower(fakeHeader(message, "From")), value) {
+				return false
+			}
+		case hasKey && key == "to":
+			if !strings.Contains(strings.ToLower(fakeHeader(message, "To")), value) {
+				return false
+			}
+		case hasKey && key == "deliveredto":
+			recipients := fakeHeader(message, "Delivered-To") + " " + fakeHeader(message, "To") + " " + fakeHeader(message, "Cc")
+			if !strings.Contains(strings.ToLower(recipients), value) {
+				return false
+			}
+		case hasKey && key == "subject":
+			if !strings.Contains(strings.ToLower(fakeHeader(message, "Subject")), value) {
+				return false
+			}
+		case hasKey && (key == "is" || key == "in" || key == "label"):
+			if !hasLabel(message, strings.ToUpper(value)) {
+				return false
+			}
+		case hasKey && key == "category":
+			if !hasCategory(message, value) {
+				return false
+			}
+		case hasKey && (key == "newer_than" || key == "older_than"):
+			age, ok := fakeAge(value)
+			if !ok {
+				return false
+			}
+			newer := message.InternalDate >= time.Now().Add(-age).UnixMilli()
+			if newer != (key == "newer_than") {
+				return false
+			}
+		case hasKey && (key == "after" || key == "before"):
+			day, err := time.ParseInLocation("2006/01/02", strings.ReplaceAll(value, "-", "/"), config.TimeZone())
+			if seconds, parseErr := strconv.ParseInt(value, 10, 64); parseErr == nil {
+				// Gmail also takes Unix seconds, which is how ZonedQuery writes dates
+				day, err = time.Unix(seconds, 0), nil
+			}
+			if err != nil {
+				return false
+			}
+			after := message.InternalDate >= day.UnixMilli()
+			if after != (key == "after") {
+				return false
+			}
+		case hasKey && key == "filename":
+			if message.Payload == nil || !hasFilename(message.Payload.Parts, value) {
+				return false
+			}
+		case hasKey && key == "larger":
+			size, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || message.Payload == nil || partsSize(message.Payload) <= size {
+				return false
+			}
+		case hasKey && key == "has" && value == "attachment":
+			if message.Payload == nil || !hasAttachment(message.Payload.Parts) {
+				return false
+			}
+		case hasKey && key == "rfc822msgid":
+			if strings.Trim(strings.ToLower(fakeHeader(message, "Message-ID")), "<>") != strings.Trim(value, "<>") {
+				return false
+			}
+		case hasKey && key == "has" && value == "nouserlabels":
+			for _, id := range message.LabelIds {
+				if !containsString(fakeSystemLabels, id) && !strings.HasPrefix(id, "CATEGORY_") {
+					return false
+				}
+			}
+		default:
+			text := strings.ToLower(message.Snippet + " " + fakeHeader(message, "Subject") + " " + fakeHeader(message, "From"))
+			if !strings.Contains(text, term) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// fakeAge parses newer_than/older_than values such as "7d", "3m" or "1y"
+func fakeAge(value string) (time.Duration, bool) {
+	if len(value) < 2 {
+		return 0, false
+	}
+	n, err := strconv.Atoi(value[:len(value)-1])
+	if err != nil {
+		return 0, false
+	}
+	day := 24 * time.Hour
+	switch value[len(value)-1] {
+	case 'd':
+		return time.Duration(n) * day, true
+	case 'm':
+		return time.Duration(n) * 30 * day, true
+	case 'y':
+		return time.Duration(n) * 365 * day, true
+	}
+	return 0, false
+}
+
+func hasAttachment(parts []*gmail.MessagePart) bool {
+	for _, part := range parts {
+		if (part.Body != nil && part.Body.AttachmentId != "") || hasAttachment(part.Parts) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasFilename(parts []*gmail.MessagePart, name string) bool {
+	for _, part := range parts {
+		if (part.Filename != "" && strings.Contains(strings.ToLower(part.Filename), name)) || hasFilename(part.Parts, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func partsSize(part *gmail.MessagePart) int64 {
+	var size int64
+	if part.Body != nil {
+		size = part.Body.Size
+	}
+	for _, child := range part.Parts {
+		size += partsSize(child)
+	}
+	return size
+}
+
+// fakeCategoryLabels maps category: search values to the labels behind Gmail's tabs
+var fakeCategoryLabels = map[string]string{
+	"primary":    "CATEGORY_PERSONAL",
+	"personal":   "CATEGORY_PERSONAL",
+	"social":     "CATEGORY_SOCIAL",
+	"promotions": "CATEGORY_PROMOTIONS",
+	"updates":    "CATEGORY_UPDATES",
+	"forums":     "CATEGORY_FORUMS",
+}
+
+// hasCategory reports whether a message is in an inbox tab; inbox mail without
+// a category label counts as primary
+func hasCategory(message *gmail.Message, category string) bool {
+	label, ok := fakeCategoryLabels[category]
+	if !ok {
+		return false
+	}
+	if hasLabel(message, label) {
+		return true
+	}
+	if label != "CATEGORY_PERSONAL" || !hasLabel(message, "INBOX") {
+		return false
+	}
+	for _, other := range fakeCategoryLabels {
+		if hasLabel(message, other) {
+			return false
+		}
+	}
+	return true
+}
+
+func hasLabel(message *gmail.Message, label string) bool {
+	for _, id := range message.LabelIds {
+		if id == label {
+			return true
+		}
+	}
+	return false
+}
+
+func fakeHeader(message *gmail.Message, name string) string {
+	if message.Payload == nil {
+		return ""
+	}
+	for _, header := range message.Payload.Headers {
+		if strings.EqualFold(header.Name, name) {
+			return header.Value
+		}
+	}
+	return ""
+}
+
+func threadDate(thread *gmail.Thread) int64 {
+	var latest int64
+	for _, message := range thread.Messages {
+		if message.InternalDate > latest {
+			latest = message.InternalDate
+		}
+	}
+	return latest
+}
+
+// fakeDraftMessage keeps what Drafts.Get would return for a raw draft message
+func fakeDraftMessage(message *gmail.Message, messageID string) *gmail.Message {
+	stored := &gmail.Message{Id: messageID, LabelIds: []string{"DRAFT"}}
+	if message != nil {
+		stored.ThreadId = message.ThreadId
+		stored.Raw = message.Raw
+	}
+	return stored
+}
+
+// fakeSystemLabels are the built-in labels every mailbox has
+var fakeSystemLabels = []string{"INBOX", "SENT", "DRAFT", "SPAM", "TRASH", "UNREAD", "STARRED", "IMPORTANT"}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func fakeETag(historyID uint64) string {
+	return `"` + strconv.FormatUint(historyID, 10) + `"`
+}
+
+func notFound(kind, id string) error {
+	return &googleapi.Error{Code: http.StatusNotFound, Message: fmt.Sprintf("%s %s not found", kind, id)}
+}
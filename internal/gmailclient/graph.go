@@ -0,0 +1,773 @@
+package gmailclient
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/api/gmail/v1"
+	"google.golang.org/api/googleapi"
+)
+
+// graphBaseURL is the Microsoft Graph endpoint for the signed-in user
+const graphBaseURL = "https://graph.microsoft.com/v1.0/me"
+
+// graphMetadataFields are the message properties read for every message; full
+// messages also download their MIME content
+const graphMetadataFields = "id,conversationId,changeKey,receivedDateTime,subject,bodyPreview,isRead,isDraft,hasAttachments," +
+	"parentFolderId,internetMessageId,categories,flag,from,toRecipients,ccRecipients,bccRecipients"
+
+// graphFolderLabels maps Outlook's well-known folders to Gmail system labels
+var graphFolderLabels = map[string]string{
+	"inbox":        "INBOX",
+	"sentitems":    "SENT",
+	"drafts":       "DRAFT",
+	"deleteditems": "TRASH",
+	"junkemail":    "SPAM",
+}
+
+// GraphClient implements Client with the Microsoft Graph mail API, so the same tools
+// work against Outlook and Microsoft 365 mailboxes. Conversations stand in for
+// threads, categories for user labels and inbox rules for filters. Message bodies and
+// attachments come from each message's MIME content, converted like IMAP messages.
+type GraphClient struct {
+	httpClient *http.Client
+	baseURL    string
+
+	mu sync.Mutex
+	// folderLabels maps folder IDs to system labels; archiveFolderID is used by rules
+	folderLabels    map[string]string
+	archiveFolderID string
+}
+
+// graphMessage is the subset of a Graph message resource the client reads
+type graphMessage struct {
+	ID                string           `json:"id"`
+	ConversationID    string           `json:"conversationId"`
+	ChangeKey         string           `json:"changeKey"`
+	ReceivedDateTime  time.Time        `json:"receivedDateTime"`
+	Subject           string           `json:"subject"`
+	BodyPreview       string           `json:"bodyPreview"`
+	IsRead            bool             `json:"isRead"`
+	IsDraft           bool             `json:"isDraft"`
+	HasAttachments    bool             `json:"hasAttachments"`
+	ParentFolderID    string           `json:"parentFolderId"`
+	InternetMessageID string           `json:"internetMessageId"`
+	Categories        []string         `json:"categories"`
+	Flag              graphFlag        `json:"flag"`
+	From              *graphRecipient  `json:"from"`
+	ToRecipients      []graphRecipient `json:"toRecipients"`
+	CcRecipients      []graphRecipient `json:"ccRecipients"`
+	BccRecipients     []graphRecipient `json:"bccRecipients"`
+}
+
+type graphFlag struct {
+	FlagStatus string `json:"flagStatus"`
+}
+
+type graphRecipient struct {
+	EmailAddress struct {
+		Name    string `json:"name"`
+		Address string `json:"address"`
+	} `json:"emailAddress"`
+}
+
+// graphPage is one page of a Graph collection
+type graphPage struct {
+	Value    json.RawMessage `json:"value"`
+	NextLink string          `json:"@odata.nextLink"`
+}
+
+var _ Client = (*GraphClient)(nil)
+
+// NewGraphClient wraps an HTTP client authorized for Microsoft Graph
+func NewGraphClient(ctx context.Context, httpClient *http.Client) (*GraphClient, error) {
+	return &GraphClient{httpClient: httpClient, baseURL: graphBaseURL}, nil
+}
+
+// do sends a Graph request and decodes the JSON response into out. Non-2xx responses
+// become googleapi errors so callers handle them like Gmail API errors.
+func (c *GraphClient) do(ctx context.Context, method, path string, query url.Values, contentType string, body []byte, out interface{}) error {
+	endpoint := path
+	if !strings.HasPrefix(path, "https://") {
+		endpoint = c.baseURL + path
+		if len(query) > 0 {
+			endpoint += "?" + query.Encode()
+		}
+	}
+
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, method, endpoint, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		// Immutable IDs keep message IDs stable when messages move between folders
+		req.Header.Set("Prefer", `IdType="ImmutableId"`)
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		resp, err := c.httpClient.Do(req)
+		if err != nil {
+			return err
+		}
+		data, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return err
+		}
+
+		// Back off once when throttled
+		if (resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable) && attempt == 0 {
+			wait, _ := strconv.Atoi(resp.Header.Get("Retry-After"))
+			select {
+			case <-time.After(time.Duration(min(max(wait, 1), 30)) * time.Second):
+				continue
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		if resp.StatusCode >= 300 {
+			var graphErr struct {
+				Error struct {
+					Code    string `json:"code"`
+					Message string `json:"message"`
+				} `json:"error"`
+			}
+			json.Unmarshal(data, &graphErr)
+			message := graphErr.Error.Message
+			if message == "" {
+				message = strings.TrimSpace(string(data))
+			}
+			return &googleapi.Error{Code: resp.StatusCode, Message: message, Body: string(data)}
+		}
+
+		switch out := out.(type) {
+		case nil:
+		case *[]byte:
+			*out = data
+		default:
+			if err := json.Unmarshal(data, out); err != nil {
+				return fmt.Errorf("failed to parse Graph response: %v", err)
+			}
+		}
+		return nil
+	}
+}
+
+// listMessages pages through a message collection until limit messages are read
+func (c *GraphClient) listMessages(ctx context.Context, path string, query url.Values, limit int) ([]graphMessage, error) {
+	var messages []graphMessage
+	next := path
+	for next != "" && len(messages) < limit {
+		var page graphPage
+		if err := c.do(ctx, http.MethodGet, next, query, "", nil, &page); err != nil {
+			return nil, err
+		}
+		var batch []graphMessage
+		if err := json.Unmarshal(page.Value, &batch); err != nil {
+			return nil, fmt.Errorf("failed to parse Graph messages: %v", err)
+		}
+		messages = append(messages, batch...)
+		next = page.NextLink
+	}
+	if len(messages) > limit {
+		messages = messages[:limit]
+	}
+	return messages, nil
+}
+
+// loadFolders looks up the IDs of the well-known folders once
+func (c *GraphClient) loadFolders(ctx context.Context) map[string]string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.folderLabels != nil {
+		return c.folderLabels
+	}
+	folderLabels := map[string]string{}
+	for name, label := range graphFolderLabels {
+		var folder struct {
+			ID string `json:"id"`
+		}
+		if err := c.do(ctx, http.MethodGet, "/mailFolders/"+name, url.Values{"$select": {"id"}}, "", nil, &folder); err != nil {
+			// Try again next time rather than caching a partial map
+			return folderLabels
+		}
+		folderLabels[folder.ID] = label
+	}
+	var archive struct {
+		ID string `json:"id"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/mailFolders/archive", url.Values{"$select": {"id"}}, "", nil, &archive); err == nil {
+		c.archiveFolderID = archive.ID
+	}
+	c.folderLabels = folderLabels
+	return folderLabels
+}
+
+// convert turns a Graph message into a Gmail message. With raw MIME content the
+// payload is complete; without it only the headers are filled in, like format=metadata.
+func (c *GraphClient) convert(ctx context.Context, message graphMessage, raw []byte) (*gmail.Message, error) {
+	converted := &gmail.Message{
+		Id:           message.ID,
+		ThreadId:     message.ConversationID,
+		Snippet:      truncateSnippet(message.BodyPreview),
+		InternalDate: message.ReceivedDateTime.UnixMilli(),
+	}
+	if label := c.loadFolders(ctx)[message.ParentFolderID]; label != "" {
+		converted.LabelIds = append(converted.LabelIds, label)
+	}
+	if message.IsDraft && !containsString(converted.LabelIds, "DRAFT") {
+		converted.LabelIds = append(converted.LabelIds, "DRAFT")
+	}
+	if !message.IsRead && !message.IsDraft {
+		converted.LabelIds = append(converted.LabelIds, "UNREAD")
+	}
+	if message.Flag.FlagStatus == "flagged" {
+		converted.LabelIds = append(converted.LabelIds, "STARRED")
+	}
+	converted.LabelIds = append(converted.LabelIds, message.Categories...)
+
+	if raw != nil {
+		parsed, err := parseRFC822(raw)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse message %s: %v", message.ID, err)
+		}
+		converted.Payload = parsed.payload
+		converted.SizeEstimate = int64(len(raw))
+	} else {
+		converted.Payload = &gmail.MessagePart{MimeType: "text/plain", Body: &gmail.MessagePartBody{}}
+		headers := []struct{ name, value string }{
+			{"From", graphAddresses([]graphRecipient{derefRecipient(message.From)})},
+			{"To", graphAddresses(message.ToRecipients)},
+			{"Cc", graphAddresses(message.CcRecipients)},
+			{"Bcc", graphAddresses(message.BccRecipients)},
+			{"Subject", message.Subject},
+			{"Date", message.ReceivedDateTime.Format(time.RFC1123Z)},
+			{"Message-ID", message.InternetMessageID},
+		}
+		for _, header := range headers {
+			if header.value != "" {
+				converted.Payload.Headers = append(converted.Payload.Headers, &gmail.MessagePartHeader{Name: header.name, Value: header.value})
+			}
+		}
+		if message.HasAttachments {
+			converted.Payload.MimeType = "multipart/mixed"
+		}
+	}
+
+	etag := `"` + message.ChangeKey + `"`
+	converted.ServerResponse = googleapi.ServerResponse{HTTPStatusCode: http.StatusOK, Header: http.Header{"Etag": []string{etag}}}
+	return converted, nil
+}
+
+func derefRecipient(recipient *graphRecipient) graphRecipient {
+	if recipient == nil {
+		return graphRecipient{}
+	}
+	return *recipient
+}
+
+// graphAddresses formats recipients as an address list header
+func graphAddresses(recipients []graphRecipient) string {
+	var addresses []string
+	for _, recipient := range recipients {
+		switch {
+		case recipient.EmailAddress.Address == "":
+		case recipient.EmailAddress.Name != "" && recipient.EmailAddress.Name != recipient.EmailAddress.Address:
+			addresses = append(addresses, fmt.Sprintf("%q <%s>", recipient.EmailAddress.Name, recipient.EmailAddress.Address))
+		default:
+			addresses = append(addresses, recipient.EmailAddress.Address)
+		}
+	}
+	return strings.Join(addresses, ", ")
+}
+
+// rawMessage downloads a message's MIME content
+func (c *GraphClient) rawMessage(ctx context.Context, messageID string) ([]byte, error) {
+	var raw []byte
+	err := c.do(ctx, http.MethodGet, "/messages/"+url.PathEscape(messageID)+"/$value", nil, "", nil, &raw)
+	return raw, err
+}
+
+// graphQuery translates Gmail search syntax into an Outlook KQL search and a folder.
+// Terms KQL can't express (stars, labels, importance) are returned as a Gmail query
+// checked against the converted messages.
+func graphQuery(query string) (search, folder, local string) {
+	var kql, rest []string
+	for _, term := range strings.Fields(query) {
+		key, value, hasKey := strings.Cut(strings.ToLower(term), ":")
+		switch {
+		case hasKey && (key == "from" || key == "to" || key == "subject"):
+			kql = append(kql, key+":"+value)
+		case hasKey && key == "cc":
+			kql = append(kql, "cc:"+value)
+		case hasKey && key == "has" && value == "attachment":
+			kql = append(kql, "hasattachments:true")
+		case hasKey && key == "filename":
+			kql = append(kql, "attachment:"+value)
+		case hasKey && key == "is" && (value == "unread" || value == "read"):
+			kql = append(kql, "isread:"+strconv.FormatBool(value == "read"))
+		case hasKey && key == "in" && value != "anywhere":
+			for name, label := range graphFolderLabels {
+				if strings.ToLower(label) == value || (value == "sent" && name == "sentitems") {
+					folder = name
+				}
+			}
+			if value == "drafts" {
+				folder = "drafts"
+			}
+		case hasKey && (key == "newer_than" || key == "older_than"):
+			if age, ok := fakeAge(value); ok {
+				op := ">="
+				if key == "older_than" {
+					op = "<"
+				}
+				kql = append(kql, "received"+op+time.Now().Add(-age).Format("2006-01-02"))
+			}
+		case hasKey && (key == "after" || key == "before"):
+			if day, err := time.Parse("2006/01/02", strings.ReplaceAll(value, "-", "/")); err == nil {
+				op := ">="
+				if key == "before" {
+					op = "<"
+				}
+				kql = append(kql, "received"+op+day.Format("2006-01-02"))
+			}
+		case hasKey && key == "larger":
+			kql = append(kql, "size>"+value)
+		case hasKey && (key == "is" || key == "label" || key == "category"):
+			rest = append(rest, term)
+		default:
+			kql = append(kql, strings.Trim(term, `"`))
+		}
+	}
+	return strings.Join(kql, " "), folder, strings.Join(rest, " ")
+}
+
+// search finds up to limit messages matching a Gmail query, newest first. Like Gmail,
+// trash and junk are left out unless the query asks for them.
+func (c *GraphClient) search(ctx context.Context, query string, limit int) ([]*gmail.Message, error) {
+	search, folder, local := graphQuery(query)
+	path := "/messages"
+	if folder != "" {
+		path = "/mailFolders/" + folder + "/messages"
+	}
+	params := url.Values{"$select": {graphMetadataFields}, "$top": {strconv.Itoa(min(max(limit, 10), 250))}}
+	if search != "" {
+		params.Set("$search", `"`+strings.ReplaceAll(search, `"`, "")+`"`)
+	} else {
+		params.Set("$orderby", "receivedDateTime desc")
+	}
+	found, err := c.listMessages(ctx, path, params, limit*3)
+	if err != nil {
+		return nil, err
+	}
+
+	var messages []*gmail.Message
+	for _, message := range found {
+		converted, err := c.convert(ctx, message, nil)
+		if err != nil {
+			return nil, err
+		}
+		if folder == "" && (hasLabel(converted, "TRASH") || hasLabel(converted, "SPAM")) {
+			continue
+		}
+		if local != "" && !messageMatches(converted, local) {
+			continue
+		}
+		messages = append(messages, converted)
+	}
+	// Search results come back by relevance
+	sort.SliceStable(messages, func(i, j int) bool { return messages[i].InternalDate > messages[j].InternalDate })
+	return messages, nil
+}
+
+func (c *GraphClient) GetProfile(ctx context.Context) (*gmail.Profile, error) {
+	var user struct {
+		Mail              string `json:"mail"`
+		UserPrincipalName string `json:"userPrincipalName"`
+	}
+	if err := c.do(ctx, http.MethodGet, "", url.Values{"$select": {"mail,userPrincipalName"}}, "", nil, &user); err != nil {
+		return nil, err
+	}
+	address := user.Mail
+	if address == "" {
+		address = user.UserPrincipalName
+	}
+	return &gmail.Profile{EmailAddress: address}, nil
+}
+
+func (c *GraphClient) ListThreads(ctx context.Context, query string, maxResults int64) (*gmail.ListThreadsResponse, error) {
+	limit := int(maxResults)
+	if limit <= 0 {
+		limit = 100
+	}
+	messages, err := c.search(ctx, query, limit)
+	if err != nil {
+		return nil, err
+	}
+	resp := &gmail.ListThreadsResponse{}
+	seen := map[string]bool{}
+	for _, message := range messages {
+		if seen[message.ThreadId] {
+			continue
+		}
+		seen[message.ThreadId] = true
+		resp.Threads = append(resp.Threads, &gmail.Thread{Id: message.ThreadId, Snippet: message.Snippet})
+		if len(resp.Threads) >= limit {
+			break
+		}
+	}
+	resp.ResultSizeEstimate = int64(len(resp.Threads))
+	return resp, nil
+}
+
+// conversation lists a conversation's messages, oldest first
+func (c *GraphClient) conversation(ctx context.Context, threadID string) ([]graphMessage, error) {
+	params := url.Values{
+		"$select": {graphMetadataFields},
+		"$filter": {"conversationId eq '" + strings.ReplaceAll(threadID, "'", "''") + "'"},
+		"$top":    {"100"},
+	}
+	messages, err := c.listMessages(ctx, "/messages", params, 500)
+	if err != nil {
+		return nil, err
+	}
+	if len(messages) == 0 {
+		return nil, notFound("thread", threadID)
+	}
+	sort.SliceStable(messages, func(i, j int) bool { return messages[i].ReceivedDateTime.Before(messages[j].ReceivedDateTime) })
+	return messages, nil
+}
+
+func (c *GraphClient) GetThread(ctx context.Context, threadID string, opts GetOptions) (*gmail.Thread, error) {
+	messages, err := c.conversation(ctx, threadID)
+	if err != nil {
+		return nil, err
+	}
+
+	// The thread's ETag covers every message's change key
+	hash := sha1.New()
+	for _, message := range messages {
+		io.WriteString(hash, message.ID+message.ChangeKey)
+	}
+	etag := `"` + hex.EncodeToString(hash.Sum(nil)) + `"`
+	if opts.ETag != "" && opts.ETag == etag {
+		return nil, &googleapi.Error{Code: http.StatusNotModified}
+	}
+
+	thread := &gmail.Thread{Id: threadID}
+	for _, message := range messages {
+		var raw []byte
+		if opts.Format == "" || opts.Format == "full" {
+			if raw, err = c.rawMessage(ctx, message.ID); err != nil {
+				return nil, err
+			}
+		}
+		converted, err := c.convert(ctx, message, raw)
+		if err != nil {
+			return nil, err
+		}
+		thread.Messages = append(thread.Messages, converted)
+	}
+	thread.Snippet = thread.Messages[len(thread.Messages)-1].Snippet
+	thread.ServerResponse = googleapi.ServerResponse{HTTPStatusCode: http.StatusOK, Header: http.Header{"Etag": []string{etag}}}
+	return thread, nil
+}
+
+// ModifyThread maps label changes onto Outlook: UNREAD to the read state, STARRED to
+// the follow-up flag, INBOX/TRASH/SPAM to moves between folders and any other label
+// to a category
+func (c *GraphClient) ModifyThread(ctx context.Context, threadID string, req *gmail.ModifyThreadRequest) (*gmail.Thread, error) {
+	messages, err := c.conversation(ctx, threadID)
+	if err != nil {
+		return nil, err
+	}
+	folders := c.loadFolders(ctx)
+	system := map[string]bool{"UNREAD": true, "STARRED": true, "INBOX": true, "TRASH": true, "SPAM": true, "SENT": true, "DRAFT": true, "IMPORTANT": true}
+
+	for _, message := range messages {
+		update := map[string]interface{}{}
+		if containsString(req.AddLabelIds, "UNREAD") {
+			update["isRead"] = false
+		}
+		if containsString(req.RemoveLabelIds, "UNREAD") {
+			update["isRead"] = true
+		}
+		if containsString(req.AddLabelIds, "STARRED") {
+			update["flag"] = graphFlag{FlagStatus: "flagged"}
+		}
+		if containsString(req.RemoveLabelIds, "STARRED") {
+			update["flag"] = graphFlag{FlagStatus: "notFlagged"}
+		}
+		categories := []string{}
+		changed := false
+		for _, category := range message.Categories {
+			if containsString(req.RemoveLabelIds, category) {
+				changed = true
+				continue
+			}
+			categories = append(categories, category)
+		}
+		for _, label := range req.AddLabelIds {
+			if !system[label] && !containsString(categories, label) {
+				categories = append(categories, label)
+				changed = true
+			}
+		}
+		if changed {
+			update["categories"] = categories
+		}
+		if len(update) > 0 {
+			body, _ := json.Marshal(update)
+			if err := c.do(ctx, http.MethodPatch, "/messages/"+url.PathEscape(message.ID), nil, "application/json", body, nil); err != nil {
+				return nil, err
+			}
+		}
+
+		folder := folders[message.ParentFolderID]
+		destination := ""
+		switch {
+		case containsString(req.AddLabelIds, "TRASH"):
+			destination = "deleteditems"
+		case containsString(req.AddLabelIds, "SPAM"):
+			destination = "junkemail"
+		case containsString(req.RemoveLabelIds, "INBOX") && folder == "INBOX":
+			destination = "archive"
+		case containsString(req.AddLabelIds, "INBOX") && folder != "INBOX" && folder != "SENT" && folder != "DRAFT":
+			destination = "inbox"
+		}
+		if destination != "" {
+			body, _ := json.Marshal(map[string]string{"destinationId": destination})
+			if err := c.do(ctx, http.MethodPost, "/messages/"+url.PathEscape(message.ID)+"/move", nil, "application/json", body, nil); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return &gmail.Thread{Id: threadID}, nil
+}
+
+func (c *GraphClient) ListMessages(ctx context.Context, query string, maxResults int64) (*gmail.ListMessagesResponse, error) {
+	limit := int(maxResults)
+	if limit <= 0 {
+		limit = 100
+	}
+	messages, err := c.search(ctx, query, limit)
+	if err != nil {
+		return nil, err
+	}
+	resp := &gmail.ListMessagesResponse{}
+	for _, message := range messages {
+		resp.Messages = append(resp.Messages, &gmail.Message{Id: message.Id, ThreadId: message.ThreadId})
+		if len(resp.Messages) >= limit {
+			break
+		}
+	}
+	resp.ResultSizeEstimate = int64(len(resp.Messages))
+	return resp, nil
+}
+
+func (c *GraphClient) GetMessage(ctx context.Context, messageID string, opts GetOptions) (*gmail.Message, error) {
+	var message graphMessage
+	if err := c.do(ctx, http.MethodGet, "/messages/"+url.PathEscape(messageID), url.Values{"$select": {graphMetadataFields}}, "", nil, &message); err != nil {
+		return nil, err
+	}
+	if opts.ETag != "" && opts.ETag == `"`+message.ChangeKey+`"` {
+		return nil, &googleapi.Error{Code: http.StatusNotModified}
+	}
+	var raw []byte
+	if opts.Format == "" || opts.Format == "full" {
+		var err error
+		if raw, err = c.rawMessage(ctx, messageID); err != nil {
+			return nil, err
+		}
+	}
+	return c.convert(ctx, message, raw)
+}
+
+// GetAttachment downloads the message's MIME content and returns one attachment from
+// it; attachment IDs are the ones the converted payload carries
+func (c *GraphClient) GetAttachment(ctx context.Context, messageID, attachmentID string) (*gmail.MessagePartBody, error) {
+	raw, err := c.rawMessage(ctx, messageID)
+	if err != nil {
+		return nil, err
+	}
+	parsed, err := parseRFC822(raw)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse message %s: %v", messageID, err)
+	}
+	data, ok := parsed.attachments[attachmentID]
+	if !ok {
+		return nil, notFound("attachment", attachmentID)
+	}
+	return &gmail.MessagePartBody{AttachmentId: attachmentID, Size: int64(len(data)), Data: base64.URLEncoding.EncodeToString(data)}, nil
+}
+
+func (c *GraphClient) ListDrafts(ctx context.Context) (*gmail.ListDraftsResponse, error) {
+	messages, err := c.listMessages(ctx, "/mailFolders/drafts/messages", url.Values{"$select": {"id,conversationId"}, "$top": {"100"}}, 500)
+	if err != nil {
+		return nil, err
+	}
+	resp := &gmail.ListDraftsResponse{}
+	for _, message := range messages {
+		resp.Drafts = append(resp.Drafts, &gmail.Draft{Id: message.ID, Message: &gmail.Message{Id: message.ID, ThreadId: message.ConversationID}})
+	}
+	return resp, nil
+}
+
+// GetDraft returns a draft; Outlook drafts are messages, so draft and message IDs match
+func (c *GraphClient) GetDraft(ctx context.Context, draftID string, opts GetOptions) (*gmail.Draft, error) {
+	message, err := c.GetMessage(ctx, draftID, GetOptions{Format: opts.Format})
+	if err != nil {
+		return nil, err
+	}
+	return &gmail.Draft{Id: draftID, Message: message}, nil
+}
+
+// CreateDraft uploads the draft's raw MIME message to the drafts folder
+func (c *GraphClient) CreateDraft(ctx context.Context, draft *gmail.Draft) (*gmail.Draft, error) {
+	if draft.Message == nil {
+		return nil, &googleapi.Error{Code: http.StatusBadRequest, Message: "draft has no message"}
+	}
+	created, err := c.createFromMIME(ctx, draft.Message.Raw)
+	if err != nil {
+		return nil, err
+	}
+	return &gmail.Draft{Id: created.ID, Message: &gmail.Message{Id: created.ID, ThreadId: created.ConversationID}}, nil
+}
+
+// UpdateDraft replaces a draft. Graph can't rewrite a message's MIME content, so the
+// new version gets a new ID and the old draft is deleted.
+func (c *GraphClient) UpdateDraft(ctx context.Context, draftID string, draft *gmail.Draft) (*gmail.Draft, error) {
+	updated, err := c.CreateDraft(ctx, draft)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.do(ctx, http.MethodDelete, "/messages/"+url.PathEscape(draftID), nil, "", nil, nil); err != nil {
+		return nil, fmt.Errorf("saved the new draft %s but failed to delete the old one: %v", updated.Id, err)
+	}
+	return updated, nil
+}
+
+// createFromMIME saves a base64url raw message as a draft
+func (c *GraphClient) createFromMIME(ctx context.Context, raw string) (*graphMessage, error) {
+	data, err := decodeRaw(raw)
+	if err != nil {
+		return nil, err
+	}
+	var created graphMessage
+	body := []byte(base64.StdEncoding.EncodeToString(data))
+	if err := c.do(ctx, http.MethodPost, "/messages", nil, "text/plain", body, &created); err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+func (c *GraphClient) ListLabels(ctx context.Context) (*gmail.ListLabelsResponse, error) {
+	var categories struct {
+		Value []struct {
+			DisplayName string `json:"displayName"`
+		} `json:"value"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/outlook/masterCategories", nil, "", nil, &categories); err != nil {
+		return nil, err
+	}
+	resp := &gmail.ListLabelsResponse{}
+	for _, id := range fakeSystemLabels {
+		resp.Labels = append(resp.Labels, &gmail.Label{Id: id, Name: id, Type: "system"})
+	}
+	for _, category := range categories.Value {
+		resp.Labels = append(resp.Labels, &gmail.Label{Id: category.DisplayName, Name: category.DisplayName, Type: "user"})
+	}
+	return resp, nil
+}
+
+// CreateLabel creates an Outlook category; its name doubles as the label ID
+func (c *GraphClient) CreateLabel(ctx context.Context, label *gmail.Label) (*gmail.Label, error) {
+	body, _ := json.Marshal(map[string]string{"displayName": label.Name, "color": "preset0"})
+	if err := c.do(ctx, http.MethodPost, "/outlook/masterCategories", nil, "application/json", body, nil); err != nil {
+		return nil, err
+	}
+	created := *label
+	created.Id = label.Name
+	created.Type = "user"
+	return &created, nil
+}
+
+// CreateFilter creates an inbox rule for a sender filter that archives, trashes, marks
+// read or categorizes mail. Other criteria have no rule equivalent here.
+func (c *GraphClient) CreateFilter(ctx context.Context, filter *gmail.Filter) (*gmail.Filter, error) {
+	if filter.Criteria == nil || filter.Criteria.From == "" || filter.Criteria.Query != "" || filter.Criteria.To != "" || filter.Criteria.Subject != "" {
+		return nil, &googleapi.Error{Code: http.StatusNotImplemented, Message: "only filters on the sender are supported for Outlook"}
+	}
+	actions := map[string]interface{}{"stopProcessingRules": true}
+	if filter.Action != nil {
+		var categories []string
+		for _, label := range filter.Action.AddLabelIds {
+			switch label {
+			case "TRASH":
+				actions["delete"] = true
+			case "STARRED", "IMPORTANT", "INBOX":
+			default:
+				categories = append(categories, label)
+			}
+		}
+		if len(categories) > 0 {
+			actions["assignCategories"] = categories
+		}
+		if containsString(filter.Action.RemoveLabelIds, "UNREAD") {
+			actions["markAsRead"] = true
+		}
+		if containsString(filter.Action.RemoveLabelIds, "INBOX") && actions["delete"] == nil {
+			c.loadFolders(ctx)
+			c.mu.Lock()
+			archive := c.archiveFolderID
+			c.mu.Unlock()
+			if archive == "" {
+				return nil, &googleapi.Error{Code: http.StatusNotImplemented, Message: "this mailbox has no Archive folder to move mail to"}
+			}
+			actions["moveToFolder"] = archive
+		}
+	}
+	rule := map[string]interface{}{
+		"displayName": "From " + filter.Criteria.From,
+		"sequence":    1,
+		"isEnabled":   true,
+		"conditions":  map[string]interface{}{"senderContains": []string{filter.Criteria.From}},
+		"actions":     actions,
+	}
+	body, _ := json.Marshal(rule)
+	var created struct {
+		ID string `json:"id"`
+	}
+	if err := c.do(ctx, http.MethodPost, "/mailFolders/inbox/messageRules", nil, "application/json", body, &created); err != nil {
+		return nil, err
+	}
+	stored := *filter
+	stored.Id = created.ID
+	return &stored, nil
+}
+
+// SendMessage saves the raw message as a draft and sends it, so the sent message keeps
+// an ID (immutable IDs survive the move to Sent Items)
+func (c *GraphClient) SendMessage(ctx context.Context, message *gmail.Message) (*gmail.Message, error) {
+	created, err := c.createFromMIME(ctx, message.Raw)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.do(ctx, http.MethodPost, "/messages/"+url.PathEscape(created.ID)+"/send", nil, "", nil, nil); err != nil {
+		return nil, err
+	}
+	return &gmail.Message{Id: created.ID, ThreadId: created.ConversationID, LabelIds: []string{"SENT"}}, nil
+}
@@ -0,0 +1,1052 @@
+package gmailclient
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/mail"
+	"net/smtp"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/api/gmail/v1"
+	"google.golang.org/api/googleapi"
+)
+
+// imapSyncInterval is how long a synced mailbox is served before checking for changes
+const imapSyncInterval = 30 * time.Second
+
+// imapDraftHeader keeps a draft's ID stable across updates, which replace the message
+const imapDraftHeader = "X-Gmail-MCP-Draft-Id"
+
+// IMAPConfig configures the IMAP/SMTP backend
+type IMAPConfig struct {
+	IMAPAddr     string   // host:port; 993 uses implicit TLS, anything else STARTTLS
+	SMTPAddr     string   // host:port; 465 uses implicit TLS, anything else STARTTLS
+	Username     string   // login for both IMAP and SMTP
+	Password     string   // an app password for Gmail and Workspace accounts
+	EmailAddress string   // the mailbox's address
+	Folders      []string // folders synced besides the inbox, sent, drafts and archive folders
+	MaxMessages  int      // most recent messages synced per folder
+}
+
+// IMAPConfigFromEnv reads the GMAIL_MCP_IMAP_* and GMAIL_MCP_SMTP_HOST variables.
+// SMTP defaults to the IMAP host with "imap." replaced by "smtp.", on port 587.
+func IMAPConfigFromEnv() (IMAPConfig, error) {
+	config := IMAPConfig{
+		IMAPAddr:     os.Getenv("GMAIL_MCP_IMAP_HOST"),
+		SMTPAddr:     os.Getenv("GMAIL_MCP_SMTP_HOST"),
+		Username:     os.Getenv("GMAIL_MCP_IMAP_USER"),
+		Password:     os.Getenv("GMAIL_MCP_IMAP_PASSWORD"),
+		EmailAddress: os.Getenv("GMAIL_MCP_IMAP_ADDRESS"),
+		MaxMessages:  500,
+	}
+	if config.IMAPAddr == "" || config.Username == "" || config.Password == "" {
+		return config, fmt.Errorf("GMAIL_MCP_IMAP_HOST, GMAIL_MCP_IMAP_USER and GMAIL_MCP_IMAP_PASSWORD must all be set")
+	}
+	if _, _, err := net.SplitHostPort(config.IMAPAddr); err != nil {
+		config.IMAPAddr = net.JoinHostPort(config.IMAPAddr, "993")
+	}
+	if config.SMTPAddr == "" {
+		host, _, _ := net.SplitHostPort(config.IMAPAddr)
+		config.SMTPAddr = "smtp." + strings.TrimPrefix(host, "imap.")
+	}
+	if _, _, err := net.SplitHostPort(config.SMTPAddr); err != nil {
+		config.SMTPAddr = net.JoinHostPort(config.SMTPAddr, "587")
+	}
+	if config.EmailAddress == "" {
+		if !strings.Contains(config.Username, "@") {
+			return config, fmt.Errorf("GMAIL_MCP_IMAP_ADDRESS must be set when the IMAP user isn't an email address")
+		}
+		config.EmailAddress = config.Username
+	}
+	for _, folder := range strings.Split(os.Getenv("GMAIL_MCP_IMAP_FOLDERS"), ",") {
+		if folder = strings.TrimSpace(folder); folder != "" {
+			config.Folders = append(config.Folders, folder)
+		}
+	}
+	if value := os.Getenv("GMAIL_MCP_IMAP_MAX_MESSAGES"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit <= 0 {
+			return config, fmt.Errorf("invalid GMAIL_MCP_IMAP_MAX_MESSAGES %q", value)
+		}
+		config.MaxMessages = limit
+	}
+	return config, nil
+}
+
+// IMAPClient implements Client over IMAP and SMTP, for accounts that can't use the
+// Gmail API: Workspace accounts with app passwords or other providers. It syncs the
+// recent messages of a few folders into an in-memory Fake and answers reads (including
+// searches) from it. Read, starred, archive and trash changes are written back; other
+// labels and filters only exist locally.
+type IMAPClient struct {
+	config IMAPConfig
+
+	mu   sync.Mutex // guards everything below
+	conn *imapConn
+	// roles maps "inbox", "sent", "drafts", "trash", "junk" and "archive" to folder names
+	roles     map[string]string
+	mailboxes map[string]*imapMailbox
+	index     *Fake
+	// locations lists where each message ID lives on the server
+	locations map[string][]imapLocation
+	// localLabels are labels the server can't store, kept across syncs
+	localLabels map[string][]string
+	userLabels  map[string]*gmail.Label
+	lastSync    time.Time
+	generation  uint64
+	dirty       bool
+}
+
+// imapMailbox is the synced state of one folder
+type imapMailbox struct {
+	uidValidity string
+	messages    map[uint32]*imapMessage
+}
+
+// imapMessage is one synced message
+type imapMessage struct {
+	uid          uint32
+	flags        []string
+	internalDate int64
+	size         int
+	parsed       *parsedMessage
+	gmMessageID  string
+	gmThreadID   string
+}
+
+// imapLocation is one copy of a message on the server
+type imapLocation struct {
+	folder string
+	uid    uint32
+}
+
+var _ Client = (*IMAPClient)(nil)
+
+// NewIMAPClient logs in and syncs the mailbox once, so bad credentials fail at startup
+func NewIMAPClient(ctx context.Context, config IMAPConfig) (*IMAPClient, error) {
+	c := &IMAPClient{
+		config:      config,
+		mailboxes:   map[string]*imapMailbox{},
+		localLabels: map[string][]string{},
+		userLabels:  map[string]*gmail.Label{},
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.sync(); err != nil {
+		return nil, err
+	}
+	log.Printf("📬 Synced %s over IMAP from %s", config.EmailAddress, config.IMAPAddr)
+	return c, nil
+}
+
+// current syncs when the last sync is older than imapSyncInterval and returns the
+// index to answer reads from. A failed sync serves the previous index.
+func (c *IMAPClient) current() (*Fake, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if time.Since(c.lastSync) > imapSyncInterval {
+		if err := c.sync(); err != nil {
+			if c.index == nil {
+				return nil, err
+			}
+			log.Printf("Warning: IMAP sync failed, serving the last synced mailbox: %v", err)
+		}
+	}
+	return c.index, nil
+}
+
+// run calls fn with a logged-in connection, reconnecting and retrying once when the
+// connection (rather than the command) failed
+func (c *IMAPClient) run(fn func(conn *imapConn) error) error {
+	for attempt := 0; ; attempt++ {
+		if c.conn == nil {
+			conn, err := dialIMAP(c.config.IMAPAddr)
+			if err != nil {
+				return err
+			}
+			if err := conn.login(c.config.Username, c.config.Password); err != nil {
+				conn.conn.Close()
+				return err
+			}
+			c.conn = conn
+		}
+		err := fn(c.conn)
+		var statusErr *imapError
+		if err == nil || errors.As(err, &statusErr) || attempt > 0 {
+			return err
+		}
+		c.conn.conn.Close()
+		c.conn = nil
+	}
+}
+
+// sync fetches new messages and flag changes for every synced folder and rebuilds the index
+func (c *IMAPClient) sync() error {
+	err := c.run(func(conn *imapConn) error {
+		if c.roles == nil {
+			roles, err := imapFolderRoles(conn)
+			if err != nil {
+				return err
+			}
+			c.roles = roles
+		}
+		for _, folder := range c.syncedFolders() {
+			if err := c.syncFolder(conn, folder); err != nil {
+				return fmt.Errorf("failed to sync %s: %w", folder, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	c.lastSync = time.Now()
+	if c.dirty || c.index == nil {
+		c.generation++
+		c.rebuild()
+		c.dirty = false
+	}
+	return nil
+}
+
+// syncedFolders lists the folders mirrored locally, without duplicates
+func (c *IMAPClient) syncedFolders() []string {
+	var folders []string
+	for _, folder := range append([]string{"INBOX", c.roles["sent"], c.roles["drafts"], c.roles["archive"]}, c.config.Folders...) {
+		if folder != "" && !containsString(folders, folder) {
+			folders = append(folders, folder)
+		}
+	}
+	return folders
+}
+
+// syncFolder brings one folder's local copy up to date
+func (c *IMAPClient) syncFolder(conn *imapConn, folder string) error {
+	responses, err := conn.command("EXAMINE " + imapQuote(folder))
+	if err != nil {
+		return err
+	}
+	uidValidity, exists := "", 0
+	for _, response := range responses {
+		if code := imapStatusCode(response.text, "UIDVALIDITY"); code != "" {
+			uidValidity = code
+		}
+		if len(response.fields) == 2 && strings.EqualFold(imapString(response.fields[1]), "EXISTS") {
+			exists, _ = strconv.Atoi(imapString(response.fields[0]))
+		}
+	}
+
+	mailbox := c.mailboxes[folder]
+	if mailbox == nil || mailbox.uidValidity != uidValidity {
+		mailbox = &imapMailbox{uidValidity: uidValidity, messages: map[uint32]*imapMessage{}}
+		c.mailboxes[folder] = mailbox
+		c.dirty = true
+	}
+	if exists == 0 {
+		if len(mailbox.messages) > 0 {
+			mailbox.messages = map[uint32]*imapMessage{}
+			c.dirty = true
+		}
+		return nil
+	}
+
+	items := "(UID FLAGS INTERNALDATE RFC822.SIZE BODY.PEEK[])"
+	if conn.capabilities["X-GM-EXT-1"] {
+		items = "(UID FLAGS INTERNALDATE RFC822.SIZE BODY.PEEK[] X-GM-MSGID X-GM-THRID)"
+	}
+
+	// Refresh flags and notice deletions for what's already synced, then fetch what's new
+	var lastUID uint32
+	if len(mailbox.messages) > 0 {
+		minUID := ^uint32(0)
+		for uid := range mailbox.messages {
+			minUID, lastUID = min(minUID, uid), max(lastUID, uid)
+		}
+		responses, err := conn.command(fmt.Sprintf("UID FETCH %d:* (UID FLAGS)", minUID))
+		if err != nil {
+			return err
+		}
+		seen := map[uint32]bool{}
+		for _, response := range responses {
+			fetched, ok := parseIMAPFetch(response)
+			if !ok {
+				continue
+			}
+			seen[fetched.uid] = true
+			if message := mailbox.messages[fetched.uid]; message != nil && strings.Join(message.flags, " ") != strings.Join(fetched.flags, " ") {
+				message.flags = fetched.flags
+				c.dirty = true
+			}
+		}
+		for uid := range mailbox.messages {
+			if !seen[uid] {
+				delete(mailbox.messages, uid)
+				c.dirty = true
+			}
+		}
+		responses, err = conn.command(fmt.Sprintf("UID FETCH %d:* %s", lastUID+1, items))
+		if err != nil {
+			return err
+		}
+		c.addFetched(mailbox, responses, lastUID)
+	} else {
+		start := max(1, exists-c.config.MaxMessages+1)
+		responses, err := conn.command(fmt.Sprintf("FETCH %d:* %s", start, items))
+		if err != nil {
+			return err
+		}
+		c.addFetched(mailbox, responses, 0)
+	}
+	return nil
+}
+
+// addFetched stores fetched messages newer than afterUID ("n:*" always returns the
+// last message, even when nothing is new)
+func (c *IMAPClient) addFetched(mailbox *imapMailbox, responses []imapResponse, afterUID uint32) {
+	for _, response := range responses {
+		fetched, ok := parseIMAPFetch(response)
+		if !ok || fetched.uid <= afterUID || fetched.body == nil {
+			continue
+		}
+		parsed, err := parseRFC822(fetched.body)
+		if err != nil {
+			log.Printf("Warning: Skipping IMAP message %d that couldn't be parsed: %v", fetched.uid, err)
+			continue
+		}
+		fetched.parsed = parsed
+		fetched.size = len(fetched.body)
+		fetched.body = nil
+		mailbox.messages[fetched.uid] = &fetched.imapMessage
+		c.dirty = true
+	}
+}
+
+// imapFetched is a parsed FETCH response, with the raw message until it's parsed
+type imapFetched struct {
+	imapMessage
+	body []byte
+}
+
+// parseIMAPFetch reads a "* n FETCH (...)" response
+func parseIMAPFetch(response imapResponse) (imapFetched, bool) {
+	var fetched imapFetched
+	if len(response.fields) < 3 || !strings.EqualFold(imapString(response.fields[1]), "FETCH") {
+		return fetched, false
+	}
+	items, ok := response.fields[2].([]interface{})
+	if !ok {
+		return fetched, false
+	}
+	for i := 0; i+1 < len(items); i += 2 {
+		value := items[i+1]
+		switch strings.ToUpper(imapString(items[i])) {
+		case "UID":
+			uid, _ := strconv.ParseUint(imapString(value), 10, 32)
+			fetched.uid = uint32(uid)
+		case "FLAGS":
+			flags, _ := value.([]interface{})
+			for _, flag := range flags {
+				fetched.flags = append(fetched.flags, imapString(flag))
+			}
+			sort.Strings(fetched.flags)
+		case "INTERNALDATE":
+			if date, err := time.Parse("_2-Jan-2006 15:04:05 -0700", imapString(value)); err == nil {
+				fetched.internalDate = date.UnixMilli()
+			}
+		case "BODY[]", "RFC822":
+			if body, ok := value.([]byte); ok {
+				fetched.body = body
+			} else if text := imapString(value); text != "NIL" {
+				fetched.body = []byte(text)
+			}
+		case "X-GM-MSGID":
+			fetched.gmMessageID = imapString(value)
+		case "X-GM-THRID":
+			fetched.gmThreadID = imapString(value)
+		}
+	}
+	return fetched, fetched.uid != 0
+}
+
+// imapFolderRoles finds the special-use folders from LIST, falling back to common names
+func imapFolderRoles(conn *imapConn) (map[string]string, error) {
+	responses, err := conn.command(`LIST "" "*"`)
+	if err != nil {
+		return nil, err
+	}
+	specialUse := map[string]string{`\SENT`: "sent", `\DRAFTS`: "drafts", `\TRASH`: "trash", `\JUNK`: "junk", `\ARCHIVE`: "archive", `\ALL`: "archive"}
+	fallbacks := map[string]string{
+		"sent": "sent", "sent items": "sent", "sent mail": "sent", "sent messages": "sent",
+		"drafts": "drafts", "trash": "trash", "deleted items": "trash", "deleted messages": "trash",
+		"junk": "junk", "spam": "junk", "archive": "archive",
+	}
+
+	roles := map[string]string{}
+	named := map[string]string{}
+	for _, response := range responses {
+		if len(response.fields) < 4 || !strings.EqualFold(imapString(response.fields[0]), "LIST") {
+			continue
+		}
+		name := imapString(response.fields[3])
+		flags, _ := response.fields[1].([]interface{})
+		for _, flag := range flags {
+			if role := specialUse[strings.ToUpper(imapString(flag))]; role != "" && roles[role] == "" {
+				roles[role] = name
+			}
+		}
+		base := name
+		if delimiter := imapString(response.fields[2]); delimiter != "" && delimiter != "NIL" {
+			base = base[strings.LastIndex(base, delimiter)+1:]
+		}
+		if role := fallbacks[strings.ToLower(base)]; role != "" && named[role] == "" {
+			named[role] = name
+		}
+	}
+	for role, name := range named {
+		if roles[role] == "" {
+			roles[role] = name
+		}
+	}
+	roles["inbox"] = "INBOX"
+	return roles, nil
+}
+
+// rebuild replaces the index with the synced messages, grouped into threads
+func (c *IMAPClient) rebuild() {
+	index := NewFake(c.config.EmailAddress)
+	for id, label := range c.userLabels {
+		index.labels[id] = label
+	}
+	labelByFolder := map[string]string{c.roles["inbox"]: "INBOX", c.roles["sent"]: "SENT", c.roles["drafts"]: "DRAFT"}
+	for _, folder := range c.config.Folders {
+		if labelByFolder[folder] == "" {
+			labelByFolder[folder] = folder
+			index.labels[folder] = &gmail.Label{Id: folder, Name: folder, Type: "user"}
+		}
+	}
+
+	// The same message can be in several folders (e.g. Gmail's INBOX and All Mail)
+	messages := map[string]*gmail.Message{}
+	threadKeys := map[string]string{}
+	locations := map[string][]imapLocation{}
+	folders := make([]string, 0, len(c.mailboxes))
+	for folder := range c.mailboxes {
+		folders = append(folders, folder)
+	}
+	sort.Strings(folders)
+	for _, folder := range folders {
+		mailbox := c.mailboxes[folder]
+		for uid, synced := range mailbox.messages {
+			id := synced.gmMessageID
+			if id != "" {
+				if n, err := strconv.ParseUint(id, 10, 64); err == nil {
+					id = strconv.FormatUint(n, 16)
+				}
+			} else {
+				id = imapHashID(imapHeader(synced.parsed.payload, "Message-Id"), folder+"/"+mailbox.uidValidity+"/"+strconv.FormatUint(uint64(uid), 10))
+			}
+			locations[id] = append(locations[id], imapLocation{folder: folder, uid: uid})
+
+			message := messages[id]
+			if message == nil {
+				message = &gmail.Message{
+					Id:           id,
+					InternalDate: synced.internalDate,
+					HistoryId:    c.generation,
+					SizeEstimate: int64(synced.size),
+					Snippet:      synced.parsed.snippet,
+					Payload:      synced.parsed.payload,
+				}
+				messages[id] = message
+				for attachmentID, data := range synced.parsed.attachments {
+					index.AddAttachment(id, attachmentID, data)
+				}
+				if synced.gmThreadID != "" {
+					if n, err := strconv.ParseUint(synced.gmThreadID, 10, 64); err == nil {
+						threadKeys[id] = strconv.FormatUint(n, 16)
+					}
+				}
+			}
+			labels := message.LabelIds
+			if label := labelByFolder[folder]; label != "" {
+				labels = append(labels, label)
+			}
+			if !containsString(synced.flags, `\Seen`) {
+				labels = append(labels, "UNREAD")
+			}
+			if containsString(synced.flags, `\Flagged`) {
+				labels = append(labels, "STARRED")
+			}
+			message.LabelIds = labels
+		}
+	}
+
+	for id, message := range messages {
+		for _, label := range c.localLabels[id] {
+			message.LabelIds = append(message.LabelIds, label)
+		}
+		var labels []string
+		for _, label := range message.LabelIds {
+			if !containsString(labels, label) {
+				labels = append(labels, label)
+			}
+		}
+		message.LabelIds = labels
+	}
+
+	for threadID, thread := range imapThreads(messages, threadKeys) {
+		thread.Id = threadID
+		index.AddThread(thread)
+		for _, message := range thread.Messages {
+			if !hasLabel(message, "DRAFT") {
+				continue
+			}
+			draftID := imapHeader(message.Payload, imapDraftHeader)
+			if draftID == "" {
+				draftID = "r-" + message.Id
+			}
+			index.AddDraft(&gmail.Draft{Id: draftID, Message: message})
+		}
+	}
+
+	c.index = index
+	c.locations = locations
+}
+
+// imapThreads groups messages into threads: by Gmail's thread ID when the server has
+// one, otherwise by Message-ID, In-Reply-To and References. A thread's ID is the ID
+// of its earliest message, like in Gmail.
+func imapThreads(messages map[string]*gmail.Message, threadKeys map[string]string) map[string]*gmail.Thread {
+	parent := map[string]string{}
+	var find func(key string) string
+	find = func(key string) string {
+		if parent[key] == "" || parent[key] == key {
+			parent[key] = key
+			return key
+		}
+		root := find(parent[key])
+		parent[key] = root
+		return root
+	}
+	union := func(a, b string) {
+		if rootA, rootB := find(a), find(b); rootA != rootB {
+			parent[rootA] = rootB
+		}
+	}
+
+	for id, message := range messages {
+		node := "id:" + id
+		find(node)
+		if key := threadKeys[id]; key != "" {
+			union(node, "gm:"+key)
+			continue
+		}
+		for _, header := range []string{"Message-Id", "In-Reply-To", "References"} {
+			for _, reference := range strings.Fields(imapHeader(message.Payload, header)) {
+				if strings.HasPrefix(reference, "<") {
+					union(node, "ref:"+strings.ToLower(reference))
+				}
+			}
+		}
+	}
+
+	groups := map[string][]*gmail.Message{}
+	for id, message := range messages {
+		root := find("id:" + id)
+		groups[root] = append(groups[root], message)
+	}
+	threads := map[string]*gmail.Thread{}
+	for _, group := range groups {
+		sort.Slice(group, func(i, j int) bool {
+			if group[i].InternalDate != group[j].InternalDate {
+				return group[i].InternalDate < group[j].InternalDate
+			}
+			return group[i].Id < group[j].Id
+		})
+		threads[group[0].Id] = &gmail.Thread{Messages: group, Snippet: group[len(group)-1].Snippet}
+	}
+	return threads
+}
+
+// imapHashID derives a stable Gmail-style hex ID from a Message-ID header, or from
+// fallback for messages without one
+func imapHashID(messageID, fallback string) string {
+	key := strings.ToLower(strings.TrimSpace(messageID))
+	if key == "" {
+		key = fallback
+	}
+	sum := sha1.Sum([]byte(key))
+	return hex.EncodeToString(sum[:8])
+}
+
+// imapHeader returns a header of a converted payload
+func imapHeader(payload *gmail.MessagePart, name string) string {
+	if payload == nil {
+		return ""
+	}
+	for _, header := range payload.Headers {
+		if strings.EqualFold(header.Name, name) {
+			return header.Value
+		}
+	}
+	return ""
+}
+
+func (c *IMAPClient) GetProfile(ctx context.Context) (*gmail.Profile, error) {
+	index, err := c.current()
+	if err != nil {
+		return nil, err
+	}
+	return index.GetProfile(ctx)
+}
+
+func (c *IMAPClient) ListThreads(ctx context.Context, query string, maxResults int64) (*gmail.ListThreadsResponse, error) {
+	index, err := c.current()
+	if err != nil {
+		return nil, err
+	}
+	return index.ListThreads(ctx, query, maxResults)
+}
+
+func (c *IMAPClient) GetThread(ctx context.Context, threadID string, opts GetOptions) (*gmail.Thread, error) {
+	index, err := c.current()
+	if err != nil {
+		return nil, err
+	}
+	return index.GetThread(ctx, threadID, opts)
+}
+
+func (c *IMAPClient) ListMessages(ctx context.Context, query string, maxResults int64) (*gmail.ListMessagesResponse, error) {
+	index, err := c.current()
+	if err != nil {
+		return nil, err
+	}
+	return index.ListMessages(ctx, query, maxResults)
+}
+
+func (c *IMAPClient) GetMessage(ctx context.Context, messageID string, opts GetOptions) (*gmail.Message, error) {
+	index, err := c.current()
+	if err != nil {
+		return nil, err
+	}
+	return index.GetMessage(ctx, messageID, opts)
+}
+
+func (c *IMAPClient) GetAttachment(ctx context.Context, messageID, attachmentID string) (*gmail.MessagePartBody, error) {
+	index, err := c.current()
+	if err != nil {
+		return nil, err
+	}
+	return index.GetAttachment(ctx, messageID, attachmentID)
+}
+
+func (c *IMAPClient) ListDrafts(ctx context.Context) (*gmail.ListDraftsResponse, error) {
+	index, err := c.current()
+	if err != nil {
+		return nil, err
+	}
+	return index.ListDrafts(ctx)
+}
+
+func (c *IMAPClient) GetDraft(ctx context.Context, draftID string, opts GetOptions) (*gmail.Draft, error) {
+	index, err := c.current()
+	if err != nil {
+		return nil, err
+	}
+	return index.GetDraft(ctx, draftID, opts)
+}
+
+func (c *IMAPClient) ListLabels(ctx context.Context) (*gmail.ListLabelsResponse, error) {
+	index, err := c.current()
+	if err != nil {
+		return nil, err
+	}
+	return index.ListLabels(ctx)
+}
+
+// CreateLabel creates a label that only exists in this server, since IMAP has no labels
+func (c *IMAPClient) CreateLabel(ctx context.Context, label *gmail.Label) (*gmail.Label, error) {
+	index, err := c.current()
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, existing := range c.userLabels {
+		if strings.EqualFold(existing.Name, label.Name) {
+			return nil, &googleapi.Error{Code: http.StatusConflict, Message: "Label name exists or conflicts"}
+		}
+	}
+	stored := *label
+	stored.Id = fmt.Sprintf("Label_local_%d", len(c.userLabels)+1)
+	stored.Type = "user"
+	c.userLabels[stored.Id] = &stored
+	index.labels[stored.Id] = &stored
+	return &stored, nil
+}
+
+// CreateFilter always fails: IMAP has no server-side filters
+func (c *IMAPClient) CreateFilter(ctx context.Context, filter *gmail.Filter) (*gmail.Filter, error) {
+	return nil, &googleapi.Error{Code: http.StatusNotImplemented, Message: "filters aren't supported over IMAP"}
+}
+
+// ModifyThread stores read and starred changes as IMAP flags, moves threads out of the
+// inbox to the archive folder and into the trash folder, and keeps other labels locally
+func (c *IMAPClient) ModifyThread(ctx context.Context, threadID string, req *gmail.ModifyThreadRequest) (*gmail.Thread, error) {
+	index, err := c.current()
+	if err != nil {
+		return nil, err
+	}
+	thread, err := index.GetThread(ctx, threadID, GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var flagChanges []string
+	for label, flag := range map[string]string{"UNREAD": `\Seen`, "STARRED": `\Flagged`} {
+		add, remove := containsString(req.AddLabelIds, label), containsString(req.RemoveLabelIds, label)
+		// Adding UNREAD removes \Seen
+		if label == "UNREAD" {
+			add, remove = remove, add
+		}
+		if add {
+			flagChanges = append(flagChanges, "+FLAGS.SILENT ("+flag+")")
+		}
+		if remove {
+			flagChanges = append(flagChanges, "-FLAGS.SILENT ("+flag+")")
+		}
+	}
+	moveTo := ""
+	switch {
+	case containsString(req.AddLabelIds, "TRASH"):
+		moveTo = c.roles["trash"]
+	case containsString(req.AddLabelIds, "SPAM"):
+		moveTo = c.roles["junk"]
+	case containsString(req.RemoveLabelIds, "INBOX"):
+		moveTo = c.roles["archive"]
+	}
+
+	err = c.run(func(conn *imapConn) error {
+		for _, message := range thread.Messages {
+			for _, location := range c.locations[message.Id] {
+				if _, err := conn.command("SELECT " + imapQuote(location.folder)); err != nil {
+					return err
+				}
+				for _, change := range flagChanges {
+					if _, err := conn.command(fmt.Sprintf("UID STORE %d %s", location.uid, change)); err != nil {
+						return err
+					}
+				}
+				if moveTo != "" && moveTo != location.folder && (location.folder == "INBOX" || containsString(req.AddLabelIds, "TRASH") || containsString(req.AddLabelIds, "SPAM")) {
+					if err := imapMove(conn, location.uid, moveTo); err != nil {
+						return err
+					}
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to update thread %s over IMAP: %v", threadID, err)
+	}
+
+	// Labels IMAP can't store stay local
+	serverLabels := []string{"UNREAD", "STARRED", "INBOX", "TRASH", "SPAM", "SENT", "DRAFT"}
+	for _, message := range thread.Messages {
+		labels := c.localLabels[message.Id]
+		var kept []string
+		for _, label := range labels {
+			if !containsString(req.RemoveLabelIds, label) {
+				kept = append(kept, label)
+			}
+		}
+		for _, label := range req.AddLabelIds {
+			if !containsString(serverLabels, label) && !containsString(kept, label) {
+				kept = append(kept, label)
+			}
+		}
+		c.localLabels[message.Id] = kept
+	}
+	c.dirty = true
+	c.lastSync = time.Time{}
+	return index.ModifyThread(ctx, threadID, req)
+}
+
+// imapMove moves a message from the selected folder, with MOVE when the server has it
+func imapMove(conn *imapConn, uid uint32, folder string) error {
+	if conn.capabilities["MOVE"] {
+		_, err := conn.command(fmt.Sprintf("UID MOVE %d %s", uid, imapQuote(folder)))
+		return err
+	}
+	if _, err := conn.command(fmt.Sprintf("UID COPY %d %s", uid, imapQuote(folder))); err != nil {
+		return err
+	}
+	return imapDelete(conn, uid)
+}
+
+// imapDelete removes a message from the selected folder
+func imapDelete(conn *imapConn, uid uint32) error {
+	if _, err := conn.command(fmt.Sprintf(`UID STORE %d +FLAGS.SILENT (\Deleted)`, uid)); err != nil {
+		return err
+	}
+	if conn.capabilities["UIDPLUS"] {
+		_, err := conn.command(fmt.Sprintf("UID EXPUNGE %d", uid))
+		return err
+	}
+	_, err := conn.command("EXPUNGE")
+	return err
+}
+
+func (c *IMAPClient) CreateDraft(ctx context.Context, draft *gmail.Draft) (*gmail.Draft, error) {
+	return c.saveDraft("r-"+imapRandomID(), draft)
+}
+
+// UpdateDraft saves the new version and deletes the old one; the draft ID stays the same
+func (c *IMAPClient) UpdateDraft(ctx context.Context, draftID string, draft *gmail.Draft) (*gmail.Draft, error) {
+	index, err := c.current()
+	if err != nil {
+		return nil, err
+	}
+	existing, err := index.GetDraft(ctx, draftID, GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	saved, err := c.saveDraft(draftID, draft)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if existing.Message != nil {
+		locations := c.locations[existing.Message.Id]
+		err := c.run(func(conn *imapConn) error {
+			for _, location := range locations {
+				if _, err := conn.command("SELECT " + imapQuote(location.folder)); err != nil {
+					return err
+				}
+				if err := imapDelete(conn, location.uid); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			log.Printf("Warning: Could not delete the previous version of draft %s: %v", draftID, err)
+		}
+		c.lastSync = time.Time{}
+	}
+	return saved, nil
+}
+
+// saveDraft appends a raw draft to the drafts folder and returns it once synced
+func (c *IMAPClient) saveDraft(draftID string, draft *gmail.Draft) (*gmail.Draft, error) {
+	if draft.Message == nil {
+		return nil, &googleapi.Error{Code: http.StatusBadRequest, Message: "draft has no message"}
+	}
+	raw, err := decodeRaw(draft.Message.Raw)
+	if err != nil {
+		return nil, err
+	}
+	raw = withHeader(withoutHeader(raw, imapDraftHeader), imapDraftHeader, draftID)
+	raw = c.withMessageID(raw)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	folder := c.roles["drafts"]
+	if folder == "" {
+		return nil, fmt.Errorf("the IMAP server has no drafts folder")
+	}
+	if err := c.run(func(conn *imapConn) error {
+		return conn.appendMessage(folder, `\Draft \Seen`, raw)
+	}); err != nil {
+		return nil, fmt.Errorf("failed to save draft over IMAP: %v", err)
+	}
+	c.dirty = true
+	if err := c.sync(); err != nil {
+		return nil, err
+	}
+	saved, err := c.index.GetDraft(context.Background(), draftID, GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return &gmail.Draft{Id: saved.Id, Message: &gmail.Message{Id: saved.Message.Id, ThreadId: saved.Message.ThreadId}}, nil
+}
+
+// SendMessage sends a raw message over SMTP to its To, Cc and Bcc recipients and saves
+// a copy to the sent folder (Gmail's SMTP server saves its own)
+func (c *IMAPClient) SendMessage(ctx context.Context, message *gmail.Message) (*gmail.Message, error) {
+	raw, err := decodeRaw(message.Raw)
+	if err != nil {
+		return nil, err
+	}
+	raw = c.withMessageID(raw)
+	parsed, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return nil, &googleapi.Error{Code: http.StatusBadRequest, Message: fmt.Sprintf("invalid raw message: %v", err)}
+	}
+	if parsed.Header.Get("Date") == "" {
+		raw = withHeader(raw, "Date", time.Now().Format(time.RFC1123Z))
+	}
+	var recipients []string
+	for _, header := range []string{"To", "Cc", "Bcc"} {
+		addresses, _ := parsed.Header.AddressList(header)
+		for _, address := range addresses {
+			recipients = append(recipients, address.Address)
+		}
+	}
+	if len(recipients) == 0 {
+		return nil, &googleapi.Error{Code: http.StatusBadRequest, Message: "message has no recipients"}
+	}
+	raw = withoutHeader(raw, "Bcc")
+	if err := c.sendSMTP(recipients, raw); err != nil {
+		return nil, fmt.Errorf("failed to send message over SMTP: %v", err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	smtpHost, _, _ := net.SplitHostPort(c.config.SMTPAddr)
+	if folder := c.roles["sent"]; folder != "" && !strings.HasSuffix(smtpHost, "gmail.com") {
+		if err := c.run(func(conn *imapConn) error {
+			return conn.appendMessage(folder, `\Seen`, raw)
+		}); err != nil {
+			log.Printf("Warning: Sent message could not be saved to %s: %v", folder, err)
+		}
+	}
+	c.dirty = true
+	if err := c.sync(); err != nil {
+		log.Printf("Warning: IMAP sync after sending failed: %v", err)
+	}
+
+	id := imapHashID(parsed.Header.Get("Message-Id"), "")
+	if sent, err := c.index.GetMessage(ctx, id, GetOptions{}); err == nil {
+		return &gmail.Message{Id: sent.Id, ThreadId: sent.ThreadId, LabelIds: sent.LabelIds}, nil
+	}
+	return &gmail.Message{Id: id, ThreadId: message.ThreadId, LabelIds: []string{"SENT"}}, nil
+}
+
+// sendSMTP delivers raw to recipients, with implicit TLS on port 465 and STARTTLS otherwise
+func (c *IMAPClient) sendSMTP(recipients []string, raw []byte) error {
+	host, port, err := net.SplitHostPort(c.config.SMTPAddr)
+	if err != nil {
+		return err
+	}
+	auth := smtp.PlainAuth("", c.config.Username, c.config.Password, host)
+	if port != "465" {
+		return smtp.SendMail(c.config.SMTPAddr, auth, c.config.EmailAddress, recipients, raw)
+	}
+
+	conn, err := tls.DialWithDialer(&net.Dialer{Timeout: 30 * time.Second}, "tcp", c.config.SMTPAddr, &tls.Config{ServerName: host})
+	if err != nil {
+		return err
+	}
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+	if err := client.Auth(auth); err != nil {
+		return err
+	}
+	if err := client.Mail(c.config.EmailAddress); err != nil {
+		return err
+	}
+	for _, recipient := range recipients {
+		if err := client.Rcpt(recipient); err != nil {
+			return err
+		}
+	}
+	writer, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := writer.Write(raw); err != nil {
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// withMessageID adds a Message-ID to raw when it has none, so the message can be found
+// again after it's synced
+func (c *IMAPClient) withMessageID(raw []byte) []byte {
+	if parsed, err := mail.ReadMessage(bytes.NewReader(raw)); err == nil && parsed.Header.Get("Message-Id") != "" {
+		return raw
+	}
+	domain := c.config.EmailAddress[strings.LastIndex(c.config.EmailAddress, "@")+1:]
+	return withHeader(raw, "Message-ID", "<"+imapRandomID()+"@"+domain+">")
+}
+
+// decodeRaw decodes a Gmail API raw message, padded or not
+func decodeRaw(raw string) ([]byte, error) {
+	data, err := base64.URLEncoding.DecodeString(raw)
+	if err != nil {
+		data, err = base64.RawURLEncoding.DecodeString(raw)
+	}
+	if err != nil {
+		return nil, &googleapi.Error{Code: http.StatusBadRequest, Message: fmt.Sprintf("invalid raw message: %v", err)}
+	}
+	return data, nil
+}
+
+// withHeader prepends a header line to a raw message
+func withHeader(raw []byte, name, value string) []byte {
+	return append([]byte(name+": "+value+"\r\n"), raw...)
+}
+
+// withoutHeader drops every occurrence of a header, including folded continuation
+// lines, from a raw message's header section
+func withoutHeader(raw []byte, name string) []byte {
+	end := bytes.Index(raw, []byte("\r\n\r\n"))
+	separator := "\r\n"
+	if end < 0 {
+		end, separator = bytes.Index(raw, []byte("\n\n")), "\n"
+	}
+	if end < 0 {
+		return raw
+	}
+	var kept []string
+	dropping := false
+	for _, line := range strings.Split(string(raw[:end]), separator) {
+		if strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t") {
+			if !dropping {
+				kept = append(kept, line)
+			}
+			continue
+		}
+		field, _, _ := strings.Cut(line, ":")
+		dropping = strings.EqualFold(strings.TrimSpace(field), name)
+		if !dropping {
+			kept = append(kept, line)
+		}
+	}
+	return append([]byte(strings.Join(kept, separator)), raw[end:]...)
+}
+
+// imapRandomID returns a random hex ID for new drafts and Message-IDs
+func imapRandomID() string {
+	buf := make([]byte, 12)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
@@ -0,0 +1,362 @@
+package gmailclient
+
+import (
+	"bufio"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// imapTimeout bounds each IMAP command, including reading its responses
+const imapTimeout = 2 * time.Minute
+
+// imapConn is a minimal IMAP4rev1 client connection: enough to log in, list,
+// select, fetch, store, move and append
+type imapConn struct {
+	conn         net.Conn
+	r            *bufio.Reader
+	tag          int
+	capabilities map[string]bool
+}
+
+// imapResponse is one response line. Data responses ("* 3 FETCH (...)") are parsed
+// into fields of strings (atoms and quoted strings), []byte (literals) and
+// []interface{} (lists); status responses keep their text as is.
+type imapResponse struct {
+	tag    string
+	status string
+	text   string
+	fields []interface{}
+}
+
+// imapError is a NO or BAD answer to a command. Any other error from a command
+// means the connection itself failed.
+type imapError struct {
+	status, text string
+}
+
+func (e *imapError) Error() string {
+	return e.status + " " + e.text
+}
+
+// dialIMAP connects to addr (host:port): implicit TLS on port 993, STARTTLS otherwise
+func dialIMAP(addr string) (*imapConn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid IMAP address %q: %v", addr, err)
+	}
+	dialer := &net.Dialer{Timeout: 30 * time.Second}
+
+	var conn net.Conn
+	if port == "993" {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, &tls.Config{ServerName: host})
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to IMAP server %s: %v", addr, err)
+	}
+
+	c := &imapConn{conn: conn, r: bufio.NewReader(conn)}
+	c.conn.SetDeadline(time.Now().Add(imapTimeout))
+	greeting, err := c.readResponse()
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to read IMAP greeting: %v", err)
+	}
+	if greeting.status == "BYE" {
+		conn.Close()
+		return nil, fmt.Errorf("IMAP server refused the connection: %s", greeting.text)
+	}
+
+	if port != "993" {
+		if _, err := c.command("STARTTLS"); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("IMAP server %s doesn't support STARTTLS: %v", addr, err)
+		}
+		tlsConn := tls.Client(conn, &tls.Config{ServerName: host})
+		if err := tlsConn.Handshake(); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("IMAP TLS handshake failed: %v", err)
+		}
+		c.conn, c.r = tlsConn, bufio.NewReader(tlsConn)
+	}
+	return c, nil
+}
+
+// login authenticates and records the server's capabilities
+func (c *imapConn) login(username, password string) error {
+	if _, err := c.command("LOGIN " + imapQuote(username) + " " + imapQuote(password)); err != nil {
+		return fmt.Errorf("IMAP login failed: %v", err)
+	}
+	responses, err := c.command("CAPABILITY")
+	if err != nil {
+		return err
+	}
+	c.capabilities = map[string]bool{}
+	for _, response := range responses {
+		if len(response.fields) > 0 && strings.EqualFold(imapString(response.fields[0]), "CAPABILITY") {
+			for _, field := range response.fields[1:] {
+				c.capabilities[strings.ToUpper(imapString(field))] = true
+			}
+		}
+	}
+	return nil
+}
+
+// command sends one command and returns its untagged responses, or an error when
+// the server doesn't answer OK
+func (c *imapConn) command(command string) ([]imapResponse, error) {
+	c.tag++
+	tag := fmt.Sprintf("A%d", c.tag)
+	c.conn.SetDeadline(time.Now().Add(imapTimeout))
+	if _, err := io.WriteString(c.conn, tag+" "+command+"\r\n"); err != nil {
+		return nil, err
+	}
+	return c.readUntilTagged(tag)
+}
+
+// appendMessage uploads a message to folder with flags such as `\Draft \Seen`
+func (c *imapConn) appendMessage(folder, flags string, message []byte) error {
+	c.tag++
+	tag := fmt.Sprintf("A%d", c.tag)
+	c.conn.SetDeadline(time.Now().Add(imapTimeout))
+	if _, err := fmt.Fprintf(c.conn, "%s APPEND %s (%s) {%d}\r\n", tag, imapQuote(folder), flags, len(message)); err != nil {
+		return err
+	}
+
+	// Wait for the server to ask for the literal
+	for {
+		response, err := c.readResponse()
+		if err != nil {
+			return err
+		}
+		if response.tag == "+" {
+			break
+		}
+		if response.tag == tag {
+			return &imapError{status: response.status, text: response.text}
+		}
+	}
+	if _, err := c.conn.Write(append(message, '\r', '\n')); err != nil {
+		return err
+	}
+	_, err := c.readUntilTagged(tag)
+	return err
+}
+
+// readUntilTagged collects untagged responses until the tagged completion of tag
+func (c *imapConn) readUntilTagged(tag string) ([]imapResponse, error) {
+	var untagged []imapResponse
+	for {
+		response, err := c.readResponse()
+		if err != nil {
+			return untagged, err
+		}
+		switch response.tag {
+		case tag:
+			if response.status != "OK" {
+				return untagged, &imapError{status: response.status, text: response.text}
+			}
+			return untagged, nil
+		case "*":
+			if response.status == "BYE" {
+				return untagged, fmt.Errorf("IMAP server closed the connection: %s", response.text)
+			}
+			untagged = append(untagged, response)
+		}
+	}
+}
+
+// close logs out and closes the connection
+func (c *imapConn) close() {
+	c.command("LOGOUT")
+	c.conn.Close()
+}
+
+// readResponse reads one response line, including any literals inside it
+func (c *imapConn) readResponse() (imapResponse, error) {
+	var response imapResponse
+	tag, err := c.readAtom()
+	if err != nil {
+		return response, err
+	}
+	response.tag = tag
+	if tag == "+" {
+		response.text, err = c.readRestOfLine()
+		return response, err
+	}
+
+	c.skipSpaces()
+	first, err := c.readValue()
+	if err != nil {
+		return response, err
+	}
+	switch status := strings.ToUpper(imapString(first)); status {
+	case "OK", "NO", "BAD", "BYE", "PREAUTH":
+		response.status = status
+		response.text, err = c.readRestOfLine()
+		return response, err
+	}
+
+	response.fields = []interface{}{first}
+	for {
+		c.skipSpaces()
+		b, err := c.r.ReadByte()
+		if err != nil {
+			return response, err
+		}
+		if b == '\r' {
+			_, err := c.r.ReadByte() // \n
+			return response, err
+		}
+		if b == '\n' {
+			return response, nil
+		}
+		c.r.UnreadByte()
+		value, err := c.readValue()
+		if err != nil {
+			return response, err
+		}
+		response.fields = append(response.fields, value)
+	}
+}
+
+// readValue reads an atom, quoted string, literal or parenthesized list
+func (c *imapConn) readValue() (interface{}, error) {
+	b, err := c.r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	switch b {
+	case '(':
+		var list []interface{}
+		for {
+			c.skipSpaces()
+			next, err := c.r.ReadByte()
+			if err != nil {
+				return nil, err
+			}
+			if next == ')' {
+				return list, nil
+			}
+			c.r.UnreadByte()
+			value, err := c.readValue()
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, value)
+		}
+	case '"':
+		var quoted strings.Builder
+		for {
+			next, err := c.r.ReadByte()
+			if err != nil {
+				return nil, err
+			}
+			if next == '"' {
+				return quoted.String(), nil
+			}
+			if next == '\\' {
+				if next, err = c.r.ReadByte(); err != nil {
+					return nil, err
+				}
+			}
+			quoted.WriteByte(next)
+		}
+	case '{':
+		sizeText, err := c.r.ReadString('}')
+		if err != nil {
+			return nil, err
+		}
+		size, err := strconv.Atoi(strings.TrimSuffix(strings.TrimSuffix(sizeText, "}"), "+"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid IMAP literal size %q", sizeText)
+		}
+		if _, err := c.r.ReadString('\n'); err != nil {
+			return nil, err
+		}
+		literal := make([]byte, size)
+		_, err = io.ReadFull(c.r, literal)
+		return literal, err
+	}
+	c.r.UnreadByte()
+	return c.readAtom()
+}
+
+// readAtom reads up to the next space, parenthesis or line end. Brackets are kept
+// whole, so "BODY[]" and "[UIDVALIDITY 42]" are single atoms.
+func (c *imapConn) readAtom() (string, error) {
+	var atom strings.Builder
+	depth := 0
+	for {
+		b, err := c.r.ReadByte()
+		if err != nil {
+			return atom.String(), err
+		}
+		switch {
+		case b == '[':
+			depth++
+		case b == ']':
+			depth--
+		case depth == 0 && (b == ' ' || b == '(' || b == ')' || b == '\r' || b == '\n'):
+			c.r.UnreadByte()
+			return atom.String(), nil
+		}
+		atom.WriteByte(b)
+	}
+}
+
+// readRestOfLine returns the rest of the current line without its line ending
+func (c *imapConn) readRestOfLine() (string, error) {
+	line, err := c.r.ReadString('\n')
+	return strings.TrimSpace(line), err
+}
+
+// skipSpaces consumes spaces before the next value
+func (c *imapConn) skipSpaces() {
+	for {
+		b, err := c.r.ReadByte()
+		if err != nil {
+			return
+		}
+		if b != ' ' {
+			c.r.UnreadByte()
+			return
+		}
+	}
+}
+
+// imapQuote renders s as an IMAP quoted string
+func imapQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// imapString returns an atom, quoted string or literal as a string, or "" for lists
+func imapString(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	}
+	return ""
+}
+
+// imapStatusCode returns the value of a response code such as "[UIDVALIDITY 42]" in text
+func imapStatusCode(text, code string) string {
+	start := strings.Index(strings.ToUpper(text), "["+code+" ")
+	if start < 0 {
+		return ""
+	}
+	rest := text[start+len(code)+2:]
+	end := strings.IndexAny(rest, "] ")
+	if end < 0 {
+		return ""
+	}
+	return rest[:end]
+}
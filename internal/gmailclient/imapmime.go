@@ -0,0 +1,231 @@
+package gmailclient
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"google.golang.org/api/gmail/v1"
+)
+
+// htmlTags strips markup when a message only has an HTML body to take a snippet from
+var htmlTags = regexp.MustCompile(`(?s)<style.*?</style>|<script.*?</script>|<[^>]*>`)
+
+// parsedMessage is an RFC 822 message converted to the Gmail API's format=full shape
+type parsedMessage struct {
+	payload *gmail.MessagePart
+	snippet string
+	// attachments holds attachment content by attachment ID
+	attachments map[string][]byte
+}
+
+// parseRFC822 converts a raw message into a Gmail payload, with attachment bodies
+// replaced by attachment IDs as Messages.Get returns them
+func parseRFC822(raw []byte) (*parsedMessage, error) {
+	message, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return nil, err
+	}
+	parsed := &parsedMessage{attachments: map[string][]byte{}}
+	parsed.payload = parsed.convertPart(textproto.MIMEHeader(message.Header), message.Body, "")
+	parsed.payload.Headers = mimeHeaders(textproto.MIMEHeader(message.Header))
+
+	if text := parsed.firstText(parsed.payload, "text/plain"); text != "" {
+		parsed.snippet = truncateSnippet(text)
+	} else if html := parsed.firstText(parsed.payload, "text/html"); html != "" {
+		parsed.snippet = truncateSnippet(mimeHTMLText(html))
+	}
+	return parsed, nil
+}
+
+// MIMEAttachment is one named attachment of a raw message, with its decoded content
+type MIMEAttachment struct {
+	Filename string
+	MIMEType string
+	Data     []byte
+}
+
+// MIMEAttachments returns the named attachments of a raw message
+func MIMEAttachments(raw []byte) ([]MIMEAttachment, error) {
+	parsed, err := parseRFC822(raw)
+	if err != nil {
+		return nil, err
+	}
+	var attachments []MIMEAttachment
+	var walk func(part *gmail.MessagePart)
+	walk = func(part *gmail.MessagePart) {
+		if part.Filename != "" && part.Body != nil && part.Body.AttachmentId != "" {
+			attachments = append(attachments, MIMEAttachment{Filename: part.Filename, MIMEType: part.MimeType, Data: parsed.attachments[part.Body.AttachmentId]})
+		}
+		for _, child := range part.Parts {
+			walk(child)
+		}
+	}
+	walk(parsed.payload)
+	return attachments, nil
+}
+
+// convertPart converts one MIME part and, for multiparts, its children
+func (p *parsedMessage) convertPart(header textproto.MIMEHeader, body io.Reader, partID string) *gmail.MessagePart {
+	mediaType, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		mediaType, params = "text/plain", map[string]string{}
+	}
+	part := &gmail.MessagePart{PartId: partID, MimeType: mediaType, Headers: mimeHeaders(header), Body: &gmail.MessagePartBody{}}
+
+	if strings.HasPrefix(mediaType, "multipart/") && params["boundary"] != "" {
+		reader := multipart.NewReader(body, params["boundary"])
+		for i := 0; ; i++ {
+			child, err := reader.NextRawPart()
+			if err != nil {
+				break
+			}
+			childID := fmt.Sprint(i)
+			if partID != "" {
+				childID = partID + "." + childID
+			}
+			part.Parts = append(part.Parts, p.convertPart(child.Header, child, childID))
+		}
+		return part
+	}
+
+	data := decodeTransferEncoding(header.Get("Content-Transfer-Encoding"), body)
+	_, dispositionParams, _ := mime.ParseMediaType(header.Get("Content-Disposition"))
+	part.Filename = dispositionParams["filename"]
+	if part.Filename == "" {
+		part.Filename = params["name"]
+	}
+	part.Body.Size = int64(len(data))
+
+	if part.Filename != "" || strings.HasPrefix(strings.ToLower(header.Get("Content-Disposition")), "attachment") || !strings.HasPrefix(mediaType, "text/") {
+		attachmentID := "att-" + partID
+		if partID == "" {
+			attachmentID = "att-0"
+		}
+		part.Body.AttachmentId = attachmentID
+		p.attachments[attachmentID] = data
+		return part
+	}
+
+	text := decodeCharset(params["charset"], data)
+	part.Body.Data = base64.URLEncoding.EncodeToString([]byte(text))
+	part.Body.Size = int64(len(text))
+	return part
+}
+
+// firstText returns the decoded body of the first part of mimeType
+func (p *parsedMessage) firstText(part *gmail.MessagePart, mimeType string) string {
+	if part.MimeType == mimeType && part.Body != nil && part.Body.Data != "" {
+		data, err := base64.URLEncoding.DecodeString(part.Body.Data)
+		if err == nil {
+			return string(data)
+		}
+	}
+	for _, child := range part.Parts {
+		if text := p.firstText(child, mimeType); text != "" {
+			return text
+		}
+	}
+	return ""
+}
+
+// mimeHeaders lists a part's headers, decoding RFC 2047 encoded words as the Gmail API does
+func mimeHeaders(header textproto.MIMEHeader) []*gmail.MessagePartHeader {
+	names := make([]string, 0, len(header))
+	for name := range header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	decoder := &mime.WordDecoder{CharsetReader: func(charset string, input io.Reader) (io.Reader, error) {
+		data, err := io.ReadAll(input)
+		if err != nil {
+			return nil, err
+		}
+		return strings.NewReader(decodeCharset(charset, data)), nil
+	}}
+	var headers []*gmail.MessagePartHeader
+	for _, name := range names {
+		for _, value := range header[name] {
+			if decoded, err := decoder.DecodeHeader(value); err == nil {
+				value = decoded
+			}
+			headers = append(headers, &gmail.MessagePartHeader{Name: name, Value: value})
+		}
+	}
+	return headers
+}
+
+// decodeTransferEncoding undoes base64 or quoted-printable encoding
+func decodeTransferEncoding(encoding string, body io.Reader) []byte {
+	var reader io.Reader = body
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "base64":
+		reader = base64.NewDecoder(base64.StdEncoding, &newlineStripper{r: body})
+	case "quoted-printable":
+		reader = quotedprintable.NewReader(body)
+	}
+	data, _ := io.ReadAll(reader)
+	return data
+}
+
+// newlineStripper drops line breaks so base64 bodies split over lines decode
+type newlineStripper struct {
+	r io.Reader
+}
+
+func (s *newlineStripper) Read(p []byte) (int, error) {
+	n, err := s.r.Read(p)
+	kept := 0
+	for _, b := range p[:n] {
+		if b != '\r' && b != '\n' && b != ' ' && b != '\t' {
+			p[kept] = b
+			kept++
+		}
+	}
+	return kept, err
+}
+
+// decodeCharset converts Latin-1 and Windows-1252 text to UTF-8; other charsets are
+// kept when already valid UTF-8 and otherwise read as Latin-1
+func decodeCharset(charset string, data []byte) string {
+	switch strings.ToLower(strings.TrimSpace(charset)) {
+	case "", "utf-8", "utf8", "us-ascii", "ascii":
+		if utf8.Valid(data) {
+			return string(data)
+		}
+	}
+	if utf8.Valid(data) && !strings.Contains(strings.ToLower(charset), "8859") && !strings.Contains(strings.ToLower(charset), "1252") {
+		return string(data)
+	}
+	runes := make([]rune, len(data))
+	for i, b := range data {
+		runes[i] = rune(b)
+	}
+	return string(runes)
+}
+
+// mimeHTMLText reduces an HTML body to its text for a snippet
+func mimeHTMLText(html string) string {
+	return strings.NewReplacer("&nbsp;", " ", "&amp;", "&", "&lt;", "<", "&gt;", ">", "&quot;", `"`, "&#39;", "'").Replace(htmlTags.ReplaceAllString(html, " "))
+}
+
+// ParseMIME converts a raw message or MIME entity, such as a decrypted PGP/MIME
+// body, into a Gmail payload. Attachment contents aren't kept.
+func ParseMIME(raw []byte) (*gmail.MessagePart, error) {
+	parsed, err := parseRFC822(raw)
+	if err != nil {
+		return nil, err
+	}
+	return parsed.payload, nil
+}
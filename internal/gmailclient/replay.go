@@ -0,0 +1,212 @@
+package gmailclient
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// recordedHeaders are the only response headers kept in fixtures; everything else
+// (cookies, server and tracing headers) is dropped when recording
+var recordedHeaders = []string{"Content-Type", "ETag"}
+
+// droppedQueryParams never end up in fixture keys or files
+var droppedQueryParams = map[string]bool{"access_token": true, "key": true, "quotaUser": true}
+
+// recording is one Gmail API response stored as a fixture file
+type recording struct {
+	Key    string            `json:"key"`
+	Status int               `json:"status"`
+	Header map[string]string `json:"header,omitempty"`
+	// JSON holds JSON bodies verbatim so fixtures stay readable; Body holds anything else
+	JSON json.RawMessage `json:"json,omitempty"`
+	Body string          `json:"body,omitempty"`
+}
+
+// recordingTransport forwards requests and saves each response under dir
+type recordingTransport struct {
+	next http.RoundTripper
+	dir  string
+}
+
+// RecordHTTPClient wraps an authorized HTTP client so every Gmail API response is
+// also written to dir as a sanitized fixture that NewReplayClient can serve later.
+// Request credentials and all but a few response headers are never written.
+func RecordHTTPClient(client *http.Client, dir string) *http.Client {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		log.Printf("Warning: Could not create recording directory %s: %v", dir, err)
+		return client
+	}
+	next := client.Transport
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	recorded := *client
+	recorded.Transport = &recordingTransport{next: next, dir: dir}
+	log.Printf("⏺️  Recording Gmail API responses to %s", dir)
+	return &recorded
+}
+
+func (t *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	key, err := requestKey(req)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	rec := recording{Key: key, Status: resp.StatusCode, Header: map[string]string{}}
+	for _, name := range recordedHeaders {
+		if value := resp.Header.Get(name); value != "" {
+			rec.Header[name] = value
+		}
+	}
+	if json.Valid(body) && len(body) > 0 {
+		rec.JSON = body
+	} else {
+		rec.Body = string(body)
+	}
+
+	data, err := json.MarshalIndent(rec, "", "  ")
+	if err == nil {
+		// Fixtures contain mailbox content, keep them private to the user
+		err = os.WriteFile(fixturePath(t.dir, key), data, 0600)
+	}
+	if err != nil {
+		log.Printf("Warning: Could not record %s: %v", key, err)
+	}
+	return resp, nil
+}
+
+// replayTransport answers requests from fixtures recorded by RecordHTTPClient
+type replayTransport struct {
+	dir string
+}
+
+// NewReplayClient creates a Client that serves previously recorded responses from dir
+// without any network access or credentials. Requests that were never recorded fail
+// with a 404 naming the missing request.
+func NewReplayClient(ctx context.Context, dir string) (*APIClient, error) {
+	if _, err := os.Stat(dir); err != nil {
+		return nil, fmt.Errorf("replay directory not found: %v", err)
+	}
+	log.Printf("⏯️  Replaying Gmail API responses from %s", dir)
+	return NewAPIClient(ctx, &http.Client{Transport: &replayTransport{dir: dir}}, "me")
+}
+
+func (t *replayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	key, err := requestKey(req)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &http.Response{
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     http.Header{},
+		Request:    req,
+	}
+
+	data, err := os.ReadFile(fixturePath(t.dir, key))
+	if err != nil {
+		message, _ := json.Marshal(fmt.Sprintf("no recorded response for %s", key))
+		resp.StatusCode = http.StatusNotFound
+		resp.Header.Set("Content-Type", "application/json")
+		resp.Body = io.NopCloser(strings.NewReader(fmt.Sprintf(`{"error":{"code":404,"message":%s}}`, message)))
+		return resp, nil
+	}
+
+	var rec recording
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return nil, fmt.Errorf("invalid recording for %s: %v", key, err)
+	}
+	resp.StatusCode = rec.Status
+	resp.Status = fmt.Sprintf("%d %s", rec.Status, http.StatusText(rec.Status))
+	for name, value := range rec.Header {
+		resp.Header.Set(name, value)
+	}
+	body := []byte(rec.Body)
+	if len(rec.JSON) > 0 {
+		body = rec.JSON
+	}
+	resp.ContentLength = int64(len(body))
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	return resp, nil
+}
+
+// requestKey identifies a request independently of credentials and batch boundaries.
+// Batch requests are keyed by the sub-request lines they contain.
+func requestKey(req *http.Request) (string, error) {
+	query := req.URL.Query()
+	for param := range droppedQueryParams {
+		query.Del(param)
+	}
+	key := req.Method + " " + req.URL.Path
+	if encoded := sortedQuery(query); encoded != "" {
+		key += "?" + encoded
+	}
+
+	if req.Body == nil || req.Method == http.MethodGet {
+		return key, nil
+	}
+	body, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return "", err
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+
+	if strings.HasPrefix(req.Header.Get("Content-Type"), "multipart/mixed") {
+		var lines []string
+		for _, line := range strings.Split(string(body), "\n") {
+			if strings.HasPrefix(line, "GET ") {
+				lines = append(lines, strings.TrimSpace(line))
+			}
+		}
+		return key + " [" + strings.Join(lines, ", ") + "]", nil
+	}
+	sum := sha256.Sum256(body)
+	return key + " body:" + hex.EncodeToString(sum[:8]), nil
+}
+
+func sortedQuery(query url.Values) string {
+	names := make([]string, 0, len(query))
+	for name := range query {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var parts []string
+	for _, name := range names {
+		for _, value := range query[name] {
+			parts = append(parts, url.QueryEscape(name)+"="+url.QueryEscape(value))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// fixturePath maps a request key to its fixture file
+func fixturePath(dir, key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(dir, hex.EncodeToString(sum[:16])+".json")
+}
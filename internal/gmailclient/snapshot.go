@@ -0,0 +1,457 @@
+package gmailclient
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/api/gmail/v1"
+	"google.golang.org/api/googleapi"
+)
+
+// SyncedAtHeader is set on responses served from the offline snapshot instead of
+// Gmail. Its value is when the data was last synced, in RFC 3339 format.
+const SyncedAtHeader = "X-Snapshot-Synced-At"
+
+// ErrOffline is returned for calls the offline snapshot can't answer
+var ErrOffline = errors.New("gmail is unavailable and this request can't be served from the offline snapshot")
+
+// IsUnavailable reports whether err means Gmail couldn't be reached (network
+// failures, 5xx and rate limiting) rather than that the request itself was bad
+func IsUnavailable(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, ErrOffline) {
+		return true
+	}
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) {
+		return apiErr.Code >= 500 || apiErr.Code == http.StatusTooManyRequests
+	}
+	var netErr net.Error
+	var urlErr *url.Error
+	return errors.As(err, &netErr) || errors.As(err, &urlErr)
+}
+
+// snapshotEntry is one synced object on disk
+type snapshotEntry struct {
+	SyncedAt time.Time      `json:"syncedAt"`
+	Profile  *gmail.Profile `json:"profile,omitempty"`
+	Thread   *gmail.Thread  `json:"thread,omitempty"`
+	Message  *gmail.Message `json:"message,omitempty"`
+}
+
+// Snapshot is a Client that keeps a local copy of every full thread and message
+// fetched through it, and answers from that copy when Gmail is unavailable.
+// Responses served locally carry SyncedAtHeader so callers can mark them as stale.
+type Snapshot struct {
+	// online is the live backend; nil when running from the snapshot only
+	online Client
+	dir    string
+	mu     sync.Mutex
+}
+
+var (
+	_ Client          = (*Snapshot)(nil)
+	_ BatchGetter     = (*Snapshot)(nil)
+	_ MessageImporter = (*Snapshot)(nil)
+	_ MailboxSyncer   = (*Snapshot)(nil)
+	_ BulkModifier    = (*Snapshot)(nil)
+)
+
+// NewSnapshot wraps online with a snapshot stored in dir. Pass a nil online
+// client to serve everything from a previously synced snapshot.
+func NewSnapshot(online Client, dir string) *Snapshot {
+	return &Snapshot{online: online, dir: dir}
+}
+
+// fallback reports whether a failed (or impossible) online call should be answered locally
+func (s *Snapshot) fallback(op string, err error) bool {
+	if s.online == nil {
+		return true
+	}
+	if !IsUnavailable(err) {
+		return false
+	}
+	log.Printf("📴 Gmail unavailable for %s (%v), using offline snapshot", op, err)
+	return true
+}
+
+func (s *Snapshot) GetProfile(ctx context.Context) (*gmail.Profile, error) {
+	var err error
+	if s.online != nil {
+		var profile *gmail.Profile
+		if profile, err = s.online.GetProfile(ctx); err == nil {
+			s.save("profile", "", &snapshotEntry{Profile: profile})
+			return profile, nil
+		}
+	}
+	if !s.fallback("profile", err) {
+		return nil, err
+	}
+
+	entry, ok := s.load("profile", "")
+	if !ok || entry.Profile == nil {
+		return nil, ErrOffline
+	}
+	entry.Profile.ServerResponse = syncedResponse(entry.SyncedAt)
+	return entry.Profile, nil
+}
+
+func (s *Snapshot) ListThreads(ctx context.Context, query string, maxResults int64) (*gmail.ListThreadsResponse, error) {
+	var err error
+	if s.online != nil {
+		var resp *gmail.ListThreadsResponse
+		if resp, err = s.online.ListThreads(ctx, query, maxResults); err == nil {
+			return resp, nil
+		}
+	}
+	if !s.fallback("search", err) {
+		return nil, err
+	}
+
+	mailbox, syncedAt, err := s.mailbox()
+	if err != nil {
+		return nil, err
+	}
+	resp, err := mailbox.ListThreads(ctx, query, maxResults)
+	if err != nil {
+		return nil, err
+	}
+	resp.ServerResponse = syncedResponse(syncedAt)
+	return resp, nil
+}
+
+func (s *Snapshot) GetThread(ctx context.Context, threadID string, opts GetOptions) (*gmail.Thread, error) {
+	var err error
+	if s.online != nil {
+		var thread *gmail.Thread
+		if thread, err = s.online.GetThread(ctx, threadID, opts); err == nil {
+			if isFull(opts) {
+				s.save("thread", threadID, &snapshotEntry{Thread: thread})
+			}
+			return thread, nil
+		}
+	}
+	if !s.fallback("thread "+threadID, err) {
+		return nil, err
+	}
+
+	entry, ok := s.load("thread", threadID)
+	if !ok || entry.Thread == nil {
+		return nil, fmt.Errorf("thread %s is not in the offline snapshot: %w", threadID, ErrOffline)
+	}
+	entry.Thread.ServerResponse = syncedResponse(entry.SyncedAt)
+	return entry.Thread, nil
+}
+
+func (s *Snapshot) ListMessages(ctx context.Context, query string, maxResults int64) (*gmail.ListMessagesResponse, error) {
+	var err error
+	if s.online != nil {
+		var resp *gmail.ListMessagesResponse
+		if resp, err = s.online.ListMessages(ctx, query, maxResults); err == nil {
+			return resp, nil
+		}
+	}
+	if !s.fallback("search", err) {
+		return nil, err
+	}
+
+	mailbox, syncedAt, err := s.mailbox()
+	if err != nil {
+		return nil, err
+	}
+	resp, err := mailbox.ListMessages(ctx, query, maxResults)
+	if err != nil {
+		return nil, err
+	}
+	resp.ServerResponse = syncedResponse(syncedAt)
+	return resp, nil
+}
+
+func (s *Snapshot) GetMessage(ctx context.Context, messageID string, opts GetOptions) (*gmail.Message, error) {
+	var err error
+	if s.online != nil {
+		var message *gmail.Message
+		if message, err = s.online.GetMessage(ctx, messageID, opts); err == nil {
+			if isFull(opts) {
+				s.save("message", messageID, &snapshotEntry{Message: message})
+			}
+			return message, nil
+		}
+	}
+	if !s.fallback("message "+messageID, err) {
+		return nil, err
+	}
+
+	if entry, ok := s.load("message", messageID); ok && entry.Message != nil {
+		entry.Message.ServerResponse = syncedResponse(entry.SyncedAt)
+		return entry.Message, nil
+	}
+
+	// The message may only have been synced as part of its thread
+	mailbox, _, err := s.mailbox()
+	if err != nil {
+		return nil, err
+	}
+	message, err := mailbox.GetMessage(ctx, messageID, GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("message %s is not in the offline snapshot: %w", messageID, ErrOffline)
+	}
+	if entry, ok := s.load("thread", message.ThreadId); ok {
+		message.ServerResponse = syncedResponse(entry.SyncedAt)
+	}
+	return message, nil
+}
+
+func (s *Snapshot) GetAttachment(ctx context.Context, messageID, attachmentID string) (*gmail.MessagePartBody, error) {
+	if s.online == nil {
+		return nil, ErrOffline
+	}
+	return s.online.GetAttachment(ctx, messageID, attachmentID)
+}
+
+func (s *Snapshot) ListDrafts(ctx context.Context) (*gmail.ListDraftsResponse, error) {
+	if s.online == nil {
+		return nil, ErrOffline
+	}
+	return s.online.ListDrafts(ctx)
+}
+
+func (s *Snapshot) GetDraft(ctx context.Context, draftID string, opts GetOptions) (*gmail.Draft, error) {
+	if s.online == nil {
+		return nil, ErrOffline
+	}
+	return s.online.GetDraft(ctx, draftID, opts)
+}
+
+func (s *Snapshot) CreateDraft(ctx context.Context, draft *gmail.Draft) (*gmail.Draft, error) {
+	if s.online == nil {
+		return nil, ErrOffline
+	}
+	return s.online.CreateDraft(ctx, draft)
+}
+
+func (s *Snapshot) UpdateDraft(ctx context.Context, draftID string, draft *gmail.Draft) (*gmail.Draft, error) {
+	if s.online == nil {
+		return nil, ErrOffline
+	}
+	return s.online.UpdateDraft(ctx, draftID, draft)
+}
+
+func (s *Snapshot) ModifyThread(ctx context.Context, threadID string, req *gmail.ModifyThreadRequest) (*gmail.Thread, error) {
+	if s.online == nil {
+		return nil, ErrOffline
+	}
+	return s.online.ModifyThread(ctx, threadID, req)
+}
+
+func (s *Snapshot) ListLabels(ctx context.Context) (*gmail.ListLabelsResponse, error) {
+	if s.online == nil {
+		return nil, ErrOffline
+	}
+	return s.online.ListLabels(ctx)
+}
+
+func (s *Snapshot) CreateLabel(ctx context.Context, label *gmail.Label) (*gmail.Label, error) {
+	if s.online == nil {
+		return nil, ErrOffline
+	}
+	return s.online.CreateLabel(ctx, label)
+}
+
+func (s *Snapshot) CreateFilter(ctx context.Context, filter *gmail.Filter) (*gmail.Filter, error) {
+	if s.online == nil {
+		return nil, ErrOffline
+	}
+	return s.online.CreateFilter(ctx, filter)
+}
+
+func (s *Snapshot) SendMessage(ctx context.Context, message *gmail.Message) (*gmail.Message, error) {
+	if s.online == nil {
+		return nil, ErrOffline
+	}
+	return s.online.SendMessage(ctx, message)
+}
+
+// ImportMessage forwards to the online client when it can import
+func (s *Snapshot) ImportMessage(ctx context.Context, raw []byte, labelIDs []string, insert bool) (*gmail.Message, error) {
+	importer, ok := s.online.(MessageImporter)
+	if s.online == nil || !ok {
+		return nil, ErrOffline
+	}
+	return importer.ImportMessage(ctx, raw, labelIDs, insert)
+}
+
+// ListLabelMessages forwards to the online client when it can sync
+func (s *Snapshot) ListLabelMessages(ctx context.Context, labelID string) ([]string, error) {
+	syncer, ok := s.online.(MailboxSyncer)
+	if s.online == nil || !ok {
+		return nil, ErrOffline
+	}
+	return syncer.ListLabelMessages(ctx, labelID)
+}
+
+// ListHistory forwards to the online client when it can sync
+func (s *Snapshot) ListHistory(ctx context.Context, startHistoryID uint64, labelID string) ([]string, uint64, error) {
+	syncer, ok := s.online.(MailboxSyncer)
+	if s.online == nil || !ok {
+		return nil, 0, ErrOffline
+	}
+	return syncer.ListHistory(ctx, startHistoryID, labelID)
+}
+
+// ListAllMessageIDs forwards to the online client when it can list in bulk
+func (s *Snapshot) ListAllMessageIDs(ctx context.Context, query string, limit int) ([]string, error) {
+	modifier, ok := s.online.(BulkModifier)
+	if s.online == nil || !ok {
+		return nil, ErrOffline
+	}
+	return modifier.ListAllMessageIDs(ctx, query, limit)
+}
+
+// BatchModifyMessages forwards to the online client when it can modify in bulk
+func (s *Snapshot) BatchModifyMessages(ctx context.Context, messageIDs []string, req *gmail.BatchModifyMessagesRequest) error {
+	modifier, ok := s.online.(BulkModifier)
+	if s.online == nil || !ok {
+		return ErrOffline
+	}
+	return modifier.BatchModifyMessages(ctx, messageIDs, req)
+}
+
+// BatchGet forwards to the online client and syncs full threads and messages from
+// the responses. Offline it fails, so callers fall back to single gets served locally.
+func (s *Snapshot) BatchGet(ctx context.Context, requests []BatchRequest) ([]BatchResponse, error) {
+	batcher, ok := s.online.(BatchGetter)
+	if s.online == nil || !ok {
+		return nil, ErrOffline
+	}
+	responses, err := batcher.BatchGet(ctx, requests)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, resp := range responses {
+		if resp.Status != http.StatusOK || i >= len(requests) {
+			continue
+		}
+		path, query, _ := strings.Cut(requests[i].Path, "?")
+		if query != "format=full" {
+			continue
+		}
+		kind, id, _ := strings.Cut(path, "/")
+		id, err := url.PathUnescape(id)
+		if err != nil {
+			continue
+		}
+		switch kind {
+		case "threads":
+			var thread gmail.Thread
+			if json.Unmarshal(resp.Body, &thread) == nil {
+				s.save("thread", id, &snapshotEntry{Thread: &thread})
+			}
+		case "messages":
+			var message gmail.Message
+			if json.Unmarshal(resp.Body, &message) == nil {
+				s.save("message", id, &snapshotEntry{Message: &message})
+			}
+		}
+	}
+	return responses, nil
+}
+
+// mailbox loads every synced thread into a Fake so offline searches can reuse its
+// query matching. It also returns when the most recent thread was synced.
+func (s *Snapshot) mailbox() (*Fake, time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var syncedAt time.Time
+	files, err := filepath.Glob(filepath.Join(s.dir, "thread", "*.json"))
+	if err != nil || len(files) == 0 {
+		return nil, syncedAt, fmt.Errorf("no offline snapshot in %s: %w", s.dir, ErrOffline)
+	}
+
+	mailbox := NewFake("me")
+	for _, file := range files {
+		entry, ok := readSnapshotEntry(file)
+		if !ok || entry.Thread == nil {
+			continue
+		}
+		mailbox.AddThread(entry.Thread)
+		if entry.SyncedAt.After(syncedAt) {
+			syncedAt = entry.SyncedAt
+		}
+	}
+	return mailbox, syncedAt, nil
+}
+
+// save writes entry for one object; failures only cost offline coverage
+func (s *Snapshot) save(kind, id string, entry *snapshotEntry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry.SyncedAt = time.Now()
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(filepath.Join(s.dir, kind), 0700); err != nil {
+		log.Printf("Warning: Could not create offline snapshot directory: %v", err)
+		return
+	}
+	// The snapshot is mailbox content, keep it private to the user
+	if err := os.WriteFile(s.path(kind, id), data, 0600); err != nil {
+		log.Printf("Warning: Could not write offline snapshot: %v", err)
+	}
+}
+
+// load reads the synced copy of one object
+func (s *Snapshot) load(kind, id string) (*snapshotEntry, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return readSnapshotEntry(s.path(kind, id))
+}
+
+// path maps an object to its snapshot file
+func (s *Snapshot) path(kind, id string) string {
+	sum := sha256.Sum256([]byte(id))
+	return filepath.Join(s.dir, kind, hex.EncodeToString(sum[:16])+".json")
+}
+
+func readSnapshotEntry(file string) (*snapshotEntry, bool) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, false
+	}
+	var entry snapshotEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, false
+	}
+	return &entry, true
+}
+
+// isFull reports whether a get returns the complete object, so it is worth syncing
+func isFull(opts GetOptions) bool {
+	return (opts.Format == "" || opts.Format == "full") && opts.Fields == ""
+}
+
+// syncedResponse marks a locally served response with its sync time
+func syncedResponse(syncedAt time.Time) googleapi.ServerResponse {
+	header := http.Header{}
+	header.Set(SyncedAtHeader, syncedAt.UTC().Format(time.RFC3339))
+	return googleapi.ServerResponse{HTTPStatusCode: http.StatusOK, Header: header}
+}
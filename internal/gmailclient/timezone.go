@@ -0,0 +1,32 @@
+package gmailclient
+
+import (
+	"regexp"
+	"strconv"
+	"time"
+
+	"auto-gmail/internal/config"
+)
+
+// queryDatePattern matches dated search operators such as after:2026/03/05 or
+// before:2026-03-05; older: and newer: are Gmail's synonyms for before: and after:
+var queryDatePattern = regexp.MustCompile(`(?i)\b(after|before|older|newer):(\d{4})[/-](\d{1,2})[/-](\d{1,2})\b`)
+
+// ZonedQuery rewrites the dates of after:/before: operators as the Unix time of that
+// midnight in the user's time zone. Gmail reads YYYY/MM/DD as midnight Pacific time,
+// so "after:2026/03/05" would otherwise include or miss mail from the hours around
+// midnight for everyone else.
+func ZonedQuery(query string) string {
+	location := config.TimeZone()
+	return queryDatePattern.ReplaceAllStringFunc(query, func(term string) string {
+		match := queryDatePattern.FindStringSubmatch(term)
+		year, _ := strconv.Atoi(match[2])
+		month, _ := strconv.Atoi(match[3])
+		day, _ := strconv.Atoi(match[4])
+		if month < 1 || month > 12 || day < 1 || day > 31 {
+			return term
+		}
+		midnight := time.Date(year, time.Month(month), day, 0, 0, 0, 0, location)
+		return match[1] + ":" + strconv.FormatInt(midnight.Unix(), 10)
+	})
+}
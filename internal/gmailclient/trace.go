@@ -0,0 +1,55 @@
+package gmailclient
+
+import (
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"auto-gmail/internal/requestid"
+	"auto-gmail/internal/usage"
+)
+
+// tracingTransport logs Gmail API calls under the request ID of the tool call that
+// made them
+type tracingTransport struct {
+	next http.RoundTripper
+	// all logs every call; otherwise only failed ones are logged
+	all bool
+}
+
+// TraceHTTPClient wraps an authorized HTTP client so Gmail API calls that fail are
+// logged with the request ID of their tool call, and with GMAIL_MCP_TRACE_API=1
+// every call is
+func TraceHTTPClient(client *http.Client) *http.Client {
+	next := client.Transport
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	traced := *client
+	traced.Transport = &tracingTransport{next: next, all: os.Getenv("GMAIL_MCP_TRACE_API") == "1"}
+	return &traced
+}
+
+func (t *tracingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	id := requestid.FromContext(req.Context())
+	if id == "" {
+		// Background work such as the outbox and syncing isn't part of a tool call
+		id = "background"
+	}
+	// Count the request and its quota units against the tool call for session_stats
+	usage.AddGmailRequest(req.Context(), req.Method, req.URL.Path)
+	started := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	elapsed := time.Since(started).Round(time.Millisecond)
+
+	switch {
+	case err != nil:
+		log.Printf("[%s] Gmail API %s %s failed after %s: %v", id, req.Method, req.URL.Path, elapsed, err)
+	case resp.StatusCode >= 400:
+		log.Printf("[%s] Gmail API %s %s returned %d after %s", id, req.Method, req.URL.Path, resp.StatusCode, elapsed)
+	case t.all:
+		log.Printf("[%s] Gmail API %s %s returned %d in %s", id, req.Method, req.URL.Path, resp.StatusCode, elapsed)
+	}
+	return resp, err
+}
@@ -0,0 +1,372 @@
+// Package hooks runs operator policy around every tool call: audit logging, rate
+// limiting, PII redaction of results and latency metrics, configured in code or
+// from a JSON file.
+package hooks
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"auto-gmail/internal/config"
+	"auto-gmail/internal/redact"
+	"auto-gmail/internal/requestid"
+	"auto-gmail/internal/toolerr"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// Call describes one tool invocation
+type Call struct {
+	// RequestID identifies the call in results and logs; see package requestid
+	RequestID string
+	Tool      string
+	Principal string
+	Arguments map[string]interface{}
+	Started   time.Time
+}
+
+// Before runs ahead of a tool. A non-nil result is returned instead of running the
+// tool, e.g. when a rate limit is exceeded.
+type Before func(ctx context.Context, call *Call) *mcp.CallToolResult
+
+// After runs once a tool has returned and may replace its result
+type After func(ctx context.Context, call *Call, result *mcp.CallToolResult, err error, elapsed time.Duration) *mcp.CallToolResult
+
+// Hooks is the ordered set of hooks run around every tool call
+type Hooks struct {
+	principal func(context.Context) string
+	before    []Before
+	after     []After
+	metrics   *metrics
+}
+
+// New creates an empty set of hooks; principal names the caller of a request
+// (e.g. their Gmail address in multi-user mode) and may be nil
+func New(principal func(context.Context) string) *Hooks {
+	return &Hooks{principal: principal}
+}
+
+// AddBefore adds a hook that runs before each tool, after those already added
+func (h *Hooks) AddBefore(before Before) {
+	h.before = append(h.before, before)
+}
+
+// AddAfter adds a hook that runs after each tool, after those already added
+func (h *Hooks) AddAfter(after After) {
+	h.after = append(h.after, after)
+}
+
+// Empty reports whether no hooks are configured
+func (h *Hooks) Empty() bool {
+	return h == nil || len(h.before) == 0 && len(h.after) == 0
+}
+
+// Middleware runs the hooks around every tool handler; pass it to
+// server.WithToolHandlerMiddleware
+func (h *Hooks) Middleware() server.ToolHandlerMiddleware {
+	return func(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+		return func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			call := &Call{RequestID: requestid.FromContext(ctx), Tool: req.Params.Name, Arguments: req.GetArguments(), Started: time.Now()}
+			if h.principal != nil {
+				call.Principal = h.principal(ctx)
+			}
+			if call.Principal == "" {
+				call.Principal = "local"
+			}
+
+			var result *mcp.CallToolResult
+			var err error
+			for _, before := range h.before {
+				if result = before(ctx, call); result != nil {
+					break
+				}
+			}
+			if result == nil {
+				result, err = next(ctx, req)
+			}
+
+			elapsed := time.Since(call.Started)
+			for _, after := range h.after {
+				result = after(ctx, call, result, err, elapsed)
+			}
+			return result, err
+		}
+	}
+}
+
+// Config is the hooks file (hooks.json in the app data directory, or GMAIL_MCP_HOOKS_FILE)
+type Config struct {
+	// AuditLog is a JSON-lines file recording every call; relative to the app data directory
+	AuditLog string `json:"audit_log,omitempty"`
+	// RateLimit caps calls per caller per minute, overall and per tool
+	RateLimit *struct {
+		PerMinute int            `json:"per_minute,omitempty"`
+		Tools     map[string]int `json:"tools,omitempty"`
+	} `json:"rate_limit,omitempty"`
+	// Redact strips personal data from tool results with the GMAIL_MCP_REDACT rules
+	Redact bool `json:"redact,omitempty"`
+	// Metrics records call counts and latency per tool
+	Metrics bool `json:"metrics,omitempty"`
+	// SlowCallMs logs calls slower than this when metrics are on (default 5000)
+	SlowCallMs int `json:"slow_call_ms,omitempty"`
+}
+
+// FromEnv loads the hooks file named by GMAIL_MCP_HOOKS_FILE, or hooks.json in the
+// app data directory when it exists. It returns nil hooks when there is no file.
+func FromEnv(principal func(context.Context) string) (*Hooks, error) {
+	path := os.Getenv("GMAIL_MCP_HOOKS_FILE")
+	if path == "" {
+		path = config.AppFilePath("hooks.json")
+		if _, err := os.Stat(path); err != nil {
+			return nil, nil
+		}
+	}
+	return Load(path, principal)
+}
+
+// Load creates hooks from a hooks file
+func Load(path string, principal func(context.Context) string) (*Hooks, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read hooks file %s: %v", path, err)
+	}
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse hooks file %s: %v", path, err)
+	}
+
+	h := New(principal)
+	if cfg.RateLimit != nil {
+		h.RateLimit(cfg.RateLimit.PerMinute, cfg.RateLimit.Tools)
+	}
+	if cfg.Redact {
+		if err := h.RedactResults(); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.Metrics {
+		h.EnableMetrics(time.Duration(cfg.SlowCallMs) * time.Millisecond)
+	}
+	if cfg.AuditLog != "" {
+		auditPath := cfg.AuditLog
+		if !filepath.IsAbs(auditPath) {
+			auditPath = config.AppFilePath(auditPath)
+		}
+		if err := h.AuditLog(auditPath); err != nil {
+			return nil, err
+		}
+	}
+	log.Printf("🪝 Tool hooks loaded from %s", path)
+	return h, nil
+}
+
+// maxAuditValueChars caps each string argument written to the audit log
+const maxAuditValueChars = 200
+
+// auditEntry is one line of the audit log
+type auditEntry struct {
+	Time      time.Time              `json:"time"`
+	RequestID string                 `json:"requestId,omitempty"`
+	Principal string                 `json:"principal"`
+	Tool      string                 `json:"tool"`
+	Arguments map[string]interface{} `json:"arguments,omitempty"`
+	IsError   bool                   `json:"isError"`
+	Error     string                 `json:"error,omitempty"`
+	ElapsedMs int64                  `json:"elapsedMs"`
+}
+
+// AuditLog appends a JSON line per call to path: who called which tool with which
+// arguments (long strings cut short), whether it failed and how long it took.
+// Calls stopped by an earlier hook, such as the rate limit, are logged too.
+func (h *Hooks) AuditLog(path string) error {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log %s: %v", path, err)
+	}
+
+	var mu sync.Mutex
+	h.AddAfter(func(ctx context.Context, call *Call, result *mcp.CallToolResult, err error, elapsed time.Duration) *mcp.CallToolResult {
+		entry := auditEntry{
+			Time:      call.Started.UTC(),
+			RequestID: call.RequestID,
+			Principal: call.Principal,
+			Tool:      call.Tool,
+			Arguments: map[string]interface{}{},
+			IsError:   err != nil || result != nil && result.IsError,
+			ElapsedMs: elapsed.Milliseconds(),
+		}
+		for name, value := range call.Arguments {
+			if text, ok := value.(string); ok && len(text) > maxAuditValueChars {
+				value = text[:maxAuditValueChars] + "…"
+			}
+			entry.Arguments[name] = value
+		}
+		if err != nil {
+			entry.Error = err.Error()
+		}
+
+		line, _ := json.Marshal(entry)
+		mu.Lock()
+		defer mu.Unlock()
+		if _, err := file.Write(append(line, '\n')); err != nil {
+			log.Printf("Warning: Could not write audit log %s: %v", path, err)
+		}
+		return result
+	})
+	return nil
+}
+
+// RateLimit caps how many tools each caller may call per minute: perMinute across
+// all tools (0 for no overall cap) and perTool for individual tools
+func (h *Hooks) RateLimit(perMinute int, perTool map[string]int) {
+	var mu sync.Mutex
+	recent := map[string][]time.Time{}
+
+	// allow records a call against key unless limit calls were already made in the last minute
+	allow := func(key string, limit int, now time.Time) (bool, time.Duration) {
+		kept := recent[key][:0]
+		for _, t := range recent[key] {
+			if now.Sub(t) < time.Minute {
+				kept = append(kept, t)
+			}
+		}
+		recent[key] = kept
+		if len(kept) >= limit {
+			return false, time.Minute - now.Sub(kept[0])
+		}
+		return true, 0
+	}
+
+	h.AddBefore(func(ctx context.Context, call *Call) *mcp.CallToolResult {
+		mu.Lock()
+		defer mu.Unlock()
+
+		now := time.Now()
+		var keys []string
+		if limit, ok := perTool[call.Tool]; ok && limit > 0 {
+			key := call.Principal + "\x00" + call.Tool
+			if ok, wait := allow(key, limit, now); !ok {
+				return rateLimited(fmt.Sprintf("Rate limit exceeded: at most %d %s calls per minute; retry in %ds", limit, call.Tool, int(wait.Seconds())+1))
+			}
+			keys = append(keys, key)
+		}
+		if perMinute > 0 {
+			if ok, wait := allow(call.Principal, perMinute, now); !ok {
+				return rateLimited(fmt.Sprintf("Rate limit exceeded: at most %d tool calls per minute; retry in %ds", perMinute, int(wait.Seconds())+1))
+			}
+			keys = append(keys, call.Principal)
+		}
+		for _, key := range keys {
+			recent[key] = append(recent[key], now)
+		}
+		return nil
+	})
+}
+
+// rateLimited is the error result of a call over a rate limit
+func rateLimited(message string) *mcp.CallToolResult {
+	return toolerr.New(toolerr.Quota, "rate_limited", message).
+		WithHint("Wait for the time the message gives, then retry.").Result()
+}
+
+// RedactResults strips personal data from the text of every tool result using the
+// GMAIL_MCP_REDACT_PATTERNS and GMAIL_MCP_REDACT_NAMES settings
+func (h *Hooks) RedactResults() error {
+	redactor := redact.FromEnv()
+	if redactor == nil {
+		var err error
+		if redactor, err = redact.New(nil, os.Getenv("GMAIL_MCP_REDACT_NAMES") == "1"); err != nil {
+			return err
+		}
+	}
+
+	h.AddAfter(func(ctx context.Context, call *Call, result *mcp.CallToolResult, err error, elapsed time.Duration) *mcp.CallToolResult {
+		if result == nil {
+			return result
+		}
+		for i, content := range result.Content {
+			switch text := content.(type) {
+			case mcp.TextContent:
+				text.Text, _ = redactor.Redact(text.Text)
+				result.Content[i] = text
+			case *mcp.TextContent:
+				text.Text, _ = redactor.Redact(text.Text)
+			}
+		}
+		return result
+	})
+	return nil
+}
+
+// metrics counts calls, errors and latency per tool
+type metrics struct {
+	mu    sync.Mutex
+	tools map[string]*toolMetrics
+}
+
+// toolMetrics are one tool's counters
+type toolMetrics struct {
+	calls, errors  int
+	totalMs, maxMs int64
+}
+
+// EnableMetrics records call counts, errors and latency per tool (see Stats) and
+// logs calls slower than slow (default 5s)
+func (h *Hooks) EnableMetrics(slow time.Duration) {
+	if slow <= 0 {
+		slow = 5 * time.Second
+	}
+	h.metrics = &metrics{tools: map[string]*toolMetrics{}}
+	m := h.metrics
+
+	h.AddAfter(func(ctx context.Context, call *Call, result *mcp.CallToolResult, err error, elapsed time.Duration) *mcp.CallToolResult {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+
+		stats, ok := m.tools[call.Tool]
+		if !ok {
+			stats = &toolMetrics{}
+			m.tools[call.Tool] = stats
+		}
+		stats.calls++
+		if err != nil || result != nil && result.IsError {
+			stats.errors++
+		}
+		stats.totalMs += elapsed.Milliseconds()
+		stats.maxMs = max(stats.maxMs, elapsed.Milliseconds())
+
+		if elapsed > slow {
+			log.Printf("🐢 Slow tool call: %s took %s (%s)", call.Tool, elapsed.Round(time.Millisecond), call.RequestID)
+		}
+		return result
+	})
+}
+
+// Stats returns the per-tool metrics with their average latency, or nil when
+// metrics aren't enabled
+func (h *Hooks) Stats() map[string]interface{} {
+	if h == nil || h.metrics == nil {
+		return nil
+	}
+	h.metrics.mu.Lock()
+	defer h.metrics.mu.Unlock()
+
+	stats := map[string]interface{}{}
+	for tool, m := range h.metrics.tools {
+		stats[tool] = map[string]interface{}{
+			"calls":   m.calls,
+			"errors":  m.errors,
+			"avgMs":   m.totalMs / int64(m.calls),
+			"maxMs":   m.maxMs,
+			"totalMs": m.totalMs,
+		}
+	}
+	return stats
+}
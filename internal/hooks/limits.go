@@ -0,0 +1,210 @@
+package hooks
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"auto-gmail/internal/requestid"
+	"auto-gmail/internal/toolerr"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// Default call limits, overridable with GMAIL_MCP_MAX_CONCURRENT_CALLS,
+// GMAIL_MCP_TOOL_CONCURRENCY, GMAIL_MCP_TOOL_TIMEOUT and GMAIL_MCP_TOOL_TIMEOUTS
+const (
+	defaultMaxConcurrent = 8
+	defaultToolTimeout   = 2 * time.Minute
+	// queueTimeout is how long a call waits for a free slot before it is refused
+	queueTimeout = 30 * time.Second
+)
+
+// defaultToolConcurrency caps the tools that use the most Gmail quota and memory
+var defaultToolConcurrency = map[string]int{
+	"fetch_email_bodies":             3,
+	"extract_attachment_by_filename": 2,
+	"render_attachment_preview":      2,
+	"collect_receipts":               2,
+}
+
+// defaultToolTimeouts give tools that legitimately take long more time: authenticate
+// waits up to 5 minutes for the user to sign in, a large mail merge creates
+// hundreds of drafts, a backup run saves hundreds of messages and a cleanup plan
+// sizes thousands
+var defaultToolTimeouts = map[string]time.Duration{
+	"authenticate":   6 * time.Minute,
+	"mail_merge":     10 * time.Minute,
+	"backup_mailbox": 10 * time.Minute,
+	"cleanup_plan":   10 * time.Minute,
+}
+
+// Limits bound how much work tool calls can do at once: how many run concurrently,
+// overall and per tool, and how long each may take
+type Limits struct {
+	MaxConcurrent   int
+	ToolConcurrency map[string]int
+	Timeout         time.Duration
+	ToolTimeouts    map[string]time.Duration
+}
+
+// LimitsFromEnv reads the limits from the environment, falling back to the defaults.
+// GMAIL_MCP_TOOL_CONCURRENCY and GMAIL_MCP_TOOL_TIMEOUTS are lists like
+// "fetch_email_bodies=2,render_attachment_preview=1"; timeouts are in seconds.
+func LimitsFromEnv() Limits {
+	limits := Limits{
+		MaxConcurrent:   defaultMaxConcurrent,
+		ToolConcurrency: map[string]int{},
+		Timeout:         defaultToolTimeout,
+		ToolTimeouts:    map[string]time.Duration{},
+	}
+	for tool, limit := range defaultToolConcurrency {
+		limits.ToolConcurrency[tool] = limit
+	}
+	for tool, timeout := range defaultToolTimeouts {
+		limits.ToolTimeouts[tool] = timeout
+	}
+
+	if value := os.Getenv("GMAIL_MCP_MAX_CONCURRENT_CALLS"); value != "" {
+		if n, err := strconv.Atoi(value); err == nil && n > 0 {
+			limits.MaxConcurrent = n
+		} else {
+			log.Printf("Warning: Invalid GMAIL_MCP_MAX_CONCURRENT_CALLS %q, using %d", value, limits.MaxConcurrent)
+		}
+	}
+	if value := os.Getenv("GMAIL_MCP_TOOL_TIMEOUT"); value != "" {
+		if n, err := strconv.Atoi(value); err == nil && n > 0 {
+			limits.Timeout = time.Duration(n) * time.Second
+		} else {
+			log.Printf("Warning: Invalid GMAIL_MCP_TOOL_TIMEOUT %q, using %s", value, limits.Timeout)
+		}
+	}
+	for tool, n := range toolSettings("GMAIL_MCP_TOOL_CONCURRENCY") {
+		limits.ToolConcurrency[tool] = n
+	}
+	for tool, n := range toolSettings("GMAIL_MCP_TOOL_TIMEOUTS") {
+		limits.ToolTimeouts[tool] = time.Duration(n) * time.Second
+	}
+	return limits
+}
+
+// toolSettings parses a "tool=n,tool=n" list of positive numbers, skipping bad entries
+func toolSettings(name string) map[string]int {
+	settings := map[string]int{}
+	for _, entry := range strings.Split(os.Getenv(name), ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		tool, value, _ := strings.Cut(entry, "=")
+		n, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil || n <= 0 || strings.TrimSpace(tool) == "" {
+			log.Printf("Warning: Invalid %s entry %q, ignoring it", name, entry)
+			continue
+		}
+		settings[strings.TrimSpace(tool)] = n
+	}
+	return settings
+}
+
+// timeout returns how long a call of tool may run
+func (l Limits) timeout(tool string) time.Duration {
+	if timeout, ok := l.ToolTimeouts[tool]; ok {
+		return timeout
+	}
+	return l.Timeout
+}
+
+// Middleware enforces the limits around every tool handler; pass it to
+// server.WithToolHandlerMiddleware. A call waits up to queueTimeout for a free slot
+// and is then refused. A call that runs past its timeout gets an error result and
+// its context is cancelled; it keeps its slot until the handler actually returns,
+// so a handler that ignores cancellation can't make room for more work.
+func (l Limits) Middleware() server.ToolHandlerMiddleware {
+	global := make(chan struct{}, l.MaxConcurrent)
+	perTool := map[string]chan struct{}{}
+	for tool, limit := range l.ToolConcurrency {
+		perTool[tool] = make(chan struct{}, limit)
+	}
+
+	// acquire takes a slot in each semaphore, or returns why it couldn't
+	acquire := func(ctx context.Context, tool string, semaphores ...chan struct{}) (func(), *mcp.CallToolResult) {
+		wait, cancel := context.WithTimeout(ctx, queueTimeout)
+		defer cancel()
+		var held []chan struct{}
+		release := func() {
+			for _, semaphore := range held {
+				<-semaphore
+			}
+		}
+		for _, semaphore := range semaphores {
+			select {
+			case semaphore <- struct{}{}:
+				held = append(held, semaphore)
+			case <-wait.Done():
+				release()
+				if ctx.Err() != nil {
+					return nil, toolerr.New(toolerr.Internal, "cancelled", "Request cancelled while waiting to run").Result()
+				}
+				return nil, toolerr.New(toolerr.Quota, "server_busy", fmt.Sprintf("Server busy: %s waited %s for one of %d slots", tool, queueTimeout, cap(semaphore))).
+					WithHint("Retry shortly, with fewer calls at once.").Result()
+			}
+		}
+		return release, nil
+	}
+
+	return func(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+		return func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			tool := req.Params.Name
+			semaphores := []chan struct{}{global}
+			if semaphore, ok := perTool[tool]; ok {
+				// The tool's own slot first, so waiting calls of one tool don't hold global slots
+				semaphores = []chan struct{}{semaphore, global}
+			}
+			release, busy := acquire(ctx, tool, semaphores...)
+			if busy != nil {
+				return busy, nil
+			}
+
+			timeout := l.timeout(tool)
+			ctx, cancel := context.WithTimeout(ctx, timeout)
+			type outcome struct {
+				result *mcp.CallToolResult
+				err    error
+			}
+			done := make(chan outcome, 1)
+			go func() {
+				defer release()
+				defer cancel()
+				// Recover here: panics in this goroutine don't reach the server's recovery
+				defer func() {
+					if r := recover(); r != nil {
+						log.Printf("Tool %s panicked (%s): %v", tool, requestid.FromContext(ctx), r)
+						done <- outcome{result: toolerr.New(toolerr.Internal, "tool_panicked", fmt.Sprintf("Tool %s failed unexpectedly: %v", tool, r)).Result()}
+					}
+				}()
+				result, err := next(ctx, req)
+				done <- outcome{result, err}
+			}()
+
+			select {
+			case out := <-done:
+				return out.result, out.err
+			case <-ctx.Done():
+				if ctx.Err() == context.DeadlineExceeded {
+					log.Printf("⏱️  Tool call %s timed out after %s (%s)", tool, timeout, requestid.FromContext(ctx))
+					timedOut := toolerr.New(toolerr.Unavailable, "timeout", fmt.Sprintf("%s timed out after %s", tool, timeout)).
+						WithHint("Narrow the request (fewer threads, a smaller date range) and try again.")
+					// Retrying the same request would most likely time out again
+					timedOut.Retryable = false
+					return timedOut.Result(), nil
+				}
+				return toolerr.New(toolerr.Internal, "cancelled", "Request cancelled").Result(), nil
+			}
+		}
+	}
+}
@@ -0,0 +1,249 @@
+package i18n
+
+// builtin holds the translations shipped with the server, keyed by locale. Tool,
+// parameter and field names, search operators and other text a model or program
+// must match stay in English inside the translations.
+var builtin = map[string]map[string]string{
+	"de": {
+		"report.this_period":        "Dieser Zeitraum",
+		"report.previous_period":    "Vorheriger Zeitraum",
+		"report.this_week":          "Diese Woche",
+		"report.previous_week":      "Vorwoche",
+		"report.title":              "# E-Mail-Aktivität: %s bis %s",
+		"report.tab_only":           "Nur Threads, die auf dem Tab %s eingegangen sind.",
+		"report.volume":             "Volumen",
+		"report.change":             "Veränderung",
+		"report.received":           "Empfangen",
+		"report.sent":               "Gesendet",
+		"report.median_reply":       "Mittlere Antwortzeit",
+		"report.by_tab":             "Empfangen nach Tab",
+		"report.tab":                "Tab",
+		"report.top_correspondents": "Häufigste Kontakte",
+		"report.no_correspondents":  "Keine E-Mails ausgetauscht.",
+		"report.correspondent":      "%s: %d empfangen, %d gesendet",
+		"report.unanswered":         "Unbeantwortete Threads",
+		"report.no_unanswered":      "Keine Nachricht einer Person wartet auf eine Antwort.",
+		"report.waiting":            "**%s** von %s, wartet seit %d Tag(en) (Thread %s)",
+		"report.attachments":        "Bemerkenswerte Anhänge",
+		"report.no_attachments":     "Keine Anhänge.",
+		"report.attachment":         "%s (%s) von %s: „%s“",
+		"report.new":                "neu",
+		"report.n_a":                "k. A.",
+		"report.faster":             "schneller",
+		"report.slower":             "langsamer",
+		"report.same":               "unverändert",
+		"report.subject":            "E-Mail-Aktivitätsbericht: %s bis %s",
+		"digest.daily_subject":      "Tägliche E-Mail-Übersicht: %s",
+		"digest.follow_ups_subject": "Nachfassen: %d Thread(s) warten auf eine Antwort (%s)",
+		"digest.follow_ups_title":   "# Warten auf Antwort",
+		"digest.no_follow_ups":      "Nichts, was Sie in den letzten %d Tagen gesendet haben, wartet auf eine Antwort.",
+		"digest.follow_up":          "**%s** an %s, seit %d Tag(en) keine Antwort (Thread %s)",
+
+		"ooo.until": "%s ist anscheinend bis %s abwesend (automatische Antwort vom %s: %q)",
+		"ooo.away":  "%s ist anscheinend abwesend (automatische Antwort vom %s: %q)",
+
+		"status.title":               "Gmail-MCP-Server-Status",
+		"status.found":               "Vorhanden",
+		"status.not_found":           "Nicht gefunden",
+		"status.authenticated":       "Angemeldet",
+		"status.not_authenticated":   "Nicht angemeldet (mit /authenticate oder dem Tool authenticate anmelden)",
+		"status.app_data_dir":        "App-Datenverzeichnis",
+		"status.token_file":          "Token-Datei",
+		"status.status":              "Status",
+		"status.style_guide_file":    "Stilleitfaden-Datei",
+		"status.commands":            "Verfügbare Befehle",
+		"status.use_generate_tone":   "Mit /generate-email-tone einen persönlichen E-Mail-Stil erstellen",
+		"status.use_authenticate":    "Mit /authenticate Gmail verbinden",
+		"status.use_weekly_report":   "Mit /weekly-report einen Bericht zur E-Mail-Aktivität abrufen",
+		"status.use_tools":           "Tools",
+		"status.use_resources":       "Ressourcen",
+		"status.cache":               "**Cache:** %v/%v Einträge, Trefferquote %.0f%% (%v Treffer, %v erneut geprüft, %v Fehlschläge)",
+		"prompt.generate-email-tone": "Persönlichen E-Mail-Stil anhand deiner gesendeten E-Mails erstellen",
+		"prompt.authenticate":        "Den Server mit deinem Gmail-Konto verbinden (startet die Google-Anmeldung)",
+		"prompt.server-status":       "Status und Dateispeicherorte des Gmail-MCP-Servers anzeigen",
+		"prompt.weekly-report":       "Bericht zur E-Mail-Aktivität der letzten Woche: Volumen, häufigste Kontakte, unbeantwortete Threads, Antwortzeit und bemerkenswerte Anhänge",
+		"prompt.weekly-report.days":  "Wie viele Tage abgedeckt werden (Standard: 7)",
+
+		"tool.authenticate":                                 "Verbindet diesen Server mit dem Gmail-Konto des Benutzers. Gibt eine Google-Anmelde-URL zurück, die der Benutzer öffnet; nach der Anmeldung sind alle anderen Gmail-Tools verfügbar. Aufrufen, wenn ein anderes Tool meldet, dass eine Gmail-Anmeldung nötig ist.",
+		"tool.get_profile":                                  "Zeigt, mit welchem Gmail-Konto dieser Server arbeitet: E-Mail-Adresse, Anzahl der Nachrichten und Threads, die aktuelle History-ID und die vom Benutzer erteilten OAuth-Berechtigungen. Damit das Konto bestätigen, bevor E-Mails bearbeitet werden.",
+		"tool.server_version":                               "Zeigt, welcher Build dieses Servers läuft (Version, Commit, Build-Datum, Go-Version, Plattform) und, falls die Update-Prüfung beim Start aktiviert ist, ob eine neuere Version oder ein Sicherheitsupdate verfügbar ist. Bei Fehlermeldungen mitschicken.",
+		"tool.telemetry_status":                             "Zeigt, ob anonyme Nutzungstelemetrie aktiv ist, was sie erfasst und welche Zähler genau zum Senden gepuffert sind. Telemetrie ist aus, solange der Benutzer nicht GMAIL_MCP_TELEMETRY=1 gesetzt hat.",
+		"tool.fetch_email_bodies":                           "Lädt die vollständigen E-Mail-Texte bestimmter Threads, nachdem sie anhand der Snippets ausgewählt wurden. Mehrere Threads können auf einmal geladen werden. Enthält die Anfrage ein Progress-Token, wird jeder Thread zusätzlich als Fortschrittsmeldung (mit dem Thread in partialResult) gestreamt, sobald er geladen ist. Mit aktivierter OpenPGP-Unterstützung werden verschlüsselte E-Mails mit dem lokalen Schlüssel entschlüsselt und Signaturen geprüft; das Ergebnis steht in 'pgp' nach Nachrichten-ID. messageIds listet jede Nachricht mit Absender, date (laut Date-Header) und internalDate (Eingang bei Gmail), als RFC 3339 in der Zeitzone des Nutzers.",
+		"tool.fetch_email_bodies.thread_ids":                "Kommagetrennte Liste der Thread-IDs, deren vollständiger Inhalt geladen werden soll (z. B. 'id1,id2,id3')",
+		"tool.create_draft":                                 "Erstellt einen Gmail-Entwurf oder aktualisiert einen vorhandenen Entwurf im Thread. Mit thread_id werden die vorhandenen Entwürfe des Threads geprüft: Standardmäßig wird der einzige Entwurf des Threads überschrieben, sodass der Entwurf schrittweise überarbeitet werden kann. Hat der Thread mehrere Entwürfe, mit draft_id einen auswählen oder mit mode create_new einen weiteren anlegen. Ergebnisse listen die existingDrafts des Threads; Aktualisierungen enthalten außerdem einen Unified Diff zum vorherigen Entwurf sowie dessen to, subject und body. Ergebnisse warnen in outOfOffice, wenn automatische Antworten eines Empfängers auf Abwesenheit hinweisen. Wichtig: Vor dem Schreiben einer E-Mail immer die Ressource file://personal-email-style-guide abrufen, um Stil und Vorlieben des Benutzers zu kennen.",
+		"tool.create_draft.to":                              "Empfängeradresse; mehrere durch Kommas trennen. Erforderlich, sofern to_group nicht angegeben ist.",
+		"tool.create_draft.subject":                         "Betreffzeile der E-Mail",
+		"tool.create_draft.body":                            "Inhalt der E-Mail",
+		"tool.create_draft.thread_id":                       "Thread-ID, wenn es sich um eine Antwort handelt (optional). Gibt es für diesen Thread einen Entwurf, wird er aktualisiert statt ein neuer erstellt (siehe mode).",
+		"tool.extract_attachment_by_filename":               "Extrahiert sicher den Text aus E-Mail-Anhängen anhand des Dateinamens (keine Anhang-ID verwenden). Zuerst mit search_threads E-Mails mit Anhängen finden, dann mit diesem Tool den lesbaren Text bestimmter Dateien extrahieren.",
+		"tool.extract_attachment_by_filename.message_id":    "Die Gmail-Nachrichten-ID mit dem Anhang (aus den Ergebnissen von search_threads)",
+		"tool.extract_attachment_by_filename.filename":      "Der Dateiname des zu extrahierenden Anhangs (z. B. 'document.pdf', 'CV.docx')",
+		"tool.extract_attachment_by_filename.force_refresh": "Den Anhang erneut herunterladen und extrahieren, auch wenn eine zwischengespeicherte Extraktion existiert (Standard: false)",
+		"tool.weekly_report":                                "Erstellt einen Bericht zur E-Mail-Aktivität der letzten Woche (oder Tage): empfangene und gesendete Mengen im Vergleich zum Zeitraum davor, häufigste Kontakte, unbeantwortete Threads von Personen, mittlere Antwortzeit und bemerkenswerte Anhänge. Das Feld 'report' ist Markdown, bereit zum Einfügen in ein Dokument. Mit email_to_self wird er auch an die eigene Adresse des Benutzers gesendet; ist Gmail nicht erreichbar, wird das Senden eingereiht und wiederholt (siehe outbox_status).",
+		"tool.weekly_report.days":                           "Wie viele Tage abgedeckt werden (Standard: 7, max.: 90)",
+		"tool.weekly_report.email_to_self":                  "Den Bericht auch an die eigene Adresse des Benutzers senden (Standard: false). Er wird nie an andere gesendet.",
+		"tool.weekly_report.category":                       "Nur Threads berücksichtigen, die auf diesem Posteingangs-Tab eingegangen sind, z. B. primary, um Newsletter und Benachrichtigungen auszulassen",
+	},
+
+	"fr": {
+		"report.this_period":        "Cette période",
+		"report.previous_period":    "Période précédente",
+		"report.this_week":          "Cette semaine",
+		"report.previous_week":      "Semaine précédente",
+		"report.title":              "# Activité e-mail : du %s au %s",
+		"report.tab_only":           "Uniquement les fils reçus dans l'onglet %s.",
+		"report.volume":             "Volume",
+		"report.change":             "Évolution",
+		"report.received":           "Reçus",
+		"report.sent":               "Envoyés",
+		"report.median_reply":       "Délai de réponse médian",
+		"report.by_tab":             "Reçus par onglet",
+		"report.tab":                "Onglet",
+		"report.top_correspondents": "Principaux correspondants",
+		"report.no_correspondents":  "Aucun e-mail échangé.",
+		"report.correspondent":      "%s : %d reçus, %d envoyés",
+		"report.unanswered":         "Fils sans réponse",
+		"report.no_unanswered":      "Aucun message d'une personne n'attend de réponse.",
+		"report.waiting":            "**%s** de %s, en attente depuis %d jour(s) (fil %s)",
+		"report.attachments":        "Pièces jointes notables",
+		"report.no_attachments":     "Aucune pièce jointe.",
+		"report.attachment":         "%s (%s) de %s : « %s »",
+		"report.new":                "nouveau",
+		"report.n_a":                "n.d.",
+		"report.faster":             "plus rapide",
+		"report.slower":             "plus lent",
+		"report.same":               "identique",
+		"report.subject":            "Rapport d'activité e-mail : du %s au %s",
+		"digest.daily_subject":      "Résumé quotidien des e-mails : %s",
+		"digest.follow_ups_subject": "Relances : %d fil(s) en attente de réponse (%s)",
+		"digest.follow_ups_title":   "# En attente de réponse",
+		"digest.no_follow_ups":      "Aucun message envoyé ces %d derniers jours n'attend de réponse.",
+		"digest.follow_up":          "**%s** à %s, sans réponse depuis %d jour(s) (fil %s)",
+
+		"ooo.until": "%s semble absent(e) jusqu'au %s (réponse automatique du %s : %q)",
+		"ooo.away":  "%s semble absent(e) (réponse automatique du %s : %q)",
+
+		"status.title":               "État du serveur Gmail MCP",
+		"status.found":               "Trouvé",
+		"status.not_found":           "Introuvable",
+		"status.authenticated":       "Connecté",
+		"status.not_authenticated":   "Non connecté (utilisez /authenticate ou l'outil authenticate)",
+		"status.app_data_dir":        "Répertoire des données",
+		"status.token_file":          "Fichier de jeton",
+		"status.status":              "État",
+		"status.style_guide_file":    "Fichier du guide de style",
+		"status.commands":            "Commandes disponibles",
+		"status.use_generate_tone":   "Utilisez /generate-email-tone pour créer votre style d'écriture personnalisé",
+		"status.use_authenticate":    "Utilisez /authenticate pour connecter Gmail",
+		"status.use_weekly_report":   "Utilisez /weekly-report pour un rapport d'activité e-mail",
+		"status.use_tools":           "Outils",
+		"status.use_resources":       "Ressources",
+		"status.cache":               "**Cache :** %v/%v entrées, taux de réussite %.0f%% (%v réussites, %v revalidés, %v échecs)",
+		"prompt.generate-email-tone": "Créer votre style d'écriture personnalisé en analysant vos e-mails envoyés",
+		"prompt.authenticate":        "Connecter le serveur à votre compte Gmail (lance la connexion Google)",
+		"prompt.server-status":       "Afficher l'état du serveur Gmail MCP et l'emplacement de ses fichiers",
+		"prompt.weekly-report":       "Rapport d'activité e-mail de la semaine passée : volumes, principaux correspondants, fils sans réponse, délai de réponse et pièces jointes notables",
+		"prompt.weekly-report.days":  "Nombre de jours couverts (par défaut : 7)",
+
+		"tool.authenticate":                                 "Connecte ce serveur au compte Gmail de l'utilisateur. Renvoie une URL de connexion Google que l'utilisateur doit ouvrir ; une fois connecté, tous les autres outils Gmail deviennent disponibles. À appeler quand un autre outil signale qu'une authentification Gmail est requise.",
+		"tool.get_profile":                                  "Indique le compte Gmail utilisé par ce serveur : adresse e-mail, nombre total de messages et de fils, History ID actuel et autorisations OAuth accordées par l'utilisateur. À utiliser pour confirmer le compte avant d'agir sur les e-mails.",
+		"tool.server_version":                               "Indique quelle version de ce serveur est exécutée (version, commit, date de build, version de Go, plateforme) et, si la vérification au démarrage est activée, si une version plus récente ou un correctif de sécurité est disponible. À joindre lors du signalement d'un problème.",
+		"tool.telemetry_status":                             "Indique si la télémétrie d'utilisation anonyme est active, ce qu'elle collecte et exactement quels compteurs sont en attente d'envoi. La télémétrie est désactivée tant que l'utilisateur n'a pas défini GMAIL_MCP_TELEMETRY=1.",
+		"tool.fetch_email_bodies":                           "Récupère le contenu complet des e-mails de fils précis après les avoir parcourus via leurs extraits. Plusieurs fils peuvent être récupérés en une fois. Si la requête inclut un jeton de progression, chaque fil est aussi transmis en notification de progression (avec le fil dans partialResult) dès qu'il est chargé. Avec la prise en charge d'OpenPGP, les e-mails chiffrés sont déchiffrés avec la clé locale et les signatures vérifiées ; le résultat figure dans 'pgp' par ID de message. messageIds liste chaque message avec son expéditeur, date (d'après l'en-tête Date) et internalDate (réception par Gmail), en RFC 3339 dans le fuseau horaire de l'utilisateur.",
+		"tool.fetch_email_bodies.thread_ids":                "Liste d'ID de fils séparés par des virgules dont le contenu complet doit être récupéré (p. ex. 'id1,id2,id3')",
+		"tool.create_draft":                                 "Crée un brouillon Gmail ou met à jour un brouillon existant du fil. Avec thread_id, les brouillons existants du fil sont vérifiés : par défaut, le seul brouillon du fil est remplacé, ce qui permet de retravailler le brouillon par itérations. Si le fil a plusieurs brouillons, passez draft_id pour en choisir un ou mode create_new pour en ajouter un. Les résultats listent les existingDrafts du fil ; les mises à jour renvoient aussi un diff unifié avec le brouillon précédent et ses to, subject et body précédents. Les résultats avertissent dans outOfOffice quand les réponses automatiques récentes d'un destinataire indiquent une absence. Important : avant d'écrire un e-mail, demandez toujours la ressource file://personal-email-style-guide pour connaître le style et les préférences de l'utilisateur.",
+		"tool.create_draft.to":                              "Adresse du destinataire ; séparez-en plusieurs par des virgules. Obligatoire sauf si to_group est indiqué.",
+		"tool.create_draft.subject":                         "Objet de l'e-mail",
+		"tool.create_draft.body":                            "Contenu de l'e-mail",
+		"tool.create_draft.thread_id":                       "ID du fil s'il s'agit d'une réponse (facultatif). Si un brouillon existe pour ce fil, il est mis à jour au lieu d'en créer un nouveau (voir mode).",
+		"tool.extract_attachment_by_filename":               "Extrait en toute sécurité le texte des pièces jointes d'un e-mail à partir du nom de fichier (n'utilisez pas l'ID de pièce jointe). Utilisez d'abord search_threads pour trouver des e-mails avec pièces jointes, puis cet outil pour extraire le texte lisible de fichiers précis.",
+		"tool.extract_attachment_by_filename.message_id":    "L'ID du message Gmail contenant la pièce jointe (issu des résultats de search_threads)",
+		"tool.extract_attachment_by_filename.filename":      "Le nom de fichier de la pièce jointe à extraire (p. ex. 'document.pdf', 'CV.docx')",
+		"tool.extract_attachment_by_filename.force_refresh": "Retélécharger et réextraire la pièce jointe même si une extraction en cache existe (par défaut : false)",
+		"tool.weekly_report":                                "Génère un rapport d'activité e-mail pour la semaine passée (ou un nombre de jours) : volumes reçus et envoyés comparés à la période précédente, principaux correspondants, fils de personnes sans réponse, délai de réponse médian et pièces jointes notables. Le champ 'report' est du Markdown prêt à coller dans un document. Avec email_to_self, il est aussi envoyé à l'adresse de l'utilisateur ; si Gmail est indisponible, l'envoi est mis en file d'attente et réessayé (voir outbox_status).",
+		"tool.weekly_report.days":                           "Nombre de jours couverts (par défaut : 7, max. : 90)",
+		"tool.weekly_report.email_to_self":                  "Envoyer aussi le rapport à l'adresse de l'utilisateur (par défaut : false). Il n'est jamais envoyé à quelqu'un d'autre.",
+		"tool.weekly_report.category":                       "Ne couvrir que les fils reçus dans cet onglet de la boîte de réception, p. ex. primary pour exclure newsletters et notifications",
+	},
+
+	"es": {
+		"report.this_period":        "Este periodo",
+		"report.previous_period":    "Periodo anterior",
+		"report.this_week":          "Esta semana",
+		"report.previous_week":      "Semana anterior",
+		"report.title":              "# Actividad de correo: del %s al %s",
+		"report.tab_only":           "Solo conversaciones recibidas en la pestaña %s.",
+		"report.volume":             "Volumen",
+		"report.change":             "Cambio",
+		"report.received":           "Recibidos",
+		"report.sent":               "Enviados",
+		"report.median_reply":       "Mediana del tiempo de respuesta",
+		"report.by_tab":             "Recibidos por pestaña",
+		"report.tab":                "Pestaña",
+		"report.top_correspondents": "Contactos principales",
+		"report.no_correspondents":  "No se intercambiaron correos.",
+		"report.correspondent":      "%s: %d recibidos, %d enviados",
+		"report.unanswered":         "Conversaciones sin respuesta",
+		"report.no_unanswered":      "Ningún mensaje de una persona espera respuesta.",
+		"report.waiting":            "**%s** de %s, esperando desde hace %d día(s) (conversación %s)",
+		"report.attachments":        "Adjuntos destacados",
+		"report.no_attachments":     "Sin adjuntos.",
+		"report.attachment":         "%s (%s) de %s: «%s»",
+		"report.new":                "nuevo",
+		"report.n_a":                "n/d",
+		"report.faster":             "más rápido",
+		"report.slower":             "más lento",
+		"report.same":               "igual",
+		"report.subject":            "Informe de actividad de correo: del %s al %s",
+		"digest.daily_subject":      "Resumen diario de correo: %s",
+		"digest.follow_ups_subject": "Seguimientos: %d conversación(es) esperando respuesta (%s)",
+		"digest.follow_ups_title":   "# Esperando respuesta",
+		"digest.no_follow_ups":      "Nada de lo que enviaste en los últimos %d días está esperando respuesta.",
+		"digest.follow_up":          "**%s** a %s, sin respuesta desde hace %d día(s) (conversación %s)",
+
+		"ooo.until": "%s parece estar fuera de la oficina hasta el %s (respuesta automática del %s: %q)",
+		"ooo.away":  "%s parece estar fuera de la oficina (respuesta automática del %s: %q)",
+
+		"status.title":               "Estado del servidor Gmail MCP",
+		"status.found":               "Encontrado",
+		"status.not_found":           "No encontrado",
+		"status.authenticated":       "Autenticado",
+		"status.not_authenticated":   "Sin autenticar (usa /authenticate o la herramienta authenticate)",
+		"status.app_data_dir":        "Directorio de datos",
+		"status.token_file":          "Archivo del token",
+		"status.status":              "Estado",
+		"status.style_guide_file":    "Archivo de la guía de estilo",
+		"status.commands":            "Comandos disponibles",
+		"status.use_generate_tone":   "Usa /generate-email-tone para crear tu estilo de correo personalizado",
+		"status.use_authenticate":    "Usa /authenticate para conectar Gmail",
+		"status.use_weekly_report":   "Usa /weekly-report para un informe de actividad de correo",
+		"status.use_tools":           "Herramientas",
+		"status.use_resources":       "Recursos",
+		"status.cache":               "**Caché:** %v/%v entradas, tasa de aciertos %.0f%% (%v aciertos, %v revalidados, %v fallos)",
+		"prompt.generate-email-tone": "Crear tu estilo de correo personalizado analizando tus correos enviados",
+		"prompt.authenticate":        "Conectar el servidor a tu cuenta de Gmail (inicia el acceso con Google)",
+		"prompt.server-status":       "Mostrar el estado del servidor Gmail MCP y la ubicación de sus archivos",
+		"prompt.weekly-report":       "Informe de actividad de correo de la última semana: volúmenes, contactos principales, conversaciones sin respuesta, tiempo de respuesta y adjuntos destacados",
+		"prompt.weekly-report.days":  "Cuántos días cubrir (predeterminado: 7)",
+
+		"tool.authenticate":                                 "Conecta este servidor con la cuenta de Gmail del usuario. Devuelve una URL de acceso de Google que el usuario debe abrir; al terminar, el resto de herramientas de Gmail quedan disponibles. Llámala cuando otra herramienta indique que se requiere autenticación de Gmail.",
+		"tool.get_profile":                                  "Muestra con qué cuenta de Gmail trabaja este servidor: dirección de correo, total de mensajes y conversaciones, el History ID actual y los permisos OAuth concedidos por el usuario. Úsala para confirmar la cuenta antes de actuar sobre el correo.",
+		"tool.server_version":                               "Muestra qué compilación de este servidor se está ejecutando (versión, commit, fecha de compilación, versión de Go, plataforma) y, si la comprobación al inicio está activada, si hay una versión más reciente o una corrección de seguridad. Inclúyela al informar de un problema.",
+		"tool.telemetry_status":                             "Muestra si la telemetría de uso anónima está activada, qué recopila y exactamente qué contadores están pendientes de enviar. La telemetría está desactivada salvo que el usuario haya definido GMAIL_MCP_TELEMETRY=1.",
+		"tool.fetch_email_bodies":                           "Obtiene el contenido completo de los correos de conversaciones concretas tras revisarlas con sus fragmentos. Puede obtener varias a la vez. Si la solicitud incluye un token de progreso, cada conversación se envía además como notificación de progreso (con la conversación en partialResult) en cuanto se carga. Con la compatibilidad con OpenPGP activada, el correo cifrado se descifra con la clave local y se comprueban las firmas; el resultado está en 'pgp' por ID de mensaje. messageIds enumera cada mensaje con su remitente, date (según la cabecera Date) e internalDate (recepción en Gmail), en RFC 3339 en la zona horaria del usuario.",
+		"tool.fetch_email_bodies.thread_ids":                "Lista de ID de conversaciones separados por comas cuyo contenido completo se quiere obtener (p. ej. 'id1,id2,id3')",
+		"tool.create_draft":                                 "Crea un borrador de Gmail o actualiza un borrador existente de la conversación. Con thread_id se comprueban los borradores existentes de la conversación: por defecto se sobrescribe su único borrador, lo que permite ir modificando el borrador. Si la conversación tiene varios, pasa draft_id para elegir uno o mode create_new para añadir otro. Los resultados listan los existingDrafts de la conversación; las actualizaciones también devuelven un diff unificado con el borrador anterior y sus to, subject y body anteriores. Los resultados avisan en outOfOffice cuando las respuestas automáticas recientes de un destinatario indican que está ausente. Importante: antes de escribir un correo, solicita siempre el recurso file://personal-email-style-guide para conocer el estilo y las preferencias del usuario.",
+		"tool.create_draft.to":                              "Dirección del destinatario; separa varias con comas. Obligatoria salvo que se indique to_group.",
+		"tool.create_draft.subject":                         "Asunto del correo",
+		"tool.create_draft.body":                            "Contenido del correo",
+		"tool.create_draft.thread_id":                       "ID de la conversación si es una respuesta (opcional). Si ya hay un borrador para esta conversación, se actualiza en lugar de crear uno nuevo (ver mode).",
+		"tool.extract_attachment_by_filename":               "Extrae de forma segura el texto de los adjuntos de un correo por nombre de archivo (no uses el ID del adjunto). Usa primero search_threads para encontrar correos con adjuntos y luego esta herramienta para extraer el texto legible de archivos concretos.",
+		"tool.extract_attachment_by_filename.message_id":    "El ID del mensaje de Gmail que contiene el adjunto (de los resultados de search_threads)",
+		"tool.extract_attachment_by_filename.filename":      "El nombre de archivo del adjunto que se extraerá (p. ej. 'document.pdf', 'CV.docx')",
+		"tool.extract_attachment_by_filename.force_refresh": "Volver a descargar y extraer el adjunto aunque haya una extracción en caché (predeterminado: false)",
+		"tool.weekly_report":                                "Genera un informe de actividad de correo de la última semana (o de varios días): volúmenes recibidos y enviados frente al periodo anterior, contactos principales, conversaciones de personas sin respuesta, mediana del tiempo de respuesta y adjuntos destacados. El campo 'report' es Markdown listo para pegar en un documento. Con email_to_self también se envía a la dirección del propio usuario; si Gmail no está disponible, el envío se pone en cola y se reintenta (ver outbox_status).",
+		"tool.weekly_report.days":                           "Cuántos días cubrir (predeterminado: 7, máx.: 90)",
+		"tool.weekly_report.email_to_self":                  "Enviar también el informe a la dirección del propio usuario (predeterminado: false). Nunca se envía a nadie más.",
+		"tool.weekly_report.category":                       "Solo incluir conversaciones recibidas en esta pestaña de la bandeja de entrada, p. ej. primary para excluir boletines y notificaciones",
+	},
+}
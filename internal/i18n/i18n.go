@@ -0,0 +1,148 @@
+// Package i18n translates the server's own text (tool and prompt descriptions, the
+// status prompt and activity reports) and formats dates for the locale set with
+// GMAIL_MCP_LOCALE. English text stays next to the code that uses it; catalogs
+// only hold translations, so a missing one falls back to English. Mail content is
+// never translated here.
+//
+// Built-in catalogs cover German (de), French (fr) and Spanish (es). A JSON file
+// of key/translation pairs at locales/<locale>.json in the app data directory
+// adds translations or overrides built-in ones, for these or any other locale.
+package i18n
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"auto-gmail/internal/config"
+)
+
+var (
+	loadOnce sync.Once
+	locale   = "en"
+	catalog  = map[string]string{}
+)
+
+// load reads GMAIL_MCP_LOCALE and builds the catalog for it: the language's
+// built-in catalog, then the region's (e.g. fr-CA), then the user's file
+func load() {
+	loadOnce.Do(func() {
+		value := strings.TrimSpace(os.Getenv("GMAIL_MCP_LOCALE"))
+		if value == "" {
+			return
+		}
+		// Accept POSIX-style names like de_DE.UTF-8 as well as de-DE
+		value, _, _ = strings.Cut(value, ".")
+		value = strings.ReplaceAll(value, "_", "-")
+		language, region, _ := strings.Cut(strings.ToLower(value), "-")
+		locale = language
+		if region != "" {
+			locale = language + "-" + strings.ToUpper(region)
+		}
+
+		for key, text := range builtin[language] {
+			catalog[key] = text
+		}
+		for key, text := range builtin[locale] {
+			catalog[key] = text
+		}
+		names := []string{language}
+		if locale != language {
+			names = append(names, locale)
+		}
+		for _, name := range names {
+			path := config.AppFilePath(filepath.Join("locales", name+".json"))
+			data, err := os.ReadFile(path)
+			if err != nil {
+				continue
+			}
+			var overrides map[string]string
+			if err := json.Unmarshal(data, &overrides); err != nil {
+				log.Printf("Warning: Invalid locale file %s: %v", path, err)
+				continue
+			}
+			for key, text := range overrides {
+				catalog[key] = text
+			}
+		}
+		if language != "en" && len(catalog) == 0 {
+			log.Printf("Warning: No translations for locale %q; using English (add %s)", locale, config.AppFilePath(filepath.Join("locales", language+".json")))
+		}
+	})
+}
+
+// Locale returns the configured locale, such as "de" or "fr-CA"; "en" by default
+func Locale() string {
+	load()
+	return locale
+}
+
+// T returns the translation of key, or english when there is none, formatted with
+// args like fmt.Sprintf
+func T(key, english string, args ...interface{}) string {
+	load()
+	text, ok := catalog[key]
+	if !ok {
+		text = english
+	}
+	if len(args) == 0 {
+		return text
+	}
+	return fmt.Sprintf(text, args...)
+}
+
+// Has reports whether key has a translation
+func Has(key string) bool {
+	load()
+	_, ok := catalog[key]
+	return ok
+}
+
+// dateFormat is how one language writes dates
+type dateFormat struct {
+	// date is a layout using Go's reference time, with "January"/"Jan" replaced by
+	// the language's month names
+	date, dateTime string
+	months         [12]string
+}
+
+var englishMonths = [12]string{"January", "February", "March", "April", "May", "June", "July", "August", "September", "October", "November", "December"}
+
+// dateFormats are keyed by language; English is the default
+var dateFormats = map[string]dateFormat{
+	"en": {date: "Jan 2, 2006", dateTime: "Jan 2, 2006 3:04 PM", months: englishMonths},
+	"de": {date: "2. January 2006", dateTime: "2. January 2006, 15:04", months: [12]string{"Januar", "Februar", "März", "April", "Mai", "Juni", "Juli", "August", "September", "Oktober", "November", "Dezember"}},
+	"fr": {date: "2 January 2006", dateTime: "2 January 2006 à 15:04", months: [12]string{"janvier", "février", "mars", "avril", "mai", "juin", "juillet", "août", "septembre", "octobre", "novembre", "décembre"}},
+	"es": {date: "2 de January de 2006", dateTime: "2 de January de 2006, 15:04", months: [12]string{"enero", "febrero", "marzo", "abril", "mayo", "junio", "julio", "agosto", "septiembre", "octubre", "noviembre", "diciembre"}},
+}
+
+// FormatDate writes a date for people in the configured locale, e.g. "Mar 5, 2026"
+// or "5. März 2026". Results meant for programs keep RFC 3339 instead.
+func FormatDate(t time.Time) string {
+	return formatWith(t, func(f dateFormat) string { return f.date })
+}
+
+// FormatDateTime is FormatDate with the time of day
+func FormatDateTime(t time.Time) string {
+	return formatWith(t, func(f dateFormat) string { return f.dateTime })
+}
+
+func formatWith(t time.Time, layout func(dateFormat) string) string {
+	language, _, _ := strings.Cut(Locale(), "-")
+	format, ok := dateFormats[language]
+	if !ok {
+		format = dateFormats["en"]
+	}
+	formatted := t.Format(layout(format))
+	// Go only knows English month names; swap in the language's
+	month := int(t.Month()) - 1
+	if format.months != englishMonths {
+		formatted = strings.Replace(formatted, englishMonths[month], format.months[month], 1)
+	}
+	return formatted
+}
@@ -0,0 +1,152 @@
+// Package llm creates the OpenAI-compatible clients that style guide generation,
+// translation, entity refinement and embeddings use, and is the single place
+// GMAIL_MCP_NO_EXTERNAL_AI is enforced.
+package llm
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"auto-gmail/internal/usage"
+
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/option"
+	"github.com/openai/openai-go/shared"
+)
+
+// defaultBaseURL is OpenAI's API, used unless another endpoint is configured
+const defaultBaseURL = "https://api.openai.com/v1/"
+
+// ErrExternalAIDisabled is returned instead of a client for a third-party endpoint
+// while GMAIL_MCP_NO_EXTERNAL_AI=1
+var ErrExternalAIDisabled = errors.New("sending mail content to external AI providers is disabled (GMAIL_MCP_NO_EXTERNAL_AI=1); set GMAIL_MCP_LLM_BASE_URL to a local OpenAI-compatible endpoint to use this feature")
+
+// NoExternalAI reports whether mail content may only go to local AI endpoints
+func NoExternalAI() bool {
+	return os.Getenv("GMAIL_MCP_NO_EXTERNAL_AI") == "1"
+}
+
+// BaseURL is the OpenAI-compatible endpoint in use: GMAIL_MCP_LLM_BASE_URL, then
+// OPENAI_BASE_URL (which the OpenAI SDK also reads), then OpenAI itself
+func BaseURL() string {
+	for _, name := range []string{"GMAIL_MCP_LLM_BASE_URL", "OPENAI_BASE_URL"} {
+		if value := strings.TrimSpace(os.Getenv(name)); value != "" {
+			return value
+		}
+	}
+	return defaultBaseURL
+}
+
+// IsLocal reports whether baseURL points at this machine or a private network
+// (e.g. Ollama, LM Studio or vLLM), rather than a third-party service
+func IsLocal(baseURL string) bool {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return false
+	}
+	host := strings.ToLower(u.Hostname())
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") || strings.HasSuffix(host, ".local") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && (ip.IsLoopback() || ip.IsPrivate())
+}
+
+// Check returns nil when an LLM can be used: the endpoint is allowed by
+// GMAIL_MCP_NO_EXTERNAL_AI and has credentials (local endpoints need none)
+func Check() error {
+	baseURL := BaseURL()
+	local := IsLocal(baseURL)
+	if NoExternalAI() && !local {
+		return ErrExternalAIDisabled
+	}
+	if !local && os.Getenv("OPENAI_API_KEY") == "" {
+		return fmt.Errorf("OPENAI_API_KEY environment variable not set")
+	}
+	return nil
+}
+
+// NewClient returns a client for the configured endpoint, or an error when
+// Check fails. Every request that carries mail content must use it.
+func NewClient() (openai.Client, error) {
+	if err := Check(); err != nil {
+		return openai.Client{}, err
+	}
+	// The SDK also reads OPENAI_BASE_URL; set the base URL explicitly so the
+	// endpoint that was checked is the one that is called
+	opts := []option.RequestOption{option.WithBaseURL(BaseURL()), option.WithMiddleware(localOnly, countTokens)}
+	if apiKey := os.Getenv("OPENAI_API_KEY"); apiKey != "" {
+		opts = append(opts, option.WithAPIKey(apiKey))
+	} else {
+		opts = append(opts, option.WithAPIKey("local"))
+	}
+	return openai.NewClient(opts...), nil
+}
+
+// localOnly refuses each request to a non-local host while GMAIL_MCP_NO_EXTERNAL_AI=1,
+// so per-request base URL options can't bypass the check in NewClient
+func localOnly(req *http.Request, next option.MiddlewareNext) (*http.Response, error) {
+	if NoExternalAI() && !IsLocal(req.URL.String()) {
+		return nil, ErrExternalAIDisabled
+	}
+	return next(req)
+}
+
+// countTokens records the token usage a response reports against the tool call that
+// made the request, for session_stats
+func countTokens(req *http.Request, next option.MiddlewareNext) (*http.Response, error) {
+	resp, err := next(req)
+	if err != nil || resp.StatusCode != http.StatusOK || !strings.Contains(resp.Header.Get("Content-Type"), "json") {
+		return resp, err
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	var reported struct {
+		Usage struct {
+			PromptTokens     int64 `json:"prompt_tokens"`
+			CompletionTokens int64 `json:"completion_tokens"`
+		} `json:"usage"`
+	}
+	if json.Unmarshal(body, &reported) == nil {
+		usage.AddTokens(req.Context(), reported.Usage.PromptTokens, reported.Usage.CompletionTokens)
+	}
+	return resp, nil
+}
+
+// ChatModel is the chat model to use, GMAIL_MCP_LLM_MODEL or GPT-4o
+func ChatModel() shared.ChatModel {
+	if model := os.Getenv("GMAIL_MCP_LLM_MODEL"); model != "" {
+		return model
+	}
+	return shared.ChatModelGPT4o
+}
+
+// EmbeddingModel is the embedding model to use, GMAIL_MCP_EMBEDDING_MODEL or text-embedding-3-small
+func EmbeddingModel() openai.EmbeddingModel {
+	if model := os.Getenv("GMAIL_MCP_EMBEDDING_MODEL"); model != "" {
+		return model
+	}
+	return openai.EmbeddingModelTextEmbedding3Small
+}
+
+// VisionModel is the model that reads images, GMAIL_MCP_VISION_MODEL or the chat model;
+// with a local endpoint set it to a vision model such as llava
+func VisionModel() shared.ChatModel {
+	if model := os.Getenv("GMAIL_MCP_VISION_MODEL"); model != "" {
+		return model
+	}
+	return ChatModel()
+}
@@ -0,0 +1,100 @@
+package pgp
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"net/mail"
+	"strings"
+)
+
+// Armor markers of inline (non-MIME) OpenPGP content
+const (
+	MessageArmor       = "-----BEGIN PGP MESSAGE-----"
+	messageArmorEnd    = "-----END PGP MESSAGE-----"
+	SignedMessageArmor = "-----BEGIN PGP SIGNED MESSAGE-----"
+	signatureArmorEnd  = "-----END PGP SIGNATURE-----"
+)
+
+// ArmoredBlock returns the first armored block in text that starts with begin, or nil
+func ArmoredBlock(text, begin string) []byte {
+	start := strings.Index(text, begin)
+	if start < 0 {
+		return nil
+	}
+	end := messageArmorEnd
+	if begin == SignedMessageArmor {
+		end = signatureArmorEnd
+	}
+	length := strings.Index(text[start:], end)
+	if length < 0 {
+		return nil
+	}
+	return []byte(text[start : start+length+len(end)])
+}
+
+// SplitSigned splits a raw multipart/signed message (RFC 3156) into the exact bytes
+// that were signed, with CRLF line endings, and the detached signature
+func SplitSigned(raw []byte) (signed, signature []byte, err error) {
+	raw = bytes.ReplaceAll(raw, []byte("\r\n"), []byte("\n"))
+	message, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return nil, nil, err
+	}
+	mediaType, params, err := mime.ParseMediaType(message.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/signed" || params["boundary"] == "" {
+		return nil, nil, fmt.Errorf("not a multipart/signed message")
+	}
+	body, err := io.ReadAll(message.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// The preamble, the signed part, the signature part and the closing delimiter
+	parts := bytes.Split(append([]byte("\n"), body...), []byte("\n--"+params["boundary"]))
+	if len(parts) < 4 {
+		return nil, nil, fmt.Errorf("multipart/signed message has %d parts, expected 2", len(parts)-2)
+	}
+	_, signed, _ = bytes.Cut(parts[1], []byte("\n"))
+	_, signaturePart, _ := bytes.Cut(parts[2], []byte("\n"))
+
+	signatureMessage, err := mail.ReadMessage(bytes.NewReader(signaturePart))
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid signature part: %v", err)
+	}
+	signature, err = io.ReadAll(signatureMessage.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+	if strings.EqualFold(strings.TrimSpace(signatureMessage.Header.Get("Content-Transfer-Encoding")), "base64") {
+		if signature, err = base64.StdEncoding.DecodeString(strings.Join(strings.Fields(string(signature)), "")); err != nil {
+			return nil, nil, fmt.Errorf("invalid signature encoding: %v", err)
+		}
+	}
+	return bytes.ReplaceAll(signed, []byte("\n"), []byte("\r\n")), signature, nil
+}
+
+// EncryptedMIME wraps armored ciphertext as a PGP/MIME (RFC 3156) body: the
+// Content-Type header, a blank line and the two parts
+func EncryptedMIME(ciphertext []byte, boundary string) string {
+	return fmt.Sprintf("MIME-Version: 1.0\r\n"+
+		"Content-Type: multipart/encrypted; protocol=\"application/pgp-encrypted\"; boundary=\"%s\"\r\n"+
+		"\r\n"+
+		"This is an OpenPGP/MIME encrypted message (RFC 3156).\r\n"+
+		"--%s\r\n"+
+		"Content-Type: application/pgp-encrypted\r\n"+
+		"Content-Description: PGP/MIME version identification\r\n"+
+		"\r\n"+
+		"Version: 1\r\n"+
+		"\r\n"+
+		"--%s\r\n"+
+		"Content-Type: application/octet-stream; name=\"encrypted.asc\"\r\n"+
+		"Content-Description: OpenPGP encrypted message\r\n"+
+		"Content-Disposition: inline; filename=\"encrypted.asc\"\r\n"+
+		"\r\n"+
+		"%s\r\n"+
+		"--%s--\r\n",
+		boundary, boundary, boundary, strings.ReplaceAll(strings.TrimSpace(string(ciphertext)), "\n", "\r\n"), boundary)
+}
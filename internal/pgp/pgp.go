@@ -0,0 +1,288 @@
+// Package pgp decrypts, verifies and encrypts OpenPGP mail with a locally installed
+// GnuPG, so private keys and passphrases never leave the machine.
+package pgp
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// gpgTimeout bounds a single gpg run so a stuck agent or pinentry can't hang a tool call
+const gpgTimeout = 30 * time.Second
+
+// Signature states reported in Status.Signature
+const (
+	SignatureGood       = "good"
+	SignatureBad        = "bad"
+	SignatureExpired    = "expired"     // good, but the signature or key has expired
+	SignatureRevoked    = "revoked"     // good, but the key has been revoked
+	SignatureUnknownKey = "unknown_key" // the signer's public key isn't in the keyring
+	SignatureError      = "error"
+)
+
+// Status describes what was found and done with a message's OpenPGP content
+type Status struct {
+	Encrypted bool   `json:"encrypted"`
+	Decrypted bool   `json:"decrypted"`
+	Signed    bool   `json:"signed"`
+	Signature string `json:"signature,omitempty"` // one of the Signature constants
+	Signer    string `json:"signer,omitempty"`    // user ID of the signing key
+	KeyID     string `json:"keyId,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// GPG runs the gpg binary against a keyring
+type GPG struct {
+	Binary string
+	// Home is the GnuPG home directory; empty uses gpg's default (~/.gnupg)
+	Home string
+	// PassphraseFile holds the secret key's passphrase; empty leaves it to gpg-agent
+	PassphraseFile string
+}
+
+// FromEnv returns the GnuPG configured by GMAIL_MCP_GPG ("1" finds gpg on PATH, or
+// give its path), with GMAIL_MCP_GPG_HOME and GMAIL_MCP_GPG_PASSPHRASE_FILE, or nil
+// when OpenPGP support is off
+func FromEnv() *GPG {
+	setting := strings.TrimSpace(os.Getenv("GMAIL_MCP_GPG"))
+	if setting == "" || setting == "0" || strings.EqualFold(setting, "false") {
+		return nil
+	}
+	binary := setting
+	if setting == "1" || strings.EqualFold(setting, "true") {
+		binary = ""
+		for _, name := range []string{"gpg", "gpg2"} {
+			if path, err := exec.LookPath(name); err == nil {
+				binary = path
+				break
+			}
+		}
+		if binary == "" {
+			return nil
+		}
+	}
+	return &GPG{
+		Binary:         binary,
+		Home:           strings.TrimSpace(os.Getenv("GMAIL_MCP_GPG_HOME")),
+		PassphraseFile: strings.TrimSpace(os.Getenv("GMAIL_MCP_GPG_PASSPHRASE_FILE")),
+	}
+}
+
+// run executes gpg in batch mode on stdin, returning its output and the status lines
+// it wrote (without the "[GNUPG:] " prefix)
+func (g *GPG) run(ctx context.Context, stdin []byte, args ...string) ([]byte, []string, error) {
+	ctx, cancel := context.WithTimeout(ctx, gpgTimeout)
+	defer cancel()
+
+	base := []string{"--batch", "--no-tty", "--status-fd", "2"}
+	if g.Home != "" {
+		base = append(base, "--homedir", g.Home)
+	}
+	if g.PassphraseFile != "" {
+		base = append(base, "--pinentry-mode", "loopback", "--passphrase-file", g.PassphraseFile)
+	}
+	cmd := exec.CommandContext(ctx, g.Binary, append(base, args...)...)
+	cmd.Stdin = bytes.NewReader(stdin)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	err := cmd.Run()
+
+	var status, messages []string
+	for _, line := range strings.Split(stderr.String(), "\n") {
+		if rest, ok := strings.CutPrefix(line, "[GNUPG:] "); ok {
+			status = append(status, rest)
+		} else if line = strings.TrimSpace(line); line != "" {
+			messages = append(messages, line)
+		}
+	}
+	if ctx.Err() == context.DeadlineExceeded {
+		return nil, status, fmt.Errorf("gpg timed out after %s", gpgTimeout)
+	}
+	if err != nil {
+		return stdout.Bytes(), status, fmt.Errorf("gpg failed: %v: %s", err, strings.Join(messages, "; "))
+	}
+	return stdout.Bytes(), status, nil
+}
+
+// applyStatus fills in the status from gpg's status lines
+func (s *Status) applyStatus(lines []string) {
+	for _, line := range lines {
+		keyword, rest, _ := strings.Cut(line, " ")
+		switch keyword {
+		case "DECRYPTION_OKAY":
+			s.Decrypted = true
+		case "BEGIN_DECRYPTION", "ENC_TO":
+			s.Encrypted = true
+		case "GOODSIG", "BADSIG", "EXPSIG", "EXPKEYSIG", "REVKEYSIG":
+			s.Signed = true
+			keyID, signer, _ := strings.Cut(rest, " ")
+			s.KeyID, s.Signer = keyID, signer
+			s.Signature = map[string]string{
+				"GOODSIG":   SignatureGood,
+				"BADSIG":    SignatureBad,
+				"EXPSIG":    SignatureExpired,
+				"EXPKEYSIG": SignatureExpired,
+				"REVKEYSIG": SignatureRevoked,
+			}[keyword]
+		case "ERRSIG":
+			s.Signed = true
+			fields := strings.Fields(rest)
+			if len(fields) > 0 {
+				s.KeyID = fields[0]
+			}
+			s.Signature = SignatureError
+			if len(fields) > 5 && fields[5] == "9" {
+				s.Signature = SignatureUnknownKey
+			}
+		case "NO_SECKEY":
+			s.Encrypted = true
+			s.Error = "no secret key for " + rest + " in the keyring"
+		}
+	}
+}
+
+// Decrypt decrypts an OpenPGP message (armored or binary), verifying any signature
+// inside it
+func (g *GPG) Decrypt(ctx context.Context, ciphertext []byte) ([]byte, Status) {
+	status := Status{Encrypted: true}
+	plaintext, lines, err := g.run(ctx, ciphertext, "--decrypt")
+	status.applyStatus(lines)
+	if err != nil || !status.Decrypted {
+		if status.Error == "" {
+			status.Error = fmt.Sprint(err)
+		}
+		return nil, status
+	}
+	return plaintext, status
+}
+
+// Verify checks a detached signature over signed, or a clear-signed message when
+// signature is nil
+func (g *GPG) Verify(ctx context.Context, signed, signature []byte) Status {
+	status := Status{Signed: true}
+	if signature == nil {
+		_, lines, _ := g.run(ctx, signed, "--verify")
+		status.applyStatus(lines)
+	} else {
+		// gpg reads a detached signature and its data from two files
+		dir, err := os.MkdirTemp("", "gmail-mcp-pgp-")
+		if err != nil {
+			status.Signature, status.Error = SignatureError, err.Error()
+			return status
+		}
+		defer os.RemoveAll(dir)
+		sigFile, dataFile := filepath.Join(dir, "signature.asc"), filepath.Join(dir, "data")
+		if err := os.WriteFile(sigFile, signature, 0600); err != nil {
+			status.Signature, status.Error = SignatureError, err.Error()
+			return status
+		}
+		if err := os.WriteFile(dataFile, signed, 0600); err != nil {
+			status.Signature, status.Error = SignatureError, err.Error()
+			return status
+		}
+		_, lines, _ := g.run(ctx, nil, "--verify", sigFile, dataFile)
+		status.applyStatus(lines)
+	}
+	if status.Signature == "" {
+		status.Signature = SignatureError
+	}
+	return status
+}
+
+// Encrypt encrypts plaintext to the recipients' public keys as ASCII armor
+func (g *GPG) Encrypt(ctx context.Context, plaintext []byte, recipients []string) ([]byte, error) {
+	args := []string{"--armor", "--encrypt"}
+	for _, recipient := range recipients {
+		args = append(args, "--recipient", recipient)
+	}
+	ciphertext, lines, err := g.run(ctx, plaintext, args...)
+	if err != nil {
+		// INV_RECP reason 10 is a key gpg found but won't use because it isn't trusted
+		var untrusted []string
+		for _, line := range lines {
+			if rest, ok := strings.CutPrefix(line, "INV_RECP 10 "); ok {
+				untrusted = append(untrusted, rest)
+			}
+		}
+		if len(untrusted) > 0 {
+			return nil, fmt.Errorf("the public key for %s isn't trusted", strings.Join(untrusted, ", "))
+		}
+		return nil, err
+	}
+	return ciphertext, nil
+}
+
+// KeyCheck sorts addresses by whether gpg will encrypt to them in batch mode
+type KeyCheck struct {
+	// Missing have no public key that can encrypt: none at all, or only revoked,
+	// expired, disabled or invalid ones
+	Missing []string
+	// Untrusted have a usable key that isn't certified (signed by the user or a key
+	// they trust), which gpg refuses to encrypt to
+	Untrusted []string
+}
+
+// OK reports whether every address has a usable, trusted key
+func (c KeyCheck) OK() bool {
+	return len(c.Missing) == 0 && len(c.Untrusted) == 0
+}
+
+// CheckKeys looks up the addresses' public keys in the keyring and checks each one's
+// validity, so keys gpg would refuse are reported before trying to encrypt
+func (g *GPG) CheckKeys(ctx context.Context, addresses []string) KeyCheck {
+	var check KeyCheck
+	for _, address := range addresses {
+		// gpg exits non-zero when nothing matches, which leaves the listing empty
+		listing, _, _ := g.run(ctx, nil, "--list-keys", "--with-colons", "<"+address+">")
+		switch keyState(listing, address) {
+		case keyMissing:
+			check.Missing = append(check.Missing, address)
+		case keyUntrusted:
+			check.Untrusted = append(check.Untrusted, address)
+		}
+	}
+	return check
+}
+
+// Key states found by keyState, from worst to best
+const (
+	keyMissing = iota
+	keyUntrusted
+	keyValid
+)
+
+// keyState reads a --list-keys --with-colons listing and returns the best state of
+// the keys for address. A key counts when it can encrypt and isn't invalid, disabled,
+// revoked or expired; it is trusted when the user ID with the address has marginal,
+// full or ultimate validity.
+func keyState(listing []byte, address string) int {
+	state, usable := keyMissing, false
+	wanted := "<" + strings.ToLower(address) + ">"
+	for _, line := range strings.Split(string(listing), "\n") {
+		fields := strings.Split(line, ":")
+		if len(fields) < 10 {
+			continue
+		}
+		switch fields[0] {
+		case "pub":
+			// Field 2 is the key's validity and field 12 its capabilities, with an
+			// upper-case E when the key or one of its subkeys can encrypt
+			usable = len(fields) > 11 && !strings.ContainsAny(fields[1], "idre") &&
+				strings.Contains(fields[11], "E") && !strings.Contains(fields[11], "D")
+			if usable && state < keyUntrusted {
+				state = keyUntrusted
+			}
+		case "uid":
+			if usable && strings.ContainsAny(fields[1], "mfu") && strings.Contains(strings.ToLower(fields[9]), wanted) {
+				state = keyValid
+			}
+		}
+	}
+	return state
+}
@@ -0,0 +1,93 @@
+package pgp
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestApplyStatus(t *testing.T) {
+	tests := []struct {
+		name  string
+		lines []string
+		want  Status
+	}{
+		{
+			name:  "good signature",
+			lines: []string{"NEWSIG", "GOODSIG 0123456789ABCDEF Alice <alice@example.com>", "VALIDSIG ABCDEF"},
+			want:  Status{Signed: true, Signature: SignatureGood, KeyID: "0123456789ABCDEF", Signer: "Alice <alice@example.com>"},
+		},
+		{
+			name:  "bad signature",
+			lines: []string{"NEWSIG", "BADSIG 0123456789ABCDEF Alice <alice@example.com>"},
+			want:  Status{Signed: true, Signature: SignatureBad, KeyID: "0123456789ABCDEF", Signer: "Alice <alice@example.com>"},
+		},
+		{
+			name:  "signature by a key not in the keyring",
+			lines: []string{"NEWSIG", "ERRSIG 0123456789ABCDEF 22 10 00 1700000000 9 -", "NO_PUBKEY 0123456789ABCDEF"},
+			want:  Status{Signed: true, Signature: SignatureUnknownKey, KeyID: "0123456789ABCDEF"},
+		},
+		{
+			name:  "signature that can't be checked",
+			lines: []string{"NEWSIG", "ERRSIG 0123456789ABCDEF 22 10 00 1700000000 4 -"},
+			want:  Status{Signed: true, Signature: SignatureError, KeyID: "0123456789ABCDEF"},
+		},
+		{
+			name:  "no secret key to decrypt",
+			lines: []string{"ENC_TO 0123456789ABCDEF 18 0", "NO_SECKEY 0123456789ABCDEF", "BEGIN_DECRYPTION", "DECRYPTION_FAILED", "END_DECRYPTION"},
+			want:  Status{Encrypted: true, Error: "no secret key for 0123456789ABCDEF in the keyring"},
+		},
+		{
+			name:  "decrypted and signed",
+			lines: []string{"ENC_TO 0123456789ABCDEF 18 0", "BEGIN_DECRYPTION", "GOODSIG FEDCBA9876543210 Bob <bob@example.com>", "DECRYPTION_OKAY", "END_DECRYPTION"},
+			want:  Status{Encrypted: true, Decrypted: true, Signed: true, Signature: SignatureGood, KeyID: "FEDCBA9876543210", Signer: "Bob <bob@example.com>"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got Status
+			got.applyStatus(tt.lines)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("applyStatus() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestKeyState(t *testing.T) {
+	listing := func(validity, capabilities, uidValidity string) []byte {
+		return []byte("tru::1:1700000000:0:3:1:5\n" +
+			"pub:" + validity + ":255:22:0123456789ABCDEF:1600000000:::-:::" + capabilities + ":::+:::23::0:\n" +
+			"fpr:::::::::0000000000000000000000000123456789ABCDEF:\n" +
+			"uid:" + uidValidity + "::::1600000000::0000::Alice <Alice@Example.com>::::::::::0:\n" +
+			"sub:" + validity + ":255:18:FEDCBA9876543210:1600000000::::::e:::+:::23:\n")
+	}
+
+	tests := []struct {
+		name    string
+		listing []byte
+		want    int
+	}{
+		{"no key", nil, keyMissing},
+		{"fully valid", listing("f", "scESC", "f"), keyValid},
+		{"ultimately trusted own key", listing("u", "scESC", "u"), keyValid},
+		{"marginally valid", listing("m", "scESC", "m"), keyValid},
+		{"not certified", listing("-", "scESC", "-"), keyUntrusted},
+		{"unknown validity", listing("o", "scESC", "q"), keyUntrusted},
+		{"revoked", listing("r", "scESC", "r"), keyMissing},
+		{"expired", listing("e", "scESC", "e"), keyMissing},
+		{"disabled", listing("f", "scESCD", "f"), keyMissing},
+		{"signing only", listing("f", "scSC", "f"), keyMissing},
+		{
+			"revoked key beside a valid one",
+			append(listing("r", "scESC", "r"), listing("f", "scESC", "f")...),
+			keyValid,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := keyState(tt.listing, "alice@example.com"); got != tt.want {
+				t.Errorf("keyState() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
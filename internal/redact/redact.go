@@ -0,0 +1,209 @@
+// Package redact removes personal data (SSNs, card numbers, phone numbers, ...)
+// from email text before it is sent to an LLM provider.
+package redact
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// rule replaces every valid match of pattern with a [REDACTED_KIND] placeholder
+type rule struct {
+	kind    string
+	pattern *regexp.Regexp
+	valid   func(match string) bool // optional check to cut false positives
+}
+
+// defaultRules are always applied when redaction is on
+var defaultRules = []rule{
+	{kind: "ssn", pattern: regexp.MustCompile(`\b\d{3}-\d{2}-\d{4}\b`)},
+	{kind: "card", pattern: regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`), valid: luhn},
+	{kind: "iban", pattern: regexp.MustCompile(`\b[A-Z]{2}\d{2}(?: ?[A-Z0-9]{4}){2,7}(?: ?[A-Z0-9]{1,4})?\b`)},
+	{kind: "email", pattern: regexp.MustCompile(`\b[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}\b`)},
+	{kind: "phone", pattern: regexp.MustCompile(`(?:\+\d{1,3}[ .-]?)?(?:\(\d{2,4}\)|\d{2,4})[ .-]?\d{3,4}[ .-]?\d{3,4}\b`), valid: phoneDigits},
+}
+
+var (
+	// greetingName catches the name after a greeting or on the line after a sign-off
+	greetingName = regexp.MustCompile(`(?m)(\b(?:Hi|Hello|Hey|Dear|Thanks|Thank you)[ ,]+|^(?:Best|Regards|Cheers|Thanks|Sincerely|Best regards|Kind regards|Warm regards),?[ \t]*\r?\n)([A-Z][a-z]+(?: [A-Z][a-z]+)?)\b`)
+	nameWord     = regexp.MustCompile(`^[A-Z][\p{L}'-]+$`)
+)
+
+// Report counts the redactions made per kind
+type Report map[string]int
+
+// Add merges other into r
+func (r Report) Add(other Report) {
+	for kind, count := range other {
+		r[kind] += count
+	}
+}
+
+// String lists the counts, e.g. "2 email, 1 phone"
+func (r Report) String() string {
+	kinds := make([]string, 0, len(r))
+	for kind := range r {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	parts := make([]string, len(kinds))
+	for i, kind := range kinds {
+		parts[i] = fmt.Sprintf("%d %s", r[kind], kind)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Redactor removes personal data from text. A nil Redactor leaves text unchanged.
+type Redactor struct {
+	rules []rule
+	names bool
+}
+
+// FromEnv returns the redactor configured by the environment, or nil when
+// GMAIL_MCP_REDACT isn't "1". GMAIL_MCP_REDACT_PATTERNS names a JSON file of extra
+// {"kind": "regex"} rules and GMAIL_MCP_REDACT_NAMES=1 turns on the names pass.
+func FromEnv() *Redactor {
+	if os.Getenv("GMAIL_MCP_REDACT") != "1" {
+		return nil
+	}
+	return Configured()
+}
+
+// Configured returns a redactor with the GMAIL_MCP_REDACT_PATTERNS and
+// GMAIL_MCP_REDACT_NAMES settings whether or not GMAIL_MCP_REDACT is on, for
+// redacting on request, e.g. a thread exported for sharing
+func Configured() *Redactor {
+	var extra map[string]string
+	if path := os.Getenv("GMAIL_MCP_REDACT_PATTERNS"); path != "" {
+		data, err := os.ReadFile(path)
+		if err == nil {
+			err = json.Unmarshal(data, &extra)
+		}
+		if err != nil {
+			log.Printf("Warning: Could not load redaction patterns from %s: %v", path, err)
+		}
+	}
+
+	redactor, err := New(extra, os.Getenv("GMAIL_MCP_REDACT_NAMES") == "1")
+	if err != nil {
+		log.Printf("Warning: %v; using the default redaction rules only", err)
+		redactor, _ = New(nil, os.Getenv("GMAIL_MCP_REDACT_NAMES") == "1")
+	}
+	return redactor
+}
+
+// New creates a redactor with the default rules plus extra {"kind": "regex"} rules.
+// With names, people's names are redacted too: names passed to Redact and names
+// after greetings and sign-offs.
+func New(extra map[string]string, names bool) (*Redactor, error) {
+	r := &Redactor{names: names}
+	kinds := make([]string, 0, len(extra))
+	for kind := range extra {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	// Custom rules run first so they can claim text the defaults would also match
+	for _, kind := range kinds {
+		pattern, err := regexp.Compile(extra[kind])
+		if err != nil {
+			return nil, fmt.Errorf("invalid redaction pattern %q: %v", kind, err)
+		}
+		r.rules = append(r.rules, rule{kind: kind, pattern: pattern})
+	}
+	r.rules = append(r.rules, defaultRules...)
+	return r, nil
+}
+
+// Redact replaces personal data in text with placeholders like [REDACTED_PHONE] and
+// reports what was removed. names are people's names (e.g. from From/To headers)
+// redacted by the names pass.
+func (r *Redactor) Redact(text string, names ...string) (string, Report) {
+	report := Report{}
+	if r == nil {
+		return text, report
+	}
+
+	for _, rule := range r.rules {
+		placeholder := "[REDACTED_" + strings.ToUpper(rule.kind) + "]"
+		text = rule.pattern.ReplaceAllStringFunc(text, func(match string) string {
+			if rule.valid != nil && !rule.valid(match) {
+				return match
+			}
+			report[rule.kind]++
+			return placeholder
+		})
+	}
+
+	if r.names {
+		text = greetingName.ReplaceAllStringFunc(text, func(match string) string {
+			groups := greetingName.FindStringSubmatch(match)
+			report["name"]++
+			return groups[1] + "[NAME]"
+		})
+		for _, word := range nameWords(names) {
+			pattern := regexp.MustCompile(`\b` + regexp.QuoteMeta(word) + `\b`)
+			text = pattern.ReplaceAllStringFunc(text, func(string) string {
+				report["name"]++
+				return "[NAME]"
+			})
+		}
+	}
+	return text, report
+}
+
+// nameWords splits names into the capitalized words worth redacting, longest first
+// so "Annabel" is replaced before "Anna"
+func nameWords(names []string) []string {
+	seen := map[string]bool{}
+	var words []string
+	for _, name := range names {
+		for _, word := range strings.Fields(name) {
+			word = strings.Trim(word, `",.()<>`)
+			if len(word) >= 2 && nameWord.MatchString(word) && !seen[word] {
+				seen[word] = true
+				words = append(words, word)
+			}
+		}
+	}
+	sort.Slice(words, func(i, j int) bool {
+		return len(words[i]) > len(words[j])
+	})
+	return words
+}
+
+// luhn reports whether a digit string (spaces and dashes allowed) passes the card checksum
+func luhn(number string) bool {
+	sum, double := 0, false
+	for i := len(number) - 1; i >= 0; i-- {
+		c := number[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+		digit := int(c - '0')
+		if double {
+			digit *= 2
+			if digit > 9 {
+				digit -= 9
+			}
+		}
+		sum += digit
+		double = !double
+	}
+	return sum%10 == 0
+}
+
+// phoneDigits keeps phone matches with a plausible number of digits (10-15)
+func phoneDigits(match string) bool {
+	digits := 0
+	for _, c := range match {
+		if c >= '0' && c <= '9' {
+			digits++
+		}
+	}
+	return digits >= 10 && digits <= 15
+}
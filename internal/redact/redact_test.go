@@ -0,0 +1,92 @@
+package redact
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRedact(t *testing.T) {
+	redactor, err := New(nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name   string
+		text   string
+		want   string
+		report Report
+	}{
+		{"email", "Write to dana.lee+work@mail.example.co.uk today", "Write to [REDACTED_EMAIL] today", Report{"email": 1}},
+		{"two emails", "cc a@example.com, b_c@example.org", "cc [REDACTED_EMAIL], [REDACTED_EMAIL]", Report{"email": 2}},
+		{"international phone", "Call +1 415-555-0132 or +44 20 7946 0958.", "Call [REDACTED_PHONE] or [REDACTED_PHONE].", Report{"phone": 2}},
+		{"phone with area code", "Office: (415) 555-0132", "Office: [REDACTED_PHONE]", Report{"phone": 1}},
+		{"dotted phone", "mobile 415.555.0132", "mobile [REDACTED_PHONE]", Report{"phone": 1}},
+		{"card with spaces", "Card 4111 1111 1111 1111 exp 04/28", "Card [REDACTED_CARD] exp 04/28", Report{"card": 1}},
+		{"card with dashes", "Amex 3782-822463-10005", "Amex [REDACTED_CARD]", Report{"card": 1}},
+		{"card without separators", "pan=5555555555554444;", "pan=[REDACTED_CARD];", Report{"card": 1}},
+		{"iban with spaces", "IBAN: DE89 3704 0044 0532 0130 00", "IBAN: [REDACTED_IBAN]", Report{"iban": 1}},
+		{"compact iban", "pay GB82WEST12345698765432 by Friday", "pay [REDACTED_IBAN] by Friday", Report{"iban": 1}},
+		{"ssn", "SSN 078-05-1120", "SSN [REDACTED_SSN]", Report{"ssn": 1}},
+		{"mixed", "Reach me at dana@example.com or 415-555-0132",
+			"Reach me at [REDACTED_EMAIL] or [REDACTED_PHONE]", Report{"email": 1, "phone": 1}},
+
+		{"plain text", "The Q3 plan is attached, see section 4.2", "The Q3 plan is attached, see section 4.2", Report{}},
+		{"dates and times", "Meeting on 2026-03-05 at 14:30, invoice 2026/03", "Meeting on 2026-03-05 at 14:30, invoice 2026/03", Report{}},
+		{"short numbers", "Order 12345, room 404, 3 items at $19.99", "Order 12345, room 404, 3 items at $19.99", Report{}},
+		{"no domain", "ping @dana or user@localhost", "ping @dana or user@localhost", Report{}},
+		{"too few digits for a phone", "serial 1234-5678, ext. 555 0132", "serial 1234-5678, ext. 555 0132", Report{}},
+		{"digits inside a word", "ref X1234567812345678Y", "ref X1234567812345678Y", Report{}},
+		{"iban without enough groups", "ticket DE89 3704", "ticket DE89 3704", Report{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, report := redactor.Redact(tt.text)
+			if got != tt.want {
+				t.Errorf("Redact(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+			if !reflect.DeepEqual(report, tt.report) {
+				t.Errorf("Redact(%q) report = %v, want %v", tt.text, report, tt.report)
+			}
+		})
+	}
+}
+
+func TestLuhn(t *testing.T) {
+	tests := []struct {
+		number string
+		want   bool
+	}{
+		{"4111 1111 1111 1111", true},
+		{"4111-1111-1111-1112", false},
+		{"378282246310005", true},
+		{"1234567812345678", false},
+	}
+	for _, tt := range tests {
+		if got := luhn(tt.number); got != tt.want {
+			t.Errorf("luhn(%q) = %v, want %v", tt.number, got, tt.want)
+		}
+	}
+}
+
+func TestRedactNames(t *testing.T) {
+	redactor, err := New(map[string]string{"order": `\bORD-\d{6}\b`}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, report := redactor.Redact("Hi Annabel,\nyour order ORD-123456 shipped. Anna says hello.\n\nBest regards,\nMarco Rossi", "Annabel Smith <annabel@example.com>", "Anna")
+	want := "Hi [NAME],\nyour order [REDACTED_ORDER] shipped. [NAME] says hello.\n\nBest regards,\n[NAME]"
+	if got != want {
+		t.Errorf("Redact() = %q, want %q", got, want)
+	}
+	if report["order"] != 1 || report["name"] != 3 {
+		t.Errorf("Redact() report = %v, want 1 order and 3 names", report)
+	}
+
+	var none *Redactor
+	if got, report := none.Redact("dana@example.com"); got != "dana@example.com" || len(report) != 0 {
+		t.Errorf("nil Redactor changed the text to %q (%v)", got, report)
+	}
+	if _, err := New(map[string]string{"bad": "("}, false); err == nil {
+		t.Errorf("New() with an invalid pattern succeeded")
+	}
+}
@@ -0,0 +1,72 @@
+// Package requestid gives every tool call an ID that appears in its result, the
+// server log, the audit log and the log lines of the Gmail API calls it makes, so a
+// user reporting a problem can point at the exact call.
+package requestid
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// MetaKey is the key of the request ID in a tool result's _meta
+const MetaKey = "requestId"
+
+type contextKey struct{}
+
+// New returns a random request ID such as "req-3f9a1c0b7d2e"
+func New() string {
+	id := make([]byte, 6)
+	rand.Read(id)
+	return "req-" + hex.EncodeToString(id)
+}
+
+// WithID returns ctx carrying the request ID
+func WithID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext returns the request ID of the tool call ctx belongs to, or ""
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(contextKey{}).(string)
+	return id
+}
+
+// Middleware gives each tool call a request ID, logs when the call starts and ends,
+// and returns the ID in the result's _meta. Install it outermost so every other
+// middleware, and the tool itself, can read the ID with FromContext.
+func Middleware() server.ToolHandlerMiddleware {
+	return func(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+		return func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			id := New()
+			tool := req.Params.Name
+			started := time.Now()
+			log.Printf("[%s] %s started", id, tool)
+
+			result, err := next(WithID(ctx, id), req)
+
+			elapsed := time.Since(started).Round(time.Millisecond)
+			switch {
+			case err != nil:
+				log.Printf("[%s] %s failed after %s: %v", id, tool, elapsed, err)
+			case result != nil && result.IsError:
+				log.Printf("[%s] %s returned an error after %s", id, tool, elapsed)
+			default:
+				log.Printf("[%s] %s finished in %s", id, tool, elapsed)
+			}
+
+			if result != nil {
+				if result.Meta == nil {
+					result.Meta = map[string]any{}
+				}
+				result.Meta[MetaKey] = id
+			}
+			return result, err
+		}
+	}
+}
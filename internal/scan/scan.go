@@ -0,0 +1,177 @@
+// Package scan screens attachment bytes for malware before they are parsed, using
+// a ClamAV daemon or a user-supplied command.
+package scan
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// scanTimeout bounds a single scan so a stuck scanner can't hang a tool call
+const scanTimeout = 60 * time.Second
+
+// clamdChunkSize is the INSTREAM chunk size; clamd's StreamMaxLength applies to the total
+const clamdChunkSize = 64 * 1024
+
+// Scanner checks bytes for malware
+type Scanner interface {
+	// Scan returns a non-nil *FlaggedError when data is malicious, or another
+	// error when it could not be scanned
+	Scan(ctx context.Context, data []byte, filename string) error
+	// Name identifies the scanner in messages
+	Name() string
+}
+
+// FlaggedError reports a file the scanner flagged
+type FlaggedError struct {
+	Scanner   string
+	Signature string
+}
+
+func (e *FlaggedError) Error() string {
+	return fmt.Sprintf("flagged as malicious by %s (%s)", e.Scanner, e.Signature)
+}
+
+// IsFlagged reports whether err is (or wraps) a FlaggedError
+func IsFlagged(err error) bool {
+	var flagged *FlaggedError
+	return errors.As(err, &flagged)
+}
+
+// FromEnv returns the scanner configured by GMAIL_MCP_SCAN_COMMAND or GMAIL_MCP_CLAMD,
+// or nil when attachments aren't scanned. GMAIL_MCP_CLAMD is a unix socket path or
+// host:port of clamd; GMAIL_MCP_SCAN_COMMAND is a command run with the file's path
+// appended, exiting 0 for clean and 1 for infected (like clamscan).
+func FromEnv() Scanner {
+	if command := strings.TrimSpace(os.Getenv("GMAIL_MCP_SCAN_COMMAND")); command != "" {
+		return &Command{Args: strings.Fields(command)}
+	}
+	if address := strings.TrimSpace(os.Getenv("GMAIL_MCP_CLAMD")); address != "" {
+		return NewClamd(address)
+	}
+	return nil
+}
+
+// Clamd scans with a ClamAV daemon using the INSTREAM command
+type Clamd struct {
+	network string
+	address string
+}
+
+// NewClamd creates a clamd scanner for a unix socket path or a host:port address
+func NewClamd(address string) *Clamd {
+	if strings.HasPrefix(address, "/") || strings.HasPrefix(address, "unix:") {
+		return &Clamd{network: "unix", address: strings.TrimPrefix(address, "unix:")}
+	}
+	return &Clamd{network: "tcp", address: strings.TrimPrefix(address, "tcp://")}
+}
+
+// Name identifies the scanner in messages
+func (c *Clamd) Name() string {
+	return "ClamAV"
+}
+
+// Scan streams data to clamd and parses its "stream: OK" or "stream: <signature> FOUND" reply
+func (c *Clamd) Scan(ctx context.Context, data []byte, filename string) error {
+	ctx, cancel := context.WithTimeout(ctx, scanTimeout)
+	defer cancel()
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, c.network, c.address)
+	if err != nil {
+		return fmt.Errorf("failed to connect to clamd at %s: %v", c.address, err)
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	if _, err := conn.Write([]byte("zINSTREAM\x00")); err != nil {
+		return fmt.Errorf("failed to send to clamd: %v", err)
+	}
+	for start := 0; start < len(data); start += clamdChunkSize {
+		chunk := data[start:min(start+clamdChunkSize, len(data))]
+		var size [4]byte
+		binary.BigEndian.PutUint32(size[:], uint32(len(chunk)))
+		if _, err := conn.Write(append(size[:], chunk...)); err != nil {
+			return fmt.Errorf("failed to send to clamd: %v", err)
+		}
+	}
+	if _, err := conn.Write([]byte{0, 0, 0, 0}); err != nil {
+		return fmt.Errorf("failed to send to clamd: %v", err)
+	}
+
+	reply, err := io.ReadAll(conn)
+	if err != nil {
+		return fmt.Errorf("failed to read clamd reply: %v", err)
+	}
+	result := strings.TrimSpace(strings.TrimRight(string(reply), "\x00"))
+	result = strings.TrimPrefix(result, "stream: ")
+	switch {
+	case result == "OK":
+		return nil
+	case strings.HasSuffix(result, " FOUND"):
+		return &FlaggedError{Scanner: c.Name(), Signature: strings.TrimSuffix(result, " FOUND")}
+	default:
+		// e.g. "INSTREAM size limit exceeded. ERROR"
+		return fmt.Errorf("clamd could not scan %s: %s", filename, result)
+	}
+}
+
+// Command scans by running an external program on a temporary copy of the file
+type Command struct {
+	Args []string
+}
+
+// Name identifies the scanner in messages
+func (c *Command) Name() string {
+	return filepath.Base(c.Args[0])
+}
+
+// Scan writes data to a temporary file and runs the command on it. Exit status 1
+// means infected, with the command's output as the signature; other failures are errors.
+func (c *Command) Scan(ctx context.Context, data []byte, filename string) error {
+	ctx, cancel := context.WithTimeout(ctx, scanTimeout)
+	defer cancel()
+
+	file, err := os.CreateTemp("", "gmail-mcp-scan-*"+filepath.Ext(filename))
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file for scanning: %v", err)
+	}
+	defer os.Remove(file.Name())
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write temporary file for scanning: %v", err)
+	}
+	file.Close()
+
+	var output bytes.Buffer
+	cmd := exec.CommandContext(ctx, c.Args[0], append(c.Args[1:], file.Name())...)
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	err = cmd.Run()
+
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+		return nil
+	case errors.As(err, &exitErr) && exitErr.ExitCode() == 1:
+		signature := strings.TrimSpace(strings.ReplaceAll(output.String(), file.Name(), filename))
+		if signature == "" {
+			signature = "no details"
+		}
+		return &FlaggedError{Scanner: c.Name(), Signature: signature}
+	default:
+		return fmt.Errorf("%s could not scan %s: %v: %s", c.Name(), filename, err, strings.TrimSpace(output.String()))
+	}
+}
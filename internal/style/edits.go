@@ -0,0 +1,80 @@
+package style
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// The user's own additions live between these markers at the end of the guide, so
+// regenerating the guide keeps them
+const (
+	userEditsStart  = "<!-- user-edits:start -->"
+	userEditsEnd    = "<!-- user-edits:end -->"
+	userEditsHeader = "## User Edits\n\nThese corrections come from the user and take precedence over the generated guide above. Regenerating the guide keeps them."
+)
+
+// UserEdits returns the user-edited section of a style guide, or "" when there is none
+func UserEdits(guide string) string {
+	_, rest, found := strings.Cut(guide, userEditsStart)
+	if !found {
+		return ""
+	}
+	inner, _, _ := strings.Cut(rest, userEditsEnd)
+	return strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(inner), userEditsHeader))
+}
+
+// Generated returns a style guide without its user-edited section
+func Generated(guide string) string {
+	before, rest, found := strings.Cut(guide, userEditsStart)
+	if !found {
+		return guide
+	}
+	_, after, _ := strings.Cut(rest, userEditsEnd)
+	return strings.TrimSpace(before + after)
+}
+
+// withUserEdits appends the user-edited section to a generated guide
+func withUserEdits(generated, edits string) string {
+	generated = strings.TrimSpace(generated)
+	if edits == "" {
+		return generated + "\n"
+	}
+	if generated != "" {
+		generated += "\n\n"
+	}
+	return fmt.Sprintf("%s%s\n%s\n\n%s\n%s\n", generated, userEditsStart, userEditsHeader, edits, userEditsEnd)
+}
+
+// UpdateUserEdits merges text into the user-edited section of the guide at path,
+// appending it (each line as a bullet) or replacing the section, and returns the
+// section's new contents. The generated part of the guide is left as it is.
+func UpdateUserEdits(path, text string, replace bool) (string, error) {
+	guide, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return "", fmt.Errorf("failed to read style guide at %s: %v", path, err)
+	}
+
+	var lines []string
+	for _, line := range strings.Split(strings.TrimSpace(text), "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed != "" && !strings.HasPrefix(trimmed, "-") && !strings.HasPrefix(trimmed, "*") && !strings.HasPrefix(trimmed, "#") {
+			line = "- " + trimmed
+		}
+		lines = append(lines, line)
+	}
+	added := strings.TrimSpace(strings.Join(lines, "\n"))
+
+	edits := UserEdits(string(guide))
+	switch {
+	case replace || edits == "":
+		edits = added
+	case added != "":
+		edits += "\n" + added
+	}
+
+	if err := os.WriteFile(path, []byte(withUserEdits(Generated(string(guide)), edits)), 0644); err != nil {
+		return "", fmt.Errorf("failed to write personal email style guide file: %v", err)
+	}
+	return edits, nil
+}
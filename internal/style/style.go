@@ -0,0 +1,247 @@
+// Package style generates and maintains the personal email style guide that
+// teaches agents how the user writes.
+package style
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+
+	"auto-gmail/internal/extract"
+	"auto-gmail/internal/llm"
+	"auto-gmail/internal/redact"
+
+	"github.com/openai/openai-go"
+	"google.golang.org/api/gmail/v1"
+)
+
+// minLanguageSamples is how many sent emails in another language earn it its own section
+const minLanguageSamples = 3
+
+// maxLanguageSections caps the extra per-language sections in the guide
+const maxLanguageSections = 3
+
+// Source is the Gmail account a style guide is generated from
+type Source interface {
+	IsAuthenticated() bool
+	GetUserProfile() (*gmail.Profile, error)
+	// SentMessages returns up to max full messages from the Sent folder, newest first
+	SentMessages(ctx context.Context, max int64) ([]*gmail.Message, error)
+}
+
+// Generate analyzes the account's sent emails and writes a personal style guide to path
+func Generate(src Source, path string) error {
+	log.Println("Generating personal email style guide from sent emails...")
+
+	// Create the OpenAI client; fails when no key is set or external AI is disabled
+	client, err := llm.NewClient()
+	if err != nil {
+		return err
+	}
+
+	if !src.IsAuthenticated() {
+		return fmt.Errorf("Gmail is not authenticated yet; call the authenticate tool first")
+	}
+
+	// Get user profile information
+	log.Println("Fetching user profile...")
+	profile, err := src.GetUserProfile()
+	if err != nil {
+		log.Printf("Warning: Could not fetch user profile: %v", err)
+		profile = &gmail.Profile{EmailAddress: "unknown@example.com"}
+	}
+
+	// Get sent emails
+	log.Println("Fetching sent emails...")
+	messages, err := src.SentMessages(context.Background(), 100)
+	if err != nil {
+		return fmt.Errorf("failed to fetch sent messages: %v", err)
+	}
+
+	// Group substantial emails by language; the most common one drives the main guide
+	byLanguage := map[string][]sample{}
+	primary := ""
+	for _, fullMsg := range messages {
+		body := extract.EmailBody(fullMsg)
+		if body == "" || len(body) <= 50 { // Only include substantial emails
+			continue
+		}
+		s := sample{body: body}
+		if fullMsg.Payload != nil {
+			for _, header := range fullMsg.Payload.Headers {
+				switch header.Name {
+				case "Subject":
+					s.subject = header.Value
+				case "To":
+					s.to = header.Value
+				}
+			}
+		}
+		language := extract.DetectLanguage(body)
+		if language == "" {
+			language = "en"
+		}
+		byLanguage[language] = append(byLanguage[language], s)
+		if primary == "" || len(byLanguage[language]) > len(byLanguage[primary]) {
+			primary = language
+		}
+	}
+
+	if len(byLanguage) == 0 {
+		return fmt.Errorf("no sent emails found to analyze")
+	}
+
+	// Limit to avoid hitting token limits
+	primarySamples := byLanguage[primary][:min(len(byLanguage[primary]), 25)]
+	log.Printf("Analyzing %d sent emails...", len(primarySamples))
+
+	// Concise, focused prompt that encourages specificity
+	prompt := fmt.Sprintf(`Analyze these %d emails from %s to create a concise, specific email style guide.
+
+EMAILS:
+%s
+
+Create a markdown guide with:
+
+1. **USER BACKGROUND**: Infer their role, industry, expertise from email content/recipients
+2. **WRITING PATTERNS**: Specific words/phrases they actually use (not generic advice)
+3. **STRUCTURE**: How they organize emails (greeting→body→closing patterns)
+4. **TONE**: Their actual communication style with examples
+5. **SIGNATURE ELEMENTS**: Unique characteristics that make emails sound like them
+
+Be specific and actionable. Avoid generic advice. Focus on what makes THIS person's emails distinctive.
+
+Start with "# Personal Email Style Guide for %s"`, len(primarySamples), profile.EmailAddress, samplesText(primarySamples), profile.EmailAddress)
+
+	// Call OpenAI API
+	log.Println("Generating personal email style guide with OpenAI...")
+	styleGuide, err := complete(client, prompt)
+	if err != nil {
+		return fmt.Errorf("failed to generate style guide: %v", err)
+	}
+
+	// A section per other language the user writes in often enough, so drafts in
+	// German or Japanese follow how they actually write in it
+	var languages []string
+	for language, samples := range byLanguage {
+		if language != primary && len(samples) >= minLanguageSamples {
+			languages = append(languages, language)
+		}
+	}
+	sort.Slice(languages, func(i, j int) bool {
+		return len(byLanguage[languages[i]]) > len(byLanguage[languages[j]])
+	})
+	for _, language := range languages[:min(len(languages), maxLanguageSections)] {
+		samples := byLanguage[language][:min(len(byLanguage[language]), 10)]
+		name := extract.LanguageName(language)
+		log.Printf("Generating the %s section from %d emails...", name, len(samples))
+
+		section, err := complete(client, fmt.Sprintf(`These %d emails were written in %s by %s.
+
+EMAILS:
+%s
+
+Write a short markdown section describing how this person writes emails in %s specifically: their usual greetings and sign-offs (quote them in %s), level of formality (e.g. du/Sie, tu/vous, keigo), typical phrases and structure, and how it differs from their writing in %s. Be specific; quote real phrases. Do not translate the quotes.
+
+Start with "## Writing in %s"`, len(samples), name, profile.EmailAddress, samplesText(samples), name, name, extract.LanguageName(primary), name))
+		if err != nil {
+			log.Printf("Warning: Could not generate the %s section: %v", name, err)
+			continue
+		}
+		styleGuide = strings.TrimRight(styleGuide, "\n") + "\n\n" + section
+	}
+
+	// Keep the user's own edits from the previous guide
+	if existing, err := os.ReadFile(path); err == nil {
+		styleGuide = withUserEdits(styleGuide, UserEdits(string(existing)))
+	}
+
+	// Save to file
+	err = os.WriteFile(path, []byte(styleGuide), 0644)
+	if err != nil {
+		return fmt.Errorf("failed to write personal email style guide file: %v", err)
+	}
+
+	log.Printf("Successfully generated personal-email-style-guide.md at: %s", path)
+	return nil
+}
+
+// sample is one sent email used to learn the user's style
+type sample struct {
+	subject, to, body string
+}
+
+// samplesText formats emails for a prompt, stripping personal data before the
+// samples leave the machine (GMAIL_MCP_REDACT=1)
+func samplesText(samples []sample) string {
+	var emailSamples []string
+	var recipients []string
+	for i, s := range samples {
+		text := fmt.Sprintf("Email %d:\n", i+1)
+		if s.subject != "" {
+			text += fmt.Sprintf("Subject: %s\n", s.subject)
+		}
+		if s.to != "" {
+			text += fmt.Sprintf("To: %s\n", s.to)
+		}
+		text += fmt.Sprintf("Body: %s", s.body)
+		emailSamples = append(emailSamples, text)
+		recipients = append(recipients, s.to)
+	}
+
+	text, report := redact.FromEnv().Redact(strings.Join(emailSamples, "\n\n---\n\n"), recipients...)
+	if len(report) > 0 {
+		log.Printf("🔒 Redacted %s from the email samples before sending them to OpenAI", report)
+	}
+	return text
+}
+
+// complete sends one prompt to OpenAI and returns the reply
+func complete(client openai.Client, prompt string) (string, error) {
+	completion, err := client.Chat.Completions.New(context.Background(), openai.ChatCompletionNewParams{
+		Messages: []openai.ChatCompletionMessageParamUnion{
+			{
+				OfUser: &openai.ChatCompletionUserMessageParam{
+					Content: openai.ChatCompletionUserMessageParamContentUnion{
+						OfString: openai.String(prompt),
+					},
+				},
+			},
+		},
+		Model:       llm.ChatModel(),
+		Temperature: openai.Float(0.3), // Lower temperature for more focused, consistent output
+	})
+	if err != nil {
+		return "", err
+	}
+	if len(completion.Choices) == 0 {
+		return "", fmt.Errorf("no response from OpenAI")
+	}
+	return completion.Choices[0].Message.Content, nil
+}
+
+// EnsureExists checks if the style guide at path exists and auto-generates it if needed
+func EnsureExists(src Source, path string) error {
+	toneFilePath := path
+
+	// Check if file already exists
+	if _, err := os.Stat(toneFilePath); err == nil {
+		return nil // File exists, nothing to do
+	}
+
+	// File doesn't exist, try to auto-generate
+	if err := llm.Check(); err != nil {
+		return fmt.Errorf("personal email style guide not found at %s and it can't be auto-generated (%v). Please either set OPENAI_API_KEY for auto-generation or create the file manually", toneFilePath, err)
+	}
+
+	log.Println("📝 Style guide not found, auto-generating from your sent emails...")
+	if err := Generate(src, path); err != nil {
+		return fmt.Errorf("personal email style guide not found at %s and auto-generation failed: %v. Please create the file manually or set OPENAI_API_KEY", toneFilePath, err)
+	}
+
+	log.Println("✅ Personal email style guide auto-generated successfully!")
+	return nil
+}
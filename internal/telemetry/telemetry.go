@@ -0,0 +1,309 @@
+// Package telemetry collects anonymous usage statistics when the user opts in with
+// GMAIL_MCP_TELEMETRY=1: how often each tool is called and which categories of
+// error it returns. It never records arguments, results, addresses, IDs or any
+// other content. Counts are buffered in telemetry.json in the app data directory
+// and, when GMAIL_MCP_TELEMETRY_URL is set, uploaded there once a day.
+package telemetry
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"runtime"
+	"sync"
+	"time"
+
+	"auto-gmail/internal/config"
+	"auto-gmail/internal/toolerr"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+const (
+	// uploadInterval is how often buffered counts are sent
+	uploadInterval = 24 * time.Hour
+	// saveInterval is how often counts are written to the buffer file
+	saveInterval  = time.Minute
+	uploadTimeout = 15 * time.Second
+)
+
+// Collected describes exactly what is recorded, for telemetry_status and the README
+const Collected = "tool names, call counts and error categories, with the server version, OS and an install ID that is random and not derived from your account; never arguments, results, email content, addresses or IDs"
+
+// ToolCounts are one tool's counters
+type ToolCounts struct {
+	Calls int `json:"calls"`
+	// Errors counts failed calls by error category (see package toolerr)
+	Errors map[toolerr.Category]int `json:"errors,omitempty"`
+}
+
+// Report is what is buffered and uploaded
+type Report struct {
+	InstallID string                 `json:"installId"`
+	Version   string                 `json:"version"`
+	OS        string                 `json:"os"`
+	Arch      string                 `json:"arch"`
+	Since     time.Time              `json:"since"`
+	Tools     map[string]*ToolCounts `json:"tools"`
+}
+
+// buffer is the telemetry file
+type buffer struct {
+	Report      Report    `json:"report"`
+	LastAttempt time.Time `json:"lastAttempt,omitempty"`
+	LastUpload  time.Time `json:"lastUpload,omitempty"`
+	LastError   string    `json:"lastError,omitempty"`
+}
+
+// Telemetry records tool usage when enabled; a disabled Telemetry records nothing
+type Telemetry struct {
+	enabled  bool
+	endpoint string
+	path     string
+
+	mu    sync.Mutex
+	state buffer
+	dirty bool
+}
+
+var (
+	defaultOnce      sync.Once
+	defaultTelemetry *Telemetry
+)
+
+// Default returns the process-wide telemetry, configured from the environment on
+// first use. When enabled it starts saving and uploading in the background.
+func Default() *Telemetry {
+	defaultOnce.Do(func() {
+		defaultTelemetry = fromEnv()
+		if defaultTelemetry.enabled {
+			go defaultTelemetry.run()
+		}
+	})
+	return defaultTelemetry
+}
+
+// fromEnv reads GMAIL_MCP_TELEMETRY and GMAIL_MCP_TELEMETRY_URL and loads the buffer.
+// Opting out deletes anything buffered earlier.
+func fromEnv() *Telemetry {
+	t := &Telemetry{
+		enabled:  os.Getenv("GMAIL_MCP_TELEMETRY") == "1",
+		endpoint: os.Getenv("GMAIL_MCP_TELEMETRY_URL"),
+		path:     config.AppFilePath("telemetry.json"),
+	}
+	if !t.enabled {
+		if err := os.Remove(t.path); err == nil {
+			log.Printf("📊 Telemetry is off; deleted the counts buffered in %s", t.path)
+		}
+		return t
+	}
+
+	if data, err := os.ReadFile(t.path); err == nil {
+		if err := json.Unmarshal(data, &t.state); err != nil {
+			log.Printf("Warning: Invalid telemetry buffer %s, starting over: %v", t.path, err)
+			t.state = buffer{}
+		}
+	}
+	if t.state.Report.InstallID == "" {
+		id := make([]byte, 8)
+		rand.Read(id)
+		t.state.Report.InstallID = hex.EncodeToString(id)
+		t.state.Report.Since = time.Now().UTC()
+		t.dirty = true
+	}
+	if t.state.Report.Tools == nil {
+		t.state.Report.Tools = map[string]*ToolCounts{}
+	}
+	t.state.Report.Version = config.Version
+	t.state.Report.OS = runtime.GOOS
+	t.state.Report.Arch = runtime.GOARCH
+
+	destination := "kept locally (set GMAIL_MCP_TELEMETRY_URL to upload them)"
+	if t.endpoint != "" {
+		destination = "uploaded daily to " + t.endpoint
+	}
+	log.Printf("📊 Anonymous usage telemetry is on: counts are buffered in %s and %s", t.path, destination)
+	return t
+}
+
+// Enabled reports whether the user opted in
+func (t *Telemetry) Enabled() bool {
+	return t != nil && t.enabled
+}
+
+// Middleware counts each tool call and the category of its error, if any. Install
+// it outside toolerr's middleware so it sees the final error envelope.
+func (t *Telemetry) Middleware() server.ToolHandlerMiddleware {
+	return func(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+		if !t.Enabled() {
+			return next
+		}
+		return func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			result, err := next(ctx, req)
+			var category toolerr.Category
+			switch {
+			case err != nil:
+				category = toolerr.Classify(err).Category
+			case result != nil && result.IsError:
+				category = toolerr.Internal
+				if failure := toolerr.FromResult(result); failure != nil {
+					category = failure.Category
+				}
+			}
+			t.record(req.Params.Name, category)
+			return result, err
+		}
+	}
+}
+
+// record counts one call of tool; category is empty for calls that succeeded
+func (t *Telemetry) record(tool string, category toolerr.Category) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	counts, ok := t.state.Report.Tools[tool]
+	if !ok {
+		counts = &ToolCounts{}
+		t.state.Report.Tools[tool] = counts
+	}
+	counts.Calls++
+	if category != "" {
+		if counts.Errors == nil {
+			counts.Errors = map[toolerr.Category]int{}
+		}
+		counts.Errors[category]++
+	}
+	t.dirty = true
+}
+
+// run saves the buffer every saveInterval and uploads it every uploadInterval
+func (t *Telemetry) run() {
+	for range time.Tick(saveInterval) {
+		t.mu.Lock()
+		due := t.endpoint != "" && time.Since(t.lastAttempt()) >= uploadInterval && len(t.state.Report.Tools) > 0
+		t.mu.Unlock()
+		if due {
+			t.upload()
+		}
+		t.save()
+	}
+}
+
+// lastAttempt is when counting started or an upload was last tried; callers hold mu
+func (t *Telemetry) lastAttempt() time.Time {
+	if t.state.LastAttempt.After(t.state.Report.Since) {
+		return t.state.LastAttempt
+	}
+	return t.state.Report.Since
+}
+
+// upload sends the buffered report. Counting starts over while it is sent, and the
+// sent counts are merged back if the upload fails.
+func (t *Telemetry) upload() {
+	t.mu.Lock()
+	sent := t.state.Report
+	t.state.Report.Tools = map[string]*ToolCounts{}
+	t.mu.Unlock()
+	body, err := json.Marshal(sent)
+	if err != nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), uploadTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.endpoint, bytes.NewReader(body))
+	if err == nil {
+		req.Header.Set("Content-Type", "application/json")
+		var resp *http.Response
+		if resp, err = http.DefaultClient.Do(req); err == nil {
+			resp.Body.Close()
+			if resp.StatusCode >= 300 {
+				err = fmt.Errorf("server returned %s", resp.Status)
+			}
+		}
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.dirty = true
+	t.state.LastAttempt = time.Now().UTC()
+	if err != nil {
+		// Keep buffering; the next attempt is an upload interval later
+		t.state.LastError = err.Error()
+		for tool, counts := range sent.Tools {
+			merged, ok := t.state.Report.Tools[tool]
+			if !ok {
+				t.state.Report.Tools[tool] = counts
+				continue
+			}
+			merged.Calls += counts.Calls
+			for category, n := range counts.Errors {
+				if merged.Errors == nil {
+					merged.Errors = map[toolerr.Category]int{}
+				}
+				merged.Errors[category] += n
+			}
+		}
+		return
+	}
+	t.state.LastError = ""
+	t.state.LastUpload = t.state.LastAttempt
+	t.state.Report.Since = t.state.LastUpload
+}
+
+// save writes the buffer file when counts changed
+func (t *Telemetry) save() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.dirty {
+		return
+	}
+	data, err := json.MarshalIndent(t.state, "", "  ")
+	if err != nil {
+		return
+	}
+	if err := os.WriteFile(t.path, data, 0600); err != nil {
+		log.Printf("Warning: Could not save telemetry buffer %s: %v", t.path, err)
+		return
+	}
+	t.dirty = false
+}
+
+// Status describes the telemetry settings and shows exactly what is buffered
+func (t *Telemetry) Status() map[string]interface{} {
+	status := map[string]interface{}{
+		"enabled":   t.Enabled(),
+		"collected": Collected,
+	}
+	if !t.Enabled() {
+		status["howToEnable"] = "Set GMAIL_MCP_TELEMETRY=1 to share anonymous usage counts; nothing is collected until then"
+		return status
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	status["bufferFile"] = t.path
+	// Marshalled now, since the counts keep changing after the lock is released
+	pending, _ := json.Marshal(t.state.Report)
+	status["pending"] = json.RawMessage(pending)
+	if t.endpoint == "" {
+		status["upload"] = "off: counts stay in the buffer file until GMAIL_MCP_TELEMETRY_URL is set"
+	} else {
+		status["uploadUrl"] = t.endpoint
+		status["nextUpload"] = t.lastAttempt().Add(uploadInterval).Format(time.RFC3339)
+	}
+	if !t.state.LastUpload.IsZero() {
+		status["lastUpload"] = t.state.LastUpload.Format(time.RFC3339)
+	}
+	if t.state.LastError != "" {
+		status["lastError"] = t.state.LastError
+	}
+	status["howToDisable"] = "Unset GMAIL_MCP_TELEMETRY (or set it to 0) and restart; the buffer file is then deleted"
+	return status
+}
@@ -0,0 +1,335 @@
+// Package toolerr gives every tool error the same shape, so agents can branch on
+// failures instead of parsing messages. An error result's text is a JSON envelope:
+//
+//	{"error": {"code": "not_found", "category": "not_found", "message": "...", "retryable": false, "hint": "..."}}
+package toolerr
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"auto-gmail/internal/requestid"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"golang.org/x/oauth2"
+	"google.golang.org/api/googleapi"
+)
+
+// Category is the broad kind of failure an agent branches on
+type Category string
+
+const (
+	// Auth means the user must sign in again or lacks permission
+	Auth Category = "auth"
+	// Quota means a rate limit or quota was hit; the call can be retried later
+	Quota Category = "quota"
+	// NotFound means a message, thread, attachment or named item doesn't exist
+	NotFound Category = "not_found"
+	// InvalidInput means the arguments must be changed before calling again
+	InvalidInput Category = "invalid_input"
+	// ParseFailure means content (an attachment, a file, a model response) couldn't be read
+	ParseFailure Category = "parse_failure"
+	// Unavailable means Gmail or another dependency couldn't be reached; retry shortly
+	Unavailable Category = "unavailable"
+	// Internal is everything else
+	Internal Category = "internal"
+)
+
+// defaultHints say what to do about each category when the error has no better hint
+var defaultHints = map[Category]string{
+	Auth:         "Call the authenticate tool and complete the sign-in, then retry.",
+	Quota:        "Wait a minute, then retry with fewer or smaller calls.",
+	NotFound:     "Check the ID or name; search again to get current message, thread and attachment IDs.",
+	InvalidInput: "Fix the arguments as the message describes and call again.",
+	ParseFailure: "The content couldn't be read; open it in Gmail instead.",
+	Unavailable:  "Gmail or a service the tool depends on is unreachable; retry shortly.",
+}
+
+// Error is the envelope of a failed tool call
+type Error struct {
+	// Code is a stable, specific identifier such as "rate_limited" or "missing_argument"
+	Code      string   `json:"code"`
+	Category  Category `json:"category"`
+	Message   string   `json:"message"`
+	Retryable bool     `json:"retryable"`
+	Hint      string   `json:"hint,omitempty"`
+	// Details carries data the agent needs to recover, such as the choices it has
+	Details map[string]interface{} `json:"details,omitempty"`
+	// RequestID identifies the call in the server logs, for reporting problems
+	RequestID string `json:"requestId,omitempty"`
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// New creates an error of category with the category's default hint; only quota
+// and unavailability errors are retryable as-is
+func New(category Category, code, message string) *Error {
+	return &Error{
+		Code:      code,
+		Category:  category,
+		Message:   message,
+		Retryable: category == Quota || category == Unavailable,
+		Hint:      defaultHints[category],
+	}
+}
+
+// WithHint replaces the remediation hint
+func (e *Error) WithHint(hint string) *Error {
+	e.Hint = hint
+	return e
+}
+
+// Result returns the error as a tool error result
+func (e *Error) Result() *mcp.CallToolResult {
+	envelope, _ := json.MarshalIndent(map[string]*Error{"error": e}, "", "  ")
+	return mcp.NewToolResultError(string(envelope))
+}
+
+// Coded is implemented by errors that know their own category and code. They may
+// also have an ErrorHint() string method with a more specific hint.
+type Coded interface {
+	ErrorCode() (Category, string)
+}
+
+// coded is an error made by Errorf
+type coded struct {
+	category Category
+	code     string
+	err      error
+}
+
+// Errorf formats an error like fmt.Errorf, wrapping any %w operand, that is reported
+// with category and code. It is for errors returned through functions that don't
+// build tool results themselves.
+func Errorf(category Category, code, format string, args ...interface{}) error {
+	return &coded{category: category, code: code, err: fmt.Errorf(format, args...)}
+}
+
+func (e *coded) Error() string {
+	return e.err.Error()
+}
+
+func (e *coded) Unwrap() error {
+	return e.err
+}
+
+// ErrorCode implements Coded
+func (e *coded) ErrorCode() (Category, string) {
+	return e.category, e.code
+}
+
+// Result classifies err and returns it as a tool error result. A non-empty prefix
+// goes before the message, as in "Failed to get message: <err>".
+func Result(err error, prefix string) *mcp.CallToolResult {
+	classified := Classify(err)
+	if prefix != "" {
+		classified.Message = prefix + ": " + classified.Message
+	}
+	return classified.Result()
+}
+
+// Invalid returns an invalid_input result, for arguments the tool can't use
+func Invalid(message string) *mcp.CallToolResult {
+	return New(InvalidInput, "invalid_argument", message).Result()
+}
+
+// Classify works out the category of err from its type: coded errors, Gmail API
+// status codes, OAuth token errors, network failures and cancellation. Errors without
+// a telling type fall back to FromText.
+func Classify(err error) *Error {
+	if err == nil {
+		return New(Internal, "unknown", "unknown error")
+	}
+	message := err.Error()
+
+	var classified *Error
+	if errors.As(err, &classified) {
+		copied := *classified
+		copied.Message = message
+		return &copied
+	}
+	var coded Coded
+	if errors.As(err, &coded) {
+		category, code := coded.ErrorCode()
+		classified = New(category, code, message)
+		if hinted, ok := coded.(interface{ ErrorHint() string }); ok {
+			classified.Hint = hinted.ErrorHint()
+		}
+		return classified
+	}
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) {
+		return fromStatus(apiErr.Code, apiErr.Errors, message)
+	}
+	var tokenErr *oauth2.RetrieveError
+	if errors.As(err, &tokenErr) {
+		return New(Auth, "token_refresh_failed", message).
+			WithHint("The saved Google sign-in is no longer valid. Call the authenticate tool to sign in again, then retry.")
+	}
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return New(Unavailable, "timeout", message)
+	case errors.Is(err, context.Canceled):
+		return New(Internal, "cancelled", message).WithHint("The request was cancelled; call again if it is still needed.")
+	}
+	var corrupt base64.CorruptInputError
+	var syntaxErr *json.SyntaxError
+	if errors.As(err, &corrupt) || errors.As(err, &syntaxErr) {
+		return New(ParseFailure, "decode_failed", message)
+	}
+	var netErr net.Error
+	var urlErr *url.Error
+	if errors.As(err, &netErr) || errors.As(err, &urlErr) {
+		return New(Unavailable, "network_error", message)
+	}
+	return FromText(message)
+}
+
+// fromStatus classifies a Gmail API (or Gmail-like provider) error by HTTP status
+// and, for 403s, by Google's reason
+func fromStatus(status int, reasons []googleapi.ErrorItem, message string) *Error {
+	switch {
+	case status == http.StatusUnauthorized:
+		return New(Auth, "unauthenticated", message)
+	case status == http.StatusForbidden:
+		for _, reason := range reasons {
+			switch reason.Reason {
+			case "rateLimitExceeded", "userRateLimitExceeded":
+				return New(Quota, "rate_limited", message)
+			case "dailyLimitExceeded", "quotaExceeded":
+				return New(Quota, "quota_exceeded", message).WithHint("The daily Gmail API quota is used up; retry tomorrow or raise the quota in Google Cloud Console.")
+			}
+		}
+		return New(Auth, "permission_denied", message).
+			WithHint("The sign-in lacks permission for this; delete the token file and call the authenticate tool to grant the current scopes.")
+	case status == http.StatusNotFound:
+		return New(NotFound, "not_found", message)
+	case status == http.StatusTooManyRequests:
+		return New(Quota, "rate_limited", message)
+	case status == http.StatusConflict:
+		return New(InvalidInput, "conflict", message).WithHint("Something with that name already exists; pick another name or use the existing one.")
+	case status == http.StatusNotImplemented:
+		return New(InvalidInput, "unsupported", message).WithHint("This mail provider doesn't support the operation.")
+	case status >= 500:
+		return New(Unavailable, "gmail_unavailable", message)
+	case status >= 400:
+		return New(InvalidInput, "invalid_request", message)
+	}
+	return New(Internal, "gmail_error", message)
+}
+
+// statusInMessage finds a status code in wrapped Gmail API error text, such as
+// "googleapi: Error 404: Requested entity was not found."
+var statusInMessage = regexp.MustCompile(`googleapi: Error (\d{3})`)
+
+// textRule classifies messages containing any of its phrases
+type textRule struct {
+	phrases  []string
+	category Category
+	code     string
+}
+
+// textRules are checked in order, so more specific phrases come first
+var textRules = []textRule{
+	{[]string{"authentication required", "not authenticated", "authentication is in progress", "unauthorized", "invalid_grant", "token has been expired"}, Auth, "not_authenticated"},
+	{[]string{"rate limit exceeded", "ratelimitexceeded", "too many requests"}, Quota, "rate_limited"},
+	{[]string{"server busy"}, Quota, "server_busy"},
+	{[]string{"send limit", "quota"}, Quota, "quota_exceeded"},
+	{[]string{"timed out", "deadline exceeded"}, Unavailable, "timeout"},
+	{[]string{"unavailable", "connection refused", "no such host"}, Unavailable, "unavailable"},
+	{[]string{"cancelled", "canceled"}, Internal, "cancelled"},
+	{[]string{"too large"}, InvalidInput, "too_large"},
+	{[]string{"refused to extract", "malware"}, InvalidInput, "refused"},
+	{[]string{"failed to parse", "failed to decode", "failed to extract", "extraction failed", "couldn't parse", "invalid json", "malformed", "unsupported file type", "can't convert", "no text could be extracted"}, ParseFailure, "parse_failed"},
+	{[]string{"required argument", "parameter is required", "is required", "not a string"}, InvalidInput, "missing_argument"},
+	{[]string{"not found", "no saved search named", "no recipient group named", "has no messages", "no such", "unknown"}, NotFound, "not_found"},
+	{[]string{"invalid", "can only", "at most", "allowed", "too long", "must", "use one of", "empty"}, InvalidInput, "invalid_argument"},
+}
+
+// FromText classifies a plain error message by the phrases in it. It is the last
+// resort for errors that carry no type, such as those of other libraries, and logs
+// every message it sees so the errors behind them can be given a type.
+func FromText(message string) *Error {
+	log.Printf("toolerr: classifying an untyped error by its text: %s", message)
+	if match := statusInMessage.FindStringSubmatch(message); match != nil {
+		status, _ := strconv.Atoi(match[1])
+		return fromStatus(status, nil, message)
+	}
+	lower := strings.ToLower(message)
+	for _, rule := range textRules {
+		for _, phrase := range rule.phrases {
+			if strings.Contains(lower, phrase) {
+				return New(rule.category, rule.code, message)
+			}
+		}
+	}
+	return New(Internal, "tool_failed", message)
+}
+
+// parseEnvelope returns the error in text if it is already an envelope
+func parseEnvelope(text string) *Error {
+	var envelope struct {
+		Error *Error `json:"error"`
+	}
+	if !strings.HasPrefix(strings.TrimSpace(text), "{") || json.Unmarshal([]byte(text), &envelope) != nil || envelope.Error == nil || envelope.Error.Category == "" {
+		return nil
+	}
+	return envelope.Error
+}
+
+// FromResult returns the envelope of an error result, or nil if result isn't one
+func FromResult(result *mcp.CallToolResult) *Error {
+	if result == nil || !result.IsError {
+		return nil
+	}
+	var texts []string
+	for _, content := range result.Content {
+		if text, ok := mcp.AsTextContent(content); ok {
+			texts = append(texts, text.Text)
+		}
+	}
+	return parseEnvelope(strings.Join(texts, "\n"))
+}
+
+// Middleware turns every error a tool reports, as an error result or a Go error,
+// into an envelope carrying the call's request ID. Install it outside all other
+// tool middleware except requestid's, so errors such as rate limits are converted too.
+func Middleware() server.ToolHandlerMiddleware {
+	return func(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+		return func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			result, err := next(ctx, req)
+			var failure *Error
+			switch {
+			case err != nil:
+				failure = Classify(err)
+			case result == nil || !result.IsError:
+				return result, nil
+			default:
+				if failure = FromResult(result); failure == nil {
+					var texts []string
+					for _, content := range result.Content {
+						if text, ok := mcp.AsTextContent(content); ok {
+							texts = append(texts, text.Text)
+						}
+					}
+					failure = FromText(strings.Join(texts, "\n"))
+				}
+			}
+			failure.RequestID = requestid.FromContext(ctx)
+			return failure.Result(), nil
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package toolerr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestClassify(t *testing.T) {
+	sentinel := errors.New("extraction failed: malformed file")
+	tests := []struct {
+		name         string
+		err          error
+		wantCategory Category
+		wantCode     string
+	}{
+		{"coded", Errorf(NotFound, "label_not_found", "no label named %q", "Receipts"), NotFound, "label_not_found"},
+		{"coded and wrapped", fmt.Errorf("Failed to extract text: %w", Errorf(ParseFailure, "malformed_file", "%w: a.pdf", sentinel)), ParseFailure, "malformed_file"},
+		{"envelope error", New(Quota, "server_busy", "Server busy"), Quota, "server_busy"},
+		{"deadline", fmt.Errorf("gave up waiting: %w", context.DeadlineExceeded), Unavailable, "timeout"},
+		{"status in text", errors.New("googleapi: Error 404: Requested entity was not found."), NotFound, "not_found"},
+		{"untyped", errors.New("something odd happened"), Internal, "tool_failed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Classify(tt.err)
+			if got.Category != tt.wantCategory || got.Code != tt.wantCode {
+				t.Errorf("Classify() = %s/%s, want %s/%s", got.Category, got.Code, tt.wantCategory, tt.wantCode)
+			}
+			if got.Message != tt.err.Error() {
+				t.Errorf("Classify() message = %q, want %q", got.Message, tt.err.Error())
+			}
+		})
+	}
+}
+
+func TestErrorfWraps(t *testing.T) {
+	sentinel := errors.New("sentinel")
+	if err := Errorf(ParseFailure, "malformed_file", "%w: a.pdf", sentinel); !errors.Is(err, sentinel) {
+		t.Errorf("errors.Is(%v, sentinel) = false, want true", err)
+	}
+}
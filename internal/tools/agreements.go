@@ -0,0 +1,352 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"google.golang.org/api/gmail/v1"
+
+	"auto-gmail/internal/config"
+	"auto-gmail/internal/extract"
+	"auto-gmail/internal/toolerr"
+)
+
+// Agreement log limits
+const (
+	// maxAgreements caps how many entries one decision log lists
+	maxAgreements = 150
+	// agreementStatementChars caps the statement quoted with each entry
+	agreementStatementChars = 300
+)
+
+// agreementPatterns classify a sentence, checked in order so "we can't accept" is a
+// rejection rather than an acceptance
+var agreementPatterns = []struct {
+	kind    string
+	pattern *regexp.Regexp
+}{
+	{"rejected", regexp.MustCompile(`(?i)\b(?:can(?:no|')t (?:accept|agree)|unable to (?:accept|agree)|not able to (?:accept|agree)|(?:we|i) (?:must|have to|will|'ll|'d have to) decline|(?:we|i) decline|declined|reject(?:ed)?|(?:doesn't|does not|won't|will not) work for (?:us|me)|no deal|too high for (?:us|me))\b`)},
+	{"decided", regexp.MustCompile(`(?i)\b(?:(?:we|i)(?:'ve| have)? decided|the decision is|(?:our|my) final decision|(?:we|i)(?:'ll| will| are|'re) (?:be )?moving forward with|(?:we|i)(?:'re| are| am|'m) going (?:ahead )?with)\b`)},
+	{"agreed", regexp.MustCompile(`(?i)\b(?:(?:we|i) (?:fully )?agree|agreed|(?:we|i) accept|(?:we|i)(?:'re| are| am|'m)? happy to (?:proceed|accept|go ahead)|(?:we|i) approve|approved|sounds good|works for (?:us|me)|that works|it's a deal|(?:we|i) confirm|confirmed|let's (?:go|proceed) with|(?:we'll|we will|i'll|i will) go with|go ahead|(?:i've|we've|have|has) (?:now )?(?:signed|countersigned))\b`)},
+	{"proposed", regexp.MustCompile(`(?i)\b(?:(?:we|i)(?: would|'d)? like to propose|(?:we|i) propose|(?:our|my|a|the) (?:revised |updated |new )?(?:proposal|offer|quote|price|rate|terms) (?:is|are|would be|will be|of)|(?:we|i) (?:can|could) offer|counter[- ]?(?:offer|proposal)|how about|would you (?:accept|consider|agree)|(?:we|i) (?:suggest|recommend)|what if we|(?:we|i) (?:can|could) do)\b`)},
+}
+
+// agreementConditionPattern marks an entry that only holds under a condition
+var agreementConditionPattern = regexp.MustCompile(`(?i)\b(?:provided(?: that)?|on (?:the )?condition|as long as|subject to|contingent (?:on|upon)|assuming)\b`)
+
+// paragraphPattern separates paragraphs: a blank line
+var paragraphPattern = regexp.MustCompile(`\n\s*\n`)
+
+// sentenceEndPattern ends a sentence, without splitting "$1,200.50" or "v2.1"
+var sentenceEndPattern = regexp.MustCompile(`[.!?]+(?:\s+|$)`)
+
+// agreement is one entry of a decision log: a proposal, agreement, rejection or decision
+type agreement struct {
+	ID int `json:"id"`
+	// Kind is proposed, agreed, rejected or decided
+	Kind string `json:"kind"`
+	// Who is "you" for the user, otherwise the sender's name
+	Who         string   `json:"who"`
+	From        string   `json:"from"`
+	Date        string   `json:"date"`
+	Statement   string   `json:"statement"`
+	Terms       []string `json:"terms,omitempty"`
+	Conditional bool     `json:"conditional,omitempty"`
+	// RespondsTo is the ID of the other side's proposal an agreement or rejection answers
+	RespondsTo int `json:"respondsTo,omitempty"`
+	// Outcome is accepted, rejected, countered or open for proposals
+	Outcome   string `json:"outcome,omitempty"`
+	Subject   string `json:"subject"`
+	MessageID string `json:"messageId"`
+	ThreadID  string `json:"threadId"`
+	Link      string `json:"link,omitempty"`
+
+	party        string
+	internalDate int64
+}
+
+// SummarizeAgreements builds a decision log for a thread, or for every thread of a
+// tracked project: who proposed, agreed to, rejected or decided what and when, each
+// entry citing the message it comes from. Agreements and rejections are linked to the
+// other side's proposal they answer, and proposals nobody answered are listed as open.
+func (g *GmailServer) SummarizeAgreements(ctx context.Context, threadID, projectName string) (*mcp.CallToolResult, error) {
+	threadID, projectName = strings.TrimSpace(threadID), ProjectName(projectName)
+	if (threadID == "") == (projectName == "") {
+		return toolerr.Invalid("Give either thread_id or project"), nil
+	}
+
+	var threads []*gmail.Thread
+	scope := "thread " + threadID
+	if threadID != "" {
+		thread, err := g.getThread(ctx, threadID, 0)
+		if err != nil {
+			return toolerr.Result(err, "Failed to get thread"), nil
+		}
+		threads = append(threads, thread)
+	} else {
+		scope = "project " + projectName
+		g.projectsMu.Lock()
+		projects, err := g.loadProjects()
+		g.projectsMu.Unlock()
+		if err != nil {
+			return toolerr.Result(err, "Failed to read projects"), nil
+		}
+		p, ok := projects[projectName]
+		if !ok {
+			return toolerr.New(toolerr.NotFound, "project_not_found", fmt.Sprintf("No project named %q", projectName)).
+				WithHint("Create it with track_project, or list projects with track_project action list.").Result(), nil
+		}
+		listed, err := g.projectThreadList(ctx, p)
+		if err != nil {
+			return toolerr.Result(err, "Failed to list the project's threads"), nil
+		}
+		if len(listed) > projectThreadLimit {
+			listed = listed[:projectThreadLimit]
+		}
+		hydrated := g.hydrateThreads(ctx, listed)
+		for _, thread := range listed {
+			if detail, ok := hydrated[thread.Id]; ok && len(detail.Messages) > 0 {
+				threads = append(threads, detail)
+			}
+		}
+	}
+
+	me := g.userEmail(ctx)
+	var entries []*agreement
+	for _, thread := range threads {
+		entries = append(entries, threadAgreements(thread, me)...)
+	}
+	// Threads in the order their negotiations started, each thread's entries in order
+	start := map[string]int64{}
+	for _, entry := range entries {
+		if first, ok := start[entry.ThreadID]; !ok || entry.internalDate < first {
+			start[entry.ThreadID] = entry.internalDate
+		}
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].ThreadID != entries[j].ThreadID {
+			return start[entries[i].ThreadID] < start[entries[j].ThreadID]
+		}
+		return entries[i].internalDate < entries[j].internalDate
+	})
+	truncated := len(entries) > maxAgreements
+	if truncated {
+		entries = entries[:maxAgreements]
+	}
+	linkAgreements(entries)
+
+	counts := map[string]int{}
+	var open []int
+	for _, entry := range entries {
+		counts[entry.Kind]++
+		if entry.Outcome == "open" {
+			open = append(open, entry.ID)
+		}
+	}
+	result := map[string]interface{}{
+		"scope":         scope,
+		"threads":       len(threads),
+		"counts":        counts,
+		"entries":       entries,
+		"openProposals": open,
+		"log":           agreementLog(scope, entries),
+	}
+	if len(entries) == 0 {
+		result["note"] = "No proposals, agreements, rejections or decisions were found in the text of these messages."
+	}
+	if truncated {
+		result["truncated"] = fmt.Sprintf("Only the first %d entries are listed; summarize single threads for the rest.", maxAgreements)
+	}
+
+	resultJSON, _ := json.MarshalIndent(result, "", "  ")
+	return mcp.NewToolResultText(string(resultJSON)), nil
+}
+
+// threadAgreements classifies the sentences each person wrote in a thread, leaving out
+// quoted replies, drafts and automated mail
+func threadAgreements(thread *gmail.Thread, me string) []*agreement {
+	subject := "(no subject)"
+	if len(thread.Messages) > 0 {
+		if s := stripSubjectPrefixes(messageHeader(thread.Messages[0], "Subject")); s != "" {
+			subject = s
+		}
+	}
+	var entries []*agreement
+	for _, message := range thread.Messages {
+		if message.Payload == nil || hasLabelID(message, "DRAFT") || isAutomated(message) {
+			continue
+		}
+		from := messageHeader(message, "From")
+		party, who := strings.ToLower(senderAddress(from)), displayName(from)
+		if hasLabelID(message, "SENT") || (me != "" && strings.EqualFold(party, me)) {
+			party, who = "", "you"
+		}
+		seen := map[string]bool{}
+		for _, sentence := range splitSentences(stripQuotedText(extract.EmailBody(message))) {
+			kind := classifyAgreement(sentence)
+			if kind == "" || seen[sentence] {
+				continue
+			}
+			seen[sentence] = true
+			statement := sentence
+			if len(statement) > agreementStatementChars {
+				statement = truncateText(statement, agreementStatementChars) + "…"
+			}
+			entry := &agreement{
+				Kind:         kind,
+				Who:          who,
+				From:         from,
+				Date:         formatInternalDate(message.InternalDate),
+				Statement:    statement,
+				Terms:        agreementTerms(sentence),
+				Conditional:  agreementConditionPattern.MatchString(sentence),
+				Subject:      subject,
+				MessageID:    message.Id,
+				ThreadID:     thread.Id,
+				party:        party,
+				internalDate: message.InternalDate,
+			}
+			if config.Provider() == "gmail" {
+				entry.Link = "https://mail.google.com/mail/#all/" + message.Id
+			}
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// classifyAgreement is the kind of entry a sentence makes, or "" for none. A question
+// ("Is $5,000 agreed?") is a proposal, whatever words it uses.
+func classifyAgreement(sentence string) string {
+	for _, p := range agreementPatterns {
+		if p.pattern.MatchString(sentence) {
+			if p.kind != "proposed" && strings.HasSuffix(sentence, "?") {
+				return "proposed"
+			}
+			return p.kind
+		}
+	}
+	return ""
+}
+
+// agreementTerms are the amounts and dates a sentence names
+func agreementTerms(sentence string) []string {
+	entities := extract.ExtractEntities(sentence)
+	var terms []string
+	for _, amount := range entities.Amounts {
+		terms = append(terms, amount.Text)
+	}
+	for _, date := range entities.Dates {
+		terms = append(terms, date.Date)
+	}
+	return terms
+}
+
+// linkAgreements numbers the entries, points each agreement or rejection at the other
+// side's latest proposal before it in the same thread, and marks proposals accepted,
+// rejected, countered or still open
+func linkAgreements(entries []*agreement) {
+	for i, entry := range entries {
+		entry.ID = i + 1
+	}
+	for i, entry := range entries {
+		if entry.Kind == "proposed" {
+			entry.Outcome = "open"
+			continue
+		}
+		if entry.Kind != "agreed" && entry.Kind != "rejected" {
+			continue
+		}
+		for j := i - 1; j >= 0; j-- {
+			proposal := entries[j]
+			if proposal.ThreadID != entry.ThreadID || proposal.party == entry.party || proposal.Kind != "proposed" {
+				continue
+			}
+			entry.RespondsTo = proposal.ID
+			proposal.Outcome = map[string]string{"agreed": "accepted", "rejected": "rejected"}[entry.Kind]
+			break
+		}
+	}
+	// A later proposal from the other side answers an open one too, as a counter-offer
+	for i, entry := range entries {
+		if entry.Outcome != "open" {
+			continue
+		}
+		for _, later := range entries[i+1:] {
+			if later.ThreadID == entry.ThreadID && later.party != entry.party && later.Kind == "proposed" {
+				entry.Outcome = "countered"
+				if later.RespondsTo == 0 {
+					later.RespondsTo = entry.ID
+				}
+				break
+			}
+		}
+	}
+}
+
+// agreementLog renders the entries as a markdown decision log, one section per thread
+func agreementLog(scope string, entries []*agreement) string {
+	var out strings.Builder
+	fmt.Fprintf(&out, "# Decision Log: %s\n\n", scope)
+	if len(entries) == 0 {
+		out.WriteString("No proposals, agreements or decisions found.\n")
+		return out.String()
+	}
+	thread := ""
+	var open []string
+	for _, entry := range entries {
+		if entry.ThreadID != thread {
+			thread = entry.ThreadID
+			fmt.Fprintf(&out, "\n## %s\n\n", entry.Subject)
+		}
+		verb := entry.Kind
+		if entry.RespondsTo != 0 {
+			verb = fmt.Sprintf("%s (re #%d)", entry.Kind, entry.RespondsTo)
+		}
+		fmt.Fprintf(&out, "%d. **%s** %s %s: \"%s\"", entry.ID, entry.Date, entry.Who, verb, entry.Statement)
+		if entry.Conditional {
+			out.WriteString(" _(conditional)_")
+		}
+		if entry.Outcome != "" {
+			fmt.Fprintf(&out, " → %s", entry.Outcome)
+		}
+		if entry.Link != "" {
+			fmt.Fprintf(&out, " [message](%s)\n", entry.Link)
+		} else {
+			fmt.Fprintf(&out, " (message %s)\n", entry.MessageID)
+		}
+		if entry.Outcome == "open" {
+			open = append(open, fmt.Sprintf("- #%d from %s in \"%s\"", entry.ID, entry.Who, entry.Subject))
+		}
+	}
+	if len(open) > 0 {
+		out.WriteString("\n## Open Proposals\n\n")
+		out.WriteString(strings.Join(open, "\n") + "\n")
+	}
+	return out.String()
+}
+
+// splitSentences splits text into sentences on one line each. Lines of a paragraph are
+// joined first, since plain-text mail wraps sentences across lines.
+func splitSentences(text string) []string {
+	var sentences []string
+	for _, paragraph := range paragraphPattern.Split(text, -1) {
+		paragraph = strings.Join(strings.Fields(paragraph), " ")
+		for paragraph != "" {
+			end := len(paragraph)
+			if loc := sentenceEndPattern.FindStringIndex(paragraph); loc != nil {
+				end = loc[1]
+			}
+			if sentence := strings.TrimSpace(paragraph[:end]); len(sentence) > 2 {
+				sentences = append(sentences, sentence)
+			}
+			paragraph = paragraph[end:]
+		}
+	}
+	return sentences
+}
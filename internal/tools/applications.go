@@ -0,0 +1,185 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"auto-gmail/internal/config"
+	"auto-gmail/internal/extract"
+	"auto-gmail/internal/toolerr"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"google.golang.org/api/gmail/v1"
+)
+
+// maxApplicationScan caps how many recruiting messages track_applications looks at
+const maxApplicationScan = 200
+
+// applicationKeywords are the subject words searched for recruiting threads, one query each
+var applicationKeywords = []string{"application", "applying", "interview", "position", "role", "opportunity", "offer", "candidate"}
+
+// applicationStages are the pipeline stages from first contact to outcome. A thread
+// is at the furthest stage any of its messages reached.
+var applicationStages = []struct {
+	stage   string
+	pattern *regexp.Regexp
+}{
+	{"outreach", regexp.MustCompile(`(?i)\b(recruiter|your background|your profile|reach(ing)? out|exciting opportunity)\b`)},
+	{"applied", regexp.MustCompile(`(?i)\b(thank you for (applying|your application|your interest)|application (received|submitted)|received your application)\b`)},
+	{"assessment", regexp.MustCompile(`(?i)\b(assessment|coding challenge|take-home|technical test|hackerrank|codility)\b`)},
+	{"interview", regexp.MustCompile(`(?i)\b(interview|phone screen|onsite|on-site|meet the team|schedule a (call|chat|time))\b`)},
+	{"offer", regexp.MustCompile(`(?i)\b(offer letter|pleased to offer|extend (you )?an offer|job offer|compensation package)\b`)},
+	{"rejected", regexp.MustCompile(`(?i)(not (be )?moving forward|decided to (move forward|proceed) with other|position has been filled|not be proceeding|other candidates|unfortunately,? we)`)},
+}
+
+// atsDomains are applicant tracking systems that send mail on a company's behalf
+var atsDomains = []string{"greenhouse.io", "lever.co", "myworkday.com", "myworkdayjobs.com", "smartrecruiters.com", "ashbyhq.com", "icims.com", "jobvite.com", "workable.com", "linkedin.com"}
+
+var (
+	roleAtCompany   = regexp.MustCompile(`(?i)\b(?:for|as)\s+(?:applying\s+(?:for|to)\s+)?(?:the\s+|an?\s+)?(.+?)\s+(?:position|role|opening)?\s*(?:at|with)\s+(.+?)(?:[!.,|-]|$)`)
+	companySuffixes = regexp.MustCompile(`(?i)\s*(recruiting|recruitment|careers|talent( acquisition)?|hiring( team)?|hr|jobs|people( team)?)\s*$`)
+	resumeFilename  = regexp.MustCompile(`(?i)(cv|resume|résumé|curriculum)`)
+)
+
+// application is one row of the pipeline table
+type application struct {
+	Company     string `json:"company"`
+	Role        string `json:"role,omitempty"`
+	Stage       string `json:"stage"`
+	LastContact string `json:"lastContact"`
+	WaitingOn   string `json:"waitingOn"`
+	ResumeSent  bool   `json:"resumeSent,omitempty"`
+	Subject     string `json:"subject"`
+	ThreadID    string `json:"threadId"`
+	lastDate    int64
+}
+
+// TrackApplications finds recruiter and job application threads from the past months
+// and reports each one's company, role, pipeline stage and last contact
+func (g *GmailServer) TrackApplications(ctx context.Context, months int) (*mcp.CallToolResult, error) {
+	if months <= 0 {
+		months = 6
+	}
+
+	messageIDs, err := g.subjectKeywordMessages(ctx, applicationKeywords, []string{fmt.Sprintf("newer_than:%dm", months)}, maxApplicationScan)
+	if err != nil {
+		return toolerr.Result(err, "Failed to search recruiting emails"), nil
+	}
+	headers := g.hydrateMessageHeaders(ctx, messageIDs, []string{"Subject"})
+	var threads []*gmail.Thread
+	seen := map[string]bool{}
+	for _, id := range messageIDs {
+		if message, ok := headers[id]; ok && !seen[message.ThreadId] {
+			seen[message.ThreadId] = true
+			threads = append(threads, &gmail.Thread{Id: message.ThreadId})
+		}
+	}
+	details := g.hydrateThreads(ctx, threads)
+
+	applications := []application{}
+	stageCounts := map[string]int{}
+	for _, thread := range threads {
+		detail, ok := details[thread.Id]
+		if !ok || len(detail.Messages) == 0 {
+			continue
+		}
+		if app, ok := trackApplication(detail); ok {
+			applications = append(applications, app)
+			stageCounts[app.Stage]++
+		}
+	}
+	sort.SliceStable(applications, func(i, j int) bool {
+		return applications[i].lastDate > applications[j].lastDate
+	})
+
+	var table strings.Builder
+	table.WriteString("| Company | Role | Stage | Last contact | Waiting on |\n|---|---|---|---|---|\n")
+	for _, app := range applications {
+		fmt.Fprintf(&table, "| %s | %s | %s | %s | %s |\n", app.Company, app.Role, app.Stage, app.LastContact, app.WaitingOn)
+	}
+
+	result := map[string]interface{}{
+		"months":       months,
+		"threadCount":  len(threads),
+		"applications": applications,
+		"stages":       stageCounts,
+		"table":        table.String(),
+	}
+
+	resultJSON, _ := json.MarshalIndent(result, "", "  ")
+	return mcp.NewToolResultText(string(resultJSON)), nil
+}
+
+// trackApplication reads a recruiting thread; ok is false when no message matches a pipeline stage
+func trackApplication(thread *gmail.Thread) (application, bool) {
+	first := thread.Messages[0]
+	app := application{Subject: messageHeader(first, "Subject"), ThreadID: thread.Id}
+
+	stage := -1
+	var theirs *gmail.Message
+	for _, message := range thread.Messages {
+		if message.InternalDate > app.lastDate {
+			app.lastDate = message.InternalDate
+			app.WaitingOn = "them"
+			if !hasLabelID(message, "SENT") {
+				app.WaitingOn = "you"
+			}
+		}
+		if hasLabelID(message, "SENT") {
+			for _, attachment := range extract.AttachmentInfo(message) {
+				app.ResumeSent = app.ResumeSent || resumeFilename.MatchString(attachment["filename"].(string))
+			}
+			continue
+		}
+		if theirs == nil {
+			theirs = message
+		}
+		text := messageHeader(message, "Subject") + "\n" + extract.EmailBody(message)
+		for i := len(applicationStages) - 1; i > stage; i-- {
+			if applicationStages[i].pattern.MatchString(text) {
+				stage = i
+				break
+			}
+		}
+	}
+	if stage < 0 || theirs == nil {
+		return app, false
+	}
+
+	app.Stage = applicationStages[stage].stage
+	app.LastContact = time.UnixMilli(app.lastDate).In(config.TimeZone()).Format("2006-01-02")
+	app.Company, app.Role = applicationCompany(app.Subject, messageHeader(theirs, "From"))
+	return app, true
+}
+
+// applicationCompany works out the company and role from the subject ("... for Backend
+// Engineer at Acme"), falling back to the sender's name or domain for the company
+func applicationCompany(subject, from string) (company, role string) {
+	if match := roleAtCompany.FindStringSubmatch(stripSubjectPrefixes(subject)); match != nil {
+		role, company = strings.TrimSpace(match[1]), strings.TrimSpace(match[2])
+	}
+	if company != "" {
+		return company, role
+	}
+
+	// ATS senders look like "Acme via Greenhouse" or "Acme Hiring Team"
+	company, _, _ = strings.Cut(vendorName(from), " via ")
+	company = strings.TrimSpace(companySuffixes.ReplaceAllString(company, ""))
+	_, domain, _ := strings.Cut(strings.ToLower(senderAddress(from)), "@")
+	if company == "" || company == domain {
+		company = domain
+		for _, ats := range atsDomains {
+			if domain == ats || strings.HasSuffix(domain, "."+ats) {
+				// The ATS's domain says nothing about the company
+				company = "unknown"
+				break
+			}
+		}
+	}
+	return company, role
+}
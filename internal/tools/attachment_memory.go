@@ -0,0 +1,100 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"sync"
+
+	"auto-gmail/internal/toolerr"
+)
+
+// Attachment memory limits, overridable with GMAIL_MCP_MAX_ATTACHMENT_BYTES and
+// GMAIL_MCP_ATTACHMENT_MEMORY
+const (
+	defaultMaxAttachmentBytes = 20 << 20
+	defaultAttachmentMemory   = 96 << 20
+	// attachmentMemoryFactor estimates the peak memory of handling an attachment from
+	// its size: the base64 download, the decoded bytes and a parser's working copy
+	attachmentMemoryFactor = 3
+)
+
+// attachmentTooLargeError reports an attachment over the extraction size limit
+type attachmentTooLargeError struct {
+	filename    string
+	size, limit int64
+}
+
+func (e *attachmentTooLargeError) Error() string {
+	return fmt.Sprintf("Attachment '%s' is too large to extract (%s, over the %s limit set by GMAIL_MCP_MAX_ATTACHMENT_BYTES); download it from Gmail instead", e.filename, formatBytes(e.size), formatBytes(e.limit))
+}
+
+// ErrorCode classifies the error for the tool error envelope
+func (e *attachmentTooLargeError) ErrorCode() (toolerr.Category, string) {
+	return toolerr.InvalidInput, "attachment_too_large"
+}
+
+// ErrorHint tells the agent not to retry
+func (e *attachmentTooLargeError) ErrorHint() string {
+	return "Don't retry: ask the user to download the attachment from Gmail, or raise GMAIL_MCP_MAX_ATTACHMENT_BYTES."
+}
+
+// maxAttachmentBytes is the largest attachment that is downloaded into memory
+func maxAttachmentBytes() int64 {
+	return int64(envLimit("GMAIL_MCP_MAX_ATTACHMENT_BYTES", defaultMaxAttachmentBytes))
+}
+
+// memoryBudget bounds the attachment bytes held in memory by all tool calls at once.
+// Calls over the budget wait for others to finish instead of growing the process.
+type memoryBudget struct {
+	mu    sync.Mutex
+	used  int64
+	freed chan struct{} // closed and replaced whenever memory is released
+}
+
+// attachmentMemory is shared by every server in the process
+var attachmentMemory = &memoryBudget{freed: make(chan struct{})}
+
+// acquire reserves n bytes, waiting while the budget is used up. A reservation
+// larger than the whole budget is let through once nothing else is held.
+func (b *memoryBudget) acquire(ctx context.Context, n int64) (release func(), err error) {
+	limit := int64(envLimit("GMAIL_MCP_ATTACHMENT_MEMORY", defaultAttachmentMemory))
+	for {
+		b.mu.Lock()
+		if b.used == 0 || b.used+n <= limit {
+			b.used += n
+			b.mu.Unlock()
+			var once sync.Once
+			return func() { once.Do(func() { b.release(n) }) }, nil
+		}
+		freed := b.freed
+		b.mu.Unlock()
+
+		select {
+		case <-freed:
+		case <-ctx.Done():
+			return nil, fmt.Errorf("gave up waiting for memory to download the attachment: %w", ctx.Err())
+		}
+	}
+}
+
+func (b *memoryBudget) release(n int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.used -= n
+	close(b.freed)
+	b.freed = make(chan struct{})
+}
+
+// decodeAttachmentData decodes Gmail's base64url attachment data without first
+// copying the whole string into a byte slice
+func decodeAttachmentData(data string) ([]byte, error) {
+	var decoded bytes.Buffer
+	decoded.Grow(base64.URLEncoding.DecodedLen(len(data)))
+	if _, err := decoded.ReadFrom(base64.NewDecoder(base64.URLEncoding, strings.NewReader(data))); err != nil {
+		return nil, err
+	}
+	return decoded.Bytes(), nil
+}
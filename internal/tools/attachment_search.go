@@ -0,0 +1,159 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"auto-gmail/internal/extract"
+	"auto-gmail/internal/gmailclient"
+	"auto-gmail/internal/toolerr"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"google.golang.org/api/gmail/v1"
+)
+
+// maxAttachmentScan caps how many messages search_attachments inspects
+const maxAttachmentScan = 100
+
+// attachmentFields asks only for what's needed to list attachments (three levels of nested parts)
+const attachmentFields = "id,threadId,internalDate,payload(headers,parts(filename,mimeType,body(attachmentId,size),parts(filename,mimeType,body(attachmentId,size),parts(filename,mimeType,body(attachmentId,size)))))"
+
+// extensionPattern matches filename patterns like "*.pdf" that Gmail can prefilter
+var extensionPattern = regexp.MustCompile(`^\*\.([a-z0-9]+)$`)
+
+// AttachmentFilter narrows search_attachments results; zero values match everything
+type AttachmentFilter struct {
+	Filename string // glob ("*.pdf", "invoice-*") or substring, case-insensitive
+	MimeType string // exact type or prefix ("image/" or "image/*")
+	MinSize  int64  // bytes
+	MaxSize  int64  // bytes
+	After    string // YYYY/MM/DD
+	Before   string // YYYY/MM/DD
+	From     string
+}
+
+// SearchAttachments returns a flat list of attachments matching filter across the mailbox
+func (g *GmailServer) SearchAttachments(ctx context.Context, filter AttachmentFilter, maxResults int) (*mcp.CallToolResult, error) {
+	if maxResults <= 0 {
+		maxResults = 50
+	}
+	filter.Filename = strings.ToLower(strings.TrimSpace(filter.Filename))
+	filter.MimeType = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(filter.MimeType)), "*")
+
+	// Let Gmail do as much of the filtering as it can; the rest is checked per attachment
+	terms := []string{"has:attachment"}
+	if filter.From != "" {
+		terms = append(terms, "from:"+filter.From)
+	}
+	for _, date := range [][2]string{{"after", filter.After}, {"before", filter.Before}} {
+		key, value := date[0], date[1]
+		if value == "" {
+			continue
+		}
+		if _, err := time.Parse("2006/01/02", strings.ReplaceAll(value, "-", "/")); err != nil {
+			return toolerr.Invalid(fmt.Sprintf("Invalid %s date %q: use YYYY/MM/DD", key, value)), nil
+		}
+		terms = append(terms, key+":"+strings.ReplaceAll(value, "-", "/"))
+	}
+	if match := extensionPattern.FindStringSubmatch(filter.Filename); match != nil {
+		terms = append(terms, "filename:"+match[1])
+	}
+	if filter.MinSize > 0 {
+		// A message is always larger than its attachments
+		terms = append(terms, fmt.Sprintf("larger:%d", filter.MinSize))
+	}
+	query := strings.Join(terms, " ")
+
+	messages, err := g.client.ListMessages(ctx, query, maxAttachmentScan)
+	if err != nil {
+		return toolerr.Result(err, "Failed to search messages"), nil
+	}
+	messageIDs := make([]string, len(messages.Messages))
+	for i, msg := range messages.Messages {
+		messageIDs[i] = msg.Id
+	}
+	hydrated := g.hydratePartialMessages(ctx, messageIDs, url.Values{"format": {"full"}, "fields": {attachmentFields}}, gmailclient.GetOptions{Fields: attachmentFields})
+
+	results := []map[string]interface{}{}
+	for _, id := range messageIDs {
+		message, ok := hydrated[id]
+		if !ok {
+			continue
+		}
+		for _, attachment := range extract.AttachmentInfo(message) {
+			if !filter.matches(attachment) {
+				continue
+			}
+			attachment["messageId"] = message.Id
+			attachment["threadId"] = message.ThreadId
+			attachment["from"] = messageHeader(message, "From")
+			attachment["subject"] = messageHeader(message, "Subject")
+			attachment["date"] = formatInternalDate(message.InternalDate)
+			results = append(results, attachment)
+			if len(results) >= maxResults {
+				break
+			}
+		}
+		if len(results) >= maxResults {
+			break
+		}
+	}
+
+	result := map[string]interface{}{
+		"query":           query,
+		"messagesScanned": len(messageIDs),
+		"attachments":     results,
+	}
+	if len(messageIDs) >= maxAttachmentScan && len(results) < maxResults {
+		result["note"] = fmt.Sprintf("Only the %d most recent matching messages were scanned; narrow the filters to search further back.", maxAttachmentScan)
+	}
+
+	resultJSON, _ := json.MarshalIndent(result, "", "  ")
+	return mcp.NewToolResultText(string(resultJSON)), nil
+}
+
+// matches checks the filters Gmail can't apply exactly
+func (f AttachmentFilter) matches(attachment map[string]interface{}) bool {
+	filename := strings.ToLower(attachment["filename"].(string))
+	mimeType := strings.ToLower(attachment["mimeType"].(string))
+	size := attachment["size"].(int64)
+
+	if f.Filename != "" {
+		if strings.ContainsAny(f.Filename, "*?[") {
+			if ok, _ := path.Match(f.Filename, filename); !ok {
+				return false
+			}
+		} else if !strings.Contains(filename, f.Filename) {
+			return false
+		}
+	}
+	if f.MimeType != "" && mimeType != f.MimeType && !(strings.HasSuffix(f.MimeType, "/") && strings.HasPrefix(mimeType, f.MimeType)) {
+		return false
+	}
+	if f.MinSize > 0 && size < f.MinSize {
+		return false
+	}
+	if f.MaxSize > 0 && size > f.MaxSize {
+		return false
+	}
+	return true
+}
+
+// messageHeader returns the first header with the given name, or ""
+func messageHeader(message *gmail.Message, name string) string {
+	if message.Payload == nil {
+		return ""
+	}
+	for _, header := range message.Payload.Headers {
+		if strings.EqualFold(header.Name, name) {
+			return header.Value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,394 @@
+package tools
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"auto-gmail/internal/extract"
+	"auto-gmail/internal/gmailclient"
+	"auto-gmail/internal/scan"
+	"auto-gmail/internal/toolerr"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"google.golang.org/api/gmail/v1"
+)
+
+// ExtractAttachmentText safely extracts text content from an email attachment
+func (g *GmailServer) ExtractAttachmentText(ctx context.Context, messageID, attachmentID string) (*mcp.CallToolResult, error) {
+	// Get the message to extract attachment metadata
+	message, err := g.getMessage(ctx, messageID)
+	if err != nil {
+		return toolerr.Result(err, "Failed to get message"), nil
+	}
+
+	// Debug: Print all attachment IDs found in this message
+	log.Printf("Looking for attachment ID: %s", attachmentID)
+	allAttachments := extract.AttachmentInfo(message)
+	log.Printf("Found %d attachments in message:", len(allAttachments))
+	for i, att := range allAttachments {
+		log.Printf("  Attachment %d: ID=%v, filename=%v", i, att["attachmentId"], att["filename"])
+	}
+
+	// Find the attachment part to get metadata
+	var attachmentPart *gmail.MessagePart
+	extract.FindAttachmentPart(message.Payload.Parts, attachmentID, &attachmentPart)
+
+	if attachmentPart == nil {
+		return toolerr.New(toolerr.NotFound, "attachment_not_found", fmt.Sprintf("Attachment not found in message. Available attachments: %v", allAttachments)).Result(), nil
+	}
+
+	// Get the attachment data
+	data, release, err := g.downloadAttachment(ctx, messageID, attachmentID, attachmentPart)
+	if err != nil {
+		return toolerr.Result(err, ""), nil
+	}
+	defer release()
+
+	// Extract text based on MIME type
+	text, err := extract.TextFromBytes(data, attachmentPart.MimeType, attachmentPart.Filename)
+	if err != nil {
+		return toolerr.Result(err, "Failed to extract text"), nil
+	}
+
+	// Keep the extracted text within the response budget
+	var trimmed string
+	if truncated, cut := newResponseBudget().truncate(text); cut {
+		trimmed = fmt.Sprintf("text truncated from %d to %d chars to fit the response budget", len(text), len(truncated))
+		text = truncated
+	}
+
+	result := map[string]interface{}{
+		"messageId":    messageID,
+		"attachmentId": attachmentID,
+		"filename":     attachmentPart.Filename,
+		"mimeType":     attachmentPart.MimeType,
+		"textContent":  text,
+		"extractedAt":  time.Now().Format(time.RFC3339),
+	}
+	if trimmed != "" {
+		result["trimmed"] = trimmed
+	}
+
+	resultJSON, _ := json.MarshalIndent(result, "", "  ")
+	return mcp.NewToolResultText(string(resultJSON)), nil
+}
+
+// ExtractAttachmentByFilename safely extracts text content from an email attachment by filename
+// This is more reliable than using attachment IDs which are unstable in Gmail API.
+// Extracted text is cached on disk unless forceRefresh is set.
+func (g *GmailServer) ExtractAttachmentByFilename(ctx context.Context, messageID, filename string, forceRefresh bool) (*mcp.CallToolResult, error) {
+	// Get the message to find attachments
+	message, err := g.getMessage(ctx, messageID)
+	if err != nil {
+		return toolerr.Result(err, "Failed to get message"), nil
+	}
+
+	// Find all attachments in the message
+	allAttachments := extract.AttachmentInfo(message)
+
+	// Look for the attachment with matching filename
+	var targetAttachment map[string]interface{}
+	var attachmentPart *gmail.MessagePart
+
+	for _, attachment := range allAttachments {
+		if attachment["filename"] == filename {
+			targetAttachment = attachment
+			attachmentID := attachment["attachmentId"].(string)
+			extract.FindAttachmentPart(message.Payload.Parts, attachmentID, &attachmentPart)
+			break
+		}
+	}
+
+	if targetAttachment == nil {
+		availableFiles := make([]string, 0, len(allAttachments))
+		for _, att := range allAttachments {
+			availableFiles = append(availableFiles, att["filename"].(string))
+		}
+		return toolerr.New(toolerr.NotFound, "attachment_not_found", fmt.Sprintf("Attachment with filename '%s' not found. Available files: %v", filename, availableFiles)).Result(), nil
+	}
+
+	if attachmentPart == nil {
+		return toolerr.New(toolerr.NotFound, "attachment_not_found", fmt.Sprintf("Could not find attachment part for filename '%s'", filename)).Result(), nil
+	}
+
+	attachmentID := targetAttachment["attachmentId"].(string)
+	size := attachmentPart.Body.Size
+
+	// Reuse a previous extraction of the same file unless the caller asked for a fresh one
+	var text string
+	extractedAt := time.Now()
+	cached := false
+	stale := staleAsOf(message.ServerResponse)
+	if entry, ok := g.extractCache.Load(messageID, filename, size); ok && !forceRefresh {
+		text = entry.TextContent
+		extractedAt = entry.ExtractedAt
+		cached = true
+	} else if downloaded, err := g.downloadAttachmentText(ctx, messageID, attachmentID, attachmentPart); err == nil {
+		text = downloaded
+		g.extractCache.Save(&extract.CacheEntry{
+			MessageID:   messageID,
+			Filename:    filename,
+			Size:        size,
+			MimeType:    attachmentPart.MimeType,
+			TextContent: text,
+			ExtractedAt: extractedAt,
+		})
+	} else if entry, ok := g.extractCache.LoadStale(messageID, filename, size); ok && gmailclient.IsUnavailable(err) {
+		// While Gmail is unavailable, an expired extraction beats no answer
+		text = entry.TextContent
+		extractedAt = entry.ExtractedAt
+		cached = true
+		stale = entry.ExtractedAt.UTC().Format(time.RFC3339)
+	} else if tooLarge := (*attachmentTooLargeError)(nil); errors.As(err, &tooLarge) {
+		// Not a failure the agent should retry: point the user at the file instead
+		result := map[string]interface{}{
+			"messageId":    messageID,
+			"filename":     filename,
+			"attachmentId": attachmentID,
+			"mimeType":     attachmentPart.MimeType,
+			"size":         tooLarge.size,
+			"limit":        tooLarge.limit,
+			"tooLarge":     true,
+			"message":      tooLarge.Error(),
+		}
+		resultJSON, _ := json.MarshalIndent(result, "", "  ")
+		return mcp.NewToolResultText(string(resultJSON)), nil
+	} else {
+		return toolerr.Result(err, ""), nil
+	}
+
+	// Keep the extracted text within the response budget
+	var trimmed string
+	if truncated, cut := newResponseBudget().truncate(text); cut {
+		trimmed = fmt.Sprintf("text truncated from %d to %d chars to fit the response budget", len(text), len(truncated))
+		text = truncated
+	}
+
+	result := map[string]interface{}{
+		"messageId":    messageID,
+		"filename":     filename,
+		"attachmentId": attachmentID,
+		"mimeType":     attachmentPart.MimeType,
+		"textContent":  text,
+		"extractedAt":  extractedAt.Format(time.RFC3339),
+		"cached":       cached,
+	}
+	if stale != "" {
+		result["staleAsOf"] = stale
+	}
+	if trimmed != "" {
+		result["trimmed"] = trimmed
+	}
+
+	resultJSON, _ := json.MarshalIndent(result, "", "  ")
+	return mcp.NewToolResultText(string(resultJSON)), nil
+}
+
+// downloadAttachment downloads an attachment and screens it for malware. Attachments
+// over GMAIL_MCP_MAX_ATTACHMENT_BYTES are refused with an attachmentTooLargeError, and
+// downloads wait for room in the process-wide attachment memory budget. Call release
+// once done with the data.
+func (g *GmailServer) downloadAttachment(ctx context.Context, messageID, attachmentID string, part *gmail.MessagePart) (data []byte, release func(), err error) {
+	limit := maxAttachmentBytes()
+	if part.Body != nil && part.Body.Size > limit {
+		return nil, nil, &attachmentTooLargeError{filename: part.Filename, size: part.Body.Size, limit: limit}
+	}
+	reserve := limit
+	if part.Body != nil && part.Body.Size > 0 {
+		reserve = part.Body.Size
+	}
+	release, err = attachmentMemory.acquire(ctx, reserve*attachmentMemoryFactor)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer func() {
+		if err != nil {
+			release()
+		}
+	}()
+
+	// Get the attachment data using the current attachment ID
+	attachment, err := g.client.GetAttachment(ctx, messageID, attachmentID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Failed to get attachment data: %w", err)
+	}
+
+	// Decode the attachment data, dropping the encoded copy as soon as possible
+	data, err = decodeAttachmentData(attachment.Data)
+	attachment.Data = ""
+	if err != nil {
+		return nil, nil, fmt.Errorf("Failed to decode attachment data: %w", err)
+	}
+	if int64(len(data)) > limit {
+		return nil, nil, &attachmentTooLargeError{filename: part.Filename, size: int64(len(data)), limit: limit}
+	}
+
+	// Never parse files the malware scanner flags
+	if err = screenAttachment(ctx, data, part.Filename); err != nil {
+		return nil, nil, err
+	}
+	return data, release, nil
+}
+
+// downloadAttachmentText downloads an attachment and extracts its text
+func (g *GmailServer) downloadAttachmentText(ctx context.Context, messageID, attachmentID string, part *gmail.MessagePart) (string, error) {
+	data, release, err := g.downloadAttachment(ctx, messageID, attachmentID, part)
+	if err != nil {
+		return "", err
+	}
+	defer release()
+
+	// Extract text based on MIME type
+	text, err := extract.TextFromBytes(data, part.MimeType, part.Filename)
+	if err != nil {
+		return "", fmt.Errorf("Failed to extract text: %w", err)
+	}
+	return text, nil
+}
+
+// screenAttachment runs the configured malware scanner (GMAIL_MCP_CLAMD or
+// GMAIL_MCP_SCAN_COMMAND) over an attachment. Files that are flagged, or can't
+// be scanned, are refused.
+func screenAttachment(ctx context.Context, data []byte, filename string) error {
+	scanner := scan.FromEnv()
+	if scanner == nil {
+		return nil
+	}
+	err := scanner.Scan(ctx, data, filename)
+	switch {
+	case err == nil:
+		return nil
+	case scan.IsFlagged(err):
+		log.Printf("🛡️ Refused attachment %s: %v", filename, err)
+		return toolerr.Errorf(toolerr.InvalidInput, "attachment_refused", "Refused to extract '%s': %w; the file was not parsed", filename, err)
+	default:
+		log.Printf("Warning: Malware scan failed for %s: %v", filename, err)
+		return toolerr.Errorf(toolerr.Unavailable, "scan_failed", "Refused to extract '%s': the malware scan failed (%w)", filename, err)
+	}
+}
+
+// ListSupportedFormats lists the attachment formats extract_attachment_by_filename can
+// read, including formats an embedder registered and ones turned off with
+// GMAIL_MCP_DISABLED_EXTRACTORS
+func ListSupportedFormats() (*mcp.CallToolResult, error) {
+	var formats []map[string]interface{}
+	for _, extractor := range extract.Extractors() {
+		formats = append(formats, map[string]interface{}{
+			"name":       extractor.Name(),
+			"mimeTypes":  extractor.MIMETypes(),
+			"extensions": extractor.Extensions(),
+			"enabled":    extract.Enabled(extractor.Name()),
+		})
+	}
+
+	result := map[string]interface{}{
+		"formats": formats,
+		"count":   len(formats),
+	}
+
+	resultJSON, _ := json.MarshalIndent(result, "", "  ")
+	return mcp.NewToolResultText(string(resultJSON)), nil
+}
+
+// Limits for render_attachment_preview output
+const (
+	defaultPreviewPages = 3
+	maxPreviewPages     = 10
+	// maxPreviewBytes caps the image data returned in one result
+	maxPreviewBytes = 8 << 20
+)
+
+// RenderAttachmentPreview renders an attachment as page images (or a PDF) so vision-capable
+// clients can look at documents whose text extraction fails
+func (g *GmailServer) RenderAttachmentPreview(ctx context.Context, messageID, filename, format string, maxPages int) (*mcp.CallToolResult, error) {
+	if format != "images" && format != "pdf" {
+		return toolerr.Invalid(fmt.Sprintf("Invalid format '%s': use images or pdf", format)), nil
+	}
+	if maxPages <= 0 {
+		maxPages = defaultPreviewPages
+	}
+	maxPages = min(maxPages, maxPreviewPages)
+
+	message, err := g.getMessage(ctx, messageID)
+	if err != nil {
+		return toolerr.Result(err, "Failed to get message"), nil
+	}
+
+	var attachmentPart *gmail.MessagePart
+	allAttachments := extract.AttachmentInfo(message)
+	for _, attachment := range allAttachments {
+		if attachment["filename"] == filename {
+			extract.FindAttachmentPart(message.Payload.Parts, attachment["attachmentId"].(string), &attachmentPart)
+			break
+		}
+	}
+	if attachmentPart == nil {
+		availableFiles := make([]string, 0, len(allAttachments))
+		for _, att := range allAttachments {
+			availableFiles = append(availableFiles, att["filename"].(string))
+		}
+		return toolerr.New(toolerr.NotFound, "attachment_not_found", fmt.Sprintf("Attachment with filename '%s' not found. Available files: %v", filename, availableFiles)).Result(), nil
+	}
+
+	data, release, err := g.downloadAttachment(ctx, messageID, attachmentPart.Body.AttachmentId, attachmentPart)
+	if err != nil {
+		return toolerr.Result(err, ""), nil
+	}
+	defer release()
+
+	result := map[string]interface{}{
+		"messageId": messageID,
+		"filename":  filename,
+		"mimeType":  attachmentPart.MimeType,
+		"format":    format,
+	}
+
+	if format == "pdf" {
+		pdf, err := extract.RenderPDF(ctx, data, attachmentPart.MimeType, filename)
+		if err != nil {
+			return toolerr.Result(err, fmt.Sprintf("Failed to render '%s' as PDF", filename)), nil
+		}
+		if len(pdf) > maxPreviewBytes {
+			return toolerr.Invalid(fmt.Sprintf("The PDF of '%s' is %d bytes, over the %d byte preview limit; use format images instead", filename, len(pdf), maxPreviewBytes)), nil
+		}
+		result["size"] = len(pdf)
+		resultJSON, _ := json.MarshalIndent(result, "", "  ")
+		return &mcp.CallToolResult{Content: []mcp.Content{
+			mcp.NewTextContent(string(resultJSON)),
+			mcp.NewEmbeddedResource(mcp.BlobResourceContents{
+				URI:      fmt.Sprintf("gmail://attachment/%s/%s.pdf", messageID, filename),
+				MIMEType: "application/pdf",
+				Blob:     base64.StdEncoding.EncodeToString(pdf),
+			}),
+		}}, nil
+	}
+
+	pages, err := extract.RenderPages(ctx, data, attachmentPart.MimeType, filename, maxPages)
+	if err != nil {
+		return toolerr.Result(err, fmt.Sprintf("Failed to render '%s'", filename)), nil
+	}
+
+	// Stop adding pages once the result would get too large for the client
+	var images []mcp.Content
+	total := 0
+	for _, page := range pages {
+		if total+len(page.Data) > maxPreviewBytes && len(images) > 0 {
+			break
+		}
+		total += len(page.Data)
+		images = append(images, mcp.NewImageContent(base64.StdEncoding.EncodeToString(page.Data), page.MIMEType))
+	}
+	result["pages"] = len(images)
+	if len(images) < len(pages) {
+		result["truncated"] = true
+		result["message"] = fmt.Sprintf("Only the first %d of %d rendered pages fit in the %d byte preview limit", len(images), len(pages), maxPreviewBytes)
+	}
+
+	resultJSON, _ := json.MarshalIndent(result, "", "  ")
+	return &mcp.CallToolResult{Content: append([]mcp.Content{mcp.NewTextContent(string(resultJSON))}, images...)}, nil
+}
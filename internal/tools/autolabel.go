@@ -0,0 +1,231 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"auto-gmail/internal/extract"
+	"auto-gmail/internal/llm"
+	"auto-gmail/internal/redact"
+	"auto-gmail/internal/toolerr"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/shared"
+	"google.golang.org/api/gmail/v1"
+)
+
+// auto_label defaults and limits
+const (
+	// defaultAutoLabelQuery is inbox mail without any of the user's labels
+	defaultAutoLabelQuery     = "in:inbox has:nouserlabels"
+	defaultAutoLabelThreads   = 20
+	maxAutoLabelThreads       = 50
+	defaultAutoLabelThreshold = 0.8
+	// autoLabelBodyChars caps how much of each thread's first message is classified
+	autoLabelBodyChars = 1500
+)
+
+// labelDecision is the model's label choice for one thread
+type labelDecision struct {
+	ThreadID   string  `json:"threadId"`
+	Subject    string  `json:"subject"`
+	From       string  `json:"from"`
+	Label      string  `json:"label,omitempty"`
+	Confidence float64 `json:"confidence"`
+	Reason     string  `json:"reason,omitempty"`
+	Error      string  `json:"error,omitempty"`
+}
+
+// AutoLabel classifies threads matching query against the user's existing labels
+// with the configured model, applies the labels chosen with at least threshold
+// confidence, and returns the rest for review. A dry run applies nothing.
+func (g *GmailServer) AutoLabel(ctx context.Context, query string, maxThreads int, threshold float64, dryRun bool) (*mcp.CallToolResult, error) {
+	if err := llm.Check(); err != nil {
+		return toolerr.Result(err, "Auto-labeling is unavailable"), nil
+	}
+	query = strings.TrimSpace(query)
+	if query == "" {
+		query = defaultAutoLabelQuery
+	}
+	if problems := lintQuery(query); len(problems) > 0 {
+		return invalidQueryError(query, problems), nil
+	}
+
+	labels, err := g.client.ListLabels(ctx)
+	if err != nil {
+		return toolerr.Result(err, "Failed to list labels"), nil
+	}
+	taxonomy := map[string]*gmail.Label{}
+	var names []string
+	for _, label := range labels.Labels {
+		if label.Type != "system" {
+			taxonomy[strings.ToLower(label.Name)] = label
+			names = append(names, label.Name)
+		}
+	}
+	if len(names) == 0 {
+		return toolerr.New(toolerr.NotFound, "no_labels", "There are no labels to classify threads into").
+			WithHint("Create the labels first with create_label, then run auto_label again.").Result(), nil
+	}
+	sort.Strings(names)
+
+	listed, err := g.client.ListThreads(ctx, query, int64(maxThreads))
+	if err != nil {
+		return toolerr.Result(err, "Failed to search threads"), nil
+	}
+	hydrated := g.hydrateThreads(ctx, listed.Threads)
+	var threads []*gmail.Thread
+	for _, thread := range listed.Threads {
+		if detail, ok := hydrated[thread.Id]; ok && len(detail.Messages) > 0 {
+			threads = append(threads, detail)
+		}
+	}
+	if len(threads) == 0 {
+		result := map[string]interface{}{"query": query, "classified": 0, "note": "No threads match the query"}
+		resultJSON, _ := json.MarshalIndent(result, "", "  ")
+		return mcp.NewToolResultText(string(resultJSON)), nil
+	}
+
+	decisions, redactions, err := classifyThreads(ctx, threads, names)
+	if err != nil {
+		return toolerr.Result(err, "Failed to classify threads"), nil
+	}
+
+	applied, review, unlabeled := []labelDecision{}, []labelDecision{}, []labelDecision{}
+	for _, decision := range decisions {
+		label, known := taxonomy[strings.ToLower(decision.Label)]
+		switch {
+		case decision.Label == "":
+			unlabeled = append(unlabeled, decision)
+			continue
+		case !known:
+			decision.Reason = strings.TrimSpace(fmt.Sprintf("suggested %q, which isn't one of your labels. %s", decision.Label, decision.Reason))
+			review = append(review, decision)
+			continue
+		case decision.Confidence < threshold:
+			decision.Label = label.Name
+			review = append(review, decision)
+			continue
+		}
+
+		decision.Label = label.Name
+		if !dryRun {
+			if _, err := g.client.ModifyThread(ctx, decision.ThreadID, &gmail.ModifyThreadRequest{AddLabelIds: []string{label.Id}}); err != nil {
+				decision.Error = g.permissionHint(err).Error()
+				review = append(review, decision)
+				continue
+			}
+		}
+		applied = append(applied, decision)
+	}
+	sort.SliceStable(review, func(i, j int) bool { return review[i].Confidence > review[j].Confidence })
+
+	result := map[string]interface{}{
+		"query":      query,
+		"threshold":  threshold,
+		"classified": len(decisions),
+		"applied":    applied,
+		"review":     review,
+		"noMatch":    unlabeled,
+		"dryRun":     dryRun,
+	}
+	if dryRun {
+		result["note"] = "Dry run: nothing was labeled. 'applied' lists what would be."
+	}
+	if len(redactions) > 0 {
+		result["redactions"] = redactions
+	}
+	resultJSON, _ := json.MarshalIndent(result, "", "  ")
+	return mcp.NewToolResultText(string(resultJSON)), nil
+}
+
+// classifyThreads asks the model to pick the best of labels for each thread's first
+// message, with a confidence. Personal data is redacted first when GMAIL_MCP_REDACT=1.
+func classifyThreads(ctx context.Context, threads []*gmail.Thread, labels []string) ([]labelDecision, redact.Report, error) {
+	redactor := redact.FromEnv()
+	report := redact.Report{}
+	decisions := make([]labelDecision, len(threads))
+
+	var listing strings.Builder
+	for i, thread := range threads {
+		message := thread.Messages[0]
+		decisions[i] = labelDecision{
+			ThreadID: thread.Id,
+			Subject:  messageHeader(message, "Subject"),
+			From:     messageHeader(message, "From"),
+		}
+		names := messageNames(message)
+		from, fromReport := redactor.Redact(decisions[i].From, names...)
+		subject, subjectReport := redactor.Redact(decisions[i].Subject, names...)
+		body, bodyReport := redactor.Redact(truncateText(extract.EmailBody(message), autoLabelBodyChars), names...)
+		report.Add(fromReport)
+		report.Add(subjectReport)
+		report.Add(bodyReport)
+		fmt.Fprintf(&listing, "### Thread %d\nFrom: %s\nSubject: %s\n\n%s\n\n", i+1, from, subject, body)
+	}
+
+	prompt := fmt.Sprintf(`Sort each email thread below into the one label that fits it best, choosing only from these labels:
+%s
+
+Reply with JSON: {"classifications": [{"thread": 1, "label": "exact label name, or empty if none fits", "confidence": 0.0 to 1.0, "reason": "a few words"}]}, one entry per thread. Use a low confidence when the choice is a guess.
+
+%s`, "- "+strings.Join(labels, "\n- "), listing.String())
+
+	client, err := llm.NewClient()
+	if err != nil {
+		return nil, report, err
+	}
+	completion, err := client.Chat.Completions.New(ctx, openai.ChatCompletionNewParams{
+		Messages: []openai.ChatCompletionMessageParamUnion{
+			{
+				OfUser: &openai.ChatCompletionUserMessageParam{
+					Content: openai.ChatCompletionUserMessageParamContentUnion{
+						OfString: openai.String(prompt),
+					},
+				},
+			},
+		},
+		Model:          llm.ChatModel(),
+		Temperature:    openai.Float(0),
+		ResponseFormat: openai.ChatCompletionNewParamsResponseFormatUnion{OfJSONObject: &shared.ResponseFormatJSONObjectParam{}},
+	})
+	if err != nil {
+		return nil, report, err
+	}
+	if len(completion.Choices) == 0 {
+		return nil, report, fmt.Errorf("no response from the model")
+	}
+
+	var parsed struct {
+		Classifications []struct {
+			Thread     int     `json:"thread"`
+			Label      string  `json:"label"`
+			Confidence float64 `json:"confidence"`
+			Reason     string  `json:"reason"`
+		} `json:"classifications"`
+	}
+	if err := json.Unmarshal([]byte(completion.Choices[0].Message.Content), &parsed); err != nil {
+		return nil, report, fmt.Errorf("invalid JSON from the model: %v", err)
+	}
+	answered := make([]bool, len(threads))
+	for _, classification := range parsed.Classifications {
+		i := classification.Thread - 1
+		if i < 0 || i >= len(threads) || answered[i] {
+			continue
+		}
+		answered[i] = true
+		decisions[i].Label = strings.TrimSpace(classification.Label)
+		decisions[i].Confidence = min(max(classification.Confidence, 0), 1)
+		decisions[i].Reason = classification.Reason
+	}
+	for i := range decisions {
+		if !answered[i] {
+			decisions[i].Reason = "the model didn't classify this thread"
+		}
+	}
+	return decisions, report, nil
+}
@@ -0,0 +1,101 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"auto-gmail/internal/backup"
+	"auto-gmail/internal/gmailclient"
+	"auto-gmail/internal/toolerr"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// defaultBackupLabels are backed up when none are given and none were backed up before
+var defaultBackupLabels = []string{"INBOX", "SENT"}
+
+// BackupDir is where this account's backup is kept: "backup" next to the account's
+// token, or the account's own subdirectory of GMAIL_MCP_BACKUP_DIR so users never
+// share a manifest or mbox files
+func (g *GmailServer) BackupDir() string {
+	if root := strings.TrimSpace(os.Getenv("GMAIL_MCP_BACKUP_DIR")); root != "" {
+		return filepath.Join(root, g.accountDirName())
+	}
+	return g.dataFile("backup")
+}
+
+// RunBackup saves the labels (names or system label IDs) to the backup directory,
+// in full the first time and incrementally after that. Without labels it continues
+// the labels backed up before, or starts with the inbox and sent mail. Only one
+// backup of an account runs at a time.
+func (g *GmailServer) RunBackup(ctx context.Context, labelNames []string, full bool, maxMessages int) (*backup.Result, error) {
+	if !g.backupMu.TryLock() {
+		return nil, toolerr.Errorf(toolerr.Unavailable, "backup_running", "a backup of this account is already running")
+	}
+	defer g.backupMu.Unlock()
+
+	dir := g.BackupDir()
+	if len(labelNames) == 0 {
+		manifest, err := backup.LoadManifest(dir)
+		if err != nil {
+			return nil, err
+		}
+		labelNames = manifest.LabelIDs()
+	}
+	if len(labelNames) == 0 {
+		labelNames = defaultBackupLabels
+	}
+
+	labels, err := g.client.ListLabels(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var selected []backup.Label
+	for _, name := range labelNames {
+		found := false
+		for _, label := range labels.Labels {
+			if label.Id == name || strings.EqualFold(label.Name, name) {
+				selected = append(selected, backup.Label{ID: label.Id, Name: label.Name})
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, toolerr.Errorf(toolerr.NotFound, "label_not_found", "no label named %q", name)
+		}
+	}
+
+	return backup.Run(ctx, g.client, dir, backup.Options{Labels: selected, Full: full, MaxMessages: maxMessages})
+}
+
+// BackupMailbox runs a backup for the backup_mailbox tool
+func (g *GmailServer) BackupMailbox(ctx context.Context, labelNames []string, full bool, maxMessages int) (*mcp.CallToolResult, error) {
+	if _, ok := g.client.(gmailclient.MailboxSyncer); !ok {
+		return toolerr.New(toolerr.Unavailable, "backup_unsupported", "This mailbox can't be backed up").
+			WithHint("Connect a Gmail account to use backups.").Result(), nil
+	}
+	result, err := g.RunBackup(ctx, labelNames, full, maxMessages)
+	if err != nil {
+		return toolerr.Result(err, "Backup failed"), nil
+	}
+
+	resultJSON, _ := json.MarshalIndent(struct {
+		*backup.Result
+		Note string `json:"note,omitempty"`
+	}{result, backupNote(result)}, "", "  ")
+	return mcp.NewToolResultText(string(resultJSON)), nil
+}
+
+// backupNote tells the caller what to do after a run that didn't finish everything
+func backupNote(result *backup.Result) string {
+	switch {
+	case result.Remaining:
+		return "The message limit was reached; call backup_mailbox again to continue where this run stopped"
+	case len(result.Failed) > 0:
+		return "Some messages failed and will be retried on the next run"
+	}
+	return ""
+}
@@ -0,0 +1,140 @@
+package tools
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// defaultResponseBudget is the default character budget for one tool response (~8000 tokens)
+const defaultResponseBudget = 32000
+
+// quoteHeaderPattern matches the line that introduces a quoted reply ("On Mon, ... wrote:")
+var quoteHeaderPattern = regexp.MustCompile(`^On .+ wrote:$`)
+
+// responseBudget caps how much email text a single tool response may contain.
+// When content exceeds the budget it is trimmed in stages: quoted reply text first,
+// then whole bodies of the oldest items, then the remaining bodies are truncated evenly.
+type responseBudget struct {
+	limit int
+}
+
+// budgetItem is one body competing for the response budget
+type budgetItem struct {
+	body  string
+	age   int64    // e.g. internalDate; lower values are older and dropped first
+	notes []string // what was trimmed, reported back to the caller
+}
+
+// newResponseBudget reads the budget from GMAIL_MCP_RESPONSE_BUDGET (characters)
+func newResponseBudget() *responseBudget {
+	limit := defaultResponseBudget
+	if value := os.Getenv("GMAIL_MCP_RESPONSE_BUDGET"); value != "" {
+		if n, err := strconv.Atoi(value); err == nil && n > 0 {
+			limit = n
+		} else {
+			log.Printf("Warning: Invalid GMAIL_MCP_RESPONSE_BUDGET %q, using %d", value, defaultResponseBudget)
+		}
+	}
+	return &responseBudget{limit: limit}
+}
+
+// fit trims the items in place until their combined length fits the budget
+func (b *responseBudget) fit(items []*budgetItem) {
+	total := 0
+	for _, item := range items {
+		total += len(item.body)
+	}
+	if total <= b.limit {
+		return
+	}
+
+	// Stage 1: drop quoted reply text, which usually repeats earlier messages
+	for _, item := range items {
+		stripped := stripQuotedText(item.body)
+		if removed := len(item.body) - len(stripped); removed > 0 {
+			item.notes = append(item.notes, fmt.Sprintf("quoted reply text removed (%d chars)", removed))
+			total -= removed
+			item.body = stripped
+		}
+	}
+	if total <= b.limit {
+		return
+	}
+
+	// Stage 2: omit the oldest bodies entirely, always keeping the newest one
+	order := make([]*budgetItem, len(items))
+	copy(order, items)
+	sort.SliceStable(order, func(i, j int) bool { return order[i].age < order[j].age })
+	for _, item := range order[:len(order)-1] {
+		if total <= b.limit {
+			return
+		}
+		if item.body == "" {
+			continue
+		}
+		item.notes = append(item.notes, fmt.Sprintf("body omitted to fit the %d-character response budget (%d chars); request this item on its own to read it", b.limit, len(item.body)))
+		total -= len(item.body)
+		item.body = ""
+	}
+	if total <= b.limit {
+		return
+	}
+
+	// Stage 3: truncate what is left so every remaining body gets an equal share
+	var remaining []*budgetItem
+	for _, item := range items {
+		if item.body != "" {
+			remaining = append(remaining, item)
+		}
+	}
+	share := b.limit / len(remaining)
+	for _, item := range remaining {
+		if len(item.body) > share {
+			item.notes = append(item.notes, fmt.Sprintf("body truncated from %d to %d chars to fit the response budget", len(item.body), share))
+			item.body = truncateText(item.body, share)
+		}
+	}
+}
+
+// truncate shortens a single text to the budget and reports whether it was cut
+func (b *responseBudget) truncate(text string) (string, bool) {
+	if len(text) <= b.limit {
+		return text, false
+	}
+	return truncateText(text, b.limit), true
+}
+
+// stripQuotedText removes quoted reply blocks ("> ..." lines and everything after an
+// "On ... wrote:" or "Original Message" separator) from an email body
+func stripQuotedText(body string) string {
+	var kept []string
+	for _, line := range strings.Split(body, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if quoteHeaderPattern.MatchString(trimmed) || strings.Contains(trimmed, "-----Original Message-----") {
+			break
+		}
+		if strings.HasPrefix(trimmed, ">") {
+			continue
+		}
+		kept = append(kept, line)
+	}
+	return strings.TrimSpace(strings.Join(kept, "\n"))
+}
+
+// truncateText cuts text to at most max bytes without splitting a UTF-8 character
+func truncateText(text string, max int) string {
+	if len(text) <= max {
+		return text
+	}
+	cut := max
+	for cut > 0 && !utf8.RuneStart(text[cut]) {
+		cut--
+	}
+	return text[:cut]
+}
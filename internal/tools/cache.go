@@ -0,0 +1,176 @@
+package tools
+
+import (
+	"container/list"
+	"context"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+
+	"auto-gmail/internal/gmailclient"
+
+	"google.golang.org/api/gmail/v1"
+	"google.golang.org/api/googleapi"
+)
+
+// defaultCacheSize is the number of threads/messages kept per Gmail account
+const defaultCacheSize = 500
+
+// cacheEntry is one cached Gmail API object with the validators needed to reuse it
+type cacheEntry struct {
+	key       string
+	etag      string
+	historyID uint64
+	value     interface{}
+}
+
+// gmailCache is a small LRU cache of Gmail API responses.
+// Entries are reused without a request when the caller already knows the object's
+// current historyId (e.g. from a list call), and otherwise revalidated with If-None-Match.
+type gmailCache struct {
+	mu       sync.Mutex
+	capacity int
+	ll       *list.List
+	items    map[string]*list.Element
+
+	hits        uint64 // served without any request (historyId matched)
+	revalidated uint64 // served after a 304 Not Modified
+	misses      uint64 // downloaded in full
+}
+
+// newGmailCache creates a cache sized from GMAIL_MCP_CACHE_SIZE (0 disables caching)
+func newGmailCache() *gmailCache {
+	capacity := defaultCacheSize
+	if value := os.Getenv("GMAIL_MCP_CACHE_SIZE"); value != "" {
+		if n, err := strconv.Atoi(value); err == nil && n >= 0 {
+			capacity = n
+		} else {
+			log.Printf("Warning: Invalid GMAIL_MCP_CACHE_SIZE %q, using %d", value, defaultCacheSize)
+		}
+	}
+	return &gmailCache{
+		capacity: capacity,
+		ll:       list.New(),
+		items:    make(map[string]*list.Element),
+	}
+}
+
+// get returns the entry for key and marks it as recently used
+func (c *gmailCache) get(key string) (*cacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.items[key]; ok {
+		c.ll.MoveToFront(elem)
+		return elem.Value.(*cacheEntry), true
+	}
+	return nil, false
+}
+
+// put stores value under key, evicting the least recently used entry when full
+func (c *gmailCache) put(key, etag string, historyID uint64, value interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.capacity == 0 {
+		return
+	}
+
+	entry := &cacheEntry{key: key, etag: etag, historyID: historyID, value: value}
+	if elem, ok := c.items[key]; ok {
+		elem.Value = entry
+		c.ll.MoveToFront(elem)
+		return
+	}
+
+	c.items[key] = c.ll.PushFront(entry)
+	if c.ll.Len() > c.capacity {
+		oldest := c.ll.Back()
+		c.ll.Remove(oldest)
+		delete(c.items, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+// record counts a lookup outcome for the hit rate metrics
+func (c *gmailCache) record(counter *uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	*counter++
+}
+
+// Stats returns cache metrics for the health endpoint and status prompt
+func (c *gmailCache) Stats() map[string]interface{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	total := c.hits + c.revalidated + c.misses
+	hitRate := 0.0
+	if total > 0 {
+		hitRate = float64(c.hits+c.revalidated) / float64(total)
+	}
+	return map[string]interface{}{
+		"entries":     c.ll.Len(),
+		"capacity":    c.capacity,
+		"hits":        c.hits,
+		"revalidated": c.revalidated,
+		"misses":      c.misses,
+		"hitRate":     hitRate,
+	}
+}
+
+// getThread fetches a full thread through the cache. Pass the historyId from a
+// list call as knownHistoryID to skip the request entirely when nothing changed, or 0.
+func (g *GmailServer) getThread(ctx context.Context, threadID string, knownHistoryID uint64) (*gmail.Thread, error) {
+	key := "thread:" + threadID
+	entry, cached := g.cache.get(key)
+	if cached && knownHistoryID != 0 && entry.historyID == knownHistoryID {
+		g.cache.record(&g.cache.hits)
+		return entry.value.(*gmail.Thread), nil
+	}
+
+	var opts gmailclient.GetOptions
+	if cached {
+		opts.ETag = entry.etag
+	}
+	thread, err := g.client.GetThread(ctx, threadID, opts)
+	if err != nil {
+		if cached && googleapi.IsNotModified(err) {
+			g.cache.record(&g.cache.revalidated)
+			return entry.value.(*gmail.Thread), nil
+		}
+		return nil, err
+	}
+
+	// Snapshot copies are only for this call; live data replaces them once Gmail is back
+	if staleAsOf(thread.ServerResponse) != "" {
+		return thread, nil
+	}
+	g.cache.record(&g.cache.misses)
+	g.cache.put(key, thread.Header.Get("ETag"), thread.HistoryId, thread)
+	return thread, nil
+}
+
+// getMessage fetches a full message through the cache, revalidating with If-None-Match
+func (g *GmailServer) getMessage(ctx context.Context, messageID string) (*gmail.Message, error) {
+	key := "message:" + messageID
+	entry, cached := g.cache.get(key)
+
+	var opts gmailclient.GetOptions
+	if cached {
+		opts.ETag = entry.etag
+	}
+	message, err := g.client.GetMessage(ctx, messageID, opts)
+	if err != nil {
+		if cached && googleapi.IsNotModified(err) {
+			g.cache.record(&g.cache.revalidated)
+			return entry.value.(*gmail.Message), nil
+		}
+		return nil, err
+	}
+
+	if staleAsOf(message.ServerResponse) != "" {
+		return message, nil
+	}
+	g.cache.record(&g.cache.misses)
+	g.cache.put(key, message.Header.Get("ETag"), message.HistoryId, message)
+	return message, nil
+}
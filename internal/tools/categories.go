@@ -0,0 +1,141 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"google.golang.org/api/gmail/v1"
+
+	"auto-gmail/internal/toolerr"
+)
+
+// gmailCategories are Gmail's inbox tabs in the order Gmail shows them, with the
+// system label each one is backed by
+var gmailCategories = []struct {
+	name    string
+	labelID string
+}{
+	{"primary", "CATEGORY_PERSONAL"},
+	{"social", "CATEGORY_SOCIAL"},
+	{"promotions", "CATEGORY_PROMOTIONS"},
+	{"updates", "CATEGORY_UPDATES"},
+	{"forums", "CATEGORY_FORUMS"},
+}
+
+// searchCategories are the category: values Gmail search accepts: the tabs, plus
+// the personal alias and the smart categories that have no tab
+var searchCategories = map[string]bool{
+	"primary": true, "personal": true, "social": true, "promotions": true, "updates": true,
+	"forums": true, "reservations": true, "purchases": true,
+}
+
+// categoryNames lists the tab names, for tool enums
+func categoryNames() []string {
+	names := make([]string, len(gmailCategories))
+	for i, category := range gmailCategories {
+		names[i] = category.name
+	}
+	return names
+}
+
+// validCategory reports whether category is empty or one of the tab names
+func validCategory(category string) bool {
+	if category == "" {
+		return true
+	}
+	for _, known := range gmailCategories {
+		if known.name == category {
+			return true
+		}
+	}
+	return false
+}
+
+// invalidCategoryError is the tool error for an unknown category
+func invalidCategoryError(category string) *mcp.CallToolResult {
+	return toolerr.Invalid(fmt.Sprintf("Invalid category '%s': use %s", category, strings.Join(categoryNames(), ", ")))
+}
+
+// withCategory narrows query to one inbox tab; an empty category leaves it as is.
+// Gmail's OR binds tighter than the implicit AND, so appending the term is enough.
+func withCategory(query, category string) string {
+	if category == "" {
+		return query
+	}
+	return strings.TrimSpace(query + " category:" + category)
+}
+
+// messageCategory is the tab a message is shown under. Inbox mail without a
+// category label is in primary, as in Gmail; other mail, such as sent messages,
+// has no tab.
+func messageCategory(message *gmail.Message) string {
+	for _, category := range gmailCategories {
+		if hasLabelID(message, category.labelID) {
+			return category.name
+		}
+	}
+	if hasLabelID(message, "INBOX") {
+		return "primary"
+	}
+	return ""
+}
+
+// threadCategory is the tab of the latest received message in a thread
+func threadCategory(thread *gmail.Thread) string {
+	for i := len(thread.Messages) - 1; i >= 0; i-- {
+		if hasLabelID(thread.Messages[i], "SENT") {
+			continue
+		}
+		if category := messageCategory(thread.Messages[i]); category != "" {
+			return category
+		}
+	}
+	return ""
+}
+
+// CategoryCounts estimates how many threads, and how many unread ones, match query
+// in each inbox tab. An empty query counts the inbox.
+func (g *GmailServer) CategoryCounts(ctx context.Context, query string) (*mcp.CallToolResult, error) {
+	query = strings.TrimSpace(query)
+	if query == "" {
+		query = "in:inbox"
+	}
+	if problems := lintQuery(query); len(problems) > 0 {
+		return invalidQueryError(query, problems), nil
+	}
+
+	type categoryCount struct {
+		Category string `json:"category"`
+		Threads  int64  `json:"threads"`
+		Unread   int64  `json:"unread"`
+	}
+	counts := make([]categoryCount, 0, len(gmailCategories))
+	for _, category := range gmailCategories {
+		scoped := withCategory(query, category.name)
+		all, err := g.client.ListThreads(ctx, scoped, 1)
+		if err != nil {
+			return toolerr.Result(err, fmt.Sprintf("Failed to count %s threads", category.name)), nil
+		}
+		unread, err := g.client.ListThreads(ctx, scoped+" is:unread", 1)
+		if err != nil {
+			return toolerr.Result(err, fmt.Sprintf("Failed to count unread %s threads", category.name)), nil
+		}
+		counts = append(counts, categoryCount{
+			Category: category.name,
+			Threads:  all.ResultSizeEstimate,
+			Unread:   unread.ResultSizeEstimate,
+		})
+	}
+
+	result := map[string]interface{}{
+		"query":      query,
+		"categories": counts,
+		"note":       "Counts are Gmail's estimates and may be approximate for large results",
+	}
+
+	resultJSON, _ := json.MarshalIndent(result, "", "  ")
+	return mcp.NewToolResultText(string(resultJSON)), nil
+}
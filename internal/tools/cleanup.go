@@ -0,0 +1,117 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"google.golang.org/api/gmail/v1"
+	"google.golang.org/api/googleapi"
+
+	"auto-gmail/internal/toolerr"
+)
+
+// mutedLabelName is the user label applied to muted threads
+const mutedLabelName = "Muted"
+
+// MuteThread archives a thread and labels it "Muted". Gmail's API has no native
+// mute, so later replies still arrive in the inbox.
+func (g *GmailServer) MuteThread(ctx context.Context, threadID string) (*mcp.CallToolResult, error) {
+	labelID, err := g.ensureLabel(ctx, mutedLabelName)
+	if err != nil {
+		return toolerr.Result(g.permissionHint(err), fmt.Sprintf("Failed to prepare %q label", mutedLabelName)), nil
+	}
+
+	_, err = g.client.ModifyThread(ctx, threadID, &gmail.ModifyThreadRequest{
+		AddLabelIds:    []string{labelID},
+		RemoveLabelIds: []string{"INBOX"},
+	})
+	if err != nil {
+		return toolerr.Result(g.permissionHint(err), "Failed to mute thread"), nil
+	}
+
+	result := map[string]interface{}{
+		"threadId": threadID,
+		"action":   "muted",
+		"label":    mutedLabelName,
+		"archived": true,
+		"message":  "Thread archived and labeled Muted. Gmail's API can't apply native mute, so new replies will still reach the inbox.",
+	}
+
+	resultJSON, _ := json.MarshalIndent(result, "", "  ")
+	return mcp.NewToolResultText(string(resultJSON)), nil
+}
+
+// BlockSender creates a filter so future mail from sender skips the inbox ("archive")
+// or goes straight to the trash ("delete"). sender can be an address or "@domain".
+func (g *GmailServer) BlockSender(ctx context.Context, sender, action string) (*mcp.CallToolResult, error) {
+	sender = strings.TrimSpace(sender)
+	if sender == "" || strings.ContainsAny(sender, " \t") || !strings.Contains(sender, "@") {
+		return toolerr.Invalid(fmt.Sprintf("Invalid sender %q: use an email address or @domain", sender)), nil
+	}
+
+	filterAction := &gmail.FilterAction{RemoveLabelIds: []string{"INBOX"}}
+	switch action {
+	case "", "archive":
+		action = "archive"
+	case "delete":
+		filterAction.AddLabelIds = []string{"TRASH"}
+	default:
+		return toolerr.Invalid(fmt.Sprintf("Invalid action %q: use \"archive\" or \"delete\"", action)), nil
+	}
+
+	filter, err := g.client.CreateFilter(ctx, &gmail.Filter{
+		Criteria: &gmail.FilterCriteria{From: sender},
+		Action:   filterAction,
+	})
+	if err != nil {
+		return toolerr.Result(g.permissionHint(err), "Failed to create filter"), nil
+	}
+
+	result := map[string]interface{}{
+		"filterId": filter.Id,
+		"from":     sender,
+		"action":   action,
+		"message":  fmt.Sprintf("Future mail from %s will be %sd. Existing mail is unchanged.", sender, action),
+	}
+
+	resultJSON, _ := json.MarshalIndent(result, "", "  ")
+	return mcp.NewToolResultText(string(resultJSON)), nil
+}
+
+// ensureLabel returns the ID of the user label with the given name, creating it if needed
+func (g *GmailServer) ensureLabel(ctx context.Context, name string) (string, error) {
+	labels, err := g.client.ListLabels(ctx)
+	if err != nil {
+		return "", err
+	}
+	for _, label := range labels.Labels {
+		if strings.EqualFold(label.Name, name) {
+			return label.Id, nil
+		}
+	}
+
+	label, err := g.client.CreateLabel(ctx, &gmail.Label{
+		Name:                  name,
+		LabelListVisibility:   "labelShow",
+		MessageListVisibility: "show",
+	})
+	if err != nil {
+		return "", err
+	}
+	return label.Id, nil
+}
+
+// permissionHint explains 403s caused by tokens granted before the server asked
+// for label and filter permissions
+func (g *GmailServer) permissionHint(err error) error {
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) && apiErr.Code == http.StatusForbidden {
+		return fmt.Errorf("%v (the saved sign-in may predate the label/filter permissions: delete %s and call the authenticate tool again)", err, g.tokenFile)
+	}
+	return err
+}
@@ -0,0 +1,190 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"net/mail"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"auto-gmail/internal/extract"
+
+	"google.golang.org/api/gmail/v1"
+)
+
+// contactThreadLimit is how many recent threads with a contact the context resource summarizes
+const contactThreadLimit = 8
+
+// contactToneSamples is how many of the user's own messages to a contact are quoted for tone
+const contactToneSamples = 3
+
+// contactSampleChars caps each quoted message in the tone section
+const contactSampleChars = 600
+
+// ContactAddress turns the {address} of a gmail://contact/{address}/context URI into
+// a lowercase email address
+func ContactAddress(value interface{}) (string, error) {
+	raw, _ := value.(string)
+	if unescaped, err := url.PathUnescape(raw); err == nil {
+		raw = unescaped
+	}
+	address := strings.ToLower(senderAddress(strings.TrimSpace(raw)))
+	if !strings.Contains(address, "@") {
+		return "", fmt.Errorf("invalid contact address %q: use an email address", raw)
+	}
+	return address, nil
+}
+
+// ContactContext assembles what an agent needs to reply to a contact in one read:
+// recent threads with their last message and whose turn it is, open items, how the
+// user has written to them before, and remembered facts that mention them
+func (g *GmailServer) ContactContext(ctx context.Context, address string) (string, error) {
+	me := g.userEmail(ctx)
+
+	// Threads in either direction, most recent first
+	var threads []*gmail.Thread
+	seen := map[string]bool{}
+	for _, query := range []string{"from:" + address, "to:" + address} {
+		list, err := g.client.ListThreads(ctx, query, contactThreadLimit)
+		if err != nil {
+			return "", fmt.Errorf("failed to search threads with %s: %v", address, err)
+		}
+		for _, thread := range list.Threads {
+			if !seen[thread.Id] {
+				seen[thread.Id] = true
+				threads = append(threads, thread)
+			}
+		}
+	}
+	details := g.hydrateThreads(ctx, threads)
+
+	var recent []*gmail.Thread
+	for _, thread := range threads {
+		if detail, ok := details[thread.Id]; ok && len(detail.Messages) > 0 {
+			recent = append(recent, detail)
+		}
+	}
+	sort.Slice(recent, func(i, j int) bool {
+		return lastMessage(recent[i]).InternalDate > lastMessage(recent[j]).InternalDate
+	})
+	if len(recent) > contactThreadLimit {
+		recent = recent[:contactThreadLimit]
+	}
+
+	name := ""
+	var openItems, samples []string
+	var out strings.Builder
+	var threadSection strings.Builder
+	for _, thread := range recent {
+		latest := lastMessage(thread)
+		fromContact := strings.EqualFold(senderAddress(messageHeader(latest, "From")), address)
+		status := "waiting on them"
+		if fromContact {
+			status = "waiting on you"
+		} else if !hasLabelID(latest, "SENT") && !strings.EqualFold(senderAddress(messageHeader(latest, "From")), me) {
+			status = "last message from someone else"
+		}
+
+		subject := stripSubjectPrefixes(messageHeader(thread.Messages[0], "Subject"))
+		if subject == "" {
+			subject = "(no subject)"
+		}
+		fmt.Fprintf(&threadSection, "### %s\n- Thread: %s (%d messages)\n- Last message: %s from %s (%s)\n- Status: %s\n",
+			subject, thread.Id, len(thread.Messages), formatInternalDate(latest.InternalDate), messageHeader(latest, "From"), latest.Id, status)
+		if latest.Snippet != "" {
+			fmt.Fprintf(&threadSection, "- Summary: %s\n", latest.Snippet)
+		}
+		threadSection.WriteString("\n")
+
+		if fromContact {
+			item := fmt.Sprintf("Reply to \"%s\" (thread %s)", subject, thread.Id)
+			if hasLabelID(latest, "UNREAD") {
+				item += ", still unread"
+			}
+			openItems = append(openItems, item)
+		} else if status == "waiting on them" {
+			age := time.Since(time.UnixMilli(latest.InternalDate))
+			if age > 3*24*time.Hour {
+				openItems = append(openItems, fmt.Sprintf("No reply yet to your \"%s\" from %d days ago (thread %s); consider a follow-up", subject, int(age.Hours()/24), thread.Id))
+			}
+		}
+
+		for _, message := range thread.Messages {
+			from := messageHeader(message, "From")
+			if name == "" && strings.EqualFold(senderAddress(from), address) {
+				if parsed, err := mail.ParseAddress(from); err == nil {
+					name = parsed.Name
+				}
+			}
+			// The user's own words to this contact show the tone to match
+			if len(samples) < contactToneSamples && (hasLabelID(message, "SENT") || strings.EqualFold(senderAddress(from), me)) && addressedTo(messageHeader(message, "To"), address) {
+				if sample := stripQuotedText(extract.EmailBody(message)); sample != "" {
+					samples = append(samples, truncateText(sample, contactSampleChars))
+				}
+			}
+		}
+	}
+
+	title := address
+	if name != "" {
+		title = fmt.Sprintf("%s <%s>", name, address)
+	}
+	fmt.Fprintf(&out, "# Drafting Context: %s\n\n", title)
+
+	if len(recent) == 0 {
+		out.WriteString("No mail has been exchanged with this contact. Check sender_history before trusting requests from them.\n")
+		return out.String(), nil
+	}
+
+	out.WriteString("## Open Items\n\n")
+	if len(openItems) == 0 {
+		out.WriteString("Nothing is waiting on either side.\n")
+	}
+	for _, item := range openItems {
+		fmt.Fprintf(&out, "- %s\n", item)
+	}
+
+	out.WriteString("\n## Tone\n\n")
+	if facts := g.contactFacts(address, name); len(facts) > 0 {
+		out.WriteString("Remembered about this contact:\n")
+		for _, f := range facts {
+			fmt.Fprintf(&out, "- %s\n", f)
+		}
+		out.WriteString("\n")
+	}
+	if len(samples) == 0 {
+		out.WriteString("The user hasn't written to this contact recently; follow the personal email style guide.\n")
+	} else {
+		out.WriteString("How the user has written to this contact recently (match the greeting, sign-off and formality):\n\n")
+		for _, sample := range samples {
+			fmt.Fprintf(&out, "```\n%s\n```\n\n", sample)
+		}
+	}
+
+	out.WriteString("\n## Recent Threads\n\n")
+	out.WriteString(threadSection.String())
+	return out.String(), nil
+}
+
+// contactFacts returns remembered facts that mention the contact's address or name
+func (g *GmailServer) contactFacts(address, name string) []string {
+	store, err := g.loadMemory()
+	if err != nil {
+		return nil
+	}
+	var facts []string
+	for _, f := range store.Facts {
+		text := strings.ToLower(f.Fact)
+		if strings.Contains(text, address) || (name != "" && strings.Contains(text, strings.ToLower(name))) {
+			facts = append(facts, f.Fact)
+		}
+	}
+	return facts
+}
+
+// lastMessage returns a thread's most recent message
+func lastMessage(thread *gmail.Thread) *gmail.Message {
+	return thread.Messages[len(thread.Messages)-1]
+}
@@ -0,0 +1,498 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/mail"
+	"os"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"auto-gmail/internal/extract"
+	"auto-gmail/internal/style"
+	"auto-gmail/internal/toolerr"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// critiqueSampleCount is how many sent emails the draft is compared against
+const critiqueSampleCount = 50
+
+// minCritiqueLanguageSamples is how many sent emails in the draft's language are
+// needed to compare it with those alone
+const minCritiqueLanguageSamples = 3
+
+var (
+	// greetingPattern matches the opening word of a greeting line
+	greetingPattern = regexp.MustCompile(`(?i)^(good (?:morning|afternoon|evening)|hi there|hello|hiya|hey|hi|dear|greetings|morning|sehr geehrte[rs]?|liebe[rs]?|hallo|moin|bonjour|salut|chère|cher|hola|estimad[oa]s?|querid[oa]s?|buongiorno|ciao|olá|oi|beste|hej)(?:\s|,|!|$)`)
+	// closingPattern matches a sign-off line such as "Thanks," or "Best regards,"
+	closingPattern = regexp.MustCompile(`(?i)^(thanks so much|thanks again|thank you|many thanks|thanks|thx|best regards|kind regards|warm regards|regards|all the best|best wishes|best|cheers|sincerely|warmly|talk soon|mit freundlichen grüßen|viele grüße|beste grüße|liebe grüße|danke|cordialement|bien à vous|bisous|merci|un saludo|saludos|gracias|cordiali saluti|un saluto|grazie|abraços|obrigad[oa]|met vriendelijke groet|groeten|med vänliga hälsningar|hälsningar)[\s,.!]*$`)
+	// quotedPhrase pulls "quoted" examples out of the style guide
+	quotedPhrase = regexp.MustCompile(`["“]([^"”]{2,40})["”]`)
+)
+
+// stockPhrases are formal or generic phrases with plainer replacements; they're only
+// flagged when the user's own sent mail never uses them. An empty replacement means
+// the phrase can simply be cut.
+var stockPhrases = []struct{ phrase, replacement string }{
+	{"I hope this email finds you well. ", ""},
+	{"I hope this email finds you well.", ""},
+	{"I hope this finds you well. ", ""},
+	{"I hope this finds you well.", ""},
+	{"I am writing to ", "I'd like to "},
+	{"Please do not hesitate to contact me", "Let me know"},
+	{"Please don't hesitate to reach out", "Let me know"},
+	{"do not hesitate to", "feel free to"},
+	{"Per my last email", "As I mentioned"},
+	{"at your earliest convenience", "when you can"},
+	{"Please find attached", "I've attached"},
+	{"Kindly", "Please"},
+	{"in order to", "to"},
+	{"utilize", "use"},
+}
+
+// styleProfile is how the user writes, learned from their sent mail and style guide
+type styleProfile struct {
+	samples      int
+	greetings    map[string]int
+	closings     map[string]int
+	exclamations int
+	words        []int
+	text         string
+	// english is set for English drafts, the only ones checked for stock phrases
+	english bool
+	// guideGreetings, guideClosings and guideAvoid are quoted examples from the style guide
+	guideGreetings, guideClosings, guideAvoid []string
+}
+
+// critiqueIssue is one way the draft departs from the user's style, with the edit that fixes it
+type critiqueIssue struct {
+	Category string        `json:"category"`
+	Severity string        `json:"severity"`
+	Message  string        `json:"message"`
+	Edit     *critiqueEdit `json:"edit,omitempty"`
+	penalty  int
+}
+
+// critiqueEdit is a concrete change: replace find with text, or insert text at the
+// start or end of the body
+type critiqueEdit struct {
+	Action string `json:"action"`
+	Find   string `json:"find,omitempty"`
+	Text   string `json:"text"`
+}
+
+// CritiqueDraft scores a proposed email body against the personal style guide and the
+// user's recent sent mail (greeting, closing, phrasing, length) and returns concrete
+// edits plus the body with those edits applied, so a draft can be reviewed before it's saved
+func (g *GmailServer) CritiqueDraft(ctx context.Context, body, to string) (*mcp.CallToolResult, error) {
+	body = strings.TrimSpace(body)
+	if body == "" {
+		return toolerr.Invalid("body must not be empty"), nil
+	}
+
+	draft := stripQuotedText(body)
+	language := extract.DetectLanguage(draft)
+
+	sent, err := g.SentMessages(ctx, critiqueSampleCount)
+	if err != nil {
+		return toolerr.Result(err, "Failed to fetch sent messages"), nil
+	}
+	var texts, sameLanguage []string
+	for _, message := range sent {
+		text := stripQuotedText(extract.EmailBody(message))
+		if len(text) < 20 {
+			continue
+		}
+		texts = append(texts, text)
+		if language != "" && extract.DetectLanguage(text) == language {
+			sameLanguage = append(sameLanguage, text)
+		}
+	}
+	// Compare with mail in the draft's language when the user writes in it often enough
+	if len(sameLanguage) >= minCritiqueLanguageSamples {
+		texts = sameLanguage
+	}
+
+	profile := styleProfile{greetings: map[string]int{}, closings: map[string]int{}, english: language == "" || language == "en"}
+	for _, text := range texts {
+		profile.samples++
+		profile.greetings[greetingOf(text)]++
+		profile.closings[closingOf(text)]++
+		profile.exclamations += strings.Count(text, "!")
+		profile.words = append(profile.words, len(strings.Fields(text)))
+	}
+	profile.text = strings.ToLower(strings.Join(texts, "\n"))
+
+	guideFound := false
+	if guide, err := os.ReadFile(g.styleGuideFile); err == nil {
+		guideFound = true
+		profile.readGuide(guideSection(string(guide), language))
+	}
+	if profile.samples == 0 && !guideFound {
+		return toolerr.New(toolerr.NotFound, "no_style_reference", "There is no sent mail or personal email style guide to compare the draft against yet").
+			WithHint("Send some mail or run generate_style_guide first.").Result(), nil
+	}
+
+	var issues []critiqueIssue
+	issues = append(issues, profile.checkGreeting(draft, firstName(to))...)
+	issues = append(issues, profile.checkClosing(draft)...)
+	issues = append(issues, profile.checkLength(draft)...)
+	issues = append(issues, profile.checkPhrasing(draft)...)
+
+	score := 100
+	suggested := body
+	for _, issue := range issues {
+		score -= issue.penalty
+		if issue.Edit != nil {
+			suggested = applyCritiqueEdit(suggested, *issue.Edit)
+		}
+	}
+
+	usual := map[string]interface{}{
+		"samplesAnalyzed": profile.samples,
+	}
+	if greeting := profile.usualGreeting(); greeting != "" {
+		usual["greeting"] = greeting
+	}
+	if closing := profile.usualClosing(); closing != "" {
+		usual["closing"] = closing
+	}
+	if median := medianInt(profile.words); median > 0 {
+		usual["typicalWords"] = median
+	}
+
+	result := map[string]interface{}{
+		"score":           max(score, 0),
+		"issues":          issues,
+		"issueCount":      len(issues),
+		"wordCount":       len(strings.Fields(draft)),
+		"usualStyle":      usual,
+		"styleGuideFound": guideFound,
+	}
+	if language != "" {
+		result["language"] = extract.LanguageName(language)
+	}
+	if suggested != body {
+		result["suggestedBody"] = suggested
+	}
+	if !guideFound {
+		result["note"] = "No personal email style guide yet; the draft was compared with recent sent mail only"
+	}
+
+	resultJSON, _ := json.MarshalIndent(result, "", "  ")
+	return mcp.NewToolResultText(string(resultJSON)), nil
+}
+
+// readGuide collects quoted greetings, sign-offs and phrases to avoid from the style guide
+func (p *styleProfile) readGuide(guide string) {
+	for _, line := range strings.Split(guide, "\n") {
+		lower := strings.ToLower(line)
+		for _, match := range quotedPhrase.FindAllStringSubmatch(line, -1) {
+			quoted := strings.TrimSpace(match[1])
+			switch {
+			case strings.Contains(lower, "avoid") || strings.Contains(lower, "never") || strings.Contains(lower, "don't use"):
+				p.guideAvoid = append(p.guideAvoid, quoted)
+			case strings.Contains(lower, "greeting") || strings.Contains(lower, "opening"):
+				if greeting := greetingOf(quoted); greeting != "" {
+					p.guideGreetings = append(p.guideGreetings, greeting)
+				}
+			case strings.Contains(lower, "sign-off") || strings.Contains(lower, "sign off") || strings.Contains(lower, "closing"):
+				if closing := closingOf(quoted); closing != "" {
+					p.guideClosings = append(p.guideClosings, closing)
+				}
+			}
+		}
+	}
+}
+
+// guideSection returns the style guide's "## Writing in <language>" section for the
+// draft's language, or the guide without those sections for the main language
+func guideSection(guide, language string) string {
+	heading := "## writing in " + strings.ToLower(extract.LanguageName(language))
+	var main, section []string
+	inSection, inOther := false, false
+	for _, line := range strings.Split(guide, "\n") {
+		lower := strings.ToLower(strings.TrimSpace(line))
+		if strings.HasPrefix(lower, "## ") {
+			inSection = language != "" && lower == heading
+			inOther = !inSection && strings.HasPrefix(lower, "## writing in ")
+		}
+		switch {
+		case inSection:
+			section = append(section, line)
+		case !inOther:
+			main = append(main, line)
+		}
+	}
+	if len(section) > 0 {
+		return strings.Join(section, "\n") + "\n" + style.UserEdits(guide)
+	}
+	return strings.Join(main, "\n")
+}
+
+// usualGreeting is the style guide's greeting, else the one most sent mail opens with
+func (p *styleProfile) usualGreeting() string {
+	if len(p.guideGreetings) > 0 {
+		return p.guideGreetings[0]
+	}
+	return mostCommon(p.greetings)
+}
+
+// usualClosing is the style guide's sign-off, else the one most sent mail ends with
+func (p *styleProfile) usualClosing() string {
+	if len(p.guideClosings) > 0 {
+		return p.guideClosings[0]
+	}
+	return mostCommon(p.closings)
+}
+
+// checkGreeting flags a missing greeting when the user usually opens with one, and
+// a greeting the user doesn't use
+func (p *styleProfile) checkGreeting(draft, name string) []critiqueIssue {
+	usual := p.usualGreeting()
+	if usual == "" {
+		return nil
+	}
+	greeting := greetingOf(draft)
+	if greeting == "" {
+		if p.greetings[""]*2 > p.samples && len(p.guideGreetings) == 0 {
+			return nil
+		}
+		if name == "" {
+			name = "<first name>"
+		}
+		return []critiqueIssue{{
+			Category: "greeting",
+			Severity: "medium",
+			Message:  fmt.Sprintf("No greeting; the user usually opens with \"%s\"", capitalize(usual)),
+			Edit:     &critiqueEdit{Action: "insert_start", Text: fmt.Sprintf("%s %s,\n\n", capitalize(usual), name)},
+			penalty:  15,
+		}}
+	}
+	if greeting == usual || slices.Contains(p.guideGreetings, greeting) || p.greetings[greeting]*5 >= p.samples && p.greetings[greeting] > 0 {
+		return nil
+	}
+	return []critiqueIssue{{
+		Category: "greeting",
+		Severity: "medium",
+		Message:  fmt.Sprintf("Opens with \"%s\", but the user usually writes \"%s\"", capitalize(greeting), capitalize(usual)),
+		Edit:     &critiqueEdit{Action: "replace", Find: draft[:len(greeting)], Text: capitalize(usual)},
+		penalty:  15,
+	}}
+}
+
+// checkClosing flags a missing or unusual sign-off
+func (p *styleProfile) checkClosing(draft string) []critiqueIssue {
+	usual := p.usualClosing()
+	if usual == "" {
+		return nil
+	}
+	closing, line := closingLine(draft)
+	if closing == "" {
+		if p.closings[""]*2 > p.samples && len(p.guideClosings) == 0 {
+			return nil
+		}
+		return []critiqueIssue{{
+			Category: "closing",
+			Severity: "medium",
+			Message:  fmt.Sprintf("No sign-off; the user usually ends with \"%s,\"", capitalize(usual)),
+			Edit:     &critiqueEdit{Action: "append", Text: fmt.Sprintf("\n\n%s,", capitalize(usual))},
+			penalty:  15,
+		}}
+	}
+	if closing == usual || slices.Contains(p.guideClosings, closing) || p.closings[closing]*5 >= p.samples && p.closings[closing] > 0 {
+		return nil
+	}
+	return []critiqueIssue{{
+		Category: "closing",
+		Severity: "medium",
+		Message:  fmt.Sprintf("Signs off with \"%s\", but the user usually writes \"%s,\"", line, capitalize(usual)),
+		Edit:     &critiqueEdit{Action: "replace", Find: line, Text: capitalize(usual) + ","},
+		penalty:  15,
+	}}
+}
+
+// checkLength flags drafts much longer than the user's typical email
+func (p *styleProfile) checkLength(draft string) []critiqueIssue {
+	median := medianInt(p.words)
+	words := len(strings.Fields(draft))
+	if median == 0 || words <= 2*median || words < 80 {
+		return nil
+	}
+	severity, penalty := "medium", 10
+	if words > 4*median {
+		severity, penalty = "high", 20
+	}
+	return []critiqueIssue{{
+		Category: "length",
+		Severity: severity,
+		Message:  fmt.Sprintf("%d words; the user's emails are usually about %d. Cut it to the ask and the key facts", words, median),
+		penalty:  penalty,
+	}}
+}
+
+// checkPhrasing flags stock phrases the user doesn't use, phrases the style guide says
+// to avoid, and more exclamation marks than the user writes
+func (p *styleProfile) checkPhrasing(draft string) []critiqueIssue {
+	var issues []critiqueIssue
+	lower := strings.ToLower(draft)
+	phrasePenalty := 0
+	for _, stock := range stockPhrases {
+		if !p.english {
+			break
+		}
+		key := strings.ToLower(strings.TrimSpace(stock.phrase))
+		index := strings.Index(lower, strings.ToLower(stock.phrase))
+		if index < 0 || strings.Contains(p.text, key) || phrasePenalty >= 30 {
+			continue
+		}
+		// Skip the shorter variants of a phrase already flagged
+		if slices.ContainsFunc(issues, func(issue critiqueIssue) bool {
+			return issue.Edit != nil && strings.Contains(strings.ToLower(issue.Edit.Find), key)
+		}) {
+			continue
+		}
+		found := draft[index : index+len(stock.phrase)]
+		message := fmt.Sprintf("\"%s\" reads as stock phrasing the user doesn't use", strings.TrimSpace(found))
+		if stock.replacement == "" {
+			message += "; cut it"
+		} else {
+			message += fmt.Sprintf("; try \"%s\"", strings.TrimSpace(stock.replacement))
+		}
+		issues = append(issues, critiqueIssue{
+			Category: "phrasing",
+			Severity: "low",
+			Message:  message,
+			Edit:     &critiqueEdit{Action: "replace", Find: found, Text: matchCase(found, stock.replacement)},
+			penalty:  5,
+		})
+		phrasePenalty += 5
+	}
+
+	for _, avoid := range p.guideAvoid {
+		if strings.Contains(lower, strings.ToLower(avoid)) {
+			issues = append(issues, critiqueIssue{
+				Category: "phrasing",
+				Severity: "medium",
+				Message:  fmt.Sprintf("The style guide says to avoid \"%s\"", avoid),
+				penalty:  10,
+			})
+		}
+	}
+
+	if count := strings.Count(draft, "!"); count > 1 && p.samples > 0 && float64(count) > 2*float64(p.exclamations)/float64(p.samples)+1 {
+		issues = append(issues, critiqueIssue{
+			Category: "tone",
+			Severity: "low",
+			Message:  fmt.Sprintf("%d exclamation marks; the user averages %.1f per email", count, float64(p.exclamations)/float64(p.samples)),
+			penalty:  5,
+		})
+	}
+	return issues
+}
+
+// greetingOf returns the lowercase greeting a body opens with, or ""
+func greetingOf(body string) string {
+	first, _, _ := strings.Cut(strings.TrimSpace(body), "\n")
+	if match := greetingPattern.FindStringSubmatch(strings.TrimSpace(first)); match != nil {
+		return strings.ToLower(match[1])
+	}
+	return ""
+}
+
+// closingOf returns the lowercase sign-off near the end of a body, or ""
+func closingOf(body string) string {
+	closing, _ := closingLine(body)
+	return closing
+}
+
+// closingLine finds the sign-off among the last few lines of a body, returning it
+// normalized (e.g. "best regards") and as written
+func closingLine(body string) (string, string) {
+	lines := strings.Split(strings.TrimSpace(body), "\n")
+	checked := 0
+	for i := len(lines) - 1; i >= 0 && checked < 4; i-- {
+		line := strings.TrimSpace(lines[i])
+		if line == "" {
+			continue
+		}
+		checked++
+		if match := closingPattern.FindStringSubmatch(line); match != nil {
+			return strings.ToLower(match[1]), line
+		}
+	}
+	return "", ""
+}
+
+// firstName returns the first name from the first recipient's display name, or ""
+func firstName(to string) string {
+	addresses, err := mail.ParseAddressList(to)
+	if err != nil || len(addresses) == 0 {
+		return ""
+	}
+	name, _, _ := strings.Cut(strings.TrimSpace(addresses[0].Name), " ")
+	return name
+}
+
+// mostCommon returns the most frequent non-empty key of counts, or ""
+func mostCommon(counts map[string]int) string {
+	var keys []string
+	for key := range counts {
+		if key != "" {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if counts[keys[i]] != counts[keys[j]] {
+			return counts[keys[i]] > counts[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+	if len(keys) == 0 {
+		return ""
+	}
+	return keys[0]
+}
+
+// medianInt returns the median of values, or 0 when there are none
+func medianInt(values []int) int {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := slices.Clone(values)
+	slices.Sort(sorted)
+	return sorted[len(sorted)/2]
+}
+
+// capitalize upper-cases the first letter of s
+func capitalize(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
+
+// matchCase capitalizes replacement when the text it replaces starts a sentence
+func matchCase(found, replacement string) string {
+	if found != "" && strings.ToUpper(found[:1]) == found[:1] {
+		return capitalize(replacement)
+	}
+	return replacement
+}
+
+// applyCritiqueEdit applies one edit to body
+func applyCritiqueEdit(body string, edit critiqueEdit) string {
+	switch edit.Action {
+	case "insert_start":
+		return edit.Text + body
+	case "append":
+		return strings.TrimRight(body, "\n ") + edit.Text
+	case "replace":
+		return strings.Replace(body, edit.Find, edit.Text, 1)
+	}
+	return body
+}
@@ -0,0 +1,227 @@
+package tools
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"auto-gmail/internal/config"
+	"auto-gmail/internal/toolerr"
+)
+
+// dateRangeNames are the ranges the search tools understand, in the user's time zone
+var dateRangeNames = []string{"today", "yesterday", "this_week", "last_week", "this_month", "last_month", "this_year", "last_year", "last_N_days"}
+
+// Descriptions of the range and since parameters shared by the search tools
+const (
+	dateRangeDescription = "Only mail from this period in the user's time zone: today, yesterday, this_week, last_week (weeks start on Monday), this_month, last_month, this_year, last_year or last_N_days such as last_7_days (the N days up to and including today)"
+	sinceDescription     = "Only mail since this day in the user's time zone, e.g. 'yesterday', 'last Tuesday', '3 days ago', 'last month', 'March 5' or '2026-03-05'"
+)
+
+// maxRangeDays caps last_N_days at ten years
+const maxRangeDays = 3650
+
+var (
+	lastDaysPattern = regexp.MustCompile(`^last_(\d+)_days?$`)
+	agoPattern      = regexp.MustCompile(`^(\d+|a|an|one)\s+(day|week|month|year)s?\s+ago$`)
+	monthDayPattern = regexp.MustCompile(`^([a-z]+)\.?\s+(\d{1,2})(?:st|nd|rd|th)?(?:,?\s+(\d{4}))?$|^(\d{1,2})(?:st|nd|rd|th)?\s+([a-z]+)\.?(?:,?\s+(\d{4}))?$`)
+)
+
+// dateRange returns the first day of a named range and the day after it ends, both
+// at midnight in now's location, ready for after:/before:. Weeks start on Monday,
+// and last_N_days is the N days up to and including today.
+func dateRange(name string, now time.Time) (after, before time.Time, err error) {
+	today := startOfDay(now)
+	tomorrow := today.AddDate(0, 0, 1)
+	thisWeek := startOfWeek(today)
+	thisMonth := time.Date(today.Year(), today.Month(), 1, 0, 0, 0, 0, today.Location())
+	thisYear := time.Date(today.Year(), time.January, 1, 0, 0, 0, 0, today.Location())
+
+	name = strings.ToLower(strings.TrimSpace(name))
+	switch name {
+	case "today":
+		return today, tomorrow, nil
+	case "yesterday":
+		return today.AddDate(0, 0, -1), today, nil
+	case "this_week":
+		return thisWeek, tomorrow, nil
+	case "last_week":
+		return thisWeek.AddDate(0, 0, -7), thisWeek, nil
+	case "this_month":
+		return thisMonth, tomorrow, nil
+	case "last_month":
+		return thisMonth.AddDate(0, -1, 0), thisMonth, nil
+	case "this_year":
+		return thisYear, tomorrow, nil
+	case "last_year":
+		return thisYear.AddDate(-1, 0, 0), thisYear, nil
+	}
+	if match := lastDaysPattern.FindStringSubmatch(name); match != nil {
+		days, _ := strconv.Atoi(match[1])
+		if days >= 1 && days <= maxRangeDays {
+			return today.AddDate(0, 0, 1-days), tomorrow, nil
+		}
+	}
+	return time.Time{}, time.Time{}, toolerr.Errorf(toolerr.InvalidInput, "invalid_date_range", "invalid range %q: use %s (e.g. last_7_days)", name, strings.Join(dateRangeNames, ", "))
+}
+
+// sinceDate resolves a phrase such as "yesterday", "last Tuesday", "3 days ago",
+// "last month", "March 5" or "2026-03-05" to the midnight it starts from, in now's
+// location. Dates without a year and bare weekdays mean the most recent one before today.
+func sinceDate(phrase string, now time.Time) (time.Time, error) {
+	today := startOfDay(now)
+	text := strings.ToLower(strings.Join(strings.Fields(strings.Trim(phrase, `"' `)), " "))
+
+	switch text {
+	case "today":
+		return today, nil
+	case "yesterday":
+		return today.AddDate(0, 0, -1), nil
+	}
+	for _, layout := range []string{"2006-01-02", "2006/01/02", "2006-1-2", "2006/1/2"} {
+		if parsed, err := time.ParseInLocation(layout, text, today.Location()); err == nil {
+			return parsed, nil
+		}
+	}
+
+	// "last week", "this month": where that period starts
+	if period, ok := strings.CutPrefix(text, "last "); ok {
+		if start, _, err := dateRange("last_"+strings.ReplaceAll(period, " ", "_"), now); err == nil {
+			return start, nil
+		}
+	}
+	if period, ok := strings.CutPrefix(text, "this "); ok {
+		if start, _, err := dateRange("this_"+period, now); err == nil {
+			return start, nil
+		}
+	}
+
+	// "tuesday", "last tuesday": the most recent one before today
+	weekday := strings.TrimPrefix(text, "last ")
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		name := strings.ToLower(day.String())
+		if weekday == name || weekday == name[:3] {
+			back := (int(today.Weekday()) - int(day) + 7) % 7
+			if back == 0 {
+				back = 7
+			}
+			return today.AddDate(0, 0, -back), nil
+		}
+	}
+
+	if match := agoPattern.FindStringSubmatch(text); match != nil {
+		n, err := strconv.Atoi(match[1])
+		if err != nil {
+			n = 1
+		}
+		switch match[2] {
+		case "day":
+			return today.AddDate(0, 0, -n), nil
+		case "week":
+			return today.AddDate(0, 0, -7*n), nil
+		case "month":
+			return addMonths(today, -n), nil
+		case "year":
+			return addMonths(today, -12*n), nil
+		}
+	}
+
+	// "march 5", "5 march 2026"
+	if match := monthDayPattern.FindStringSubmatch(text); match != nil {
+		monthName, day, year := match[1], match[2], match[3]
+		if monthName == "" {
+			monthName, day, year = match[5], match[4], match[6]
+		}
+		if month, ok := monthNumber(monthName); ok {
+			d, _ := strconv.Atoi(day)
+			y := today.Year()
+			if year != "" {
+				y, _ = strconv.Atoi(year)
+			}
+			date := time.Date(y, month, d, 0, 0, 0, 0, today.Location())
+			if year == "" && date.After(today) {
+				date = time.Date(y-1, month, d, 0, 0, 0, 0, today.Location())
+			}
+			// February 30 would roll over into March
+			if date.Day() != d {
+				return time.Time{}, toolerr.Errorf(toolerr.InvalidInput, "invalid_date_range", "invalid since %q: %s has no day %d", phrase, month, d)
+			}
+			return date, nil
+		}
+	}
+	return time.Time{}, toolerr.Errorf(toolerr.InvalidInput, "invalid_date_range", "could not understand since %q: use a date (YYYY-MM-DD, 'March 5'), a weekday ('last Tuesday'), 'yesterday', 'N days ago' or 'last week/month/year'", phrase)
+}
+
+// monthNumber reads a month name or its first three letters
+func monthNumber(name string) (time.Month, bool) {
+	for month := time.January; month <= time.December; month++ {
+		full := strings.ToLower(month.String())
+		if name == full || (len(name) >= 3 && strings.HasPrefix(full, name)) {
+			return month, true
+		}
+	}
+	return 0, false
+}
+
+// resolveDates turns a named range or a since phrase, read in the user's time zone,
+// into after:/before: dates (YYYY/MM/DD); before is empty for since
+func resolveDates(rangeName, since string) (after, before string, err error) {
+	rangeName, since = strings.TrimSpace(rangeName), strings.TrimSpace(since)
+	switch {
+	case rangeName != "" && since != "":
+		return "", "", toolerr.Errorf(toolerr.InvalidInput, "invalid_date_range", "use range or since, not both")
+	case rangeName != "":
+		start, end, err := dateRange(rangeName, userNow())
+		if err != nil {
+			return "", "", err
+		}
+		return start.Format("2006/01/02"), end.Format("2006/01/02"), nil
+	case since != "":
+		start, err := sinceDate(since, userNow())
+		if err != nil {
+			return "", "", err
+		}
+		return start.Format("2006/01/02"), "", nil
+	}
+	return "", "", nil
+}
+
+// withDates narrows query to a named range or to mail since a phrase; empty ones
+// leave it as is
+func withDates(query, rangeName, since string) (string, error) {
+	after, before, err := resolveDates(rangeName, since)
+	if err != nil {
+		return "", err
+	}
+	if after != "" {
+		query += " after:" + after
+	}
+	if before != "" {
+		query += " before:" + before
+	}
+	return strings.TrimSpace(query), nil
+}
+
+// startOfDay is midnight at the start of t's day, in t's location
+func startOfDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+// addMonths moves day by months, to the last day of the month when it's shorter, so a
+// month before March 31 is February 28 rather than March 3
+func addMonths(day time.Time, months int) time.Time {
+	first := time.Date(day.Year(), day.Month()+time.Month(months), 1, 0, 0, 0, 0, day.Location())
+	last := first.AddDate(0, 1, -1).Day()
+	return time.Date(first.Year(), first.Month(), min(day.Day(), last), 0, 0, 0, 0, day.Location())
+}
+
+// startOfWeek is the Monday on or before day
+func startOfWeek(day time.Time) time.Time {
+	return day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+}
+
+// userNow is the current time in the user's time zone
+func userNow() time.Time {
+	return time.Now().In(config.TimeZone())
+}
@@ -0,0 +1,159 @@
+package tools
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// newYork is a zone with daylight saving time; 2026-03-08 and 2026-11-01 are the days
+// it starts and ends
+func newYork(t *testing.T) *time.Location {
+	t.Helper()
+	location, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return location
+}
+
+func TestDateRange(t *testing.T) {
+	location := newYork(t)
+	springForward := time.Date(2026, 3, 8, 12, 0, 0, 0, location) // a Sunday
+	tests := []struct {
+		name          string
+		rangeName     string
+		now           time.Time
+		after, before string
+		wantErr       bool
+	}{
+		{"today", "today", springForward, "2026/03/08", "2026/03/09", false},
+		{"yesterday", "Yesterday", springForward, "2026/03/07", "2026/03/08", false},
+		{"this week starts on Monday", "this_week", springForward, "2026/03/02", "2026/03/09", false},
+		{"last week", "last_week", springForward, "2026/02/23", "2026/03/02", false},
+		{"this month", "this_month", springForward, "2026/03/01", "2026/03/09", false},
+		{"last month", "last_month", springForward, "2026/02/01", "2026/03/01", false},
+		{"this year", "this_year", springForward, "2026/01/01", "2026/03/09", false},
+		{"last year", "last_year", springForward, "2025/01/01", "2026/01/01", false},
+		{"last N days includes today", "last_7_days", springForward, "2026/03/02", "2026/03/09", false},
+		{"last day", "last_1_day", springForward, "2026/03/08", "2026/03/09", false},
+		{"last month on the 31st", "last_month", time.Date(2026, 3, 31, 9, 0, 0, 0, location), "2026/02/01", "2026/03/01", false},
+		{"this month on the 31st", "this_month", time.Date(2026, 3, 31, 9, 0, 0, 0, location), "2026/03/01", "2026/04/01", false},
+		{"last month in January", "last_month", time.Date(2026, 1, 31, 9, 0, 0, 0, location), "2025/12/01", "2026/01/01", false},
+		// 03:30 UTC on March 8 is still the evening of March 7 in New York
+		{"the user's day, not UTC's", "today", time.Date(2026, 3, 8, 3, 30, 0, 0, time.UTC).In(location), "2026/03/07", "2026/03/08", false},
+		{"zero days", "last_0_days", springForward, "", "", true},
+		{"too many days", "last_3651_days", springForward, "", "", true},
+		{"unknown range", "fortnight", springForward, "", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			after, before, err := dateRange(tt.rangeName, tt.now)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("dateRange(%q) = %v, %v, want an error", tt.rangeName, after, before)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("dateRange(%q) error = %v", tt.rangeName, err)
+			}
+			if got := after.Format("2006/01/02"); got != tt.after {
+				t.Errorf("dateRange(%q) after = %s, want %s", tt.rangeName, got, tt.after)
+			}
+			if got := before.Format("2006/01/02"); got != tt.before {
+				t.Errorf("dateRange(%q) before = %s, want %s", tt.rangeName, got, tt.before)
+			}
+			for _, bound := range []time.Time{after, before} {
+				if bound.Location() != location || bound.Hour() != 0 || bound.Minute() != 0 {
+					t.Errorf("dateRange(%q) bound %v isn't midnight in New York", tt.rangeName, bound)
+				}
+			}
+		})
+	}
+}
+
+func TestDateRangeAcrossDaylightSaving(t *testing.T) {
+	location := newYork(t)
+	tests := []struct {
+		name string
+		now  time.Time
+		want time.Duration
+	}{
+		{"clocks go forward", time.Date(2026, 3, 8, 12, 0, 0, 0, location), 23 * time.Hour},
+		{"clocks go back", time.Date(2026, 11, 1, 12, 0, 0, 0, location), 25 * time.Hour},
+		{"ordinary day", time.Date(2026, 3, 9, 12, 0, 0, 0, location), 24 * time.Hour},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			after, before, err := dateRange("today", tt.now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := before.Sub(after); got != tt.want {
+				t.Errorf("today runs from %v to %v, %v long, want %v", after, before, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSinceDate(t *testing.T) {
+	location := newYork(t)
+	sunday := time.Date(2026, 3, 8, 12, 0, 0, 0, location) // the day clocks go forward
+	endOfMarch := time.Date(2026, 3, 31, 9, 0, 0, 0, location)
+	tests := []struct {
+		phrase  string
+		now     time.Time
+		want    string
+		wantErr string
+	}{
+		{"today", sunday, "2026/03/08", ""},
+		{" Yesterday ", sunday, "2026/03/07", ""},
+		{"2026-03-05", sunday, "2026/03/05", ""},
+		{"2026/3/5", sunday, "2026/03/05", ""},
+		{"last week", sunday, "2026/02/23", ""},
+		{"this week", sunday, "2026/03/02", ""},
+		{"last month", sunday, "2026/02/01", ""},
+		{"last 7 days", sunday, "2026/03/02", ""},
+		{"Tuesday", sunday, "2026/03/03", ""},
+		{"last Sun", sunday, "2026/03/01", ""},
+		{"3 days ago", sunday, "2026/03/05", ""},
+		{"a week ago", sunday, "2026/03/01", ""},
+		{"March 5", sunday, "2026/03/05", ""},
+		{"mar. 8", sunday, "2026/03/08", ""},
+		{"December 25", sunday, "2025/12/25", ""},
+		{"5th March 2025", sunday, "2025/03/05", ""},
+		{"last month", endOfMarch, "2026/02/01", ""},
+		{"1 month ago", endOfMarch, "2026/02/28", ""},
+		{"3 months ago", endOfMarch, "2025/12/31", ""},
+		{"a year ago", time.Date(2028, 2, 29, 9, 0, 0, 0, location), "2027/02/28", ""},
+		{"Feb 30", endOfMarch, "", "has no day 30"},
+		{"next friday", sunday, "", "could not understand"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.phrase, func(t *testing.T) {
+			got, err := sinceDate(tt.phrase, tt.now)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("sinceDate(%q) = %v, %v, want an error mentioning %q", tt.phrase, got, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("sinceDate(%q) error = %v", tt.phrase, err)
+			}
+			if formatted := got.Format("2006/01/02"); formatted != tt.want || got.Location() != location || got.Hour() != 0 {
+				t.Errorf("sinceDate(%q) = %v, want midnight on %s in New York", tt.phrase, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveDatesRangeAndSince(t *testing.T) {
+	if _, _, err := resolveDates("today", "yesterday"); err == nil || !strings.Contains(err.Error(), "not both") {
+		t.Errorf("resolveDates() with a range and since = %v, want an error", err)
+	}
+	if after, before, err := resolveDates(" ", ""); after != "" || before != "" || err != nil {
+		t.Errorf("resolveDates() with neither = %q, %q, %v, want nothing", after, before, err)
+	}
+}
@@ -0,0 +1,385 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/mail"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"auto-gmail/internal/config"
+	"auto-gmail/internal/extract"
+	"auto-gmail/internal/toolerr"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"google.golang.org/api/gmail/v1"
+)
+
+// Deadline scan limits
+const (
+	defaultDeadlineDays = 14
+	maxDeadlineDays     = 90
+	// maxDeadlineScan caps how many messages extract_deadlines reads
+	maxDeadlineScan = 100
+	// deadlineContextChars caps the sentence quoted with each deadline
+	deadlineContextChars = 240
+	// deadlineYearWrapDays is how far before the message a yearless date may fall
+	// before it's read as next year's ("due January 5" in a December email)
+	deadlineYearWrapDays = 60
+)
+
+var (
+	deadlineWeekdays = `(?:mon|tues?|wed(?:nes)?|thu(?:rs?)?|fri|sat(?:ur)?|sun)(?:day)?`
+	deadlineMonths   = `(?:jan|feb|mar|apr|may|jun|jul|aug|sep|sept|oct|nov|dec)[a-z]*\.?`
+	// deadlinePattern finds a deadline word followed by a date, and optionally a time
+	deadlinePattern = regexp.MustCompile(`(?i)\b(?:by|due(?:\s+(?:on|by))?|before|no later than|deadline(?:\s+is)?:?|until|expires?(?:\s+on)?|closes?(?:\s+on)?)\s+(?:the\s+)?(` +
+		`today|tonight|tomorrow|eod|cob|eow|eom|end of (?:the )?(?:day|week|month)|` +
+		`(?:this\s+|next\s+)?` + deadlineWeekdays + `|` +
+		deadlineMonths + `\s+\d{1,2}(?:st|nd|rd|th)?(?:,?\s+\d{4})?|` +
+		`\d{1,2}(?:st|nd|rd|th)?\s+(?:of\s+)?` + deadlineMonths + `(?:,?\s+\d{4})?|` +
+		`\d{4}-\d{2}-\d{2}|` +
+		`\d{1,2}/\d{1,2}(?:/\d{2,4})?` +
+		`)\b(?:\s+at\s+(\d{1,2}(?::\d{2})?\s*(?:am|pm)?|noon|midnight)\b)?`)
+	// deadlineSelfPattern marks a sentence where the writer commits to something
+	deadlineSelfPattern = regexp.MustCompile(`(?i)\b(?:i'll|i will|i'm going to|we'll|we will|i can|we can|let me|i'd|we'd)\b`)
+	// deadlineRequestPattern marks a sentence asking the reader to do something
+	deadlineRequestPattern = regexp.MustCompile(`(?i)\b(?:please|could you|can you|would you|you need|you must|you should|you'll need|kindly)\b`)
+	deadlineOrdinal        = regexp.MustCompile(`(?i)(\d)(?:st|nd|rd|th)\b`)
+	deadlineTimePattern    = regexp.MustCompile(`^(\d{1,2})(?::(\d{2}))?\s*(am|pm)?$`)
+)
+
+// deadline is one date a message commits someone to
+type deadline struct {
+	Date     string `json:"date"`           // YYYY-MM-DD in the user's time zone
+	Time     string `json:"time,omitempty"` // HH:MM, when the text gives one
+	Weekday  string `json:"weekday"`
+	DaysLeft int    `json:"daysLeft"`
+	Phrase   string `json:"phrase"`
+	Context  string `json:"context"`
+	// Owner is who has to act: "you", "them", or empty when the text doesn't say
+	Owner     string `json:"owner,omitempty"`
+	Subject   string `json:"subject"`
+	From      string `json:"from"`
+	Sent      string `json:"sent"`
+	MessageID string `json:"messageId"`
+	ThreadID  string `json:"threadId"`
+	Link      string `json:"link,omitempty"`
+
+	at time.Time
+}
+
+// ExtractDeadlines scans the past days of mail (narrowed by query) for deadlines and
+// commitments such as "by Friday" or "due March 3", resolves each against the date of
+// its message into an absolute date in the user's time zone, and lists them in date
+// order with their source. With ics they're also written to a calendar file.
+func (g *GmailServer) ExtractDeadlines(ctx context.Context, days int, query string, includePast, ics bool) (*mcp.CallToolResult, error) {
+	if days <= 0 {
+		days = defaultDeadlineDays
+	}
+	if days > maxDeadlineDays {
+		return toolerr.Invalid(fmt.Sprintf("Maximum %d days allowed per request", maxDeadlineDays)), nil
+	}
+	query = strings.TrimSpace(query)
+	if query != "" {
+		if problems := lintQuery(query); len(problems) > 0 {
+			return invalidQueryError(query, problems), nil
+		}
+	}
+	search := strings.TrimSpace(fmt.Sprintf("newer_than:%dd -category:promotions -category:social %s", days, query))
+
+	listed, err := g.client.ListMessages(ctx, search, maxDeadlineScan)
+	if err != nil {
+		return toolerr.Result(err, "Failed to search messages"), nil
+	}
+	messageIDs := make([]string, len(listed.Messages))
+	for i, message := range listed.Messages {
+		messageIDs[i] = message.Id
+	}
+	messages := g.hydrateMessages(ctx, messageIDs)
+
+	me := g.userEmail(ctx)
+	today := startOfDay(userNow())
+	deadlines := []deadline{}
+	seen := map[string]bool{}
+	for _, id := range messageIDs {
+		message, ok := messages[id]
+		if !ok || hasLabelID(message, "DRAFT") {
+			continue
+		}
+		for _, d := range messageDeadlines(message, me) {
+			key := d.ThreadID + "|" + d.Date
+			if seen[key] || (!includePast && d.at.Before(today)) {
+				continue
+			}
+			seen[key] = true
+			d.DaysLeft = int(startOfDay(d.at).Sub(today).Round(24*time.Hour).Hours() / 24)
+			deadlines = append(deadlines, d)
+		}
+	}
+	sort.SliceStable(deadlines, func(i, j int) bool { return deadlines[i].at.Before(deadlines[j].at) })
+
+	result := map[string]interface{}{
+		"query":           search,
+		"timeZone":        config.TimeZone().String(),
+		"messagesScanned": len(messageIDs),
+		"deadlineCount":   len(deadlines),
+		"deadlines":       deadlines,
+	}
+	if len(messageIDs) >= maxDeadlineScan {
+		result["note"] = fmt.Sprintf("Only the %d most recent messages were scanned; narrow days or query to cover the rest.", maxDeadlineScan)
+	}
+	if ics {
+		path := g.dataFile("deadlines.ics")
+		calendar := deadlinesICS(deadlines)
+		// The calendar holds mailbox details, so it's private to the user like the other
+		// data files; WriteFile keeps the mode of a file an older version wrote
+		err := os.WriteFile(path, []byte(calendar), 0600)
+		if err == nil {
+			err = os.Chmod(path, 0600)
+		}
+		if err != nil {
+			return toolerr.Result(err, fmt.Sprintf("Failed to write %s", path)), nil
+		}
+		result["icsFile"] = path
+		result["ics"] = calendar
+	}
+
+	resultJSON, _ := json.MarshalIndent(result, "", "  ")
+	return mcp.NewToolResultText(string(resultJSON)), nil
+}
+
+// messageDeadlines finds the deadlines in a message's own text, leaving out quoted replies
+func messageDeadlines(message *gmail.Message, me string) []deadline {
+	body := stripQuotedText(extract.EmailBody(message))
+	if body == "" {
+		return nil
+	}
+	sent := time.UnixMilli(message.InternalDate).In(config.TimeZone())
+	if parsed, err := mail.ParseDate(messageHeader(message, "Date")); err == nil {
+		sent = parsed.In(config.TimeZone())
+	}
+	from := messageHeader(message, "From")
+	fromMe := hasLabelID(message, "SENT") || (me != "" && strings.EqualFold(senderAddress(from), me))
+
+	var found []deadline
+	for _, match := range deadlinePattern.FindAllStringSubmatchIndex(body, -1) {
+		day, ok := resolveDeadlineDate(body[match[2]:match[3]], sent)
+		if !ok {
+			continue
+		}
+		d := deadline{
+			Phrase:    strings.Join(strings.Fields(body[match[0]:match[1]]), " "),
+			Context:   deadlineSentence(body, match[0], match[1]),
+			Subject:   messageHeader(message, "Subject"),
+			From:      from,
+			Sent:      sent.Format(time.RFC3339),
+			MessageID: message.Id,
+			ThreadID:  message.ThreadId,
+			at:        day,
+		}
+		if match[4] >= 0 {
+			if hour, minute, ok := parseDeadlineTime(body[match[4]:match[5]]); ok {
+				d.at = day.Add(time.Duration(hour)*time.Hour + time.Duration(minute)*time.Minute)
+				d.Time = d.at.Format("15:04")
+			}
+		}
+		d.Date, d.Weekday = d.at.Format("2006-01-02"), d.at.Weekday().String()
+
+		// The writer commits, or asks the reader; either way, who acts depends on who wrote
+		switch {
+		case deadlineSelfPattern.MatchString(d.Context):
+			d.Owner = map[bool]string{true: "you", false: "them"}[fromMe]
+		case deadlineRequestPattern.MatchString(d.Context):
+			d.Owner = map[bool]string{true: "them", false: "you"}[fromMe]
+		}
+		if config.Provider() == "gmail" {
+			d.Link = "https://mail.google.com/mail/#all/" + message.ThreadId
+		}
+		found = append(found, d)
+	}
+	return found
+}
+
+// resolveDeadlineDate turns a date phrase into midnight of that day, reading relative
+// phrases ("Friday", "tomorrow", "end of month") against ref, the message's date
+func resolveDeadlineDate(phrase string, ref time.Time) (time.Time, bool) {
+	phrase = strings.ToLower(strings.Join(strings.Fields(phrase), " "))
+	day := startOfDay(ref)
+	switch phrase {
+	case "today", "tonight", "eod", "cob", "end of day", "end of the day":
+		return day, true
+	case "tomorrow":
+		return day.AddDate(0, 0, 1), true
+	case "eow", "end of week", "end of the week":
+		friday := startOfWeek(day).AddDate(0, 0, 4)
+		if friday.Before(day) {
+			friday = friday.AddDate(0, 0, 7)
+		}
+		return friday, true
+	case "eom", "end of month", "end of the month":
+		return time.Date(day.Year(), day.Month()+1, 0, 0, 0, 0, 0, day.Location()), true
+	}
+
+	next := strings.HasPrefix(phrase, "next ")
+	name := strings.TrimPrefix(strings.TrimPrefix(phrase, "next "), "this ")
+	for weekday := time.Sunday; weekday <= time.Saturday; weekday++ {
+		full := strings.ToLower(weekday.String())
+		if name == full || (len(name) >= 3 && strings.HasPrefix(full, name)) {
+			// The next such day after the message; "next Friday" is in the following week
+			ahead := (int(weekday) - int(day.Weekday()) + 7) % 7
+			if ahead == 0 {
+				ahead = 7
+			}
+			date := day.AddDate(0, 0, ahead)
+			if next && startOfWeek(date).Equal(startOfWeek(day)) {
+				date = date.AddDate(0, 0, 7)
+			}
+			return date, true
+		}
+	}
+
+	if date, err := time.ParseInLocation("2006-01-02", phrase, day.Location()); err == nil {
+		return date, true
+	}
+
+	var month time.Month
+	var dayOfMonth, year int
+	if parts := strings.Split(phrase, "/"); len(parts) >= 2 {
+		// US order, like the rest of the server's date parsing
+		m, err1 := strconv.Atoi(parts[0])
+		d, err2 := strconv.Atoi(parts[1])
+		if err1 != nil || err2 != nil || m < 1 || m > 12 {
+			return time.Time{}, false
+		}
+		month, dayOfMonth = time.Month(m), d
+		if len(parts) == 3 {
+			year, _ = strconv.Atoi(parts[2])
+			if year < 100 {
+				year += 2000
+			}
+		}
+	} else {
+		fields := strings.Fields(strings.NewReplacer(",", " ", ".", " ", " of ", " ").Replace(deadlineOrdinal.ReplaceAllString(phrase, "$1")))
+		if len(fields) < 2 {
+			return time.Time{}, false
+		}
+		dayField, monthField := fields[1], fields[0]
+		if _, err := strconv.Atoi(fields[0]); err == nil {
+			dayField, monthField = fields[0], fields[1]
+		}
+		var ok bool
+		if month, ok = monthNumber(monthField); !ok {
+			return time.Time{}, false
+		}
+		dayOfMonth, _ = strconv.Atoi(dayField)
+		if len(fields) >= 3 {
+			year, _ = strconv.Atoi(fields[2])
+		}
+	}
+
+	explicitYear := year != 0
+	if !explicitYear {
+		year = day.Year()
+	}
+	date := time.Date(year, month, dayOfMonth, 0, 0, 0, 0, day.Location())
+	if date.Day() != dayOfMonth {
+		return time.Time{}, false
+	}
+	if !explicitYear && date.Before(day.AddDate(0, 0, -deadlineYearWrapDays)) {
+		date = date.AddDate(1, 0, 0)
+	}
+	return date, true
+}
+
+// parseDeadlineTime reads "5pm", "5:30 pm", "17:00", "noon" or "midnight"
+func parseDeadlineTime(text string) (hour, minute int, ok bool) {
+	text = strings.ToLower(strings.TrimSpace(text))
+	switch text {
+	case "noon":
+		return 12, 0, true
+	case "midnight":
+		return 23, 59, true
+	}
+	match := deadlineTimePattern.FindStringSubmatch(text)
+	if match == nil {
+		return 0, 0, false
+	}
+	hour, _ = strconv.Atoi(match[1])
+	if match[2] != "" {
+		minute, _ = strconv.Atoi(match[2])
+	}
+	switch match[3] {
+	case "pm":
+		if hour < 12 {
+			hour += 12
+		}
+	case "am":
+		if hour == 12 {
+			hour = 0
+		}
+	case "":
+		// "by 5" without am/pm means office hours, not 5 in the morning
+		if match[2] == "" && hour >= 1 && hour <= 7 {
+			hour += 12
+		}
+	}
+	if hour > 23 || minute > 59 {
+		return 0, 0, false
+	}
+	return hour, minute, true
+}
+
+// deadlineSentence is the sentence around a match, on one line and capped in length
+func deadlineSentence(text string, start, end int) string {
+	from := strings.LastIndexAny(text[:start], ".!?\n") + 1
+	to := len(text)
+	if i := strings.IndexAny(text[end:], ".!?\n"); i >= 0 {
+		to = end + i + 1
+	}
+	sentence := strings.Join(strings.Fields(text[from:to]), " ")
+	if len(sentence) > deadlineContextChars {
+		sentence = truncateText(sentence, deadlineContextChars) + "…"
+	}
+	return sentence
+}
+
+// deadlinesICS renders deadlines as calendar events: timed ones as 30-minute events,
+// the rest as all-day events
+func deadlinesICS(deadlines []deadline) string {
+	lines := []string{"BEGIN:VCALENDAR", "VERSION:2.0", "PRODID:-//auto-gmail//Deadlines//EN", "CALSCALE:GREGORIAN"}
+	stamp := time.Now().UTC().Format("20060102T150405Z")
+	for _, d := range deadlines {
+		lines = append(lines,
+			"BEGIN:VEVENT",
+			fmt.Sprintf("UID:%s-%s@auto-gmail", d.MessageID, d.at.Format("20060102T1504")),
+			"DTSTAMP:"+stamp,
+		)
+		if d.Time != "" {
+			lines = append(lines,
+				"DTSTART:"+d.at.UTC().Format("20060102T150405Z"),
+				"DTEND:"+d.at.Add(30*time.Minute).UTC().Format("20060102T150405Z"),
+			)
+		} else {
+			lines = append(lines,
+				"DTSTART;VALUE=DATE:"+d.at.Format("20060102"),
+				"DTEND;VALUE=DATE:"+d.at.AddDate(0, 0, 1).Format("20060102"),
+			)
+		}
+		summary := "Deadline: " + d.Subject
+		if d.Owner == "you" {
+			summary = "Due from you: " + d.Subject
+		}
+		description := fmt.Sprintf("%s\nFrom: %s", d.Context, d.From)
+		if d.Link != "" {
+			description += "\n" + d.Link
+		}
+		lines = append(lines, "SUMMARY:"+icsEscape(summary), "DESCRIPTION:"+icsEscape(description), "END:VEVENT")
+	}
+	lines = append(lines, "END:VCALENDAR")
+	return strings.Join(lines, "\r\n") + "\r\n"
+}
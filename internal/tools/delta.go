@@ -0,0 +1,82 @@
+package tools
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/server"
+	"google.golang.org/api/gmail/v1"
+)
+
+// deltaSessionTTL is how long an idle session's fetch cursors are kept
+const deltaSessionTTL = 24 * time.Hour
+
+// deltaTracker remembers, per MCP session, which messages of each thread were
+// already returned by fetch_email_bodies, for context_mode=delta
+type deltaTracker struct {
+	mu       sync.Mutex
+	sessions map[string]*deltaSession
+}
+
+// deltaSession is one session's fetch cursors
+type deltaSession struct {
+	lastUsed time.Time
+	// seen maps a thread ID to the IDs of the messages already returned
+	seen map[string]map[string]bool
+}
+
+func newDeltaTracker() *deltaTracker {
+	return &deltaTracker{sessions: map[string]*deltaSession{}}
+}
+
+// deltaSessionID identifies the calling MCP session; stdio has a single session
+func deltaSessionID(ctx context.Context) string {
+	if session := server.ClientSessionFromContext(ctx); session != nil {
+		return session.SessionID()
+	}
+	return ""
+}
+
+// newMessages returns the messages of thread this session hasn't been given yet and
+// records the whole thread as seen. known is false the first time the session
+// fetches the thread, when every message is new.
+func (t *deltaTracker) newMessages(ctx context.Context, thread *gmail.Thread) (messages []*gmail.Message, known bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	for id, session := range t.sessions {
+		if now.Sub(session.lastUsed) > deltaSessionTTL {
+			delete(t.sessions, id)
+		}
+	}
+
+	sessionID := deltaSessionID(ctx)
+	session, ok := t.sessions[sessionID]
+	if !ok {
+		session = &deltaSession{seen: map[string]map[string]bool{}}
+		t.sessions[sessionID] = session
+	}
+	session.lastUsed = now
+
+	seen, known := session.seen[thread.Id]
+	if !known {
+		seen = map[string]bool{}
+		session.seen[thread.Id] = seen
+	}
+	for _, message := range thread.Messages {
+		if !seen[message.Id] {
+			messages = append(messages, message)
+			seen[message.Id] = true
+		}
+	}
+	return messages, known
+}
+
+// endSession forgets a session's fetch cursors once it has ended
+func (t *deltaTracker) endSession(sessionID string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.sessions, sessionID)
+}
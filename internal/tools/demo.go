@@ -0,0 +1,42 @@
+package tools
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+
+	"auto-gmail/internal/config"
+	"auto-gmail/internal/gmailclient"
+)
+
+// demoThreadCount is the size of the generated mailbox in demo mode
+const demoThreadCount = 24
+
+// demoStyleGuide is served in demo mode instead of a generated style guide
+const demoStyleGuide = `# Personal Email Style Guide (demo)
+
+- Greeting: "Hi <first name>," for colleagues, no greeting for quick replies
+- Tone: friendly, direct and brief; two or three short paragraphs at most
+- Sign-off: "Thanks," followed by a first name
+- Prefer bullet points for action items and dates
+`
+
+// NewDemoGmailServer creates a server on a generated mailbox so clients can be
+// developed without a Gmail account. Its files live under demo/ in the app data
+// directory, so a real token or style guide is never touched.
+func NewDemoGmailServer() *GmailServer {
+	dir := filepath.Join(config.AppDataDir(), "demo")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		log.Printf("Warning: Could not create demo directory: %v", err)
+	}
+
+	// Like the other non-Gmail backends, the demo server never runs background workers
+	g := newGmailServerWithClient(gmailclient.NewDemo(demoThreadCount), dir)
+	if _, err := os.Stat(g.styleGuideFile); err != nil {
+		if err := os.WriteFile(g.styleGuideFile, []byte(demoStyleGuide), 0600); err != nil {
+			log.Printf("Warning: Could not write demo style guide: %v", err)
+		}
+	}
+	log.Printf("🧪 Demo mode: serving a generated mailbox with %d threads", demoThreadCount)
+	return g
+}
@@ -0,0 +1,519 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"auto-gmail/internal/config"
+	"auto-gmail/internal/i18n"
+	"auto-gmail/internal/toolerr"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"google.golang.org/api/gmail/v1"
+)
+
+// Reports a digest can deliver
+const (
+	DigestDaily     = "daily_digest"
+	DigestWeekly    = "weekly_report"
+	DigestFollowUps = "follow_ups"
+)
+
+// digestReports lists the reports for parameter enums
+var digestReports = []string{DigestDaily, DigestWeekly, DigestFollowUps}
+
+// Digest schedules; times are read in the user's time zone
+const (
+	ScheduleDaily    = "daily"
+	ScheduleWeekdays = "weekdays"
+	ScheduleWeekly   = "weekly"
+)
+
+// digestSchedules lists the schedules for parameter enums
+var digestSchedules = []string{ScheduleDaily, ScheduleWeekdays, ScheduleWeekly}
+
+// Digest defaults and limits
+const (
+	defaultDigestTime = "08:00"
+	// digestCheckInterval is how often the background loop looks for digests that are due
+	digestCheckInterval = time.Minute
+	// digestRetryDelay is how long a failed delivery waits before it's tried again
+	digestRetryDelay = 15 * time.Minute
+	// digestBuildTimeout bounds building and sending one digest
+	digestBuildTimeout = 5 * time.Minute
+	// followUpWindowDays is how far back follow_ups looks for the user's unanswered mail
+	followUpWindowDays = 30
+	// followUpAfterDays is how long a sent message waits before it needs a follow-up
+	followUpAfterDays = 3
+	// maxFollowUps caps the follow_ups list
+	maxFollowUps = 20
+)
+
+// digest is one scheduled report emailed to the user's own address
+type digest struct {
+	Name     string `json:"name"`
+	Report   string `json:"report"`
+	Schedule string `json:"schedule"`
+	At       string `json:"at"`                // HH:MM in the user's time zone
+	Weekday  string `json:"weekday,omitempty"` // for weekly digests
+	Category string `json:"category,omitempty"`
+	// Created is when the digest was saved; the first delivery is the next scheduled time after it
+	Created  time.Time `json:"created"`
+	LastSent time.Time `json:"lastSent,omitempty"`
+	// LastAttempt and LastError record a failed delivery, retried every digestRetryDelay
+	LastAttempt time.Time `json:"lastAttempt,omitempty"`
+	LastError   string    `json:"lastError,omitempty"`
+}
+
+// followUp is a thread where the user wrote last and nobody has replied
+type followUp struct {
+	ThreadID    string `json:"threadId"`
+	Subject     string `json:"subject"`
+	To          string `json:"to"`
+	Sent        string `json:"sent"`
+	WaitingDays int    `json:"waitingDays"`
+}
+
+// digestsFile is where scheduled digests are stored, next to the token
+func (g *GmailServer) digestsFile() string {
+	return g.dataFile("digests.json")
+}
+
+// loadDigests reads the scheduled digests; a missing file means none. The caller holds digestMu.
+func (g *GmailServer) loadDigests() ([]digest, error) {
+	var stored struct {
+		Digests []digest `json:"digests"`
+	}
+	data, err := os.ReadFile(g.digestsFile())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return nil, toolerr.Errorf(toolerr.ParseFailure, "invalid_data_file", "invalid digests file %s: %v", g.digestsFile(), err)
+	}
+	return stored.Digests, nil
+}
+
+// saveDigests writes the scheduled digests. The caller holds digestMu.
+func (g *GmailServer) saveDigests(digests []digest) error {
+	data, _ := json.MarshalIndent(map[string]interface{}{"digests": digests}, "", "  ")
+	return os.WriteFile(g.digestsFile(), data, 0600)
+}
+
+// parseWeekday reads a weekday name or its first three letters
+func parseWeekday(name string) (time.Weekday, bool) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		full := strings.ToLower(day.String())
+		if name == full || name == full[:3] {
+			return day, true
+		}
+	}
+	return 0, false
+}
+
+// nextDigestTime is the first scheduled delivery of d strictly after from, with its
+// time of day read in from's location. Across a daylight saving change the wall-clock
+// time is kept; one skipped by the clocks going forward is moved past the gap.
+func nextDigestTime(d digest, from time.Time) time.Time {
+	at, err := time.Parse("15:04", d.At)
+	if err != nil {
+		at, _ = time.Parse("15:04", defaultDigestTime)
+	}
+	weekday, _ := parseWeekday(d.Weekday)
+
+	day := startOfDay(from)
+	for i := 0; i <= 7; i++ {
+		candidate := time.Date(day.Year(), day.Month(), day.Day()+i, at.Hour(), at.Minute(), 0, 0, day.Location())
+		// time.Date puts a time in a spring-forward gap before it; move it after
+		wall := time.Date(day.Year(), day.Month(), day.Day()+i, at.Hour(), at.Minute(), 0, 0, time.UTC)
+		got := time.Date(candidate.Year(), candidate.Month(), candidate.Day(), candidate.Hour(), candidate.Minute(), 0, 0, time.UTC)
+		if skipped := wall.Sub(got); skipped > 0 {
+			candidate = candidate.Add(skipped)
+		}
+		if !candidate.After(from) {
+			continue
+		}
+		switch d.Schedule {
+		case ScheduleWeekdays:
+			if candidate.Weekday() == time.Saturday || candidate.Weekday() == time.Sunday {
+				continue
+			}
+		case ScheduleWeekly:
+			if candidate.Weekday() != weekday {
+				continue
+			}
+		}
+		return candidate
+	}
+	return time.Time{}
+}
+
+// ManageDigests lists, saves or deletes scheduled report emails, or sends one right
+// away. action is "list", "set" (create or replace), "delete" or "send_now".
+func (g *GmailServer) ManageDigests(ctx context.Context, action string, d digest) (*mcp.CallToolResult, error) {
+	d.Name = strings.TrimSpace(d.Name)
+	if action == "" {
+		action = "list"
+	}
+	if action != "list" && d.Name == "" {
+		return toolerr.Invalid("name parameter is required unless listing"), nil
+	}
+	if action == "set" {
+		if errResult := normalizeDigest(&d); errResult != nil {
+			return errResult, nil
+		}
+	}
+
+	g.digestMu.Lock()
+	digests, err := g.loadDigests()
+	if err != nil {
+		g.digestMu.Unlock()
+		return toolerr.Result(err, "Failed to read digests"), nil
+	}
+	index := -1
+	for i, existing := range digests {
+		if strings.EqualFold(existing.Name, d.Name) {
+			index = i
+		}
+	}
+	if action != "list" && action != "set" && index < 0 {
+		g.digestMu.Unlock()
+		return toolerr.New(toolerr.NotFound, "digest_not_found", fmt.Sprintf("No digest named '%s'", d.Name)).Result(), nil
+	}
+	switch action {
+	case "list", "send_now":
+	case "set":
+		d.Created = time.Now()
+		if index >= 0 {
+			digests[index] = d
+		} else {
+			digests = append(digests, d)
+		}
+		err = g.saveDigests(digests)
+	case "delete":
+		digests = append(digests[:index], digests[index+1:]...)
+		err = g.saveDigests(digests)
+	default:
+		g.digestMu.Unlock()
+		return toolerr.Invalid(fmt.Sprintf("Invalid action %q: use \"list\", \"set\", \"delete\" or \"send_now\"", action)), nil
+	}
+	g.digestMu.Unlock()
+	if err != nil {
+		return toolerr.Result(err, "Failed to save digests"), nil
+	}
+
+	result := map[string]interface{}{"action": action}
+	switch action {
+	case "set":
+		g.startDigestWorker()
+	case "send_now":
+		sent, err := g.deliverDigest(ctx, digests[index])
+		if err != nil {
+			return toolerr.Result(err, "Failed to send digest"), nil
+		}
+		result["sent"] = sent
+		digests[index].LastSent, digests[index].LastError = time.Now(), ""
+	}
+
+	listed := make([]map[string]interface{}, len(digests))
+	for i, existing := range digests {
+		entry := map[string]interface{}{
+			"name":     existing.Name,
+			"report":   existing.Report,
+			"schedule": existing.Schedule,
+			"at":       existing.At,
+			"nextSend": nextDigestTime(existing, digestFrom(existing)).Format(time.RFC3339),
+		}
+		if existing.Weekday != "" {
+			entry["weekday"] = existing.Weekday
+		}
+		if existing.Category != "" {
+			entry["category"] = existing.Category
+		}
+		if !existing.LastSent.IsZero() {
+			entry["lastSent"] = existing.LastSent.In(config.TimeZone()).Format(time.RFC3339)
+		}
+		if existing.LastError != "" {
+			entry["lastError"] = existing.LastError
+		}
+		listed[i] = entry
+	}
+	result["digests"] = listed
+	result["file"] = g.digestsFile()
+	result["timeZone"] = config.TimeZone().String()
+
+	resultJSON, _ := json.MarshalIndent(result, "", "  ")
+	return mcp.NewToolResultText(string(resultJSON)), nil
+}
+
+// normalizeDigest checks a digest about to be saved and fills in its defaults: a
+// daily schedule (weekly for weekly_report), 08:00, and Monday for weekly ones
+func normalizeDigest(d *digest) *mcp.CallToolResult {
+	if !containsString(digestReports, d.Report) {
+		return toolerr.Invalid(fmt.Sprintf("Invalid report %q: use %s", d.Report, strings.Join(digestReports, ", ")))
+	}
+	if d.Schedule == "" {
+		d.Schedule = ScheduleDaily
+		if d.Report == DigestWeekly {
+			d.Schedule = ScheduleWeekly
+		}
+	}
+	if !containsString(digestSchedules, d.Schedule) {
+		return toolerr.Invalid(fmt.Sprintf("Invalid schedule %q: use %s", d.Schedule, strings.Join(digestSchedules, ", ")))
+	}
+	if d.At == "" {
+		d.At = defaultDigestTime
+	}
+	at, err := time.Parse("15:04", d.At)
+	if err != nil {
+		return toolerr.Invalid(fmt.Sprintf("Invalid at %q: use a 24-hour time such as 08:00", d.At))
+	}
+	d.At = at.Format("15:04")
+
+	d.Weekday = strings.TrimSpace(d.Weekday)
+	if d.Schedule != ScheduleWeekly {
+		d.Weekday = ""
+	} else if d.Weekday == "" {
+		d.Weekday = "monday"
+	} else if weekday, ok := parseWeekday(d.Weekday); ok {
+		d.Weekday = strings.ToLower(weekday.String())
+	} else {
+		return toolerr.Invalid(fmt.Sprintf("Invalid weekday %q: use a day name such as monday", d.Weekday))
+	}
+
+	// follow_ups covers everything the user sent, so it has no inbox tab
+	if d.Report == DigestFollowUps {
+		d.Category = ""
+	}
+	return nil
+}
+
+// digestFrom is the time the next delivery of d is counted from: its last send, or
+// when it was saved, in the user's time zone
+func digestFrom(d digest) time.Time {
+	if !d.LastSent.IsZero() {
+		return d.LastSent.In(config.TimeZone())
+	}
+	return d.Created.In(config.TimeZone())
+}
+
+// deliverDigest builds a digest's report and emails it to the user through the
+// outbox, which retries the send if Gmail is unavailable. The send is recorded on
+// the digest, and the outbox entry's state is returned.
+func (g *GmailServer) deliverDigest(ctx context.Context, d digest) (map[string]interface{}, error) {
+	me := g.userEmail(ctx)
+	if me == "" {
+		return nil, toolerr.New(toolerr.Unavailable, "profile_unavailable", "Could not look up your address to email the digest")
+	}
+
+	subject, body, err := g.buildDigest(ctx, d)
+	if err == nil {
+		var entry outboxEntry
+		entry, err = g.queueSend(ctx, me, subject, reportEmail(me, subject, body))
+		if err == nil && entry.Status == outboxFailed {
+			err = fmt.Errorf("%s", entry.LastError)
+		}
+		if err == nil {
+			g.recordDigestSend(d.Name, "")
+			sent := map[string]interface{}{"to": me, "subject": subject, "status": entry.Status, "outboxId": entry.ID}
+			if entry.MessageID != "" {
+				sent["messageId"] = entry.MessageID
+			}
+			return sent, nil
+		}
+	}
+	g.recordDigestSend(d.Name, err.Error())
+	return nil, err
+}
+
+// recordDigestSend notes a delivery attempt on the stored digest. An error keeps the
+// last successful send time, so the background loop tries again after digestRetryDelay.
+func (g *GmailServer) recordDigestSend(name, errText string) {
+	g.digestMu.Lock()
+	defer g.digestMu.Unlock()
+	digests, err := g.loadDigests()
+	if err != nil {
+		return
+	}
+	for i := range digests {
+		if strings.EqualFold(digests[i].Name, name) {
+			if errText == "" {
+				digests[i].LastSent = time.Now()
+			}
+			digests[i].LastAttempt, digests[i].LastError = time.Now(), errText
+		}
+	}
+	if err := g.saveDigests(digests); err != nil {
+		log.Printf("Warning: Failed to save digests %s: %v", g.digestsFile(), err)
+	}
+}
+
+// buildDigest renders a digest's report as a subject and markdown body
+func (g *GmailServer) buildDigest(ctx context.Context, d digest) (string, string, error) {
+	switch d.Report {
+	case DigestDaily, DigestWeekly:
+		days := 7
+		if d.Report == DigestDaily {
+			days = 1
+		}
+		report, err := g.buildActivityReport(ctx, days, d.Category)
+		if err != nil {
+			return "", "", err
+		}
+		subject := i18n.T("report.subject", "Email activity report: %s to %s", reportDate(report.From), reportDate(report.To))
+		if d.Report == DigestDaily {
+			subject = i18n.T("digest.daily_subject", "Daily email digest: %s", reportDate(report.To))
+		}
+		return subject, report.Markdown, nil
+	case DigestFollowUps:
+		followUps, err := g.buildFollowUps(ctx)
+		if err != nil {
+			return "", "", err
+		}
+		today := reportDate(userNow().Format("2006-01-02"))
+		return i18n.T("digest.follow_ups_subject", "Follow-ups: %d thread(s) waiting on a reply (%s)", len(followUps), today), followUpsMarkdown(followUps), nil
+	}
+	return "", "", fmt.Errorf("unknown report %q", d.Report)
+}
+
+// buildFollowUps finds recent threads where the user wrote last, to a person, and
+// nobody has replied for followUpAfterDays or more. The longest-waiting come first.
+func (g *GmailServer) buildFollowUps(ctx context.Context) ([]followUp, error) {
+	list, err := g.client.ListMessages(ctx, fmt.Sprintf("newer_than:%dd", followUpWindowDays), maxReportScan)
+	if err != nil {
+		return nil, err
+	}
+	messageIDs := make([]string, len(list.Messages))
+	for i, msg := range list.Messages {
+		messageIDs[i] = msg.Id
+	}
+	hydrated := g.hydrateMessageHeaders(ctx, messageIDs, []string{"From", "To", "Subject"})
+
+	latest := map[string]*gmail.Message{}
+	first := map[string]*gmail.Message{}
+	for _, message := range hydrated {
+		if current, ok := latest[message.ThreadId]; !ok || message.InternalDate > current.InternalDate {
+			latest[message.ThreadId] = message
+		}
+		if current, ok := first[message.ThreadId]; !ok || message.InternalDate < current.InternalDate {
+			first[message.ThreadId] = message
+		}
+	}
+
+	me := g.userEmail(ctx)
+	now := time.Now()
+	var followUps []followUp
+	for threadID, message := range latest {
+		to := messageHeader(message, "To")
+		waiting := now.Sub(time.UnixMilli(message.InternalDate))
+		if !hasLabelID(message, "SENT") || hasLabelID(message, "DRAFT") || waiting < followUpAfterDays*24*time.Hour {
+			continue
+		}
+		// Notes to self aren't waiting on anyone
+		if me != "" && strings.EqualFold(senderAddress(to), me) {
+			continue
+		}
+		followUps = append(followUps, followUp{
+			ThreadID:    threadID,
+			Subject:     messageHeader(first[threadID], "Subject"),
+			To:          to,
+			Sent:        formatInternalDate(message.InternalDate),
+			WaitingDays: int(waiting.Hours() / 24),
+		})
+	}
+	sort.Slice(followUps, func(i, j int) bool {
+		if followUps[i].WaitingDays != followUps[j].WaitingDays {
+			return followUps[i].WaitingDays > followUps[j].WaitingDays
+		}
+		return followUps[i].ThreadID < followUps[j].ThreadID
+	})
+	return followUps[:min(len(followUps), maxFollowUps)], nil
+}
+
+// followUpsMarkdown renders the follow_ups report
+func followUpsMarkdown(followUps []followUp) string {
+	var out strings.Builder
+	out.WriteString(i18n.T("digest.follow_ups_title", "# Waiting on a Reply") + "\n\n")
+	if len(followUps) == 0 {
+		out.WriteString(i18n.T("digest.no_follow_ups", "Nothing you sent in the past %d days is waiting on a reply.", followUpWindowDays) + "\n")
+	}
+	for _, thread := range followUps {
+		fmt.Fprintf(&out, "- %s\n", i18n.T("digest.follow_up", "**%s** to %s, no reply for %d day(s) (thread %s)", thread.Subject, thread.To, thread.WaitingDays, thread.ThreadID))
+	}
+	return out.String()
+}
+
+// reportEmail builds a plain-text RFC 822 message to the user's own address
+func reportEmail(to, subject, body string) string {
+	return fmt.Sprintf("To: %s\r\nSubject: %s\r\nContent-Type: text/plain; charset=UTF-8\r\n\r\n%s",
+		to, subject, strings.ReplaceAll(body, "\n", "\r\n"))
+}
+
+// startDigestWorker starts sending scheduled digests in the background, unless it's
+// already running, there are none, or background work isn't enabled for the account
+func (g *GmailServer) startDigestWorker() {
+	g.authMu.RLock()
+	enabled := g.workersEnabled
+	g.authMu.RUnlock()
+	if !enabled {
+		return
+	}
+
+	g.digestMu.Lock()
+	defer g.digestMu.Unlock()
+	if g.digestRunning {
+		return
+	}
+	if digests, err := g.loadDigests(); err != nil || len(digests) == 0 {
+		return
+	}
+	g.digestRunning = true
+	go g.runDigests()
+}
+
+// runDigests sends each digest when its scheduled time passes. A digest missed
+// while the server wasn't running is sent once when it next checks.
+func (g *GmailServer) runDigests() {
+	for {
+		time.Sleep(digestCheckInterval)
+		if !g.IsAuthenticated() {
+			continue
+		}
+
+		g.digestMu.Lock()
+		digests, err := g.loadDigests()
+		g.digestMu.Unlock()
+		if err != nil {
+			log.Printf("Warning: Digests not sent: %v", err)
+			continue
+		}
+
+		now := time.Now()
+		for _, d := range digests {
+			due := nextDigestTime(d, digestFrom(d))
+			if due.IsZero() || now.Before(due) {
+				continue
+			}
+			if d.LastError != "" && now.Sub(d.LastAttempt) < digestRetryDelay {
+				continue
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), digestBuildTimeout)
+			if _, err := g.deliverDigest(ctx, d); err != nil {
+				log.Printf("Warning: Digest %q not sent: %v", d.Name, err)
+			} else {
+				log.Printf("📬 Sent digest %q", d.Name)
+			}
+			cancel()
+		}
+	}
+}
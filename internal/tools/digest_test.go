@@ -0,0 +1,60 @@
+package tools
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNextDigestTime(t *testing.T) {
+	newYork := newYork(t)
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	santiago, err := time.LoadLocation("America/Santiago")
+	if err != nil {
+		t.Fatal(err)
+	}
+	daily := digest{Schedule: ScheduleDaily, At: "08:00"}
+	tests := []struct {
+		name string
+		d    digest
+		from time.Time
+		want time.Time
+	}{
+		{"later today", daily, time.Date(2026, 3, 10, 7, 0, 0, 0, newYork), time.Date(2026, 3, 10, 8, 0, 0, 0, newYork)},
+		{"strictly after from", daily, time.Date(2026, 3, 10, 8, 0, 0, 0, newYork), time.Date(2026, 3, 11, 8, 0, 0, 0, newYork)},
+		{"tomorrow", daily, time.Date(2026, 3, 10, 9, 0, 0, 0, newYork), time.Date(2026, 3, 11, 8, 0, 0, 0, newYork)},
+		{"invalid time uses the default", digest{Schedule: ScheduleDaily, At: "25:00"}, time.Date(2026, 3, 10, 7, 0, 0, 0, newYork), time.Date(2026, 3, 10, 8, 0, 0, 0, newYork)},
+		{"weekdays skip the weekend", digest{Schedule: ScheduleWeekdays, At: "08:00"}, time.Date(2026, 3, 13, 9, 0, 0, 0, newYork), time.Date(2026, 3, 16, 8, 0, 0, 0, newYork)},
+		{"weekdays from Saturday", digest{Schedule: ScheduleWeekdays, At: "08:00"}, time.Date(2026, 3, 14, 7, 0, 0, 0, newYork), time.Date(2026, 3, 16, 8, 0, 0, 0, newYork)},
+		{"weekly later this week", digest{Schedule: ScheduleWeekly, At: "17:30", Weekday: "fri"}, time.Date(2026, 3, 10, 9, 0, 0, 0, newYork), time.Date(2026, 3, 13, 17, 30, 0, 0, newYork)},
+		{"weekly a week later", digest{Schedule: ScheduleWeekly, At: "08:00", Weekday: "Monday"}, time.Date(2026, 3, 9, 9, 0, 0, 0, newYork), time.Date(2026, 3, 16, 8, 0, 0, 0, newYork)},
+
+		// The user's zone decides the day and hour: 20:00 UTC on Sunday is already Monday in Tokyo
+		{"weekday in the user's zone", digest{Schedule: ScheduleWeekly, At: "08:00", Weekday: "monday"}, time.Date(2026, 3, 15, 20, 0, 0, 0, time.UTC).In(tokyo), time.Date(2026, 3, 16, 8, 0, 0, 0, tokyo)},
+		{"hour in the user's zone", daily, time.Date(2026, 3, 10, 12, 30, 0, 0, time.UTC).In(newYork), time.Date(2026, 3, 11, 8, 0, 0, 0, newYork)},
+
+		// Daylight saving starts on 2026-03-08 and ends on 2026-11-01 in New York
+		{"clocks go forward", daily, time.Date(2026, 3, 7, 9, 0, 0, 0, newYork), time.Date(2026, 3, 8, 8, 0, 0, 0, newYork)},
+		{"time skipped by the clocks", digest{Schedule: ScheduleDaily, At: "02:30"}, time.Date(2026, 3, 7, 3, 0, 0, 0, newYork), time.Date(2026, 3, 8, 3, 30, 0, 0, newYork)},
+		// Santiago skips from midnight to 01:00 on 2026-09-06
+		{"time skipped at midnight", digest{Schedule: ScheduleDaily, At: "00:30"}, time.Date(2026, 9, 5, 12, 0, 0, 0, santiago), time.Date(2026, 9, 6, 1, 30, 0, 0, santiago)},
+		{"clocks go back", daily, time.Date(2026, 10, 31, 9, 0, 0, 0, newYork), time.Date(2026, 11, 1, 8, 0, 0, 0, newYork)},
+		{"weekly across the change", digest{Schedule: ScheduleWeekly, At: "08:00", Weekday: "mon"}, time.Date(2026, 3, 2, 9, 0, 0, 0, newYork), time.Date(2026, 3, 9, 8, 0, 0, 0, newYork)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := nextDigestTime(tt.d, tt.from)
+			if !got.Equal(tt.want) || got.Location() != tt.want.Location() {
+				t.Errorf("nextDigestTime(%+v, %v) = %v, want %v", tt.d, tt.from, got, tt.want)
+			}
+		})
+	}
+
+	// Across the change the wall-clock time is kept, so the day is an hour shorter or longer
+	before := time.Date(2026, 3, 7, 8, 0, 0, 0, newYork)
+	if gap := nextDigestTime(daily, before).Sub(before); gap != 23*time.Hour {
+		t.Errorf("daily digest after %v comes %v later, want 23h", before, gap)
+	}
+}
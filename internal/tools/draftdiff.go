@@ -0,0 +1,171 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/mail"
+	"strings"
+
+	"auto-gmail/internal/extract"
+	"auto-gmail/internal/gmailclient"
+)
+
+// diffContext is how many unchanged lines surround each change in a draft diff
+const diffContext = 3
+
+// maxDiffLines caps the lines compared line-by-line; longer drafts are shown as a full replacement
+const maxDiffLines = 2000
+
+// draftText renders a draft's recipient, subject and body as the text a diff compares
+func draftText(to, subject, body string) string {
+	return fmt.Sprintf("To: %s\nSubject: %s\n\n%s", to, subject, strings.ReplaceAll(body, "\r\n", "\n"))
+}
+
+// draftContent returns the recipient, subject and body a draft has now
+func (g *GmailServer) draftContent(ctx context.Context, draftID string) (string, string, string, error) {
+	draft, err := g.client.GetDraft(ctx, draftID, gmailclient.GetOptions{Format: "full"})
+	if err != nil {
+		return "", "", "", err
+	}
+	if draft.Message == nil {
+		return "", "", "", fmt.Errorf("draft %s has no message", draftID)
+	}
+	if draft.Message.Payload != nil {
+		return messageHeader(draft.Message, "To"), messageHeader(draft.Message, "Subject"), extract.EmailBody(draft.Message), nil
+	}
+
+	// Drafts that only carry the raw RFC 822 message (e.g. in demo mode) are parsed directly
+	raw, err := base64.URLEncoding.DecodeString(draft.Message.Raw)
+	if err != nil {
+		raw, err = base64.RawURLEncoding.DecodeString(draft.Message.Raw)
+	}
+	if err != nil {
+		return "", "", "", fmt.Errorf("failed to decode draft %s: %v", draftID, err)
+	}
+	parsed, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return "", "", "", fmt.Errorf("failed to parse draft %s: %v", draftID, err)
+	}
+	body, err := io.ReadAll(parsed.Body)
+	if err != nil {
+		return "", "", "", fmt.Errorf("failed to read draft %s: %v", draftID, err)
+	}
+	return parsed.Header.Get("To"), parsed.Header.Get("Subject"), string(body), nil
+}
+
+// unifiedDiff returns a unified diff from oldText to newText, or "" when they're the same
+func unifiedDiff(oldName, newName, oldText, newText string) string {
+	if oldText == newText {
+		return ""
+	}
+	oldLines := strings.Split(oldText, "\n")
+	newLines := strings.Split(newText, "\n")
+	ops := diffLines(oldLines, newLines)
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n", oldName, newName)
+	for start := 0; start < len(ops); {
+		// Find the next change and the run of ops it belongs to
+		for start < len(ops) && ops[start].kind == ' ' {
+			start++
+		}
+		if start == len(ops) {
+			break
+		}
+		end := start
+		for i := start; i < len(ops); i++ {
+			if ops[i].kind != ' ' {
+				end = i + 1
+			} else if i-end >= 2*diffContext {
+				break
+			}
+		}
+		from, to := max(start-diffContext, 0), min(end+diffContext, len(ops))
+
+		oldStart, newStart := ops[from].oldLine, ops[from].newLine
+		oldCount, newCount := 0, 0
+		for _, op := range ops[from:to] {
+			if op.kind != '+' {
+				oldCount++
+			}
+			if op.kind != '-' {
+				newCount++
+			}
+		}
+		fmt.Fprintf(&out, "@@ -%s +%s @@\n", hunkRange(oldStart, oldCount), hunkRange(newStart, newCount))
+		for _, op := range ops[from:to] {
+			fmt.Fprintf(&out, "%c%s\n", op.kind, op.text)
+		}
+		start = to
+	}
+	return out.String()
+}
+
+// hunkRange formats a hunk's line range as unified diff does, counting lines from 1
+func hunkRange(start, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
+
+// diffOp is one line of a diff: ' ' kept, '-' removed or '+' added, with the
+// 0-based positions reached in the old and new texts before it
+type diffOp struct {
+	kind    byte
+	text    string
+	oldLine int
+	newLine int
+}
+
+// diffLines aligns two line slices by their longest common subsequence
+func diffLines(oldLines, newLines []string) []diffOp {
+	var ops []diffOp
+	if len(oldLines) > maxDiffLines || len(newLines) > maxDiffLines {
+		for i, line := range oldLines {
+			ops = append(ops, diffOp{kind: '-', text: line, oldLine: i})
+		}
+		for i, line := range newLines {
+			ops = append(ops, diffOp{kind: '+', text: line, oldLine: len(oldLines), newLine: i})
+		}
+		return ops
+	}
+
+	// common[i][j] is the LCS length of oldLines[i:] and newLines[j:]
+	common := make([][]int, len(oldLines)+1)
+	for i := range common {
+		common[i] = make([]int, len(newLines)+1)
+	}
+	for i := len(oldLines) - 1; i >= 0; i-- {
+		for j := len(newLines) - 1; j >= 0; j-- {
+			if oldLines[i] == newLines[j] {
+				common[i][j] = common[i+1][j+1] + 1
+			} else {
+				common[i][j] = max(common[i+1][j], common[i][j+1])
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(oldLines) || j < len(newLines) {
+		switch {
+		case i < len(oldLines) && j < len(newLines) && oldLines[i] == newLines[j]:
+			ops = append(ops, diffOp{kind: ' ', text: oldLines[i], oldLine: i, newLine: j})
+			i++
+			j++
+		case i < len(oldLines) && (j == len(newLines) || common[i+1][j] >= common[i][j+1]):
+			ops = append(ops, diffOp{kind: '-', text: oldLines[i], oldLine: i, newLine: j})
+			i++
+		default:
+			ops = append(ops, diffOp{kind: '+', text: newLines[j], oldLine: i, newLine: j})
+			j++
+		}
+	}
+	return ops
+}
@@ -0,0 +1,217 @@
+package tools
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+
+	"auto-gmail/internal/gmailclient"
+	"auto-gmail/internal/toolerr"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"google.golang.org/api/gmail/v1"
+)
+
+// Draft modes for CreateDraft
+const (
+	DraftModeUpdate       = "update"         // update draft_id, or the thread's only draft, else create
+	DraftModeCreateNew    = "create_new"     // always create another draft
+	DraftModeFailIfExists = "fail_if_exists" // refuse when the thread already has a draft
+)
+
+// CreateDraft creates a Gmail draft or updates an existing one. In "update" mode (the
+// default) draftID names the draft to overwrite; without it the thread's draft is
+// updated when there is exactly one, and the call fails when there are several.
+// "create_new" always adds a draft and "fail_if_exists" refuses if the thread has one.
+// With a fromTag the draft is from the user's plus-addressed user+tag address, and
+// encrypt turns the body into PGP/MIME for recipients with known public keys.
+func (g *GmailServer) CreateDraft(ctx context.Context, to, subject, body, threadID, draftID, mode, fromTag string, encrypt bool) (*mcp.CallToolResult, error) {
+	if mode == "" {
+		mode = DraftModeUpdate
+	}
+	if mode != DraftModeUpdate && mode != DraftModeCreateNew && mode != DraftModeFailIfExists {
+		return toolerr.Invalid(fmt.Sprintf("Invalid mode %q: use update, create_new or fail_if_exists", mode)), nil
+	}
+	if draftID != "" && mode != DraftModeUpdate {
+		return toolerr.Invalid(fmt.Sprintf("draft_id can only be used with mode \"update\", not %q", mode)), nil
+	}
+
+	tagHeaders, err := g.tagHeaders(ctx, fromTag)
+	if err != nil {
+		return toolerr.Result(err, ""), nil
+	}
+
+	var message gmail.Message
+
+	// Build the email message
+	headers := tagHeaders + fmt.Sprintf("To: %s\r\n", to)
+
+	existingDrafts := []map[string]interface{}{}
+	if threadID != "" {
+		// Set the thread ID on the message for proper threading
+		message.ThreadId = threadID
+
+		// Ensure subject has "Re:" prefix for replies
+		if !strings.HasPrefix(strings.ToLower(subject), "re:") {
+			subject = "Re: " + subject
+		}
+
+		// For replies, we need to set the In-Reply-To and References headers (headers only, no bodies)
+		thread, err := g.client.GetThread(ctx, threadID, gmailclient.GetOptions{
+			Format:          "metadata",
+			MetadataHeaders: []string{"Message-ID", "References"},
+			Fields:          "messages(payload/headers)",
+		})
+		if err == nil && len(thread.Messages) > 0 {
+			lastMessage := thread.Messages[len(thread.Messages)-1]
+			var messageID string
+			var references string
+
+			// Extract Message-ID and References from the last message
+			for _, header := range lastMessage.Payload.Headers {
+				switch header.Name {
+				case "Message-ID":
+					messageID = header.Value
+				case "References":
+					references = header.Value
+				}
+			}
+
+			if messageID != "" {
+				headers += fmt.Sprintf("In-Reply-To: %s\r\n", messageID)
+
+				// Build References header (previous references + last message ID)
+				if references != "" {
+					headers += fmt.Sprintf("References: %s %s\r\n", references, messageID)
+				} else {
+					headers += fmt.Sprintf("References: %s\r\n", messageID)
+				}
+			}
+		}
+
+		// Existing drafts in this thread decide between updating and creating
+		drafts, err := g.getThreadDrafts(ctx, threadID)
+		if err != nil && mode != DraftModeCreateNew {
+			return toolerr.Result(err, "Failed to check existing drafts"), nil
+		}
+		if drafts != nil {
+			existingDrafts = drafts
+		}
+	}
+
+	headers += fmt.Sprintf("Subject: %s\r\n", subject)
+	rawMessage := headers + "\r\n" + body
+	if encrypt {
+		encrypted, err := g.encryptBody(ctx, to, body)
+		if err != nil {
+			return toolerr.Result(err, ""), nil
+		}
+		rawMessage = headers + encrypted
+	}
+
+	// Gmail API requires base64url-encoded raw message
+	message.Raw = base64.URLEncoding.EncodeToString([]byte(rawMessage))
+
+	// Pick the draft to overwrite, if any
+	targetDraftID := ""
+	switch {
+	case mode == DraftModeFailIfExists && len(existingDrafts) > 0:
+		return draftConflict(fmt.Sprintf("Thread %s already has %d draft(s); pass mode \"update\" with a draft_id to overwrite one, or \"create_new\" to add another", threadID, len(existingDrafts)), existingDrafts)
+	case draftID != "":
+		if threadID != "" && !slices.ContainsFunc(existingDrafts, func(d map[string]interface{}) bool { return d["draftId"] == draftID }) {
+			return draftConflict(fmt.Sprintf("Draft %s is not a draft in thread %s", draftID, threadID), existingDrafts)
+		}
+		targetDraftID = draftID
+	case mode == DraftModeUpdate && len(existingDrafts) > 1:
+		return draftConflict(fmt.Sprintf("Thread %s has %d drafts; pass the draft_id to update, or mode \"create_new\" to add another", threadID, len(existingDrafts)), existingDrafts)
+	case mode == DraftModeUpdate && len(existingDrafts) == 1:
+		targetDraftID = existingDrafts[0]["draftId"].(string)
+	}
+
+	var result map[string]interface{}
+	if targetDraftID != "" {
+		// Capture what is being overwritten so the change can be reviewed
+		oldTo, oldSubject, oldBody, previousErr := g.draftContent(ctx, targetDraftID)
+		if previousErr != nil {
+			log.Printf("Warning: Could not read draft %s before updating it: %v", targetDraftID, previousErr)
+		}
+
+		draft := &gmail.Draft{
+			Id:      targetDraftID,
+			Message: &message,
+		}
+
+		updatedDraft, err := g.client.UpdateDraft(ctx, targetDraftID, draft)
+		if err != nil {
+			return toolerr.Result(err, "Failed to update existing draft"), nil
+		}
+
+		result = map[string]interface{}{
+			"draftId": updatedDraft.Id,
+			"message": "Draft updated successfully (existing draft was overwritten)",
+			"action":  "updated",
+			"to":      to,
+			"subject": subject,
+		}
+		if previousErr == nil {
+			diff := unifiedDiff("previous draft", "updated draft", draftText(oldTo, oldSubject, oldBody), draftText(to, subject, body))
+			result["diff"] = diff
+			result["unchanged"] = diff == ""
+			result["previous"] = map[string]interface{}{
+				"to":      oldTo,
+				"subject": oldSubject,
+				"body":    oldBody,
+			}
+		}
+	} else {
+		draft := &gmail.Draft{
+			Message: &message,
+		}
+
+		createdDraft, err := g.client.CreateDraft(ctx, draft)
+		if err != nil {
+			return toolerr.Result(err, "Failed to create draft"), nil
+		}
+
+		result = map[string]interface{}{
+			"draftId": createdDraft.Id,
+			"message": "Draft created successfully",
+			"action":  "created",
+			"to":      to,
+			"subject": subject,
+		}
+	}
+
+	if fromTag != "" {
+		result["fromTag"] = fromTag
+	}
+	if encrypt {
+		result["encrypted"] = true
+	}
+
+	// Warn about recipients whose recent auto-replies say they're away
+	if warnings := g.outOfOfficeWarnings(ctx, to); len(warnings) > 0 {
+		result["outOfOffice"] = warnings
+	}
+
+	// List the thread's drafts as they were before this call, so the agent sees what else is there
+	if len(existingDrafts) > 0 {
+		result["existingDrafts"] = existingDrafts
+	}
+
+	resultJSON, _ := json.MarshalIndent(result, "", "  ")
+	return mcp.NewToolResultText(string(resultJSON)), nil
+}
+
+// draftConflict is the error result when the mode or draft_id doesn't fit the thread's
+// drafts; it lists them so the agent can choose one
+func draftConflict(message string, existingDrafts []map[string]interface{}) (*mcp.CallToolResult, error) {
+	conflict := toolerr.New(toolerr.InvalidInput, "draft_conflict", message).
+		WithHint("Pick a draft_id from existingDrafts with mode \"update\", or use mode \"create_new\".")
+	conflict.Details = map[string]interface{}{"existingDrafts": existingDrafts}
+	return conflict.Result(), nil
+}
@@ -0,0 +1,158 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"auto-gmail/internal/extract"
+	"auto-gmail/internal/llm"
+	"auto-gmail/internal/redact"
+	"auto-gmail/internal/toolerr"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/shared"
+	"google.golang.org/api/gmail/v1"
+)
+
+// maxRefineChars caps how much text is sent to OpenAI when refining entities
+const maxRefineChars = 12000
+
+// ExtractEntities pulls amounts, dates, order/tracking numbers, flights and addresses
+// out of a message body, or out of one of its attachments when filename is set.
+// With refine, OpenAI corrects and completes the regex results.
+func (g *GmailServer) ExtractEntities(ctx context.Context, messageID, filename string, refine bool) (*mcp.CallToolResult, error) {
+	message, err := g.getMessage(ctx, messageID)
+	if err != nil {
+		return toolerr.Result(err, "Failed to get message"), nil
+	}
+
+	source := "body"
+	text := extract.EmailBody(message)
+	if filename != "" {
+		source = "attachment"
+		text, err = g.attachmentText(ctx, message, filename)
+		if err != nil {
+			return toolerr.Result(err, ""), nil
+		}
+	}
+
+	entities := extract.ExtractEntities(text)
+	method := "regex"
+	var redactions redact.Report
+	if refine {
+		if err := llm.Check(); err != nil {
+			return toolerr.Result(err, "Refinement is unavailable"), nil
+		}
+		refined, report, err := refineEntities(ctx, text, entities, messageNames(message))
+		if err != nil {
+			log.Printf("Warning: Could not refine entities with OpenAI: %v", err)
+		} else {
+			entities = refined
+			method = "regex+llm"
+		}
+		redactions = report
+	}
+
+	result := map[string]interface{}{
+		"messageId": messageID,
+		"subject":   messageHeader(message, "Subject"),
+		"source":    source,
+		"method":    method,
+		"entities":  entities,
+	}
+	if filename != "" {
+		result["filename"] = filename
+	}
+	if len(redactions) > 0 {
+		result["redactions"] = redactions
+	}
+
+	resultJSON, _ := json.MarshalIndent(result, "", "  ")
+	return mcp.NewToolResultText(string(resultJSON)), nil
+}
+
+// attachmentText returns the extracted text of the named attachment, from the extraction cache when possible
+func (g *GmailServer) attachmentText(ctx context.Context, message *gmail.Message, filename string) (string, error) {
+	for _, attachment := range extract.AttachmentInfo(message) {
+		if attachment["filename"] != filename {
+			continue
+		}
+		attachmentID := attachment["attachmentId"].(string)
+		var part *gmail.MessagePart
+		extract.FindAttachmentPart(message.Payload.Parts, attachmentID, &part)
+		if part == nil {
+			return "", toolerr.Errorf(toolerr.NotFound, "attachment_not_found", "Could not find attachment part for filename '%s'", filename)
+		}
+
+		if entry, ok := g.extractCache.Load(message.Id, filename, part.Body.Size); ok {
+			return entry.TextContent, nil
+		}
+		text, err := g.downloadAttachmentText(ctx, message.Id, attachmentID, part)
+		if err != nil {
+			return "", err
+		}
+		g.extractCache.Save(&extract.CacheEntry{
+			MessageID:   message.Id,
+			Filename:    filename,
+			Size:        part.Body.Size,
+			MimeType:    part.MimeType,
+			TextContent: text,
+			ExtractedAt: time.Now(),
+		})
+		return text, nil
+	}
+	return "", toolerr.Errorf(toolerr.NotFound, "attachment_not_found", "Attachment with filename '%s' not found", filename)
+}
+
+// refineEntities asks OpenAI to correct and complete regex-extracted entities, keeping
+// the same JSON shape. Personal data is redacted first when GMAIL_MCP_REDACT=1.
+func refineEntities(ctx context.Context, text string, entities *extract.Entities, names []string) (*extract.Entities, redact.Report, error) {
+	found, _ := json.Marshal(entities)
+	redactor := redact.FromEnv()
+	redactedFound, report := redactor.Redact(string(found), names...)
+	text, textReport := redactor.Redact(truncateText(text, maxRefineChars), names...)
+	report.Add(textReport)
+
+	prompt := fmt.Sprintf(`Below is an email or attachment and the entities a regex pass found in it. Return corrected JSON in exactly the same shape: remove false positives, fix values and labels, and add anything missed (invoice totals, due dates, order, invoice and booking confirmation numbers, parcel tracking numbers with carrier, flight numbers like "UA1234", and full postal addresses). Dates are YYYY-MM-DD, amounts are numbers with an ISO 4217 currency. Only include what the text states.
+
+Regex results:
+%s
+
+Text:
+%s`, redactedFound, text)
+
+	client, err := llm.NewClient()
+	if err != nil {
+		return nil, report, err
+	}
+	completion, err := client.Chat.Completions.New(ctx, openai.ChatCompletionNewParams{
+		Messages: []openai.ChatCompletionMessageParamUnion{
+			{
+				OfUser: &openai.ChatCompletionUserMessageParam{
+					Content: openai.ChatCompletionUserMessageParamContentUnion{
+						OfString: openai.String(prompt),
+					},
+				},
+			},
+		},
+		Model:          llm.ChatModel(),
+		Temperature:    openai.Float(0),
+		ResponseFormat: openai.ChatCompletionNewParamsResponseFormatUnion{OfJSONObject: &shared.ResponseFormatJSONObjectParam{}},
+	})
+	if err != nil {
+		return nil, report, err
+	}
+	if len(completion.Choices) == 0 {
+		return nil, report, fmt.Errorf("no response from OpenAI")
+	}
+
+	var refined extract.Entities
+	if err := json.Unmarshal([]byte(completion.Choices[0].Message.Content), &refined); err != nil {
+		return nil, report, fmt.Errorf("invalid JSON from OpenAI: %v", err)
+	}
+	return &refined, report, nil
+}
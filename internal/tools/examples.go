@@ -0,0 +1,134 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"auto-gmail/internal/extract"
+	"auto-gmail/internal/toolerr"
+
+	"google.golang.org/api/gmail/v1"
+)
+
+// styleExampleSentCount is how many recent sent emails are searched for examples
+const styleExampleSentCount = 100
+
+// styleExampleCount is how many examples a scenario shows
+const styleExampleCount = 5
+
+// styleScenario is a kind of email the user writes, recognized by its phrases
+type styleScenario struct {
+	name, title string
+	phrases     []string
+}
+
+// styleScenarios are the scenarios served at gmail://style-examples/{scenario}
+var styleScenarios = []styleScenario{
+	{"scheduling", "Scheduling", []string{"schedule", "reschedule", "availability", "available", "calendar", "meeting", "call", "works for me", "does that work", "time slot", "next week", "zoom", "invite"}},
+	{"declining", "Declining", []string{"unfortunately", "decline", "can't make", "cannot make", "not able to", "unable to", "pass on", "not interested", "won't be able", "have to say no", "not a good fit", "regret"}},
+	{"introductions", "Introductions", []string{"introduce", "introduction", "intro", "connecting you", "looping in", "cc'ing", "you two", "should connect", "meet each other"}},
+	{"follow-up", "Following Up", []string{"following up", "follow up", "checking in", "circling back", "any update", "gentle reminder", "just wanted to check", "bumping"}},
+	{"thanks", "Thanking", []string{"thank you so much", "thanks so much", "really appreciate", "grateful", "thanks for", "thank you for"}},
+	{"requests", "Asking for Something", []string{"could you", "can you", "would you mind", "please send", "do you have", "would it be possible"}},
+}
+
+// StyleScenarioNames lists the scenarios that have style examples
+func StyleScenarioNames() []string {
+	names := make([]string, len(styleScenarios))
+	for i, scenario := range styleScenarios {
+		names[i] = scenario.name
+	}
+	return names
+}
+
+// styleExample is a sent email that fits a scenario
+type styleExample struct {
+	message *gmail.Message
+	body    string
+	score   int
+}
+
+// StyleExamples renders the user's best recent sent emails for a scenario (e.g.
+// "declining") as markdown, so an agent can few-shot from real examples
+func (g *GmailServer) StyleExamples(ctx context.Context, name string) (string, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	var scenario *styleScenario
+	for i := range styleScenarios {
+		if styleScenarios[i].name == name {
+			scenario = &styleScenarios[i]
+		}
+	}
+	if scenario == nil {
+		return "", toolerr.Errorf(toolerr.InvalidInput, "invalid_scenario", "unknown scenario %q: use one of %s", name, strings.Join(StyleScenarioNames(), ", "))
+	}
+
+	sent, err := g.SentMessages(ctx, styleExampleSentCount)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch sent messages: %v", err)
+	}
+
+	// Each email counts for the scenario it fits best
+	var examples []styleExample
+	for _, message := range sent {
+		subject := messageHeader(message, "Subject")
+		if lower := strings.ToLower(subject); strings.HasPrefix(lower, "fw:") || strings.HasPrefix(lower, "fwd:") {
+			continue
+		}
+		body := stripQuotedText(extract.EmailBody(message))
+		if words := len(strings.Fields(body)); words < 25 || words > 300 {
+			continue
+		}
+		best, bestScore := "", 0
+		for _, candidate := range styleScenarios {
+			if score := scenarioScore(candidate, subject, body); score > bestScore {
+				best, bestScore = candidate.name, score
+			}
+		}
+		if best == scenario.name {
+			examples = append(examples, styleExample{message: message, body: body, score: bestScore})
+		}
+	}
+	sort.SliceStable(examples, func(i, j int) bool {
+		if examples[i].score != examples[j].score {
+			return examples[i].score > examples[j].score
+		}
+		return examples[i].message.InternalDate > examples[j].message.InternalDate
+	})
+	if len(examples) > styleExampleCount {
+		examples = examples[:styleExampleCount]
+	}
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "# Style Examples: %s\n\n", scenario.title)
+	if len(examples) == 0 {
+		fmt.Fprintf(&out, "None of the user's last %d sent emails fit this scenario. Follow the personal email style guide instead.\n", styleExampleSentCount)
+		return out.String(), nil
+	}
+	out.WriteString("Real emails the user sent in this situation. Use them as few-shot examples: match their greeting, sign-off, length and tone, not their content.\n")
+	for i, example := range examples {
+		subject := messageHeader(example.message, "Subject")
+		if subject == "" {
+			subject = "(no subject)"
+		}
+		fmt.Fprintf(&out, "\n## Example %d: %s\n\n- To: %s\n- Sent: %s\n\n```\n%s\n```\n",
+			i+1, subject, messageHeader(example.message, "To"), formatInternalDate(example.message.InternalDate), truncateText(example.body, 2000))
+	}
+	return out.String(), nil
+}
+
+// scenarioScore counts a scenario's phrases in an email, subject hits counting double
+func scenarioScore(scenario styleScenario, subject, body string) int {
+	subject, body = strings.ToLower(subject), strings.ToLower(body)
+	score := 0
+	for _, phrase := range scenario.phrases {
+		if strings.Contains(subject, phrase) {
+			score += 2
+		}
+		if strings.Contains(body, phrase) {
+			score++
+		}
+	}
+	return score
+}
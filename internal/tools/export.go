@@ -0,0 +1,401 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/mail"
+	"regexp"
+	"strings"
+
+	"auto-gmail/internal/extract"
+	"auto-gmail/internal/redact"
+	"auto-gmail/internal/toolerr"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"google.golang.org/api/gmail/v1"
+)
+
+// threadDocument is a thread laid out for export, independent of the output format
+type threadDocument struct {
+	ThreadID     string
+	Subject      string
+	Participants []string
+	Exported     string
+	Redacted     string // what was removed for sharing, if anything
+	Messages     []documentMessage
+}
+
+// exportOptions are what export_thread_document keeps and removes
+type exportOptions struct {
+	IncludeQuoted   bool // keep quoted reply text
+	HideAddresses   bool // show people by name, never by email address
+	StripSignatures bool // cut signatures, mobile taglines and legal or mailing list footers
+	RedactPatterns  bool // apply the GMAIL_MCP_REDACT_PATTERNS and default PII rules
+}
+
+// documentMessage is one message of an exported thread
+type documentMessage struct {
+	ID          string
+	From        string
+	To          string
+	Cc          string
+	Date        string
+	Subject     string // only set when it differs from the thread's subject
+	Body        string
+	Attachments []documentAttachment
+}
+
+// documentAttachment references an attachment by name; its content isn't exported
+type documentAttachment struct {
+	Filename string
+	MIMEType string
+	Size     string
+}
+
+// ExportThreadDocument renders a whole thread, oldest message first, as a Markdown
+// document or a PDF printed from HTML, with each message's headers, date, body and
+// attachment references. Quoted reply text is dropped unless options.IncludeQuoted is
+// set, since every earlier message is already in the document; the other options
+// redact it for sharing outside the organization.
+func (g *GmailServer) ExportThreadDocument(ctx context.Context, threadID, format string, options exportOptions) (*mcp.CallToolResult, error) {
+	if format == "" {
+		format = "markdown"
+	}
+	if format != "markdown" && format != "pdf" {
+		return toolerr.Invalid(fmt.Sprintf("Invalid format '%s': use markdown or pdf", format)), nil
+	}
+
+	thread, err := g.getThread(ctx, threadID, 0)
+	if err != nil {
+		return toolerr.Result(err, "Failed to get thread"), nil
+	}
+	doc, redactions := g.threadDocument(ctx, thread, options)
+	if len(doc.Messages) == 0 {
+		return toolerr.New(toolerr.NotFound, "empty_thread", fmt.Sprintf("Thread %s has no messages to export", threadID)).Result(), nil
+	}
+
+	if format == "markdown" {
+		return mcp.NewToolResultText(threadMarkdown(doc)), nil
+	}
+
+	var html bytes.Buffer
+	if err := threadHTMLTemplate.Execute(&html, doc); err != nil {
+		return toolerr.Result(err, "Failed to build the document"), nil
+	}
+	pdf, err := extract.HTMLToPDF(ctx, html.Bytes())
+	if err != nil {
+		return toolerr.Result(err, "Failed to render the thread as PDF"), nil
+	}
+	if len(pdf) > maxPreviewBytes {
+		return toolerr.Invalid(fmt.Sprintf("The PDF of thread %s is %d bytes, over the %d byte limit; export it as markdown instead", threadID, len(pdf), maxPreviewBytes)), nil
+	}
+
+	result := map[string]interface{}{
+		"threadId":     threadID,
+		"subject":      doc.Subject,
+		"messageCount": len(doc.Messages),
+		"format":       format,
+		"size":         len(pdf),
+	}
+	if doc.Redacted != "" {
+		result["redacted"] = doc.Redacted
+	}
+	if len(redactions) > 0 {
+		result["redactions"] = redactions
+	}
+	resultJSON, _ := json.MarshalIndent(result, "", "  ")
+	return &mcp.CallToolResult{Content: []mcp.Content{
+		mcp.NewTextContent(string(resultJSON)),
+		mcp.NewEmbeddedResource(mcp.BlobResourceContents{
+			URI:      fmt.Sprintf("gmail://thread/%s/export.pdf", threadID),
+			MIMEType: "application/pdf",
+			Blob:     base64.StdEncoding.EncodeToString(pdf),
+		}),
+	}}, nil
+}
+
+// threadDocument collects a thread's sent and received messages for export, redacted
+// as options ask, and counts the pattern redactions; drafts and noise attachments such
+// as signature logos are left out
+func (g *GmailServer) threadDocument(ctx context.Context, thread *gmail.Thread, options exportOptions) (threadDocument, redact.Report) {
+	doc := threadDocument{ThreadID: thread.Id, Exported: userNow().Format("2006-01-02 15:04 MST")}
+	report := redact.Report{}
+	var redactor *redact.Redactor
+	if options.RedactPatterns {
+		redactor = redact.Configured()
+	}
+	var hider *addressHider
+	if options.HideAddresses {
+		hider = newAddressHider(thread)
+	}
+	// clean applies the address and pattern redactions to one piece of text
+	clean := func(text string, header bool, names []string) string {
+		if hider != nil {
+			if header {
+				text = hider.header(text)
+			} else {
+				text = hider.text(text)
+			}
+		}
+		text, found := redactor.Redact(text, names...)
+		report.Add(found)
+		return text
+	}
+
+	seen := map[string]bool{}
+	var firstSubject string
+	for _, message := range thread.Messages {
+		if hasLabelID(message, "DRAFT") || message.Payload == nil {
+			continue
+		}
+		names := messageNames(message)
+		subject := messageHeader(message, "Subject")
+		if firstSubject == "" {
+			firstSubject = subject
+			doc.Subject = clean(subject, false, names)
+		}
+		body, _ := g.messageBody(ctx, message)
+		if !options.IncludeQuoted {
+			body = stripQuotedText(body)
+		}
+		if options.StripSignatures {
+			body = stripSignature(body)
+		}
+		entry := documentMessage{
+			ID:   message.Id,
+			From: clean(messageHeader(message, "From"), true, names),
+			To:   clean(messageHeader(message, "To"), true, names),
+			Cc:   clean(messageHeader(message, "Cc"), true, names),
+			Date: messageDate(message),
+			Body: clean(body, false, names),
+		}
+		if subject != firstSubject {
+			entry.Subject = clean(subject, false, names)
+		}
+		attachments, _ := extract.FilterNoiseAttachments(extract.AttachmentInfo(message))
+		for _, attachment := range attachments {
+			size, _ := attachment["size"].(int64)
+			entry.Attachments = append(entry.Attachments, documentAttachment{
+				Filename: attachment["filename"].(string),
+				MIMEType: attachment["mimeType"].(string),
+				Size:     formatBytes(size),
+			})
+		}
+		if address := senderAddress(messageHeader(message, "From")); address != "" && !seen[address] {
+			seen[address] = true
+			doc.Participants = append(doc.Participants, entry.From)
+		}
+		doc.Messages = append(doc.Messages, entry)
+	}
+	if doc.Subject == "" {
+		doc.Subject = "(no subject)"
+	}
+
+	var redacted []string
+	if options.HideAddresses {
+		redacted = append(redacted, "email addresses hidden")
+	}
+	if options.StripSignatures {
+		redacted = append(redacted, "signatures and footers removed")
+	}
+	if options.RedactPatterns {
+		if len(report) > 0 {
+			redacted = append(redacted, "sensitive data replaced ("+report.String()+")")
+		} else {
+			redacted = append(redacted, "no sensitive data patterns found")
+		}
+	}
+	doc.Redacted = strings.Join(redacted, "; ")
+	return doc, report
+}
+
+// emailAddressPattern finds email addresses in message text, with any angle brackets
+var emailAddressPattern = regexp.MustCompile(`<?\b[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}\b>?`)
+
+// addressHider stands in people's names for their email addresses. Names come from
+// the thread's headers; someone without one becomes "Participant N", the same N
+// throughout the document.
+type addressHider struct {
+	names map[string]string
+}
+
+// newAddressHider learns the name behind every address on a thread's headers
+func newAddressHider(thread *gmail.Thread) *addressHider {
+	h := &addressHider{names: map[string]string{}}
+	var unnamed []string
+	for _, message := range thread.Messages {
+		for _, header := range []string{"From", "To", "Cc", "Reply-To"} {
+			addresses, err := mail.ParseAddressList(messageHeader(message, header))
+			if err != nil {
+				continue
+			}
+			for _, address := range addresses {
+				key := strings.ToLower(address.Address)
+				name := strings.TrimSpace(address.Name)
+				if name != "" && !strings.Contains(name, "@") {
+					h.names[key] = name
+				} else if _, known := h.names[key]; !known {
+					h.names[key] = ""
+					unnamed = append(unnamed, key)
+				}
+			}
+		}
+	}
+	participant := 0
+	for _, key := range unnamed {
+		if h.names[key] == "" {
+			participant++
+			h.names[key] = fmt.Sprintf("Participant %d", participant)
+		}
+	}
+	return h
+}
+
+// header rewrites an address header as the names of its recipients
+func (h *addressHider) header(value string) string {
+	addresses, err := mail.ParseAddressList(value)
+	if err != nil {
+		return h.text(value)
+	}
+	names := make([]string, len(addresses))
+	for i, address := range addresses {
+		names[i] = h.name(address.Address)
+	}
+	return strings.Join(names, ", ")
+}
+
+// text replaces the addresses in free text with [name]
+func (h *addressHider) text(text string) string {
+	return emailAddressPattern.ReplaceAllStringFunc(text, func(match string) string {
+		return "[" + h.name(strings.Trim(match, "<>")) + "]"
+	})
+}
+
+// name is who an address belongs to, as far as the thread says
+func (h *addressHider) name(address string) string {
+	if name := h.names[strings.ToLower(address)]; name != "" {
+		return name
+	}
+	return "address hidden"
+}
+
+// Signature and footer markers for stripSignature
+var (
+	// signatureDelimiter is the standard "-- " line before a signature (RFC 3676)
+	signatureDelimiter = regexp.MustCompile(`^--\s*$`)
+	mobileTagline      = regexp.MustCompile(`(?i)^(sent from my |sent from (yahoo )?mail for |get outlook for )`)
+	signOffLine        = regexp.MustCompile(`(?i)^(best|regards|cheers|thanks|thank you|many thanks|sincerely|best regards|kind regards|warm regards|all the best)[,.!]?$`)
+	footerPattern      = regexp.MustCompile(`(?i)(confidential|intended recipient|privileged|disclaimer|unsubscribe|manage (your )?(email )?preferences|view (this email |it )?in (your )?browser|this (e-?mail|message) and any attachments)`)
+)
+
+// maxSignatureLines is how long a block after a sign-off can be and still count as a signature
+const maxSignatureLines = 8
+
+// stripSignature cuts an email body's signature block, mobile taglines and the legal
+// or mailing list footers at its end, keeping the sign-off and the name under it
+func stripSignature(body string) string {
+	lines := strings.Split(body, "\n")
+	for i, line := range lines {
+		if signatureDelimiter.MatchString(line) || mobileTagline.MatchString(strings.TrimSpace(line)) {
+			lines = lines[:i]
+			break
+		}
+	}
+
+	// Drop trailing paragraphs that read like footers
+	paragraphs := strings.Split(strings.TrimSpace(strings.Join(lines, "\n")), "\n\n")
+	for len(paragraphs) > 1 && footerPattern.MatchString(paragraphs[len(paragraphs)-1]) {
+		paragraphs = paragraphs[:len(paragraphs)-1]
+	}
+	lines = strings.Split(strings.TrimSpace(strings.Join(paragraphs, "\n\n")), "\n")
+
+	// Keep a late sign-off and the line after it, dropping contact details below
+	for i := len(lines) - 1; i >= 0 && i >= len(lines)-maxSignatureLines-2; i-- {
+		if !signOffLine.MatchString(strings.TrimSpace(lines[i])) {
+			continue
+		}
+		end := i + 1
+		for end < len(lines) && strings.TrimSpace(lines[end]) == "" {
+			end++
+		}
+		lines = lines[:min(end+1, len(lines))]
+		break
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
+
+// threadMarkdown lays a thread document out as Markdown
+func threadMarkdown(doc threadDocument) string {
+	var out strings.Builder
+	fmt.Fprintf(&out, "# %s\n\n", doc.Subject)
+	fmt.Fprintf(&out, "- **Thread:** %s\n- **Messages:** %d\n- **Participants:** %s\n- **Exported:** %s\n",
+		doc.ThreadID, len(doc.Messages), strings.Join(doc.Participants, "; "), doc.Exported)
+	if doc.Redacted != "" {
+		fmt.Fprintf(&out, "- **Redacted:** %s\n", doc.Redacted)
+	}
+	for i, message := range doc.Messages {
+		fmt.Fprintf(&out, "\n---\n\n## %d. %s\n\n", i+1, message.From)
+		fmt.Fprintf(&out, "- **Date:** %s\n", message.Date)
+		if message.To != "" {
+			fmt.Fprintf(&out, "- **To:** %s\n", message.To)
+		}
+		if message.Cc != "" {
+			fmt.Fprintf(&out, "- **Cc:** %s\n", message.Cc)
+		}
+		if message.Subject != "" {
+			fmt.Fprintf(&out, "- **Subject:** %s\n", message.Subject)
+		}
+		fmt.Fprintf(&out, "- **Message ID:** %s\n\n%s\n", message.ID, message.Body)
+		if len(message.Attachments) > 0 {
+			out.WriteString("\n**Attachments:**\n")
+			for _, attachment := range message.Attachments {
+				fmt.Fprintf(&out, "- %s (%s, %s)\n", attachment.Filename, attachment.MIMEType, attachment.Size)
+			}
+		}
+	}
+	return out.String()
+}
+
+// threadHTMLTemplate lays a thread document out as a printable page. Bodies are shown
+// as escaped text, so nothing in an email can run or load in the renderer.
+var threadHTMLTemplate = template.Must(template.New("thread").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Subject}}</title>
+<style>
+@page { margin: 2cm; }
+body { font-family: Helvetica, Arial, sans-serif; font-size: 11pt; color: #222; margin: 2em; }
+h1 { font-size: 16pt; margin-bottom: 0.3em; }
+.meta { color: #555; font-size: 9pt; }
+.message { border-top: 1px solid #ccc; margin-top: 1.5em; padding-top: 0.8em; page-break-inside: auto; }
+.headers td { padding: 0 1em 0 0; vertical-align: top; font-size: 9pt; }
+.headers td:first-child { color: #555; font-weight: bold; }
+.body { white-space: pre-wrap; margin-top: 0.8em; }
+.attachments { font-size: 9pt; color: #555; }
+</style>
+</head>
+<body>
+<h1>{{.Subject}}</h1>
+<div class="meta">Thread {{.ThreadID}} &middot; {{len .Messages}} messages &middot; exported {{.Exported}}</div>
+{{if .Redacted}}<div class="meta">Redacted: {{.Redacted}}</div>{{end}}
+{{range $i, $m := .Messages}}
+<div class="message">
+<table class="headers">
+<tr><td>From</td><td>{{$m.From}}</td></tr>
+<tr><td>Date</td><td>{{$m.Date}}</td></tr>
+{{if $m.To}}<tr><td>To</td><td>{{$m.To}}</td></tr>{{end}}
+{{if $m.Cc}}<tr><td>Cc</td><td>{{$m.Cc}}</td></tr>{{end}}
+{{if $m.Subject}}<tr><td>Subject</td><td>{{$m.Subject}}</td></tr>{{end}}
+</table>
+<div class="body">{{$m.Body}}</div>
+{{if $m.Attachments}}<div class="attachments"><strong>Attachments:</strong><ul>{{range $m.Attachments}}<li>{{.Filename}} ({{.MIMEType}}, {{.Size}})</li>{{end}}</ul></div>{{end}}
+</div>
+{{end}}
+</body>
+</html>
+`))
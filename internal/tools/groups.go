@@ -0,0 +1,209 @@
+package tools
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/mail"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+
+	"auto-gmail/internal/toolerr"
+)
+
+// recipientGroups maps lowercase group names to their members, each an address
+// or a "Name <address>" pair
+type recipientGroups map[string][]string
+
+// groupsFile is where this server's recipient groups are stored, next to its token.
+// It's plain JSON so users can define groups by hand.
+func (g *GmailServer) groupsFile() string {
+	return g.dataFile("groups.json")
+}
+
+// loadGroups reads the recipient groups; a missing file means no groups
+func (g *GmailServer) loadGroups() (recipientGroups, error) {
+	var stored struct {
+		Groups recipientGroups `json:"groups"`
+	}
+	data, err := os.ReadFile(g.groupsFile())
+	if os.IsNotExist(err) {
+		return recipientGroups{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return nil, toolerr.Errorf(toolerr.ParseFailure, "invalid_data_file", "invalid groups file %s: %v", g.groupsFile(), err)
+	}
+
+	groups := recipientGroups{}
+	for name, members := range stored.Groups {
+		groups[strings.ToLower(strings.TrimSpace(name))] = members
+	}
+	return groups, nil
+}
+
+// parseMembers splits a comma-separated recipient list into members, rejecting
+// entries that aren't addresses
+func parseMembers(list string) ([]string, error) {
+	if strings.TrimSpace(list) == "" {
+		return nil, nil
+	}
+	addresses, err := mail.ParseAddressList(list)
+	if err != nil {
+		return nil, toolerr.Errorf(toolerr.InvalidInput, "invalid_recipients", "invalid recipients %q: %v", list, err)
+	}
+	members := make([]string, len(addresses))
+	for i, address := range addresses {
+		members[i] = formatMember(address)
+	}
+	return members, nil
+}
+
+// formatMember writes an address as "Name <address>", or just the address without a name
+func formatMember(address *mail.Address) string {
+	if address.Name == "" {
+		return address.Address
+	}
+	return address.String()
+}
+
+// dedupeMembers drops repeated addresses (compared case-insensitively), keeping the first
+func dedupeMembers(members []string) []string {
+	seen := map[string]bool{}
+	var unique []string
+	for _, member := range members {
+		address := strings.ToLower(senderAddress(member))
+		if seen[address] {
+			continue
+		}
+		seen[address] = true
+		unique = append(unique, member)
+	}
+	return unique
+}
+
+// ExpandRecipients joins the addresses in to with the members of the comma-separated
+// groups, removing duplicates, into a To header value. Without groups, to is used as is.
+func (g *GmailServer) ExpandRecipients(to, groupNames string) (string, error) {
+	if strings.TrimSpace(groupNames) == "" {
+		return strings.TrimSpace(to), nil
+	}
+	members, err := parseMembers(to)
+	if err != nil {
+		return "", err
+	}
+
+	groups, err := g.loadGroups()
+	if err != nil {
+		return "", err
+	}
+	for _, name := range strings.Split(groupNames, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		group, ok := groups[name]
+		if !ok {
+			return "", toolerr.Errorf(toolerr.NotFound, "group_not_found", "no recipient group named %q; known groups: %s", name, strings.Join(groups.names(), ", "))
+		}
+		members = append(members, group...)
+	}
+
+	members = dedupeMembers(members)
+	if len(members) == 0 {
+		return "", toolerr.Errorf(toolerr.InvalidInput, "empty_group", "the groups %q have no members", groupNames)
+	}
+	return strings.Join(members, ", "), nil
+}
+
+// names lists the groups alphabetically
+func (groups recipientGroups) names() []string {
+	names := make([]string, 0, len(groups))
+	for name := range groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ManageGroups lists, creates, edits or deletes recipient groups. action is "list",
+// "set" (replace the members), "add", "remove" (members) or "delete" (the group).
+func (g *GmailServer) ManageGroups(action, name, members string) (*mcp.CallToolResult, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if action == "" {
+		action = "list"
+	}
+	if action != "list" && name == "" {
+		return toolerr.Invalid("name parameter is required to change a group"), nil
+	}
+
+	g.groupsMu.Lock()
+	defer g.groupsMu.Unlock()
+
+	groups, err := g.loadGroups()
+	if err != nil {
+		return toolerr.Result(err, "Failed to read groups"), nil
+	}
+	changed, err := parseMembers(members)
+	if err != nil {
+		return toolerr.Result(err, ""), nil
+	}
+
+	switch action {
+	case "list":
+	case "set", "add":
+		if len(changed) == 0 {
+			return toolerr.Invalid(fmt.Sprintf("members parameter is required to %s members", action)), nil
+		}
+		if action == "add" {
+			changed = append(groups[name], changed...)
+		}
+		groups[name] = dedupeMembers(changed)
+	case "remove":
+		existing, ok := groups[name]
+		if !ok {
+			return toolerr.New(toolerr.NotFound, "group_not_found", fmt.Sprintf("No recipient group named '%s'", name)).Result(), nil
+		}
+		removed := map[string]bool{}
+		for _, member := range changed {
+			removed[strings.ToLower(senderAddress(member))] = true
+		}
+		var kept []string
+		for _, member := range existing {
+			if !removed[strings.ToLower(senderAddress(member))] {
+				kept = append(kept, member)
+			}
+		}
+		groups[name] = kept
+	case "delete":
+		if _, ok := groups[name]; !ok {
+			return toolerr.New(toolerr.NotFound, "group_not_found", fmt.Sprintf("No recipient group named '%s'", name)).Result(), nil
+		}
+		delete(groups, name)
+	default:
+		return toolerr.Invalid(fmt.Sprintf("Invalid action %q: use \"list\", \"set\", \"add\", \"remove\" or \"delete\"", action)), nil
+	}
+
+	if action != "list" {
+		data, _ := json.MarshalIndent(map[string]interface{}{"groups": groups}, "", "  ")
+		if err := os.WriteFile(g.groupsFile(), data, 0600); err != nil {
+			return toolerr.Result(err, "Failed to save groups"), nil
+		}
+	}
+
+	result := map[string]interface{}{
+		"action": action,
+		"groups": groups,
+		"file":   g.groupsFile(),
+	}
+	if name != "" && action != "list" {
+		result["group"] = name
+	}
+
+	resultJSON, _ := json.MarshalIndent(result, "", "  ")
+	return mcp.NewToolResultText(string(resultJSON)), nil
+}
@@ -0,0 +1,186 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+
+	"auto-gmail/internal/gmailclient"
+
+	"google.golang.org/api/gmail/v1"
+)
+
+// hydrateThreads fetches full thread details for search results in batches, using the cache
+// for threads whose historyId hasn't changed. Threads that fail to load are left out of the map.
+func (g *GmailServer) hydrateThreads(ctx context.Context, threads []*gmail.Thread) map[string]*gmail.Thread {
+	hydrated := make(map[string]*gmail.Thread, len(threads))
+
+	var requests []gmailclient.BatchRequest
+	var pending []*gmail.Thread
+	var cachedEntries []*cacheEntry
+	for _, thread := range threads {
+		entry, cached := g.cache.get("thread:" + thread.Id)
+		if cached && thread.HistoryId != 0 && entry.historyID == thread.HistoryId {
+			g.cache.record(&g.cache.hits)
+			hydrated[thread.Id] = entry.value.(*gmail.Thread)
+			continue
+		}
+
+		req := gmailclient.BatchRequest{Path: fmt.Sprintf("threads/%s?format=full", url.PathEscape(thread.Id))}
+		if cached {
+			req.ETag = entry.etag
+		} else {
+			entry = nil
+		}
+		requests = append(requests, req)
+		pending = append(pending, thread)
+		cachedEntries = append(cachedEntries, entry)
+	}
+
+	if len(requests) == 0 {
+		return hydrated
+	}
+
+	// Fall back to one request per thread when batching isn't available or fails
+	var responses []gmailclient.BatchResponse
+	var err error
+	batcher, ok := g.client.(gmailclient.BatchGetter)
+	if ok {
+		responses, err = batcher.BatchGet(ctx, requests)
+		if err != nil {
+			log.Printf("Warning: %v; fetching threads individually", err)
+		}
+	}
+	if !ok || err != nil {
+		for _, thread := range pending {
+			if detail, err := g.getThread(ctx, thread.Id, thread.HistoryId); err == nil {
+				hydrated[thread.Id] = detail
+			}
+		}
+		return hydrated
+	}
+
+	for i, resp := range responses {
+		threadID := pending[i].Id
+		switch {
+		case resp.Status == http.StatusNotModified && cachedEntries[i] != nil:
+			g.cache.record(&g.cache.revalidated)
+			hydrated[threadID] = cachedEntries[i].value.(*gmail.Thread)
+		case resp.Status == http.StatusOK:
+			var thread gmail.Thread
+			if err := json.Unmarshal(resp.Body, &thread); err != nil {
+				log.Printf("Warning: Failed to decode thread %s: %v", threadID, err)
+				continue
+			}
+			g.cache.record(&g.cache.misses)
+			g.cache.put("thread:"+threadID, resp.Header.Get("ETag"), thread.HistoryId, &thread)
+			hydrated[threadID] = &thread
+		default:
+			log.Printf("Warning: Failed to get thread %s: status %d", threadID, resp.Status)
+		}
+	}
+	return hydrated
+}
+
+// hydrateMessages fetches full messages in batches. Messages that fail to load are left out of the map.
+func (g *GmailServer) hydrateMessages(ctx context.Context, messageIDs []string) map[string]*gmail.Message {
+	hydrated := make(map[string]*gmail.Message, len(messageIDs))
+	if len(messageIDs) == 0 {
+		return hydrated
+	}
+
+	requests := make([]gmailclient.BatchRequest, len(messageIDs))
+	for i, id := range messageIDs {
+		requests[i] = gmailclient.BatchRequest{Path: fmt.Sprintf("messages/%s?format=full", url.PathEscape(id))}
+	}
+
+	// Fall back to one request per message when batching isn't available or fails
+	var responses []gmailclient.BatchResponse
+	var err error
+	batcher, ok := g.client.(gmailclient.BatchGetter)
+	if ok {
+		responses, err = batcher.BatchGet(ctx, requests)
+		if err != nil {
+			log.Printf("Warning: %v; fetching messages individually", err)
+		}
+	}
+	if !ok || err != nil {
+		for _, id := range messageIDs {
+			if message, err := g.getMessage(ctx, id); err == nil {
+				hydrated[id] = message
+			}
+		}
+		return hydrated
+	}
+
+	for i, resp := range responses {
+		if resp.Status != http.StatusOK {
+			log.Printf("Warning: Failed to get message %s: status %d", messageIDs[i], resp.Status)
+			continue
+		}
+		var message gmail.Message
+		if err := json.Unmarshal(resp.Body, &message); err != nil {
+			log.Printf("Warning: Failed to decode message %s: %v", messageIDs[i], err)
+			continue
+		}
+		hydrated[messageIDs[i]] = &message
+	}
+	return hydrated
+}
+
+// hydrateMessageHeaders fetches label IDs, dates and the named headers of messages in batches,
+// without bodies. Messages that fail to load are left out of the map.
+func (g *GmailServer) hydrateMessageHeaders(ctx context.Context, messageIDs []string, headers []string) map[string]*gmail.Message {
+	query := url.Values{"format": {"metadata"}, "metadataHeaders": headers}
+	return g.hydratePartialMessages(ctx, messageIDs, query, gmailclient.GetOptions{Format: "metadata", MetadataHeaders: headers})
+}
+
+// hydratePartialMessages fetches messages in batches with the given query parameters, or one by
+// one with opts when batching isn't available. Messages that fail to load are left out of the map.
+func (g *GmailServer) hydratePartialMessages(ctx context.Context, messageIDs []string, query url.Values, opts gmailclient.GetOptions) map[string]*gmail.Message {
+	hydrated := make(map[string]*gmail.Message, len(messageIDs))
+	if len(messageIDs) == 0 {
+		return hydrated
+	}
+
+	requests := make([]gmailclient.BatchRequest, len(messageIDs))
+	for i, id := range messageIDs {
+		requests[i] = gmailclient.BatchRequest{Path: fmt.Sprintf("messages/%s?%s", url.PathEscape(id), query.Encode())}
+	}
+
+	// Fall back to one request per message when batching isn't available or fails
+	var responses []gmailclient.BatchResponse
+	var err error
+	batcher, ok := g.client.(gmailclient.BatchGetter)
+	if ok {
+		responses, err = batcher.BatchGet(ctx, requests)
+		if err != nil {
+			log.Printf("Warning: %v; fetching messages individually", err)
+		}
+	}
+	if !ok || err != nil {
+		for _, id := range messageIDs {
+			if message, err := g.client.GetMessage(ctx, id, opts); err == nil {
+				hydrated[id] = message
+			}
+		}
+		return hydrated
+	}
+
+	for i, resp := range responses {
+		if resp.Status != http.StatusOK {
+			log.Printf("Warning: Failed to get message %s: status %d", messageIDs[i], resp.Status)
+			continue
+		}
+		var message gmail.Message
+		if err := json.Unmarshal(resp.Body, &message); err != nil {
+			log.Printf("Warning: Failed to decode message %s: %v", messageIDs[i], err)
+			continue
+		}
+		hydrated[messageIDs[i]] = &message
+	}
+	return hydrated
+}
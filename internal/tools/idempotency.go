@@ -0,0 +1,131 @@
+package tools
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+
+	"auto-gmail/internal/toolerr"
+)
+
+// idempotencyTTL is how long a mutating call's result is replayed for a repeated key
+const idempotencyTTL = 24 * time.Hour
+
+// maxIdempotencyKeys caps the stored keys; the oldest are dropped first
+const maxIdempotencyKeys = 500
+
+// idempotentCall is the recorded outcome of a mutating tool call
+type idempotentCall struct {
+	Tool      string    `json:"tool"`
+	Arguments string    `json:"arguments"` // hash of the call's arguments
+	Result    string    `json:"result"`
+	StoredAt  time.Time `json:"storedAt"`
+}
+
+// idempotencyFile is where recent idempotency keys are stored, next to the token
+func (g *GmailServer) idempotencyFile() string {
+	return g.dataFile("idempotency.json")
+}
+
+// Idempotent runs a mutating tool call at most once per idempotency key. A retry
+// with the same key within idempotencyTTL gets the original result back instead of
+// repeating the change. Only successful results are recorded, so failed calls can
+// be retried; reusing a key with different arguments is an error.
+func (g *GmailServer) Idempotent(tool, key string, args map[string]interface{}, run func() (*mcp.CallToolResult, error)) (*mcp.CallToolResult, error) {
+	if key == "" {
+		return run()
+	}
+
+	// Hold the lock across the call so concurrent retries can't both run it
+	g.idempotencyMu.Lock()
+	defer g.idempotencyMu.Unlock()
+
+	calls := g.loadIdempotentCalls()
+	fingerprint := argumentsHash(tool, args)
+	if call, ok := calls[key]; ok {
+		if call.Tool != tool || call.Arguments != fingerprint {
+			return toolerr.New(toolerr.InvalidInput, "idempotency_key_reused", fmt.Sprintf("idempotency_key %q was already used for a different %s call; use a new key for a new request", key, call.Tool)).Result(), nil
+		}
+		log.Printf("🔁 Replaying %s result for idempotency key %s", tool, key)
+		return mcp.NewToolResultText(call.Result), nil
+	}
+
+	result, err := run()
+	if err != nil || result == nil || result.IsError {
+		return result, err
+	}
+	text, ok := resultText(result)
+	if !ok {
+		return result, nil
+	}
+
+	calls[key] = idempotentCall{Tool: tool, Arguments: fingerprint, Result: text, StoredAt: time.Now()}
+	g.saveIdempotentCalls(calls)
+	return result, nil
+}
+
+// loadIdempotentCalls reads the stored keys, dropping expired ones
+func (g *GmailServer) loadIdempotentCalls() map[string]idempotentCall {
+	calls := map[string]idempotentCall{}
+	data, err := os.ReadFile(g.idempotencyFile())
+	if err != nil {
+		return calls
+	}
+	if err := json.Unmarshal(data, &calls); err != nil {
+		log.Printf("Warning: Invalid idempotency file %s: %v", g.idempotencyFile(), err)
+		return map[string]idempotentCall{}
+	}
+	for key, call := range calls {
+		if time.Since(call.StoredAt) > idempotencyTTL {
+			delete(calls, key)
+		}
+	}
+	return calls
+}
+
+// saveIdempotentCalls writes the stored keys, keeping only the newest maxIdempotencyKeys
+func (g *GmailServer) saveIdempotentCalls(calls map[string]idempotentCall) {
+	for len(calls) > maxIdempotencyKeys {
+		oldest := ""
+		for key, call := range calls {
+			if oldest == "" || call.StoredAt.Before(calls[oldest].StoredAt) {
+				oldest = key
+			}
+		}
+		delete(calls, oldest)
+	}
+
+	data, _ := json.MarshalIndent(calls, "", "  ")
+	if err := os.WriteFile(g.idempotencyFile(), data, 0600); err != nil {
+		log.Printf("Warning: Failed to save idempotency file %s: %v", g.idempotencyFile(), err)
+	}
+}
+
+// argumentsHash identifies a call by its tool and arguments, ignoring the key itself
+func argumentsHash(tool string, args map[string]interface{}) string {
+	filtered := map[string]interface{}{}
+	for name, value := range args {
+		if name != "idempotency_key" {
+			filtered[name] = value
+		}
+	}
+	// Map keys are marshaled in sorted order, so equal arguments hash equally
+	data, _ := json.Marshal(filtered)
+	sum := sha256.Sum256(append([]byte(tool+"\x00"), data...))
+	return hex.EncodeToString(sum[:])
+}
+
+// resultText returns the text of a single-text tool result
+func resultText(result *mcp.CallToolResult) (string, bool) {
+	if len(result.Content) != 1 {
+		return "", false
+	}
+	text, ok := result.Content[0].(mcp.TextContent)
+	return text.Text, ok
+}
@@ -0,0 +1,199 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"auto-gmail/internal/gmailclient"
+	"auto-gmail/internal/toolerr"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"google.golang.org/api/gmail/v1"
+)
+
+// maxEMLBytes caps the size of a file import_eml reads
+const maxEMLBytes = 50 << 20
+
+// importSystemLabels are the system labels an imported message may be given
+var importSystemLabels = []string{"INBOX", "UNREAD", "STARRED", "IMPORTANT", "SENT"}
+
+// draftDroppedHeaders are header name prefixes of delivery and trace headers that
+// don't belong in a new draft made from a received message
+var draftDroppedHeaders = []string{"received", "return-path", "delivered-to", "message-id", "dkim-signature", "authentication-results", "arc-", "x-received", "x-gm-", "x-google-"}
+
+// importDir is the only directory import_eml reads from: "imports" next to the
+// account's token, or the account's own subdirectory of GMAIL_MCP_IMPORT_DIR, so no
+// account can import files meant for another
+func (g *GmailServer) importDir() string {
+	if root := strings.TrimSpace(os.Getenv("GMAIL_MCP_IMPORT_DIR")); root != "" {
+		return filepath.Join(root, g.accountDirName())
+	}
+	return g.dataFile("imports")
+}
+
+// resolveImportPath turns a path relative to the import directory (or an absolute one
+// inside it) into a real file path, refusing anything that leads outside it
+func (g *GmailServer) resolveImportPath(path string) (string, error) {
+	dir, err := filepath.Abs(g.importDir())
+	if err != nil {
+		return "", err
+	}
+	if resolved, err := filepath.EvalSymlinks(dir); err == nil {
+		dir = resolved
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(dir, path)
+	}
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return "", err
+	}
+	if rel, err := filepath.Rel(dir, resolved); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s is outside the import directory %s", path, dir)
+	}
+	return resolved, nil
+}
+
+// ImportEML adds a local .eml file to the mailbox. Mode "import" (the default) treats
+// it like received mail, "insert" stores it exactly as it is, skipping spam and filter
+// checks, and "draft" turns it into a draft to edit and resend. labels are system
+// labels or label names, created if missing, and default to INBOX.
+func (g *GmailServer) ImportEML(ctx context.Context, path, mode string, labels []string) (*mcp.CallToolResult, error) {
+	if mode == "" {
+		mode = "import"
+	}
+	if mode != "import" && mode != "insert" && mode != "draft" {
+		return toolerr.Invalid(fmt.Sprintf("Invalid mode '%s': use import, insert or draft", mode)), nil
+	}
+
+	resolved, err := g.resolveImportPath(path)
+	if err != nil {
+		return toolerr.New(toolerr.InvalidInput, "invalid_path", fmt.Sprintf("Can't read %s: %v", path, err)).
+			WithHint(fmt.Sprintf("Put the .eml file in %s and pass its name.", g.importDir())).Result(), nil
+	}
+	info, err := os.Stat(resolved)
+	if err != nil {
+		return toolerr.Result(err, "Failed to read the file"), nil
+	}
+	if info.Size() > maxEMLBytes {
+		return toolerr.Invalid(fmt.Sprintf("%s is %d bytes, over the %d byte import limit", path, info.Size(), maxEMLBytes)), nil
+	}
+	raw, err := os.ReadFile(resolved)
+	if err != nil {
+		return toolerr.Result(err, "Failed to read the file"), nil
+	}
+	parsed, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return toolerr.New(toolerr.ParseFailure, "invalid_eml", fmt.Sprintf("%s isn't an RFC 822 email message: %v", path, err)).Result(), nil
+	}
+
+	result := map[string]interface{}{
+		"path":    resolved,
+		"mode":    mode,
+		"subject": parsed.Header.Get("Subject"),
+		"from":    parsed.Header.Get("From"),
+		"date":    parsed.Header.Get("Date"),
+	}
+
+	if mode == "draft" {
+		draft, err := g.client.CreateDraft(ctx, &gmail.Draft{Message: &gmail.Message{Raw: base64.URLEncoding.EncodeToString(draftFromEML(raw))}})
+		if err != nil {
+			return toolerr.Result(err, "Failed to create draft"), nil
+		}
+		result["draftId"] = draft.Id
+		if draft.Message != nil {
+			result["messageId"] = draft.Message.Id
+		}
+		result["note"] = "Delivery headers were removed; review the recipients before sending, since they're the original ones"
+		resultJSON, _ := json.MarshalIndent(result, "", "  ")
+		return mcp.NewToolResultText(string(resultJSON)), nil
+	}
+
+	importer, ok := g.client.(gmailclient.MessageImporter)
+	if !ok {
+		return toolerr.New(toolerr.Unavailable, "import_unsupported", "This mailbox can't import messages").
+			WithHint("Use mode draft instead, or connect a Gmail account.").Result(), nil
+	}
+
+	// Gmail keeps duplicates, so a file imported before is reported instead of added again
+	if messageID := strings.Trim(strings.TrimSpace(parsed.Header.Get("Message-Id")), "<>"); messageID != "" {
+		existing, err := g.client.ListMessages(ctx, "rfc822msgid:"+messageID, 1)
+		if err == nil && len(existing.Messages) > 0 {
+			result["messageId"] = existing.Messages[0].Id
+			result["threadId"] = existing.Messages[0].ThreadId
+			result["alreadyImported"] = true
+			result["note"] = "A message with the same Message-ID is already in the mailbox; nothing was imported"
+			resultJSON, _ := json.MarshalIndent(result, "", "  ")
+			return mcp.NewToolResultText(string(resultJSON)), nil
+		}
+	}
+
+	if len(labels) == 0 {
+		labels = []string{"INBOX"}
+	}
+	var labelIDs []string
+	for _, label := range labels {
+		if system := strings.ToUpper(label); containsString(importSystemLabels, system) {
+			labelIDs = append(labelIDs, system)
+			continue
+		}
+		id, err := g.ensureLabel(ctx, label)
+		if err != nil {
+			return toolerr.Result(g.permissionHint(err), fmt.Sprintf("Failed to get label %q", label)), nil
+		}
+		labelIDs = append(labelIDs, id)
+	}
+
+	message, err := importer.ImportMessage(ctx, raw, labelIDs, mode == "insert")
+	if err != nil {
+		return toolerr.Result(g.permissionHint(err), "Failed to import the message"), nil
+	}
+	result["messageId"] = message.Id
+	result["threadId"] = message.ThreadId
+	result["labels"] = labels
+	resultJSON, _ := json.MarshalIndent(result, "", "  ")
+	return mcp.NewToolResultText(string(resultJSON)), nil
+}
+
+// draftFromEML drops the delivery and trace headers from a raw message, leaving the
+// rest of the headers and the body byte for byte
+func draftFromEML(raw []byte) []byte {
+	headerEnd := bytes.Index(raw, []byte("\r\n\r\n"))
+	if lf := bytes.Index(raw, []byte("\n\n")); lf >= 0 && (headerEnd < 0 || lf < headerEnd) {
+		headerEnd = lf
+	}
+	if headerEnd < 0 {
+		return raw
+	}
+
+	var kept strings.Builder
+	drop := false
+	for _, line := range strings.SplitAfter(string(raw[:headerEnd]), "\n") {
+		if line == "" {
+			continue
+		}
+		// Folded continuation lines belong to the header above them
+		if line[0] != ' ' && line[0] != '\t' {
+			name, _, _ := strings.Cut(line, ":")
+			name = strings.ToLower(strings.TrimSpace(name))
+			drop = false
+			for _, prefix := range draftDroppedHeaders {
+				if strings.HasPrefix(name, prefix) {
+					drop = true
+					break
+				}
+			}
+		}
+		if !drop {
+			kept.WriteString(line)
+		}
+	}
+	return append([]byte(strings.TrimRight(kept.String(), "\r\n")), raw[headerEnd:]...)
+}
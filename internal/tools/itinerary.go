@@ -0,0 +1,218 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"auto-gmail/internal/extract"
+	"auto-gmail/internal/toolerr"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"google.golang.org/api/gmail/v1"
+)
+
+// maxItineraryScan caps how many travel emails assemble_itinerary reads
+const maxItineraryScan = 100
+
+// itineraryKeywords are the subject words searched for travel confirmations, one query each
+var itineraryKeywords = []string{"flight", "itinerary", "booking", "reservation", "hotel", "rental", "trip"}
+
+// travelKinds classify a confirmation by its subject and body, checked in order
+var travelKinds = []struct {
+	kind    string
+	pattern *regexp.Regexp
+}{
+	{"flight", regexp.MustCompile(`(?i)\b(flight|boarding pass|airline|e-ticket|departure gate)\b`)},
+	{"car", regexp.MustCompile(`(?i)\b(car rental|rental car|rent a car|vehicle|hertz|avis|enterprise|sixt|budget)\b`)},
+	{"hotel", regexp.MustCompile(`(?i)\b(hotel|check-in|check in|your stay|room|nights?|airbnb|inn|resort)\b`)},
+}
+
+// travelStart and travelEnd are the date labels marking when a booking begins and ends
+var (
+	travelStart = []string{"departure", "check-in", "pick-up"}
+	travelEnd   = []string{"arrival", "check-out", "drop-off"}
+)
+
+// itineraryItem is one flight, hotel stay or car rental
+type itineraryItem struct {
+	Kind         string   `json:"kind"`
+	Start        string   `json:"start,omitempty"`
+	End          string   `json:"end,omitempty"`
+	Vendor       string   `json:"vendor"`
+	Confirmation string   `json:"confirmation,omitempty"`
+	Flights      []string `json:"flights,omitempty"`
+	Address      string   `json:"address,omitempty"`
+	Subject      string   `json:"subject"`
+	MessageID    string   `json:"messageId"`
+	ThreadID     string   `json:"threadId"`
+}
+
+// AssembleItinerary gathers flight, hotel and car rental confirmations received
+// between after and before (YYYY/MM/DD), orders them by travel date and, with ics,
+// writes them to an iCalendar file next to the token
+func (g *GmailServer) AssembleItinerary(ctx context.Context, after, before string, ics bool) (*mcp.CallToolResult, error) {
+	dateTerms, err := dateRangeTerms(after, before, "newer_than:90d")
+	if err != nil {
+		return toolerr.Result(err, ""), nil
+	}
+	messageIDs, err := g.subjectKeywordMessages(ctx, itineraryKeywords, dateTerms, maxItineraryScan)
+	if err != nil {
+		return toolerr.Result(err, "Failed to search travel emails"), nil
+	}
+	messages := g.hydrateMessages(ctx, messageIDs)
+
+	items := []itineraryItem{}
+	for _, id := range messageIDs {
+		message, ok := messages[id]
+		if !ok || hasLabelID(message, "SENT") {
+			continue
+		}
+		if item, ok := travelItem(message); ok {
+			items = append(items, item)
+		}
+	}
+
+	// Chronological by travel date; bookings without one go last
+	sort.SliceStable(items, func(i, j int) bool {
+		if (items[i].Start == "") != (items[j].Start == "") {
+			return items[j].Start == ""
+		}
+		return items[i].Start < items[j].Start
+	})
+
+	result := map[string]interface{}{
+		"query":           strings.Join(dateTerms, " "),
+		"messagesScanned": len(messageIDs),
+		"itemCount":       len(items),
+		"itinerary":       items,
+	}
+	if ics {
+		path := g.dataFile("itinerary.ics")
+		calendar := itineraryICS(items)
+		// The calendar holds mailbox details, so it's private to the user like the other
+		// data files; WriteFile keeps the mode of a file an older version wrote
+		err := os.WriteFile(path, []byte(calendar), 0600)
+		if err == nil {
+			err = os.Chmod(path, 0600)
+		}
+		if err != nil {
+			return toolerr.Result(err, fmt.Sprintf("Failed to write %s", path)), nil
+		}
+		result["icsFile"] = path
+		result["ics"] = calendar
+	}
+
+	resultJSON, _ := json.MarshalIndent(result, "", "  ")
+	return mcp.NewToolResultText(string(resultJSON)), nil
+}
+
+// travelItem parses a travel confirmation; ok is false for messages that aren't one
+func travelItem(message *gmail.Message) (itineraryItem, bool) {
+	subject := messageHeader(message, "Subject")
+	body := extract.EmailBody(message)
+	entities := extract.ExtractEntities(body)
+
+	item := itineraryItem{
+		Vendor:    vendorName(messageHeader(message, "From")),
+		Flights:   entities.Flights,
+		Subject:   subject,
+		MessageID: message.Id,
+		ThreadID:  message.ThreadId,
+	}
+	for _, kind := range travelKinds {
+		if kind.pattern.MatchString(subject) || (kind.kind == "flight" && len(entities.Flights) > 0) {
+			item.Kind = kind.kind
+			break
+		}
+	}
+	if item.Kind == "" {
+		for _, kind := range travelKinds {
+			if kind.pattern.MatchString(body) {
+				item.Kind = kind.kind
+				break
+			}
+		}
+	}
+	if item.Kind == "" {
+		return item, false
+	}
+
+	for _, date := range entities.Dates {
+		switch {
+		case item.Start == "" && slices.Contains(travelStart, date.Label):
+			item.Start = date.Date
+		case item.End == "" && slices.Contains(travelEnd, date.Label):
+			item.End = date.Date
+		}
+	}
+	if item.Start == "" && len(entities.Dates) > 0 {
+		item.Start = entities.Dates[0].Date
+	}
+	if item.End != "" && item.End < item.Start {
+		item.End = ""
+	}
+
+	for _, ref := range entities.References {
+		if ref.Kind == "confirmation" || item.Confirmation == "" {
+			item.Confirmation = ref.Value
+		}
+	}
+	if len(entities.Addresses) > 0 {
+		item.Address = entities.Addresses[0]
+	}
+	return item, true
+}
+
+// itineraryICS renders dated itinerary items as all-day iCalendar events
+func itineraryICS(items []itineraryItem) string {
+	lines := []string{"BEGIN:VCALENDAR", "VERSION:2.0", "PRODID:-//auto-gmail//Itinerary//EN", "CALSCALE:GREGORIAN"}
+	stamp := time.Now().UTC().Format("20060102T150405Z")
+	for _, item := range items {
+		start, err := time.Parse("2006-01-02", item.Start)
+		if err != nil {
+			continue
+		}
+		// DTEND is exclusive for all-day events
+		end := start.AddDate(0, 0, 1)
+		if parsed, err := time.Parse("2006-01-02", item.End); err == nil {
+			end = parsed.AddDate(0, 0, 1)
+		}
+
+		summary := fmt.Sprintf("%s: %s", strings.ToUpper(item.Kind[:1])+item.Kind[1:], item.Vendor)
+		if len(item.Flights) > 0 {
+			summary = fmt.Sprintf("Flight %s (%s)", strings.Join(item.Flights, ", "), item.Vendor)
+		}
+		description := item.Subject
+		if item.Confirmation != "" {
+			description = fmt.Sprintf("Confirmation: %s\n%s", item.Confirmation, item.Subject)
+		}
+
+		lines = append(lines,
+			"BEGIN:VEVENT",
+			"UID:"+item.MessageID+"@auto-gmail",
+			"DTSTAMP:"+stamp,
+			"DTSTART;VALUE=DATE:"+start.Format("20060102"),
+			"DTEND;VALUE=DATE:"+end.Format("20060102"),
+			"SUMMARY:"+icsEscape(summary),
+			"DESCRIPTION:"+icsEscape(description),
+		)
+		if item.Address != "" {
+			lines = append(lines, "LOCATION:"+icsEscape(item.Address))
+		}
+		lines = append(lines, "END:VEVENT")
+	}
+	lines = append(lines, "END:VCALENDAR")
+	return strings.Join(lines, "\r\n") + "\r\n"
+}
+
+// icsEscape escapes text values for iCalendar (RFC 5545 section 3.3.11)
+func icsEscape(text string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`).Replace(text)
+}
@@ -0,0 +1,238 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"auto-gmail/internal/toolerr"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"google.golang.org/api/gmail/v1"
+)
+
+// labelColors maps color names to a background and text color from Gmail's label
+// palette; Gmail rejects colors outside it
+var labelColors = map[string][2]string{
+	"red":    {"#fb4c2f", "#ffffff"},
+	"orange": {"#ffad47", "#ffffff"},
+	"yellow": {"#fad165", "#000000"},
+	"green":  {"#16a766", "#ffffff"},
+	"teal":   {"#43d692", "#ffffff"},
+	"blue":   {"#4a86e8", "#ffffff"},
+	"purple": {"#a479e2", "#ffffff"},
+	"pink":   {"#f691b3", "#ffffff"},
+	"gray":   {"#999999", "#ffffff"},
+	"black":  {"#000000", "#ffffff"},
+}
+
+// labelColorNames lists the color names for parameter enums
+func labelColorNames() []string {
+	names := make([]string, 0, len(labelColors))
+	for name := range labelColors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// hexColorPattern matches a #rrggbb color
+var hexColorPattern = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+// Label visibility settings as Gmail names them
+var (
+	labelListVisibilities = map[string]string{
+		"show":           "labelShow",
+		"hide":           "labelHide",
+		"show_if_unread": "labelShowIfUnread",
+	}
+	messageListVisibilities = map[string]string{
+		"show": "show",
+		"hide": "hide",
+	}
+)
+
+// labelNode is one level of the user's label hierarchy. Gmail nests labels by
+// name, so "Clients/Acme" sits under "Clients"; a parent that isn't a label itself
+// has no ID.
+type labelNode struct {
+	Name                  string       `json:"name"`
+	Path                  string       `json:"path"`
+	ID                    string       `json:"id,omitempty"`
+	BackgroundColor       string       `json:"backgroundColor,omitempty"`
+	TextColor             string       `json:"textColor,omitempty"`
+	LabelListVisibility   string       `json:"labelListVisibility,omitempty"`
+	MessageListVisibility string       `json:"messageListVisibility,omitempty"`
+	Children              []*labelNode `json:"children,omitempty"`
+}
+
+// labelTree arranges user labels into their hierarchy, sorted by name at each level
+func labelTree(labels []*gmail.Label) []*labelNode {
+	nodes := map[string]*labelNode{}
+	var roots []*labelNode
+
+	// node returns the node for a path, creating it and its parents as needed
+	var node func(path string) *labelNode
+	node = func(path string) *labelNode {
+		if existing, ok := nodes[strings.ToLower(path)]; ok {
+			return existing
+		}
+		created := &labelNode{Name: path, Path: path}
+		nodes[strings.ToLower(path)] = created
+		if slash := strings.LastIndex(path, "/"); slash > 0 {
+			parent := node(path[:slash])
+			created.Name = path[slash+1:]
+			parent.Children = append(parent.Children, created)
+		} else {
+			roots = append(roots, created)
+		}
+		return created
+	}
+
+	for _, label := range labels {
+		if label.Type == "system" {
+			continue
+		}
+		entry := node(label.Name)
+		entry.ID = label.Id
+		entry.LabelListVisibility = label.LabelListVisibility
+		entry.MessageListVisibility = label.MessageListVisibility
+		if label.Color != nil {
+			entry.BackgroundColor, entry.TextColor = label.Color.BackgroundColor, label.Color.TextColor
+		}
+	}
+
+	var sortNodes func(level []*labelNode)
+	sortNodes = func(level []*labelNode) {
+		sort.Slice(level, func(i, j int) bool { return strings.ToLower(level[i].Name) < strings.ToLower(level[j].Name) })
+		for _, entry := range level {
+			sortNodes(entry.Children)
+		}
+	}
+	sortNodes(roots)
+	return roots
+}
+
+// ListLabels returns the user's labels as a tree, plus the system labels by ID
+func (g *GmailServer) ListLabels(ctx context.Context) (*mcp.CallToolResult, error) {
+	labels, err := g.client.ListLabels(ctx)
+	if err != nil {
+		return toolerr.Result(err, "Failed to list labels"), nil
+	}
+
+	userLabels := 0
+	var systemLabels []string
+	for _, label := range labels.Labels {
+		if label.Type == "system" {
+			systemLabels = append(systemLabels, label.Id)
+		} else {
+			userLabels++
+		}
+	}
+	sort.Strings(systemLabels)
+
+	result := map[string]interface{}{
+		"labels":       labelTree(labels.Labels),
+		"userLabels":   userLabels,
+		"systemLabels": systemLabels,
+	}
+	resultJSON, _ := json.MarshalIndent(result, "", "  ")
+	return mcp.NewToolResultText(string(resultJSON)), nil
+}
+
+// labelSettings is how create_label should set up a new label
+type labelSettings struct {
+	Color       string // a labelColors name, or a #rrggbb background from Gmail's palette
+	TextColor   string // #rrggbb, for a hex Color
+	LabelList   string // a labelListVisibilities key
+	MessageList string // a messageListVisibilities key
+}
+
+// CreateLabel creates a label, nesting it under the parents in a "Parent/Child" name.
+// Missing parents are created first, with the default settings, since Gmail only
+// shows a label as nested when its parent exists. An existing label is returned unchanged.
+func (g *GmailServer) CreateLabel(ctx context.Context, name string, settings labelSettings) (*mcp.CallToolResult, error) {
+	var parts []string
+	for _, part := range strings.Split(name, "/") {
+		if part = strings.TrimSpace(part); part == "" {
+			return toolerr.Invalid(fmt.Sprintf("Invalid label name %q: every level of a Parent/Child path needs a name", name)), nil
+		}
+		parts = append(parts, part)
+	}
+
+	label := &gmail.Label{LabelListVisibility: "labelShow", MessageListVisibility: "show"}
+	if settings.Color != "" {
+		background, text := settings.Color, settings.TextColor
+		if named, ok := labelColors[strings.ToLower(background)]; ok {
+			background, text = named[0], named[1]
+		}
+		if text == "" {
+			text = "#ffffff"
+		}
+		if !hexColorPattern.MatchString(background) || !hexColorPattern.MatchString(text) {
+			return toolerr.Invalid(fmt.Sprintf("Invalid color %q: use %s or a #rrggbb color from Gmail's label palette", settings.Color, strings.Join(labelColorNames(), ", "))), nil
+		}
+		label.Color = &gmail.LabelColor{BackgroundColor: strings.ToLower(background), TextColor: strings.ToLower(text)}
+	}
+	if settings.LabelList != "" {
+		visibility, ok := labelListVisibilities[settings.LabelList]
+		if !ok {
+			return toolerr.Invalid(fmt.Sprintf("Invalid show_in_label_list %q: use show, hide or show_if_unread", settings.LabelList)), nil
+		}
+		label.LabelListVisibility = visibility
+	}
+	if settings.MessageList != "" {
+		visibility, ok := messageListVisibilities[settings.MessageList]
+		if !ok {
+			return toolerr.Invalid(fmt.Sprintf("Invalid show_in_message_list %q: use show or hide", settings.MessageList)), nil
+		}
+		label.MessageListVisibility = visibility
+	}
+
+	labels, err := g.client.ListLabels(ctx)
+	if err != nil {
+		return toolerr.Result(err, "Failed to list labels"), nil
+	}
+	existing := map[string]*gmail.Label{}
+	for _, l := range labels.Labels {
+		existing[strings.ToLower(l.Name)] = l
+	}
+
+	created := []string{}
+	var target *gmail.Label
+	for i := range parts {
+		path := strings.Join(parts[:i+1], "/")
+		if found, ok := existing[strings.ToLower(path)]; ok {
+			target = found
+			continue
+		}
+		create := &gmail.Label{Name: path, LabelListVisibility: "labelShow", MessageListVisibility: "show"}
+		if i == len(parts)-1 {
+			create.Color = label.Color
+			create.LabelListVisibility, create.MessageListVisibility = label.LabelListVisibility, label.MessageListVisibility
+		}
+		target, err = g.client.CreateLabel(ctx, create)
+		if err != nil {
+			if create.Color != nil && toolerr.Classify(err).Category == toolerr.InvalidInput {
+				return toolerr.New(toolerr.InvalidInput, "invalid_color", fmt.Sprintf("Failed to create label %q: %v", path, err)).
+					WithHint(fmt.Sprintf("Gmail only accepts colors from its label palette; use one of %s.", strings.Join(labelColorNames(), ", "))).Result(), nil
+			}
+			return toolerr.Result(g.permissionHint(err), fmt.Sprintf("Failed to create label %q", path)), nil
+		}
+		created = append(created, path)
+	}
+
+	result := map[string]interface{}{
+		"id":      target.Id,
+		"name":    target.Name,
+		"created": created,
+	}
+	if len(created) == 0 {
+		result["note"] = "The label already exists and was left unchanged"
+	}
+	resultJSON, _ := json.MarshalIndent(result, "", "  ")
+	return mcp.NewToolResultText(string(resultJSON)), nil
+}
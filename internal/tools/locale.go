@@ -0,0 +1,37 @@
+package tools
+
+import (
+	"auto-gmail/internal/i18n"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// localizedAdder swaps in translated tool and parameter descriptions, looked up
+// under "tool.<name>" and "tool.<name>.<parameter>"
+type localizedAdder struct {
+	next ToolAdder
+}
+
+// localized returns adder unchanged in English, or one that adds tools with the
+// descriptions translated for the configured locale
+func localized(adder ToolAdder) ToolAdder {
+	if _, ok := adder.(*localizedAdder); ok || i18n.Locale() == "en" {
+		return adder
+	}
+	return &localizedAdder{next: adder}
+}
+
+// AddTool adds tool with whichever of its descriptions have translations
+func (l *localizedAdder) AddTool(tool mcp.Tool, handler server.ToolHandlerFunc) {
+	key := "tool." + tool.Name
+	tool.Description = i18n.T(key, tool.Description)
+	for name, property := range tool.InputSchema.Properties {
+		schema, ok := property.(map[string]interface{})
+		if !ok || !i18n.Has(key+"."+name) {
+			continue
+		}
+		schema["description"] = i18n.T(key+"."+name, "")
+	}
+	l.next.AddTool(tool, handler)
+}
@@ -0,0 +1,102 @@
+package tools
+
+import (
+	"context"
+
+	"auto-gmail/internal/style"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// Mailbox is what the resource, prompt and tool handlers use of the account a request
+// acts on, grouped by the registration function that needs it. *GmailServer is the
+// only implementation.
+type Mailbox interface {
+	// style.Source lets the style guide be generated from sent mail
+	style.Source
+
+	// RegisterResources and RegisterPrompts
+	StyleGuideFile() string
+	TokenFile() string
+	CacheStats() map[string]interface{}
+	MemoryMarkdown() (string, error)
+	ContactContext(ctx context.Context, address string) (string, error)
+	ProjectStatus(ctx context.Context, name string) (string, error)
+	StyleExamples(ctx context.Context, name string) (string, error)
+	ViewMarkdown(ctx context.Context, view smartView) (string, error)
+	buildActivityReport(ctx context.Context, days int, category string) (*activityReport, error)
+
+	// RegisterAuthTools
+	StartAuthentication() (string, error)
+	Profile(ctx context.Context) (*mcp.CallToolResult, error)
+
+	// RegisterSearchTools
+	withTag(ctx context.Context, query, tag string) (string, error)
+	SearchThreads(ctx context.Context, query string, maxResults int64, sortOrder, snippets string, includeInline bool) (*mcp.CallToolResult, error)
+	CountMatches(ctx context.Context, query string) (*mcp.CallToolResult, error)
+	CategoryCounts(ctx context.Context, query string) (*mcp.CallToolResult, error)
+	BuildQuery(ctx context.Context, filter QueryFilter, rawQuery string, validate bool) (*mcp.CallToolResult, error)
+	SaveSearch(search savedSearch, remove bool) (*mcp.CallToolResult, error)
+	ListSavedSearches() (*mcp.CallToolResult, error)
+	RunSavedSearch(ctx context.Context, name string, maxResults int64) (*mcp.CallToolResult, error)
+	FetchEmailBodies(ctx context.Context, threadIDs []string, includeInline bool, contextMode string, progress *progressReporter) (*mcp.CallToolResult, error)
+	FindSimilar(ctx context.Context, messageID string, maxResults int) (*mcp.CallToolResult, error)
+	FindRelatedThreads(ctx context.Context, threadID string, windowDays int, merge bool) (*mcp.CallToolResult, error)
+	GetThreadParticipants(ctx context.Context, threadID string) (*mcp.CallToolResult, error)
+	ExportThreadDocument(ctx context.Context, threadID, format string, options exportOptions) (*mcp.CallToolResult, error)
+	SenderHistory(ctx context.Context, sender string) (*mcp.CallToolResult, error)
+
+	// RegisterDraftTools; Idempotent is also used by RegisterLabelTools
+	Idempotent(tool, key string, args map[string]interface{}, run func() (*mcp.CallToolResult, error)) (*mcp.CallToolResult, error)
+	ExpandRecipients(to, groupNames string) (string, error)
+	CreateDraft(ctx context.Context, to, subject, body, threadID, draftID, mode, fromTag string, encrypt bool) (*mcp.CallToolResult, error)
+	ManageGroups(action, name, members string) (*mcp.CallToolResult, error)
+	MailMerge(ctx context.Context, req MergeRequest) (*mcp.CallToolResult, error)
+	CritiqueDraft(ctx context.Context, body, to string) (*mcp.CallToolResult, error)
+	ImportEML(ctx context.Context, path, mode string, labels []string) (*mcp.CallToolResult, error)
+	BackupMailbox(ctx context.Context, labelNames []string, full bool, maxMessages int) (*mcp.CallToolResult, error)
+
+	// RegisterAttachmentTools
+	ExtractAttachmentByFilename(ctx context.Context, messageID, filename string, forceRefresh bool) (*mcp.CallToolResult, error)
+	SearchAttachments(ctx context.Context, filter AttachmentFilter, maxResults int) (*mcp.CallToolResult, error)
+	RenderAttachmentPreview(ctx context.Context, messageID, filename, format string, maxPages int) (*mcp.CallToolResult, error)
+
+	// RegisterLabelTools
+	MuteThread(ctx context.Context, threadID string) (*mcp.CallToolResult, error)
+	BlockSender(ctx context.Context, sender, action string) (*mcp.CallToolResult, error)
+	CleanupPlan(ctx context.Context, rulesSpec, confirmToken string) (*mcp.CallToolResult, error)
+	ListSubscriptions(ctx context.Context, months int, limit int) (*mcp.CallToolResult, error)
+	SetVIP(sender, action string) (*mcp.CallToolResult, error)
+	ExplainPriority(ctx context.Context, threadID, messageID string) (*mcp.CallToolResult, error)
+	ManageRules(action, name, query, actionList string) (*mcp.CallToolResult, error)
+	RunRulesNow(ctx context.Context, name string, dryRun bool) (*mcp.CallToolResult, error)
+	ListLabels(ctx context.Context) (*mcp.CallToolResult, error)
+	CreateLabel(ctx context.Context, name string, settings labelSettings) (*mcp.CallToolResult, error)
+
+	// RegisterAITools
+	TranslateMessage(ctx context.Context, messageID, targetLanguage string) (*mcp.CallToolResult, error)
+	AnalyzeImageAttachment(ctx context.Context, messageID, filename, question string) (*mcp.CallToolResult, error)
+	ExtractEntities(ctx context.Context, messageID, filename string, refine bool) (*mcp.CallToolResult, error)
+	AutoLabel(ctx context.Context, query string, maxThreads int, threshold float64, dryRun bool) (*mcp.CallToolResult, error)
+
+	// RegisterInsightTools
+	CollectReceipts(ctx context.Context, after, before, format string, includeAttachments bool, maxResults int) (*mcp.CallToolResult, error)
+	AssembleItinerary(ctx context.Context, after, before string, ics bool) (*mcp.CallToolResult, error)
+	ExtractDeadlines(ctx context.Context, days int, query string, includePast, ics bool) (*mcp.CallToolResult, error)
+	UnansweredQuestions(ctx context.Context, days int, query string) (*mcp.CallToolResult, error)
+	TrackApplications(ctx context.Context, months int) (*mcp.CallToolResult, error)
+	TrackProject(ctx context.Context, action, name string, threadIDs []string, query string) (*mcp.CallToolResult, error)
+	SummarizeAgreements(ctx context.Context, threadID, projectName string) (*mcp.CallToolResult, error)
+	WeeklyReport(ctx context.Context, days int, category string, emailToSelf bool) (*mcp.CallToolResult, error)
+	ManageDigests(ctx context.Context, action string, d digest) (*mcp.CallToolResult, error)
+	OutboxStatus(ctx context.Context, retryID, cancelMergeID string) (*mcp.CallToolResult, error)
+
+	// RegisterStyleTools
+	UpdateStyleGuide(text, mode string) (*mcp.CallToolResult, error)
+
+	// RegisterMemoryTools
+	RememberFact(text string, tags []string) (*mcp.CallToolResult, error)
+	RecallFacts(query, tag string) (*mcp.CallToolResult, error)
+}
+
+var _ Mailbox = (*GmailServer)(nil)
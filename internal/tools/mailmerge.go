@@ -0,0 +1,393 @@
+package tools
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/mail"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"google.golang.org/api/gmail/v1"
+
+	"auto-gmail/internal/toolerr"
+)
+
+// Mail merge limits
+const (
+	maxMergeRecipients = 500
+	// defaultMergePerHour and maxMergePerHour cap how fast a merge's scheduled sends go out
+	defaultMergePerHour = 20
+	maxMergePerHour     = 100
+	// mergePreviewCount is how many rendered messages the preview shows in full
+	mergePreviewCount = 3
+)
+
+// Merge delivery modes
+const (
+	MergeDeliverDraft = "draft"
+	MergeDeliverSend  = "send"
+)
+
+// mergePlaceholderPattern matches {{variable}} in a merge template
+var mergePlaceholderPattern = regexp.MustCompile(`\{\{\s*([A-Za-z0-9_.\-]+)\s*\}\}`)
+
+// MergeRequest is the input of mail_merge
+type MergeRequest struct {
+	Subject    string // template, may use {{variables}}
+	Body       string // template, may use {{variables}}
+	Recipients string // CSV with a header row, or a JSON array of objects; each needs an email
+	Deliver    string // MergeDeliverDraft (default) or MergeDeliverSend
+	SendAt     string // RFC 3339 time of the first scheduled send (default: now)
+	PerHour    int    // scheduled sends per hour (default defaultMergePerHour)
+	FromTag    string // optional plus-address tag to send from, as user+tag@domain
+	// ConfirmToken is the token from the dry-run preview of exactly this request;
+	// without it only the preview is returned
+	ConfirmToken string
+}
+
+// mergeMessage is one recipient's rendered message, or why it was skipped
+type mergeMessage struct {
+	Row     int    `json:"row"`
+	To      string `json:"to"`
+	Subject string `json:"subject,omitempty"`
+	Body    string `json:"body,omitempty"`
+	Skipped string `json:"skipped,omitempty"`
+	// Result of running the merge
+	DraftID  string `json:"draftId,omitempty"`
+	OutboxID string `json:"outboxId,omitempty"`
+	SendAt   string `json:"sendAt,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// parseMergeRecipients reads recipient rows from JSON (an array of objects) or CSV
+// (a header row naming the columns). Variable names are lowercased.
+func parseMergeRecipients(data string) ([]map[string]string, error) {
+	data = strings.TrimSpace(data)
+	if data == "" {
+		return nil, toolerr.Errorf(toolerr.InvalidInput, "invalid_recipients", "no recipients given")
+	}
+
+	var rows []map[string]string
+	if strings.HasPrefix(data, "[") {
+		var objects []map[string]interface{}
+		if err := json.Unmarshal([]byte(data), &objects); err != nil {
+			return nil, toolerr.Errorf(toolerr.InvalidInput, "invalid_recipients", "invalid JSON recipients: %v", err)
+		}
+		for _, object := range objects {
+			row := map[string]string{}
+			for key, value := range object {
+				if value != nil {
+					row[strings.ToLower(strings.TrimSpace(key))] = strings.TrimSpace(fmt.Sprint(value))
+				}
+			}
+			rows = append(rows, row)
+		}
+	} else {
+		reader := csv.NewReader(strings.NewReader(data))
+		reader.TrimLeadingSpace = true
+		records, err := reader.ReadAll()
+		if err != nil {
+			return nil, toolerr.Errorf(toolerr.InvalidInput, "invalid_recipients", "invalid CSV recipients: %v", err)
+		}
+		if len(records) < 2 {
+			return nil, toolerr.Errorf(toolerr.InvalidInput, "invalid_recipients", "CSV recipients need a header row and at least one recipient")
+		}
+		header := records[0]
+		for _, record := range records[1:] {
+			row := map[string]string{}
+			for i, column := range header {
+				if i < len(record) {
+					row[strings.ToLower(strings.TrimSpace(column))] = strings.TrimSpace(record[i])
+				}
+			}
+			rows = append(rows, row)
+		}
+	}
+
+	if len(rows) == 0 {
+		return nil, toolerr.Errorf(toolerr.InvalidInput, "invalid_recipients", "no recipients given")
+	}
+	if len(rows) > maxMergeRecipients {
+		return nil, toolerr.Errorf(toolerr.InvalidInput, "invalid_recipients", "%d recipients given; a merge can have at most %d", len(rows), maxMergeRecipients)
+	}
+	return rows, nil
+}
+
+// fillMergeTemplate substitutes {{variables}} from row, returning the variables it had no value for
+func fillMergeTemplate(template string, row map[string]string) (string, []string) {
+	var missing []string
+	filled := mergePlaceholderPattern.ReplaceAllStringFunc(template, func(placeholder string) string {
+		name := strings.ToLower(mergePlaceholderPattern.FindStringSubmatch(placeholder)[1])
+		value, ok := row[name]
+		if !ok || value == "" {
+			missing = append(missing, name)
+			return placeholder
+		}
+		return value
+	})
+	return filled, missing
+}
+
+// renderMerge builds every recipient's message. Rows without a valid address, with
+// missing variables or repeating an earlier address are skipped with the reason.
+func renderMerge(req MergeRequest, rows []map[string]string) []mergeMessage {
+	seen := map[string]int{}
+	messages := make([]mergeMessage, len(rows))
+	for i, row := range rows {
+		messages[i] = mergeMessage{Row: i + 1, To: row["email"]}
+
+		address, err := mail.ParseAddress(row["email"])
+		if err != nil {
+			messages[i].Skipped = fmt.Sprintf("invalid or missing email %q", row["email"])
+			continue
+		}
+		key := strings.ToLower(address.Address)
+		if first, ok := seen[key]; ok {
+			messages[i].Skipped = fmt.Sprintf("duplicate of row %d", first)
+			continue
+		}
+		seen[key] = i + 1
+		if name := row["name"]; name != "" && address.Name == "" {
+			address.Name = name
+		}
+		messages[i].To = formatMember(address)
+
+		subject, missingSubject := fillMergeTemplate(req.Subject, row)
+		body, missingBody := fillMergeTemplate(req.Body, row)
+		if missing := append(missingSubject, missingBody...); len(missing) > 0 {
+			messages[i].Skipped = fmt.Sprintf("no value for %s", strings.Join(uniqueStrings(missing), ", "))
+			continue
+		}
+		// A line break in a substituted subject would inject headers
+		messages[i].Subject = strings.Join(strings.Fields(subject), " ")
+		messages[i].Body = body
+	}
+	return messages
+}
+
+// uniqueStrings drops repeats, keeping the first occurrence
+func uniqueStrings(values []string) []string {
+	seen := map[string]bool{}
+	var unique []string
+	for _, value := range values {
+		if !seen[value] {
+			seen[value] = true
+			unique = append(unique, value)
+		}
+	}
+	return unique
+}
+
+// mergeToken identifies a merge request, so a merge only runs after its exact preview
+func mergeToken(req MergeRequest) string {
+	hash := sha256.New()
+	for _, part := range []string{req.Subject, req.Body, req.Recipients, req.Deliver, req.SendAt, fmt.Sprint(req.PerHour), req.FromTag} {
+		hash.Write([]byte(part))
+		hash.Write([]byte{0})
+	}
+	return hex.EncodeToString(hash.Sum(nil))[:16]
+}
+
+// mergeRaw is a merge message as an RFC 822 message, after the given extra headers.
+// The subject is RFC 2047 encoded, since merged values may not be ASCII.
+func mergeRaw(message mergeMessage, headers string) string {
+	return fmt.Sprintf("%sTo: %s\r\nSubject: %s\r\nContent-Type: text/plain; charset=UTF-8\r\n\r\n%s",
+		headers, message.To, mime.QEncoding.Encode("utf-8", message.Subject), strings.ReplaceAll(message.Body, "\n", "\r\n"))
+}
+
+// MailMerge fills a template for every recipient and saves the results as drafts or
+// schedules them for sending no faster than the per-hour cap. Without the confirm
+// token of a previous dry run of the same request it only returns that dry run.
+func (g *GmailServer) MailMerge(ctx context.Context, req MergeRequest) (*mcp.CallToolResult, error) {
+	if req.Deliver == "" {
+		req.Deliver = MergeDeliverDraft
+	}
+	if req.Deliver != MergeDeliverDraft && req.Deliver != MergeDeliverSend {
+		return toolerr.Invalid(fmt.Sprintf("Invalid deliver '%s': use draft or send", req.Deliver)), nil
+	}
+	limits := loadSendLimits()
+	if req.PerHour <= 0 {
+		req.PerHour = min(defaultMergePerHour, limits.PerHour)
+	}
+	if perHourCap := min(maxMergePerHour, limits.PerHour); req.PerHour > perHourCap {
+		return toolerr.Invalid(fmt.Sprintf("per_hour can be at most %d", perHourCap)), nil
+	}
+	if strings.TrimSpace(req.Subject) == "" || strings.TrimSpace(req.Body) == "" {
+		return toolerr.Invalid("subject and body templates are required"), nil
+	}
+
+	start := time.Now()
+	if req.SendAt != "" {
+		parsed, err := time.Parse(time.RFC3339, req.SendAt)
+		if err != nil {
+			return toolerr.Invalid(fmt.Sprintf("Invalid send_at %q: use RFC 3339, e.g. 2026-10-20T09:00:00-07:00", req.SendAt)), nil
+		}
+		if parsed.After(start) {
+			start = parsed
+		}
+	}
+
+	tagHeaders, err := g.tagHeaders(ctx, req.FromTag)
+	if err != nil {
+		return toolerr.Result(err, ""), nil
+	}
+	rows, err := parseMergeRecipients(req.Recipients)
+	if err != nil {
+		return toolerr.Result(err, ""), nil
+	}
+	messages := renderMerge(req, rows)
+
+	// Scheduled sends are spread out evenly to stay under the hourly cap
+	interval := time.Hour / time.Duration(req.PerHour)
+	ready := 0
+	for i := range messages {
+		if messages[i].Skipped != "" {
+			continue
+		}
+		if req.Deliver == MergeDeliverSend {
+			messages[i].SendAt = start.Add(time.Duration(ready) * interval).Format(time.RFC3339)
+		}
+		ready++
+	}
+
+	token := mergeToken(req)
+	summary := map[string]interface{}{
+		"recipients": len(messages),
+		"ready":      ready,
+		"skipped":    len(messages) - ready,
+		"deliver":    req.Deliver,
+	}
+	if req.FromTag != "" {
+		summary["fromTag"] = req.FromTag
+	}
+	if req.Deliver == MergeDeliverSend && ready > 0 {
+		summary["perHour"] = req.PerHour
+		summary["firstSend"] = start.Format(time.RFC3339)
+		summary["lastSend"] = start.Add(time.Duration(ready-1) * interval).Format(time.RFC3339)
+
+		var recipients []string
+		for _, message := range messages {
+			if message.Skipped == "" {
+				recipients = append(recipients, message.To)
+			}
+		}
+		g.outboxMu.Lock()
+		entries, err := g.loadOutbox()
+		g.outboxMu.Unlock()
+		if err != nil {
+			return toolerr.Result(err, ""), nil
+		}
+		warnings := limits.bulkWarnings(entries, recipients, time.Now())
+		if len(warnings) > 0 {
+			summary["warnings"] = warnings
+		}
+	}
+
+	if req.ConfirmToken != token {
+		if req.ConfirmToken != "" {
+			summary["note"] = "confirm_token doesn't match this request; it changed since the preview. Review this new preview."
+		}
+		return mergeResult(true, token, summary, messages)
+	}
+	if ready == 0 {
+		return toolerr.Invalid("No recipients are ready to merge; fix the skipped rows and preview again"), nil
+	}
+
+	// The token stays valid, so refuse to schedule the same merge twice
+	mergeID := token
+	if req.Deliver == MergeDeliverSend {
+		scheduled, err := g.mergeScheduled(mergeID)
+		if err != nil {
+			return toolerr.Result(err, ""), nil
+		}
+		if scheduled {
+			return toolerr.New(toolerr.InvalidInput, "merge_already_scheduled", fmt.Sprintf("Merge %s was already scheduled; see outbox_status", mergeID)).
+				WithHint("Don't retry: the merge is queued. Check its progress with outbox_status.").Result(), nil
+		}
+	}
+	failed := 0
+	for i := range messages {
+		message := &messages[i]
+		if message.Skipped != "" {
+			continue
+		}
+		raw := mergeRaw(*message, tagHeaders)
+		switch req.Deliver {
+		case MergeDeliverDraft:
+			draft, err := g.client.CreateDraft(ctx, &gmail.Draft{Message: &gmail.Message{Raw: base64.URLEncoding.EncodeToString([]byte(raw))}})
+			if err != nil {
+				message.Error = err.Error()
+				failed++
+				continue
+			}
+			message.DraftID = draft.Id
+		case MergeDeliverSend:
+			at, _ := time.Parse(time.RFC3339, message.SendAt)
+			entry, err := g.scheduleSend(message.To, message.Subject, raw, at, mergeID)
+			if err != nil {
+				message.Error = err.Error()
+				failed++
+				continue
+			}
+			message.OutboxID = entry.ID
+		}
+	}
+	summary["succeeded"] = ready - failed
+	summary["failed"] = failed
+	if req.Deliver == MergeDeliverSend {
+		summary["mergeId"] = mergeID
+		summary["note"] = "Sends are queued in the outbox; check them with outbox_status, or cancel the rest with its cancel_merge_id"
+	}
+	return mergeResult(false, token, summary, messages)
+}
+
+// mergeScheduled reports whether the outbox already has mail from the merge
+func (g *GmailServer) mergeScheduled(mergeID string) (bool, error) {
+	g.outboxMu.Lock()
+	defer g.outboxMu.Unlock()
+	entries, err := g.loadOutbox()
+	if err != nil {
+		return false, err
+	}
+	for _, entry := range entries {
+		if entry.MergeID == mergeID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// mergeResult renders a dry run (the first few messages in full, then the rest by
+// recipient) or the outcome of running the merge
+func mergeResult(dryRun bool, token string, summary map[string]interface{}, messages []mergeMessage) (*mcp.CallToolResult, error) {
+	result := map[string]interface{}{
+		"dryRun":  dryRun,
+		"summary": summary,
+	}
+	if dryRun {
+		shown := 0
+		for i := range messages {
+			if messages[i].Skipped != "" {
+				continue
+			}
+			if shown >= mergePreviewCount {
+				messages[i].Body = ""
+			}
+			shown++
+		}
+		result["confirmToken"] = token
+		result["instructions"] = "Nothing was created or sent. Show this preview to the user; to run the merge, call mail_merge again with the same arguments plus this confirm_token."
+	}
+	result["messages"] = messages
+
+	resultJSON, _ := json.MarshalIndent(result, "", "  ")
+	return mcp.NewToolResultText(string(resultJSON)), nil
+}
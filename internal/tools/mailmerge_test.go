@@ -0,0 +1,184 @@
+package tools
+
+import (
+	"context"
+	"mime"
+	"net/mail"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFillMergeTemplate(t *testing.T) {
+	row := map[string]string{"name": "Dana", "company": "Acme", "invoice": "42", "empty": ""}
+	tests := []struct {
+		name        string
+		template    string
+		want        string
+		wantMissing []string
+	}{
+		{"no variables", "Hello there", "Hello there", nil},
+		{"variables", "Invoice {{invoice}} for {{company}}", "Invoice 42 for Acme", nil},
+		{"case and spaces", "Hi {{ Name }}, {{NAME}}", "Hi Dana, Dana", nil},
+		{"missing variable kept", "Hi {{name}} from {{team}}", "Hi Dana from {{team}}", []string{"team"}},
+		{"empty value is missing", "Ref {{empty}}", "Ref {{empty}}", []string{"empty"}},
+		{"not a placeholder", "Use {single} or {{ }} braces", "Use {single} or {{ }} braces", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, missing := fillMergeTemplate(tt.template, row)
+			if got != tt.want {
+				t.Errorf("fillMergeTemplate() = %q, want %q", got, tt.want)
+			}
+			if !reflect.DeepEqual(missing, tt.wantMissing) {
+				t.Errorf("fillMergeTemplate() missing = %v, want %v", missing, tt.wantMissing)
+			}
+		})
+	}
+}
+
+func TestRenderMerge(t *testing.T) {
+	rows, err := parseMergeRecipients("email,name,company\n" +
+		"dana@example.com,Dana Lee,Acme\n" +
+		"not-an-address,Bob,Acme\n" +
+		"DANA@example.com,Dana again,Acme\n" +
+		"erin@example.com,Erin,\n" +
+		"frank@example.com,,Globex\n")
+	if err != nil {
+		t.Fatalf("parseMergeRecipients() error = %v", err)
+	}
+	messages := renderMerge(MergeRequest{Subject: "Hello {{company}}", Body: "Hi {{Name}}"}, rows)
+
+	tests := []struct {
+		to, subject, body, skipped string
+	}{
+		{`"Dana Lee" <dana@example.com>`, "Hello Acme", "Hi Dana Lee", ""},
+		{"not-an-address", "", "", `invalid or missing email "not-an-address"`},
+		{"DANA@example.com", "", "", "duplicate of row 1"},
+		{`"Erin" <erin@example.com>`, "", "", "no value for company"},
+		{"frank@example.com", "", "", "no value for name"},
+	}
+	if len(messages) != len(tests) {
+		t.Fatalf("renderMerge() = %d messages, want %d", len(messages), len(tests))
+	}
+	for i, want := range tests {
+		got := messages[i]
+		if got.Row != i+1 || got.To != want.to || got.Subject != want.subject || got.Body != want.body || got.Skipped != want.skipped {
+			t.Errorf("row %d = %+v, want %+v", i+1, got, want)
+		}
+	}
+
+	// A line break in a substituted subject is folded, so it can't add a header
+	rows = []map[string]string{{"email": "frank@example.com", "company": "Globex\r\nBcc: eve@example.com"}}
+	message := renderMerge(MergeRequest{Subject: "Hello {{company}}", Body: "Hi"}, rows)[0]
+	if message.Subject != "Hello Globex Bcc: eve@example.com" {
+		t.Errorf("subject = %q, want it on one line", message.Subject)
+	}
+}
+
+func TestMergeRaw(t *testing.T) {
+	tests := []struct {
+		name    string
+		subject string
+	}{
+		{"ascii", "Invoice 42 for Acme"},
+		{"accents", "Facture n° 42 pour Société Générale"},
+		{"non-latin", "請求書 42"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			raw := mergeRaw(mergeMessage{To: "dana@example.com", Subject: tt.subject, Body: "Line one\nLine two"}, "From: me+tag@example.com\r\n")
+			parsed, err := mail.ReadMessage(strings.NewReader(raw))
+			if err != nil {
+				t.Fatalf("mergeRaw() isn't a valid message: %v\n%s", err, raw)
+			}
+			header := parsed.Header.Get("Subject")
+			for _, r := range header {
+				if r > 127 {
+					t.Fatalf("Subject header %q isn't ASCII", header)
+				}
+			}
+			if decoded, err := new(mime.WordDecoder).DecodeHeader(header); err != nil || decoded != tt.subject {
+				t.Errorf("Subject header %q decodes to %q (%v), want %q", header, decoded, err, tt.subject)
+			}
+			if parsed.Header.Get("From") != "me+tag@example.com" || !strings.Contains(raw, "Line one\r\nLine two") {
+				t.Errorf("mergeRaw() = %q, want the extra headers and CRLF line breaks", raw)
+			}
+		})
+	}
+}
+
+func TestMailMergeConfirmToken(t *testing.T) {
+	fake := loadFake(t)
+	tools := newTestTools(t, fake)
+	arguments := map[string]interface{}{
+		"subject":    "Q3 plan for {{company}}",
+		"body":       "Hi {{name}},\nthe Q3 plan is attached.",
+		"recipients": `[{"email": "dana@example.com", "name": "Dana", "company": "Acme"}, {"email": "erin@example.com", "name": "Erin", "company": "Globex"}]`,
+	}
+	type mergeOutput struct {
+		DryRun       bool                   `json:"dryRun"`
+		ConfirmToken string                 `json:"confirmToken"`
+		Summary      map[string]interface{} `json:"summary"`
+		Messages     []mergeMessage         `json:"messages"`
+	}
+	draftCount := func() int {
+		drafts, err := fake.ListDrafts(context.Background())
+		if err != nil {
+			t.Fatalf("ListDrafts() error = %v", err)
+		}
+		return len(drafts.Drafts)
+	}
+	before := draftCount()
+
+	var preview mergeOutput
+	tools.decode(t, "mail_merge", arguments, &preview)
+	if !preview.DryRun || preview.ConfirmToken == "" || len(preview.Messages) != 2 {
+		t.Fatalf("mail_merge preview = %+v, want a dry run of 2 messages with a token", preview)
+	}
+	if preview.Messages[1].Subject != "Q3 plan for Globex" || preview.Messages[1].Body != "Hi Erin,\nthe Q3 plan is attached." {
+		t.Errorf("mail_merge preview message = %+v, want it filled in", preview.Messages[1])
+	}
+	if draftCount() != before {
+		t.Fatalf("the dry run created drafts")
+	}
+
+	tests := []struct {
+		name       string
+		change     map[string]interface{}
+		wantDryRun bool
+		wantDrafts int
+	}{
+		{"wrong token", map[string]interface{}{"confirm_token": "0123456789abcdef"}, true, 0},
+		{"token for a different request", map[string]interface{}{"confirm_token": preview.ConfirmToken, "subject": "Q4 plan for {{company}}"}, true, 0},
+		{"token for this request", map[string]interface{}{"confirm_token": preview.ConfirmToken}, false, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			changed := map[string]interface{}{}
+			for key, value := range arguments {
+				changed[key] = value
+			}
+			for key, value := range tt.change {
+				changed[key] = value
+			}
+			countBefore := draftCount()
+
+			var output mergeOutput
+			tools.decode(t, "mail_merge", changed, &output)
+			if output.DryRun != tt.wantDryRun {
+				t.Errorf("mail_merge dryRun = %v, want %v", output.DryRun, tt.wantDryRun)
+			}
+			if created := draftCount() - countBefore; created != tt.wantDrafts {
+				t.Errorf("mail_merge created %d drafts, want %d", created, tt.wantDrafts)
+			}
+			if !tt.wantDryRun {
+				for _, message := range output.Messages {
+					if message.DraftID == "" {
+						t.Errorf("mail_merge message %+v has no draft", message)
+					}
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,176 @@
+package tools
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+
+	"auto-gmail/internal/config"
+	"auto-gmail/internal/i18n"
+	"auto-gmail/internal/toolerr"
+)
+
+// maxFactLength caps a single remembered fact
+const maxFactLength = 1000
+
+// maxFacts caps the memory store; the oldest facts are dropped first
+const maxFacts = 500
+
+// fact is one note an agent asked to remember about the mailbox or its owner
+type fact struct {
+	ID        int       `json:"id"`
+	Fact      string    `json:"fact"`
+	Tags      []string  `json:"tags,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// memoryStore is the contents of the memory file
+type memoryStore struct {
+	NextID int    `json:"nextId"`
+	Facts  []fact `json:"facts"`
+}
+
+// memoryFile is where this server's remembered facts are stored, next to its token
+func (g *GmailServer) memoryFile() string {
+	return g.dataFile("memory.json")
+}
+
+// loadMemory reads the memory file; a missing file is an empty store
+func (g *GmailServer) loadMemory() (memoryStore, error) {
+	store := memoryStore{NextID: 1}
+	data, err := os.ReadFile(g.memoryFile())
+	if os.IsNotExist(err) {
+		return store, nil
+	}
+	if err != nil {
+		return store, err
+	}
+	if err := json.Unmarshal(data, &store); err != nil {
+		return store, toolerr.Errorf(toolerr.ParseFailure, "invalid_data_file", "invalid memory file %s: %v", g.memoryFile(), err)
+	}
+	return store, nil
+}
+
+// RememberFact stores a fact (e.g. "user prefers to decline cold outreach politely")
+// with optional tags. Repeating a fact already stored returns the existing one.
+func (g *GmailServer) RememberFact(text string, tags []string) (*mcp.CallToolResult, error) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return toolerr.Invalid("fact must not be empty"), nil
+	}
+	if len(text) > maxFactLength {
+		return toolerr.Invalid(fmt.Sprintf("fact is too long (%d characters, max %d); store a shorter summary", len(text), maxFactLength)), nil
+	}
+	var cleanTags []string
+	for _, tag := range tags {
+		if tag = strings.ToLower(strings.TrimSpace(tag)); tag != "" && !slices.Contains(cleanTags, tag) {
+			cleanTags = append(cleanTags, tag)
+		}
+	}
+
+	g.memoryMu.Lock()
+	defer g.memoryMu.Unlock()
+
+	store, err := g.loadMemory()
+	if err != nil {
+		return toolerr.Result(err, "Failed to read memory"), nil
+	}
+
+	action := "remembered"
+	var stored fact
+	for _, existing := range store.Facts {
+		if strings.EqualFold(existing.Fact, text) {
+			action = "already remembered"
+			stored = existing
+		}
+	}
+	if action == "remembered" {
+		stored = fact{ID: store.NextID, Fact: text, Tags: cleanTags, CreatedAt: time.Now().UTC()}
+		store.NextID++
+		store.Facts = append(store.Facts, stored)
+		if len(store.Facts) > maxFacts {
+			store.Facts = store.Facts[len(store.Facts)-maxFacts:]
+		}
+
+		data, _ := json.MarshalIndent(store, "", "  ")
+		if err := os.WriteFile(g.memoryFile(), data, 0600); err != nil {
+			return toolerr.Result(err, "Failed to save memory"), nil
+		}
+	}
+
+	result := map[string]interface{}{
+		"action":     action,
+		"fact":       stored,
+		"totalFacts": len(store.Facts),
+	}
+	resultJSON, _ := json.MarshalIndent(result, "", "  ")
+	return mcp.NewToolResultText(string(resultJSON)), nil
+}
+
+// RecallFacts returns the remembered facts, newest first, optionally only those
+// containing every word of query and carrying tag
+func (g *GmailServer) RecallFacts(query, tag string) (*mcp.CallToolResult, error) {
+	store, err := g.loadMemory()
+	if err != nil {
+		return toolerr.Result(err, "Failed to read memory"), nil
+	}
+
+	words := strings.Fields(strings.ToLower(query))
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	matches := []fact{}
+	for i := len(store.Facts) - 1; i >= 0; i-- {
+		if factMatches(store.Facts[i], words, tag) {
+			matches = append(matches, store.Facts[i])
+		}
+	}
+
+	result := map[string]interface{}{
+		"facts":      matches,
+		"count":      len(matches),
+		"totalFacts": len(store.Facts),
+	}
+	resultJSON, _ := json.MarshalIndent(result, "", "  ")
+	return mcp.NewToolResultText(string(resultJSON)), nil
+}
+
+// factMatches reports whether a fact has every query word (in its text or tags) and the tag
+func factMatches(f fact, words []string, tag string) bool {
+	if tag != "" && !slices.Contains(f.Tags, tag) {
+		return false
+	}
+	text := strings.ToLower(f.Fact + " " + strings.Join(f.Tags, " "))
+	for _, word := range words {
+		if !strings.Contains(text, word) {
+			return false
+		}
+	}
+	return true
+}
+
+// MemoryMarkdown renders every remembered fact for the gmail://memory resource
+func (g *GmailServer) MemoryMarkdown() (string, error) {
+	store, err := g.loadMemory()
+	if err != nil {
+		return "", err
+	}
+
+	var out strings.Builder
+	out.WriteString("# Remembered Facts\n\n")
+	if len(store.Facts) == 0 {
+		out.WriteString("Nothing remembered yet. Use the remember_fact tool to store preferences and facts about the user's email.\n")
+		return out.String(), nil
+	}
+	for _, f := range store.Facts {
+		fmt.Fprintf(&out, "- %s", f.Fact)
+		if len(f.Tags) > 0 {
+			fmt.Fprintf(&out, " _(%s)_", strings.Join(f.Tags, ", "))
+		}
+		fmt.Fprintf(&out, " — #%d, %s\n", f.ID, i18n.FormatDate(f.CreatedAt.In(config.TimeZone())))
+	}
+	return out.String(), nil
+}
@@ -0,0 +1,38 @@
+package tools
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+
+	"auto-gmail/internal/config"
+	"auto-gmail/internal/gmailclient"
+
+	"google.golang.org/api/googleapi"
+)
+
+// snapshotEnabled reports whether fetched mail is synced to disk for offline use.
+// The snapshot holds mailbox content in plaintext, so it is off unless
+// GMAIL_MCP_SNAPSHOT=1 is set.
+func snapshotEnabled() bool {
+	return os.Getenv("GMAIL_MCP_SNAPSHOT") == "1"
+}
+
+// snapshotDir is where this server's offline snapshot lives, next to its token
+func (g *GmailServer) snapshotDir() string {
+	return g.dataFile("snapshot")
+}
+
+// NewOfflineGmailServer creates a server that never contacts Gmail and answers
+// searches and fetches from the previously synced offline snapshot
+func NewOfflineGmailServer() *GmailServer {
+	dir := filepath.Join(config.AppDataDir(), "snapshot")
+	log.Printf("📴 Offline mode: serving mail from the snapshot in %s", dir)
+	return NewGmailServerWithClient(gmailclient.NewSnapshot(nil, dir))
+}
+
+// staleAsOf returns when a response served from the offline snapshot was last
+// synced, or "" for live data
+func staleAsOf(resp googleapi.ServerResponse) string {
+	return resp.Header.Get(gmailclient.SyncedAtHeader)
+}
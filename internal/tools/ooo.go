@@ -0,0 +1,136 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"net/mail"
+	"regexp"
+	"strings"
+	"time"
+
+	"auto-gmail/internal/config"
+	"auto-gmail/internal/extract"
+	"auto-gmail/internal/i18n"
+
+	"google.golang.org/api/gmail/v1"
+)
+
+// oooLookbackDays is how far back create_draft looks for auto-replies from a recipient
+const oooLookbackDays = 14
+
+// oooUndatedWindow is how long an auto-reply without a return date counts as current
+const oooUndatedWindow = 7 * 24 * time.Hour
+
+var (
+	// oooSubject catches auto-replies from servers that don't set Auto-Submitted
+	oooSubject = regexp.MustCompile(`(?i)^(?:out of (?:the )?office|automatic reply|auto(?:matic)?[- ]?reply|autoreply|away from (?:the )?office|on vacation|abwesenheitsnotiz|réponse automatique)`)
+	// oooReturn captures the phrase naming when the sender is back
+	oooReturn = regexp.MustCompile(`(?i)\b(?:until|till|through|thru|returning(?: on)?|return(?:ing)? to the office on|back(?: in the office)?(?: on)?)\s+([^.;\n]{3,40})`)
+	// yearlessDate matches "October 20" or "20 October" without a year
+	yearlessDate = regexp.MustCompile(`(?i)\b(?:(jan|feb|mar|apr|may|jun|jul|aug|sep|oct|nov|dec)[a-z]*\.?\s+(\d{1,2})(?:st|nd|rd|th)?|(\d{1,2})(?:st|nd|rd|th)?\s+(jan|feb|mar|apr|may|jun|jul|aug|sep|oct|nov|dec)[a-z]*)\b`)
+)
+
+// outOfOfficeWarnings checks each recipient in to for recent auto-replies and
+// returns a warning for those who appear to be away
+func (g *GmailServer) outOfOfficeWarnings(ctx context.Context, to string) []string {
+	addresses, err := mail.ParseAddressList(to)
+	if err != nil {
+		return nil
+	}
+
+	var warnings []string
+	for _, address := range addresses {
+		if warning := g.outOfOffice(ctx, strings.ToLower(address.Address)); warning != "" {
+			warnings = append(warnings, warning)
+		}
+	}
+	return warnings
+}
+
+// outOfOffice returns a warning when the latest auto-reply from address says they're
+// still away, or "" when there is none
+func (g *GmailServer) outOfOffice(ctx context.Context, address string) string {
+	list, err := g.client.ListMessages(ctx, fmt.Sprintf("from:%s newer_than:%dd", address, oooLookbackDays), 20)
+	if err != nil || len(list.Messages) == 0 {
+		return ""
+	}
+	messageIDs := make([]string, len(list.Messages))
+	for i, msg := range list.Messages {
+		messageIDs[i] = msg.Id
+	}
+	hydrated := g.hydrateMessageHeaders(ctx, messageIDs, []string{"From", "Subject", "Auto-Submitted", "X-Autoreply", "X-Autorespond"})
+
+	var latest, latestReply *gmail.Message
+	for _, message := range hydrated {
+		if !strings.EqualFold(senderAddress(messageHeader(message, "From")), address) {
+			continue
+		}
+		if latest == nil || message.InternalDate > latest.InternalDate {
+			latest = message
+		}
+		if isAutoReply(message) && (latestReply == nil || message.InternalDate > latestReply.InternalDate) {
+			latestReply = message
+		}
+	}
+	// A normal message after the auto-reply means they're back
+	if latestReply == nil || latest != latestReply {
+		return ""
+	}
+
+	replied := time.UnixMilli(latestReply.InternalDate).In(config.TimeZone())
+	returnDate, returnText := oooReturnDate(latestReply.Snippet, replied)
+	switch {
+	case !returnDate.IsZero() && returnDate.Before(time.Now().Truncate(24*time.Hour)):
+		return ""
+	case !returnDate.IsZero():
+		return i18n.T("ooo.until", "%s appears to be out of office until %s (auto-reply on %s: %q)", address, i18n.FormatDate(returnDate), i18n.FormatDate(replied), messageHeader(latestReply, "Subject"))
+	case time.Since(replied) > oooUndatedWindow:
+		return ""
+	case returnText != "":
+		return i18n.T("ooo.until", "%s appears to be out of office until %s (auto-reply on %s: %q)", address, returnText, i18n.FormatDate(replied), messageHeader(latestReply, "Subject"))
+	}
+	return i18n.T("ooo.away", "%s appears to be out of office (auto-reply on %s: %q)", address, i18n.FormatDate(replied), messageHeader(latestReply, "Subject"))
+}
+
+// isAutoReply reports whether a message is a vacation or out-of-office responder
+// reply. Auto-Submitted: auto-generated (notifications, newsletters) doesn't count.
+func isAutoReply(message *gmail.Message) bool {
+	if strings.HasPrefix(strings.ToLower(messageHeader(message, "Auto-Submitted")), "auto-replied") {
+		return true
+	}
+	if messageHeader(message, "X-Autoreply") != "" || messageHeader(message, "X-Autorespond") != "" {
+		return true
+	}
+	return oooSubject.MatchString(strings.TrimSpace(messageHeader(message, "Subject")))
+}
+
+// oooReturnDate finds when an auto-reply says the sender is back: a parsed date
+// when possible, otherwise the raw phrase (e.g. "next Monday")
+func oooReturnDate(snippet string, replied time.Time) (time.Time, string) {
+	match := oooReturn.FindStringSubmatch(snippet)
+	if match == nil {
+		return time.Time{}, ""
+	}
+	phrase := strings.TrimSpace(match[1])
+
+	if dates := extract.ExtractEntities(phrase).Dates; len(dates) > 0 {
+		if parsed, err := time.Parse("2006-01-02", dates[0].Date); err == nil {
+			return parsed, phrase
+		}
+	}
+
+	// "until October 20": the next such date on or after the auto-reply
+	if parts := yearlessDate.FindStringSubmatch(phrase); parts != nil {
+		month, day := parts[1], parts[2]
+		if month == "" {
+			month, day = parts[4], parts[3]
+		}
+		if parsed, err := time.Parse("Jan 2 2006", fmt.Sprintf("%s %s %d", strings.ToLower(month), day, replied.Year())); err == nil {
+			if parsed.Before(replied.Truncate(24 * time.Hour)) {
+				parsed = parsed.AddDate(1, 0, 0)
+			}
+			return parsed, phrase
+		}
+	}
+	return time.Time{}, phrase
+}
@@ -0,0 +1,471 @@
+package tools
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"time"
+
+	"auto-gmail/internal/gmailclient"
+	"auto-gmail/internal/toolerr"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"google.golang.org/api/gmail/v1"
+)
+
+// Outbox retry policy: the delay doubles from outboxFirstRetry up to outboxMaxRetryDelay,
+// and a send that keeps failing is given up after outboxMaxAttempts
+const (
+	outboxFirstRetry    = 30 * time.Second
+	outboxMaxRetryDelay = time.Hour
+	outboxMaxAttempts   = 8
+	// outboxKeepSent is how long sent and failed entries stay listed in outbox_status
+	outboxKeepSent = 7 * 24 * time.Hour
+)
+
+// Outbox entry states
+const (
+	outboxQueued    = "queued"
+	outboxSending   = "sending"
+	outboxSent      = "sent"
+	outboxFailed    = "failed"
+	outboxCancelled = "cancelled"
+)
+
+// outboxEntry is one queued send
+type outboxEntry struct {
+	ID          string    `json:"id"`
+	To          string    `json:"to"`
+	Subject     string    `json:"subject"`
+	Raw         string    `json:"raw"` // base64url RFC 822 message
+	Status      string    `json:"status"`
+	Attempts    int       `json:"attempts"`
+	LastError   string    `json:"lastError,omitempty"`
+	QueuedAt    time.Time `json:"queuedAt"`
+	NextAttempt time.Time `json:"nextAttempt,omitempty"`
+	SentAt      time.Time `json:"sentAt,omitempty"`
+	MessageID   string    `json:"messageId,omitempty"`
+	// MergeID is set on sends scheduled by mail_merge, so they can be cancelled together
+	MergeID string `json:"mergeId,omitempty"`
+}
+
+// outboxFile is where queued sends are stored, next to the token
+func (g *GmailServer) outboxFile() string {
+	return g.dataFile("outbox.json")
+}
+
+// queueSend stores a message in the outbox and tries to send it right away. When
+// Gmail is unavailable, or the send limits are reached, the entry stays queued and is
+// retried in the background, as it is when ctx ends mid-send; other errors mark it
+// failed. The entry is returned in its current state.
+func (g *GmailServer) queueSend(ctx context.Context, to, subject, raw string) (outboxEntry, error) {
+	entry, err := newOutboxEntry(to, subject, raw)
+	if err != nil {
+		return outboxEntry{}, err
+	}
+	entry.Status = outboxSending
+
+	// Over the send limits, the entry waits in the queue instead. The check and saving
+	// the entry as sending happen under one lock, so it holds its share of the limits.
+	g.outboxMu.Lock()
+	entries, err := g.loadOutbox()
+	if err != nil {
+		g.outboxMu.Unlock()
+		return outboxEntry{}, err
+	}
+	wait, reason := loadSendLimits().throttleDelay(entries, entry.recipients(), time.Now())
+	if wait > 0 {
+		entry.Status = outboxQueued
+		entry.NextAttempt = time.Now().Add(wait)
+		entry.LastError = reason
+	}
+	err = g.saveOutbox(append(entries, entry))
+	g.outboxMu.Unlock()
+	if err != nil {
+		return outboxEntry{}, err
+	}
+	if wait > 0 {
+		g.startOutboxWorker()
+		return entry, nil
+	}
+
+	entry = g.attemptSend(ctx, entry)
+	if entry.Status == outboxQueued {
+		g.startOutboxWorker()
+	}
+	return entry, nil
+}
+
+// scheduleSend stores a message in the outbox for the background worker to send at
+// the given time, with the same retries as queueSend
+func (g *GmailServer) scheduleSend(to, subject, raw string, at time.Time, mergeID string) (outboxEntry, error) {
+	entry, err := newOutboxEntry(to, subject, raw)
+	if err != nil {
+		return outboxEntry{}, err
+	}
+	entry.Status = outboxQueued
+	entry.NextAttempt = at
+	entry.MergeID = mergeID
+	if err := g.addToOutbox(entry); err != nil {
+		return outboxEntry{}, err
+	}
+
+	g.startOutboxWorker()
+	return entry, nil
+}
+
+// newOutboxEntry creates an entry with a random ID for a raw RFC 822 message
+func newOutboxEntry(to, subject, raw string) (outboxEntry, error) {
+	idBytes := make([]byte, 8)
+	if _, err := rand.Read(idBytes); err != nil {
+		return outboxEntry{}, err
+	}
+	return outboxEntry{
+		ID:       hex.EncodeToString(idBytes),
+		To:       to,
+		Subject:  subject,
+		Raw:      base64.URLEncoding.EncodeToString([]byte(raw)),
+		QueuedAt: time.Now(),
+	}, nil
+}
+
+// addToOutbox appends an entry to the outbox file
+func (g *GmailServer) addToOutbox(entry outboxEntry) error {
+	g.outboxMu.Lock()
+	defer g.outboxMu.Unlock()
+	entries, err := g.loadOutbox()
+	if err != nil {
+		return err
+	}
+	return g.saveOutbox(append(entries, entry))
+}
+
+// attemptSend sends one entry, already marked as sending in the outbox file, and
+// records the outcome there. A send cut off by ctx is queued again for the worker.
+func (g *GmailServer) attemptSend(ctx context.Context, entry outboxEntry) outboxEntry {
+	sent, err := g.client.SendMessage(ctx, &gmail.Message{Raw: entry.Raw})
+	entry.Attempts++
+	switch {
+	case err == nil:
+		entry.Status = outboxSent
+		entry.SentAt = time.Now()
+		entry.MessageID = sent.Id
+		entry.LastError = ""
+		entry.NextAttempt = time.Time{}
+		log.Printf("📤 Sent outbox message %s to %s", entry.ID, entry.To)
+	case (gmailclient.IsUnavailable(err) || ctx.Err() != nil) && entry.Attempts < outboxMaxAttempts:
+		entry.Status = outboxQueued
+		entry.LastError = err.Error()
+		entry.NextAttempt = time.Now().Add(outboxRetryDelay(entry.Attempts))
+		log.Printf("Warning: Sending outbox message %s failed (attempt %d), retrying at %s: %v", entry.ID, entry.Attempts, entry.NextAttempt.Format(time.RFC3339), err)
+	default:
+		entry.Status = outboxFailed
+		entry.LastError = err.Error()
+		entry.NextAttempt = time.Time{}
+		log.Printf("❌ Giving up on outbox message %s after %d attempts: %v", entry.ID, entry.Attempts, err)
+	}
+
+	g.outboxMu.Lock()
+	defer g.outboxMu.Unlock()
+	entries, loadErr := g.loadOutbox()
+	if loadErr != nil {
+		log.Printf("Warning: Could not record the outcome of outbox message %s: %v", entry.ID, loadErr)
+		return entry
+	}
+	for i := range entries {
+		if entries[i].ID != entry.ID {
+			continue
+		}
+		// Only a send in flight is updated; an entry cancelled meanwhile stays cancelled
+		// unless the mail went out anyway
+		if entries[i].Status != outboxSending && entry.Status != outboxSent {
+			return entries[i]
+		}
+		entries[i] = entry
+	}
+	g.saveOutbox(entries)
+	return entry
+}
+
+// outboxRetryDelay is the wait after the given number of failed attempts
+func outboxRetryDelay(attempts int) time.Duration {
+	delay := outboxFirstRetry
+	for i := 1; i < attempts && delay < outboxMaxRetryDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, outboxMaxRetryDelay)
+}
+
+// startOutboxWorker starts the background retry loop unless it's already running
+func (g *GmailServer) startOutboxWorker() {
+	g.outboxMu.Lock()
+	defer g.outboxMu.Unlock()
+	if g.outboxRunning {
+		return
+	}
+	g.outboxRunning = true
+	go g.runOutbox()
+}
+
+// runOutbox sends due entries until none are left queued
+func (g *GmailServer) runOutbox() {
+	for {
+		g.outboxMu.Lock()
+		entries, err := g.loadOutbox()
+		if err != nil {
+			log.Printf("Warning: Stopping the outbox worker: %v", err)
+			g.outboxRunning = false
+			g.outboxMu.Unlock()
+			return
+		}
+		var due []string
+		var next time.Time
+		for _, entry := range entries {
+			if entry.Status != outboxQueued {
+				continue
+			}
+			if !entry.NextAttempt.After(time.Now()) {
+				due = append(due, entry.ID)
+			} else if next.IsZero() || entry.NextAttempt.Before(next) {
+				next = entry.NextAttempt
+			}
+		}
+		if len(due) == 0 && next.IsZero() {
+			g.outboxRunning = false
+			g.outboxMu.Unlock()
+			return
+		}
+		g.outboxMu.Unlock()
+
+		for _, id := range due {
+			// Skip entries cancelled since the queue was read, or held back by the send limits
+			entry, ok := g.claimForSend(id)
+			if !ok {
+				continue
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+			g.attemptSend(ctx, entry)
+			cancel()
+		}
+		// Wake at least every minute so entries scheduled meanwhile aren't held up
+		if len(due) == 0 {
+			time.Sleep(min(max(time.Until(next), time.Second), time.Minute))
+		}
+	}
+}
+
+// claimForSend marks the outbox entry as sending and returns it, if it is still
+// waiting to be sent and within the send limits. Claiming it in the file first means a
+// cancel can no longer reach it. A throttled entry is rescheduled for when the limits
+// allow it instead.
+func (g *GmailServer) claimForSend(id string) (outboxEntry, bool) {
+	g.outboxMu.Lock()
+	defer g.outboxMu.Unlock()
+	entries, err := g.loadOutbox()
+	if err != nil {
+		log.Printf("Warning: Could not claim outbox message %s: %v", id, err)
+		return outboxEntry{}, false
+	}
+	for i := range entries {
+		if entries[i].ID != id {
+			continue
+		}
+		if entries[i].Status != outboxQueued {
+			return outboxEntry{}, false
+		}
+		wait, reason := loadSendLimits().throttleDelay(entries, entries[i].recipients(), time.Now())
+		if wait > 0 {
+			entries[i].NextAttempt = time.Now().Add(wait)
+			entries[i].LastError = reason
+			g.saveOutbox(entries)
+			return outboxEntry{}, false
+		}
+		entries[i].Status = outboxSending
+		if g.saveOutbox(entries) != nil {
+			return outboxEntry{}, false
+		}
+		return entries[i], true
+	}
+	return outboxEntry{}, false
+}
+
+// resumeOutbox restarts retries for sends left queued by an earlier run. An entry still
+// marked as sending was interrupted mid-send; it's retried, which may send it twice.
+func (g *GmailServer) resumeOutbox() {
+	g.outboxMu.Lock()
+	entries, err := g.loadOutbox()
+	if err != nil {
+		g.outboxMu.Unlock()
+		log.Printf("Warning: Not resuming the outbox: %v", err)
+		return
+	}
+	pending := false
+	for i := range entries {
+		if entries[i].Status == outboxSending {
+			entries[i].Status = outboxQueued
+		}
+		pending = pending || entries[i].Status == outboxQueued
+	}
+	if pending {
+		g.saveOutbox(entries)
+	}
+	g.outboxMu.Unlock()
+
+	if pending {
+		log.Printf("📤 Resuming queued outbox messages")
+		g.startOutboxWorker()
+	}
+}
+
+// loadOutbox reads the outbox, dropping old sent and failed entries. The caller holds outboxMu.
+// A file that doesn't parse is moved aside and reported as an error, so no caller saves
+// an emptied outbox over the queued mail in it.
+func (g *GmailServer) loadOutbox() ([]outboxEntry, error) {
+	file := g.outboxFile()
+	data, err := os.ReadFile(file)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, toolerr.Errorf(toolerr.Internal, "outbox_unreadable", "failed to read outbox: %v", err)
+	}
+	var entries []outboxEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		aside := fmt.Sprintf("%s.invalid-%d", file, time.Now().Unix())
+		if renameErr := os.Rename(file, aside); renameErr != nil {
+			return nil, toolerr.Errorf(toolerr.Internal, "outbox_invalid", "outbox file %s is invalid (%v) and couldn't be moved aside: %v", file, err, renameErr)
+		}
+		log.Printf("Warning: Invalid outbox file moved to %s: %v", aside, err)
+		return nil, toolerr.Errorf(toolerr.Internal, "outbox_invalid", "outbox file was invalid (%v); it was moved to %s so its queued mail can be recovered by hand", err, aside)
+	}
+	kept := entries[:0]
+	for _, entry := range entries {
+		if entry.Status != outboxQueued && entry.Status != outboxSending && time.Since(entry.QueuedAt) > outboxKeepSent {
+			continue
+		}
+		kept = append(kept, entry)
+	}
+	return kept, nil
+}
+
+// saveOutbox writes the outbox. The caller holds outboxMu.
+func (g *GmailServer) saveOutbox(entries []outboxEntry) error {
+	data, _ := json.MarshalIndent(entries, "", "  ")
+	if err := os.WriteFile(g.outboxFile(), data, 0600); err != nil {
+		log.Printf("Warning: Failed to save outbox file %s: %v", g.outboxFile(), err)
+		return fmt.Errorf("failed to save outbox: %v", err)
+	}
+	return nil
+}
+
+// OutboxStatus lists queued, sent and failed sends. retryID puts a failed entry back
+// in the queue for an immediate retry; cancelMergeID cancels a mail merge's unsent mail.
+func (g *GmailServer) OutboxStatus(ctx context.Context, retryID, cancelMergeID string) (*mcp.CallToolResult, error) {
+	cancelled := 0
+	if cancelMergeID != "" {
+		g.outboxMu.Lock()
+		entries, err := g.loadOutbox()
+		if err != nil {
+			g.outboxMu.Unlock()
+			return toolerr.Result(err, ""), nil
+		}
+		for i := range entries {
+			if entries[i].MergeID == cancelMergeID && entries[i].Status == outboxQueued {
+				entries[i].Status = outboxCancelled
+				entries[i].NextAttempt = time.Time{}
+				cancelled++
+			}
+		}
+		if cancelled > 0 {
+			g.saveOutbox(entries)
+		}
+		g.outboxMu.Unlock()
+		if cancelled == 0 {
+			return toolerr.New(toolerr.NotFound, "merge_not_found", fmt.Sprintf("No queued mail from merge '%s'", cancelMergeID)).Result(), nil
+		}
+	}
+
+	if retryID != "" {
+		g.outboxMu.Lock()
+		entries, err := g.loadOutbox()
+		if err != nil {
+			g.outboxMu.Unlock()
+			return toolerr.Result(err, ""), nil
+		}
+		found := false
+		for i := range entries {
+			if entries[i].ID == retryID && entries[i].Status == outboxFailed {
+				entries[i].Status = outboxQueued
+				entries[i].Attempts = 0
+				entries[i].NextAttempt = time.Now()
+				found = true
+			}
+		}
+		if found {
+			g.saveOutbox(entries)
+		}
+		g.outboxMu.Unlock()
+		if !found {
+			return toolerr.New(toolerr.NotFound, "outbox_entry_not_found", fmt.Sprintf("No failed outbox entry with ID '%s'", retryID)).Result(), nil
+		}
+		g.startOutboxWorker()
+	}
+
+	g.outboxMu.Lock()
+	entries, err := g.loadOutbox()
+	g.outboxMu.Unlock()
+	if err != nil {
+		return toolerr.Result(err, ""), nil
+	}
+	// Newest first
+	sort.Slice(entries, func(i, j int) bool { return entries[i].QueuedAt.After(entries[j].QueuedAt) })
+
+	counts := map[string]int{}
+	listed := make([]map[string]interface{}, 0, len(entries))
+	for _, entry := range entries {
+		counts[entry.Status]++
+		item := map[string]interface{}{
+			"id":       entry.ID,
+			"to":       entry.To,
+			"subject":  entry.Subject,
+			"status":   entry.Status,
+			"attempts": entry.Attempts,
+			"queuedAt": entry.QueuedAt.Format(time.RFC3339),
+		}
+		if entry.LastError != "" {
+			item["lastError"] = entry.LastError
+		}
+		if entry.MergeID != "" {
+			item["mergeId"] = entry.MergeID
+		}
+		if entry.Status == outboxQueued {
+			item["nextAttempt"] = entry.NextAttempt.Format(time.RFC3339)
+		}
+		if entry.Status == outboxSent {
+			item["sentAt"] = entry.SentAt.Format(time.RFC3339)
+			item["messageId"] = entry.MessageID
+		}
+		listed = append(listed, item)
+	}
+
+	result := map[string]interface{}{
+		"messages":   listed,
+		"counts":     counts,
+		"sendLimits": g.SendLimits(),
+	}
+	if retryID != "" {
+		result["retried"] = retryID
+	}
+	if cancelled > 0 {
+		result["cancelled"] = cancelled
+	}
+
+	resultJSON, _ := json.MarshalIndent(result, "", "  ")
+	return mcp.NewToolResultText(string(resultJSON)), nil
+}
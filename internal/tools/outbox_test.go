@@ -0,0 +1,150 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"auto-gmail/internal/gmailclient"
+	"auto-gmail/internal/toolerr"
+
+	"google.golang.org/api/gmail/v1"
+)
+
+// contextSender sends through the fake mailbox, but fails like the API client does
+// once ctx has ended
+type contextSender struct {
+	*gmailclient.Fake
+}
+
+func (c contextSender) SendMessage(ctx context.Context, message *gmail.Message) (*gmail.Message, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return c.Fake.SendMessage(ctx, message)
+}
+
+// newTestOutbox returns a server on the fixture mailbox with its outbox in a temporary directory
+func newTestOutbox(t *testing.T) *GmailServer {
+	t.Helper()
+	t.Setenv("HOME", t.TempDir())
+	return newGmailServerWithClient(contextSender{loadFake(t)}, t.TempDir())
+}
+
+// outboxStatus returns the status of an entry in the outbox file
+func outboxStatus(t *testing.T, g *GmailServer, id string) string {
+	t.Helper()
+	g.outboxMu.Lock()
+	defer g.outboxMu.Unlock()
+	entries, err := g.loadOutbox()
+	if err != nil {
+		t.Fatalf("loadOutbox() error = %v", err)
+	}
+	for _, entry := range entries {
+		if entry.ID == id {
+			return entry.Status
+		}
+	}
+	t.Fatalf("no outbox entry %s", id)
+	return ""
+}
+
+const testRaw = "To: alice@example.com\r\nSubject: Hello\r\n\r\nHi Alice"
+
+func TestQueueSend(t *testing.T) {
+	g := newTestOutbox(t)
+	entry, err := g.queueSend(context.Background(), "alice@example.com", "Hello", testRaw)
+	if err != nil {
+		t.Fatalf("queueSend() error = %v", err)
+	}
+	if entry.Status != outboxSent || entry.MessageID == "" {
+		t.Errorf("queueSend() = %+v, want it sent", entry)
+	}
+	if status := outboxStatus(t, g, entry.ID); status != outboxSent {
+		t.Errorf("outbox status = %s, want %s", status, outboxSent)
+	}
+}
+
+func TestQueueSendCancelled(t *testing.T) {
+	g := newTestOutbox(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	entry, err := g.queueSend(ctx, "alice@example.com", "Hello", testRaw)
+	if err != nil {
+		t.Fatalf("queueSend() error = %v", err)
+	}
+	if entry.Status != outboxQueued || entry.NextAttempt.IsZero() {
+		t.Errorf("queueSend() with a cancelled context = %+v, want it queued for a retry", entry)
+	}
+	if status := outboxStatus(t, g, entry.ID); status != outboxQueued {
+		t.Errorf("outbox status = %s, want %s", status, outboxQueued)
+	}
+}
+
+func TestInvalidOutboxIsKept(t *testing.T) {
+	g := newTestOutbox(t)
+	invalid := []byte(`[{"id": "queued-before", "status": "queued"`)
+	if err := os.WriteFile(g.outboxFile(), invalid, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := g.queueSend(context.Background(), "alice@example.com", "Hello", testRaw)
+	if classified := toolerr.Classify(err); err == nil || classified.Code != "outbox_invalid" {
+		t.Fatalf("queueSend() error = %v, want outbox_invalid", err)
+	}
+	if _, err := os.Stat(g.outboxFile()); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("outbox file still in place after failing to parse: %v", err)
+	}
+	aside, _ := filepath.Glob(g.outboxFile() + ".invalid-*")
+	if len(aside) != 1 {
+		t.Fatalf("outbox files moved aside = %v, want one", aside)
+	}
+	if data, _ := os.ReadFile(aside[0]); string(data) != string(invalid) {
+		t.Errorf("moved outbox = %q, want the original %q", data, invalid)
+	}
+}
+
+func TestClaimedEntryCantBeCancelled(t *testing.T) {
+	g := newTestOutbox(t)
+	entry, err := newOutboxEntry("alice@example.com", "Hello", testRaw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry.Status = outboxQueued
+	entry.MergeID = "merge-1"
+	if err := g.addToOutbox(entry); err != nil {
+		t.Fatalf("addToOutbox() error = %v", err)
+	}
+
+	claimed, ok := g.claimForSend(entry.ID)
+	if !ok || claimed.Status != outboxSending {
+		t.Fatalf("claimForSend() = %+v, %v, want the entry marked sending", claimed, ok)
+	}
+	if _, ok := g.claimForSend(entry.ID); ok {
+		t.Errorf("claimForSend() claimed the same entry twice")
+	}
+	result, _ := g.OutboxStatus(context.Background(), "", "merge-1")
+	if failure := toolerr.FromResult(result); failure == nil || failure.Code != "merge_not_found" {
+		t.Errorf("cancelling a merge whose mail is being sent = %+v, want merge_not_found", failure)
+	}
+
+	// A cancel recorded while the send was in flight survives a send that didn't go out
+	g.outboxMu.Lock()
+	entries, _ := g.loadOutbox()
+	entries[0].Status = outboxCancelled
+	g.saveOutbox(entries)
+	g.outboxMu.Unlock()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Nanosecond)
+	defer cancel()
+	<-ctx.Done()
+	if got := g.attemptSend(ctx, claimed); got.Status != outboxCancelled {
+		t.Errorf("attemptSend() = %+v, want the cancel kept", got)
+	}
+	if status := outboxStatus(t, g, entry.ID); status != outboxCancelled {
+		t.Errorf("outbox status = %s, want %s", status, outboxCancelled)
+	}
+}
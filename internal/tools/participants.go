@@ -0,0 +1,145 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"net/mail"
+	"sort"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"google.golang.org/api/gmail/v1"
+
+	"auto-gmail/internal/toolerr"
+)
+
+// threadParticipant tracks one address across the messages of a thread
+type threadParticipant struct {
+	name       string
+	address    string
+	role       string
+	firstIndex int // position of the first message they appear on
+	sent       int
+	to         int
+	cc         int
+	onLatest   bool
+}
+
+// GetThreadParticipants lists everyone on a thread with their role (original sender,
+// recipient, cc'd or later joiner) and how many messages they sent and received,
+// plus who a reply-all to the latest message would reach
+func (g *GmailServer) GetThreadParticipants(ctx context.Context, threadID string) (*mcp.CallToolResult, error) {
+	thread, err := g.getThread(ctx, threadID, 0)
+	if err != nil {
+		return toolerr.Result(err, "Failed to get thread"), nil
+	}
+	me := g.userEmail(ctx)
+
+	var messages []*gmail.Message
+	for _, message := range thread.Messages {
+		if message.Payload != nil && !hasLabelID(message, "DRAFT") {
+			messages = append(messages, message)
+		}
+	}
+	sort.SliceStable(messages, func(i, j int) bool {
+		return messages[i].InternalDate < messages[j].InternalDate
+	})
+	if len(messages) == 0 {
+		return toolerr.New(toolerr.NotFound, "no_sent_messages", "Thread has no sent messages").Result(), nil
+	}
+
+	byAddress := map[string]*threadParticipant{}
+	var order []*threadParticipant
+	for i, message := range messages {
+		latest := i == len(messages)-1
+		for _, field := range []string{"From", "To", "Cc"} {
+			addresses, err := mail.ParseAddressList(messageHeader(message, field))
+			if err != nil {
+				continue
+			}
+			for _, addr := range addresses {
+				key := strings.ToLower(addr.Address)
+				p, ok := byAddress[key]
+				if !ok {
+					p = &threadParticipant{address: key, firstIndex: i}
+					switch {
+					case i > 0:
+						p.role = "later joiner"
+					case field == "From":
+						p.role = "original sender"
+					case field == "To":
+						p.role = "recipient"
+					default:
+						p.role = "cc'd"
+					}
+					byAddress[key] = p
+					order = append(order, p)
+				}
+				if p.name == "" {
+					p.name = addr.Name
+				}
+				switch field {
+				case "From":
+					p.sent++
+				case "To":
+					p.to++
+				case "Cc":
+					p.cc++
+				}
+				p.onLatest = p.onLatest || latest
+			}
+		}
+	}
+
+	var participants []map[string]interface{}
+	var replyAll, dropped []string
+	for _, p := range order {
+		entry := map[string]interface{}{
+			"address":          p.address,
+			"role":             p.role,
+			"messagesSent":     p.sent,
+			"messagesReceived": p.to + p.cc,
+			"timesCcd":         p.cc,
+			"onLatestMessage":  p.onLatest,
+		}
+		if p.name != "" {
+			entry["name"] = p.name
+		}
+		if p.firstIndex > 0 {
+			entry["joinedAtMessage"] = p.firstIndex + 1
+		}
+		if p.address == me {
+			entry["isYou"] = true
+		}
+		participants = append(participants, entry)
+
+		if p.address == me {
+			continue
+		}
+		if p.onLatest {
+			replyAll = append(replyAll, formatParticipant(p))
+		} else {
+			dropped = append(dropped, formatParticipant(p))
+		}
+	}
+
+	result := map[string]interface{}{
+		"threadId":         threadID,
+		"messageCount":     len(messages),
+		"participantCount": len(participants),
+		"participants":     participants,
+		"replyAllTo":       replyAll,
+	}
+	if len(dropped) > 0 {
+		// Reply-all sanity check: people who were on the thread but not on the latest message
+		result["notOnLatestMessage"] = dropped
+	}
+
+	resultJSON, _ := json.MarshalIndent(result, "", "  ")
+	return mcp.NewToolResultText(string(resultJSON)), nil
+}
+
+// formatParticipant renders a participant as an address header value
+func formatParticipant(p *threadParticipant) string {
+	return (&mail.Address{Name: p.name, Address: p.address}).String()
+}
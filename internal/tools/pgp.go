@@ -0,0 +1,160 @@
+package tools
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"auto-gmail/internal/extract"
+	"auto-gmail/internal/gmailclient"
+	"auto-gmail/internal/pgp"
+	"auto-gmail/internal/toolerr"
+
+	"google.golang.org/api/gmail/v1"
+)
+
+// pgpOffNote stands in for the body of encrypted mail while OpenPGP support is off
+const pgpOffNote = "[Encrypted OpenPGP message. Set GMAIL_MCP_GPG to decrypt it with your local key.]"
+
+// messageBody extracts a message's readable text like extract.EmailBody, decrypting
+// PGP/MIME and inline OpenPGP messages and checking their signatures with the local
+// GnuPG when GMAIL_MCP_GPG is set. The status is nil for mail without OpenPGP content.
+func (g *GmailServer) messageBody(ctx context.Context, message *gmail.Message) (string, *pgp.Status) {
+	body := extract.EmailBody(message)
+	if message.Payload == nil {
+		return body, nil
+	}
+	gpg := pgp.FromEnv()
+	contentType := strings.ToLower(messageHeader(message, "Content-Type"))
+
+	switch {
+	case message.Payload.MimeType == "multipart/encrypted" && strings.Contains(contentType, "pgp-encrypted"):
+		if gpg == nil {
+			return pgpOffNote, &pgp.Status{Encrypted: true, Error: "OpenPGP support is off"}
+		}
+		ciphertext, err := g.encryptedPartData(ctx, message)
+		if err != nil {
+			return body, &pgp.Status{Encrypted: true, Error: err.Error()}
+		}
+		plaintext, status := gpg.Decrypt(ctx, ciphertext)
+		if !status.Decrypted {
+			return fmt.Sprintf("[Encrypted OpenPGP message that couldn't be decrypted: %s]", status.Error), &status
+		}
+		payload, err := gmailclient.ParseMIME(plaintext)
+		if err != nil {
+			return string(plaintext), &status
+		}
+		// Mail signed and then encrypted carries its signature inside, as multipart/signed
+		if payload.MimeType == "multipart/signed" && !status.Signed {
+			if signed, signature, err := pgp.SplitSigned(plaintext); err == nil {
+				inner := gpg.Verify(ctx, signed, signature)
+				status.Signed, status.Signature, status.Signer, status.KeyID = true, inner.Signature, inner.Signer, inner.KeyID
+			}
+		}
+		return extract.EmailBody(&gmail.Message{Payload: payload}), &status
+
+	case message.Payload.MimeType == "multipart/signed" && strings.Contains(contentType, "pgp-signature"):
+		if gpg == nil {
+			return body, &pgp.Status{Signed: true, Error: "OpenPGP support is off, so the signature wasn't checked"}
+		}
+		// Verifying needs the signed part's exact bytes, which only the raw message has
+		raw, err := g.client.GetMessage(ctx, message.Id, gmailclient.GetOptions{Format: "raw"})
+		if err != nil || raw.Raw == "" {
+			return body, &pgp.Status{Signed: true, Signature: pgp.SignatureError, Error: fmt.Sprintf("couldn't fetch the raw message to verify it: %v", err)}
+		}
+		data, err := base64.URLEncoding.DecodeString(raw.Raw)
+		if err != nil {
+			return body, &pgp.Status{Signed: true, Signature: pgp.SignatureError, Error: err.Error()}
+		}
+		signed, signature, err := pgp.SplitSigned(data)
+		if err != nil {
+			return body, &pgp.Status{Signed: true, Signature: pgp.SignatureError, Error: err.Error()}
+		}
+		status := gpg.Verify(ctx, signed, signature)
+		return body, &status
+
+	case strings.Contains(body, pgp.MessageArmor):
+		if gpg == nil {
+			return body, &pgp.Status{Encrypted: true, Error: "OpenPGP support is off"}
+		}
+		block := pgp.ArmoredBlock(body, pgp.MessageArmor)
+		if block == nil {
+			return body, nil
+		}
+		plaintext, status := gpg.Decrypt(ctx, block)
+		if !status.Decrypted {
+			return body, &status
+		}
+		return strings.Replace(body, string(block), string(plaintext), 1), &status
+
+	case strings.Contains(body, pgp.SignedMessageArmor):
+		if gpg == nil {
+			return body, &pgp.Status{Signed: true, Error: "OpenPGP support is off, so the signature wasn't checked"}
+		}
+		block := pgp.ArmoredBlock(body, pgp.SignedMessageArmor)
+		if block == nil {
+			return body, nil
+		}
+		status := gpg.Verify(ctx, block, nil)
+		return body, &status
+	}
+	return body, nil
+}
+
+// encryptedPartData returns the ciphertext of a PGP/MIME message: its
+// application/octet-stream part, downloaded when Gmail stored it as an attachment
+func (g *GmailServer) encryptedPartData(ctx context.Context, message *gmail.Message) ([]byte, error) {
+	for _, part := range message.Payload.Parts {
+		if part.MimeType != "application/octet-stream" || part.Body == nil {
+			continue
+		}
+		data := part.Body.Data
+		if part.Body.AttachmentId != "" {
+			attachment, err := g.client.GetAttachment(ctx, message.Id, part.Body.AttachmentId)
+			if err != nil {
+				return nil, fmt.Errorf("failed to download the encrypted part: %v", err)
+			}
+			data = attachment.Data
+		}
+		decoded, err := extract.DecodeEmailContent(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode the encrypted part: %v", err)
+		}
+		return []byte(decoded), nil
+	}
+	return nil, fmt.Errorf("PGP/MIME message has no encrypted part")
+}
+
+// encryptBody encrypts a plain-text draft body to the recipients and the user as
+// PGP/MIME, returning the MIME headers and body that follow the message headers.
+// Every recipient needs a public key in the local keyring.
+func (g *GmailServer) encryptBody(ctx context.Context, to, body string) (string, error) {
+	gpg := pgp.FromEnv()
+	if gpg == nil {
+		return "", toolerr.Errorf(toolerr.InvalidInput, "pgp_disabled", "encrypt needs OpenPGP support: set GMAIL_MCP_GPG and import the recipients' public keys")
+	}
+	recipients := recipientAddresses(to)
+	keys := gpg.CheckKeys(ctx, recipients)
+	if len(keys.Missing) > 0 {
+		return "", toolerr.Errorf(toolerr.InvalidInput, "public_key_missing", "no usable public key in the keyring for %s; import it with gpg --import, or leave encrypt off", strings.Join(keys.Missing, ", "))
+	}
+	if len(keys.Untrusted) > 0 {
+		return "", toolerr.Errorf(toolerr.InvalidInput, "public_key_untrusted", "the public key for %s isn't certified, so gpg won't encrypt to it; check its fingerprint and sign it with gpg --lsign-key, or leave encrypt off", strings.Join(keys.Untrusted, ", "))
+	}
+	// Encrypt to the user too when they have a key, so they can read their sent mail
+	if me := g.userEmail(ctx); me != "" && gpg.CheckKeys(ctx, []string{me}).OK() {
+		recipients = append(recipients, me)
+	}
+
+	inner := "Content-Type: text/plain; charset=UTF-8\r\n\r\n" + strings.ReplaceAll(body, "\n", "\r\n")
+	ciphertext, err := gpg.Encrypt(ctx, []byte(inner), recipients)
+	if err != nil {
+		return "", fmt.Errorf("failed to encrypt the draft: %v", err)
+	}
+	boundary := make([]byte, 12)
+	rand.Read(boundary)
+	return pgp.EncryptedMIME(ciphertext, "pgp-"+hex.EncodeToString(boundary)), nil
+}
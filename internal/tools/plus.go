@@ -0,0 +1,71 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"auto-gmail/internal/toolerr"
+)
+
+// tagPattern is what a plus-address tag may contain
+var tagPattern = regexp.MustCompile(`^[a-zA-Z0-9._-]{1,64}$`)
+
+// validTag checks a plus-address tag such as "newsletter" or "q3-launch"
+func validTag(tag string) error {
+	if !tagPattern.MatchString(tag) {
+		return toolerr.Errorf(toolerr.InvalidInput, "invalid_tag", "invalid tag %q: use up to 64 letters, digits, dots, dashes or underscores", tag)
+	}
+	return nil
+}
+
+// plusAddress tags an address as user+tag@domain, replacing any tag it already has.
+// Gmail delivers plus-addressed mail, bounces included, to the same mailbox.
+func plusAddress(address, tag string) string {
+	local, domain, ok := strings.Cut(address, "@")
+	if !ok {
+		return address
+	}
+	local, _, _ = strings.Cut(local, "+")
+	return local + "+" + tag + "@" + domain
+}
+
+// tagAddress returns the user's own address tagged with tag
+func (g *GmailServer) tagAddress(ctx context.Context, tag string) (string, error) {
+	if err := validTag(tag); err != nil {
+		return "", err
+	}
+	me := g.userEmail(ctx)
+	if me == "" {
+		return "", toolerr.Errorf(toolerr.Unavailable, "address_unknown", "couldn't look up your address to tag it with %q", tag)
+	}
+	return plusAddress(me, tag), nil
+}
+
+// tagHeaders returns From and Reply-To headers for sending from the user's address
+// tagged with tag, or nothing without a tag. Gmail may rewrite From to the main
+// address unless the tagged one is a "Send mail as" alias; Reply-To keeps replies
+// coming back tagged either way.
+func (g *GmailServer) tagHeaders(ctx context.Context, tag string) (string, error) {
+	if tag == "" {
+		return "", nil
+	}
+	address, err := g.tagAddress(ctx, tag)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("From: %s\r\nReply-To: %s\r\n", address, address), nil
+}
+
+// withTag narrows a query to mail delivered to the user's address tagged with tag
+func (g *GmailServer) withTag(ctx context.Context, query, tag string) (string, error) {
+	if tag == "" {
+		return query, nil
+	}
+	address, err := g.tagAddress(ctx, tag)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(query + " deliveredto:" + address), nil
+}
@@ -0,0 +1,352 @@
+package tools
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"auto-gmail/internal/auth"
+	"auto-gmail/internal/config"
+	"auto-gmail/internal/extract"
+	"auto-gmail/internal/gmailclient"
+	"auto-gmail/internal/toolerr"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+	"golang.org/x/oauth2/jwt"
+	"google.golang.org/api/gmail/v1"
+)
+
+// GmailServerPool resolves which GmailServer handles a tool call.
+// In single-user mode every call goes to the default server. In multi-user HTTP mode
+// each authenticated HTTP principal is mapped to its own GmailServer, token and style
+// guide, and calls without a known principal are rejected instead of falling back.
+type GmailServerPool struct {
+	defaultServer *GmailServer
+	config        *oauth2.Config
+
+	// principals maps HTTP bearer tokens to the Gmail address they may act as
+	principals map[string]string
+	// delegation is set when a service account with domain-wide delegation is configured
+	delegation *jwt.Config
+
+	mu         sync.Mutex
+	servers    map[string]*GmailServer
+	authStates map[string]*GmailServer
+	// workersEnabled is set by StartBackgroundWorkers and passed on to per-user servers
+	workersEnabled bool
+}
+
+// multiUserConfig is the format of the users file (GMAIL_MCP_USERS_FILE or users.json in the app data directory)
+type multiUserConfig struct {
+	Users []struct {
+		Token string `json:"token"`
+		Email string `json:"email"`
+	} `json:"users"`
+}
+
+type principalContextKey struct{}
+
+var unsafeFilenameChars = regexp.MustCompile(`[^a-z0-9@._-]`)
+
+// NewGmailServerPool creates the pool around the default server and enables
+// multi-user mode when a users file is configured
+func NewGmailServerPool(defaultServer *GmailServer) (*GmailServerPool, error) {
+	p := &GmailServerPool{
+		defaultServer: defaultServer,
+		config:        defaultServer.config,
+		servers:       make(map[string]*GmailServer),
+		authStates:    make(map[string]*GmailServer),
+	}
+
+	usersFile := os.Getenv("GMAIL_MCP_USERS_FILE")
+	if usersFile == "" {
+		usersFile = config.AppFilePath("users.json")
+		if _, err := os.Stat(usersFile); err != nil {
+			return p, nil // No users file, single-user mode
+		}
+	}
+
+	data, err := os.ReadFile(usersFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read users file %s: %v", usersFile, err)
+	}
+	var cfg multiUserConfig
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse users file %s: %v", usersFile, err)
+	}
+
+	p.principals = make(map[string]string)
+	for _, user := range cfg.Users {
+		if user.Token == "" || user.Email == "" {
+			return nil, fmt.Errorf("users file %s: every user needs both token and email", usersFile)
+		}
+		p.principals[user.Token] = strings.ToLower(user.Email)
+	}
+
+	// Optional domain-wide delegation: one service account impersonates every user
+	if saFile := os.Getenv("GMAIL_SERVICE_ACCOUNT_FILE"); saFile != "" {
+		saData, err := os.ReadFile(saFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read service account file %s: %v", saFile, err)
+		}
+		p.delegation, err = google.JWTConfigFromJSON(saData, auth.Scopes...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse service account file %s: %v", saFile, err)
+		}
+	}
+
+	log.Printf("👥 Multi-user mode enabled for %d users (domain-wide delegation: %v)", len(p.principals), p.delegation != nil)
+	return p, nil
+}
+
+// Default returns the single-user server, which also reports process-wide status
+func (p *GmailServerPool) Default() *GmailServer {
+	return p.defaultServer
+}
+
+// StartBackgroundWorkers enables background work for the default server and every
+// per-user server, including those created later. Only the serve path calls it.
+func (p *GmailServerPool) StartBackgroundWorkers() {
+	p.mu.Lock()
+	p.workersEnabled = true
+	servers := make([]*GmailServer, 0, len(p.servers))
+	for _, g := range p.servers {
+		servers = append(servers, g)
+	}
+	p.mu.Unlock()
+
+	p.defaultServer.StartBackgroundWorkers()
+	for _, g := range servers {
+		g.StartBackgroundWorkers()
+	}
+}
+
+// MultiUser reports whether tool calls are routed per HTTP principal
+func (p *GmailServerPool) MultiUser() bool {
+	return p.principals != nil
+}
+
+// HTTPContext attaches the Gmail address of the request's bearer token to the context.
+// It is used as the HTTP transport's context function.
+func (p *GmailServerPool) HTTPContext(ctx context.Context, r *http.Request) context.Context {
+	email := p.principalFromRequest(r)
+	if email == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, principalContextKey{}, email)
+}
+
+// principalFromRequest returns the Gmail address of the request's bearer token, or ""
+// in single-user mode or without a known token
+func (p *GmailServerPool) principalFromRequest(r *http.Request) string {
+	if !p.MultiUser() {
+		return ""
+	}
+
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") {
+		return ""
+	}
+	presented := []byte(strings.TrimPrefix(auth, "Bearer "))
+
+	// Compare against every token so lookup time doesn't leak which tokens exist
+	var email string
+	for token, address := range p.principals {
+		if subtle.ConstantTimeCompare(presented, []byte(token)) == 1 {
+			email = address
+		}
+	}
+	return email
+}
+
+// endSession drops the per-session state every server keeps for an MCP session
+func (p *GmailServerPool) endSession(sessionID string) {
+	p.defaultServer.delta.endSession(sessionID)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, g := range p.servers {
+		g.delta.endSession(sessionID)
+	}
+}
+
+// PrincipalFromContext returns the Gmail address of the authenticated HTTP principal, if any
+func PrincipalFromContext(ctx context.Context) string {
+	email, _ := ctx.Value(principalContextKey{}).(string)
+	return email
+}
+
+// ServerFor returns the caller's mailbox, whether or not it is authenticated yet
+func (p *GmailServerPool) ServerFor(ctx context.Context) (Mailbox, error) {
+	g, err := p.serverFor(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// serverFor returns the GmailServer for the caller, whether or not it is authenticated yet
+func (p *GmailServerPool) serverFor(ctx context.Context) (*GmailServer, error) {
+	if !p.MultiUser() {
+		return p.defaultServer, nil
+	}
+
+	email := PrincipalFromContext(ctx)
+	if email == "" {
+		return nil, toolerr.Errorf(toolerr.Auth, "unauthorized", "unauthorized: send a valid 'Authorization: Bearer <token>' header configured in the users file")
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if g, ok := p.servers[email]; ok {
+		return g, nil
+	}
+
+	g, err := p.newUserServer(email)
+	if err != nil {
+		return nil, err
+	}
+	p.servers[email] = g
+	if p.workersEnabled {
+		g.StartBackgroundWorkers()
+	}
+	return g, nil
+}
+
+// ForRequest returns the caller's authenticated mailbox, or a tool error result
+func (p *GmailServerPool) ForRequest(ctx context.Context) (Mailbox, *mcp.CallToolResult) {
+	g, err := p.serverFor(ctx)
+	if err != nil {
+		return nil, toolerr.Result(err, "")
+	}
+	if authResult := g.requireAuth(); authResult != nil {
+		return nil, authResult
+	}
+	return g, nil
+}
+
+// newUserServer creates an isolated server for one user with its own data directory
+func (p *GmailServerPool) newUserServer(email string) (*GmailServer, error) {
+	userDir := filepath.Join(config.AppDataDir(), "users", unsafeFilenameChars.ReplaceAllString(email, "_"))
+	if err := os.MkdirAll(userDir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create data directory for %s: %v", email, err)
+	}
+
+	if p.delegation != nil {
+		g := &GmailServer{
+			userID:         "me",
+			config:         p.config,
+			tokenFile:      filepath.Join(userDir, "token.json"),
+			styleGuideFile: filepath.Join(userDir, "personal-email-style-guide.md"),
+			cache:          newGmailCache(),
+			delta:          newDeltaTracker(),
+			extractCache:   extract.NewCache(filepath.Join(userDir, "extraction-cache")),
+			pool:           p,
+			principal:      email,
+		}
+		delegated := *p.delegation
+		delegated.Subject = email
+		if err := g.setHTTPClient(delegated.Client(context.Background())); err != nil {
+			return nil, fmt.Errorf("failed to impersonate %s: %v", email, err)
+		}
+		return g, nil
+	}
+
+	g, err := newGmailServerWithTokenFile(p.config, filepath.Join(userDir, "token.json"))
+	if err != nil {
+		return nil, err
+	}
+	g.styleGuideFile = filepath.Join(userDir, "personal-email-style-guide.md")
+	g.extractCache = extract.NewCache(filepath.Join(userDir, "extraction-cache"))
+	g.pool = p
+	g.principal = email
+	return g, nil
+}
+
+// registerAuthState returns a one-time OAuth state value that routes the callback to g
+func (p *GmailServerPool) registerAuthState(g *GmailServer) string {
+	buf := make([]byte, 16)
+	rand.Read(buf)
+	state := hex.EncodeToString(buf)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.authStates[state] = g
+	return state
+}
+
+// HandleOAuth2Callback completes a per-user OAuth flow started by the authenticate tool
+func (p *GmailServerPool) HandleOAuth2Callback(w http.ResponseWriter, r *http.Request) {
+	state := r.URL.Query().Get("state")
+	p.mu.Lock()
+	g, ok := p.authStates[state]
+	delete(p.authStates, state)
+	p.mu.Unlock()
+	if !ok {
+		http.Error(w, "Unknown or expired authorization state. Call the authenticate tool again.", http.StatusBadRequest)
+		return
+	}
+
+	code := r.URL.Query().Get("code")
+	if code == "" {
+		g.failAuthentication(fmt.Errorf("no code in callback"))
+		http.Error(w, "Authorization code not found", http.StatusBadRequest)
+		return
+	}
+
+	token, err := p.config.Exchange(r.Context(), code)
+	if err != nil {
+		g.failAuthentication(err)
+		http.Error(w, "Failed to complete authorization: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Only keep a token for the mailbox this principal is allowed to use
+	profile, err := p.tokenProfile(r.Context(), token)
+	if err != nil {
+		g.failAuthentication(err)
+		http.Error(w, "Failed to complete authorization: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !strings.EqualFold(profile.EmailAddress, g.principal) {
+		err := fmt.Errorf("signed in as %s, but this bearer token is for %s; call the authenticate tool again and sign in as %s", profile.EmailAddress, g.principal, g.principal)
+		g.failAuthentication(err)
+		http.Error(w, "Wrong Google account: "+err.Error(), http.StatusForbidden)
+		return
+	}
+
+	auth.SaveToken(g.tokenFile, token)
+	if err := g.setToken(token); err != nil {
+		g.failAuthentication(err)
+		http.Error(w, "Failed to complete authorization: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html")
+	w.Write([]byte(`<h1>✅ Gmail Authorization successful.</h1><p>You may close this window and return to your MCP client.</p>`))
+}
+
+// tokenProfile looks up which Gmail account an OAuth token belongs to
+func (p *GmailServerPool) tokenProfile(ctx context.Context, token *oauth2.Token) (*gmail.Profile, error) {
+	client, err := gmailclient.NewAPIClient(ctx, p.config.Client(ctx, token), "me")
+	if err != nil {
+		return nil, err
+	}
+	profile, err := client.GetProfile(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("could not check which account signed in: %v", err)
+	}
+	return profile, nil
+}
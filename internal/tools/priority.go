@@ -0,0 +1,382 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"html"
+	"log"
+	"net/mail"
+	"sort"
+	"strings"
+	"time"
+
+	"auto-gmail/internal/extract"
+	"auto-gmail/internal/toolerr"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"google.golang.org/api/gmail/v1"
+)
+
+// Priority score weights; a thread scores between 0 and 100
+const (
+	vipWeight       = 30
+	importantWeight = 15
+	recencyWeight   = 15
+	unreadWeight    = 10
+	directWeight    = 10
+	historyWeight   = 10
+	questionWeight  = 10
+	// recencyWindow is how long a thread keeps some recency score
+	recencyWindow = 7 * 24 * time.Hour
+	// correspondentScan is how many sent messages are read to learn who the user writes to
+	correspondentScan = 200
+	// correspondentTTL is how long that list is reused before it's read again
+	correspondentTTL = time.Hour
+)
+
+// priorityContext is what scoring needs besides the thread: who the user is, their
+// VIPs and who they've written to recently
+type priorityContext struct {
+	me   string
+	vips []string
+	// correspondents counts the user's recent sent messages per recipient address
+	correspondents map[string]int
+}
+
+// priorityFactor is one signal's share of a priority score
+type priorityFactor struct {
+	Signal string `json:"signal"`
+	Points int    `json:"points"`
+	Max    int    `json:"max"`
+	// Detail says what was found, or what would have scored
+	Detail string `json:"detail"`
+
+	// reason is the short phrase listed in priorityReasons when the signal scores
+	reason string
+}
+
+// priorityContext gathers what scoring threads for this account needs
+func (g *GmailServer) priorityContext(ctx context.Context) priorityContext {
+	return priorityContext{me: g.userEmail(ctx), vips: g.loadVIPs(), correspondents: g.correspondents(ctx)}
+}
+
+// correspondents counts the recipients of the user's most recent sent mail, read
+// at most once per correspondentTTL. It's how much history the user has with a
+// sender without a search per sender.
+func (g *GmailServer) correspondents(ctx context.Context) map[string]int {
+	g.correspondentsMu.Lock()
+	defer g.correspondentsMu.Unlock()
+	if g.correspondentCounts != nil && time.Since(g.correspondentsRead) < correspondentTTL {
+		return g.correspondentCounts
+	}
+
+	counts := map[string]int{}
+	sent, err := g.client.ListMessages(ctx, "in:sent", correspondentScan)
+	if err != nil {
+		log.Printf("Warning: Could not read sent mail for priority scores: %v", err)
+		return counts
+	}
+	ids := make([]string, len(sent.Messages))
+	for i, message := range sent.Messages {
+		ids[i] = message.Id
+	}
+	for _, message := range g.hydrateMessageHeaders(ctx, ids, []string{"To", "Cc"}) {
+		for _, field := range []string{"To", "Cc"} {
+			addresses, err := mail.ParseAddressList(messageHeader(message, field))
+			if err != nil {
+				continue
+			}
+			for _, addr := range addresses {
+				counts[strings.ToLower(addr.Address)]++
+			}
+		}
+	}
+	g.correspondentCounts, g.correspondentsRead = counts, time.Now()
+	return counts
+}
+
+// userEmail returns the mailbox owner's address, looked up once per server
+func (g *GmailServer) userEmail(ctx context.Context) string {
+	g.authMu.RLock()
+	email := g.emailAddress
+	g.authMu.RUnlock()
+	if email != "" {
+		return email
+	}
+
+	profile, err := g.client.GetProfile(ctx)
+	if err != nil {
+		log.Printf("Warning: Could not look up the account address: %v", err)
+		return ""
+	}
+	g.authMu.Lock()
+	g.emailAddress = strings.ToLower(profile.EmailAddress)
+	g.authMu.Unlock()
+	return strings.ToLower(profile.EmailAddress)
+}
+
+// threadPriority scores a thread from 0 to 100, with the reasons behind it
+func threadPriority(thread *gmail.Thread, pc priorityContext) (int, []string) {
+	score := 0
+	var reasons []string
+	for _, factor := range priorityFactors(thread, pc) {
+		if factor.Points > 0 {
+			score += factor.Points
+			reasons = append(reasons, factor.reason)
+		}
+	}
+	return score, reasons
+}
+
+// priorityFactors breaks a thread's priority into its signals: a VIP sender, Gmail's
+// own importance marker, recency, unread mail, direct addressing, the user's history
+// with the sender and a question in the latest message
+func priorityFactors(thread *gmail.Thread, pc priorityContext) []priorityFactor {
+	var vipFrom, directFrom string
+	var unread bool
+	var latest int64
+	var incoming *gmail.Message // the latest message from someone else
+	for _, message := range thread.Messages {
+		latest = max(latest, message.InternalDate)
+		if hasLabelID(message, "SENT") || hasLabelID(message, "DRAFT") || message.Payload == nil {
+			continue
+		}
+		unread = unread || hasLabelID(message, "UNREAD")
+		from := messageHeader(message, "From")
+		if vipFrom == "" && isVIP(from, pc.vips) {
+			vipFrom = from
+		}
+		if directFrom == "" && pc.me != "" && addressedTo(messageHeader(message, "To"), pc.me) {
+			directFrom = from
+		}
+		if incoming == nil || message.InternalDate >= incoming.InternalDate {
+			incoming = message
+		}
+	}
+
+	factors := make([]priorityFactor, 0, 7)
+	vip := priorityFactor{Signal: "vip", Max: vipWeight, Detail: "No VIP sender; add one with set_vip", reason: "VIP sender"}
+	if vipFrom != "" {
+		vip.Points, vip.Detail = vipWeight, displayName(vipFrom)+" is a VIP"
+	}
+	factors = append(factors, vip)
+
+	important := priorityFactor{Signal: "gmailImportant", Max: importantWeight, Detail: "Gmail doesn't mark it important", reason: "marked important by Gmail"}
+	if gmailImportant(thread) {
+		important.Points, important.Detail = importantWeight, "Gmail marks it important"
+	}
+	factors = append(factors, important)
+
+	recency := priorityFactor{Signal: "recency", Max: recencyWeight, Detail: "No activity in the last 7 days", reason: "recent"}
+	if age := time.Since(time.UnixMilli(latest)); latest != 0 && age < recencyWindow {
+		recency.Points = int(float64(recencyWeight) * (1 - float64(age)/float64(recencyWindow)))
+		recency.Detail = "Latest message " + waitingTime(age) + " ago"
+	}
+	factors = append(factors, recency)
+
+	unreadFactor := priorityFactor{Signal: "unread", Max: unreadWeight, Detail: "Everything has been read", reason: "unread"}
+	if unread {
+		unreadFactor.Points, unreadFactor.Detail = unreadWeight, "Has unread messages"
+	}
+	factors = append(factors, unreadFactor)
+
+	direct := priorityFactor{Signal: "direct", Max: directWeight, Detail: "You're only cc'd, bcc'd or on a list", reason: "sent directly to you"}
+	if directFrom != "" {
+		direct.Points, direct.Detail = directWeight, displayName(directFrom)+" wrote to you directly"
+	}
+	factors = append(factors, direct)
+
+	history := priorityFactor{Signal: "senderHistory", Max: historyWeight, Detail: "Only your own messages", reason: "sender you write to"}
+	question := priorityFactor{Signal: "question", Max: questionWeight, Detail: "Only your own messages", reason: "asks a question"}
+	if incoming != nil {
+		sender := strings.ToLower(senderAddress(messageHeader(incoming, "From")))
+		switch sent := pc.correspondents[sender]; {
+		case isAutomated(incoming):
+			history.Detail = "Latest message is automated"
+		case sent > 0:
+			history.Points = historyWeight
+			history.Detail = fmt.Sprintf("You wrote to %s in %d of your last %d sent messages", sender, sent, correspondentScan)
+		default:
+			history.Detail = fmt.Sprintf("You haven't written to %s recently", sender)
+		}
+
+		question.Detail = "The latest message from someone else asks no question"
+		if questions := directedQuestions(incoming, pc.me); len(questions) > 0 && !isAutomated(incoming) {
+			question.Points = questionWeight
+			question.Detail = fmt.Sprintf("%s asks: %q", displayName(messageHeader(incoming, "From")), truncateText(questions[0], 160))
+		}
+	}
+	return append(factors, history, question)
+}
+
+// gmailImportant reports whether Gmail's own importance model marked any message
+// of the thread important
+func gmailImportant(thread *gmail.Thread) bool {
+	for _, message := range thread.Messages {
+		if hasLabelID(message, "IMPORTANT") {
+			return true
+		}
+	}
+	return false
+}
+
+// messageQuestions are the questions in a message's own text, leaving out quoted
+// replies; a message without a body falls back to its snippet
+func messageQuestions(message *gmail.Message) []string {
+	text := stripQuotedText(extract.EmailBody(message))
+	if text == "" {
+		text = html.UnescapeString(message.Snippet)
+	}
+	var questions []string
+	for _, sentence := range splitSentences(text) {
+		if strings.HasSuffix(sentence, "?") {
+			questions = append(questions, sentence)
+		}
+	}
+	return questions
+}
+
+// priorityReason explains in one phrase why a thread matters, e.g. "direct question
+// from Dana Lee (VIP), unanswered for 2 days, unread", so agents don't re-derive it
+func priorityReason(thread *gmail.Thread, pc priorityContext) string {
+	me, vips := pc.me, pc.vips
+	if len(thread.Messages) == 0 {
+		return ""
+	}
+	latest := lastMessage(thread)
+	var incoming *gmail.Message // the latest message from someone else
+	for _, message := range thread.Messages {
+		if !hasLabelID(message, "SENT") && message.Payload != nil && (incoming == nil || message.InternalDate >= incoming.InternalDate) {
+			incoming = message
+		}
+	}
+	if incoming == nil {
+		return "only your own messages"
+	}
+
+	kind := "message"
+	switch {
+	case messageHeader(incoming, "List-Id") != "" || messageHeader(incoming, "List-Unsubscribe") != "":
+		kind = "mailing list message"
+	case isAutoReply(incoming):
+		kind = "auto-reply"
+	case len(messageQuestions(incoming)) > 0:
+		kind = "question"
+	}
+	switch {
+	case me != "" && addressedTo(messageHeader(incoming, "To"), me):
+		kind = "direct " + kind
+	case me != "" && addressedTo(messageHeader(incoming, "Cc"), me):
+		kind += " (you're cc'd)"
+	}
+
+	from := messageHeader(incoming, "From")
+	sender := senderAddress(from)
+	if parsed, err := mail.ParseAddress(from); err == nil && parsed.Name != "" {
+		sender = parsed.Name
+	}
+	if isVIP(from, vips) {
+		sender += " (VIP)"
+	}
+	parts := []string{fmt.Sprintf("%s from %s", kind, sender)}
+
+	if latest == incoming || !hasLabelID(latest, "SENT") {
+		parts = append(parts, "unanswered for "+waitingTime(time.Since(time.UnixMilli(incoming.InternalDate))))
+	} else {
+		parts = append(parts, "you replied last")
+	}
+	if hasLabelID(incoming, "UNREAD") {
+		parts = append(parts, "unread")
+	}
+	return strings.Join(parts, ", ")
+}
+
+// waitingTime renders how long something has waited, e.g. "3 hours" or "2 days"
+func waitingTime(age time.Duration) string {
+	switch {
+	case age < time.Hour:
+		return "less than an hour"
+	case age < 2*time.Hour:
+		return "1 hour"
+	case age < 24*time.Hour:
+		return fmt.Sprintf("%d hours", int(age.Hours()))
+	case age < 48*time.Hour:
+		return "1 day"
+	}
+	return fmt.Sprintf("%d days", int(age.Hours()/24))
+}
+
+// addressedTo reports whether an address list header contains me
+func addressedTo(header, me string) bool {
+	addresses, err := mail.ParseAddressList(header)
+	if err != nil {
+		return strings.Contains(strings.ToLower(header), me)
+	}
+	for _, addr := range addresses {
+		if strings.EqualFold(addr.Address, me) {
+			return true
+		}
+	}
+	return false
+}
+
+// sortByPriority orders results by their "priority" field, highest first
+func sortByPriority(results []map[string]interface{}) {
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i]["priority"].(int) > results[j]["priority"].(int)
+	})
+}
+
+// ExplainPriority breaks down the priority score of a thread, or of the thread a
+// message is in: each signal's points out of its maximum and what was found, next
+// to Gmail's own importance marker, so a user can see why mail ranked where it did
+// and what would change it
+func (g *GmailServer) ExplainPriority(ctx context.Context, threadID, messageID string) (*mcp.CallToolResult, error) {
+	threadID, messageID = strings.TrimSpace(threadID), strings.TrimSpace(messageID)
+	if (threadID == "") == (messageID == "") {
+		return toolerr.Invalid("Give either thread_id or message_id"), nil
+	}
+	if messageID != "" {
+		message, err := g.getMessage(ctx, messageID)
+		if err != nil {
+			return toolerr.Result(err, "Failed to get message"), nil
+		}
+		threadID = message.ThreadId
+	}
+	thread, err := g.getThread(ctx, threadID, 0)
+	if err != nil {
+		return toolerr.Result(err, "Failed to get thread"), nil
+	}
+	if len(thread.Messages) == 0 {
+		return toolerr.New(toolerr.NotFound, "empty_thread", "Thread has no messages").Result(), nil
+	}
+
+	pc := g.priorityContext(ctx)
+	factors := priorityFactors(thread, pc)
+	score, reasons := threadPriority(thread, pc)
+	subject := messageHeader(thread.Messages[0], "Subject")
+	if subject == "" {
+		subject = "(no subject)"
+	}
+
+	important := gmailImportant(thread)
+	result := map[string]interface{}{
+		"threadId":        thread.Id,
+		"subject":         subject,
+		"priority":        score,
+		"priorityReasons": reasons,
+		"reason":          priorityReason(thread, pc),
+		"gmailImportant":  important,
+		"factors":         factors,
+	}
+	switch {
+	case important && score < 50:
+		result["note"] = "Gmail marks this important but the server scores it low; Gmail's model also learns from how you've treated similar mail, which the server can't see."
+	case !important && score >= 50:
+		result["note"] = "The server scores this high although Gmail doesn't mark it important."
+	}
+
+	resultJSON, _ := json.MarshalIndent(result, "", "  ")
+	return mcp.NewToolResultText(string(resultJSON)), nil
+}
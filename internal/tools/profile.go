@@ -0,0 +1,80 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"auto-gmail/internal/auth"
+	"auto-gmail/internal/toolerr"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"golang.org/x/oauth2"
+)
+
+// Profile reports which account the server is operating on: its address, message
+// and thread totals, current history ID and the OAuth scopes it was granted
+func (g *GmailServer) Profile(ctx context.Context) (*mcp.CallToolResult, error) {
+	profile, err := g.client.GetProfile(ctx)
+	if err != nil {
+		return toolerr.Result(err, "Failed to get profile"), nil
+	}
+
+	result := map[string]interface{}{
+		"emailAddress":  profile.EmailAddress,
+		"messagesTotal": profile.MessagesTotal,
+		"threadsTotal":  profile.ThreadsTotal,
+		"historyId":     profile.HistoryId,
+	}
+	if stale := staleAsOf(profile.ServerResponse); stale != "" {
+		result["staleAsOf"] = stale
+	}
+
+	g.authMu.RLock()
+	tokenSource := g.tokenSource
+	g.authMu.RUnlock()
+	if tokenSource == nil {
+		// IMAP, Outlook and offline backends don't use Google OAuth
+		result["scopesNote"] = "Not connected through Google OAuth, so there are no Gmail scopes"
+	} else {
+		scopes, err := grantedScopes(ctx, tokenSource)
+		if err != nil {
+			log.Printf("Warning: Could not look up granted scopes: %v", err)
+			result["requestedScopes"] = auth.Scopes
+			result["scopesNote"] = fmt.Sprintf("Could not confirm the granted scopes (%v); these were requested", err)
+		} else {
+			result["grantedScopes"] = scopes
+			if missing := missingScopes(scopes); len(missing) > 0 {
+				result["missingScopes"] = missing
+			}
+		}
+	}
+
+	resultJSON, _ := json.MarshalIndent(result, "", "  ")
+	return mcp.NewToolResultText(string(resultJSON)), nil
+}
+
+// grantedScopes looks up the scopes of the token source's current access token
+func grantedScopes(ctx context.Context, tokenSource oauth2.TokenSource) ([]string, error) {
+	token, err := tokenSource.Token()
+	if err != nil {
+		return nil, err
+	}
+	return auth.GrantedScopes(ctx, token)
+}
+
+// missingScopes lists the requested scopes the user didn't grant
+func missingScopes(granted []string) []string {
+	have := map[string]bool{}
+	for _, scope := range granted {
+		have[scope] = true
+	}
+	var missing []string
+	for _, scope := range auth.Scopes {
+		if !have[scope] {
+			missing = append(missing, scope)
+		}
+	}
+	return missing
+}
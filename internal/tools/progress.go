@@ -0,0 +1,53 @@
+package tools
+
+import (
+	"context"
+	"log"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// progressReporter streams per-item progress notifications for long-running tool calls.
+// It does nothing when the client didn't ask for progress (no progress token).
+type progressReporter struct {
+	ctx   context.Context
+	token mcp.ProgressToken
+	total int
+	done  int
+}
+
+// newProgressReporter creates a reporter for a request's progress token
+func newProgressReporter(ctx context.Context, req mcp.CallToolRequest, total int) *progressReporter {
+	var token mcp.ProgressToken
+	if req.Params.Meta != nil {
+		token = req.Params.Meta.ProgressToken
+	}
+	return &progressReporter{ctx: ctx, token: token, total: total}
+}
+
+// report marks one more item as finished. partial, when non-nil, is the item's result
+// so clients can start using it before the whole call completes.
+func (p *progressReporter) report(message string, partial interface{}) {
+	p.done++
+	if p.token == nil {
+		return
+	}
+	mcpServer := server.ServerFromContext(p.ctx)
+	if mcpServer == nil {
+		return
+	}
+
+	params := map[string]any{
+		"progressToken": p.token,
+		"progress":      p.done,
+		"total":         p.total,
+		"message":       message,
+	}
+	if partial != nil {
+		params["partialResult"] = partial
+	}
+	if err := mcpServer.SendNotificationToClient(p.ctx, "notifications/progress", params); err != nil {
+		log.Printf("Warning: Failed to send progress notification: %v", err)
+	}
+}
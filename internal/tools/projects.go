@@ -0,0 +1,418 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/mail"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"google.golang.org/api/gmail/v1"
+
+	"auto-gmail/internal/gmailclient"
+	"auto-gmail/internal/toolerr"
+)
+
+// Project status limits
+const (
+	// projectQueryThreads is how many recent threads each of a project's queries adds
+	projectQueryThreads = 10
+	// projectThreadLimit caps how many threads a project's status covers
+	projectThreadLimit = 25
+	// projectFollowUpDays is how long the user's message waits before it needs a follow-up
+	projectFollowUpDays = 3
+)
+
+// projectNamePattern is what project names may contain, so they fit in a resource URI
+var projectNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]*$`)
+
+// project is a named set of threads and queries tracked together, e.g. a deal or a hire
+type project struct {
+	Threads []string  `json:"threads,omitempty"`
+	Queries []string  `json:"queries,omitempty"`
+	Created time.Time `json:"created"`
+	Updated time.Time `json:"updated"`
+}
+
+// projectsFile is where this server's tracked projects are stored, next to its token.
+// It's plain JSON so users can edit projects by hand.
+func (g *GmailServer) projectsFile() string {
+	return g.dataFile("projects.json")
+}
+
+// loadProjects reads the tracked projects; a missing file means none
+func (g *GmailServer) loadProjects() (map[string]*project, error) {
+	var stored struct {
+		Projects map[string]*project `json:"projects"`
+	}
+	data, err := os.ReadFile(g.projectsFile())
+	if os.IsNotExist(err) {
+		return map[string]*project{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return nil, toolerr.Errorf(toolerr.ParseFailure, "invalid_data_file", "invalid projects file %s: %v", g.projectsFile(), err)
+	}
+	projects := map[string]*project{}
+	for name, p := range stored.Projects {
+		projects[ProjectName(name)] = p
+	}
+	return projects, nil
+}
+
+// ProjectName normalizes a project name, or the {name} of a gmail://project/{name}
+// URI: lowercase, with spaces as dashes, so "Acme Deal" is "acme-deal"
+func ProjectName(value interface{}) string {
+	raw, _ := value.(string)
+	if unescaped, err := url.PathUnescape(raw); err == nil {
+		raw = unescaped
+	}
+	return strings.Join(strings.Fields(strings.ToLower(raw)), "-")
+}
+
+// projectURI is a project's resource address
+func projectURI(name string) string {
+	return "gmail://project/" + name
+}
+
+// TrackProject lists, extends, trims or deletes tracked projects. action is "list",
+// "add" (threads and a query, creating the project), "remove" (threads and a query)
+// or "delete" (the project).
+func (g *GmailServer) TrackProject(ctx context.Context, action, name string, threadIDs []string, query string) (*mcp.CallToolResult, error) {
+	name = ProjectName(name)
+	query = strings.TrimSpace(query)
+	if action == "" {
+		action = "list"
+	}
+	if action != "list" {
+		if name == "" {
+			return toolerr.Invalid("name parameter is required to change a project"), nil
+		}
+		if !projectNamePattern.MatchString(name) {
+			return toolerr.Invalid(fmt.Sprintf("Invalid project name %q: use letters, digits, spaces, dots, dashes and underscores", name)), nil
+		}
+	}
+	if query != "" {
+		if problems := lintQuery(query); len(problems) > 0 {
+			return invalidQueryError(query, problems), nil
+		}
+	}
+
+	g.projectsMu.Lock()
+	defer g.projectsMu.Unlock()
+
+	projects, err := g.loadProjects()
+	if err != nil {
+		return toolerr.Result(err, "Failed to read projects"), nil
+	}
+
+	switch action {
+	case "list":
+	case "add":
+		if len(threadIDs) == 0 && query == "" {
+			return toolerr.Invalid("thread_ids or query is required to add to a project"), nil
+		}
+		// Catch mistyped IDs now rather than on every read of the project
+		for _, id := range threadIDs {
+			if _, err := g.client.GetThread(ctx, id, gmailclient.GetOptions{Format: "minimal"}); err != nil {
+				return toolerr.Result(err, fmt.Sprintf("Failed to find thread %s", id)), nil
+			}
+		}
+		p, ok := projects[name]
+		if !ok {
+			p = &project{Created: time.Now().UTC()}
+			projects[name] = p
+		}
+		for _, id := range threadIDs {
+			if !containsString(p.Threads, id) {
+				p.Threads = append(p.Threads, id)
+			}
+		}
+		if query != "" && !containsString(p.Queries, query) {
+			p.Queries = append(p.Queries, query)
+		}
+		p.Updated = time.Now().UTC()
+	case "remove":
+		p, ok := projects[name]
+		if !ok {
+			return toolerr.New(toolerr.NotFound, "project_not_found", fmt.Sprintf("No project named '%s'", name)).Result(), nil
+		}
+		var threads, queries []string
+		for _, id := range p.Threads {
+			if !containsString(threadIDs, id) {
+				threads = append(threads, id)
+			}
+		}
+		for _, existing := range p.Queries {
+			if existing != query {
+				queries = append(queries, existing)
+			}
+		}
+		p.Threads, p.Queries, p.Updated = threads, queries, time.Now().UTC()
+	case "delete":
+		if _, ok := projects[name]; !ok {
+			return toolerr.New(toolerr.NotFound, "project_not_found", fmt.Sprintf("No project named '%s'", name)).Result(), nil
+		}
+		delete(projects, name)
+	default:
+		return toolerr.Invalid(fmt.Sprintf("Invalid action %q: use \"list\", \"add\", \"remove\" or \"delete\"", action)), nil
+	}
+
+	if action != "list" {
+		data, _ := json.MarshalIndent(map[string]interface{}{"projects": projects}, "", "  ")
+		if err := os.WriteFile(g.projectsFile(), data, 0600); err != nil {
+			return toolerr.Result(err, "Failed to save projects"), nil
+		}
+	}
+
+	names := make([]string, 0, len(projects))
+	for projectName := range projects {
+		names = append(names, projectName)
+	}
+	sort.Strings(names)
+	var listed []map[string]interface{}
+	for _, projectName := range names {
+		p := projects[projectName]
+		listed = append(listed, map[string]interface{}{
+			"name":     projectName,
+			"threads":  p.Threads,
+			"queries":  p.Queries,
+			"resource": projectURI(projectName),
+			"updated":  p.Updated.In(userNow().Location()).Format(time.RFC3339),
+		})
+	}
+	result := map[string]interface{}{
+		"action":   action,
+		"projects": listed,
+		"file":     g.projectsFile(),
+	}
+	if name != "" && action != "list" {
+		result["project"] = name
+		if action != "delete" {
+			result["note"] = fmt.Sprintf("Read %s for the project's current status", projectURI(name))
+		}
+	}
+
+	resultJSON, _ := json.MarshalIndent(result, "", "  ")
+	return mcp.NewToolResultText(string(resultJSON)), nil
+}
+
+// projectThread is one thread of a project with where it stands
+type projectThread struct {
+	thread  *gmail.Thread
+	latest  *gmail.Message
+	subject string
+	status  string
+	// waitingOnUser and followUp mark open items on either side
+	waitingOnUser bool
+	followUp      bool
+}
+
+// ProjectStatus merges a project's threads, and the recent matches of its queries,
+// into one markdown status: the latest development, open items on either side,
+// everyone involved, and each thread's state and latest message, newest first
+func (g *GmailServer) ProjectStatus(ctx context.Context, name string) (string, error) {
+	g.projectsMu.Lock()
+	projects, err := g.loadProjects()
+	g.projectsMu.Unlock()
+	if err != nil {
+		return "", err
+	}
+	p, ok := projects[name]
+	if !ok {
+		return "", toolerr.Errorf(toolerr.NotFound, "project_not_found", "no project named %q; create it with the track_project tool", name)
+	}
+
+	listed, err := g.projectThreadList(ctx, p)
+	if err != nil {
+		return "", err
+	}
+	hydrated := g.hydrateThreads(ctx, listed)
+
+	me := g.userEmail(ctx)
+	var threads []projectThread
+	var missing []string
+	for _, thread := range listed {
+		detail, ok := hydrated[thread.Id]
+		if !ok || len(detail.Messages) == 0 {
+			missing = append(missing, thread.Id)
+			continue
+		}
+		latest := latestThreadMessage(detail)
+		if latest == nil {
+			continue
+		}
+		threads = append(threads, describeProjectThread(detail, latest, me))
+	}
+	sort.Slice(threads, func(i, j int) bool { return threads[i].latest.InternalDate > threads[j].latest.InternalDate })
+	omitted := 0
+	if len(threads) > projectThreadLimit {
+		omitted = len(threads) - projectThreadLimit
+		threads = threads[:projectThreadLimit]
+	}
+
+	var out strings.Builder
+	now := userNow()
+	fmt.Fprintf(&out, "# Project: %s\n\n", name)
+	fmt.Fprintf(&out, "_%d threads; refreshed %s._\n\n", len(threads), now.Format("2006-01-02 15:04 MST"))
+	if len(threads) == 0 {
+		out.WriteString("None of the project's threads or queries match any mail yet.\n")
+		return out.String(), nil
+	}
+
+	latest := threads[0]
+	out.WriteString("## Where It Stands\n\n")
+	fmt.Fprintf(&out, "Latest: **%s** from %s, %s (%s)", latest.subject, displayName(messageHeader(latest.latest, "From")),
+		formatInternalDate(latest.latest.InternalDate), latest.status)
+	if latest.latest.Snippet != "" {
+		fmt.Fprintf(&out, ": %s", latest.latest.Snippet)
+	}
+	out.WriteString("\n\n")
+
+	var waitingOnUser, followUps []string
+	for _, t := range threads {
+		if t.waitingOnUser {
+			waitingOnUser = append(waitingOnUser, fmt.Sprintf("Reply to \"%s\" from %s (thread %s)", t.subject, displayName(messageHeader(t.latest, "From")), t.thread.Id))
+		}
+		if t.followUp {
+			days := int(time.Since(time.UnixMilli(t.latest.InternalDate)).Hours() / 24)
+			followUps = append(followUps, fmt.Sprintf("No reply for %d days to your \"%s\" (thread %s); consider a follow-up", days, t.subject, t.thread.Id))
+		}
+	}
+	out.WriteString("## Open Items\n\n")
+	if len(waitingOnUser) == 0 && len(followUps) == 0 {
+		out.WriteString("Nothing is waiting on either side.\n")
+	}
+	for _, item := range append(waitingOnUser, followUps...) {
+		fmt.Fprintf(&out, "- %s\n", item)
+	}
+
+	out.WriteString("\n## People\n\n")
+	for _, person := range projectPeople(threads, me) {
+		fmt.Fprintf(&out, "- %s\n", person)
+	}
+
+	out.WriteString("\n## Threads\n\n")
+	for _, t := range threads {
+		fmt.Fprintf(&out, "### %s\n- Thread: %s (%d messages)\n- Last message: %s from %s (%s)\n- Status: %s\n",
+			t.subject, t.thread.Id, len(t.thread.Messages), formatInternalDate(t.latest.InternalDate), messageHeader(t.latest, "From"), t.latest.Id, t.status)
+		if t.latest.Snippet != "" {
+			fmt.Fprintf(&out, "- Summary: %s\n", t.latest.Snippet)
+		}
+		out.WriteString("\n")
+	}
+	if omitted > 0 {
+		fmt.Fprintf(&out, "…and %d older threads.\n", omitted)
+	}
+	if len(missing) > 0 {
+		fmt.Fprintf(&out, "Threads that couldn't be loaded (if they were deleted, remove them with track_project): %s\n", strings.Join(missing, ", "))
+	}
+	return out.String(), nil
+}
+
+// projectThreadList is a project's own threads followed by the recent matches of its
+// queries, each once
+func (g *GmailServer) projectThreadList(ctx context.Context, p *project) ([]*gmail.Thread, error) {
+	listed := make([]*gmail.Thread, 0, len(p.Threads))
+	seen := map[string]bool{}
+	for _, id := range p.Threads {
+		if !seen[id] {
+			seen[id] = true
+			listed = append(listed, &gmail.Thread{Id: id})
+		}
+	}
+	for _, query := range p.Queries {
+		matches, err := g.client.ListThreads(ctx, query, projectQueryThreads)
+		if err != nil {
+			return nil, fmt.Errorf("failed to search %q: %v", query, err)
+		}
+		for _, thread := range matches.Threads {
+			if !seen[thread.Id] {
+				seen[thread.Id] = true
+				listed = append(listed, thread)
+			}
+		}
+	}
+	return listed, nil
+}
+
+// describeProjectThread works out whose turn a thread is
+func describeProjectThread(thread *gmail.Thread, latest *gmail.Message, me string) projectThread {
+	t := projectThread{thread: thread, latest: latest}
+	t.subject = stripSubjectPrefixes(messageHeader(thread.Messages[0], "Subject"))
+	if t.subject == "" {
+		t.subject = "(no subject)"
+	}
+	fromMe := hasLabelID(latest, "SENT") || (me != "" && strings.EqualFold(senderAddress(messageHeader(latest, "From")), me))
+	switch {
+	case fromMe:
+		t.status = "waiting on them"
+		t.followUp = time.Since(time.UnixMilli(latest.InternalDate)) > projectFollowUpDays*24*time.Hour
+	case isAutomated(latest):
+		t.status = "latest is an automated message"
+	default:
+		t.status = "waiting on you"
+		t.waitingOnUser = true
+		if hasLabelID(latest, "UNREAD") {
+			t.status += ", unread"
+		}
+	}
+	return t
+}
+
+// projectPeople lists everyone who wrote in the project's threads besides the user,
+// most messages first
+func projectPeople(threads []projectThread, me string) []string {
+	counts := map[string]int{}
+	names := map[string]string{}
+	for _, t := range threads {
+		for _, message := range t.thread.Messages {
+			if hasLabelID(message, "DRAFT") || hasLabelID(message, "SENT") {
+				continue
+			}
+			from := messageHeader(message, "From")
+			address := strings.ToLower(senderAddress(from))
+			if address == "" || strings.EqualFold(address, me) {
+				continue
+			}
+			counts[address]++
+			if _, ok := names[address]; !ok {
+				names[address] = from
+			}
+		}
+	}
+	addresses := make([]string, 0, len(counts))
+	for address := range counts {
+		addresses = append(addresses, address)
+	}
+	sort.Slice(addresses, func(i, j int) bool {
+		if counts[addresses[i]] != counts[addresses[j]] {
+			return counts[addresses[i]] > counts[addresses[j]]
+		}
+		return addresses[i] < addresses[j]
+	})
+	people := make([]string, len(addresses))
+	for i, address := range addresses {
+		people[i] = fmt.Sprintf("%s: %d messages", names[address], counts[address])
+	}
+	return people
+}
+
+// displayName is the name in a From header, or its address when it has none
+func displayName(from string) string {
+	if parsed, err := mail.ParseAddress(from); err == nil {
+		if parsed.Name != "" {
+			return parsed.Name
+		}
+		return parsed.Address
+	}
+	return from
+}
@@ -0,0 +1,421 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+
+	"auto-gmail/internal/config"
+	"auto-gmail/internal/toolerr"
+)
+
+// maxQueryDryRun caps how many messages validate_query counts
+const maxQueryDryRun = 500
+
+// broadQueryThreads is the thread estimate above which count_matches suggests
+// refining the query before fetching
+const broadQueryThreads = 100
+
+// QueryFilter is the structured input of build_query; empty fields are left out
+type QueryFilter struct {
+	From          string // addresses or names, comma-separated to match any of them
+	To            string // addresses or names, comma-separated to match any of them
+	Subject       string
+	After         string // YYYY/MM/DD
+	Before        string // YYYY/MM/DD
+	Range         string // a named range such as yesterday or last_7_days, instead of After/Before
+	Since         string // a phrase such as "last Tuesday" or "3 days ago", instead of After/Before
+	Labels        string // comma-separated label names, all required
+	HasAttachment bool
+	Category      string // inbox tab: primary, social, promotions, updates or forums
+	Text          string // free text or extra Gmail search operators
+}
+
+// gmailOperators are the search operators Gmail understands
+var gmailOperators = map[string]bool{
+	"from": true, "to": true, "cc": true, "bcc": true, "subject": true, "label": true,
+	"has": true, "is": true, "in": true, "after": true, "before": true, "older": true,
+	"newer": true, "older_than": true, "newer_than": true, "filename": true, "larger": true,
+	"smaller": true, "size": true, "category": true, "list": true, "deliveredto": true,
+	"rfc822msgid": true,
+}
+
+// operatorSuggestions maps operators agents commonly invent to the real ones
+var operatorSuggestions = map[string]string{
+	"date":       "after:/before:",
+	"since":      "after:",
+	"until":      "before:",
+	"sender":     "from:",
+	"recipient":  "to:",
+	"title":      "subject:",
+	"attachment": "has:attachment",
+	"tag":        "label:",
+	"folder":     "in: or label:",
+	"body":       "plain text without an operator",
+}
+
+var (
+	queryDatePattern     = regexp.MustCompile(`^\d{4}/\d{1,2}/\d{1,2}$|^\d{9,}$`)
+	relativeDatePattern  = regexp.MustCompile(`^\d+[dmy]$`)
+	queryOperatorPattern = regexp.MustCompile(`^-?([a-zA-Z_0-9]+):(.*)$`)
+	quotedPhrasePattern  = regexp.MustCompile(`"[^"]*"`)
+)
+
+// Build returns the Gmail query for the filter, or an error naming the first
+// invalid field
+func (f QueryFilter) Build() (string, error) {
+	var terms []string
+	for _, field := range [][2]string{{"from", f.From}, {"to", f.To}} {
+		if term := anyOfTerm(field[0], field[1]); term != "" {
+			terms = append(terms, term)
+		}
+	}
+	if subject := strings.TrimSpace(f.Subject); subject != "" {
+		terms = append(terms, "subject:"+quoteQueryValue(subject))
+	}
+
+	after, before := f.After, f.Before
+	if strings.TrimSpace(f.Range+f.Since) != "" {
+		if strings.TrimSpace(f.After+f.Before) != "" {
+			return "", fmt.Errorf("range and since can't be combined with after or before")
+		}
+		var err error
+		if after, before, err = resolveDates(f.Range, f.Since); err != nil {
+			return "", err
+		}
+	}
+
+	var afterDate, beforeDate time.Time
+	for _, date := range []struct {
+		key    string
+		value  string
+		parsed *time.Time
+	}{{"after", after, &afterDate}, {"before", before, &beforeDate}} {
+		value := strings.ReplaceAll(strings.TrimSpace(date.value), "-", "/")
+		if value == "" {
+			continue
+		}
+		parsed, err := time.Parse("2006/01/02", value)
+		if err != nil {
+			return "", fmt.Errorf("invalid %s date %q: use YYYY/MM/DD", date.key, date.value)
+		}
+		*date.parsed = parsed
+		terms = append(terms, date.key+":"+parsed.Format("2006/01/02"))
+	}
+	if !afterDate.IsZero() && !beforeDate.IsZero() && !afterDate.Before(beforeDate) {
+		return "", fmt.Errorf("after (%s) must be earlier than before (%s)", afterDate.Format("2006/01/02"), beforeDate.Format("2006/01/02"))
+	}
+
+	for _, label := range strings.Split(f.Labels, ",") {
+		if label = strings.TrimSpace(label); label != "" {
+			terms = append(terms, "label:"+queryLabelName(label))
+		}
+	}
+	if f.HasAttachment {
+		terms = append(terms, "has:attachment")
+	}
+	if category := strings.ToLower(strings.TrimSpace(f.Category)); category != "" {
+		if !validCategory(category) {
+			return "", fmt.Errorf("invalid category %q: use %s", f.Category, strings.Join(categoryNames(), ", "))
+		}
+		terms = append(terms, "category:"+category)
+	}
+	if text := strings.TrimSpace(f.Text); text != "" {
+		if problems := lintQuery(text); len(problems) > 0 {
+			return "", fmt.Errorf("invalid text %q: %s", text, strings.Join(problems, "; "))
+		}
+		terms = append(terms, text)
+	}
+
+	if len(terms) == 0 {
+		return "", fmt.Errorf("no filters given")
+	}
+	return strings.Join(terms, " "), nil
+}
+
+// anyOfTerm builds "from:a" or "from:(a OR b)" from a comma-separated list
+func anyOfTerm(operator, values string) string {
+	var quoted []string
+	for _, value := range strings.Split(values, ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			quoted = append(quoted, quoteQueryValue(value))
+		}
+	}
+	switch len(quoted) {
+	case 0:
+		return ""
+	case 1:
+		return operator + ":" + quoted[0]
+	}
+	return operator + ":(" + strings.Join(quoted, " OR ") + ")"
+}
+
+// quoteQueryValue quotes values with spaces or search syntax in them as a phrase
+func quoteQueryValue(value string) string {
+	if !strings.ContainsAny(value, " \t(){}\"") {
+		return value
+	}
+	return `"` + strings.ReplaceAll(value, `"`, "") + `"`
+}
+
+// queryLabelName writes a label the way Gmail search expects: lowercase, with
+// spaces and nesting slashes as hyphens
+func queryLabelName(label string) string {
+	return strings.NewReplacer(" ", "-", "/", "-").Replace(strings.ToLower(label))
+}
+
+// invalidQueryError is the invalid_query error for a query Gmail would misread or
+// rejected, listing the problems so agents can tell it apart from a query that
+// simply matches nothing
+func invalidQueryError(query string, problems []string) *mcp.CallToolResult {
+	err := toolerr.New(toolerr.InvalidInput, "invalid_query", fmt.Sprintf("Invalid query %q: %s", query, strings.Join(problems, "; ")))
+	err.Details = map[string]interface{}{"query": query, "problems": problems}
+	return err.WithHint("Fix the query as the problems describe; build_query can build a valid one.").Result()
+}
+
+// lintQuery lists the mistakes in a Gmail query that make Gmail silently match
+// the wrong mail: unknown operators, malformed or conflicting dates, lowercase
+// or/and, and unbalanced quotes or parentheses
+func lintQuery(query string) []string {
+	var problems []string
+	// after: and before: outside parentheses must both hold, so they must leave a range
+	var after, before time.Time
+	if strings.Count(query, `"`)%2 != 0 {
+		problems = append(problems, "unbalanced double quote")
+	}
+
+	depth := 0
+	for _, token := range queryTokens(query) {
+		unquoted := quotedPhrasePattern.ReplaceAllString(token, "")
+		depth += strings.Count(unquoted, "(") - strings.Count(unquoted, ")")
+		if depth < 0 {
+			problems = append(problems, "closing parenthesis without an opening one")
+			depth = 0
+		}
+		if strings.HasPrefix(token, `"`) {
+			continue
+		}
+		if token == "or" || token == "and" {
+			problems = append(problems, fmt.Sprintf("%q is searched as a word; use uppercase %s", token, strings.ToUpper(token)))
+			continue
+		}
+
+		match := queryOperatorPattern.FindStringSubmatch(strings.TrimLeft(token, "("))
+		if match == nil {
+			continue
+		}
+		operator, value := strings.ToLower(match[1]), strings.Trim(match[2], `()"`)
+		if !gmailOperators[operator] {
+			if suggestion, ok := operatorSuggestions[operator]; ok {
+				problems = append(problems, fmt.Sprintf("unknown operator %q; use %s", operator+":", suggestion))
+			} else if !strings.HasPrefix(match[2], "//") {
+				// URLs like https://example.com are fine as text
+				problems = append(problems, fmt.Sprintf("unknown operator %q", operator+":"))
+			}
+			continue
+		}
+		if value == "" && !strings.HasPrefix(match[2], "(") && !strings.HasPrefix(match[2], `"`) {
+			problems = append(problems, fmt.Sprintf("%q has no value", operator+":"))
+			continue
+		}
+		switch operator {
+		case "after", "before", "older", "newer":
+			if value != "" && !queryDatePattern.MatchString(value) {
+				problems = append(problems, fmt.Sprintf("%s:%s is not a date; use YYYY/MM/DD", operator, value))
+				continue
+			}
+			date, err := time.Parse("2006/1/2", value)
+			if err != nil || depth != 0 || strings.ContainsAny(token, "()") || strings.HasPrefix(token, "-") {
+				continue
+			}
+			if operator == "after" || operator == "newer" {
+				after = date
+			} else {
+				before = date
+			}
+		case "category":
+			if value != "" && !searchCategories[strings.ToLower(value)] {
+				problems = append(problems, fmt.Sprintf("category:%s is not an inbox tab; use %s", value, strings.Join(categoryNames(), ", ")))
+			}
+		case "older_than", "newer_than":
+			if value != "" && !relativeDatePattern.MatchString(value) {
+				problems = append(problems, fmt.Sprintf("%s:%s must be a number followed by d, m or y (e.g. 7d)", operator, value))
+			}
+		}
+	}
+	if depth > 0 {
+		problems = append(problems, "unclosed parenthesis")
+	}
+	if !after.IsZero() && !before.IsZero() && !after.Before(before) {
+		problems = append(problems, fmt.Sprintf("after:%s is not earlier than before:%s, so nothing can match", after.Format("2006/01/02"), before.Format("2006/01/02")))
+	}
+	return problems
+}
+
+// queryTokens splits a query on whitespace, keeping quoted phrases (and an
+// operator directly before one, like subject:"a b") as single tokens
+func queryTokens(query string) []string {
+	var tokens []string
+	var current strings.Builder
+	inQuotes := false
+	for _, r := range query {
+		switch {
+		case r == '"':
+			inQuotes = !inQuotes
+			current.WriteRune(r)
+		case !inQuotes && (r == ' ' || r == '\t' || r == '\n'):
+			if current.Len() > 0 {
+				tokens = append(tokens, current.String())
+				current.Reset()
+			}
+		default:
+			current.WriteRune(r)
+		}
+	}
+	if current.Len() > 0 {
+		tokens = append(tokens, current.String())
+	}
+	return tokens
+}
+
+// BuildQuery turns structured filters into a Gmail query. With validate it also
+// checks the labels exist and dry-runs the query to count matching messages; a
+// non-empty rawQuery is validated as given instead of building one.
+func (g *GmailServer) BuildQuery(ctx context.Context, filter QueryFilter, rawQuery string, validate bool) (*mcp.CallToolResult, error) {
+	query := strings.TrimSpace(rawQuery)
+	var problems []string
+	if query == "" {
+		built, err := filter.Build()
+		if err != nil {
+			return toolerr.Result(err, "Could not build query"), nil
+		}
+		query = built
+	} else {
+		problems = lintQuery(query)
+	}
+
+	result := map[string]interface{}{
+		"query": query,
+		"valid": len(problems) == 0,
+	}
+	if len(problems) > 0 {
+		result["problems"] = problems
+	}
+	if queryHasDates(query) {
+		// Dates are sent to Gmail as midnight in this zone rather than Gmail's Pacific time
+		result["timeZone"] = config.TimeZone().String()
+	}
+
+	if validate {
+		if missing, err := g.missingQueryLabels(ctx, query); err != nil {
+			log.Printf("Warning: Failed to list labels to validate query: %v", err)
+		} else if len(missing) > 0 {
+			result["valid"] = false
+			result["labelsNotFound"] = missing
+		}
+
+		messages, err := g.client.ListMessages(ctx, query, maxQueryDryRun)
+		if err != nil {
+			return toolerr.Result(err, fmt.Sprintf("Gmail rejected the query %q", query)), nil
+		}
+		result["messageCount"] = len(messages.Messages)
+		if len(messages.Messages) >= maxQueryDryRun {
+			result["note"] = fmt.Sprintf("At least %d messages match; only the first %d were counted", maxQueryDryRun, maxQueryDryRun)
+		}
+		if messages.ResultSizeEstimate > 0 {
+			result["resultSizeEstimate"] = messages.ResultSizeEstimate
+		}
+	}
+
+	resultJSON, _ := json.MarshalIndent(result, "", "  ")
+	return mcp.NewToolResultText(string(resultJSON)), nil
+}
+
+// queryHasDates reports whether query has after:/before: operators
+func queryHasDates(query string) bool {
+	for _, token := range queryTokens(query) {
+		if match := queryOperatorPattern.FindStringSubmatch(token); match != nil {
+			switch strings.ToLower(match[1]) {
+			case "after", "before", "older", "newer":
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// missingQueryLabels returns the label: values in query that match none of the
+// mailbox's labels
+func (g *GmailServer) missingQueryLabels(ctx context.Context, query string) ([]string, error) {
+	var wanted []string
+	for _, token := range queryTokens(query) {
+		match := queryOperatorPattern.FindStringSubmatch(strings.TrimLeft(token, "("))
+		if match != nil && strings.EqualFold(match[1], "label") {
+			if value := strings.Trim(match[2], `()"`); value != "" {
+				wanted = append(wanted, value)
+			}
+		}
+	}
+	if len(wanted) == 0 {
+		return nil, nil
+	}
+
+	labels, err := g.client.ListLabels(ctx)
+	if err != nil {
+		return nil, err
+	}
+	known := map[string]bool{}
+	for _, label := range labels.Labels {
+		known[queryLabelName(label.Name)] = true
+		known[queryLabelName(label.Id)] = true
+	}
+	var missing []string
+	for _, label := range wanted {
+		if !known[queryLabelName(label)] {
+			missing = append(missing, label)
+		}
+	}
+	return missing, nil
+}
+
+// CountMatches returns Gmail's estimate of how many threads and messages match query
+// without fetching any of them, so a fetch can be scoped first
+func (g *GmailServer) CountMatches(ctx context.Context, query string) (*mcp.CallToolResult, error) {
+	query = strings.TrimSpace(query)
+	if problems := lintQuery(query); len(problems) > 0 {
+		return invalidQueryError(query, problems), nil
+	}
+
+	threads, err := g.client.ListThreads(ctx, query, 1)
+	if err != nil {
+		return toolerr.Result(err, "Failed to count threads"), nil
+	}
+	messages, err := g.client.ListMessages(ctx, query, 1)
+	if err != nil {
+		return toolerr.Result(err, "Failed to count messages"), nil
+	}
+
+	result := map[string]interface{}{
+		"query":           query,
+		"threadEstimate":  threads.ResultSizeEstimate,
+		"messageEstimate": messages.ResultSizeEstimate,
+	}
+	switch {
+	case threads.ResultSizeEstimate == 0:
+		result["note"] = "No matches; try a broader query"
+	case threads.ResultSizeEstimate > broadQueryThreads:
+		result["note"] = fmt.Sprintf("About %d threads match; refine the query (e.g. a date range, sender or label) before fetching", threads.ResultSizeEstimate)
+	}
+	if stale := staleAsOf(threads.ServerResponse); stale != "" {
+		result["staleAsOf"] = stale
+	}
+
+	resultJSON, _ := json.MarshalIndent(result, "", "  ")
+	return mcp.NewToolResultText(string(resultJSON)), nil
+}
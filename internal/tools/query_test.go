@@ -0,0 +1,98 @@
+package tools
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestQueryFilterBuild(t *testing.T) {
+	tests := []struct {
+		name    string
+		filter  QueryFilter
+		want    string
+		wantErr string
+	}{
+		{"one sender", QueryFilter{From: "alice@example.com"}, "from:alice@example.com", ""},
+		{"name with a space is quoted", QueryFilter{From: "Alice Example"}, `from:"Alice Example"`, ""},
+		{"any of several recipients", QueryFilter{To: "alice@example.com, Bob Smith,"}, `to:(alice@example.com OR "Bob Smith")`, ""},
+		{"subject with quotes and parentheses", QueryFilter{Subject: `Re: "Q3" (draft)`}, `subject:"Re: Q3 (draft)"`, ""},
+		{"plain subject", QueryFilter{Subject: "invoice"}, "subject:invoice", ""},
+		{"nested label", QueryFilter{Labels: "Clients/Acme Corp, todo"}, "label:clients-acme-corp label:todo", ""},
+		{"dates with dashes", QueryFilter{After: "2026-01-05", Before: "2026/02/01"}, "after:2026/01/05 before:2026/02/01", ""},
+		{"attachment and text", QueryFilter{HasAttachment: true, Text: "is:unread -in:chats"}, "has:attachment is:unread -in:chats", ""},
+		{"category tab", QueryFilter{Category: " Promotions "}, "category:promotions", ""},
+		{"all fields in order", QueryFilter{From: "a@example.com", Subject: "hi", Before: "2026/03/01", Labels: "x", Category: "updates"}, "from:a@example.com subject:hi before:2026/03/01 label:x category:updates", ""},
+		{"after equals before", QueryFilter{After: "2026/01/05", Before: "2026/01/05"}, "", "must be earlier than before"},
+		{"after later than before", QueryFilter{After: "2026/02/01", Before: "2026/01/01"}, "", "must be earlier than before"},
+		{"invalid date", QueryFilter{After: "last week"}, "", `invalid after date "last week"`},
+		{"range with after", QueryFilter{Range: "yesterday", After: "2026/01/01"}, "", "can't be combined"},
+		{"unknown category", QueryFilter{Category: "spam"}, "", `invalid category "spam"`},
+		{"smart category isn't a tab", QueryFilter{Category: "purchases"}, "", `invalid category "purchases"`},
+		{"unknown operator in text", QueryFilter{Text: "sender:alice"}, "", `unknown operator "sender:"; use from:`},
+		{"no filters", QueryFilter{From: " , "}, "", "no filters given"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.filter.Build()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("Build() = %q, %v, want an error mentioning %q", got, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("Build() = %q, %v, want %q", got, err, tt.want)
+			}
+			if problems := lintQuery(got); len(problems) > 0 {
+				t.Errorf("Build() = %q, which lints with %v", got, problems)
+			}
+		})
+	}
+}
+
+func TestLintQuery(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		// want are substrings of the expected problems, in order; none for a clean query
+		want []string
+	}{
+		{"plain words", "quarterly report", nil},
+		{"operators", `from:alice@example.com subject:"Q3 plan" has:attachment -in:chats`, nil},
+		{"grouped alternatives", "from:(alice OR bob) (label:work OR is:starred)", nil},
+		{"quoted phrase closing a group", `to:(alice OR "Bob Smith") "(not a group"`, nil},
+		{"url as text", "https://example.com/pay", nil},
+		{"dates in range", "after:2026/01/01 before:2026/02/01 older_than:7d", nil},
+		{"epoch dates", "after:1767225600 before:1769904000", nil},
+		{"category tab", "category:promotions", nil},
+		{"smart category", "category:purchases", nil},
+		{"unknown category", "category:spam", []string{"category:spam is not an inbox tab"}},
+		{"invented operator", "sender:alice", []string{`unknown operator "sender:"; use from:`}},
+		{"unknown operator", "foo:bar", []string{`unknown operator "foo:"`}},
+		{"operator without a value", "subject: invoice", []string{`"subject:" has no value`}},
+		{"word date", "after:yesterday", []string{"after:yesterday is not a date"}},
+		{"relative date unit", "newer_than:7days", []string{"newer_than:7days must be a number"}},
+		{"same after and before", "after:2026/01/05 before:2026/01/05", []string{"after:2026/01/05 is not earlier than before:2026/01/05"}},
+		{"after later than before", "before:2026/01/01 from:alice after:2026/02/01", []string{"after:2026/02/01 is not earlier than before:2026/01/01"}},
+		{"alternative dates aren't a conflict", "(after:2026/02/01 OR before:2026/01/01)", nil},
+		{"excluded date isn't a conflict", "after:2026/02/01 -before:2026/01/01", nil},
+		{"lowercase or", "from:alice or from:bob", []string{`"or" is searched as a word; use uppercase OR`}},
+		{"unbalanced quote", `subject:"Q3 plan`, []string{"unbalanced double quote"}},
+		{"unclosed parenthesis", "from:(alice OR bob", []string{"unclosed parenthesis"}},
+		{"stray parenthesis", "alice) bob", []string{"closing parenthesis without an opening one"}},
+		{"several problems", "date:2026 and foo:bar", []string{`unknown operator "date:"; use after:/before:`, `"and" is searched as a word`, `unknown operator "foo:"`}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			problems := lintQuery(tt.query)
+			if len(problems) != len(tt.want) {
+				t.Fatalf("lintQuery(%q) = %q, want %d problem(s) %q", tt.query, problems, len(tt.want), tt.want)
+			}
+			for i, want := range tt.want {
+				if !strings.Contains(problems[i], want) {
+					t.Errorf("lintQuery(%q) problem %d = %q, want it to mention %q", tt.query, i, problems[i], want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,205 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/mail"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"google.golang.org/api/gmail/v1"
+
+	"auto-gmail/internal/config"
+	"auto-gmail/internal/toolerr"
+)
+
+// Question scan limits
+const (
+	defaultQuestionDays = 7
+	maxQuestionDays     = 30
+	// maxQuestionScan caps how many threads unanswered_questions reads
+	maxQuestionScan = 100
+	// questionChars caps each question quoted
+	questionChars = 300
+)
+
+var (
+	// boilerplateQuestionPattern matches stock questions that expect no answer, as in
+	// "Questions? Contact us" footers and marketing copy
+	boilerplateQuestionPattern = regexp.MustCompile(`(?i)^(?:any |have (?:any )?|got )?(?:questions|comments|thoughts or questions|feedback)\??$|^(?:need (?:more )?help|want to (?:learn|know) more|why wait|did you know|ready to get started|not interested|looking for [^?]{0,40}|having trouble [^?]{0,60})\?$`)
+	// directedQuestionPattern marks a question asked of the reader: it names them or
+	// asks them to do or decide something
+	directedQuestionPattern = regexp.MustCompile(`(?i)\b(?:you|your|yours|u)\b|^(?:can|could|would|will|should|shall|do|did|does|are|is|have|has|any|when|what|where|which|who|how|why|thoughts|ok|okay)\b`)
+)
+
+// openQuestion is a message's questions to the user that no reply of theirs followed
+type openQuestion struct {
+	ThreadID  string   `json:"threadId"`
+	MessageID string   `json:"messageId"`
+	Subject   string   `json:"subject"`
+	From      string   `json:"from"`
+	Date      string   `json:"date"`
+	Waiting   string   `json:"waiting"`
+	Questions []string `json:"questions"`
+	Link      string   `json:"link,omitempty"`
+
+	received int64
+}
+
+// UnansweredQuestions lists the explicit questions people asked the user in recent
+// inbox mail and that the user hasn't replied to since: each with the sender, how long
+// it has waited and a link to the thread, oldest first. Only mail sent to the user in
+// To counts; questions put to someone else by name, stock footer questions and
+// automated mail are left out.
+func (g *GmailServer) UnansweredQuestions(ctx context.Context, days int, query string) (*mcp.CallToolResult, error) {
+	if days <= 0 {
+		days = defaultQuestionDays
+	}
+	if days > maxQuestionDays {
+		return toolerr.Invalid(fmt.Sprintf("Maximum %d days allowed per request", maxQuestionDays)), nil
+	}
+	query = strings.TrimSpace(query)
+	if query != "" {
+		if problems := lintQuery(query); len(problems) > 0 {
+			return invalidQueryError(query, problems), nil
+		}
+	}
+	search := strings.TrimSpace(fmt.Sprintf("in:inbox newer_than:%dd -category:promotions -category:social %s", days, query))
+
+	listed, err := g.client.ListThreads(ctx, search, maxQuestionScan)
+	if err != nil {
+		return toolerr.Result(err, "Failed to search threads"), nil
+	}
+	hydrated := g.hydrateThreads(ctx, listed.Threads)
+	me := g.userEmail(ctx)
+
+	open := []openQuestion{}
+	total := 0
+	for _, thread := range listed.Threads {
+		detail, ok := hydrated[thread.Id]
+		if !ok {
+			continue
+		}
+		for _, q := range threadOpenQuestions(detail, me) {
+			total += len(q.Questions)
+			open = append(open, q)
+		}
+	}
+	sort.SliceStable(open, func(i, j int) bool { return open[i].received < open[j].received })
+
+	result := map[string]interface{}{
+		"query":          search,
+		"threadsScanned": len(listed.Threads),
+		"questionCount":  total,
+		"messages":       open,
+	}
+	if len(open) == 0 {
+		result["note"] = "No unanswered questions to you in this period."
+	}
+	if len(listed.Threads) >= maxQuestionScan {
+		result["truncated"] = fmt.Sprintf("Only the %d most recent threads were checked; use fewer days or a query for the rest.", maxQuestionScan)
+	}
+	resultJSON, _ := json.MarshalIndent(result, "", "  ")
+	return mcp.NewToolResultText(string(resultJSON)), nil
+}
+
+// threadOpenQuestions finds the questions to the user in the messages after their
+// last reply in a thread
+func threadOpenQuestions(thread *gmail.Thread, me string) []openQuestion {
+	messages := make([]*gmail.Message, 0, len(thread.Messages))
+	for _, message := range thread.Messages {
+		if message.Payload != nil && !hasLabelID(message, "DRAFT") {
+			messages = append(messages, message)
+		}
+	}
+	sort.SliceStable(messages, func(i, j int) bool { return messages[i].InternalDate < messages[j].InternalDate })
+
+	var open []openQuestion
+	for _, message := range messages {
+		from := messageHeader(message, "From")
+		if hasLabelID(message, "SENT") || (me != "" && strings.EqualFold(senderAddress(from), me)) {
+			// The user replied; what came before is answered
+			open = nil
+			continue
+		}
+		if isAutomated(message) || isAutoReply(message) || (me != "" && !addressedTo(messageHeader(message, "To"), me)) {
+			continue
+		}
+		questions := directedQuestions(message, me)
+		if len(questions) == 0 {
+			continue
+		}
+		subject := stripSubjectPrefixes(messageHeader(message, "Subject"))
+		if subject == "" {
+			subject = "(no subject)"
+		}
+		q := openQuestion{
+			ThreadID:  thread.Id,
+			MessageID: message.Id,
+			Subject:   subject,
+			From:      from,
+			Date:      formatInternalDate(message.InternalDate),
+			Waiting:   waitingTime(time.Since(time.UnixMilli(message.InternalDate))),
+			Questions: questions,
+			received:  message.InternalDate,
+		}
+		if config.Provider() == "gmail" {
+			q.Link = "https://mail.google.com/mail/#all/" + thread.Id
+		}
+		open = append(open, q)
+	}
+	return open
+}
+
+// directedQuestions are the questions in a message that are put to the reader:
+// ones that say "you" or ask something outright, without stock footer questions or
+// ones addressed by name to another recipient ("Sam, can you check?")
+func directedQuestions(message *gmail.Message, me string) []string {
+	others := otherRecipientNames(message, me)
+	var questions []string
+	for _, question := range messageQuestions(message) {
+		if boilerplateQuestionPattern.MatchString(question) || !directedQuestionPattern.MatchString(question) {
+			continue
+		}
+		lower := strings.ToLower(question)
+		addressedElsewhere := false
+		for _, name := range others {
+			if strings.HasPrefix(lower, name+",") || strings.HasPrefix(lower, "@"+name) {
+				addressedElsewhere = true
+				break
+			}
+		}
+		if addressedElsewhere {
+			continue
+		}
+		if len(question) > questionChars {
+			question = truncateText(question, questionChars) + "…"
+		}
+		questions = append(questions, question)
+	}
+	return questions
+}
+
+// otherRecipientNames are the lowercase first names of a message's other recipients
+func otherRecipientNames(message *gmail.Message, me string) []string {
+	var names []string
+	for _, field := range []string{"To", "Cc"} {
+		addresses, err := mail.ParseAddressList(messageHeader(message, field))
+		if err != nil {
+			continue
+		}
+		for _, addr := range addresses {
+			if strings.EqualFold(addr.Address, me) {
+				continue
+			}
+			if fields := strings.Fields(addr.Name); len(fields) > 0 {
+				names = append(names, strings.ToLower(strings.Trim(fields[0], `"',`)))
+			}
+		}
+	}
+	return names
+}
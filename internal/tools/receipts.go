@@ -0,0 +1,227 @@
+package tools
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"log"
+	"math"
+	"net/mail"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"auto-gmail/internal/config"
+	"auto-gmail/internal/extract"
+	"auto-gmail/internal/toolerr"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"google.golang.org/api/gmail/v1"
+)
+
+// receiptKeywords are the subject words searched for billing emails, one query each
+var receiptKeywords = []string{"receipt", "invoice", "order", "payment", "billing"}
+
+// totalLabels are amount labels in order of preference for a receipt's total
+var totalLabels = []string{"grand total", "total due", "amount due", "balance due", "total", "paid"}
+
+// receiptColumns are the CSV columns of collect_receipts, in order
+var receiptColumns = []string{"date", "vendor", "amount", "currency", "reference", "subject", "source", "messageId"}
+
+// receipt is one row of the expense report
+type receipt struct {
+	Date      string  `json:"date"`
+	Vendor    string  `json:"vendor"`
+	Amount    float64 `json:"amount"`
+	Currency  string  `json:"currency"`
+	Reference string  `json:"reference,omitempty"`
+	Subject   string  `json:"subject"`
+	Source    string  `json:"source"`
+	MessageID string  `json:"messageId"`
+}
+
+// CollectReceipts finds billing emails between after and before (YYYY/MM/DD), extracts
+// the vendor, total and date of each from the body or, with includeAttachments, from
+// attached invoices, and returns them as an expense report in JSON or CSV
+func (g *GmailServer) CollectReceipts(ctx context.Context, after, before, format string, includeAttachments bool, maxResults int) (*mcp.CallToolResult, error) {
+	if maxResults <= 0 {
+		maxResults = 100
+	}
+	if format != "csv" {
+		format = "json"
+	}
+
+	dateTerms, err := dateRangeTerms(after, before, "newer_than:30d")
+	if err != nil {
+		return toolerr.Result(err, ""), nil
+	}
+	messageIDs, err := g.subjectKeywordMessages(ctx, receiptKeywords, dateTerms, maxResults)
+	if err != nil {
+		return toolerr.Result(err, "Failed to search billing emails"), nil
+	}
+	messages := g.hydrateMessages(ctx, messageIDs)
+
+	receipts := []receipt{}
+	var withoutAmount []string
+	for _, id := range messageIDs {
+		message, ok := messages[id]
+		if !ok || hasLabelID(message, "SENT") {
+			continue
+		}
+		row, found := g.receiptFor(ctx, message, includeAttachments)
+		if !found {
+			withoutAmount = append(withoutAmount, id)
+			continue
+		}
+		receipts = append(receipts, row)
+	}
+	sort.SliceStable(receipts, func(i, j int) bool {
+		return receipts[i].Date < receipts[j].Date
+	})
+
+	totals := map[string]float64{}
+	for _, row := range receipts {
+		totals[row.Currency] = math.Round((totals[row.Currency]+row.Amount)*100) / 100
+	}
+
+	if format == "csv" {
+		var sb strings.Builder
+		w := csv.NewWriter(&sb)
+		w.Write(receiptColumns)
+		for _, row := range receipts {
+			w.Write([]string{row.Date, row.Vendor, strconv.FormatFloat(row.Amount, 'f', 2, 64), row.Currency, row.Reference, row.Subject, row.Source, row.MessageID})
+		}
+		w.Flush()
+		return mcp.NewToolResultText(sb.String()), nil
+	}
+
+	result := map[string]interface{}{
+		"query":           strings.Join(dateTerms, " "),
+		"messagesScanned": len(messageIDs),
+		"receiptCount":    len(receipts),
+		"totals":          totals,
+		"receipts":        receipts,
+	}
+	if len(withoutAmount) > 0 {
+		result["withoutAmount"] = withoutAmount
+		result["note"] = "Messages in withoutAmount looked like billing emails but no amount was found; try extract_entities with refine or on their attachments."
+	}
+
+	resultJSON, _ := json.MarshalIndent(result, "", "  ")
+	return mcp.NewToolResultText(string(resultJSON)), nil
+}
+
+// dateRangeTerms turns after/before dates (YYYY/MM/DD or YYYY-MM-DD) into Gmail
+// search terms, using fallback when neither is set
+func dateRangeTerms(after, before, fallback string) ([]string, error) {
+	var terms []string
+	for _, date := range [][2]string{{"after", after}, {"before", before}} {
+		key, value := date[0], strings.ReplaceAll(date[1], "-", "/")
+		if value == "" {
+			continue
+		}
+		if _, err := time.Parse("2006/01/02", value); err != nil {
+			return nil, toolerr.Errorf(toolerr.InvalidInput, "invalid_date", "Invalid %s date %q: use YYYY/MM/DD", key, date[1])
+		}
+		terms = append(terms, key+":"+value)
+	}
+	if len(terms) == 0 {
+		terms = []string{fallback}
+	}
+	return terms, nil
+}
+
+// subjectKeywordMessages returns up to max IDs of messages whose subject contains
+// any of keywords, one search per keyword, narrowed by the extra search terms
+func (g *GmailServer) subjectKeywordMessages(ctx context.Context, keywords, terms []string, max int) ([]string, error) {
+	var messageIDs []string
+	seen := map[string]bool{}
+	for _, keyword := range keywords {
+		query := strings.Join(append([]string{"subject:" + keyword}, terms...), " ")
+		list, err := g.client.ListMessages(ctx, query, int64(max))
+		if err != nil {
+			return nil, err
+		}
+		for _, msg := range list.Messages {
+			if !seen[msg.Id] && len(messageIDs) < max {
+				seen[msg.Id] = true
+				messageIDs = append(messageIDs, msg.Id)
+			}
+		}
+	}
+	return messageIDs, nil
+}
+
+// receiptFor builds an expense row for a billing email, preferring the body and
+// falling back to attachments; found is false when no amount was found
+func (g *GmailServer) receiptFor(ctx context.Context, message *gmail.Message, includeAttachments bool) (receipt, bool) {
+	row := receipt{
+		Date:      time.UnixMilli(message.InternalDate).In(config.TimeZone()).Format("2006-01-02"),
+		Vendor:    vendorName(messageHeader(message, "From")),
+		Subject:   messageHeader(message, "Subject"),
+		Source:    "body",
+		MessageID: message.Id,
+	}
+
+	entities := extract.ExtractEntities(extract.EmailBody(message))
+	amount, ok := receiptTotal(entities.Amounts)
+	if !ok && includeAttachments {
+		for _, attachment := range extract.AttachmentInfo(message) {
+			filename := attachment["filename"].(string)
+			text, err := g.attachmentText(ctx, message, filename)
+			if err != nil {
+				log.Printf("Warning: Could not read attachment %s of message %s: %v", filename, message.Id, err)
+				continue
+			}
+			entities = extract.ExtractEntities(text)
+			if amount, ok = receiptTotal(entities.Amounts); ok {
+				row.Source = "attachment: " + filename
+				break
+			}
+		}
+	}
+	if !ok {
+		return row, false
+	}
+
+	row.Amount, row.Currency = amount.Value, amount.Currency
+	for _, ref := range entities.References {
+		if ref.Kind == "invoice" || row.Reference == "" {
+			row.Reference = ref.Value
+		}
+	}
+	return row, true
+}
+
+// receiptTotal picks the amount that is most likely a receipt's total: the best
+// labeled one, or else the largest
+func receiptTotal(amounts []extract.Amount) (extract.Amount, bool) {
+	for _, label := range totalLabels {
+		for _, amount := range amounts {
+			if amount.Label == label {
+				return amount, true
+			}
+		}
+	}
+	var largest extract.Amount
+	for _, amount := range amounts {
+		if amount.Value > largest.Value {
+			largest = amount
+		}
+	}
+	return largest, largest.Value > 0
+}
+
+// vendorName is the display name of a From header, or the sender's domain when there is none
+func vendorName(from string) string {
+	addr, err := mail.ParseAddress(from)
+	if err != nil {
+		return from
+	}
+	if addr.Name != "" {
+		return addr.Name
+	}
+	_, domain, _ := strings.Cut(addr.Address, "@")
+	return domain
+}
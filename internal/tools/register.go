@@ -0,0 +1,2215 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"auto-gmail/internal/config"
+	"auto-gmail/internal/i18n"
+	"auto-gmail/internal/llm"
+	"auto-gmail/internal/style"
+	"auto-gmail/internal/telemetry"
+	"auto-gmail/internal/toolerr"
+	"auto-gmail/internal/update"
+	"auto-gmail/internal/usage"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// Servers resolves the Mailbox a request acts on. *GmailServerPool is the usual
+// implementation; library users can supply their own.
+type Servers interface {
+	// ServerFor returns the caller's mailbox, or an error when they have none
+	ServerFor(ctx context.Context) (Mailbox, error)
+	// ForRequest returns the caller's authenticated mailbox, or the error result to return instead
+	ForRequest(ctx context.Context) (Mailbox, *mcp.CallToolResult)
+}
+
+// ToolAdder is where tools are registered: a *server.MCPServer, or one wrapped by
+// WithMiddleware
+type ToolAdder interface {
+	AddTool(tool mcp.Tool, handler server.ToolHandlerFunc)
+}
+
+// middlewareAdder wraps every handler added through it
+type middlewareAdder struct {
+	next       ToolAdder
+	middleware []server.ToolHandlerMiddleware
+}
+
+// WithMiddleware returns a ToolAdder that wraps each tool's handler in middleware
+// (the first one outermost) before adding it to adder, e.g. to log or authorize
+// only a subset of the tools
+func WithMiddleware(adder ToolAdder, middleware ...server.ToolHandlerMiddleware) ToolAdder {
+	return &middlewareAdder{next: adder, middleware: middleware}
+}
+
+// AddTool adds tool with its handler wrapped in the middleware
+func (m *middlewareAdder) AddTool(tool mcp.Tool, handler server.ToolHandlerFunc) {
+	for i := len(m.middleware) - 1; i >= 0; i-- {
+		handler = m.middleware[i](handler)
+	}
+	m.next.AddTool(tool, handler)
+}
+
+// Register adds all the Gmail resources, prompts and tools to mcpServer.
+// Every handler resolves the caller's GmailServer through gmailServers.
+func Register(mcpServer *server.MCPServer, gmailServers Servers) {
+	RegisterResources(mcpServer, gmailServers)
+	RegisterPrompts(mcpServer, gmailServers)
+	RegisterTools(mcpServer, gmailServers)
+}
+
+// RegisterTools adds every tool group to adder
+func RegisterTools(adder ToolAdder, gmailServers Servers) {
+	RegisterAuthTools(adder, gmailServers)
+	RegisterSearchTools(adder, gmailServers)
+	RegisterDraftTools(adder, gmailServers)
+	RegisterAttachmentTools(adder, gmailServers)
+	RegisterLabelTools(adder, gmailServers)
+	RegisterAITools(adder, gmailServers)
+	RegisterInsightTools(adder, gmailServers)
+	RegisterStyleTools(adder, gmailServers)
+	RegisterMemoryTools(adder, gmailServers)
+}
+
+// RegisterResources adds the style guide, memory, contact context, style example and smart view resources
+func RegisterResources(mcpServer *server.MCPServer, gmailServers Servers) {
+	// Add email tone resource
+	toneResource := mcp.NewResource(
+		"file://personal-email-style-guide",
+		"Personal Email Style Guide",
+		mcp.WithResourceDescription("Instructions on how to write emails in the user's personal style and tone"),
+		mcp.WithMIMEType("text/markdown"),
+	)
+
+	mcpServer.AddResource(toneResource, func(ctx context.Context, request mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+		gmailServer, err := gmailServers.ServerFor(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		// Try to read from personal-email-style-guide.md file in app data directory
+		toneFilePath := gmailServer.StyleGuideFile()
+		content, err := os.ReadFile(toneFilePath)
+		if err != nil {
+			// If file doesn't exist, try to generate it automatically
+			if os.IsNotExist(err) {
+				if genErr := style.EnsureExists(gmailServer, gmailServer.StyleGuideFile()); genErr != nil {
+					return nil, genErr
+				}
+				// Try reading again after generation
+				content, err = os.ReadFile(toneFilePath)
+				if err != nil {
+					return nil, fmt.Errorf("failed to read generated style guide: %v", err)
+				}
+			} else {
+				return nil, fmt.Errorf("failed to read style guide at %s: %v", toneFilePath, err)
+			}
+		}
+
+		return []mcp.ResourceContents{
+			mcp.TextResourceContents{
+				URI:      "file://personal-email-style-guide",
+				MIMEType: "text/markdown",
+				Text:     string(content),
+			},
+		}, nil
+	})
+
+	// Add memory resource so facts remembered in earlier sessions are available alongside the style guide
+	memoryResource := mcp.NewResource(
+		"gmail://memory",
+		"Remembered Facts",
+		mcp.WithResourceDescription("Facts and preferences agents stored with remember_fact for this mailbox, e.g. how the user likes to handle certain senders"),
+		mcp.WithMIMEType("text/markdown"),
+	)
+
+	mcpServer.AddResource(memoryResource, func(ctx context.Context, request mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+		gmailServer, err := gmailServers.ServerFor(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		content, err := gmailServer.MemoryMarkdown()
+		if err != nil {
+			return nil, err
+		}
+
+		return []mcp.ResourceContents{
+			mcp.TextResourceContents{
+				URI:      "gmail://memory",
+				MIMEType: "text/markdown",
+				Text:     content,
+			},
+		}, nil
+	})
+
+	// Add contact context resource so an agent can gather everything about a correspondent in one read
+	contactTemplate := mcp.NewResourceTemplate(
+		"gmail://contact/{address}/context",
+		"Contact Drafting Context",
+		mcp.WithTemplateDescription("Everything needed to reply to one person: open items (whose turn it is), how the user has written to them before, remembered facts about them, and summaries of recent threads"),
+		mcp.WithTemplateMIMEType("text/markdown"),
+	)
+
+	mcpServer.AddResourceTemplate(contactTemplate, func(ctx context.Context, request mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+		gmailServer, err := gmailServers.ServerFor(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if !gmailServer.IsAuthenticated() {
+			return nil, fmt.Errorf("Gmail is not authenticated; call the authenticate tool first")
+		}
+
+		address, err := ContactAddress(request.Params.Arguments["address"])
+		if err != nil {
+			return nil, err
+		}
+
+		content, err := gmailServer.ContactContext(ctx, address)
+		if err != nil {
+			return nil, err
+		}
+
+		return []mcp.ResourceContents{
+			mcp.TextResourceContents{
+				URI:      request.Params.URI,
+				MIMEType: "text/markdown",
+				Text:     content,
+			},
+		}, nil
+	})
+
+	// Add project status resource so agents can answer "where does X stand" in one read
+	projectTemplate := mcp.NewResourceTemplate(
+		"gmail://project/{name}",
+		"Project Status",
+		mcp.WithTemplateDescription("Merged status of a project tracked with track_project: the latest development, open items on either side, everyone involved, and each related thread's state and latest message"),
+		mcp.WithTemplateMIMEType("text/markdown"),
+	)
+
+	mcpServer.AddResourceTemplate(projectTemplate, func(ctx context.Context, request mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+		gmailServer, err := gmailServers.ServerFor(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if !gmailServer.IsAuthenticated() {
+			return nil, fmt.Errorf("Gmail is not authenticated; call the authenticate tool first")
+		}
+
+		content, err := gmailServer.ProjectStatus(ctx, ProjectName(request.Params.Arguments["name"]))
+		if err != nil {
+			return nil, err
+		}
+
+		return []mcp.ResourceContents{
+			mcp.TextResourceContents{
+				URI:      request.Params.URI,
+				MIMEType: "text/markdown",
+				Text:     content,
+			},
+		}, nil
+	})
+
+	// Add style examples resource so agents can few-shot from the user's real emails
+	styleExamplesTemplate := mcp.NewResourceTemplate(
+		"gmail://style-examples/{scenario}",
+		"Style Examples",
+		mcp.WithTemplateDescription(fmt.Sprintf("The user's best recent sent emails for one scenario (%s), to use as few-shot examples alongside the style guide", strings.Join(StyleScenarioNames(), ", "))),
+		mcp.WithTemplateMIMEType("text/markdown"),
+	)
+
+	mcpServer.AddResourceTemplate(styleExamplesTemplate, func(ctx context.Context, request mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+		gmailServer, err := gmailServers.ServerFor(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if !gmailServer.IsAuthenticated() {
+			return nil, fmt.Errorf("Gmail is not authenticated; call the authenticate tool first")
+		}
+
+		scenario, _ := request.Params.Arguments["scenario"].(string)
+		content, err := gmailServer.StyleExamples(ctx, scenario)
+		if err != nil {
+			return nil, err
+		}
+
+		return []mcp.ResourceContents{
+			mcp.TextResourceContents{
+				URI:      request.Params.URI,
+				MIMEType: "text/markdown",
+				Text:     content,
+			},
+		}, nil
+	})
+
+	// Add smart view resources, each a live listing re-run on every read
+	for _, view := range smartViews {
+		view := view
+		viewResource := mcp.NewResource(
+			view.URI(),
+			"Smart View: "+view.Title,
+			mcp.WithResourceDescription(view.Description),
+			mcp.WithMIMEType("text/markdown"),
+		)
+
+		mcpServer.AddResource(viewResource, func(ctx context.Context, request mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+			gmailServer, err := gmailServers.ServerFor(ctx)
+			if err != nil {
+				return nil, err
+			}
+			if !gmailServer.IsAuthenticated() {
+				return nil, fmt.Errorf("Gmail is not authenticated; call the authenticate tool first")
+			}
+
+			content, err := gmailServer.ViewMarkdown(ctx, view)
+			if err != nil {
+				return nil, err
+			}
+
+			return []mcp.ResourceContents{
+				mcp.TextResourceContents{
+					URI:      view.URI(),
+					MIMEType: "text/markdown",
+					Text:     content,
+				},
+			}, nil
+		})
+	}
+}
+
+// RegisterPrompts adds the administrative and report prompts
+func RegisterPrompts(mcpServer *server.MCPServer, gmailServers Servers) {
+	// Add administrative prompts
+	generateTonePrompt := mcp.NewPrompt(
+		"generate-email-tone",
+		mcp.WithPromptDescription(i18n.T("prompt.generate-email-tone", "Generate email tone personalization by analyzing your sent emails")),
+	)
+
+	mcpServer.AddPrompt(generateTonePrompt, func(ctx context.Context, request mcp.GetPromptRequest) (*mcp.GetPromptResult, error) {
+		// Check that an LLM is configured and allowed
+		if err := llm.Check(); err != nil {
+			return &mcp.GetPromptResult{
+				Messages: []mcp.PromptMessage{
+					mcp.NewPromptMessage(
+						mcp.RoleUser,
+						mcp.NewTextContent(fmt.Sprintf("❌ Cannot generate tone: %v", err)),
+					),
+				},
+			}, nil
+		}
+
+		// Generate tone personalization
+		gmailServer, err := gmailServers.ServerFor(ctx)
+		if err == nil {
+			err = style.Generate(gmailServer, gmailServer.StyleGuideFile())
+		}
+		if err != nil {
+			return &mcp.GetPromptResult{
+				Messages: []mcp.PromptMessage{
+					mcp.NewPromptMessage(
+						mcp.RoleUser,
+						mcp.NewTextContent(fmt.Sprintf("❌ Failed to generate tone: %v", err)),
+					),
+				},
+			}, nil
+		}
+
+		toneFilePath := gmailServer.StyleGuideFile()
+		return &mcp.GetPromptResult{
+			Messages: []mcp.PromptMessage{
+				mcp.NewPromptMessage(
+					mcp.RoleUser,
+					mcp.NewTextContent(fmt.Sprintf("✅ Successfully generated personal email style guide at: %s\n\nYou can now use the file://personal-email-style-guide resource for personalized email writing.", toneFilePath)),
+				),
+			},
+		}, nil
+	})
+
+	authenticatePrompt := mcp.NewPrompt(
+		"authenticate",
+		mcp.WithPromptDescription(i18n.T("prompt.authenticate", "Connect the server to your Gmail account (starts the Google sign-in flow)")),
+	)
+
+	mcpServer.AddPrompt(authenticatePrompt, func(ctx context.Context, request mcp.GetPromptRequest) (*mcp.GetPromptResult, error) {
+		message := "✅ Gmail is already authenticated."
+		gmailServer, err := gmailServers.ServerFor(ctx)
+		if err != nil {
+			message = fmt.Sprintf("❌ %v", err)
+		} else if !gmailServer.IsAuthenticated() {
+			authURL, err := gmailServer.StartAuthentication()
+			if err != nil {
+				message = fmt.Sprintf("❌ Failed to start authentication: %v", err)
+			} else {
+				message = authURLMessage(authURL)
+			}
+		}
+
+		return &mcp.GetPromptResult{
+			Messages: []mcp.PromptMessage{
+				mcp.NewPromptMessage(
+					mcp.RoleUser,
+					mcp.NewTextContent(message),
+				),
+			},
+		}, nil
+	})
+
+	statusPrompt := mcp.NewPrompt(
+		"server-status",
+		mcp.WithPromptDescription(i18n.T("prompt.server-status", "Show Gmail MCP server status and file locations")),
+	)
+
+	mcpServer.AddPrompt(statusPrompt, func(ctx context.Context, request mcp.GetPromptRequest) (*mcp.GetPromptResult, error) {
+		gmailServer, err := gmailServers.ServerFor(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		// Check file statuses
+		tokenPath := gmailServer.TokenFile()
+		tonePath := gmailServer.StyleGuideFile()
+
+		tokenExists := "❌ " + i18n.T("status.not_found", "Not found")
+		if _, err := os.Stat(tokenPath); err == nil {
+			tokenExists = "✅ " + i18n.T("status.found", "Found")
+		}
+
+		toneExists := "❌ " + i18n.T("status.not_found", "Not found")
+		if _, err := os.Stat(tonePath); err == nil {
+			toneExists = "✅ " + i18n.T("status.found", "Found")
+		}
+
+		authStatus := "✅ " + i18n.T("status.authenticated", "Authenticated")
+		if !gmailServer.IsAuthenticated() {
+			authStatus = "❌ " + i18n.T("status.not_authenticated", "Not authenticated (use /authenticate or the authenticate tool)")
+		}
+
+		statusMessage := fmt.Sprintf("📊 **%s**\n\n🔐 **Gmail:** %s\n\n📁 **%s:** %s\n\n🔑 **%s:** %s\n   %s: %s\n\n📝 **%s:** %s\n   %s: %s\n\n🛠️ **%s:**\n- %s\n- %s\n- %s\n- %s: search_threads (includes drafts), count_matches, category_counts, build_query, run_saved_search, create_draft (create/update), manage_groups, mail_merge, import_eml, backup_mailbox, extract_attachment_by_filename, list_labels, create_label, mute_thread, block_sender, cleanup_plan, manage_rules, run_rules_now, list_subscriptions, sender_history, set_vip, explain_priority, search_attachments, find_similar, get_thread_participants, export_thread_document, translate_message, analyze_image_attachment, extract_entities, auto_label, collect_receipts, assemble_itinerary, extract_deadlines, unanswered_questions, track_applications, track_project, summarize_agreements, remember_fact, recall_facts, weekly_report, manage_digests, outbox_status, find_related_threads, critique_draft, update_style_guide, list_supported_formats, render_attachment_preview, get_profile, server_version, telemetry_status, session_stats, authenticate\n- %s: file://personal-email-style-guide, gmail://memory, gmail://contact/{address}/context, gmail://project/{name}, gmail://style-examples/{scenario}, gmail://view/needs-reply, gmail://view/today, gmail://view/vip-unread",
+			i18n.T("status.title", "Gmail MCP Server Status"), authStatus,
+			i18n.T("status.app_data_dir", "App Data Directory"), config.AppDataDir(),
+			i18n.T("status.token_file", "Token File"), tokenPath, i18n.T("status.status", "Status"), tokenExists,
+			i18n.T("status.style_guide_file", "Style Guide File"), tonePath, i18n.T("status.status", "Status"), toneExists,
+			i18n.T("status.commands", "Available Commands"),
+			i18n.T("status.use_generate_tone", "Use /generate-email-tone to create email tone personalization"),
+			i18n.T("status.use_authenticate", "Use /authenticate to connect Gmail"),
+			i18n.T("status.use_weekly_report", "Use /weekly-report for an email activity report"),
+			i18n.T("status.use_tools", "Use tools"), i18n.T("status.use_resources", "Use resources"))
+
+		cacheStats := gmailServer.CacheStats()
+		statusMessage += "\n\n🗄️ " + i18n.T("status.cache", "**Cache:** %v/%v entries, hit rate %.0f%% (%v hits, %v revalidated, %v misses)",
+			cacheStats["entries"], cacheStats["capacity"], cacheStats["hitRate"].(float64)*100,
+			cacheStats["hits"], cacheStats["revalidated"], cacheStats["misses"])
+
+		return &mcp.GetPromptResult{
+			Messages: []mcp.PromptMessage{
+				mcp.NewPromptMessage(
+					mcp.RoleUser,
+					mcp.NewTextContent(statusMessage),
+				),
+			},
+		}, nil
+	})
+
+	weeklyReportPrompt := mcp.NewPrompt(
+		"weekly-report",
+		mcp.WithPromptDescription(i18n.T("prompt.weekly-report", "Email activity report for the past week: volumes, top correspondents, unanswered threads, time to reply and notable attachments")),
+		mcp.WithArgument("days",
+			mcp.ArgumentDescription(i18n.T("prompt.weekly-report.days", "How many days to cover (default: 7)")),
+		),
+	)
+
+	mcpServer.AddPrompt(weeklyReportPrompt, func(ctx context.Context, request mcp.GetPromptRequest) (*mcp.GetPromptResult, error) {
+		gmailServer, err := gmailServers.ServerFor(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if !gmailServer.IsAuthenticated() {
+			return nil, fmt.Errorf("Gmail is not authenticated; use /authenticate first")
+		}
+
+		days, _ := strconv.Atoi(request.Params.Arguments["days"])
+		report, err := gmailServer.buildActivityReport(ctx, days, "")
+		if err != nil {
+			return nil, fmt.Errorf("failed to build report: %v", err)
+		}
+
+		return &mcp.GetPromptResult{
+			Messages: []mcp.PromptMessage{
+				mcp.NewPromptMessage(
+					mcp.RoleUser,
+					mcp.NewTextContent(report.Markdown),
+				),
+			},
+		}, nil
+	})
+}
+
+// RegisterAuthTools adds the authenticate tool, so headless clients can connect Gmail after
+// startup, and get_profile to confirm which account they're connected to
+func RegisterAuthTools(adder ToolAdder, gmailServers Servers) {
+	adder = localized(adder)
+	// Add Authenticate tool so headless clients can connect Gmail after startup
+	authenticateTool := mcp.NewTool("authenticate",
+		mcp.WithDescription("Connect this server to the user's Gmail account. Returns a Google sign-in URL for the user to open; once they finish signing in, all other Gmail tools become available. Call this when another tool reports that Gmail authentication is required."),
+	)
+
+	adder.AddTool(authenticateTool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		gmailServer, err := gmailServers.ServerFor(ctx)
+		if err != nil {
+			return toolerr.Result(err, ""), nil
+		}
+		if gmailServer.IsAuthenticated() {
+			return mcp.NewToolResultText("✅ Gmail is already authenticated."), nil
+		}
+		authURL, err := gmailServer.StartAuthentication()
+		if err != nil {
+			return toolerr.Result(err, "Failed to start authentication"), nil
+		}
+		return mcp.NewToolResultText(authURLMessage(authURL)), nil
+	})
+
+	getProfileTool := mcp.NewTool("get_profile",
+		mcp.WithDescription("Show which Gmail account this server is operating on: email address, total messages and threads, the current history ID and the OAuth scopes the user granted. Use it to confirm the account before acting on mail."),
+	)
+
+	adder.AddTool(getProfileTool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		gmailServer, errResult := gmailServers.ForRequest(ctx)
+		if errResult != nil {
+			return errResult, nil
+		}
+
+		return gmailServer.Profile(ctx)
+	})
+
+	serverVersionTool := mcp.NewTool("server_version",
+		mcp.WithDescription("Show which build of this server is running (version, commit, build date, Go version, platform) and, if the startup update check is enabled, whether a newer release or a security fix is available. Include it when reporting a problem."),
+	)
+
+	adder.AddTool(serverVersionTool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		resultJSON, _ := json.MarshalIndent(update.Status(), "", "  ")
+		return mcp.NewToolResultText(string(resultJSON)), nil
+	})
+
+	telemetryStatusTool := mcp.NewTool("telemetry_status",
+		mcp.WithDescription("Show whether anonymous usage telemetry is on, what it collects and exactly which counts are buffered to be sent. Telemetry is off unless the user set GMAIL_MCP_TELEMETRY=1."),
+	)
+
+	adder.AddTool(telemetryStatusTool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		resultJSON, _ := json.MarshalIndent(telemetry.Default().Status(), "", "  ")
+		return mcp.NewToolResultText(string(resultJSON)), nil
+	})
+
+	sessionStatsTool := mcp.NewTool("session_stats",
+		mcp.WithDescription("Report what each tool cost in this session so far: calls, errors, wall-clock time (total, average, slowest), Gmail API requests and the quota units Google charges for them, and LLM tokens for tools that call a model. Tools are listed most expensive first. Use it to find which steps of a workflow to narrow, batch or cache."),
+		mcp.WithBoolean("reset",
+			mcp.Description("Start counting over after this report (default: false)"),
+		),
+	)
+
+	adder.AddTool(sessionStatsTool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		sessionID := usage.SessionID(ctx)
+		report := usage.Default().Report(sessionID)
+		result := map[string]interface{}{
+			"totals": report.Totals,
+			"tools":  report.Tools,
+			"note":   "Gmail units are Google's quota costs per API method (a mailbox may use 250 per second); reads served from the cache cost none. Tokens are as reported by the model endpoint. Time includes waiting for a concurrency slot. This call isn't included.",
+		}
+		if !report.Since.IsZero() {
+			result["since"] = report.Since.Format(time.RFC3339)
+		} else {
+			result["note"] = "No tool calls have finished in this session yet."
+		}
+		if req.GetBool("reset", false) {
+			usage.Default().Reset(sessionID)
+			result["reset"] = true
+		}
+		resultJSON, _ := json.MarshalIndent(result, "", "  ")
+		return mcp.NewToolResultText(string(resultJSON)), nil
+	})
+}
+
+// RegisterSearchTools adds the tools that search and read mail
+func RegisterSearchTools(adder ToolAdder, gmailServers Servers) {
+	adder = localized(adder)
+	// Add Search Threads tool
+	searchThreadsTool := mcp.NewTool("search_threads",
+		mcp.WithDescription(`Search Gmail threads using Gmail's powerful query syntax.
+
+GMAIL SEARCH OPERATORS:
+Basic Filters:
+  from:amy@example.com           - Find emails from specific sender
+  to:me                          - Find emails sent to specific recipient  
+  cc:john@example.com            - Find emails with specific CC
+  subject:"quarterly review"     - Find emails with specific subject text
+  
+Date/Time Filters (dates are midnight in the user's time zone):
+  after:2025/06/01               - Emails after specific date
+  before:2025/06/07              - Emails before specific date  
+  older_than:7d                  - Older than 7 days (use d/m/y)
+  newer_than:2m                  - Newer than 2 months
+  
+Content & Attachments:
+  has:attachment                 - Has any attachment
+  filename:pdf                   - Has PDF attachment
+  filename:report.txt            - Has specific filename
+  has:youtube                    - Contains YouTube videos
+  has:drive                      - Contains Google Drive files
+  
+Labels & Categories:
+  label:important                - Has specific label
+  category:promotions            - In specific category
+  is:unread                      - Unread messages
+  is:starred                     - Starred messages
+  is:important                   - Marked important
+  in:sent                        - In sent folder
+  in:trash                       - In trash
+  in:anywhere                    - Search everywhere including spam/trash
+  
+Advanced Operators:
+  "exact phrase"                 - Search for exact phrase
+  (dinner movie)                 - Group terms together
+  holiday AROUND 10 vacation     - Words within 10 words of each other
+  from:amy OR from:bob           - Either condition (use OR or { })
+  from:amy AND to:david          - Both conditions
+  dinner -movie                  - Include dinner, exclude movie
+  +unicorn                       - Match word exactly
+  
+Size & Technical:
+  larger:10M                     - Larger than 10MB
+  smaller:1M                     - Smaller than 1MB
+  rfc822msgid:<id@example.com>   - Specific message ID
+  list:info@example.com          - From mailing list
+  deliveredto:user@example.com   - Delivered to specific address
+
+EXAMPLE QUERIES:
+  "is:unread"                    - All unread emails
+  "from:support@github.com"      - All emails from GitHub
+  "subject:invoice older_than:30d" - Old invoices
+  "has:attachment filename:pdf"  - PDF attachments
+  "from:boss@company.com is:unread" - Unread emails from boss
+  "(urgent OR important) newer_than:1d" - Recent urgent/important emails
+
+Each result lists the thread's messages in messageIds, oldest first, for tools that take a message_id. Each has its from, date (from its Date header) and internalDate (when Gmail received it), as RFC 3339 in the user's time zone.`),
+		mcp.WithString("query",
+			mcp.Required(),
+			mcp.Description("Gmail search query using the operators above (e.g., 'from:example@gmail.com', 'subject:meeting', 'is:unread')"),
+		),
+		mcp.WithNumber("max_results",
+			mcp.Description("Maximum number of threads to return (default: 10)"),
+		),
+		mcp.WithString("sort",
+			mcp.Description("Result order, applied by the server to the page of threads it loads, not to every match in the mailbox: 'newest' (default; latest message first), 'oldest' (the oldest of the 500 most recent matching threads first, e.g. for a review queue; the result has truncated: true when more matches exist), 'relevance' (query words in the subject, then sender, then snippet) or 'priority-score' (highest priority first). Every result has a 0-100 priority score combining VIP senders, Gmail's importance marker (also given as gmailImportant), recency, unread state, direct addressing, whether the user writes to the sender and questions in the latest message; explain_priority breaks one down. Each result also has a one-line reason, e.g. \"direct question from Dana (VIP), unanswered for 2 days\"."),
+			mcp.Enum(searchSorts...),
+		),
+		mcp.WithString("order_by",
+			mcp.Description("Older name for sort: 'date' is newest and 'priority' is priority-score"),
+			mcp.Enum("date", "priority"),
+		),
+		mcp.WithString("snippets",
+			mcp.Description("Which previews to return: 'both' (default), 'first' (the first message's snippet only), 'latest' (the latest message's latestSnippet only) or 'none'. Threads with replies also get lastFrom, lastDate and, when the subject changed, lastSubject for their latest message."),
+			mcp.Enum(snippetModes...),
+		),
+		mcp.WithBoolean("include_inline",
+			mcp.Description("Also list noise attachments: inline signature images, tiny icons and S/MIME or PGP signature files (default: false; hidden ones are counted in hiddenAttachments)"),
+		),
+		mcp.WithString("category",
+			mcp.Description("Only threads in this inbox tab, as the user sees them in Gmail. Every result also has its tab in 'category'."),
+			mcp.Enum(categoryNames()...),
+		),
+		mcp.WithString("tag",
+			mcp.Description("Only threads with mail delivered to the user's plus-addressed variant with this tag, e.g. 'newsletter' for user+newsletter@gmail.com (such as replies to a create_draft or mail_merge from_tag)"),
+		),
+		mcp.WithString("range",
+			mcp.Description(dateRangeDescription+". Safer than writing after:/before: dates by hand."),
+		),
+		mcp.WithString("since",
+			mcp.Description(sinceDescription),
+		),
+	)
+
+	adder.AddTool(searchThreadsTool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		gmailServer, errResult := gmailServers.ForRequest(ctx)
+		if errResult != nil {
+			return errResult, nil
+		}
+
+		query, err := req.RequireString("query")
+		if err != nil {
+			return toolerr.Invalid("query parameter is required and must be a string"), nil
+		}
+
+		maxResults := int64(10)
+		args := req.GetArguments()
+		if mr, ok := args["max_results"].(float64); ok {
+			maxResults = int64(mr)
+		}
+
+		category := req.GetString("category", "")
+		if !validCategory(category) {
+			return invalidCategoryError(category), nil
+		}
+
+		query, err = withDates(query, req.GetString("range", ""), req.GetString("since", ""))
+		if err != nil {
+			return toolerr.Invalid(err.Error()), nil
+		}
+
+		query, err = gmailServer.withTag(ctx, withCategory(query, category), req.GetString("tag", ""))
+		if err != nil {
+			return toolerr.Result(err, ""), nil
+		}
+
+		return gmailServer.SearchThreads(ctx, query, maxResults, req.GetString("sort", req.GetString("order_by", "")), req.GetString("snippets", ""), req.GetBool("include_inline", false))
+	})
+
+	countMatchesTool := mcp.NewTool("count_matches",
+		mcp.WithDescription("Estimate how many threads and messages match a Gmail query without fetching them. Call this before search_threads or fetch_email_bodies on a broad query: if thousands match, refine the query first instead of spending quota and context."),
+		mcp.WithString("query",
+			mcp.Required(),
+			mcp.Description("Gmail search query, as for search_threads"),
+		),
+		mcp.WithString("range",
+			mcp.Description(dateRangeDescription),
+		),
+		mcp.WithString("since",
+			mcp.Description(sinceDescription),
+		),
+	)
+
+	adder.AddTool(countMatchesTool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		gmailServer, errResult := gmailServers.ForRequest(ctx)
+		if errResult != nil {
+			return errResult, nil
+		}
+
+		query, err := req.RequireString("query")
+		if err != nil {
+			return toolerr.Invalid("query parameter is required and must be a string"), nil
+		}
+
+		query, err = withDates(query, req.GetString("range", ""), req.GetString("since", ""))
+		if err != nil {
+			return toolerr.Invalid(err.Error()), nil
+		}
+
+		return gmailServer.CountMatches(ctx, query)
+	})
+
+	categoryCountsTool := mcp.NewTool("category_counts",
+		mcp.WithDescription("Count threads and unread threads per Gmail inbox tab (primary, social, promotions, updates, forums), the way the user sees their tabs. Counts are Gmail's estimates; nothing is fetched."),
+		mcp.WithString("query",
+			mcp.Description("Optional Gmail query to count within (default: in:inbox)"),
+		),
+	)
+
+	adder.AddTool(categoryCountsTool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		gmailServer, errResult := gmailServers.ForRequest(ctx)
+		if errResult != nil {
+			return errResult, nil
+		}
+
+		return gmailServer.CategoryCounts(ctx, req.GetString("query", ""))
+	})
+
+	buildQueryTool := mcp.NewTool("build_query",
+		mcp.WithDescription("Build a valid Gmail search query from structured filters instead of writing one by hand, for search_threads and other tools that take a query. With mode validate_query it also checks the query (or one passed in 'query') for mistakes Gmail silently ignores, such as unknown operators, bad dates and lowercase 'or', confirms the labels exist and dry-runs it to report how many messages match."),
+		mcp.WithString("from",
+			mcp.Description("Sender address or name; comma-separate several to match any of them"),
+		),
+		mcp.WithString("to",
+			mcp.Description("Recipient address or name; comma-separate several to match any of them"),
+		),
+		mcp.WithString("subject",
+			mcp.Description("Words or phrase in the subject"),
+		),
+		mcp.WithString("after",
+			mcp.Description("Only mail after this date (YYYY/MM/DD)"),
+		),
+		mcp.WithString("before",
+			mcp.Description("Only mail before this date (YYYY/MM/DD)"),
+		),
+		mcp.WithString("range",
+			mcp.Description(dateRangeDescription+", instead of after/before"),
+		),
+		mcp.WithString("since",
+			mcp.Description(sinceDescription+", instead of after/before"),
+		),
+		mcp.WithString("labels",
+			mcp.Description("Comma-separated label names the mail must all have"),
+		),
+		mcp.WithBoolean("has_attachment",
+			mcp.Description("Only mail with attachments"),
+		),
+		mcp.WithString("category",
+			mcp.Description("Only mail in this inbox tab"),
+			mcp.Enum(categoryNames()...),
+		),
+		mcp.WithString("text",
+			mcp.Description("Free text to search for; may also hold other Gmail operators such as is:unread"),
+		),
+		mcp.WithString("query",
+			mcp.Description("An existing query to check instead of building one from the filters"),
+		),
+		mcp.WithString("mode",
+			mcp.Description("build (default) returns the query; validate_query also checks labels and counts matching messages"),
+			mcp.Enum("build", "validate_query"),
+		),
+	)
+
+	adder.AddTool(buildQueryTool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		gmailServer, errResult := gmailServers.ForRequest(ctx)
+		if errResult != nil {
+			return errResult, nil
+		}
+
+		mode := req.GetString("mode", "build")
+		if mode != "build" && mode != "validate_query" {
+			return toolerr.Invalid(fmt.Sprintf("Invalid mode '%s': use build or validate_query", mode)), nil
+		}
+
+		filter := QueryFilter{
+			From:          req.GetString("from", ""),
+			To:            req.GetString("to", ""),
+			Subject:       req.GetString("subject", ""),
+			After:         req.GetString("after", ""),
+			Before:        req.GetString("before", ""),
+			Range:         req.GetString("range", ""),
+			Since:         req.GetString("since", ""),
+			Labels:        req.GetString("labels", ""),
+			HasAttachment: req.GetBool("has_attachment", false),
+			Category:      req.GetString("category", ""),
+			Text:          req.GetString("text", ""),
+		}
+
+		return gmailServer.BuildQuery(ctx, filter, req.GetString("query", ""), mode == "validate_query")
+	})
+
+	saveSearchTool := mcp.NewTool("save_search",
+		mcp.WithDescription("Save a Gmail query under a name (e.g. 'awaiting invoices') so it can be rerun with run_saved_search. Saving an existing name replaces it; set delete to remove it. Searches are stored locally in saved-searches.json, which the user can also edit."),
+		mcp.WithString("name",
+			mcp.Required(),
+			mcp.Description("Name of the search; case-insensitive"),
+		),
+		mcp.WithString("query",
+			mcp.Description("Gmail query, as for search_threads (required unless deleting)"),
+		),
+		mcp.WithString("description",
+			mcp.Description("Optional note on what the search is for"),
+		),
+		mcp.WithString("order_by",
+			mcp.Description("Sort order when the search is run, as search_threads' sort (default: newest)"),
+			mcp.Enum(searchSorts...),
+		),
+		mcp.WithNumber("max_results",
+			mcp.Description("Threads to return when the search is run (default: 10)"),
+		),
+		mcp.WithBoolean("delete",
+			mcp.Description("Delete the saved search with this name instead"),
+		),
+	)
+
+	adder.AddTool(saveSearchTool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		gmailServer, err := gmailServers.ServerFor(ctx)
+		if err != nil {
+			return toolerr.Result(err, ""), nil
+		}
+
+		search := savedSearch{
+			Name:        req.GetString("name", ""),
+			Query:       req.GetString("query", ""),
+			Description: req.GetString("description", ""),
+			OrderBy:     req.GetString("order_by", ""),
+			MaxResults:  int64(req.GetInt("max_results", 0)),
+		}
+		return gmailServer.SaveSearch(search, req.GetBool("delete", false))
+	})
+
+	listSavedSearchesTool := mcp.NewTool("list_saved_searches",
+		mcp.WithDescription("List the saved searches with their names, queries and descriptions. Check this when the user refers to one of their searches by name."),
+	)
+
+	adder.AddTool(listSavedSearchesTool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		gmailServer, err := gmailServers.ServerFor(ctx)
+		if err != nil {
+			return toolerr.Result(err, ""), nil
+		}
+
+		return gmailServer.ListSavedSearches()
+	})
+
+	runSavedSearchTool := mcp.NewTool("run_saved_search",
+		mcp.WithDescription("Run a saved search by name and return matching threads in the same format as search_threads."),
+		mcp.WithString("name",
+			mcp.Required(),
+			mcp.Description("Name of the saved search"),
+		),
+		mcp.WithNumber("max_results",
+			mcp.Description("Override the saved number of threads to return"),
+		),
+	)
+
+	adder.AddTool(runSavedSearchTool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		gmailServer, errResult := gmailServers.ForRequest(ctx)
+		if errResult != nil {
+			return errResult, nil
+		}
+
+		name, err := req.RequireString("name")
+		if err != nil {
+			return toolerr.Invalid("name parameter is required and must be a string"), nil
+		}
+
+		return gmailServer.RunSavedSearch(ctx, name, int64(req.GetInt("max_results", 0)))
+	})
+
+	// Add Fetch Email Bodies tool for selective full content retrieval
+	fetchEmailBodiesTool := mcp.NewTool("fetch_email_bodies",
+		mcp.WithDescription("Fetch full email bodies for specific threads after browsing with snippets. Can fetch multiple emails at once for efficient selective content retrieval. If the request includes a progress token, each thread is also streamed as a progress notification (with the thread in partialResult) as soon as it is loaded. With OpenPGP support on, encrypted mail is decrypted with the local key and signatures are checked; the outcome is in 'pgp' by message ID. messageIds lists every message with its sender, date (from its Date header) and internalDate (when Gmail received it), as RFC 3339 in the user's time zone."),
+		mcp.WithString("thread_ids",
+			mcp.Required(),
+			mcp.Description("A comma-separated list of thread IDs to fetch full email content for (e.g., 'id1,id2,id3')"),
+		),
+		mcp.WithBoolean("include_inline",
+			mcp.Description("Also list noise attachments: inline signature images, tiny icons and S/MIME or PGP signature files (default: false; hidden ones are counted in hiddenAttachments)"),
+		),
+		mcp.WithString("context_mode",
+			mcp.Description("full (default) returns the thread as usual. delta returns, for threads already fetched in this session, only the messages that arrived since (newMessageIds, with their bodies in fullBody; unchanged is true when there are none). Use delta when checking a thread again."),
+			mcp.Enum("full", "delta"),
+		),
+	)
+
+	adder.AddTool(fetchEmailBodiesTool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		gmailServer, errResult := gmailServers.ForRequest(ctx)
+		if errResult != nil {
+			return errResult, nil
+		}
+
+		threadIDsStr, err := req.RequireString("thread_ids")
+		if err != nil {
+			return toolerr.Invalid("thread_ids parameter is required and must be a string"), nil
+		}
+
+		// Split the comma-separated string into a slice
+		threadIDs := strings.Split(threadIDsStr, ",")
+		for i, id := range threadIDs {
+			threadIDs[i] = strings.TrimSpace(id)
+		}
+
+		if len(threadIDs) == 0 || (len(threadIDs) == 1 && threadIDs[0] == "") {
+			return toolerr.Invalid("At least one thread_id must be provided"), nil
+		}
+
+		// Limit to prevent overwhelming requests
+		if len(threadIDs) > 20 {
+			return toolerr.Invalid("Maximum 20 thread_ids allowed per request"), nil
+		}
+
+		contextMode := req.GetString("context_mode", "full")
+		if contextMode != "full" && contextMode != "delta" {
+			return toolerr.Invalid(fmt.Sprintf("Invalid context_mode '%s': use full or delta", contextMode)), nil
+		}
+
+		progress := newProgressReporter(ctx, req, len(threadIDs))
+		return gmailServer.FetchEmailBodies(ctx, threadIDs, req.GetBool("include_inline", false), contextMode, progress)
+	})
+
+	findSimilarTool := mcp.NewTool("find_similar",
+		mcp.WithDescription("Find emails related to a message: the same subject (ignoring Re:/Fwd:), the same participants and, when GMAIL_MCP_EMBEDDINGS=1 and OPENAI_API_KEY are set, similar content. Returns one best match per thread with a score and reasons. Useful for pulling up everything about a deal, project or contract from one email."),
+		mcp.WithString("message_id",
+			mcp.Required(),
+			mcp.Description("The message ID to find related emails for"),
+		),
+		mcp.WithNumber("max_results",
+			mcp.Description("Maximum number of related threads to return (default: 10)"),
+		),
+	)
+
+	adder.AddTool(findSimilarTool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		gmailServer, errResult := gmailServers.ForRequest(ctx)
+		if errResult != nil {
+			return errResult, nil
+		}
+
+		messageID, err := req.RequireString("message_id")
+		if err != nil {
+			return toolerr.Invalid("message_id parameter is required and must be a string"), nil
+		}
+
+		return gmailServer.FindSimilar(ctx, messageID, req.GetInt("max_results", 10))
+	})
+
+	findRelatedThreadsTool := mcp.NewTool("find_related_threads",
+		mcp.WithDescription("Find threads that are really the same conversation as a thread but were split apart by clients that break threading: same subject once Re:/Fwd: are stripped, shared participants and messages close in time. Each related thread lists why it matched. Set merge to also get every message of the conversation in date order."),
+		mcp.WithString("thread_id",
+			mcp.Required(),
+			mcp.Description("The thread to find related threads for"),
+		),
+		mcp.WithNumber("window_days",
+			mcp.Description("How many days apart threads may be and still count as one conversation (default: 30)"),
+		),
+		mcp.WithBoolean("merge",
+			mcp.Description("Also return the messages of all related threads as one chronological conversation (default: false)"),
+		),
+	)
+
+	adder.AddTool(findRelatedThreadsTool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		gmailServer, errResult := gmailServers.ForRequest(ctx)
+		if errResult != nil {
+			return errResult, nil
+		}
+
+		threadID, err := req.RequireString("thread_id")
+		if err != nil {
+			return toolerr.Invalid("thread_id parameter is required and must be a string"), nil
+		}
+
+		return gmailServer.FindRelatedThreads(ctx, threadID, req.GetInt("window_days", 30), req.GetBool("merge", false))
+	})
+
+	threadParticipantsTool := mcp.NewTool("get_thread_participants",
+		mcp.WithDescription("List every person on a thread with their role (original sender, recipient, cc'd or later joiner) and how many messages they sent and received. Also returns who a reply-all to the latest message would reach and who has dropped off it. Useful for reply-all sanity checks and for assembling meeting invites."),
+		mcp.WithString("thread_id",
+			mcp.Required(),
+			mcp.Description("The thread ID to list participants for"),
+		),
+	)
+
+	adder.AddTool(threadParticipantsTool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		gmailServer, errResult := gmailServers.ForRequest(ctx)
+		if errResult != nil {
+			return errResult, nil
+		}
+
+		threadID, err := req.RequireString("thread_id")
+		if err != nil {
+			return toolerr.Invalid("thread_id parameter is required and must be a string"), nil
+		}
+
+		return gmailServer.GetThreadParticipants(ctx, threadID)
+	})
+
+	exportThreadTool := mcp.NewTool("export_thread_document",
+		mcp.WithDescription("Export a whole thread as a clean document for sharing, e.g. handing a conversation record to legal or a colleague: every message oldest first with its From, To, Cc and Date headers, body and attachment references (names, types and sizes, not the files). Markdown is returned as text; pdf is returned as an embedded PDF resource. Set hide_addresses, strip_signatures and redact_patterns before sharing outside the organization."),
+		mcp.WithString("thread_id",
+			mcp.Required(),
+			mcp.Description("The thread ID to export"),
+		),
+		mcp.WithString("format",
+			mcp.Description("markdown (default) or pdf; pdf needs GMAIL_MCP_HTML_PDF_COMMAND or GMAIL_MCP_LIBREOFFICE"),
+			mcp.Enum("markdown", "pdf"),
+		),
+		mcp.WithBoolean("include_quoted",
+			mcp.Description("Keep quoted reply text in each message (default: false, since the quoted messages are in the document already)"),
+		),
+		mcp.WithBoolean("hide_addresses",
+			mcp.Description("Show people by name only, replacing every email address in headers and bodies; someone without a name becomes 'Participant N' (default: false)"),
+		),
+		mcp.WithBoolean("strip_signatures",
+			mcp.Description("Remove signature blocks, 'Sent from my phone' taglines and confidentiality or mailing list footers, keeping the sign-off and name (default: false)"),
+		),
+		mcp.WithBoolean("redact_patterns",
+			mcp.Description("Replace sensitive data (card numbers, IBANs, phone numbers, email addresses, SSNs and the GMAIL_MCP_REDACT_PATTERNS rules) with placeholders like [REDACTED_PHONE] (default: false)"),
+		),
+	)
+
+	adder.AddTool(exportThreadTool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		gmailServer, errResult := gmailServers.ForRequest(ctx)
+		if errResult != nil {
+			return errResult, nil
+		}
+
+		threadID, err := req.RequireString("thread_id")
+		if err != nil {
+			return toolerr.Invalid("thread_id parameter is required and must be a string"), nil
+		}
+
+		return gmailServer.ExportThreadDocument(ctx, threadID, req.GetString("format", "markdown"), exportOptions{
+			IncludeQuoted:   req.GetBool("include_quoted", false),
+			HideAddresses:   req.GetBool("hide_addresses", false),
+			StripSignatures: req.GetBool("strip_signatures", false),
+			RedactPatterns:  req.GetBool("redact_patterns", false),
+		})
+	})
+
+	senderHistoryTool := mcp.NewTool("sender_history",
+		mcp.WithDescription("Check the user's history with a sender before acting on their email: whether the user has ever written to them, first contact detection, how long the relationship is, and whether their mail is usually archived unread. Useful for triage and for spotting phishing from unknown senders."),
+		mcp.WithString("sender",
+			mcp.Required(),
+			mcp.Description("The sender's email address, or a From header like 'Alice <alice@example.com>'"),
+		),
+	)
+
+	adder.AddTool(senderHistoryTool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		gmailServer, errResult := gmailServers.ForRequest(ctx)
+		if errResult != nil {
+			return errResult, nil
+		}
+
+		sender, err := req.RequireString("sender")
+		if err != nil {
+			return toolerr.Invalid("sender parameter is required and must be a string"), nil
+		}
+
+		return gmailServer.SenderHistory(ctx, sender)
+	})
+}
+
+// RegisterDraftTools adds the drafting tools
+func RegisterDraftTools(adder ToolAdder, gmailServers Servers) {
+	adder = localized(adder)
+	// Add Create Draft tool
+	createDraftTool := mcp.NewTool("create_draft",
+		mcp.WithDescription("Create a Gmail draft email or update an existing draft in the thread. When a thread_id is provided, the thread's existing drafts are checked: by default the thread's only draft is overwritten, allowing LLMs to iteratively modify draft content. If the thread has several drafts, pass draft_id to pick one or mode create_new to add another. Results list the thread's existingDrafts; updates also return a unified diff against the previous draft and its previous to, subject and body. Results warn in outOfOffice when a recipient's recent auto-replies say they are away. Important: Before writing any email, always request the file://personal-email-style-guide resource to understand the user's writing style and preferences."),
+		mcp.WithString("to",
+			mcp.Description("Recipient email address; comma-separate several. Required unless to_group is given."),
+		),
+		mcp.WithString("to_group",
+			mcp.Description("Name of a recipient group from manage_groups (e.g. 'family'); comma-separate several. Its members are added to 'to', with duplicates removed."),
+		),
+		mcp.WithString("subject",
+			mcp.Required(),
+			mcp.Description("Email subject line"),
+		),
+		mcp.WithString("body",
+			mcp.Required(),
+			mcp.Description("Email body content"),
+		),
+		mcp.WithString("thread_id",
+			mcp.Description("Thread ID if this is a reply (optional). If provided and a draft exists for this thread, the existing draft will be updated instead of creating a new one (see mode)."),
+		),
+		mcp.WithString("draft_id",
+			mcp.Description("ID of the draft to overwrite (from search_threads drafts or existingDrafts). Only valid with mode 'update'."),
+		),
+		mcp.WithString("mode",
+			mcp.Description("'update' (default): overwrite draft_id, or the thread's draft if it has exactly one, otherwise create. 'create_new': always create another draft. 'fail_if_exists': return an error listing the thread's drafts if it has any."),
+			mcp.Enum(DraftModeUpdate, DraftModeCreateNew, DraftModeFailIfExists),
+		),
+		mcp.WithString("from_tag",
+			mcp.Description("Optional tag to send from the user's plus-addressed variant, e.g. 'newsletter' for user+newsletter@gmail.com. Replies come back to that address, so they can be found later with search_threads' tag."),
+		),
+		mcp.WithBoolean("encrypt",
+			mcp.Description("Encrypt the body with OpenPGP (PGP/MIME) to every recipient's public key in the local keyring (default: false). Fails if a recipient has no known key. The subject is not encrypted. Needs GMAIL_MCP_GPG."),
+		),
+		mcp.WithString("idempotency_key",
+			mcp.Description("Optional unique key for this request (e.g. a UUID). Retrying with the same key within 24 hours returns the original result instead of creating another draft again."),
+		),
+	)
+
+	adder.AddTool(createDraftTool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		gmailServer, errResult := gmailServers.ForRequest(ctx)
+		if errResult != nil {
+			return errResult, nil
+		}
+
+		to, err := gmailServer.ExpandRecipients(req.GetString("to", ""), req.GetString("to_group", ""))
+		if err != nil {
+			return toolerr.Result(err, ""), nil
+		}
+		if to == "" {
+			return toolerr.Invalid("to or to_group parameter is required"), nil
+		}
+
+		subject, err := req.RequireString("subject")
+		if err != nil {
+			return toolerr.Invalid("subject parameter is required and must be a string"), nil
+		}
+
+		body, err := req.RequireString("body")
+		if err != nil {
+			return toolerr.Invalid("body parameter is required and must be a string"), nil
+		}
+
+		threadID := ""
+		args := req.GetArguments()
+		if tid, ok := args["thread_id"].(string); ok {
+			threadID = tid
+		}
+
+		return gmailServer.Idempotent("create_draft", req.GetString("idempotency_key", ""), args, func() (*mcp.CallToolResult, error) {
+			return gmailServer.CreateDraft(ctx, to, subject, body, threadID, req.GetString("draft_id", ""), req.GetString("mode", DraftModeUpdate), req.GetString("from_tag", ""), req.GetBool("encrypt", false))
+		})
+	})
+
+	manageGroupsTool := mcp.NewTool("manage_groups",
+		mcp.WithDescription("List, create, edit or delete named recipient groups (e.g. 'family', 'project-x-team') for recurring group emails. Pass a group name as to_group in create_draft to address everyone in it. Groups are stored locally in groups.json, which the user can also edit."),
+		mcp.WithString("action",
+			mcp.Description("'list' (default), 'set' (create or replace the members), 'add' or 'remove' members, or 'delete' the group"),
+			mcp.Enum("list", "set", "add", "remove", "delete"),
+		),
+		mcp.WithString("name",
+			mcp.Description("Group name, case-insensitive (required unless listing)"),
+		),
+		mcp.WithString("members",
+			mcp.Description("Comma-separated addresses, e.g. 'Mom <mom@example.com>, dad@example.com' (for set, add and remove)"),
+		),
+	)
+
+	adder.AddTool(manageGroupsTool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		gmailServer, err := gmailServers.ServerFor(ctx)
+		if err != nil {
+			return toolerr.Result(err, ""), nil
+		}
+
+		return gmailServer.ManageGroups(req.GetString("action", "list"), req.GetString("name", ""), req.GetString("members", ""))
+	})
+
+	mailMergeTool := mcp.NewTool("mail_merge",
+		mcp.WithDescription("Mail merge: fill a subject and body template with {{variables}} for each recipient in a CSV or JSON list, then save one draft per recipient (default) or schedule them for sending. The first call is always a dry run that creates nothing: it returns the rendered messages, the rows it would skip (bad address, duplicate, missing variable) and a confirm_token. Show the preview to the user, and only after they approve call again with the same arguments plus confirm_token. Scheduled sends go out through the outbox no faster than per_hour and within the account send limits; pass any warnings in the preview on to the user."),
+		mcp.WithString("subject",
+			mcp.Required(),
+			mcp.Description("Subject template, e.g. 'Invoice {{invoice}} for {{company}}'"),
+		),
+		mcp.WithString("body",
+			mcp.Required(),
+			mcp.Description("Body template; {{name}}-style variables are replaced with the recipient's values (names are case-insensitive)"),
+		),
+		mcp.WithString("recipients",
+			mcp.Required(),
+			mcp.Description("CSV with a header row, or a JSON array of objects. Each row needs an 'email' column; an optional 'name' is used in the To header, and every column can be used as a variable."),
+		),
+		mcp.WithString("deliver",
+			mcp.Description("'draft' (default): one draft per recipient for the user to review and send. 'send': schedule the messages for sending."),
+			mcp.Enum(MergeDeliverDraft, MergeDeliverSend),
+		),
+		mcp.WithString("send_at",
+			mcp.Description("With deliver 'send': when the first message goes out, in RFC 3339 (default: now)"),
+		),
+		mcp.WithNumber("per_hour",
+			mcp.Description(fmt.Sprintf("With deliver 'send': messages sent per hour, spread evenly (default: %d, max: %d or GMAIL_MCP_SEND_PER_HOUR if lower)", defaultMergePerHour, maxMergePerHour)),
+		),
+		mcp.WithString("from_tag",
+			mcp.Description("Optional tag to send from the user's plus-addressed variant (user+tag@gmail.com), to track replies to this merge with search_threads' tag"),
+		),
+		mcp.WithString("confirm_token",
+			mcp.Description("confirm_token from the dry run of exactly these arguments; without it nothing is created or sent"),
+		),
+	)
+
+	adder.AddTool(mailMergeTool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		gmailServer, errResult := gmailServers.ForRequest(ctx)
+		if errResult != nil {
+			return errResult, nil
+		}
+
+		merge := MergeRequest{
+			Subject:      req.GetString("subject", ""),
+			Body:         req.GetString("body", ""),
+			Recipients:   req.GetString("recipients", ""),
+			Deliver:      req.GetString("deliver", MergeDeliverDraft),
+			SendAt:       req.GetString("send_at", ""),
+			PerHour:      req.GetInt("per_hour", 0),
+			FromTag:      req.GetString("from_tag", ""),
+			ConfirmToken: req.GetString("confirm_token", ""),
+		}
+		return gmailServer.MailMerge(ctx, merge)
+	})
+
+	critiqueDraftTool := mcp.NewTool("critique_draft",
+		mcp.WithDescription("Review a proposed email body against the user's personal style guide and recent sent mail before saving it with create_draft. Scores the draft out of 100 and lists concrete issues with greeting, sign-off, stock phrasing, exclamation marks and length, each with an edit where one applies. 'suggestedBody' is the body with those edits applied."),
+		mcp.WithString("body",
+			mcp.Required(),
+			mcp.Description("The proposed email body"),
+		),
+		mcp.WithString("to",
+			mcp.Description("Recipient, used to fill in the name when a greeting is suggested (optional)"),
+		),
+	)
+
+	adder.AddTool(critiqueDraftTool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		gmailServer, errResult := gmailServers.ForRequest(ctx)
+		if errResult != nil {
+			return errResult, nil
+		}
+
+		body, err := req.RequireString("body")
+		if err != nil {
+			return toolerr.Invalid("body parameter is required and must be a string"), nil
+		}
+
+		return gmailServer.CritiqueDraft(ctx, body, req.GetString("to", ""))
+	})
+
+	importEMLTool := mcp.NewTool("import_eml",
+		mcp.WithDescription("Add a local .eml file to the mailbox without sending anything, e.g. to migrate mail or restore it from a backup. 'import' files it like received mail (spam and filter checks), 'insert' stores it exactly as it is, and 'draft' turns it into a draft to edit and resend. The file must be in the import directory (GMAIL_MCP_IMPORT_DIR, default 'imports' in the app data directory). A message whose Message-ID is already in the mailbox isn't imported twice."),
+		mcp.WithString("path",
+			mcp.Required(),
+			mcp.Description("The .eml file's name or path inside the import directory"),
+		),
+		mcp.WithString("mode",
+			mcp.Description("import (default), insert or draft"),
+			mcp.Enum("import", "insert", "draft"),
+		),
+		mcp.WithString("labels",
+			mcp.Description("Comma-separated labels for import and insert: INBOX, UNREAD, STARRED, IMPORTANT, SENT or label names, created if missing (default: INBOX)"),
+		),
+	)
+
+	adder.AddTool(importEMLTool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		gmailServer, errResult := gmailServers.ForRequest(ctx)
+		if errResult != nil {
+			return errResult, nil
+		}
+
+		path, err := req.RequireString("path")
+		if err != nil {
+			return toolerr.Invalid("path parameter is required and must be a string"), nil
+		}
+		var labels []string
+		for _, label := range strings.Split(req.GetString("labels", ""), ",") {
+			if label = strings.TrimSpace(label); label != "" {
+				labels = append(labels, label)
+			}
+		}
+
+		return gmailServer.ImportEML(ctx, path, req.GetString("mode", "import"), labels)
+	})
+
+	backupTool := mcp.NewTool("backup_mailbox",
+		mcp.WithDescription("Back up labels to disk as mbox files, with every attachment also saved as a file, a manifest.json of what's saved and RESTORE.md with restore instructions. The first run of a label exports it in full; later runs only fetch mail added since, using Gmail's history. Runs stop after max_messages new messages; call again to continue. Files go to the backup directory (GMAIL_MCP_BACKUP_DIR, default 'backup' next to the token)."),
+		mcp.WithString("labels",
+			mcp.Description("Comma-separated label names or system labels such as INBOX and SENT (default: the labels backed up before, or INBOX,SENT)"),
+		),
+		mcp.WithBoolean("full",
+			mcp.Description("List every message again instead of only new ones, e.g. to pick up mail labeled long ago; messages already saved aren't saved twice (default: false)"),
+		),
+		mcp.WithNumber("max_messages",
+			mcp.Description("Stop after saving this many new messages (default: 500, 0 for no limit)"),
+		),
+	)
+
+	adder.AddTool(backupTool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		gmailServer, errResult := gmailServers.ForRequest(ctx)
+		if errResult != nil {
+			return errResult, nil
+		}
+
+		var labels []string
+		for _, label := range strings.Split(req.GetString("labels", ""), ",") {
+			if label = strings.TrimSpace(label); label != "" {
+				labels = append(labels, label)
+			}
+		}
+		maxMessages := req.GetInt("max_messages", 500)
+		if maxMessages < 0 {
+			return toolerr.Invalid("max_messages must be 0 or more"), nil
+		}
+
+		return gmailServer.BackupMailbox(ctx, labels, req.GetBool("full", false), maxMessages)
+	})
+}
+
+// RegisterAttachmentTools adds the attachment tools
+func RegisterAttachmentTools(adder ToolAdder, gmailServers Servers) {
+	adder = localized(adder)
+	// Add Extract Attachment By Filename tool - more reliable than attachment ID
+	extractByFilenameTool := mcp.NewTool("extract_attachment_by_filename",
+		mcp.WithDescription("Safely extract text content from email attachments by filename (do not use attachment-id). Use search_threads first to find emails with attachments, then use this tool to extract readable text from specific files by name."),
+		mcp.WithString("message_id",
+			mcp.Required(),
+			mcp.Description("The Gmail message ID containing the attachment (from search_threads results)"),
+		),
+		mcp.WithString("filename",
+			mcp.Required(),
+			mcp.Description("The filename of the attachment to extract (e.g., 'document.pdf', 'CV.docx')"),
+		),
+		mcp.WithBoolean("force_refresh",
+			mcp.Description("Re-download and re-extract the attachment even if a cached extraction exists (default: false)"),
+		),
+	)
+
+	adder.AddTool(extractByFilenameTool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		gmailServer, errResult := gmailServers.ForRequest(ctx)
+		if errResult != nil {
+			return errResult, nil
+		}
+
+		messageID, err := req.RequireString("message_id")
+		if err != nil {
+			return toolerr.Invalid("message_id parameter is required and must be a string"), nil
+		}
+
+		filename, err := req.RequireString("filename")
+		if err != nil {
+			return toolerr.Invalid("filename parameter is required and must be a string"), nil
+		}
+
+		forceRefresh := req.GetBool("force_refresh", false)
+
+		return gmailServer.ExtractAttachmentByFilename(ctx, messageID, filename, forceRefresh)
+	})
+
+	searchAttachmentsTool := mcp.NewTool("search_attachments",
+		mcp.WithDescription("Find attachments across the mailbox without walking threads. Returns a flat list of matching files with filename, MIME type, size, sender, subject, date, messageId and threadId. Use extract_attachment_by_filename with the messageId and filename to read one."),
+		mcp.WithString("filename",
+			mcp.Description("Filename glob (e.g., '*.pdf', 'invoice-*') or text the filename contains, case-insensitive"),
+		),
+		mcp.WithString("mime_type",
+			mcp.Description("Exact MIME type (e.g., 'application/pdf') or a prefix like 'image/'"),
+		),
+		mcp.WithNumber("min_size",
+			mcp.Description("Minimum attachment size in bytes"),
+		),
+		mcp.WithNumber("max_size",
+			mcp.Description("Maximum attachment size in bytes"),
+		),
+		mcp.WithString("after",
+			mcp.Description("Only messages received after this date (YYYY/MM/DD)"),
+		),
+		mcp.WithString("before",
+			mcp.Description("Only messages received before this date (YYYY/MM/DD)"),
+		),
+		mcp.WithString("from",
+			mcp.Description("Only attachments sent by this address or domain"),
+		),
+		mcp.WithNumber("max_results",
+			mcp.Description("Maximum number of attachments to return (default: 50)"),
+		),
+	)
+
+	adder.AddTool(searchAttachmentsTool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		gmailServer, errResult := gmailServers.ForRequest(ctx)
+		if errResult != nil {
+			return errResult, nil
+		}
+
+		filter := AttachmentFilter{
+			Filename: req.GetString("filename", ""),
+			MimeType: req.GetString("mime_type", ""),
+			MinSize:  int64(req.GetFloat("min_size", 0)),
+			MaxSize:  int64(req.GetFloat("max_size", 0)),
+			After:    req.GetString("after", ""),
+			Before:   req.GetString("before", ""),
+			From:     req.GetString("from", ""),
+		}
+
+		return gmailServer.SearchAttachments(ctx, filter, req.GetInt("max_results", 50))
+	})
+
+	listFormatsTool := mcp.NewTool("list_supported_formats",
+		mcp.WithDescription("List the attachment formats extract_attachment_by_filename can read, with their MIME types, file extensions and whether each is enabled. Check this before extracting an unusual file type."),
+	)
+
+	adder.AddTool(listFormatsTool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		return ListSupportedFormats()
+	})
+
+	renderPreviewTool := mcp.NewTool("render_attachment_preview",
+		mcp.WithDescription("Render an attachment as page images (or a PDF) so you can look at it directly. Use this when extract_attachment_by_filename fails or loses layout, e.g. scanned PDFs, slides and forms. Images are returned as-is; PDFs need pdftoppm and office documents LibreOffice."),
+		mcp.WithString("message_id",
+			mcp.Required(),
+			mcp.Description("The message ID containing the attachment"),
+		),
+		mcp.WithString("filename",
+			mcp.Required(),
+			mcp.Description("The filename of the attachment to render"),
+		),
+		mcp.WithNumber("max_pages",
+			mcp.Description("Number of pages to render from the start of the document (default: 3, max: 10)"),
+		),
+		mcp.WithString("format",
+			mcp.Description("images (default) returns one image per page; pdf returns the whole document as a PDF resource"),
+			mcp.Enum("images", "pdf"),
+		),
+	)
+
+	adder.AddTool(renderPreviewTool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		gmailServer, errResult := gmailServers.ForRequest(ctx)
+		if errResult != nil {
+			return errResult, nil
+		}
+
+		messageID, err := req.RequireString("message_id")
+		if err != nil {
+			return toolerr.Invalid("message_id parameter is required"), nil
+		}
+		filename, err := req.RequireString("filename")
+		if err != nil {
+			return toolerr.Invalid("filename parameter is required"), nil
+		}
+
+		return gmailServer.RenderAttachmentPreview(ctx, messageID, filename, req.GetString("format", "images"), req.GetInt("max_pages", defaultPreviewPages))
+	})
+}
+
+// RegisterLabelTools adds the tools that label, filter and triage mail
+func RegisterLabelTools(adder ToolAdder, gmailServers Servers) {
+	adder = localized(adder)
+	// Add inbox cleanup tools so agents can act on triage decisions
+	muteThreadTool := mcp.NewTool("mute_thread",
+		mcp.WithDescription("Mute a thread: archive it and apply the \"Muted\" label. Note that Gmail's API has no native mute, so new replies will still arrive in the inbox."),
+		mcp.WithString("thread_id",
+			mcp.Required(),
+			mcp.Description("The thread ID to mute (from search_threads results)"),
+		),
+		mcp.WithString("idempotency_key",
+			mcp.Description("Optional unique key for this request (e.g. a UUID). Retrying with the same key within 24 hours returns the original result instead of muting the thread again."),
+		),
+	)
+
+	adder.AddTool(muteThreadTool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		gmailServer, errResult := gmailServers.ForRequest(ctx)
+		if errResult != nil {
+			return errResult, nil
+		}
+
+		threadID, err := req.RequireString("thread_id")
+		if err != nil {
+			return toolerr.Invalid("thread_id parameter is required and must be a string"), nil
+		}
+
+		return gmailServer.Idempotent("mute_thread", req.GetString("idempotency_key", ""), req.GetArguments(), func() (*mcp.CallToolResult, error) {
+			return gmailServer.MuteThread(ctx, threadID)
+		})
+	})
+
+	blockSenderTool := mcp.NewTool("block_sender",
+		mcp.WithDescription("Block a sender by creating a Gmail filter for all future mail from them. Existing mail is not changed."),
+		mcp.WithString("sender",
+			mcp.Required(),
+			mcp.Description("Email address to block (e.g., 'spam@example.com'), or '@example.com' for a whole domain"),
+		),
+		mcp.WithString("action",
+			mcp.Description("What the filter does with future mail: 'archive' (skip the inbox, default) or 'delete' (move to trash)"),
+			mcp.Enum("archive", "delete"),
+		),
+		mcp.WithString("idempotency_key",
+			mcp.Description("Optional unique key for this request (e.g. a UUID). Retrying with the same key within 24 hours returns the original result instead of creating another filter again."),
+		),
+	)
+
+	adder.AddTool(blockSenderTool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		gmailServer, errResult := gmailServers.ForRequest(ctx)
+		if errResult != nil {
+			return errResult, nil
+		}
+
+		sender, err := req.RequireString("sender")
+		if err != nil {
+			return toolerr.Invalid("sender parameter is required and must be a string"), nil
+		}
+
+		return gmailServer.Idempotent("block_sender", req.GetString("idempotency_key", ""), req.GetArguments(), func() (*mcp.CallToolResult, error) {
+			return gmailServer.BlockSender(ctx, sender, req.GetString("action", "archive"))
+		})
+	})
+
+	cleanupPlanTool := mcp.NewTool("cleanup_plan",
+		mcp.WithDescription(fmt.Sprintf("Retention assistant: for cleanup rules such as \"promotions older than a year\" or \"large attachments from newsletters\", work out what would be moved to the trash, with message counts, space reclaimed, date ranges, top senders and samples per rule. The first call is always a dry-run plan that changes nothing; show it to the user and only with their explicit approval call again with its confirm_token, within an hour, to move exactly those messages to the trash, in batches. Starred mail is never included, and nothing is deleted permanently (Gmail empties the trash after 30 days). Presets: %s.", strings.Join(cleanupPresetNames(), ", "))),
+		mcp.WithString("rules",
+			mcp.Required(),
+			mcp.Description("One rule per line: a preset name or a Gmail query (e.g. 'category:promotions older_than:1y', 'from:newsletter@example.com larger:2M'); or a JSON array of {\"name\", \"query\"} objects"),
+		),
+		mcp.WithString("confirm_token",
+			mcp.Description("The confirmToken from the dry-run plan of the same rules, once the user approved it; without it only the plan is returned"),
+		),
+	)
+
+	adder.AddTool(cleanupPlanTool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		gmailServer, errResult := gmailServers.ForRequest(ctx)
+		if errResult != nil {
+			return errResult, nil
+		}
+
+		rules, err := req.RequireString("rules")
+		if err != nil {
+			return toolerr.Invalid("rules parameter is required and must be a string"), nil
+		}
+
+		return gmailServer.CleanupPlan(ctx, rules, req.GetString("confirm_token", ""))
+	})
+
+	listSubscriptionsTool := mcp.NewTool("list_subscriptions",
+		mcp.WithDescription("Inventory the newsletters and mailing lists the user receives (mail with List-Id or List-Unsubscribe headers). Returns each sender's volume, unread count, read rate, last received and last read dates, and unsubscribe link, ranked noisiest first (most unread mail). Use it to suggest unsubscribes or block_sender candidates."),
+		mcp.WithNumber("months",
+			mcp.Description("How many months back to look (default: 3, max: 24)"),
+		),
+		mcp.WithNumber("limit",
+			mcp.Description("Maximum number of subscriptions to return (default: 20)"),
+		),
+	)
+
+	adder.AddTool(listSubscriptionsTool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		gmailServer, errResult := gmailServers.ForRequest(ctx)
+		if errResult != nil {
+			return errResult, nil
+		}
+
+		months := req.GetInt("months", 3)
+		if months > 24 {
+			return toolerr.Invalid("Maximum 24 months allowed per request"), nil
+		}
+
+		return gmailServer.ListSubscriptions(ctx, months, req.GetInt("limit", 20))
+	})
+
+	setVIPTool := mcp.NewTool("set_vip",
+		mcp.WithDescription("Add or remove a VIP sender or domain. Threads from VIPs get a higher priority score in search_threads and fetch_email_bodies results. Returns the current VIP list."),
+		mcp.WithString("sender",
+			mcp.Description("Email address (e.g., 'boss@example.com') or domain (e.g., '@example.com'). Not needed for 'list'."),
+		),
+		mcp.WithString("action",
+			mcp.Description("'add' (default), 'remove' or 'list'"),
+			mcp.Enum("add", "remove", "list"),
+		),
+	)
+
+	adder.AddTool(setVIPTool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		gmailServer, err := gmailServers.ServerFor(ctx)
+		if err != nil {
+			return toolerr.Result(err, ""), nil
+		}
+
+		return gmailServer.SetVIP(req.GetString("sender", ""), req.GetString("action", "add"))
+	})
+
+	explainPriorityTool := mcp.NewTool("explain_priority",
+		mcp.WithDescription("Explain why a thread got its priority score in search_threads and fetch_email_bodies: every signal's points out of its maximum (VIP sender, Gmail's importance marker, recency, unread, direct addressing, the user's history with the sender, a question in the latest message) with what was found, next to whether Gmail itself marks it important. Give a thread or one of its messages."),
+		mcp.WithString("thread_id",
+			mcp.Description("The thread to explain"),
+		),
+		mcp.WithString("message_id",
+			mcp.Description("A message whose thread to explain"),
+		),
+	)
+
+	adder.AddTool(explainPriorityTool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		gmailServer, errResult := gmailServers.ForRequest(ctx)
+		if errResult != nil {
+			return errResult, nil
+		}
+
+		return gmailServer.ExplainPriority(ctx, req.GetString("thread_id", ""), req.GetString("message_id", ""))
+	})
+
+	manageRulesTool := mcp.NewTool("manage_rules",
+		mcp.WithDescription("List, create, enable, disable or delete automation rules. A rule applies actions to new mail matching a Gmail query: label:<name>, archive, mark_read, star, notify (emails the user a list of the run's matches) and summarize (a short summary kept in the activity). Rules are checked in the background every few minutes and only act on mail that arrives after they're saved. Listing shows each rule's recent activity. Rules are stored locally in rules.json."),
+		mcp.WithString("action",
+			mcp.Description("'list' (default), 'set' (create or replace a rule), 'enable', 'disable' or 'delete'"),
+			mcp.Enum("list", "set", "enable", "disable", "delete"),
+		),
+		mcp.WithString("name",
+			mcp.Description("Rule name, case-insensitive (required unless listing)"),
+		),
+		mcp.WithString("query",
+			mcp.Description("Gmail query the rule matches, e.g. 'from:billing@example.com has:attachment' (for set)"),
+		),
+		mcp.WithString("actions",
+			mcp.Description("Comma-separated actions, e.g. 'label:Receipts, archive, notify' (for set)"),
+		),
+	)
+
+	adder.AddTool(manageRulesTool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		gmailServer, err := gmailServers.ServerFor(ctx)
+		if err != nil {
+			return toolerr.Result(err, ""), nil
+		}
+
+		return gmailServer.ManageRules(req.GetString("action", "list"), req.GetString("name", ""), req.GetString("query", ""), req.GetString("actions", ""))
+	})
+
+	runRulesNowTool := mcp.NewTool("run_rules_now",
+		mcp.WithDescription("Run the enabled automation rules now, on all current matches they haven't handled yet (up to 50 per rule), instead of waiting for new mail. Each thread a rule acts on is recorded in its activity. Use dry_run first to see what would change."),
+		mcp.WithString("name",
+			mcp.Description("Only run this rule (also runs it when disabled)"),
+		),
+		mcp.WithBoolean("dry_run",
+			mcp.Description("Report the matching threads and the actions that would be taken without changing anything (default: false)"),
+		),
+	)
+
+	adder.AddTool(runRulesNowTool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		gmailServer, errResult := gmailServers.ForRequest(ctx)
+		if errResult != nil {
+			return errResult, nil
+		}
+
+		return gmailServer.RunRulesNow(ctx, req.GetString("name", ""), req.GetBool("dry_run", false))
+	})
+
+	listLabelsTool := mcp.NewTool("list_labels",
+		mcp.WithDescription("List the user's labels as a tree: Gmail nests labels by name, so 'Clients/Acme' is a child of 'Clients'. Each label has its ID, path, colors and visibility; a parent with no ID isn't a label itself. System labels (INBOX, STARRED, ...) are listed by ID. Use it before proposing or creating labels, to fit the existing organization."),
+	)
+
+	adder.AddTool(listLabelsTool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		gmailServer, errResult := gmailServers.ForRequest(ctx)
+		if errResult != nil {
+			return errResult, nil
+		}
+
+		return gmailServer.ListLabels(ctx)
+	})
+
+	createLabelTool := mcp.NewTool("create_label",
+		mcp.WithDescription("Create a label, optionally nested ('Clients/Acme') and colored. Missing parent labels are created too. An existing label is left unchanged."),
+		mcp.WithString("name",
+			mcp.Required(),
+			mcp.Description("Label name; use / to nest it, e.g. 'Clients/Acme/Invoices'"),
+		),
+		mcp.WithString("color",
+			mcp.Description("Background color: a name ("+strings.Join(labelColorNames(), ", ")+") or a #rrggbb color from Gmail's label palette"),
+		),
+		mcp.WithString("text_color",
+			mcp.Description("Text color as #rrggbb, when color is a hex value (default: #ffffff)"),
+		),
+		mcp.WithString("show_in_label_list",
+			mcp.Description("Whether the label shows in Gmail's label list (default: show)"),
+			mcp.Enum("show", "hide", "show_if_unread"),
+		),
+		mcp.WithString("show_in_message_list",
+			mcp.Description("Whether the label shows on messages in the message list (default: show)"),
+			mcp.Enum("show", "hide"),
+		),
+	)
+
+	adder.AddTool(createLabelTool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		gmailServer, errResult := gmailServers.ForRequest(ctx)
+		if errResult != nil {
+			return errResult, nil
+		}
+
+		name, err := req.RequireString("name")
+		if err != nil {
+			return toolerr.Invalid("name parameter is required and must be a string"), nil
+		}
+
+		return gmailServer.CreateLabel(ctx, name, labelSettings{
+			Color:       req.GetString("color", ""),
+			TextColor:   req.GetString("text_color", ""),
+			LabelList:   req.GetString("show_in_label_list", ""),
+			MessageList: req.GetString("show_in_message_list", ""),
+		})
+	})
+}
+
+// RegisterAITools adds the tools that call a language model
+func RegisterAITools(adder ToolAdder, gmailServers Servers) {
+	adder = localized(adder)
+	translateMessageTool := mcp.NewTool("translate_message",
+		mcp.WithDescription("Translate a message's subject and body into another language using OpenAI (requires OPENAI_API_KEY). fetch_email_bodies results include a detected 'language' code to show when this is needed."),
+		mcp.WithString("message_id",
+			mcp.Required(),
+			mcp.Description("The message ID to translate"),
+		),
+		mcp.WithString("target_language",
+			mcp.Description("Language to translate into, e.g. 'English', 'Spanish' or 'ja' (default: English)"),
+		),
+	)
+
+	adder.AddTool(translateMessageTool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		gmailServer, errResult := gmailServers.ForRequest(ctx)
+		if errResult != nil {
+			return errResult, nil
+		}
+
+		messageID, err := req.RequireString("message_id")
+		if err != nil {
+			return toolerr.Invalid("message_id parameter is required and must be a string"), nil
+		}
+
+		return gmailServer.TranslateMessage(ctx, messageID, req.GetString("target_language", "English"))
+	})
+
+	analyzeImageTool := mcp.NewTool("analyze_image_attachment",
+		mcp.WithDescription("Describe an image attachment (receipt photo, whiteboard shot, screenshot) and transcribe its text with a vision model (requires OPENAI_API_KEY or a local vision model). Pass a question to ask something specific instead."),
+		mcp.WithString("message_id",
+			mcp.Required(),
+			mcp.Description("The message ID containing the image"),
+		),
+		mcp.WithString("filename",
+			mcp.Required(),
+			mcp.Description("The filename of the PNG, JPEG, GIF or WebP attachment"),
+		),
+		mcp.WithString("question",
+			mcp.Description("Optional question about the image, e.g. 'What is the total on this receipt?'"),
+		),
+	)
+
+	adder.AddTool(analyzeImageTool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		gmailServer, errResult := gmailServers.ForRequest(ctx)
+		if errResult != nil {
+			return errResult, nil
+		}
+
+		messageID, err := req.RequireString("message_id")
+		if err != nil {
+			return toolerr.Invalid("message_id parameter is required and must be a string"), nil
+		}
+		filename, err := req.RequireString("filename")
+		if err != nil {
+			return toolerr.Invalid("filename parameter is required and must be a string"), nil
+		}
+
+		return gmailServer.AnalyzeImageAttachment(ctx, messageID, filename, req.GetString("question", ""))
+	})
+
+	extractEntitiesTool := mcp.NewTool("extract_entities",
+		mcp.WithDescription("Extract structured data from a message body or one of its attachments as typed JSON: money amounts (with labels like 'total' or 'amount due'), dates (with labels like 'due' or 'departure'), order/invoice/booking confirmation numbers, parcel tracking numbers, flight numbers and postal addresses. Uses regular expressions, optionally refined by OpenAI."),
+		mcp.WithString("message_id",
+			mcp.Required(),
+			mcp.Description("The message ID to extract entities from"),
+		),
+		mcp.WithString("filename",
+			mcp.Description("Extract from this attachment of the message instead of the body (e.g., 'invoice.pdf')"),
+		),
+		mcp.WithBoolean("refine",
+			mcp.Description("Have OpenAI correct and complete the regex results (requires OPENAI_API_KEY; default: false)"),
+		),
+	)
+
+	adder.AddTool(extractEntitiesTool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		gmailServer, errResult := gmailServers.ForRequest(ctx)
+		if errResult != nil {
+			return errResult, nil
+		}
+
+		messageID, err := req.RequireString("message_id")
+		if err != nil {
+			return toolerr.Invalid("message_id parameter is required and must be a string"), nil
+		}
+
+		return gmailServer.ExtractEntities(ctx, messageID, req.GetString("filename", ""), req.GetBool("refine", false))
+	})
+
+	autoLabelTool := mcp.NewTool("auto_label",
+		mcp.WithDescription("Sort unlabeled threads into the user's existing labels with a language model (requires OPENAI_API_KEY or a local model). Labels chosen with at least 'threshold' confidence are applied; the rest come back in 'review' with the suggested label, confidence and reason, for the user to decide. Threads no label fits are listed in 'noMatch'. New labels are never created; see list_labels and create_label. Run with dry_run first to show the user what would change."),
+		mcp.WithString("query",
+			mcp.Description("Gmail query for the threads to classify (default: 'in:inbox has:nouserlabels', inbox threads without any of the user's labels)"),
+		),
+		mcp.WithNumber("max_threads",
+			mcp.Description(fmt.Sprintf("How many matching threads to classify, newest first (default: %d, max: %d)", defaultAutoLabelThreads, maxAutoLabelThreads)),
+		),
+		mcp.WithNumber("threshold",
+			mcp.Description(fmt.Sprintf("Minimum confidence, 0 to 1, for a label to be applied (default: %g)", defaultAutoLabelThreshold)),
+		),
+		mcp.WithBoolean("dry_run",
+			mcp.Description("Classify without applying any labels (default: false)"),
+		),
+	)
+
+	adder.AddTool(autoLabelTool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		gmailServer, errResult := gmailServers.ForRequest(ctx)
+		if errResult != nil {
+			return errResult, nil
+		}
+
+		maxThreads := req.GetInt("max_threads", defaultAutoLabelThreads)
+		if maxThreads <= 0 || maxThreads > maxAutoLabelThreads {
+			return toolerr.Invalid(fmt.Sprintf("max_threads must be between 1 and %d", maxAutoLabelThreads)), nil
+		}
+		threshold := req.GetFloat("threshold", defaultAutoLabelThreshold)
+		if threshold < 0 || threshold > 1 {
+			return toolerr.Invalid("threshold must be between 0 and 1"), nil
+		}
+
+		return gmailServer.AutoLabel(ctx, req.GetString("query", ""), maxThreads, threshold, req.GetBool("dry_run", false))
+	})
+}
+
+// RegisterInsightTools adds the tools that summarize the mailbox: receipts, travel, job applications and activity reports
+func RegisterInsightTools(adder ToolAdder, gmailServers Servers) {
+	adder = localized(adder)
+	collectReceiptsTool := mcp.NewTool("collect_receipts",
+		mcp.WithDescription("Build an expense report from billing emails (receipts, invoices, order and payment confirmations) in a date range. Each row has the date, vendor, total amount, currency, invoice/order reference and messageId; totals are summed per currency. Returns JSON or CSV."),
+		mcp.WithString("after",
+			mcp.Description("Only emails received after this date (YYYY/MM/DD). Defaults to the last 30 days when neither date is set."),
+		),
+		mcp.WithString("before",
+			mcp.Description("Only emails received before this date (YYYY/MM/DD)"),
+		),
+		mcp.WithString("format",
+			mcp.Description("'json' (default) or 'csv'"),
+			mcp.Enum("json", "csv"),
+		),
+		mcp.WithBoolean("include_attachments",
+			mcp.Description("Read attached invoices (PDF, DOCX, ...) when the body has no amount (default: true)"),
+		),
+		mcp.WithNumber("max_results",
+			mcp.Description("Maximum number of billing emails to scan (default: 100, max: 200)"),
+		),
+	)
+
+	adder.AddTool(collectReceiptsTool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		gmailServer, errResult := gmailServers.ForRequest(ctx)
+		if errResult != nil {
+			return errResult, nil
+		}
+
+		maxResults := req.GetInt("max_results", 100)
+		if maxResults > 200 {
+			return toolerr.Invalid("Maximum 200 results allowed per request"), nil
+		}
+
+		return gmailServer.CollectReceipts(ctx, req.GetString("after", ""), req.GetString("before", ""), req.GetString("format", "json"), req.GetBool("include_attachments", true), maxResults)
+	})
+
+	assembleItineraryTool := mcp.NewTool("assemble_itinerary",
+		mcp.WithDescription("Gather flight, hotel and car rental confirmations received in a date range into a chronological itinerary with travel dates, confirmation numbers, flight numbers and addresses. Optionally writes an .ics calendar file of the trip."),
+		mcp.WithString("after",
+			mcp.Description("Only confirmations received after this date (YYYY/MM/DD). Defaults to the last 90 days when neither date is set."),
+		),
+		mcp.WithString("before",
+			mcp.Description("Only confirmations received before this date (YYYY/MM/DD)"),
+		),
+		mcp.WithBoolean("ics",
+			mcp.Description("Also write the itinerary as all-day events to itinerary.ics in the app data directory and return its contents (default: false)"),
+		),
+	)
+
+	adder.AddTool(assembleItineraryTool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		gmailServer, errResult := gmailServers.ForRequest(ctx)
+		if errResult != nil {
+			return errResult, nil
+		}
+
+		return gmailServer.AssembleItinerary(ctx, req.GetString("after", ""), req.GetString("before", ""), req.GetBool("ics", false))
+	})
+
+	extractDeadlinesTool := mcp.NewTool("extract_deadlines",
+		mcp.WithDescription("Scan recent mail for deadlines and commitments (\"by Friday\", \"due March 3\", \"no later than end of month at 5pm\") and list them in date order as absolute dates in the user's time zone, read against the date of the message they appear in. Each has the sentence it came from, who has to act where the wording says (you or them), and the source message, thread and link. Quoted replies are skipped. Optionally writes them to an .ics calendar file."),
+		mcp.WithNumber("days",
+			mcp.Description("How many days of mail to scan (default: 14, max: 90)"),
+		),
+		mcp.WithString("query",
+			mcp.Description("Optional Gmail query to narrow the scan, e.g. 'from:@acme.com' or 'label:work'"),
+		),
+		mcp.WithBoolean("include_past",
+			mcp.Description("Also list deadlines that have already passed (default: false)"),
+		),
+		mcp.WithBoolean("ics",
+			mcp.Description("Also write the deadlines as calendar events to deadlines.ics in the app data directory and return its contents (default: false)"),
+		),
+	)
+
+	adder.AddTool(extractDeadlinesTool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		gmailServer, errResult := gmailServers.ForRequest(ctx)
+		if errResult != nil {
+			return errResult, nil
+		}
+
+		return gmailServer.ExtractDeadlines(ctx, req.GetInt("days", defaultDeadlineDays), req.GetString("query", ""), req.GetBool("include_past", false), req.GetBool("ics", false))
+	})
+
+	unansweredQuestionsTool := mcp.NewTool("unanswered_questions",
+		mcp.WithDescription("List the explicit questions people asked the user in recent inbox mail that the user hasn't replied to since, oldest first, each with the sender, how long it has waited, the questions quoted and a link to the thread. Narrower than the needs-reply view: only mail addressed to the user in To, only sentences that ask the user something, leaving out questions put to another recipient by name (\"Sam, can you...?\"), stock footer questions (\"Questions?\") and automated mail."),
+		mcp.WithNumber("days",
+			mcp.Description("How many days of inbox mail to check (default: 7, max: 30)"),
+		),
+		mcp.WithString("query",
+			mcp.Description("Optional Gmail query to narrow the check, e.g. 'from:@acme.com' or 'label:work'"),
+		),
+	)
+
+	adder.AddTool(unansweredQuestionsTool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		gmailServer, errResult := gmailServers.ForRequest(ctx)
+		if errResult != nil {
+			return errResult, nil
+		}
+
+		return gmailServer.UnansweredQuestions(ctx, req.GetInt("days", defaultQuestionDays), req.GetString("query", ""))
+	})
+
+	trackApplicationsTool := mcp.NewTool("track_applications",
+		mcp.WithDescription("Report a job search pipeline from recruiter and job application threads: company, role, stage (outreach, applied, assessment, interview, offer or rejected), last contact date, whose turn it is, and whether a CV/resume was sent. Includes a markdown table."),
+		mcp.WithNumber("months",
+			mcp.Description("How many months back to look (default: 6, max: 24)"),
+		),
+	)
+
+	adder.AddTool(trackApplicationsTool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		gmailServer, errResult := gmailServers.ForRequest(ctx)
+		if errResult != nil {
+			return errResult, nil
+		}
+
+		months := req.GetInt("months", 6)
+		if months > 24 {
+			return toolerr.Invalid("Maximum 24 months allowed per request"), nil
+		}
+
+		return gmailServer.TrackApplications(ctx, months)
+	})
+
+	trackProjectTool := mcp.NewTool("track_project",
+		mcp.WithDescription("Group the threads and searches of one project (a deal, a hire, a renovation) under a name, so gmail://project/{name} answers \"where does it stand\" in one read: the latest development, open items, people involved and every related thread's state. Projects are stored locally in projects.json, which the user can also edit."),
+		mcp.WithString("action",
+			mcp.Description("list (default), add (threads and/or a query, creating the project), remove (threads and/or a query) or delete (the whole project)"),
+			mcp.Enum("list", "add", "remove", "delete"),
+		),
+		mcp.WithString("name",
+			mcp.Description("Project name, e.g. 'acme-deal' (case-insensitive; spaces become dashes)"),
+		),
+		mcp.WithString("thread_ids",
+			mcp.Description("Comma-separated thread IDs to add or remove"),
+		),
+		mcp.WithString("query",
+			mcp.Description("A Gmail query whose recent matches belong to the project, e.g. 'from:@acme.com OR subject:acme'"),
+		),
+	)
+
+	adder.AddTool(trackProjectTool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		gmailServer, errResult := gmailServers.ForRequest(ctx)
+		if errResult != nil {
+			return errResult, nil
+		}
+
+		var threadIDs []string
+		for _, id := range strings.Split(req.GetString("thread_ids", ""), ",") {
+			if id = strings.TrimSpace(id); id != "" {
+				threadIDs = append(threadIDs, id)
+			}
+		}
+
+		return gmailServer.TrackProject(ctx, req.GetString("action", "list"), req.GetString("name", ""), threadIDs, req.GetString("query", ""))
+	})
+
+	summarizeAgreementsTool := mcp.NewTool("summarize_agreements",
+		mcp.WithDescription("Build a decision log of a negotiation (contract, vendor or hiring threads): who proposed, agreed to, rejected or decided what and when, with the amounts and dates named, each entry citing its message. Agreements and rejections point at the proposal they answer, and proposals nobody answered are listed as open. The 'log' field is markdown. Runs locally on the message text; give a thread or a project from track_project."),
+		mcp.WithString("thread_id",
+			mcp.Description("The thread to summarize"),
+		),
+		mcp.WithString("project",
+			mcp.Description("A project from track_project, to summarize all its threads at once"),
+		),
+	)
+
+	adder.AddTool(summarizeAgreementsTool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		gmailServer, errResult := gmailServers.ForRequest(ctx)
+		if errResult != nil {
+			return errResult, nil
+		}
+
+		return gmailServer.SummarizeAgreements(ctx, req.GetString("thread_id", ""), req.GetString("project", ""))
+	})
+
+	weeklyReportTool := mcp.NewTool("weekly_report",
+		mcp.WithDescription("Build an email activity report for the past week (or days): received and sent volumes against the period before, top correspondents, unanswered threads from people, median time to reply and notable attachments. The 'report' field is markdown ready to paste into a review doc. Set email_to_self to also send it to the user's own address; if Gmail is unavailable the send is queued and retried (see outbox_status)."),
+		mcp.WithNumber("days",
+			mcp.Description("How many days to cover (default: 7, max: 90)"),
+		),
+		mcp.WithBoolean("email_to_self",
+			mcp.Description("Also email the report to the user's own address (default: false). It is never sent to anyone else."),
+		),
+		mcp.WithString("category",
+			mcp.Description("Only report on threads received in this inbox tab, e.g. primary to leave out newsletters and notifications"),
+			mcp.Enum(categoryNames()...),
+		),
+	)
+
+	adder.AddTool(weeklyReportTool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		gmailServer, errResult := gmailServers.ForRequest(ctx)
+		if errResult != nil {
+			return errResult, nil
+		}
+
+		days := req.GetInt("days", 7)
+		if days > 90 {
+			return toolerr.Invalid("Maximum 90 days allowed per report"), nil
+		}
+
+		category := req.GetString("category", "")
+		if !validCategory(category) {
+			return invalidCategoryError(category), nil
+		}
+
+		return gmailServer.WeeklyReport(ctx, days, category, req.GetBool("email_to_self", false))
+	})
+
+	manageDigestsTool := mcp.NewTool("manage_digests",
+		mcp.WithDescription("Schedule reports to be emailed to the user's own address, sent by the server in the background even when no MCP client is connected: daily_digest (the past day's activity), weekly_report (the past week's activity) or follow_ups (threads where the user wrote last and has waited 3+ days for a reply). Sends go through the outbox, so they're retried if Gmail is unavailable. Digests are never sent to anyone else. 'send_now' sends one immediately."),
+		mcp.WithString("action",
+			mcp.Description("'list' (default), 'set' (create or replace a digest), 'delete' or 'send_now'"),
+			mcp.Enum("list", "set", "delete", "send_now"),
+		),
+		mcp.WithString("name",
+			mcp.Description("Digest name, case-insensitive (required unless listing)"),
+		),
+		mcp.WithString("report",
+			mcp.Description("Which report to send (for set)"),
+			mcp.Enum(digestReports...),
+		),
+		mcp.WithString("schedule",
+			mcp.Description("How often to send it (default: weekly for weekly_report, otherwise daily)"),
+			mcp.Enum(digestSchedules...),
+		),
+		mcp.WithString("at",
+			mcp.Description("Time of day to send it, 24-hour HH:MM in the user's time zone (default: 08:00)"),
+		),
+		mcp.WithString("weekday",
+			mcp.Description("Day to send a weekly digest, e.g. 'friday' (default: monday)"),
+		),
+		mcp.WithString("category",
+			mcp.Description("Only report on threads received in this inbox tab (daily_digest and weekly_report)"),
+			mcp.Enum(categoryNames()...),
+		),
+	)
+
+	adder.AddTool(manageDigestsTool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		action := req.GetString("action", "list")
+		var gmailServer Mailbox
+		if action == "send_now" {
+			var errResult *mcp.CallToolResult
+			if gmailServer, errResult = gmailServers.ForRequest(ctx); errResult != nil {
+				return errResult, nil
+			}
+		} else {
+			var err error
+			if gmailServer, err = gmailServers.ServerFor(ctx); err != nil {
+				return toolerr.Result(err, ""), nil
+			}
+		}
+
+		category := req.GetString("category", "")
+		if !validCategory(category) {
+			return invalidCategoryError(category), nil
+		}
+
+		return gmailServer.ManageDigests(ctx, action, digest{
+			Name:     req.GetString("name", ""),
+			Report:   req.GetString("report", ""),
+			Schedule: req.GetString("schedule", ""),
+			At:       req.GetString("at", ""),
+			Weekday:  req.GetString("weekday", ""),
+			Category: category,
+		})
+	})
+
+	outboxStatusTool := mcp.NewTool("outbox_status",
+		mcp.WithDescription("List mail the server queued for sending (e.g. weekly_report with email_to_self): queued sends waiting for a retry, sent messages and permanent failures with their last error. Sends that fail because Gmail is unavailable are retried automatically with backoff, and sends over the hourly, daily or per-recipient limits wait until they fit. Also returns the limits and recent usage."),
+		mcp.WithString("retry_id",
+			mcp.Description("Optional ID of a failed entry to queue for another attempt"),
+		),
+		mcp.WithString("cancel_merge_id",
+			mcp.Description("Optional mergeId from mail_merge; cancels that merge's scheduled sends that haven't gone out yet"),
+		),
+	)
+
+	adder.AddTool(outboxStatusTool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		gmailServer, errResult := gmailServers.ForRequest(ctx)
+		if errResult != nil {
+			return errResult, nil
+		}
+
+		return gmailServer.OutboxStatus(ctx, req.GetString("retry_id", ""), req.GetString("cancel_merge_id", ""))
+	})
+}
+
+// RegisterStyleTools adds the personal email style guide tools
+func RegisterStyleTools(adder ToolAdder, gmailServers Servers) {
+	adder = localized(adder)
+	// TEMPORARY HACK: Add personal email style guide as a tool
+	// This is only needed until more MCP clients support resource-fetching properly
+	// TODO: Remove this tool once resource support is more widespread
+	getStyleGuideTool := mcp.NewTool("get_personal_email_style_guide",
+		mcp.WithDescription("Get the user's personal email writing style guide. IMPORTANT: Always call this tool BEFORE drafting any emails to understand the user's writing style and tone. This is a temporary tool that will be removed once more agents support resource-fetching."),
+	)
+
+	adder.AddTool(getStyleGuideTool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		gmailServer, err := gmailServers.ServerFor(ctx)
+		if err != nil {
+			return toolerr.Result(err, ""), nil
+		}
+
+		// Read the personal email style guide file
+		styleFilePath := gmailServer.StyleGuideFile()
+		content, err := os.ReadFile(styleFilePath)
+		if err != nil {
+			if os.IsNotExist(err) {
+				// Try to auto-generate if file doesn't exist
+				if genErr := style.EnsureExists(gmailServer, gmailServer.StyleGuideFile()); genErr != nil {
+					return toolerr.Result(genErr, ""), nil
+				}
+				// Try reading again after generation
+				content, err = os.ReadFile(styleFilePath)
+				if err != nil {
+					return toolerr.Result(err, "Failed to read generated style guide"), nil
+				}
+			} else {
+				return toolerr.Result(err, fmt.Sprintf("Failed to read style guide at %s", styleFilePath)), nil
+			}
+		}
+
+		return mcp.NewToolResultText(string(content)), nil
+	})
+
+	updateStyleGuideTool := mcp.NewTool("update_style_guide",
+		mcp.WithDescription("Add the user's own corrections or additions to their personal email style guide (e.g. 'Never use \"Cheers\"', 'Sign off with just my first name'). They are kept in a separate User Edits section that takes precedence over the generated guide and survives regeneration."),
+		mcp.WithString("text",
+			mcp.Required(),
+			mcp.Description("The additions or corrections, in markdown; plain lines become bullets"),
+		),
+		mcp.WithString("mode",
+			mcp.Description("append (default) adds to the existing user edits; replace overwrites them (an empty text clears them)"),
+			mcp.Enum("append", "replace"),
+		),
+	)
+
+	adder.AddTool(updateStyleGuideTool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		gmailServer, err := gmailServers.ServerFor(ctx)
+		if err != nil {
+			return toolerr.Result(err, ""), nil
+		}
+
+		return gmailServer.UpdateStyleGuide(req.GetString("text", ""), req.GetString("mode", "append"))
+	})
+}
+
+// RegisterMemoryTools adds the tools that remember facts across sessions
+func RegisterMemoryTools(adder ToolAdder, gmailServers Servers) {
+	adder = localized(adder)
+	rememberFactTool := mcp.NewTool("remember_fact",
+		mcp.WithDescription("Remember a fact or preference about the user's email for future sessions (e.g. \"user prefers to decline cold outreach politely\", \"Dana is the user's manager\"). Facts are stored locally for this mailbox and readable with recall_facts or the gmail://memory resource. Don't store passwords or other secrets."),
+		mcp.WithString("fact",
+			mcp.Required(),
+			mcp.Description("The fact to remember, as one self-contained sentence (max 1000 characters)"),
+		),
+		mcp.WithString("tags",
+			mcp.Description("Optional comma-separated tags for finding the fact later (e.g. 'preferences,recruiting')"),
+		),
+	)
+
+	adder.AddTool(rememberFactTool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		gmailServer, err := gmailServers.ServerFor(ctx)
+		if err != nil {
+			return toolerr.Result(err, ""), nil
+		}
+
+		fact, err := req.RequireString("fact")
+		if err != nil {
+			return toolerr.Invalid("fact parameter is required and must be a string"), nil
+		}
+
+		var tags []string
+		if tagList := req.GetString("tags", ""); tagList != "" {
+			tags = strings.Split(tagList, ",")
+		}
+
+		return gmailServer.RememberFact(fact, tags)
+	})
+
+	recallFactsTool := mcp.NewTool("recall_facts",
+		mcp.WithDescription("Recall facts and preferences remembered with remember_fact in earlier sessions, newest first. Call this before drafting or triaging to apply what the user has asked for before."),
+		mcp.WithString("query",
+			mcp.Description("Only return facts containing all of these words (optional)"),
+		),
+		mcp.WithString("tag",
+			mcp.Description("Only return facts with this tag (optional)"),
+		),
+	)
+
+	adder.AddTool(recallFactsTool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		gmailServer, err := gmailServers.ServerFor(ctx)
+		if err != nil {
+			return toolerr.Result(err, ""), nil
+		}
+
+		return gmailServer.RecallFacts(req.GetString("query", ""), req.GetString("tag", ""))
+	})
+}
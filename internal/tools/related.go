@@ -0,0 +1,212 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"google.golang.org/api/gmail/v1"
+
+	"auto-gmail/internal/toolerr"
+)
+
+// Related-thread thresholds: how alike two threads must be to count as one conversation
+const (
+	// maxRelatedCandidates caps the threads searched for by subject
+	maxRelatedCandidates = 25
+	// relatedSubjectOverlap is the share of subject words both threads must have in common
+	relatedSubjectOverlap = 0.8
+	// maxMergedMessages caps the merged conversation
+	maxMergedMessages = 100
+)
+
+// relatedThread is a thread and what tied it to the conversation
+type relatedThread struct {
+	thread       *gmail.Thread
+	participants []string
+	first, last  int64
+	reasons      []string
+}
+
+// FindRelatedThreads finds threads that are really the same conversation as threadID
+// but were split by clients that break threading: the same subject once Re:/Fwd: are
+// stripped, overlapping participants and messages within windowDays of each other.
+// Threads related to a related thread count too. With merge, every message of the
+// conversation is listed in date order.
+func (g *GmailServer) FindRelatedThreads(ctx context.Context, threadID string, windowDays int, merge bool) (*mcp.CallToolResult, error) {
+	if windowDays <= 0 {
+		windowDays = 30
+	}
+	window := int64(windowDays) * int64(24*time.Hour/time.Millisecond)
+	me := g.userEmail(ctx)
+
+	source, err := g.getThread(ctx, threadID, 0)
+	if err != nil {
+		return toolerr.Result(err, "Failed to get thread"), nil
+	}
+	if len(source.Messages) == 0 {
+		return toolerr.New(toolerr.NotFound, "thread_empty", fmt.Sprintf("Thread %s has no messages", threadID)).Result(), nil
+	}
+	stem := subjectStem(messageHeader(source.Messages[0], "Subject"))
+	if stem == "" {
+		return toolerr.Invalid("The thread has no subject to match other threads by"), nil
+	}
+
+	var terms []string
+	for _, word := range strings.Fields(stem)[:min(maxStemWords, len(strings.Fields(stem)))] {
+		if word = strings.Trim(word, `.,:;!?"'()`); word != "" {
+			terms = append(terms, "subject:"+word)
+		}
+	}
+	list, err := g.client.ListThreads(ctx, strings.Join(terms, " "), maxRelatedCandidates)
+	if err != nil {
+		return toolerr.Result(err, "Failed to search threads"), nil
+	}
+	details := g.hydrateThreads(ctx, list.Threads)
+
+	cluster := []*relatedThread{newRelatedThread(source, me)}
+	var pending []*relatedThread
+	for _, thread := range list.Threads {
+		if detail, ok := details[thread.Id]; ok && thread.Id != source.Id && len(detail.Messages) > 0 {
+			pending = append(pending, newRelatedThread(detail, me))
+		}
+	}
+
+	// Grow the conversation until no remaining thread relates to any member
+	for added := true; added; {
+		added = false
+		for i := 0; i < len(pending); i++ {
+			candidate := pending[i]
+			for _, member := range cluster {
+				if reasons := relatedReasons(member, candidate, stem, window); reasons != nil {
+					candidate.reasons = reasons
+					if member.thread.Id != source.Id {
+						candidate.reasons = append(candidate.reasons, "via thread "+member.thread.Id)
+					}
+					cluster = append(cluster, candidate)
+					pending = append(pending[:i], pending[i+1:]...)
+					i--
+					added = true
+					break
+				}
+			}
+		}
+	}
+	sort.Slice(cluster, func(i, j int) bool {
+		return cluster[i].first < cluster[j].first
+	})
+
+	threads := make([]map[string]interface{}, len(cluster))
+	messageCount := 0
+	for i, member := range cluster {
+		messageCount += len(member.thread.Messages)
+		threads[i] = map[string]interface{}{
+			"threadId":     member.thread.Id,
+			"subject":      messageHeader(member.thread.Messages[0], "Subject"),
+			"messageCount": len(member.thread.Messages),
+			"firstMessage": formatInternalDate(member.first),
+			"lastMessage":  formatInternalDate(member.last),
+			"participants": member.participants,
+			"isSource":     member.thread.Id == source.Id,
+		}
+		if len(member.reasons) > 0 {
+			threads[i]["reasons"] = member.reasons
+		}
+	}
+
+	result := map[string]interface{}{
+		"threadId":          threadID,
+		"subjectStem":       stem,
+		"windowDays":        windowDays,
+		"candidatesScanned": len(list.Threads),
+		"threads":           threads,
+		"relatedCount":      len(cluster) - 1,
+		"messageCount":      messageCount,
+	}
+	if merge {
+		result["conversation"] = mergedConversation(cluster)
+	}
+
+	resultJSON, _ := json.MarshalIndent(result, "", "  ")
+	return mcp.NewToolResultText(string(resultJSON)), nil
+}
+
+// newRelatedThread collects a thread's participants (other than me) and time span
+func newRelatedThread(thread *gmail.Thread, me string) *relatedThread {
+	related := &relatedThread{thread: thread}
+	seen := map[string]bool{}
+	for _, message := range thread.Messages {
+		for _, participant := range messageParticipants(message, me) {
+			if !seen[participant] {
+				seen[participant] = true
+				related.participants = append(related.participants, participant)
+			}
+		}
+		if related.first == 0 || message.InternalDate < related.first {
+			related.first = message.InternalDate
+		}
+		if message.InternalDate > related.last {
+			related.last = message.InternalDate
+		}
+	}
+	return related
+}
+
+// relatedReasons returns why candidate belongs to member's conversation, or nil when it doesn't:
+// the subject must match and they must share a participant within the time window
+func relatedReasons(member, candidate *relatedThread, stem string, window int64) []string {
+	candidateStem := subjectStem(messageHeader(candidate.thread.Messages[0], "Subject"))
+	if candidateStem != stem && (wordOverlap(stem, candidateStem) < relatedSubjectOverlap || wordOverlap(candidateStem, stem) < relatedSubjectOverlap) {
+		return nil
+	}
+	shared := jaccard(member.participants, candidate.participants)
+	if shared == 0 && (len(member.participants) > 0 || len(candidate.participants) > 0) {
+		return nil
+	}
+	gap := max(candidate.first-member.last, member.first-candidate.last, 0)
+	if gap > window {
+		return nil
+	}
+
+	reasons := []string{"same subject"}
+	if candidateStem != stem {
+		reasons[0] = "nearly the same subject"
+	}
+	reasons = append(reasons, fmt.Sprintf("%.0f%% shared participants", shared*100))
+	if gap == 0 {
+		reasons = append(reasons, "overlapping in time")
+	} else {
+		reasons = append(reasons, fmt.Sprintf("%s apart", waitingTime(time.Duration(gap)*time.Millisecond)))
+	}
+	return reasons
+}
+
+// mergedConversation lists every message of the related threads in date order
+func mergedConversation(cluster []*relatedThread) []map[string]interface{} {
+	var messages []*gmail.Message
+	for _, member := range cluster {
+		messages = append(messages, member.thread.Messages...)
+	}
+	sort.SliceStable(messages, func(i, j int) bool {
+		return messages[i].InternalDate < messages[j].InternalDate
+	})
+	if len(messages) > maxMergedMessages {
+		messages = messages[len(messages)-maxMergedMessages:]
+	}
+
+	conversation := make([]map[string]interface{}, len(messages))
+	for i, message := range messages {
+		conversation[i] = map[string]interface{}{
+			"messageId": message.Id,
+			"threadId":  message.ThreadId,
+			"from":      messageHeader(message, "From"),
+			"date":      formatInternalDate(message.InternalDate),
+			"snippet":   message.Snippet,
+		}
+	}
+	return conversation
+}
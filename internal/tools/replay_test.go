@@ -0,0 +1,213 @@
+package tools
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+
+	"auto-gmail/internal/gmailclient"
+
+	"google.golang.org/api/googleapi"
+)
+
+// fakeTransport serves the Gmail REST endpoints the read-only tools use, and the
+// batch endpoint, from a Fake, so an APIClient can run against the fixture mailbox
+type fakeTransport struct {
+	fake *gmailclient.Fake
+}
+
+func (t fakeTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method == http.MethodPost && req.URL.Path == "/batch/gmail/v1" {
+		return t.batch(req)
+	}
+	status, body := t.serve(req.Context(), req.Method, req.URL.Path, req.URL.Query())
+	return jsonResponse(req, status, body), nil
+}
+
+// serve answers one API request with its status and JSON body
+func (t fakeTransport) serve(ctx context.Context, method, path string, query url.Values) (int, []byte) {
+	rest, ok := strings.CutPrefix(path, "/gmail/v1/users/me/")
+	if !ok || method != http.MethodGet {
+		return errorBody(http.StatusNotImplemented, fmt.Sprintf("%s %s isn't served by the fake", method, path))
+	}
+	segments := strings.Split(rest, "/")
+	for i, segment := range segments {
+		segments[i], _ = url.PathUnescape(segment)
+	}
+	opts := gmailclient.GetOptions{Format: query.Get("format"), MetadataHeaders: query["metadataHeaders"]}
+	maxResults, _ := strconv.ParseInt(query.Get("maxResults"), 10, 64)
+
+	var result interface{}
+	var err error
+	switch {
+	case len(segments) == 1 && segments[0] == "profile":
+		result, err = t.fake.GetProfile(ctx)
+	case len(segments) == 1 && segments[0] == "threads":
+		result, err = t.fake.ListThreads(ctx, query.Get("q"), maxResults)
+	case len(segments) == 2 && segments[0] == "threads":
+		result, err = t.fake.GetThread(ctx, segments[1], opts)
+	case len(segments) == 1 && segments[0] == "messages":
+		result, err = t.fake.ListMessages(ctx, query.Get("q"), maxResults)
+	case len(segments) == 2 && segments[0] == "messages":
+		result, err = t.fake.GetMessage(ctx, segments[1], opts)
+	case len(segments) == 4 && segments[0] == "messages" && segments[2] == "attachments":
+		result, err = t.fake.GetAttachment(ctx, segments[1], segments[3])
+	case len(segments) == 1 && segments[0] == "drafts":
+		result, err = t.fake.ListDrafts(ctx)
+	case len(segments) == 2 && segments[0] == "drafts":
+		result, err = t.fake.GetDraft(ctx, segments[1], opts)
+	case len(segments) == 1 && segments[0] == "labels":
+		result, err = t.fake.ListLabels(ctx)
+	default:
+		return errorBody(http.StatusNotImplemented, fmt.Sprintf("%s %s isn't served by the fake", method, path))
+	}
+
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) {
+		return errorBody(apiErr.Code, apiErr.Message)
+	}
+	if err != nil {
+		return errorBody(http.StatusInternalServerError, err.Error())
+	}
+	body, err := json.Marshal(result)
+	if err != nil {
+		return errorBody(http.StatusInternalServerError, err.Error())
+	}
+	return http.StatusOK, body
+}
+
+// batch answers each GET in a multipart/mixed batch request with a part of its own
+func (t fakeTransport) batch(req *http.Request) (*http.Response, error) {
+	_, params, err := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, err
+	}
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	reader := multipart.NewReader(req.Body, params["boundary"])
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, err := bufio.NewReader(part).ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		method, target, _ := strings.Cut(strings.TrimSpace(line), " ")
+		target, err = url.PathUnescape(target)
+		if err != nil {
+			return nil, err
+		}
+		path, rawQuery, _ := strings.Cut(target, "?")
+		query, _ := url.ParseQuery(rawQuery)
+		status, itemBody := t.serve(req.Context(), method, path, query)
+
+		partHeader := textproto.MIMEHeader{}
+		partHeader.Set("Content-Type", "application/http")
+		partHeader.Set("Content-ID", "<response-"+strings.Trim(part.Header.Get("Content-ID"), "<>")+">")
+		itemPart, err := writer.CreatePart(partHeader)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(itemPart, "HTTP/1.1 %d %s\r\nContent-Type: application/json\r\nContent-Length: %d\r\n\r\n%s",
+			status, http.StatusText(status), len(itemBody), itemBody)
+	}
+	writer.Close()
+
+	resp := jsonResponse(req, http.StatusOK, body.Bytes())
+	resp.Header.Set("Content-Type", "multipart/mixed; boundary="+writer.Boundary())
+	return resp, nil
+}
+
+// errorBody is a Gmail API error response
+func errorBody(status int, message string) (int, []byte) {
+	body, _ := json.Marshal(map[string]interface{}{"error": map[string]interface{}{"code": status, "message": message}})
+	return status, body
+}
+
+func jsonResponse(req *http.Request, status int, body []byte) *http.Response {
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": {"application/json"}},
+		ContentLength: int64(len(body)),
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		Request:       req,
+	}
+}
+
+// replayCalls are the tool calls recorded against the fake and then replayed
+var replayCalls = []struct {
+	name      string
+	arguments map[string]interface{}
+}{
+	{"search_threads", map[string]interface{}{"query": "from:alice"}},
+	{"search_threads", map[string]interface{}{"query": "in:inbox", "sort": "oldest"}},
+	{"fetch_email_bodies", map[string]interface{}{"thread_ids": planningThread + ", " + invoiceThread}},
+	{"fetch_email_bodies", map[string]interface{}{"thread_ids": "no-such-thread"}},
+}
+
+// runReplayCalls makes every call in replayCalls and returns their outputs
+func runReplayCalls(t *testing.T, client gmailclient.Client) []string {
+	t.Helper()
+	tools := newTestTools(t, client)
+	outputs := make([]string, len(replayCalls))
+	for i, c := range replayCalls {
+		outputs[i] = text(t, tools.call(t, c.name, c.arguments))
+	}
+	return outputs
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	recordingClient := gmailclient.RecordHTTPClient(&http.Client{Transport: fakeTransport{fake: loadFake(t)}}, dir)
+	online, err := gmailclient.NewAPIClient(ctx, recordingClient, "me")
+	if err != nil {
+		t.Fatalf("NewAPIClient() error = %v", err)
+	}
+	recorded := runReplayCalls(t, online)
+
+	offline, err := gmailclient.NewReplayClient(ctx, dir)
+	if err != nil {
+		t.Fatalf("NewReplayClient() error = %v", err)
+	}
+	replayed := runReplayCalls(t, offline)
+
+	for i, c := range replayCalls {
+		if replayed[i] != recorded[i] {
+			t.Errorf("%s %v replayed as\n%s\nwant the recorded\n%s", c.name, c.arguments, replayed[i], recorded[i])
+		}
+	}
+	// The recording has to hold the mailbox, not a run of errors
+	if !strings.Contains(recorded[0], planningThread) {
+		t.Errorf("search_threads recorded %s, want the planning thread", recorded[0])
+	}
+	var threads []threadResult
+	if err := json.Unmarshal([]byte(recorded[2]), &threads); err != nil {
+		t.Fatalf("fetch_email_bodies output isn't JSON: %v\n%s", err, recorded[2])
+	}
+	if len(threads) != 2 || threads[0].ThreadID != planningThread || threads[0].FullBody == "" {
+		t.Errorf("fetch_email_bodies recorded %s, want both threads with their bodies", recorded[2])
+	}
+}
@@ -0,0 +1,474 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/mail"
+	"sort"
+	"strings"
+	"time"
+
+	"auto-gmail/internal/config"
+	"auto-gmail/internal/extract"
+	"auto-gmail/internal/i18n"
+	"auto-gmail/internal/toolerr"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"google.golang.org/api/gmail/v1"
+)
+
+// maxReportScan caps how many messages the activity report inspects
+const maxReportScan = 500
+
+// maxReportAttachmentScan caps how many messages with attachments the report opens
+const maxReportAttachmentScan = 50
+
+// Report section sizes
+const (
+	reportTopCorrespondents = 5
+	reportMaxUnanswered     = 10
+	reportMaxAttachments    = 10
+)
+
+// activityPeriod is the volume and reply speed for one report period
+type activityPeriod struct {
+	Received           int `json:"received"`
+	Sent               int `json:"sent"`
+	Replies            int `json:"replies"`
+	MedianReplyMinutes int `json:"medianReplyMinutes,omitempty"`
+}
+
+// correspondent is one person's message counts in the report period
+type correspondent struct {
+	Address  string `json:"address"`
+	Name     string `json:"name,omitempty"`
+	Received int    `json:"received"`
+	Sent     int    `json:"sent"`
+}
+
+// unansweredThread is a thread whose latest message, from a person, has no reply
+type unansweredThread struct {
+	ThreadID    string `json:"threadId"`
+	Subject     string `json:"subject"`
+	From        string `json:"from"`
+	Received    string `json:"received"`
+	WaitingDays int    `json:"waitingDays"`
+}
+
+// reportAttachment is a file sent or received in the report period
+type reportAttachment struct {
+	Filename  string `json:"filename"`
+	Size      int64  `json:"size"`
+	From      string `json:"from"`
+	Subject   string `json:"subject"`
+	MessageID string `json:"messageId"`
+}
+
+// activityReport is the weekly_report result
+type activityReport struct {
+	Days           int                `json:"days"`
+	Category       string             `json:"category,omitempty"`
+	From           string             `json:"from"`
+	To             string             `json:"to"`
+	Current        activityPeriod     `json:"current"`
+	Previous       activityPeriod     `json:"previous"`
+	Correspondents []correspondent    `json:"topCorrespondents"`
+	Unanswered     []unansweredThread `json:"unanswered"`
+	Attachments    []reportAttachment `json:"attachments"`
+	// Categories counts the period's received messages per inbox tab
+	Categories map[string]int `json:"categories"`
+	Markdown   string         `json:"report"`
+}
+
+// WeeklyReport summarizes the past days of email: volumes against the period before,
+// top correspondents, unanswered threads, time to reply, notable attachments and mail
+// per inbox tab. A category limits it to threads received in that tab. With emailToSelf
+// the report is also sent to the user's own address.
+func (g *GmailServer) WeeklyReport(ctx context.Context, days int, category string, emailToSelf bool) (*mcp.CallToolResult, error) {
+	report, err := g.buildActivityReport(ctx, days, category)
+	if err != nil {
+		return toolerr.Result(err, "Failed to build report"), nil
+	}
+
+	result := map[string]interface{}{
+		"days":              report.Days,
+		"from":              report.From,
+		"to":                report.To,
+		"current":           report.Current,
+		"previous":          report.Previous,
+		"topCorrespondents": report.Correspondents,
+		"unanswered":        report.Unanswered,
+		"attachments":       report.Attachments,
+		"categories":        report.Categories,
+		"report":            report.Markdown,
+	}
+	if report.Category != "" {
+		result["category"] = report.Category
+	}
+
+	if emailToSelf {
+		me := g.userEmail(ctx)
+		if me == "" {
+			return toolerr.New(toolerr.Unavailable, "profile_unavailable", "Could not look up your address to email the report").Result(), nil
+		}
+		subject := i18n.T("report.subject", "Email activity report: %s to %s", reportDate(report.From), reportDate(report.To))
+		// The outbox retries the send in the background if Gmail is unavailable
+		sent, err := g.queueSend(ctx, me, subject, reportEmail(me, subject, report.Markdown))
+		if err != nil {
+			return toolerr.Result(err, "Report built but failed to email it"), nil
+		}
+		switch sent.Status {
+		case outboxSent:
+			result["emailedTo"] = me
+			result["emailMessageId"] = sent.MessageID
+		case outboxQueued:
+			result["emailQueued"] = map[string]interface{}{
+				"outboxId":    sent.ID,
+				"nextAttempt": sent.NextAttempt.Format(time.RFC3339),
+				"lastError":   sent.LastError,
+			}
+		default:
+			return toolerr.FromText("Report built but failed to email it: " + sent.LastError).Result(), nil
+		}
+	}
+
+	resultJSON, _ := json.MarshalIndent(result, "", "  ")
+	return mcp.NewToolResultText(string(resultJSON)), nil
+}
+
+// buildActivityReport gathers the report for the past days (default 7), only over
+// threads received in category when one is given
+func (g *GmailServer) buildActivityReport(ctx context.Context, days int, category string) (*activityReport, error) {
+	if days <= 0 {
+		days = 7
+	}
+	now := time.Now()
+	periodStart := now.Add(-time.Duration(days) * 24 * time.Hour).UnixMilli()
+	me := g.userEmail(ctx)
+
+	// One scan covers this period and the one before it, for the trend
+	list, err := g.client.ListMessages(ctx, fmt.Sprintf("newer_than:%dd", 2*days), maxReportScan)
+	if err != nil {
+		return nil, err
+	}
+	messageIDs := make([]string, len(list.Messages))
+	for i, msg := range list.Messages {
+		messageIDs[i] = msg.Id
+	}
+	hydrated := g.hydrateMessageHeaders(ctx, messageIDs, []string{"From", "To", "Cc", "Subject", "List-Id", "List-Unsubscribe"})
+
+	threads := map[string][]*gmail.Message{}
+	inCategory := map[string]bool{}
+	for _, id := range messageIDs {
+		if message, ok := hydrated[id]; ok {
+			threads[message.ThreadId] = append(threads[message.ThreadId], message)
+			if !hasLabelID(message, "SENT") && messageCategory(message) == category {
+				inCategory[message.ThreadId] = true
+			}
+		}
+	}
+	// Sent mail has no tab, so a category keeps the whole thread of mail received in it
+	if category != "" {
+		for threadID := range threads {
+			if !inCategory[threadID] {
+				delete(threads, threadID)
+			}
+		}
+	}
+
+	report := &activityReport{
+		Days:       days,
+		Category:   category,
+		From:       time.UnixMilli(periodStart).In(config.TimeZone()).Format("2006-01-02"),
+		To:         now.In(config.TimeZone()).Format("2006-01-02"),
+		Categories: map[string]int{},
+	}
+	people := map[string]*correspondent{}
+	var currentReplies, previousReplies []time.Duration
+	for _, messages := range threads {
+		sort.Slice(messages, func(i, j int) bool {
+			return messages[i].InternalDate < messages[j].InternalDate
+		})
+
+		var waiting *gmail.Message // latest received message without a reply yet
+		for _, message := range messages {
+			current := message.InternalDate >= periodStart
+			period := &report.Previous
+			if current {
+				period = &report.Current
+			}
+
+			if !hasLabelID(message, "SENT") {
+				period.Received++
+				if current {
+					countCorrespondent(people, messageHeader(message, "From"), true)
+					if tab := messageCategory(message); tab != "" {
+						report.Categories[tab]++
+					}
+				}
+				waiting = message
+				continue
+			}
+
+			period.Sent++
+			if current {
+				for _, header := range []string{"To", "Cc"} {
+					if addresses, err := mail.ParseAddressList(messageHeader(message, header)); err == nil {
+						for _, address := range addresses {
+							countCorrespondent(people, address.String(), false)
+						}
+					}
+				}
+			}
+			if waiting != nil {
+				reply := time.Duration(message.InternalDate-waiting.InternalDate) * time.Millisecond
+				if current {
+					currentReplies = append(currentReplies, reply)
+				} else {
+					previousReplies = append(previousReplies, reply)
+				}
+				waiting = nil
+			}
+		}
+
+		if waiting != nil && waiting.InternalDate >= periodStart && !isAutomated(waiting) {
+			report.Unanswered = append(report.Unanswered, unansweredThread{
+				ThreadID:    waiting.ThreadId,
+				Subject:     messageHeader(messages[0], "Subject"),
+				From:        messageHeader(waiting, "From"),
+				Received:    formatInternalDate(waiting.InternalDate),
+				WaitingDays: int(now.Sub(time.UnixMilli(waiting.InternalDate)).Hours() / 24),
+			})
+		}
+	}
+	report.Current.Replies, report.Current.MedianReplyMinutes = len(currentReplies), medianMinutes(currentReplies)
+	report.Previous.Replies, report.Previous.MedianReplyMinutes = len(previousReplies), medianMinutes(previousReplies)
+
+	// The user's own address isn't a correspondent
+	delete(people, me)
+	for _, person := range people {
+		report.Correspondents = append(report.Correspondents, *person)
+	}
+	sort.Slice(report.Correspondents, func(i, j int) bool {
+		a, b := report.Correspondents[i], report.Correspondents[j]
+		if a.Received+a.Sent != b.Received+b.Sent {
+			return a.Received+a.Sent > b.Received+b.Sent
+		}
+		return a.Address < b.Address
+	})
+	report.Correspondents = report.Correspondents[:min(len(report.Correspondents), reportTopCorrespondents)]
+
+	sort.Slice(report.Unanswered, func(i, j int) bool {
+		return report.Unanswered[i].Received < report.Unanswered[j].Received
+	})
+	report.Unanswered = report.Unanswered[:min(len(report.Unanswered), reportMaxUnanswered)]
+
+	report.Attachments = g.reportAttachments(ctx, days, category)
+	report.Markdown = report.markdown()
+	return report, nil
+}
+
+// reportAttachments returns the largest non-noise attachments of the past days
+func (g *GmailServer) reportAttachments(ctx context.Context, days int, category string) []reportAttachment {
+	attachments := []reportAttachment{}
+	list, err := g.client.ListMessages(ctx, withCategory(fmt.Sprintf("has:attachment newer_than:%dd", days), category), maxReportAttachmentScan)
+	if err != nil {
+		return attachments
+	}
+	messageIDs := make([]string, len(list.Messages))
+	for i, msg := range list.Messages {
+		messageIDs[i] = msg.Id
+	}
+	messages := g.hydrateMessages(ctx, messageIDs)
+	for _, id := range messageIDs {
+		message, ok := messages[id]
+		if !ok {
+			continue
+		}
+		found, _ := extract.FilterNoiseAttachments(extract.AttachmentInfo(message))
+		for _, attachment := range found {
+			attachments = append(attachments, reportAttachment{
+				Filename:  attachment["filename"].(string),
+				Size:      attachment["size"].(int64),
+				From:      messageHeader(message, "From"),
+				Subject:   messageHeader(message, "Subject"),
+				MessageID: message.Id,
+			})
+		}
+	}
+	sort.SliceStable(attachments, func(i, j int) bool {
+		return attachments[i].Size > attachments[j].Size
+	})
+	return attachments[:min(len(attachments), reportMaxAttachments)]
+}
+
+// countCorrespondent adds a message from (received) or to a person
+func countCorrespondent(people map[string]*correspondent, header string, received bool) {
+	address := strings.ToLower(senderAddress(header))
+	if address == "" {
+		return
+	}
+	person, ok := people[address]
+	if !ok {
+		person = &correspondent{Address: address}
+		people[address] = person
+	}
+	if parsed, err := mail.ParseAddress(header); err == nil && parsed.Name != "" {
+		person.Name = parsed.Name
+	}
+	if received {
+		person.Received++
+	} else {
+		person.Sent++
+	}
+}
+
+// isAutomated reports whether a message is a newsletter or notification that needs no reply
+func isAutomated(message *gmail.Message) bool {
+	if messageHeader(message, "List-Id") != "" || messageHeader(message, "List-Unsubscribe") != "" {
+		return true
+	}
+	from := strings.ToLower(senderAddress(messageHeader(message, "From")))
+	for _, marker := range []string{"noreply", "no-reply", "donotreply", "do-not-reply", "notifications@", "mailer-daemon"} {
+		if strings.Contains(from, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// medianMinutes is the median of durations in minutes, or 0 when there are none
+func medianMinutes(durations []time.Duration) int {
+	if len(durations) == 0 {
+		return 0
+	}
+	sorted := append([]time.Duration(nil), durations...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	middle := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return int(((sorted[middle-1] + sorted[middle]) / 2).Minutes())
+	}
+	return int(sorted[middle].Minutes())
+}
+
+// markdown renders the report for pasting into a review doc
+func (r *activityReport) markdown() string {
+	period, previous := i18n.T("report.this_period", "This period"), i18n.T("report.previous_period", "Previous period")
+	if r.Days == 7 {
+		period, previous = i18n.T("report.this_week", "This week"), i18n.T("report.previous_week", "Previous week")
+	}
+
+	var out strings.Builder
+	out.WriteString(i18n.T("report.title", "# Email Activity: %s to %s", reportDate(r.From), reportDate(r.To)) + "\n\n")
+	if r.Category != "" {
+		out.WriteString(i18n.T("report.tab_only", "Threads received in the %s tab only.", r.Category) + "\n\n")
+	}
+
+	fmt.Fprintf(&out, "## %s\n\n", i18n.T("report.volume", "Volume"))
+	fmt.Fprintf(&out, "| | %s | %s | %s |\n|---|---|---|---|\n", period, previous, i18n.T("report.change", "Change"))
+	fmt.Fprintf(&out, "| %s | %d | %d | %s |\n", i18n.T("report.received", "Received"), r.Current.Received, r.Previous.Received, percentChange(r.Current.Received, r.Previous.Received))
+	fmt.Fprintf(&out, "| %s | %d | %d | %s |\n", i18n.T("report.sent", "Sent"), r.Current.Sent, r.Previous.Sent, percentChange(r.Current.Sent, r.Previous.Sent))
+	fmt.Fprintf(&out, "| %s | %s | %s | %s |\n\n", i18n.T("report.median_reply", "Median time to reply"),
+		formatMinutes(r.Current.MedianReplyMinutes, r.Current.Replies), formatMinutes(r.Previous.MedianReplyMinutes, r.Previous.Replies),
+		replyTrend(r.Current, r.Previous))
+
+	if len(r.Categories) > 0 {
+		fmt.Fprintf(&out, "## %s\n\n| %s | %s |\n|---|---|\n", i18n.T("report.by_tab", "Received by Tab"), i18n.T("report.tab", "Tab"), i18n.T("report.received", "Received"))
+		for _, category := range gmailCategories {
+			if count := r.Categories[category.name]; count > 0 {
+				fmt.Fprintf(&out, "| %s | %d |\n", category.name, count)
+			}
+		}
+		out.WriteString("\n")
+	}
+
+	fmt.Fprintf(&out, "## %s\n\n", i18n.T("report.top_correspondents", "Top Correspondents"))
+	if len(r.Correspondents) == 0 {
+		out.WriteString(i18n.T("report.no_correspondents", "No mail exchanged.") + "\n")
+	}
+	for i, person := range r.Correspondents {
+		who := person.Address
+		if person.Name != "" {
+			who = fmt.Sprintf("%s <%s>", person.Name, person.Address)
+		}
+		fmt.Fprintf(&out, "%d. %s\n", i+1, i18n.T("report.correspondent", "%s: %d received, %d sent", who, person.Received, person.Sent))
+	}
+
+	fmt.Fprintf(&out, "\n## %s\n\n", i18n.T("report.unanswered", "Unanswered Threads"))
+	if len(r.Unanswered) == 0 {
+		out.WriteString(i18n.T("report.no_unanswered", "Nothing from a person is waiting on a reply.") + "\n")
+	}
+	for _, thread := range r.Unanswered {
+		fmt.Fprintf(&out, "- %s\n", i18n.T("report.waiting", "**%s** from %s, waiting %d day(s) (thread %s)", thread.Subject, thread.From, thread.WaitingDays, thread.ThreadID))
+	}
+
+	fmt.Fprintf(&out, "\n## %s\n\n", i18n.T("report.attachments", "Noteworthy Attachments"))
+	if len(r.Attachments) == 0 {
+		out.WriteString(i18n.T("report.no_attachments", "No attachments.") + "\n")
+	}
+	for _, attachment := range r.Attachments {
+		fmt.Fprintf(&out, "- %s\n", i18n.T("report.attachment", "%s (%s) from %s: \"%s\"", attachment.Filename, formatBytes(attachment.Size), attachment.From, attachment.Subject))
+	}
+	return out.String()
+}
+
+// reportDate writes one of the report's YYYY-MM-DD dates for the configured locale
+func reportDate(date string) string {
+	parsed, err := time.Parse("2006-01-02", date)
+	if err != nil {
+		return date
+	}
+	return i18n.FormatDate(parsed)
+}
+
+// percentChange formats the change from previous to current, e.g. "+25%"
+func percentChange(current, previous int) string {
+	if previous == 0 {
+		if current == 0 {
+			return "0%"
+		}
+		return i18n.T("report.new", "new")
+	}
+	return fmt.Sprintf("%+d%%", (current-previous)*100/previous)
+}
+
+// replyTrend says whether replies got faster or slower
+func replyTrend(current, previous activityPeriod) string {
+	if current.Replies == 0 || previous.Replies == 0 {
+		return i18n.T("report.n_a", "n/a")
+	}
+	switch {
+	case current.MedianReplyMinutes < previous.MedianReplyMinutes:
+		return i18n.T("report.faster", "faster")
+	case current.MedianReplyMinutes > previous.MedianReplyMinutes:
+		return i18n.T("report.slower", "slower")
+	}
+	return i18n.T("report.same", "same")
+}
+
+// formatMinutes renders a duration like "3h 20m" or "2d 4h"; "n/a" without replies
+func formatMinutes(minutes, replies int) string {
+	switch {
+	case replies == 0:
+		return i18n.T("report.n_a", "n/a")
+	case minutes < 60:
+		return fmt.Sprintf("%dm", minutes)
+	case minutes < 24*60:
+		return fmt.Sprintf("%dh %dm", minutes/60, minutes%60)
+	}
+	return fmt.Sprintf("%dd %dh", minutes/(24*60), minutes%(24*60)/60)
+}
+
+// formatBytes renders a size like "1.2 MB"
+func formatBytes(size int64) string {
+	switch {
+	case size >= 1<<30:
+		return fmt.Sprintf("%.1f GB", float64(size)/(1<<30))
+	case size >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(size)/(1<<20))
+	case size >= 1<<10:
+		return fmt.Sprintf("%.0f KB", float64(size)/(1<<10))
+	}
+	return fmt.Sprintf("%d B", size)
+}
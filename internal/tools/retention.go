@@ -0,0 +1,332 @@
+package tools
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/mail"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"google.golang.org/api/gmail/v1"
+
+	"auto-gmail/internal/gmailclient"
+	"auto-gmail/internal/toolerr"
+)
+
+// Cleanup plan limits
+const (
+	maxCleanupRules = 10
+	// maxCleanupMatches caps how many messages one rule covers per plan; bigger
+	// cleanups take several runs
+	maxCleanupMatches = 2000
+	// cleanupBatchSize is how many messages are moved to the trash per request
+	cleanupBatchSize = 500
+	// cleanupTopSenders and cleanupSamples are how many senders and messages each
+	// rule shows for review
+	cleanupTopSenders = 5
+	cleanupSamples    = 3
+)
+
+// cleanupTokenTTL is how long a plan's confirm token is good for; an older approval
+// needs a fresh plan
+const cleanupTokenTTL = time.Hour
+
+// cleanupGuard is added to every rule's query, so starred mail is never cleaned up
+const cleanupGuard = "-is:starred"
+
+// cleanupRule is one retention rule: mail matching Query is moved to the trash
+type cleanupRule struct {
+	Name  string `json:"name"`
+	Query string `json:"query"`
+}
+
+// cleanupPresets are named rules for common cleanups, usable in place of a query
+var cleanupPresets = []cleanupRule{
+	{Name: "old-promotions", Query: "category:promotions older_than:1y"},
+	{Name: "old-social", Query: "category:social older_than:1y"},
+	{Name: "old-updates", Query: "category:updates older_than:1y"},
+	{Name: "old-forums", Query: "category:forums older_than:1y"},
+	{Name: "large-newsletter-attachments", Query: "has:attachment larger:5M (category:promotions OR category:updates OR category:forums)"},
+}
+
+// cleanupPresetNames lists the presets for descriptions
+func cleanupPresetNames() []string {
+	names := make([]string, len(cleanupPresets))
+	for i, preset := range cleanupPresets {
+		names[i] = preset.Name
+	}
+	return names
+}
+
+// parseCleanupRules reads rules from a JSON array of {name, query} objects, or from
+// lines (or ';'-separated entries) that are each a preset name or a Gmail query
+func parseCleanupRules(spec string) ([]cleanupRule, error) {
+	spec = strings.TrimSpace(spec)
+	var rules []cleanupRule
+	if strings.HasPrefix(spec, "[") {
+		if err := json.Unmarshal([]byte(spec), &rules); err != nil {
+			return nil, fmt.Errorf("invalid JSON rules: %v", err)
+		}
+	} else {
+		for _, entry := range strings.FieldsFunc(spec, func(r rune) bool { return r == '\n' || r == ';' }) {
+			if entry = strings.TrimSpace(entry); entry != "" {
+				rules = append(rules, cleanupRule{Query: entry})
+			}
+		}
+	}
+
+	for i := range rules {
+		rule := &rules[i]
+		rule.Query = strings.TrimSpace(rule.Query)
+		for _, preset := range cleanupPresets {
+			if strings.EqualFold(rule.Query, preset.Name) {
+				rule.Query = preset.Query
+				if rule.Name == "" {
+					rule.Name = preset.Name
+				}
+			}
+		}
+		if rule.Query == "" {
+			return nil, fmt.Errorf("rule %d has no query", i+1)
+		}
+		if problems := lintQuery(rule.Query); len(problems) > 0 {
+			return nil, fmt.Errorf("rule %q: %s", rule.Query, strings.Join(problems, "; "))
+		}
+		if rule.Name == "" {
+			rule.Name = rule.Query
+		}
+	}
+	if len(rules) == 0 {
+		return nil, fmt.Errorf("no rules given")
+	}
+	if len(rules) > maxCleanupRules {
+		return nil, fmt.Errorf("%d rules given; a plan can have at most %d", len(rules), maxCleanupRules)
+	}
+	return rules, nil
+}
+
+// cleanupRulePlan is what one rule would clean up
+type cleanupRulePlan struct {
+	Name     string `json:"name"`
+	Query    string `json:"query"`
+	Messages int    `json:"messages"`
+	// New is how many of Messages no earlier rule already matched
+	New        int                      `json:"new"`
+	Bytes      int64                    `json:"bytes"`
+	Size       string                   `json:"size"`
+	Oldest     string                   `json:"oldest,omitempty"`
+	Newest     string                   `json:"newest,omitempty"`
+	TopSenders []map[string]interface{} `json:"topSenders,omitempty"`
+	Samples    []map[string]interface{} `json:"samples,omitempty"`
+	// Truncated is set when more than maxCleanupMatches messages match
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// cleanupToken identifies a plan made at issued: its queries and exactly the messages
+// it covers. It starts with issued in hex Unix seconds, so its age can be checked.
+func cleanupToken(rules []cleanupRule, messageIDs []string, issued time.Time) string {
+	sorted := append([]string(nil), messageIDs...)
+	sort.Strings(sorted)
+	hash := sha256.New()
+	stamp := strconv.FormatInt(issued.Unix(), 16)
+	hash.Write([]byte(stamp))
+	hash.Write([]byte{0})
+	for _, rule := range rules {
+		hash.Write([]byte(rule.Query))
+		hash.Write([]byte{0})
+	}
+	for _, id := range sorted {
+		hash.Write([]byte(id))
+		hash.Write([]byte{0})
+	}
+	return stamp + "-" + hex.EncodeToString(hash.Sum(nil))[:16]
+}
+
+// checkCleanupToken explains why token doesn't confirm the plan of rules and
+// messageIDs at now, or returns "" when it does
+func checkCleanupToken(token string, rules []cleanupRule, messageIDs []string, now time.Time) string {
+	stamp, _, _ := strings.Cut(token, "-")
+	seconds, err := strconv.ParseInt(stamp, 16, 64)
+	if err != nil || token != cleanupToken(rules, messageIDs, time.Unix(seconds, 0)) {
+		return "confirm_token doesn't match this plan; the rules or the matching mail changed since it was made. Review this new plan."
+	}
+	if age := now.Sub(time.Unix(seconds, 0)); age > cleanupTokenTTL || age < -time.Minute {
+		return fmt.Sprintf("confirm_token has expired; a plan must be confirmed within %s of being made. Review this new plan.", cleanupTokenTTL)
+	}
+	return ""
+}
+
+// CleanupPlan works out what the retention rules would move to the trash: per rule the
+// message count, space reclaimed, date range, top senders and a few samples, and the
+// totals with overlaps counted once. Only with the confirm token of a plan for exactly
+// the same rules and messages, made within cleanupTokenTTL, does it move them to the
+// trash, in batches. Nothing is
+// ever deleted permanently; Gmail empties the trash after 30 days.
+func (g *GmailServer) CleanupPlan(ctx context.Context, rulesSpec, confirmToken string) (*mcp.CallToolResult, error) {
+	rules, err := parseCleanupRules(rulesSpec)
+	if err != nil {
+		return toolerr.New(toolerr.InvalidInput, "invalid_rules", err.Error()).
+			WithHint(fmt.Sprintf("Give one Gmail query per line, or a preset: %s.", strings.Join(cleanupPresetNames(), ", "))).Result(), nil
+	}
+	modifier, ok := g.client.(gmailclient.BulkModifier)
+	if !ok {
+		return toolerr.New(toolerr.Unavailable, "cleanup_unsupported", "This mailbox can't be cleaned up in bulk").
+			WithHint("Connect a Gmail account to use cleanup plans.").Result(), nil
+	}
+
+	var plans []*cleanupRulePlan
+	var allIDs []string
+	planned := map[string]bool{}
+	var totalBytes int64
+	for _, rule := range rules {
+		plan := &cleanupRulePlan{Name: rule.Name, Query: rule.Query + " " + cleanupGuard}
+		plans = append(plans, plan)
+
+		ids, err := modifier.ListAllMessageIDs(ctx, plan.Query, maxCleanupMatches+1)
+		if err != nil {
+			return toolerr.Result(err, fmt.Sprintf("Failed to list mail for rule %q", rule.Name)), nil
+		}
+		if len(ids) > maxCleanupMatches {
+			ids, plan.Truncated = ids[:maxCleanupMatches], true
+		}
+		plan.Messages = len(ids)
+
+		messages := g.hydrateMessageHeaders(ctx, ids, []string{"From", "Subject"})
+		senders := map[string]int{}
+		var oldest, newest int64
+		for _, id := range ids {
+			message, ok := messages[id]
+			if !ok {
+				continue
+			}
+			plan.Bytes += message.SizeEstimate
+			if !planned[id] {
+				planned[id] = true
+				allIDs = append(allIDs, id)
+				totalBytes += message.SizeEstimate
+				plan.New++
+			}
+			if oldest == 0 || message.InternalDate < oldest {
+				oldest = message.InternalDate
+			}
+			newest = max(newest, message.InternalDate)
+			if message.Payload != nil {
+				senders[strings.ToLower(senderAddress(messageHeader(message, "From")))]++
+			}
+			if len(plan.Samples) < cleanupSamples {
+				plan.Samples = append(plan.Samples, cleanupSample(message))
+			}
+		}
+		plan.Size = formatBytes(plan.Bytes)
+		if oldest != 0 {
+			plan.Oldest, plan.Newest = formatInternalDate(oldest), formatInternalDate(newest)
+		}
+		plan.TopSenders = topCleanupSenders(senders)
+	}
+
+	now := time.Now()
+	problem := "no confirm_token"
+	if confirmToken != "" {
+		problem = checkCleanupToken(confirmToken, rules, allIDs, now)
+	}
+	summary := map[string]interface{}{
+		"rules":          len(rules),
+		"messages":       len(allIDs),
+		"reclaimedBytes": totalBytes,
+		"reclaimed":      formatBytes(totalBytes),
+	}
+	result := map[string]interface{}{
+		"summary": summary,
+		"rules":   plans,
+	}
+	for _, plan := range plans {
+		if plan.Truncated {
+			summary["truncated"] = fmt.Sprintf("Some rules match more than %d messages; only the newest %d of each are in this plan. Run the plan again afterwards for the rest.", maxCleanupMatches, maxCleanupMatches)
+			break
+		}
+	}
+
+	if problem != "" || len(allIDs) == 0 {
+		result["dryRun"] = true
+		if len(allIDs) == 0 {
+			result["instructions"] = "No mail matches these rules; nothing to clean up."
+		} else {
+			if confirmToken != "" {
+				result["note"] = problem
+			}
+			result["confirmToken"] = cleanupToken(rules, allIDs, now)
+			result["instructions"] = "Nothing was changed. Show this plan to the user; only if they approve it, call cleanup_plan again with the same rules plus this confirm_token to move these messages to the trash."
+		}
+		resultJSON, _ := json.MarshalIndent(result, "", "  ")
+		return mcp.NewToolResultText(string(resultJSON)), nil
+	}
+
+	trashed := 0
+	var failures []string
+	for start := 0; start < len(allIDs); start += cleanupBatchSize {
+		if err := ctx.Err(); err != nil {
+			failures = append(failures, err.Error())
+			break
+		}
+		batch := allIDs[start:min(start+cleanupBatchSize, len(allIDs))]
+		err := modifier.BatchModifyMessages(ctx, batch, &gmail.BatchModifyMessagesRequest{AddLabelIds: []string{"TRASH"}})
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("messages %d-%d: %v", start+1, start+len(batch), g.permissionHint(err)))
+			continue
+		}
+		trashed += len(batch)
+	}
+	result["dryRun"] = false
+	summary["trashed"] = trashed
+	if len(failures) > 0 {
+		summary["failed"] = len(allIDs) - trashed
+		result["errors"] = failures
+		result["instructions"] = "Some batches failed. Make a new plan to see what's left, and confirm it to retry."
+	} else {
+		result["instructions"] = "The messages are in the trash, where they can be restored for 30 days before Gmail deletes them."
+	}
+	resultJSON, _ := json.MarshalIndent(result, "", "  ")
+	return mcp.NewToolResultText(string(resultJSON)), nil
+}
+
+// cleanupSample describes one message of a plan for review
+func cleanupSample(message *gmail.Message) map[string]interface{} {
+	from := messageHeader(message, "From")
+	if parsed, err := mail.ParseAddress(from); err == nil && parsed.Name != "" {
+		from = parsed.Name
+	}
+	return map[string]interface{}{
+		"messageId": message.Id,
+		"from":      from,
+		"subject":   messageHeader(message, "Subject"),
+		"date":      formatInternalDate(message.InternalDate),
+		"size":      formatBytes(message.SizeEstimate),
+	}
+}
+
+// topCleanupSenders lists the senders with the most messages in a plan
+func topCleanupSenders(senders map[string]int) []map[string]interface{} {
+	addresses := make([]string, 0, len(senders))
+	for address := range senders {
+		if address != "" {
+			addresses = append(addresses, address)
+		}
+	}
+	sort.Slice(addresses, func(i, j int) bool {
+		if senders[addresses[i]] != senders[addresses[j]] {
+			return senders[addresses[i]] > senders[addresses[j]]
+		}
+		return addresses[i] < addresses[j]
+	})
+	var top []map[string]interface{}
+	for _, address := range addresses[:min(cleanupTopSenders, len(addresses))] {
+		top = append(top, map[string]interface{}{"sender": address, "messages": senders[address]})
+	}
+	return top
+}
@@ -0,0 +1,162 @@
+package tools
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"auto-gmail/internal/gmailclient"
+
+	"google.golang.org/api/gmail/v1"
+)
+
+func TestParseCleanupRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    string
+		want    []cleanupRule
+		wantErr string
+	}{
+		{"preset", "old-promotions", []cleanupRule{{Name: "old-promotions", Query: "category:promotions older_than:1y"}}, ""},
+		{
+			"lines and semicolons",
+			"Old-Social; from:news@example.com larger:2M\n\n",
+			[]cleanupRule{{Name: "old-social", Query: "category:social older_than:1y"}, {Name: "from:news@example.com larger:2M", Query: "from:news@example.com larger:2M"}},
+			"",
+		},
+		{
+			"json",
+			`[{"name": "promos", "query": "old-promotions"}, {"query": " larger:10M "}]`,
+			[]cleanupRule{{Name: "promos", Query: "category:promotions older_than:1y"}, {Name: "larger:10M", Query: "larger:10M"}},
+			"",
+		},
+		{"invalid json", `[{"query": }]`, nil, "invalid JSON rules"},
+		{"json rule without a query", `[{"name": "everything"}]`, nil, "rule 1 has no query"},
+		{"query with a mistake", "sender:news@example.com", nil, `unknown operator "sender:"`},
+		{"no rules", " ;\n ", nil, "no rules given"},
+		{"too many rules", strings.Repeat("larger:1M;", maxCleanupRules+1), nil, "at most 10"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseCleanupRules(tt.spec)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("parseCleanupRules(%q) error = %v, want it to mention %q", tt.spec, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseCleanupRules(%q) = %+v, %v, want %+v", tt.spec, got, err, tt.want)
+			}
+		})
+	}
+}
+
+// cleanupRun is the part of a cleanup_plan result the tests check
+type cleanupRun struct {
+	DryRun       bool   `json:"dryRun"`
+	ConfirmToken string `json:"confirmToken"`
+	Note         string `json:"note"`
+	Summary      struct {
+		Messages int `json:"messages"`
+		Trashed  int `json:"trashed"`
+	} `json:"summary"`
+}
+
+// addOldMail adds a single-message thread received two years ago with the given labels
+func addOldMail(fake *gmailclient.Fake, id, from string, labels ...string) {
+	fake.AddThread(&gmail.Thread{Id: id, Messages: []*gmail.Message{{
+		Id:           id,
+		LabelIds:     labels,
+		InternalDate: time.Now().AddDate(-2, 0, 0).UnixMilli(),
+		SizeEstimate: 20000,
+		Payload: &gmail.MessagePart{Headers: []*gmail.MessagePartHeader{
+			{Name: "From", Value: from},
+			{Name: "Subject", Value: "Offer " + id},
+		}},
+	}}})
+}
+
+// isTrashed reports whether a message in the fake mailbox is in the trash
+func isTrashed(t *testing.T, fake *gmailclient.Fake, id string) bool {
+	t.Helper()
+	labels := threadLabels(t, fake, id)
+	return containsString(labels, "TRASH")
+}
+
+func TestCleanupPlan(t *testing.T) {
+	fake := gmailclient.NewFake("me@example.com")
+	addOldMail(fake, "promo-old", "Shop <deals@shop.example>", "INBOX", "CATEGORY_PROMOTIONS")
+	addOldMail(fake, "promo-starred", "Shop <deals@shop.example>", "INBOX", "CATEGORY_PROMOTIONS", "STARRED")
+	addOldMail(fake, "social-old", "Friends <notify@social.example>", "CATEGORY_SOCIAL")
+	fake.AddThread(&gmail.Thread{Id: "promo-new", Messages: []*gmail.Message{{
+		Id: "promo-new", LabelIds: []string{"INBOX", "CATEGORY_PROMOTIONS"}, InternalDate: time.Now().AddDate(0, -1, 0).UnixMilli(),
+	}}})
+	tools := newTestTools(t, fake)
+
+	var planA cleanupRun
+	tools.decode(t, "cleanup_plan", map[string]interface{}{"rules": "old-promotions"}, &planA)
+	if !planA.DryRun || planA.ConfirmToken == "" || planA.Summary.Messages != 1 {
+		t.Fatalf("cleanup_plan = %+v, want a dry run of the one old, unstarred promotion", planA)
+	}
+	var planB cleanupRun
+	tools.decode(t, "cleanup_plan", map[string]interface{}{"rules": "old-social"}, &planB)
+	if !planB.DryRun || planB.ConfirmToken == "" || planB.ConfirmToken == planA.ConfirmToken {
+		t.Fatalf("cleanup_plan for other rules = %+v, want its own token", planB)
+	}
+
+	rulesA, err := parseCleanupRules("old-promotions")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name  string
+		rules string
+		token string
+		note  string
+	}{
+		{"plan A's token for plan B", "old-social", planA.ConfirmToken, "doesn't match"},
+		{"plan A's token for more rules", "old-promotions\nold-social", planA.ConfirmToken, "doesn't match"},
+		{"made-up token", "old-promotions", "0123456789abcdef", "doesn't match"},
+		{"token for other messages", "old-promotions", cleanupToken(rulesA, []string{"promo-old", "promo-starred"}, time.Now()), "doesn't match"},
+		{"expired token", "old-promotions", cleanupToken(rulesA, []string{"promo-old"}, time.Now().Add(-cleanupTokenTTL-time.Minute)), "expired"},
+		{"token from the future", "old-promotions", cleanupToken(rulesA, []string{"promo-old"}, time.Now().Add(time.Hour)), "expired"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var run cleanupRun
+			tools.decode(t, "cleanup_plan", map[string]interface{}{"rules": tt.rules, "confirm_token": tt.token}, &run)
+			if !run.DryRun || !strings.Contains(run.Note, tt.note) || run.ConfirmToken == "" {
+				t.Errorf("cleanup_plan = %+v, want a new plan with a note that the token %s", run, tt.note)
+			}
+			for _, id := range []string{"promo-old", "social-old"} {
+				if isTrashed(t, fake, id) {
+					t.Fatalf("%s was moved to the trash", id)
+				}
+			}
+		})
+	}
+
+	// Plan B's token no longer matches once more mail matches its rules
+	addOldMail(fake, "social-later", "Friends <notify@social.example>", "CATEGORY_SOCIAL")
+	var staleB cleanupRun
+	tools.decode(t, "cleanup_plan", map[string]interface{}{"rules": "old-social", "confirm_token": planB.ConfirmToken}, &staleB)
+	if !staleB.DryRun || !strings.Contains(staleB.Note, "doesn't match") || staleB.Summary.Messages != 2 {
+		t.Errorf("cleanup_plan after new mail = %+v, want a new plan of 2 messages", staleB)
+	}
+	if isTrashed(t, fake, "social-old") {
+		t.Errorf("social-old was moved to the trash with a stale token")
+	}
+
+	var confirmed cleanupRun
+	tools.decode(t, "cleanup_plan", map[string]interface{}{"rules": "old-promotions", "confirm_token": planA.ConfirmToken}, &confirmed)
+	if confirmed.DryRun || confirmed.Summary.Trashed != 1 {
+		t.Fatalf("confirmed cleanup_plan = %+v, want the one message trashed", confirmed)
+	}
+	for id, want := range map[string]bool{"promo-old": true, "promo-starred": false, "promo-new": false, "social-old": false, "social-later": false} {
+		if got := isTrashed(t, fake, id); got != want {
+			t.Errorf("%s in the trash = %v, want %v", id, got, want)
+		}
+	}
+}
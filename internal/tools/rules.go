@@ -0,0 +1,607 @@
+package tools
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"auto-gmail/internal/extract"
+	"auto-gmail/internal/gmailclient"
+	"auto-gmail/internal/llm"
+	"auto-gmail/internal/redact"
+	"auto-gmail/internal/toolerr"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/openai/openai-go"
+	"google.golang.org/api/gmail/v1"
+)
+
+// Rule engine limits
+const (
+	// defaultRulesInterval is how often, in minutes, rules are checked in the background
+	defaultRulesInterval = 5
+	// maxRuleMatches caps how many new messages one rule handles per run
+	maxRuleMatches = 50
+	// ruleProcessedTTL is how long a handled message is remembered, so it isn't handled again
+	ruleProcessedTTL = 60 * 24 * time.Hour
+	// ruleRunTimeout bounds one background run of all rules
+	ruleRunTimeout = 5 * time.Minute
+	// maxRuleSummaryChars caps how much of a body is sent to be summarized
+	maxRuleSummaryChars = 8000
+	// ruleActivityShown is how many recent actions manage_rules lists per rule
+	ruleActivityShown = 10
+)
+
+// Rule actions; a label action is written "label:<name>"
+const (
+	ruleArchive   = "archive"
+	ruleMarkRead  = "mark_read"
+	ruleStar      = "star"
+	ruleNotify    = "notify"
+	ruleSummarize = "summarize"
+)
+
+// rule is one user-defined automation: new mail matching Query gets Actions
+type rule struct {
+	Name     string   `json:"name"`
+	Query    string   `json:"query"`
+	Actions  []string `json:"actions"`
+	Disabled bool     `json:"disabled,omitempty"`
+	// Created is when the rule was saved; background runs only handle mail newer than it
+	Created time.Time `json:"created"`
+}
+
+// ruleState remembers, per rule, the messages already handled and when
+type ruleState struct {
+	Processed map[string]map[string]time.Time `json:"processed"`
+}
+
+// ruleActivity is one audit entry: what a rule did to one thread
+type ruleActivity struct {
+	Time      time.Time `json:"time"`
+	Rule      string    `json:"rule"`
+	Trigger   string    `json:"trigger"` // "schedule" or "run_rules_now"
+	ThreadID  string    `json:"threadId"`
+	MessageID string    `json:"messageId"`
+	Subject   string    `json:"subject,omitempty"`
+	From      string    `json:"from,omitempty"`
+	Actions   []string  `json:"actions,omitempty"`
+	Summary   string    `json:"summary,omitempty"`
+	// NotifiedIn is the outbox entry of the email that told the user about the match
+	NotifiedIn string `json:"notifiedIn,omitempty"`
+	Error      string `json:"error,omitempty"`
+	DryRun     bool   `json:"dryRun,omitempty"`
+}
+
+// Rule files live next to the token: the rules themselves (plain JSON users can
+// edit), which messages were handled, and the audit log of actions taken
+func (g *GmailServer) rulesFile() string {
+	return g.dataFile("rules.json")
+}
+
+func (g *GmailServer) rulesStateFile() string {
+	return g.dataFile("rules-state.json")
+}
+
+func (g *GmailServer) rulesAuditFile() string {
+	return g.dataFile("rules-audit.jsonl")
+}
+
+// loadRules reads the rules; a missing file means none. The caller holds rulesMu.
+func (g *GmailServer) loadRules() ([]rule, error) {
+	var stored struct {
+		Rules []rule `json:"rules"`
+	}
+	data, err := os.ReadFile(g.rulesFile())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return nil, toolerr.Errorf(toolerr.ParseFailure, "invalid_data_file", "invalid rules file %s: %v", g.rulesFile(), err)
+	}
+	return stored.Rules, nil
+}
+
+// saveRules writes the rules. The caller holds rulesMu.
+func (g *GmailServer) saveRules(rules []rule) error {
+	data, _ := json.MarshalIndent(map[string]interface{}{"rules": rules}, "", "  ")
+	return os.WriteFile(g.rulesFile(), data, 0600)
+}
+
+// loadRuleState reads which messages were handled, forgetting old ones. The caller holds rulesMu.
+func (g *GmailServer) loadRuleState() ruleState {
+	state := ruleState{Processed: map[string]map[string]time.Time{}}
+	data, err := os.ReadFile(g.rulesStateFile())
+	if err != nil {
+		return state
+	}
+	if err := json.Unmarshal(data, &state); err != nil || state.Processed == nil {
+		log.Printf("Warning: Invalid rules state file %s, starting over: %v", g.rulesStateFile(), err)
+		return ruleState{Processed: map[string]map[string]time.Time{}}
+	}
+	for _, handled := range state.Processed {
+		for id, at := range handled {
+			if time.Since(at) > ruleProcessedTTL {
+				delete(handled, id)
+			}
+		}
+	}
+	return state
+}
+
+// saveRuleState writes which messages were handled. The caller holds rulesMu.
+func (g *GmailServer) saveRuleState(state ruleState) {
+	data, _ := json.Marshal(state)
+	if err := os.WriteFile(g.rulesStateFile(), data, 0600); err != nil {
+		log.Printf("Warning: Failed to save rules state %s: %v", g.rulesStateFile(), err)
+	}
+}
+
+// appendRuleActivity adds entries to the audit log. The caller holds rulesMu.
+func (g *GmailServer) appendRuleActivity(entries []ruleActivity) {
+	if len(entries) == 0 {
+		return
+	}
+	file, err := os.OpenFile(g.rulesAuditFile(), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		log.Printf("Warning: Failed to open rules audit log %s: %v", g.rulesAuditFile(), err)
+		return
+	}
+	defer file.Close()
+	for _, entry := range entries {
+		line, _ := json.Marshal(entry)
+		file.Write(append(line, '\n'))
+	}
+}
+
+// recentRuleActivity returns each rule's last actions, newest first. The caller holds rulesMu.
+func (g *GmailServer) recentRuleActivity() map[string][]ruleActivity {
+	recent := map[string][]ruleActivity{}
+	file, err := os.Open(g.rulesAuditFile())
+	if err != nil {
+		return recent
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var entry ruleActivity
+		if json.Unmarshal(scanner.Bytes(), &entry) != nil {
+			continue
+		}
+		entries := append(recent[strings.ToLower(entry.Rule)], entry)
+		if len(entries) > ruleActivityShown {
+			entries = entries[1:]
+		}
+		recent[strings.ToLower(entry.Rule)] = entries
+	}
+	for name, entries := range recent {
+		sort.SliceStable(entries, func(i, j int) bool { return entries[i].Time.After(entries[j].Time) })
+		recent[name] = entries
+	}
+	return recent
+}
+
+// parseRuleActions reads a comma-separated action list such as
+// "label:Receipts, archive, notify"
+func parseRuleActions(list string) ([]string, error) {
+	var actions []string
+	for _, action := range strings.Split(list, ",") {
+		action = strings.TrimSpace(action)
+		if action == "" {
+			continue
+		}
+		if label, ok := strings.CutPrefix(action, "label:"); ok {
+			if label = strings.TrimSpace(label); label == "" {
+				return nil, fmt.Errorf("label action needs a label name, e.g. label:Receipts")
+			}
+			actions = append(actions, "label:"+label)
+			continue
+		}
+		switch strings.ToLower(action) {
+		case ruleArchive, ruleMarkRead, ruleStar, ruleNotify, ruleSummarize:
+			actions = append(actions, strings.ToLower(action))
+		default:
+			return nil, fmt.Errorf("unknown action %q: use label:<name>, %s, %s, %s, %s or %s", action, ruleArchive, ruleMarkRead, ruleStar, ruleNotify, ruleSummarize)
+		}
+	}
+	if len(actions) == 0 {
+		return nil, fmt.Errorf("a rule needs at least one action")
+	}
+	return actions, nil
+}
+
+// ManageRules lists, saves or deletes automation rules. action is "list", "set"
+// (create or replace the rule), "enable", "disable" or "delete".
+func (g *GmailServer) ManageRules(action, name, query, actionList string) (*mcp.CallToolResult, error) {
+	name = strings.TrimSpace(name)
+	if action == "" {
+		action = "list"
+	}
+	if action != "list" && name == "" {
+		return toolerr.Invalid("name parameter is required to change a rule"), nil
+	}
+
+	g.rulesMu.Lock()
+	defer g.rulesMu.Unlock()
+
+	rules, err := g.loadRules()
+	if err != nil {
+		return toolerr.Result(err, "Failed to read rules"), nil
+	}
+	index := -1
+	for i, r := range rules {
+		if strings.EqualFold(r.Name, name) {
+			index = i
+		}
+	}
+	if action != "list" && action != "set" && index < 0 {
+		return toolerr.New(toolerr.NotFound, "rule_not_found", fmt.Sprintf("No rule named '%s'", name)).Result(), nil
+	}
+
+	switch action {
+	case "list":
+	case "set":
+		query = strings.TrimSpace(query)
+		if query == "" {
+			return toolerr.Invalid("query parameter is required to save a rule"), nil
+		}
+		if problems := lintQuery(query); len(problems) > 0 {
+			return invalidQueryError(query, problems), nil
+		}
+		actions, err := parseRuleActions(actionList)
+		if err != nil {
+			return toolerr.Invalid(err.Error()), nil
+		}
+		saved := rule{Name: name, Query: query, Actions: actions, Created: time.Now()}
+		if index >= 0 {
+			saved.Created, saved.Disabled = rules[index].Created, rules[index].Disabled
+			rules[index] = saved
+		} else {
+			rules = append(rules, saved)
+		}
+	case "enable", "disable":
+		rules[index].Disabled = action == "disable"
+	case "delete":
+		rules = append(rules[:index], rules[index+1:]...)
+	default:
+		return toolerr.Invalid(fmt.Sprintf("Invalid action %q: use \"list\", \"set\", \"enable\", \"disable\" or \"delete\"", action)), nil
+	}
+
+	if action != "list" {
+		if err := g.saveRules(rules); err != nil {
+			return toolerr.Result(err, "Failed to save rules"), nil
+		}
+	}
+
+	recent := g.recentRuleActivity()
+	listed := make([]map[string]interface{}, len(rules))
+	for i, r := range rules {
+		entry := map[string]interface{}{
+			"name":    r.Name,
+			"query":   r.Query,
+			"actions": r.Actions,
+			"enabled": !r.Disabled,
+		}
+		if activity := recent[strings.ToLower(r.Name)]; len(activity) > 0 {
+			entry["recentActivity"] = activity
+		}
+		listed[i] = entry
+	}
+	result := map[string]interface{}{
+		"action":       action,
+		"rules":        listed,
+		"file":         g.rulesFile(),
+		"checkedEvery": fmt.Sprintf("%d minutes", envLimit("GMAIL_MCP_RULES_INTERVAL", defaultRulesInterval)),
+		"auditLog":     g.rulesAuditFile(),
+		"note":         "Rules run in the background only on mail that arrives after they're saved; run_rules_now also handles existing matches",
+	}
+	resultJSON, _ := json.MarshalIndent(result, "", "  ")
+	return mcp.NewToolResultText(string(resultJSON)), nil
+}
+
+// RunRulesNow runs the enabled rules (or only the named one) on matching mail they
+// haven't handled yet. A dry run reports what would be done without doing it.
+func (g *GmailServer) RunRulesNow(ctx context.Context, name string, dryRun bool) (*mcp.CallToolResult, error) {
+	g.rulesMu.Lock()
+	rules, err := g.loadRules()
+	g.rulesMu.Unlock()
+	if err != nil {
+		return toolerr.Result(err, "Failed to read rules"), nil
+	}
+
+	var selected []rule
+	for _, r := range rules {
+		if name == "" && !r.Disabled || strings.EqualFold(r.Name, name) {
+			selected = append(selected, r)
+		}
+	}
+	if name != "" && len(selected) == 0 {
+		return toolerr.New(toolerr.NotFound, "rule_not_found", fmt.Sprintf("No rule named '%s'", name)).Result(), nil
+	}
+	if len(selected) == 0 {
+		return toolerr.New(toolerr.NotFound, "no_rules", "No enabled rules; create one with manage_rules").Result(), nil
+	}
+
+	activity, errs := g.runRules(ctx, selected, "run_rules_now", dryRun, false)
+	result := map[string]interface{}{
+		"rulesRun": len(selected),
+		"handled":  len(activity),
+		"activity": activity,
+		"dryRun":   dryRun,
+	}
+	if len(errs) > 0 {
+		result["errors"] = errs
+	}
+	if len(activity) == 0 {
+		result["note"] = "No new matching mail"
+	}
+	resultJSON, _ := json.MarshalIndent(result, "", "  ")
+	return mcp.NewToolResultText(string(resultJSON)), nil
+}
+
+// runRules applies each rule to the newest matching messages it hasn't handled and
+// records what it did. newOnly limits rules to mail received after they were saved.
+func (g *GmailServer) runRules(ctx context.Context, rules []rule, trigger string, dryRun, newOnly bool) ([]ruleActivity, []string) {
+	// One run at a time, so a scheduled run and run_rules_now can't act on the same
+	// mail twice or save over each other's state
+	g.rulesRunMu.Lock()
+	defer g.rulesRunMu.Unlock()
+
+	g.rulesMu.Lock()
+	state := g.loadRuleState()
+	g.rulesMu.Unlock()
+
+	var activity []ruleActivity
+	var errs []string
+	labelIDs := map[string]string{}
+	for _, r := range rules {
+		key := strings.ToLower(r.Name)
+		handled := state.Processed[key]
+		if handled == nil {
+			handled = map[string]time.Time{}
+			state.Processed[key] = handled
+		}
+
+		query := r.Query
+		if newOnly && !r.Created.IsZero() {
+			query = fmt.Sprintf("(%s) after:%d", query, r.Created.Unix())
+		}
+		messages, err := g.client.ListMessages(ctx, query, maxRuleMatches)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", r.Name, err))
+			continue
+		}
+
+		// One entry per thread, for its newest unhandled message
+		done := map[string]bool{}
+		for _, listed := range messages.Messages {
+			if _, ok := handled[listed.Id]; ok || done[listed.ThreadId] {
+				continue
+			}
+			done[listed.ThreadId] = true
+			entry := g.applyRule(ctx, r, listed, labelIDs, dryRun)
+			entry.Trigger = trigger
+			activity = append(activity, entry)
+			if !dryRun && entry.Error == "" {
+				now := time.Now()
+				for _, other := range messages.Messages {
+					if other.ThreadId == listed.ThreadId {
+						handled[other.Id] = now
+					}
+				}
+			}
+		}
+	}
+
+	if !dryRun {
+		if err := g.notifyRuleMatches(ctx, activity); err != nil {
+			errs = append(errs, fmt.Sprintf("notify: %v", err))
+		}
+		g.rulesMu.Lock()
+		g.saveRuleState(state)
+		g.appendRuleActivity(activity)
+		g.rulesMu.Unlock()
+	}
+	return activity, errs
+}
+
+// applyRule carries out a rule's actions on the thread of one matching message
+func (g *GmailServer) applyRule(ctx context.Context, r rule, listed *gmail.Message, labelIDs map[string]string, dryRun bool) ruleActivity {
+	entry := ruleActivity{Time: time.Now().UTC(), Rule: r.Name, ThreadID: listed.ThreadId, MessageID: listed.Id, DryRun: dryRun}
+	summarize := containsString(r.Actions, ruleSummarize)
+
+	var message *gmail.Message
+	var err error
+	if summarize {
+		message, err = g.getMessage(ctx, listed.Id)
+	} else {
+		message, err = g.client.GetMessage(ctx, listed.Id, gmailclient.GetOptions{Format: "metadata", MetadataHeaders: []string{"Subject", "From"}})
+	}
+	if err != nil {
+		entry.Error = fmt.Sprintf("could not read message: %v", err)
+		return entry
+	}
+	entry.Subject, entry.From = messageHeader(message, "Subject"), messageHeader(message, "From")
+
+	modify := &gmail.ModifyThreadRequest{}
+	for _, action := range r.Actions {
+		switch {
+		case strings.HasPrefix(action, "label:"):
+			name := strings.TrimPrefix(action, "label:")
+			if dryRun {
+				break
+			}
+			id, ok := labelIDs[name]
+			if !ok {
+				if id, err = g.ensureLabel(ctx, name); err != nil {
+					entry.Error = fmt.Sprintf("could not prepare label %q: %v", name, g.permissionHint(err))
+					return entry
+				}
+				labelIDs[name] = id
+			}
+			modify.AddLabelIds = append(modify.AddLabelIds, id)
+		case action == ruleArchive:
+			modify.RemoveLabelIds = append(modify.RemoveLabelIds, "INBOX")
+		case action == ruleMarkRead:
+			modify.RemoveLabelIds = append(modify.RemoveLabelIds, "UNREAD")
+		case action == ruleStar:
+			modify.AddLabelIds = append(modify.AddLabelIds, "STARRED")
+		}
+	}
+
+	if !dryRun && (len(modify.AddLabelIds) > 0 || len(modify.RemoveLabelIds) > 0) {
+		if _, err := g.client.ModifyThread(ctx, listed.ThreadId, modify); err != nil {
+			entry.Error = fmt.Sprintf("could not modify thread: %v", g.permissionHint(err))
+			return entry
+		}
+	}
+	if summarize && !dryRun {
+		if entry.Summary, err = summarizeForRule(ctx, message); err != nil {
+			// The other actions were done; the summary is reported as missing
+			entry.Error = fmt.Sprintf("could not summarize: %v", err)
+		}
+	}
+	entry.Actions = r.Actions
+	return entry
+}
+
+// notifyRuleMatches emails the user one message listing this run's matches of rules
+// with the notify action, through the outbox, and records the email on their entries
+func (g *GmailServer) notifyRuleMatches(ctx context.Context, activity []ruleActivity) error {
+	var notify []int
+	for i, entry := range activity {
+		if entry.Error == "" && containsString(entry.Actions, ruleNotify) {
+			notify = append(notify, i)
+		}
+	}
+	if len(notify) == 0 {
+		return nil
+	}
+	me := g.userEmail(ctx)
+	if me == "" {
+		return toolerr.New(toolerr.Unavailable, "profile_unavailable", "Could not look up your address to email the rule notification")
+	}
+
+	subject := fmt.Sprintf("Rules matched %d new email(s)", len(notify))
+	var body strings.Builder
+	for _, i := range notify {
+		entry := activity[i]
+		fmt.Fprintf(&body, "- [%s] %s\n  From: %s\n  https://mail.google.com/mail/#all/%s\n", entry.Rule, entry.Subject, entry.From, entry.ThreadID)
+		if entry.Summary != "" {
+			fmt.Fprintf(&body, "  %s\n", entry.Summary)
+		}
+	}
+	sent, err := g.queueSend(ctx, me, subject, reportEmail(me, subject, body.String()))
+	if err != nil {
+		return err
+	}
+	if sent.Status == outboxFailed {
+		return fmt.Errorf("%s", sent.LastError)
+	}
+	log.Printf("🔔 Emailed a notification for %d rule match(es)", len(notify))
+	for _, i := range notify {
+		activity[i].NotifiedIn = sent.ID
+	}
+	return nil
+}
+
+// summarizeForRule writes a two-sentence summary of a message with the configured
+// model, redacting personal data first when GMAIL_MCP_REDACT=1
+func summarizeForRule(ctx context.Context, message *gmail.Message) (string, error) {
+	client, err := llm.NewClient()
+	if err != nil {
+		return "", err
+	}
+	body := truncateText(extract.EmailBody(message), maxRuleSummaryChars)
+	redactor := redact.FromEnv()
+	names := messageNames(message)
+	subject, _ := redactor.Redact(messageHeader(message, "Subject"), names...)
+	body, _ = redactor.Redact(body, names...)
+
+	completion, err := client.Chat.Completions.New(ctx, openai.ChatCompletionNewParams{
+		Messages: []openai.ChatCompletionMessageParamUnion{
+			{
+				OfUser: &openai.ChatCompletionUserMessageParam{
+					Content: openai.ChatCompletionUserMessageParamContentUnion{
+						OfString: openai.String(fmt.Sprintf("Summarize this email in at most two sentences, including any request or deadline. Reply with the summary only.\n\nSubject: %s\n\n%s", subject, body)),
+					},
+				},
+			},
+		},
+		Model:       llm.ChatModel(),
+		Temperature: openai.Float(0.2),
+	})
+	if err != nil {
+		return "", err
+	}
+	if len(completion.Choices) == 0 {
+		return "", fmt.Errorf("no response from the model")
+	}
+	return strings.TrimSpace(completion.Choices[0].Message.Content), nil
+}
+
+// startRulesWorker starts checking the rules in the background, every
+// GMAIL_MCP_RULES_INTERVAL minutes, unless it's already running
+func (g *GmailServer) startRulesWorker() {
+	g.rulesMu.Lock()
+	defer g.rulesMu.Unlock()
+	if g.rulesRunning {
+		return
+	}
+	g.rulesRunning = true
+	go g.runRulesWorker()
+}
+
+// runRulesWorker runs the enabled rules on new mail at every interval
+func (g *GmailServer) runRulesWorker() {
+	for {
+		time.Sleep(time.Duration(envLimit("GMAIL_MCP_RULES_INTERVAL", defaultRulesInterval)) * time.Minute)
+
+		g.rulesMu.Lock()
+		rules, err := g.loadRules()
+		g.rulesMu.Unlock()
+		if err != nil {
+			log.Printf("Warning: Rules not run: %v", err)
+			continue
+		}
+		var enabled []rule
+		for _, r := range rules {
+			if !r.Disabled {
+				enabled = append(enabled, r)
+			}
+		}
+		if len(enabled) == 0 || !g.IsAuthenticated() {
+			continue
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), ruleRunTimeout)
+		activity, errs := g.runRules(ctx, enabled, "schedule", false, true)
+		cancel()
+		if len(activity) > 0 {
+			log.Printf("📋 Rules handled %d new thread(s)", len(activity))
+		}
+		for _, err := range errs {
+			log.Printf("Warning: Rule failed: %s", err)
+		}
+	}
+}
+
+// containsString reports whether values holds value
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
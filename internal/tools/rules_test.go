@@ -0,0 +1,141 @@
+package tools
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"auto-gmail/internal/gmailclient"
+)
+
+func TestParseRuleActions(t *testing.T) {
+	tests := []struct {
+		name    string
+		list    string
+		want    []string
+		wantErr string
+	}{
+		{"single", "archive", []string{ruleArchive}, ""},
+		{"several", "label:Receipts, archive, notify", []string{"label:Receipts", ruleArchive, ruleNotify}, ""},
+		{"case and spaces", " Mark_Read ,STAR,, summarize ", []string{ruleMarkRead, ruleStar, ruleSummarize}, ""},
+		{"label keeps its case and nesting", "label: Clients/Acme Corp ", []string{"label:Clients/Acme Corp"}, ""},
+		{"empty label", "label:", nil, "needs a label name"},
+		{"unknown action", "archive, delete", nil, `unknown action "delete"`},
+		{"no actions", " , ", nil, "at least one action"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseRuleActions(tt.list)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("parseRuleActions(%q) error = %v, want it to mention %q", tt.list, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseRuleActions(%q) = %v, %v, want %v", tt.list, got, err, tt.want)
+			}
+		})
+	}
+}
+
+// ruleRun is the part of a run_rules_now result the tests check
+type ruleRun struct {
+	Handled  int            `json:"handled"`
+	DryRun   bool           `json:"dryRun"`
+	Activity []ruleActivity `json:"activity"`
+	Errors   []string       `json:"errors"`
+}
+
+// threadLabels returns the labels on a thread's first message in the fake mailbox
+func threadLabels(t *testing.T, fake *gmailclient.Fake, threadID string) []string {
+	t.Helper()
+	thread, err := fake.GetThread(context.Background(), threadID, gmailclient.GetOptions{})
+	if err != nil {
+		t.Fatalf("GetThread(%s) error = %v", threadID, err)
+	}
+	return thread.Messages[0].LabelIds
+}
+
+func TestRunRules(t *testing.T) {
+	fake := loadFake(t)
+	tools := newTestTools(t, fake)
+	tools.decode(t, "manage_rules", map[string]interface{}{
+		"action": "set", "name": "invoices", "query": "from:billing@vendor.example", "actions": "label:Receipts, archive, notify",
+	}, &struct{}{})
+	tools.decode(t, "manage_rules", map[string]interface{}{
+		"action": "set", "name": "alice", "query": "from:alice@example.com", "actions": "star",
+	}, &struct{}{})
+
+	var preview ruleRun
+	tools.decode(t, "run_rules_now", map[string]interface{}{"name": "invoices", "dry_run": true}, &preview)
+	if !preview.DryRun || preview.Handled != 1 || preview.Activity[0].ThreadID != invoiceThread {
+		t.Fatalf("run_rules_now dry run = %+v, want the invoice thread", preview)
+	}
+	if labels := threadLabels(t, fake, invoiceThread); !containsString(labels, "INBOX") {
+		t.Errorf("dry run changed the invoice thread's labels to %v", labels)
+	}
+
+	var run ruleRun
+	tools.decode(t, "run_rules_now", map[string]interface{}{}, &run)
+	if run.Handled != 2 || len(run.Errors) > 0 {
+		t.Fatalf("run_rules_now = %+v, want both rules to handle one thread each", run)
+	}
+	byRule := map[string]ruleActivity{}
+	for _, entry := range run.Activity {
+		byRule[entry.Rule] = entry
+	}
+	invoices, alice := byRule["invoices"], byRule["alice"]
+	if invoices.ThreadID != invoiceThread || invoices.Subject != "Your invoice is ready" || invoices.NotifiedIn == "" {
+		t.Errorf("invoices rule activity = %+v, want the invoice thread with a notification", invoices)
+	}
+	// Only Alice's message matches, not the reply sent in the same thread
+	if alice.ThreadID != planningThread || alice.MessageID != planningThread || alice.NotifiedIn != "" {
+		t.Errorf("alice rule activity = %+v, want Alice's message without a notification", alice)
+	}
+
+	labels := threadLabels(t, fake, invoiceThread)
+	if containsString(labels, "INBOX") || len(labels) != 2 {
+		t.Errorf("invoice thread labels = %v, want it archived with the Receipts label", labels)
+	}
+	if labels := threadLabels(t, fake, planningThread); !containsString(labels, "STARRED") {
+		t.Errorf("planning thread labels = %v, want it starred", labels)
+	}
+
+	// The notification is an email to the user, listed in the outbox
+	var outbox struct {
+		Messages []struct {
+			ID      string `json:"id"`
+			To      string `json:"to"`
+			Subject string `json:"subject"`
+			Status  string `json:"status"`
+		} `json:"messages"`
+	}
+	tools.decode(t, "outbox_status", map[string]interface{}{}, &outbox)
+	if len(outbox.Messages) != 1 || outbox.Messages[0].ID != invoices.NotifiedIn || outbox.Messages[0].To != "me@example.com" ||
+		outbox.Messages[0].Status != outboxSent || outbox.Messages[0].Subject != "Rules matched 1 new email(s)" {
+		t.Errorf("outbox = %+v, want the sent notification", outbox.Messages)
+	}
+
+	// Handled mail isn't handled again
+	var again ruleRun
+	tools.decode(t, "run_rules_now", map[string]interface{}{}, &again)
+	if again.Handled != 0 {
+		t.Errorf("second run_rules_now = %+v, want nothing new", again)
+	}
+
+	// Every action taken is in the audit log that manage_rules lists from
+	var listed struct {
+		Rules []struct {
+			Name           string         `json:"name"`
+			RecentActivity []ruleActivity `json:"recentActivity"`
+		} `json:"rules"`
+	}
+	tools.decode(t, "manage_rules", map[string]interface{}{"action": "list"}, &listed)
+	for _, r := range listed.Rules {
+		if len(r.RecentActivity) != 1 || r.RecentActivity[0].Trigger != "run_rules_now" || r.RecentActivity[0].DryRun {
+			t.Errorf("rule %s recent activity = %+v, want the one run", r.Name, r.RecentActivity)
+		}
+	}
+}
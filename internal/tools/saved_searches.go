@@ -0,0 +1,165 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+
+	"auto-gmail/internal/toolerr"
+)
+
+// savedSearch is a named Gmail query kept in saved-searches.json
+type savedSearch struct {
+	Name        string    `json:"name"`
+	Query       string    `json:"query"`
+	Description string    `json:"description,omitempty"`
+	OrderBy     string    `json:"orderBy,omitempty"` // a search_threads sort; "date" and "priority" still work
+	MaxResults  int64     `json:"maxResults,omitempty"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+}
+
+// savedSearchFile is where this server's saved searches are stored, next to its token.
+// It's plain JSON so users can edit their searches by hand.
+func (g *GmailServer) savedSearchFile() string {
+	return g.dataFile("saved-searches.json")
+}
+
+// loadSavedSearches reads the saved searches, sorted by name
+func (g *GmailServer) loadSavedSearches() ([]savedSearch, error) {
+	var stored struct {
+		Searches []savedSearch `json:"searches"`
+	}
+	data, err := os.ReadFile(g.savedSearchFile())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return nil, toolerr.Errorf(toolerr.ParseFailure, "invalid_data_file", "invalid saved searches file %s: %v", g.savedSearchFile(), err)
+	}
+	sort.Slice(stored.Searches, func(i, j int) bool {
+		return strings.ToLower(stored.Searches[i].Name) < strings.ToLower(stored.Searches[j].Name)
+	})
+	return stored.Searches, nil
+}
+
+// findSavedSearch returns the index of the search named name (case-insensitive), or -1
+func findSavedSearch(searches []savedSearch, name string) int {
+	for i, search := range searches {
+		if strings.EqualFold(search.Name, name) {
+			return i
+		}
+	}
+	return -1
+}
+
+// SaveSearch stores a named query, replacing a search of the same name, or deletes it
+func (g *GmailServer) SaveSearch(search savedSearch, remove bool) (*mcp.CallToolResult, error) {
+	search.Name = strings.TrimSpace(search.Name)
+	search.Query = strings.TrimSpace(search.Query)
+	if search.Name == "" {
+		return toolerr.Invalid("name parameter is required"), nil
+	}
+
+	g.savedSearchMu.Lock()
+	defer g.savedSearchMu.Unlock()
+
+	searches, err := g.loadSavedSearches()
+	if err != nil {
+		return toolerr.Result(err, "Failed to read saved searches"), nil
+	}
+	index := findSavedSearch(searches, search.Name)
+
+	action := "saved"
+	switch {
+	case remove:
+		if index < 0 {
+			return toolerr.New(toolerr.NotFound, "saved_search_not_found", fmt.Sprintf("No saved search named '%s'", search.Name)).Result(), nil
+		}
+		search = searches[index]
+		searches = append(searches[:index], searches[index+1:]...)
+		action = "deleted"
+	default:
+		if search.Query == "" {
+			return toolerr.Invalid("query parameter is required"), nil
+		}
+		if problems := lintQuery(search.Query); len(problems) > 0 {
+			return invalidQueryError(search.Query, problems), nil
+		}
+		if _, ok := searchSort(search.OrderBy); !ok {
+			return toolerr.Invalid(fmt.Sprintf("Invalid order_by '%s': use %s", search.OrderBy, strings.Join(searchSorts, ", "))), nil
+		}
+		search.UpdatedAt = time.Now()
+		if index >= 0 {
+			searches[index] = search
+			action = "updated"
+		} else {
+			searches = append(searches, search)
+		}
+	}
+
+	data, _ := json.MarshalIndent(map[string]interface{}{"searches": searches}, "", "  ")
+	if err := os.WriteFile(g.savedSearchFile(), data, 0600); err != nil {
+		return toolerr.Result(err, "Failed to save searches"), nil
+	}
+
+	result := map[string]interface{}{
+		"action": action,
+		"search": search,
+		"count":  len(searches),
+	}
+
+	resultJSON, _ := json.MarshalIndent(result, "", "  ")
+	return mcp.NewToolResultText(string(resultJSON)), nil
+}
+
+// ListSavedSearches lists the saved searches and where they're stored
+func (g *GmailServer) ListSavedSearches() (*mcp.CallToolResult, error) {
+	searches, err := g.loadSavedSearches()
+	if err != nil {
+		return toolerr.Result(err, "Failed to read saved searches"), nil
+	}
+	if searches == nil {
+		searches = []savedSearch{}
+	}
+
+	result := map[string]interface{}{
+		"searches": searches,
+		"count":    len(searches),
+		"file":     g.savedSearchFile(),
+	}
+
+	resultJSON, _ := json.MarshalIndent(result, "", "  ")
+	return mcp.NewToolResultText(string(resultJSON)), nil
+}
+
+// RunSavedSearch runs a saved search through search_threads. maxResults overrides the
+// saved limit when positive.
+func (g *GmailServer) RunSavedSearch(ctx context.Context, name string, maxResults int64) (*mcp.CallToolResult, error) {
+	searches, err := g.loadSavedSearches()
+	if err != nil {
+		return toolerr.Result(err, "Failed to read saved searches"), nil
+	}
+	index := findSavedSearch(searches, strings.TrimSpace(name))
+	if index < 0 {
+		names := make([]string, len(searches))
+		for i, search := range searches {
+			names[i] = search.Name
+		}
+		return toolerr.New(toolerr.NotFound, "saved_search_not_found", fmt.Sprintf("No saved search named '%s'. Saved searches: %v", name, names)).Result(), nil
+	}
+
+	search := searches[index]
+	if maxResults <= 0 {
+		maxResults = search.MaxResults
+	}
+	return g.SearchThreads(ctx, search.Query, maxResults, search.OrderBy, "", false)
+}
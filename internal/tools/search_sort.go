@@ -0,0 +1,121 @@
+package tools
+
+import (
+	"sort"
+	"strings"
+)
+
+// Orders search_threads can return results in
+const (
+	SortNewest    = "newest"
+	SortOldest    = "oldest"
+	SortRelevance = "relevance"
+	SortPriority  = "priority-score"
+)
+
+// searchSorts lists the orders for parameter enums
+var searchSorts = []string{SortNewest, SortOldest, SortRelevance, SortPriority}
+
+// Which snippets search_threads returns: the first message's ("snippet"), the latest
+// message's ("latestSnippet", for threads with replies), both or neither
+const (
+	SnippetsBoth   = "both"
+	SnippetsFirst  = "first"
+	SnippetsLatest = "latest"
+	SnippetsNone   = "none"
+)
+
+// snippetModes lists the snippet choices for parameter enums
+var snippetModes = []string{SnippetsBoth, SnippetsFirst, SnippetsLatest, SnippetsNone}
+
+// maxOldestScan is how many matching threads are listed to find the oldest ones;
+// Gmail only lists newest first
+const maxOldestScan = 500
+
+// searchSort reads a sort order, accepting order_by's older "date" and "priority"
+func searchSort(value string) (string, bool) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "", "date", SortNewest:
+		return SortNewest, true
+	case "priority", SortPriority:
+		return SortPriority, true
+	case SortOldest:
+		return SortOldest, true
+	case SortRelevance:
+		return SortRelevance, true
+	}
+	return "", false
+}
+
+// sortThreadResults orders search results in place. latest holds each thread's most
+// recent message time by thread ID; terms are the query's search words for relevance.
+// Ties keep the newest first.
+func sortThreadResults(results []map[string]interface{}, order string, latest map[string]int64, terms []string) {
+	newest := func(i, j int) bool {
+		return latest[results[i]["threadId"].(string)] > latest[results[j]["threadId"].(string)]
+	}
+	sort.SliceStable(results, newest)
+
+	switch order {
+	case SortOldest:
+		sort.SliceStable(results, func(i, j int) bool { return newest(j, i) })
+	case SortPriority:
+		sortByPriority(results)
+	case SortRelevance:
+		scores := make(map[string]int, len(results))
+		for _, result := range results {
+			scores[result["threadId"].(string)] = relevanceScore(result, terms)
+		}
+		sort.SliceStable(results, func(i, j int) bool {
+			return scores[results[i]["threadId"].(string)] > scores[results[j]["threadId"].(string)]
+		})
+	}
+}
+
+// relevanceScore weighs where a result mentions the search terms: the subject counts
+// most, then the sender, then the snippet
+func relevanceScore(result map[string]interface{}, terms []string) int {
+	subject, _ := result["subject"].(string)
+	from, _ := result["from"].(string)
+	snippet, _ := result["snippet"].(string)
+	subject, from, snippet = strings.ToLower(subject), strings.ToLower(from), strings.ToLower(snippet)
+
+	score := 0
+	for _, term := range terms {
+		if strings.Contains(subject, term) {
+			score += 3
+		}
+		if strings.Contains(from, term) {
+			score += 2
+		}
+		if strings.Contains(snippet, term) {
+			score++
+		}
+	}
+	return score
+}
+
+// queryTerms returns the words and phrases a query searches for: free text and the
+// values of from:, to:, cc: and subject:, lowercased. Excluded (-) terms, boolean
+// operators and other operators are left out.
+func queryTerms(query string) []string {
+	var terms []string
+	for _, token := range queryTokens(query) {
+		token = strings.Trim(token, "(){}")
+		if token == "" || strings.HasPrefix(token, "-") || token == "OR" || token == "AND" || token == "AROUND" {
+			continue
+		}
+		if match := queryOperatorPattern.FindStringSubmatch(token); match != nil {
+			switch strings.ToLower(match[1]) {
+			case "from", "to", "cc", "subject":
+				token = match[2]
+			default:
+				continue
+			}
+		}
+		if term := strings.ToLower(strings.Trim(token, `"+(){}`)); term != "" {
+			terms = append(terms, term)
+		}
+	}
+	return terms
+}
@@ -0,0 +1,132 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"auto-gmail/internal/toolerr"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"google.golang.org/api/gmail/v1"
+)
+
+// maxSenderHistoryScan caps how many messages per direction sender_history inspects
+const maxSenderHistoryScan = 200
+
+// SenderHistory summarizes the user's past mail with a sender: whether they have
+// ever corresponded, how long the relationship is and whether mail from the sender
+// usually gets archived unread. It is context for triage and phishing checks.
+func (g *GmailServer) SenderHistory(ctx context.Context, sender string) (*mcp.CallToolResult, error) {
+	address := strings.ToLower(senderAddress(strings.TrimSpace(sender)))
+	if address == "" || !strings.Contains(address, "@") {
+		return toolerr.Invalid(fmt.Sprintf("Invalid sender %q: use an email address", sender)), nil
+	}
+
+	received, err := g.messagesMatching(ctx, fmt.Sprintf("from:%s", address))
+	if err != nil {
+		return toolerr.Result(err, fmt.Sprintf("Failed to search mail from %s", address)), nil
+	}
+	sent, err := g.messagesMatching(ctx, fmt.Sprintf("to:%s in:sent", address))
+	if err != nil {
+		return toolerr.Result(err, fmt.Sprintf("Failed to search mail to %s", address)), nil
+	}
+
+	var firstSeen, lastReceived, lastSent int64
+	receivedCount, archivedUnread := 0, 0
+	for _, message := range received {
+		// The user's own sent mail can match from: too; it isn't mail received from the sender
+		if hasLabelID(message, "SENT") {
+			continue
+		}
+		receivedCount++
+		if firstSeen == 0 || message.InternalDate < firstSeen {
+			firstSeen = message.InternalDate
+		}
+		if message.InternalDate > lastReceived {
+			lastReceived = message.InternalDate
+		}
+		if hasLabelID(message, "UNREAD") && !hasLabelID(message, "INBOX") {
+			archivedUnread++
+		}
+	}
+	for _, message := range sent {
+		if firstSeen == 0 || message.InternalDate < firstSeen {
+			firstSeen = message.InternalDate
+		}
+		if message.InternalDate > lastSent {
+			lastSent = message.InternalDate
+		}
+	}
+
+	firstContact := len(sent) == 0 && receivedCount <= 1
+	result := map[string]interface{}{
+		"sender":             address,
+		"receivedCount":      receivedCount,
+		"sentCount":          len(sent),
+		"correspondedBefore": len(sent) > 0,
+		"firstContact":       firstContact,
+		"archivedUnread":     archivedUnread,
+	}
+	if firstSeen != 0 {
+		result["firstSeen"] = formatInternalDate(firstSeen)
+		result["relationshipDays"] = int(time.Since(time.UnixMilli(firstSeen)).Hours() / 24)
+	}
+	if lastReceived != 0 {
+		result["lastReceived"] = formatInternalDate(lastReceived)
+	}
+	if lastSent != 0 {
+		result["lastSent"] = formatInternalDate(lastSent)
+	}
+	if receivedCount > 0 {
+		result["archivedUnreadRate"] = float64(archivedUnread) / float64(receivedCount)
+	}
+
+	// Plain-language signals so agents don't have to interpret the numbers
+	var signals []string
+	switch {
+	case receivedCount == 0 && len(sent) == 0:
+		signals = append(signals, "No mail has ever been exchanged with this sender.")
+	case firstContact:
+		signals = append(signals, "First contact: the user has never written to this sender and this is their only message. Treat requests for payments, credentials or urgent action with caution.")
+	case len(sent) > 0:
+		signals = append(signals, fmt.Sprintf("Known contact: the user has written to this sender %d time(s).", len(sent)))
+	default:
+		signals = append(signals, "One-way sender: the user has received mail but never replied.")
+	}
+	if receivedCount >= 3 && archivedUnread*2 > receivedCount {
+		signals = append(signals, "Mail from this sender is usually archived unread; it is probably low priority.")
+	}
+	if len(received) >= maxSenderHistoryScan || len(sent) >= maxSenderHistoryScan {
+		signals = append(signals, fmt.Sprintf("Only the %d most recent messages in each direction were checked, so the relationship may be older.", maxSenderHistoryScan))
+	}
+	result["signals"] = signals
+
+	resultJSON, _ := json.MarshalIndent(result, "", "  ")
+	return mcp.NewToolResultText(string(resultJSON)), nil
+}
+
+// messagesMatching returns the labels and dates of the most recent messages matching query
+func (g *GmailServer) messagesMatching(ctx context.Context, query string) ([]*gmail.Message, error) {
+	list, err := g.client.ListMessages(ctx, query, maxSenderHistoryScan)
+	if err != nil {
+		return nil, err
+	}
+
+	messageIDs := make([]string, len(list.Messages))
+	for i, msg := range list.Messages {
+		messageIDs[i] = msg.Id
+	}
+	// Labels and internal dates come with every metadata response; skip the other headers
+	hydrated := g.hydrateMessageHeaders(ctx, messageIDs, []string{"Date"})
+
+	messages := make([]*gmail.Message, 0, len(hydrated))
+	for _, id := range messageIDs {
+		if message, ok := hydrated[id]; ok {
+			messages = append(messages, message)
+		}
+	}
+	return messages, nil
+}
@@ -0,0 +1,399 @@
+// Package tools implements the Gmail MCP tools, prompts and resources on top of
+// a GmailServer per mailbox, and registers them on an MCP server.
+package tools
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"auto-gmail/internal/auth"
+	"auto-gmail/internal/config"
+	"auto-gmail/internal/extract"
+	"auto-gmail/internal/gmailclient"
+	"auto-gmail/internal/toolerr"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"golang.org/x/oauth2"
+	"google.golang.org/api/gmail/v1"
+)
+
+// GmailServer serves the Gmail tools for one mailbox. It starts unauthenticated
+// unless a cached token is found, and holds the account's caches and files.
+type GmailServer struct {
+	// client is the Gmail backend; nil until authenticated
+	client gmailclient.Client
+	userID string
+
+	// config is kept so authentication can be (re)started lazily from a tool call
+	config *oauth2.Config
+	// tokenFile is where this server's OAuth token is cached
+	tokenFile string
+	// tokenSource is the authorized client's token source, used to look up granted
+	// scopes; nil for backends that don't use Google OAuth
+	tokenSource oauth2.TokenSource
+	// styleGuideFile is where this server's personal email style guide lives
+	styleGuideFile string
+	// cache holds recently fetched threads and messages for this account
+	cache *gmailCache
+	// extractCache holds extracted attachment text between calls
+	extractCache *extract.Cache
+	// delta tracks which thread messages each session was already given
+	delta *deltaTracker
+	// pool is set for per-user servers in multi-user HTTP mode; their OAuth
+	// callback is served by the main HTTP server instead of a temporary one
+	pool *GmailServerPool
+	// principal is the Gmail address a per-user server may act as
+	principal string
+
+	authMu         sync.RWMutex
+	authReady      bool
+	authInProgress bool
+	authURL        string
+	authErr        error
+	// emailAddress is the account's address, looked up on first use
+	emailAddress string
+	// workersEnabled is set by StartBackgroundWorkers; background work for the
+	// account only runs once it is set and the account is authenticated
+	workersEnabled bool
+
+	// idempotencyMu serializes mutating calls that carry an idempotency key
+	idempotencyMu sync.Mutex
+	// memoryMu serializes writes to the memory file
+	memoryMu sync.Mutex
+	// styleGuideMu serializes user edits to the style guide
+	styleGuideMu sync.Mutex
+	// savedSearchMu serializes writes to the saved searches file
+	savedSearchMu sync.Mutex
+	// groupsMu serializes writes to the recipient groups file
+	groupsMu sync.Mutex
+	// outboxMu serializes access to the outbox file; outboxRunning is set while
+	// the retry loop runs
+	outboxMu      sync.Mutex
+	outboxRunning bool
+	// rulesMu serializes access to the rules, their state and audit files;
+	// rulesRunning is set while the background rules loop runs
+	rulesMu      sync.Mutex
+	rulesRunning bool
+	// rulesRunMu is held for the whole of a rules run
+	rulesRunMu sync.Mutex
+	// digestMu serializes access to the digests file; digestRunning is set while
+	// the scheduled digest loop runs
+	digestMu      sync.Mutex
+	digestRunning bool
+	// projectsMu serializes access to the tracked projects file
+	projectsMu sync.Mutex
+	// backupMu is held while a backup runs, so two can't write the same files
+	backupMu sync.Mutex
+	// correspondentsMu guards the recipients of recent sent mail used for priority
+	// scores, and when they were read
+	correspondentsMu    sync.Mutex
+	correspondentCounts map[string]int
+	correspondentsRead  time.Time
+}
+
+// NewGmailServer creates the Gmail server without blocking on OAuth.
+// If a valid cached token exists the server is authenticated immediately,
+// otherwise it starts unauthenticated and waits for the authenticate tool.
+func NewGmailServer() (*GmailServer, error) {
+	oauthConfig, err := auth.NewOAuthConfig()
+	if err != nil {
+		return nil, err
+	}
+	return newGmailServerWithTokenFile(oauthConfig, config.AppFilePath("token.json"))
+}
+
+// newGmailServerWithTokenFile creates a server that caches its OAuth token in tokenFile
+func newGmailServerWithTokenFile(oauthConfig *oauth2.Config, tokenFile string) (*GmailServer, error) {
+	g := &GmailServer{
+		userID:         "me",
+		config:         oauthConfig,
+		tokenFile:      tokenFile,
+		styleGuideFile: config.AppFilePath("personal-email-style-guide.md"),
+		cache:          newGmailCache(),
+		delta:          newDeltaTracker(),
+		extractCache:   extract.NewCache(config.AppFilePath("extraction-cache")),
+	}
+
+	// Use a cached token if we have one, but never start the OAuth flow here
+	token, err := auth.LoadToken(tokenFile)
+	if err != nil {
+		log.Printf("🔑 Gmail not authenticated yet (%v). Call the authenticate tool to connect.", err)
+		return g, nil
+	}
+
+	if err := g.setToken(token); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// NewGmailServerWithClient creates an already-authenticated server on top of any
+// Gmail backend, e.g. a replay client or gmailclient.Fake. It has no OAuth config,
+// so the authenticate tool reports it as connected and never starts a flow.
+func NewGmailServerWithClient(client gmailclient.Client) *GmailServer {
+	return newGmailServerWithClient(client, config.AppDataDir())
+}
+
+// newGmailServerWithClient creates a server on client that keeps its files in dataDir.
+// Every path is set before the client is installed.
+func newGmailServerWithClient(client gmailclient.Client, dataDir string) *GmailServer {
+	g := &GmailServer{
+		userID:         "me",
+		tokenFile:      filepath.Join(dataDir, "token.json"),
+		styleGuideFile: filepath.Join(dataDir, "personal-email-style-guide.md"),
+		cache:          newGmailCache(),
+		delta:          newDeltaTracker(),
+		extractCache:   extract.NewCache(filepath.Join(dataDir, "extraction-cache")),
+	}
+	g.SetClient(client)
+	return g
+}
+
+// setToken creates the Gmail client for the token and marks the server as authenticated
+func (g *GmailServer) setToken(token *oauth2.Token) error {
+	return g.setHTTPClient(g.config.Client(context.Background(), token))
+}
+
+// setHTTPClient creates the Gmail client on an authorized HTTP client and marks the server as authenticated
+func (g *GmailServer) setHTTPClient(httpClient *http.Client) error {
+	var tokenSource oauth2.TokenSource
+	if transport, ok := httpClient.Transport.(*oauth2.Transport); ok {
+		tokenSource = transport.Source
+	}
+
+	// Optionally keep sanitized copies of every API response for offline replay
+	if dir := os.Getenv("GMAIL_MCP_RECORD_DIR"); dir != "" {
+		httpClient = gmailclient.RecordHTTPClient(httpClient, dir)
+	}
+	// Log failed API calls under the request ID of the tool call that made them
+	httpClient = gmailclient.TraceHTTPClient(httpClient)
+
+	client, err := gmailclient.NewAPIClient(context.Background(), httpClient, g.userID)
+	if err != nil {
+		return fmt.Errorf("unable to create Gmail service: %v", err)
+	}
+
+	// Sync fetched mail to disk so searches keep working when Gmail is unreachable
+	if snapshotEnabled() {
+		g.SetClient(gmailclient.NewSnapshot(client, g.snapshotDir()))
+	} else {
+		g.SetClient(client)
+	}
+
+	g.authMu.Lock()
+	g.tokenSource = tokenSource
+	g.authMu.Unlock()
+	return nil
+}
+
+// SetClient installs a Gmail backend and marks the server as authenticated.
+// It lets callers run the server against another backend, such as gmailclient.Fake.
+func (g *GmailServer) SetClient(client gmailclient.Client) {
+	g.authMu.Lock()
+	g.client = client
+	g.tokenSource = nil
+	g.authReady = true
+	g.authInProgress = false
+	g.authURL = ""
+	g.authErr = nil
+	g.emailAddress = ""
+	workersEnabled := g.workersEnabled
+	g.authMu.Unlock()
+
+	if workersEnabled {
+		g.startBackgroundWorkers()
+	}
+}
+
+// StartBackgroundWorkers lets background work run for this account, now or once it
+// is authenticated. Only the long-running server calls it, and only servers on a
+// real Gmail account take part: servers made by NewGmailServerWithClient (replay,
+// offline, demo and other providers) have no OAuth config and never run it.
+func (g *GmailServer) StartBackgroundWorkers() {
+	if g.config == nil {
+		return
+	}
+	g.authMu.Lock()
+	g.workersEnabled = true
+	ready := g.authReady
+	g.authMu.Unlock()
+
+	if ready {
+		g.startBackgroundWorkers()
+	}
+}
+
+// startBackgroundWorkers starts the account's background work
+func (g *GmailServer) startBackgroundWorkers() {
+	// Pick up sends an earlier run left queued
+	go g.resumeOutbox()
+	// Check automation rules on new mail from now on
+	g.startRulesWorker()
+	// Send scheduled digests even when no MCP client is connected
+	g.startDigestWorker()
+}
+
+// IsAuthenticated reports whether the server has a usable Gmail service
+func (g *GmailServer) IsAuthenticated() bool {
+	g.authMu.RLock()
+	defer g.authMu.RUnlock()
+	return g.authReady
+}
+
+// requireAuth returns an "auth required" tool result when Gmail is not connected yet, or nil if it is
+func (g *GmailServer) requireAuth() *mcp.CallToolResult {
+	g.authMu.RLock()
+	defer g.authMu.RUnlock()
+	if g.authReady {
+		return nil
+	}
+
+	message := "Gmail authentication required. Call the authenticate tool (or use the authenticate prompt) and complete the Google sign-in, then retry this call."
+	if g.authInProgress && g.authURL != "" {
+		message = fmt.Sprintf("Gmail authentication is in progress. Open this URL to finish signing in, then retry this call: %s", g.authURL)
+		return toolerr.New(toolerr.Auth, "authentication_in_progress", message).
+			WithHint("Ask the user to open the sign-in URL, then retry.").Result()
+	} else if g.authErr != nil {
+		message += fmt.Sprintf(" Last authentication attempt failed: %v", g.authErr)
+	}
+	return toolerr.New(toolerr.Auth, "not_authenticated", message).Result()
+}
+
+// StartAuthentication starts the OAuth flow in the background and returns the authorization URL.
+// Calling it again while a flow is running returns the same URL instead of starting a second flow.
+func (g *GmailServer) StartAuthentication() (string, error) {
+	g.authMu.Lock()
+	if g.authReady {
+		g.authMu.Unlock()
+		return "", nil
+	}
+	if g.authInProgress {
+		url := g.authURL
+		g.authMu.Unlock()
+		return url, nil
+	}
+	if g.config.RedirectURL == "" {
+		g.authMu.Unlock()
+		return "", fmt.Errorf("REDIRECT_URL environment variable not set")
+	}
+
+	g.authInProgress = true
+	g.authErr = nil
+
+	// Per-user servers finish the flow on the main HTTP server's /oauth2callback
+	if g.pool != nil {
+		g.authURL = g.config.AuthCodeURL(g.pool.registerAuthState(g), oauth2.AccessTypeOffline)
+		url := g.authURL
+		g.authMu.Unlock()
+		return url, nil
+	}
+
+	g.authURL = g.config.AuthCodeURL("state-token", oauth2.AccessTypeOffline)
+	url := g.authURL
+	g.authMu.Unlock()
+
+	go func() {
+		token, err := auth.PerformOAuthFlow(g.config, g.tokenFile)
+		if err == nil {
+			err = g.setToken(token)
+		}
+		if err != nil {
+			g.failAuthentication(err)
+			return
+		}
+		log.Println("✅ Gmail authentication successful!")
+	}()
+
+	return url, nil
+}
+
+// failAuthentication records a failed OAuth attempt so the next tool call can report it
+func (g *GmailServer) failAuthentication(err error) {
+	log.Printf("❌ Gmail authentication failed: %v", err)
+	g.authMu.Lock()
+	defer g.authMu.Unlock()
+	g.authInProgress = false
+	g.authURL = ""
+	g.authErr = err
+}
+
+// authURLMessage tells the user how to finish the OAuth flow started by StartAuthentication
+func authURLMessage(authURL string) string {
+	return fmt.Sprintf("🔐 Open this URL in a browser and sign in with Google to connect Gmail:\n\n%s\n\nOnce the browser shows \"Authorization Successful\", retry your Gmail request.", authURL)
+}
+
+// GetUserProfile gets the user's Gmail profile information
+func (g *GmailServer) GetUserProfile() (*gmail.Profile, error) {
+	profile, err := g.client.GetProfile(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user profile: %v", err)
+	}
+	return profile, nil
+}
+
+// SentMessages returns up to max full messages from the Sent folder, newest first
+func (g *GmailServer) SentMessages(ctx context.Context, max int64) ([]*gmail.Message, error) {
+	messages, err := g.client.ListMessages(ctx, "in:sent", max)
+	if err != nil {
+		return nil, err
+	}
+
+	// Fetch all sent messages in batched round trips
+	messageIDs := make([]string, len(messages.Messages))
+	for i, msg := range messages.Messages {
+		messageIDs[i] = msg.Id
+	}
+	fullMessages := g.hydrateMessages(ctx, messageIDs)
+
+	var result []*gmail.Message
+	for _, id := range messageIDs {
+		if msg, ok := fullMessages[id]; ok {
+			result = append(result, msg)
+		}
+	}
+	return result, nil
+}
+
+// Client returns the Gmail backend, or nil before authentication
+func (g *GmailServer) Client() gmailclient.Client {
+	g.authMu.RLock()
+	defer g.authMu.RUnlock()
+	return g.client
+}
+
+// TokenFile is where this server's OAuth token is cached
+func (g *GmailServer) TokenFile() string {
+	return g.tokenFile
+}
+
+// StyleGuideFile is where this server's personal email style guide lives
+func (g *GmailServer) StyleGuideFile() string {
+	return g.styleGuideFile
+}
+
+// dataFile is where this account keeps the named state file or directory, next to its token
+func (g *GmailServer) dataFile(name string) string {
+	return filepath.Join(filepath.Dir(g.tokenFile), name)
+}
+
+// accountDirName names this account's subdirectory under a directory shared by every
+// account: the name of its own data directory, or "default" for the account kept in
+// the app data directory itself
+func (g *GmailServer) accountDirName() string {
+	dir := filepath.Dir(g.tokenFile)
+	if dir == filepath.Clean(config.AppDataDir()) {
+		return "default"
+	}
+	return filepath.Base(dir)
+}
+
+// CacheStats returns the thread/message cache metrics
+func (g *GmailServer) CacheStats() map[string]interface{} {
+	return g.cache.Stats()
+}
@@ -0,0 +1,211 @@
+package tools
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// sessionIdleTimeout ends HTTP sessions that haven't made a request for this long
+const sessionIdleTimeout = deltaSessionTTL
+
+// sessionHeader carries the MCP session ID on streamable HTTP requests
+const sessionHeader = "Mcp-Session-Id"
+
+// httpSession is one HTTP client's MCP session
+type httpSession struct {
+	// principal is the Gmail address of the bearer token that started the session
+	// (empty in single-user mode); every request in it must present the same one
+	principal string
+	lastSeen  time.Time
+	// inFlight cancels the session's running requests
+	inFlight map[uint64]context.CancelFunc
+}
+
+// SessionManager issues and tracks MCP session IDs for the HTTP transport, so
+// simultaneous clients keep separate state. Unknown, ended or expired sessions are
+// reported as terminated, which makes clients start a new one. Ending a session
+// (DELETE, or idling for sessionIdleTimeout) cancels its in-flight tool calls and drops
+// its per-session state, such as delta fetch cursors. The response cache is per
+// account, not per session, since every session of an account sees the same mailbox.
+type SessionManager struct {
+	pool *GmailServerPool
+
+	mu       sync.Mutex
+	sessions map[string]*httpSession
+	nextCall uint64
+}
+
+var _ server.SessionIdManager = (*SessionManager)(nil)
+
+// NewSessionManager creates the session manager for the pool's servers
+func NewSessionManager(pool *GmailServerPool) *SessionManager {
+	return &SessionManager{pool: pool, sessions: map[string]*httpSession{}}
+}
+
+// Generate creates a session for an initialize request. The ID is random, so
+// sessions can't be guessed.
+func (m *SessionManager) Generate() string {
+	id := make([]byte, 16)
+	rand.Read(id)
+	sessionID := "mcp-session-" + hex.EncodeToString(id)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sessions[sessionID] = &httpSession{lastSeen: time.Now(), inFlight: map[uint64]context.CancelFunc{}}
+	return sessionID
+}
+
+// Validate reports sessions that don't exist (anymore) as terminated
+func (m *SessionManager) Validate(sessionID string) (isTerminated bool, err error) {
+	if sessionID == "" {
+		return false, fmt.Errorf("missing %s header", sessionHeader)
+	}
+	m.expireIdle()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, ok := m.sessions[sessionID]
+	return !ok, nil
+}
+
+// Terminate ends a session at the client's request
+func (m *SessionManager) Terminate(sessionID string) (isNotAllowed bool, err error) {
+	m.end(sessionID)
+	return false, nil
+}
+
+// Count returns the number of open sessions
+func (m *SessionManager) Count() int {
+	m.expireIdle()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.sessions)
+}
+
+// end cancels a session's in-flight calls and forgets it
+func (m *SessionManager) end(sessionID string) {
+	m.mu.Lock()
+	session, ok := m.sessions[sessionID]
+	if ok {
+		delete(m.sessions, sessionID)
+		for _, cancel := range session.inFlight {
+			cancel()
+		}
+	}
+	m.mu.Unlock()
+
+	if ok {
+		m.pool.endSession(sessionID)
+		log.Printf("MCP session %s ended (%d in-flight calls cancelled)", sessionID, len(session.inFlight))
+	}
+}
+
+// expireIdle ends sessions that have been idle for sessionIdleTimeout
+func (m *SessionManager) expireIdle() {
+	m.mu.Lock()
+	var idle []string
+	for id, session := range m.sessions {
+		if len(session.inFlight) == 0 && time.Since(session.lastSeen) > sessionIdleTimeout {
+			idle = append(idle, id)
+		}
+	}
+	m.mu.Unlock()
+
+	for _, id := range idle {
+		m.end(id)
+	}
+}
+
+// Middleware ties each /mcp request to its session: it binds a new session to the
+// bearer token that created it, rejects requests presenting another user's session,
+// and registers the request so ending the session cancels it
+func (m *SessionManager) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal := m.pool.principalFromRequest(r)
+		sessionID := r.Header.Get(sessionHeader)
+		if sessionID == "" {
+			// An initialize request; bind the session it creates before the client sees its ID
+			next.ServeHTTP(&sessionBinder{ResponseWriter: w, manager: m, principal: principal}, r)
+			return
+		}
+
+		m.mu.Lock()
+		session, ok := m.sessions[sessionID]
+		if ok && session.principal != principal {
+			m.mu.Unlock()
+			// Don't reveal that the session exists
+			http.Error(w, "Session not found", http.StatusNotFound)
+			return
+		}
+		var callID uint64
+		ctx, cancel := context.WithCancel(r.Context())
+		defer cancel()
+		if ok {
+			session.lastSeen = time.Now()
+			m.nextCall++
+			callID = m.nextCall
+			session.inFlight[callID] = cancel
+		}
+		m.mu.Unlock()
+
+		if ok {
+			defer func() {
+				m.mu.Lock()
+				delete(session.inFlight, callID)
+				session.lastSeen = time.Now()
+				m.mu.Unlock()
+			}()
+		}
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// sessionBinder records which principal a new session belongs to when the response
+// carrying its ID is written
+type sessionBinder struct {
+	http.ResponseWriter
+	manager   *SessionManager
+	principal string
+	bound     bool
+}
+
+func (b *sessionBinder) WriteHeader(status int) {
+	b.bind()
+	b.ResponseWriter.WriteHeader(status)
+}
+
+func (b *sessionBinder) Write(p []byte) (int, error) {
+	b.bind()
+	return b.ResponseWriter.Write(p)
+}
+
+func (b *sessionBinder) Flush() {
+	b.bind()
+	if flusher, ok := b.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (b *sessionBinder) bind() {
+	if b.bound {
+		return
+	}
+	b.bound = true
+	sessionID := b.Header().Get(sessionHeader)
+	if sessionID == "" {
+		return
+	}
+	b.manager.mu.Lock()
+	defer b.manager.mu.Unlock()
+	if session, ok := b.manager.sessions[sessionID]; ok {
+		session.principal = b.principal
+	}
+}
@@ -0,0 +1,340 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/mail"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"auto-gmail/internal/llm"
+	"auto-gmail/internal/redact"
+	"auto-gmail/internal/toolerr"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/openai/openai-go"
+	"google.golang.org/api/gmail/v1"
+)
+
+// Similarity weights; subject and participants come from headers, content from embeddings
+const (
+	subjectWeight     = 0.5
+	participantWeight = 0.3
+	contentWeight     = 0.4
+	// maxSimilarPerQuery caps each candidate search (one per subject and participant)
+	maxSimilarPerQuery = 25
+	// maxSimilarParticipants is how many of the source's participants are searched for
+	maxSimilarParticipants = 3
+	// maxStemWords keeps subject searches short enough to still match variants
+	maxStemWords = 6
+)
+
+// subjectPrefix matches reply/forward markers and bracketed tags at the start of a subject
+var subjectPrefix = regexp.MustCompile(`(?i)^\s*((re|fw|fwd|aw|sv)(\[\d+\])?\s*:|\[[^\]]*\])\s*`)
+
+// embeddingsEnabled reports whether find_similar may send subjects and snippets to an embedding model
+func embeddingsEnabled() bool {
+	return os.Getenv("GMAIL_MCP_EMBEDDINGS") == "1" && llm.Check() == nil
+}
+
+// similarCandidate is a message found by one of the candidate searches
+type similarCandidate struct {
+	message *gmail.Message
+	score   float64
+	reasons []string
+}
+
+// FindSimilar finds threads related to a message: the same subject once Re:/Fwd:
+// prefixes are stripped, the same people, and (with GMAIL_MCP_EMBEDDINGS=1) similar content
+func (g *GmailServer) FindSimilar(ctx context.Context, messageID string, maxResults int) (*mcp.CallToolResult, error) {
+	if maxResults <= 0 {
+		maxResults = 10
+	}
+
+	source, err := g.getMessage(ctx, messageID)
+	if err != nil {
+		return toolerr.Result(err, "Failed to get message"), nil
+	}
+	stem := subjectStem(messageHeader(source, "Subject"))
+	participants := messageParticipants(source, g.userEmail(ctx))
+
+	var queries []string
+	if words := strings.Fields(stem); len(words) > 0 {
+		terms := make([]string, 0, maxStemWords)
+		for _, word := range words[:min(maxStemWords, len(words))] {
+			if word = strings.Trim(word, `.,:;!?"'()`); word != "" {
+				terms = append(terms, "subject:"+word)
+			}
+		}
+		if len(terms) > 0 {
+			queries = append(queries, strings.Join(terms, " "))
+		}
+	}
+	for _, participant := range participants[:min(maxSimilarParticipants, len(participants))] {
+		queries = append(queries, "from:"+participant, "to:"+participant)
+	}
+	if len(queries) == 0 {
+		return toolerr.Invalid("The message has no subject or other participants to search by"), nil
+	}
+
+	var candidateIDs []string
+	seen := map[string]bool{}
+	for _, query := range queries {
+		list, err := g.client.ListMessages(ctx, query, maxSimilarPerQuery)
+		if err != nil {
+			return toolerr.Result(err, "Failed to search messages"), nil
+		}
+		for _, msg := range list.Messages {
+			if msg.ThreadId == source.ThreadId || seen[msg.Id] {
+				continue
+			}
+			seen[msg.Id] = true
+			candidateIDs = append(candidateIDs, msg.Id)
+		}
+	}
+	hydrated := g.hydrateMessageHeaders(ctx, candidateIDs, []string{"From", "To", "Cc", "Subject"})
+
+	// Score each candidate and keep the best message per thread
+	byThread := map[string]*similarCandidate{}
+	var candidates []*similarCandidate
+	for _, id := range candidateIDs {
+		message, ok := hydrated[id]
+		if !ok {
+			continue
+		}
+		candidate := &similarCandidate{message: message}
+		candidate.scoreHeaders(stem, participants, g.userEmail(ctx))
+		candidates = append(candidates, candidate)
+	}
+
+	useEmbeddings := embeddingsEnabled() && len(candidates) > 0
+	var redactions redact.Report
+	if useEmbeddings {
+		if redactions, err = scoreContent(ctx, source, candidates); err != nil {
+			log.Printf("Warning: Could not compare content with embeddings: %v", err)
+			useEmbeddings = false
+		}
+	}
+
+	for _, candidate := range candidates {
+		if candidate.score <= 0 {
+			continue
+		}
+		best, ok := byThread[candidate.message.ThreadId]
+		if !ok || candidate.score > best.score {
+			byThread[candidate.message.ThreadId] = candidate
+		}
+	}
+	ranked := make([]*similarCandidate, 0, len(byThread))
+	for _, candidate := range byThread {
+		ranked = append(ranked, candidate)
+	}
+	sort.Slice(ranked, func(i, j int) bool {
+		if ranked[i].score != ranked[j].score {
+			return ranked[i].score > ranked[j].score
+		}
+		return ranked[i].message.InternalDate > ranked[j].message.InternalDate
+	})
+
+	var results []map[string]interface{}
+	for _, candidate := range ranked[:min(maxResults, len(ranked))] {
+		results = append(results, map[string]interface{}{
+			"threadId":  candidate.message.ThreadId,
+			"messageId": candidate.message.Id,
+			"subject":   messageHeader(candidate.message, "Subject"),
+			"from":      messageHeader(candidate.message, "From"),
+			"date":      formatInternalDate(candidate.message.InternalDate),
+			"snippet":   candidate.message.Snippet,
+			"score":     math.Round(candidate.score*100) / 100,
+			"reasons":   candidate.reasons,
+		})
+	}
+
+	result := map[string]interface{}{
+		"messageId":         messageID,
+		"threadId":          source.ThreadId,
+		"subjectStem":       stem,
+		"participants":      participants,
+		"candidatesScanned": len(candidateIDs),
+		"embeddings":        useEmbeddings,
+		"similar":           results,
+	}
+	if len(redactions) > 0 {
+		result["redactions"] = redactions
+	}
+
+	resultJSON, _ := json.MarshalIndent(result, "", "  ")
+	return mcp.NewToolResultText(string(resultJSON)), nil
+}
+
+// scoreHeaders scores subject and participant overlap with the source message
+func (c *similarCandidate) scoreHeaders(stem string, participants []string, me string) {
+	candidateStem := subjectStem(messageHeader(c.message, "Subject"))
+	if stem != "" && candidateStem == stem {
+		c.score += subjectWeight
+		c.reasons = append(c.reasons, "same subject")
+	} else if overlap := wordOverlap(stem, candidateStem); overlap > 0 {
+		c.score += subjectWeight * 0.7 * overlap
+		c.reasons = append(c.reasons, "similar subject")
+	}
+
+	if shared := jaccard(participants, messageParticipants(c.message, me)); shared > 0 {
+		c.score += participantWeight * shared
+		c.reasons = append(c.reasons, "same participants")
+	}
+}
+
+// scoreContent adds embedding similarity between the source and each candidate's subject
+// and snippet. Personal data is redacted first when GMAIL_MCP_REDACT=1.
+func scoreContent(ctx context.Context, source *gmail.Message, candidates []*similarCandidate) (redact.Report, error) {
+	redactor := redact.FromEnv()
+	report := redact.Report{}
+	texts := []string{embeddingText(source)}
+	for _, candidate := range candidates {
+		texts = append(texts, embeddingText(candidate.message))
+	}
+	for i, text := range texts {
+		var textReport redact.Report
+		texts[i], textReport = redactor.Redact(text)
+		report.Add(textReport)
+	}
+
+	client, err := llm.NewClient()
+	if err != nil {
+		return report, err
+	}
+	response, err := client.Embeddings.New(ctx, openai.EmbeddingNewParams{
+		Input: openai.EmbeddingNewParamsInputUnion{OfArrayOfStrings: texts},
+		Model: llm.EmbeddingModel(),
+	})
+	if err != nil {
+		return report, err
+	}
+	if len(response.Data) != len(texts) {
+		return report, fmt.Errorf("expected %d embeddings, got %d", len(texts), len(response.Data))
+	}
+
+	vectors := make([][]float64, len(texts))
+	for _, embedding := range response.Data {
+		vectors[embedding.Index] = embedding.Embedding
+	}
+	for i, candidate := range candidates {
+		// Unrelated text still scores around 0.1-0.2 with these models, so only count the excess
+		similarity := (cosine(vectors[0], vectors[i+1]) - 0.2) / 0.8
+		if similarity <= 0 {
+			continue
+		}
+		candidate.score += contentWeight * similarity
+		if similarity >= 0.5 {
+			candidate.reasons = append(candidate.reasons, "similar content")
+		}
+	}
+	return report, nil
+}
+
+// embeddingText is the text embedded for a message; metadata responses carry no body, so the snippet stands in
+func embeddingText(message *gmail.Message) string {
+	text := strings.TrimSpace(messageHeader(message, "Subject") + "\n" + message.Snippet)
+	if text == "" {
+		return "(empty)"
+	}
+	return text
+}
+
+// subjectStem lowercases a subject and strips Re:/Fwd: prefixes and [tags]
+func subjectStem(subject string) string {
+	return strings.Join(strings.Fields(strings.ToLower(stripSubjectPrefixes(subject))), " ")
+}
+
+// stripSubjectPrefixes removes any number of leading Re:/Fwd: markers and [tags]
+func stripSubjectPrefixes(subject string) string {
+	for {
+		trimmed := subjectPrefix.ReplaceAllString(subject, "")
+		if trimmed == subject {
+			return subject
+		}
+		subject = trimmed
+	}
+}
+
+// messageParticipants returns the lowercased From/To/Cc addresses of a message other than me
+func messageParticipants(message *gmail.Message, me string) []string {
+	var participants []string
+	seen := map[string]bool{me: true}
+	for _, name := range []string{"From", "To", "Cc"} {
+		header := messageHeader(message, name)
+		if header == "" {
+			continue
+		}
+		addresses, err := mail.ParseAddressList(header)
+		if err != nil {
+			continue
+		}
+		for _, addr := range addresses {
+			address := strings.ToLower(addr.Address)
+			if !seen[address] {
+				seen[address] = true
+				participants = append(participants, address)
+			}
+		}
+	}
+	return participants
+}
+
+// wordOverlap is the share of a's words that also appear in b
+func wordOverlap(a, b string) float64 {
+	words := strings.Fields(a)
+	if len(words) == 0 {
+		return 0
+	}
+	other := map[string]bool{}
+	for _, word := range strings.Fields(b) {
+		other[word] = true
+	}
+	shared := 0
+	for _, word := range words {
+		if other[word] {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(words))
+}
+
+// jaccard is the size of the intersection of a and b over the size of their union
+func jaccard(a, b []string) float64 {
+	set := map[string]bool{}
+	for _, item := range a {
+		set[item] = true
+	}
+	shared, union := 0, len(set)
+	for _, item := range b {
+		if set[item] {
+			shared++
+		} else {
+			union++
+		}
+	}
+	if union == 0 {
+		return 0
+	}
+	return float64(shared) / float64(union)
+}
+
+// cosine is the cosine similarity of two vectors
+func cosine(a, b []float64) float64 {
+	var dot, normA, normB float64
+	for i := range a[:min(len(a), len(b))] {
+		dot += a[i] * b[i]
+		normA += a[i] * a[i]
+		normB += b[i] * b[i]
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / math.Sqrt(normA*normB)
+}
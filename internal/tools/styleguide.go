@@ -0,0 +1,44 @@
+package tools
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"auto-gmail/internal/style"
+	"auto-gmail/internal/toolerr"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// UpdateStyleGuide merges the user's additions or corrections into the user-edited
+// section of the style guide; mode "replace" swaps out that section instead of appending
+func (g *GmailServer) UpdateStyleGuide(text, mode string) (*mcp.CallToolResult, error) {
+	if mode != "append" && mode != "replace" {
+		return toolerr.Invalid(fmt.Sprintf("Invalid mode %q: use append or replace", mode)), nil
+	}
+	if strings.TrimSpace(text) == "" && mode == "append" {
+		return toolerr.Invalid("text must not be empty"), nil
+	}
+
+	g.styleGuideMu.Lock()
+	defer g.styleGuideMu.Unlock()
+
+	edits, err := style.UpdateUserEdits(g.styleGuideFile, text, mode == "replace")
+	if err != nil {
+		return toolerr.Result(err, ""), nil
+	}
+
+	result := map[string]interface{}{
+		"action":    mode,
+		"path":      g.styleGuideFile,
+		"userEdits": edits,
+	}
+	if guide, err := os.ReadFile(g.styleGuideFile); err == nil && strings.TrimSpace(style.Generated(string(guide))) == "" {
+		result["note"] = "The guide only has your edits so far; run /generate-email-tone to add the generated part (your edits are kept)"
+	}
+
+	resultJSON, _ := json.MarshalIndent(result, "", "  ")
+	return mcp.NewToolResultText(string(resultJSON)), nil
+}
@@ -0,0 +1,198 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/mail"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"google.golang.org/api/gmail/v1"
+
+	"auto-gmail/internal/config"
+	"auto-gmail/internal/toolerr"
+)
+
+// maxSubscriptionScan is how many recent messages list_subscriptions inspects
+// (one page of messages.list)
+const maxSubscriptionScan = 500
+
+// subscription aggregates the mail received from one newsletter or mailing list
+type subscription struct {
+	sender       string
+	listID       string
+	unsubscribe  string
+	messages     int
+	unread       int
+	lastReceived int64
+	lastRead     int64
+}
+
+// ListSubscriptions finds newsletters and mailing lists (messages with List-Id or
+// List-Unsubscribe headers) received in the past months and ranks them by how much
+// unread mail they produce, then by volume
+func (g *GmailServer) ListSubscriptions(ctx context.Context, months int, limit int) (*mcp.CallToolResult, error) {
+	if months <= 0 {
+		months = 3
+	}
+	if limit <= 0 {
+		limit = 20
+	}
+
+	messages, err := g.client.ListMessages(ctx, fmt.Sprintf("newer_than:%dm", months), maxSubscriptionScan)
+	if err != nil {
+		return toolerr.Result(err, "Failed to list messages"), nil
+	}
+
+	messageIDs := make([]string, len(messages.Messages))
+	for i, msg := range messages.Messages {
+		messageIDs[i] = msg.Id
+	}
+	headers := g.hydrateMessageHeaders(ctx, messageIDs, []string{"From", "List-Id", "List-Unsubscribe"})
+
+	bySender := map[string]*subscription{}
+	for _, id := range messageIDs {
+		message, ok := headers[id]
+		if !ok || message.Payload == nil || hasLabelID(message, "SENT") {
+			continue
+		}
+		from, listID, unsubscribe := subscriptionHeaders(message)
+		if listID == "" && unsubscribe == "" {
+			continue
+		}
+
+		// Group by list when there is one, since lists often rotate their From address
+		key := listID
+		if key == "" {
+			key = strings.ToLower(senderAddress(from))
+		}
+		sub, ok := bySender[key]
+		if !ok {
+			sub = &subscription{sender: from, listID: listID}
+			bySender[key] = sub
+		}
+		sub.messages++
+		if message.InternalDate > sub.lastReceived {
+			sub.lastReceived = message.InternalDate
+			sub.sender = from
+			if unsubscribe != "" {
+				sub.unsubscribe = unsubscribe
+			}
+		}
+		if sub.unsubscribe == "" {
+			sub.unsubscribe = unsubscribe
+		}
+		if hasLabelID(message, "UNREAD") {
+			sub.unread++
+		} else if message.InternalDate > sub.lastRead {
+			sub.lastRead = message.InternalDate
+		}
+	}
+
+	ranked := make([]*subscription, 0, len(bySender))
+	for _, sub := range bySender {
+		ranked = append(ranked, sub)
+	}
+	sort.Slice(ranked, func(i, j int) bool {
+		if ranked[i].unread != ranked[j].unread {
+			return ranked[i].unread > ranked[j].unread
+		}
+		if ranked[i].messages != ranked[j].messages {
+			return ranked[i].messages > ranked[j].messages
+		}
+		return ranked[i].sender < ranked[j].sender
+	})
+
+	var results []map[string]interface{}
+	for _, sub := range ranked[:min(limit, len(ranked))] {
+		entry := map[string]interface{}{
+			"sender":       sub.sender,
+			"messages":     sub.messages,
+			"unread":       sub.unread,
+			"readRate":     float64(sub.messages-sub.unread) / float64(sub.messages),
+			"lastReceived": formatInternalDate(sub.lastReceived),
+			"lastRead":     "never",
+		}
+		if sub.lastRead != 0 {
+			entry["lastRead"] = formatInternalDate(sub.lastRead)
+		}
+		if sub.listID != "" {
+			entry["listId"] = sub.listID
+		}
+		if sub.unsubscribe != "" {
+			entry["unsubscribe"] = sub.unsubscribe
+		}
+		results = append(results, entry)
+	}
+
+	result := map[string]interface{}{
+		"months":            months,
+		"messagesScanned":   len(messageIDs),
+		"subscriptionCount": len(ranked),
+		"summary":           fmt.Sprintf("You receive %d newsletters and mailing lists (past %d months); the noisiest, with the most unread mail, are listed first.", len(ranked), months),
+		"subscriptions":     results,
+	}
+	if len(messageIDs) >= maxSubscriptionScan {
+		result["note"] = fmt.Sprintf("Only the %d most recent messages were scanned; counts for older mail are incomplete.", maxSubscriptionScan)
+	}
+
+	resultJSON, _ := json.MarshalIndent(result, "", "  ")
+	return mcp.NewToolResultText(string(resultJSON)), nil
+}
+
+// subscriptionHeaders returns the From, List-Id and List-Unsubscribe headers of a message
+func subscriptionHeaders(message *gmail.Message) (from, listID, unsubscribe string) {
+	for _, header := range message.Payload.Headers {
+		switch strings.ToLower(header.Name) {
+		case "from":
+			from = header.Value
+		case "list-id":
+			listID = strings.Trim(strings.TrimSpace(header.Value[strings.LastIndex(header.Value, "<")+1:]), "<>")
+		case "list-unsubscribe":
+			unsubscribe = preferredUnsubscribe(header.Value)
+		}
+	}
+	return from, listID, unsubscribe
+}
+
+// preferredUnsubscribe picks the https link from a List-Unsubscribe header, falling back to mailto
+func preferredUnsubscribe(value string) string {
+	var fallback string
+	for _, part := range strings.Split(value, ",") {
+		link := strings.Trim(strings.TrimSpace(part), "<>")
+		if strings.HasPrefix(link, "https://") || strings.HasPrefix(link, "http://") {
+			return link
+		}
+		if fallback == "" {
+			fallback = link
+		}
+	}
+	return fallback
+}
+
+// senderAddress extracts the bare address from a From header
+func senderAddress(from string) string {
+	if addr, err := mail.ParseAddress(from); err == nil {
+		return addr.Address
+	}
+	return from
+}
+
+// hasLabelID reports whether a message carries the given label
+func hasLabelID(message *gmail.Message, labelID string) bool {
+	for _, id := range message.LabelIds {
+		if id == labelID {
+			return true
+		}
+	}
+	return false
+}
+
+// formatInternalDate formats Gmail's millisecond timestamps as RFC 3339 in the
+// user's time zone
+func formatInternalDate(ms int64) string {
+	return time.UnixMilli(ms).In(config.TimeZone()).Format(time.RFC3339)
+}
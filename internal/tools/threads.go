@@ -0,0 +1,523 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/mail"
+	"strings"
+	"time"
+
+	"auto-gmail/internal/config"
+	"auto-gmail/internal/extract"
+	"auto-gmail/internal/gmailclient"
+	"auto-gmail/internal/pgp"
+	"auto-gmail/internal/toolerr"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"google.golang.org/api/gmail/v1"
+)
+
+// SearchThreads searches Gmail threads based on a query. Every result has a priority
+// score and the inbox tab it's in. Results are sorted by sortOrder (see searchSort)
+// once they're hydrated, since Gmail only lists newest first. Threads with replies also
+// describe their latest message; snippets picks which previews are included (see
+// snippetModes). Signature images and other noise attachments are hidden unless
+// includeInline is set. Results come in an envelope with the query and resultCount, so
+// no matches is an empty list; a query Gmail would misread or rejects is an
+// invalid_query error instead.
+func (g *GmailServer) SearchThreads(ctx context.Context, query string, maxResults int64, sortOrder, snippets string, includeInline bool) (*mcp.CallToolResult, error) {
+	if maxResults <= 0 {
+		maxResults = 10
+	}
+	order, ok := searchSort(sortOrder)
+	if !ok {
+		return toolerr.Invalid(fmt.Sprintf("Invalid sort '%s': use %s", sortOrder, strings.Join(searchSorts, ", "))), nil
+	}
+	if snippets == "" {
+		snippets = SnippetsBoth
+	}
+	if !containsString(snippetModes, snippets) {
+		return toolerr.Invalid(fmt.Sprintf("Invalid snippets '%s': use %s", snippets, strings.Join(snippetModes, ", "))), nil
+	}
+
+	if problems := lintQuery(query); len(problems) > 0 {
+		return invalidQueryError(query, problems), nil
+	}
+
+	listSize := maxResults
+	if order == SortOldest {
+		listSize = maxOldestScan
+	}
+	threads, err := g.client.ListThreads(ctx, query, listSize)
+	if err != nil {
+		// Gmail answers a query it can't parse with a 400
+		if classified := toolerr.Classify(err); classified.Category == toolerr.InvalidInput {
+			return invalidQueryError(query, []string{"Gmail rejected it: " + classified.Message}), nil
+		}
+		return toolerr.Result(err, "Failed to search threads"), nil
+	}
+	candidates := threads.Threads
+	if len(candidates) > int(maxResults) {
+		// Gmail lists newest first, so the oldest matches are at the end
+		candidates = candidates[len(candidates)-int(maxResults):]
+	}
+
+	// Hydrate all threads in as few round trips as possible
+	threadDetails := g.hydrateThreads(ctx, candidates)
+
+	// Results found in the offline snapshot are marked with when they were last synced
+	listStaleAsOf := staleAsOf(threads.ServerResponse)
+
+	pc := g.priorityContext(ctx)
+
+	results := []map[string]interface{}{}
+	latest := map[string]int64{}
+	for _, thread := range candidates {
+		threadDetail, ok := threadDetails[thread.Id]
+		if !ok {
+			continue
+		}
+
+		if len(threadDetail.Messages) == 0 {
+			continue
+		}
+		for _, message := range threadDetail.Messages {
+			latest[thread.Id] = max(latest[thread.Id], message.InternalDate)
+		}
+
+		firstMessage := threadDetail.Messages[0]
+		var subject, from, snippet string
+
+		// Extract headers
+		for _, header := range firstMessage.Payload.Headers {
+			switch header.Name {
+			case "Subject":
+				subject = header.Value
+			case "From":
+				from = header.Value
+			}
+		}
+
+		// Use Gmail's built-in snippet for fast browsing (typically ~150 characters)
+		snippet = firstMessage.Snippet
+
+		allAttachments, hiddenAttachments := threadAttachments(threadDetail, includeInline)
+
+		stale := staleAsOf(threadDetail.ServerResponse)
+		if stale == "" {
+			stale = listStaleAsOf
+		}
+
+		// Get existing drafts for this thread; drafts aren't available offline
+		existingDrafts := []map[string]interface{}{}
+		if stale == "" {
+			existingDrafts, err = g.getThreadDrafts(ctx, thread.Id)
+			if err != nil {
+				log.Printf("Warning: Failed to get drafts for thread %s: %v", thread.Id, err)
+				existingDrafts = []map[string]interface{}{}
+			}
+		}
+
+		threadResult := map[string]interface{}{
+			"threadId":     thread.Id,
+			"subject":      subject,
+			"from":         from,
+			"date":         messageDate(firstMessage),
+			"messageCount": len(threadDetail.Messages),
+		}
+
+		// The latest message shows where the conversation stands now: who wrote last,
+		// when, and whether the subject changed along the way
+		latestMessage := latestThreadMessage(threadDetail)
+		if latestMessage != nil && latestMessage != firstMessage {
+			threadResult["lastFrom"] = messageHeader(latestMessage, "From")
+			threadResult["lastDate"] = messageDate(latestMessage)
+			if lastSubject := messageHeader(latestMessage, "Subject"); lastSubject != "" && lastSubject != subject {
+				threadResult["lastSubject"] = lastSubject
+			}
+			if snippets == SnippetsBoth || snippets == SnippetsLatest {
+				threadResult["latestSnippet"] = latestMessage.Snippet
+			}
+		}
+		if snippets == SnippetsBoth || snippets == SnippetsFirst || (snippets == SnippetsLatest && threadResult["latestSnippet"] == nil) {
+			threadResult["snippet"] = snippet
+		}
+		threadResult["messageIds"] = threadMessageIDs(threadDetail)
+		threadResult["priority"], threadResult["priorityReasons"] = threadPriority(threadDetail, pc)
+		threadResult["reason"] = priorityReason(threadDetail, pc)
+		threadResult["gmailImportant"] = gmailImportant(threadDetail)
+		if category := threadCategory(threadDetail); category != "" {
+			threadResult["category"] = category
+		}
+		if stale != "" {
+			threadResult["staleAsOf"] = stale
+		}
+
+		// Only include attachments if there are any
+		if len(allAttachments) > 0 {
+			threadResult["attachments"] = allAttachments
+		}
+		if hiddenAttachments > 0 {
+			threadResult["hiddenAttachments"] = hiddenAttachments
+		}
+
+		// Only include drafts if there are any
+		if len(existingDrafts) > 0 {
+			threadResult["drafts"] = existingDrafts
+		}
+
+		results = append(results, threadResult)
+	}
+
+	sortThreadResults(results, order, latest, queryTerms(query))
+
+	envelope := map[string]interface{}{
+		"query":       query,
+		"sort":        order,
+		"resultCount": len(results),
+		"results":     results,
+	}
+	if skipped := len(candidates) - len(results); skipped > 0 {
+		envelope["skipped"] = skipped
+		envelope["note"] = fmt.Sprintf("%d matching thread(s) couldn't be loaded; retry shortly", skipped)
+	} else if len(results) == 0 {
+		envelope["note"] = "No threads match this query. It is valid, so try a broader one: fewer words, a longer date range or in:anywhere to include spam and trash."
+	}
+	// Only the most recent matches were listed, so older threads may exist beyond them
+	if order == SortOldest && len(threads.Threads) >= maxOldestScan {
+		envelope["truncated"] = true
+		if envelope["note"] == nil {
+			envelope["note"] = fmt.Sprintf("Only the %d most recent matching threads were scanned, so older ones may exist; narrow the query (e.g. before:YYYY/MM/DD) to reach them", maxOldestScan)
+		}
+	}
+	resultJSON, _ := json.MarshalIndent(envelope, "", "  ")
+	return mcp.NewToolResultText(string(resultJSON)), nil
+}
+
+// threadMessageIDs lists a thread's messages oldest first with their sender and dates,
+// so a single message can be passed to the tools that take a message_id. Unsent
+// drafts are marked.
+func threadMessageIDs(thread *gmail.Thread) []map[string]interface{} {
+	messages := make([]map[string]interface{}, len(thread.Messages))
+	for i, message := range thread.Messages {
+		entry := map[string]interface{}{
+			"id":           message.Id,
+			"from":         messageHeader(message, "From"),
+			"date":         messageDate(message),
+			"internalDate": formatInternalDate(message.InternalDate),
+		}
+		if hasLabelID(message, "DRAFT") {
+			entry["draft"] = true
+		}
+		messages[i] = entry
+	}
+	return messages
+}
+
+// messageDate is when a message says it was sent, from its Date header, as RFC 3339
+// in the user's time zone. Messages without a readable Date header fall back to when
+// Gmail received them.
+func messageDate(message *gmail.Message) string {
+	if sent, err := mail.ParseDate(messageHeader(message, "Date")); err == nil {
+		return sent.In(config.TimeZone()).Format(time.RFC3339)
+	}
+	return formatInternalDate(message.InternalDate)
+}
+
+// latestThreadMessage returns a thread's most recent sent or received message,
+// leaving out drafts, or nil when the thread only holds drafts
+func latestThreadMessage(thread *gmail.Thread) *gmail.Message {
+	for i := len(thread.Messages) - 1; i >= 0; i-- {
+		if !hasLabelID(thread.Messages[i], "DRAFT") {
+			return thread.Messages[i]
+		}
+	}
+	return nil
+}
+
+// getThreadDrafts retrieves existing drafts for a specific thread
+func (g *GmailServer) getThreadDrafts(ctx context.Context, threadID string) ([]map[string]interface{}, error) {
+	var drafts []map[string]interface{}
+
+	// List all drafts for the user; the listing already carries each draft's thread ID
+	draftsList, err := g.client.ListDrafts(ctx)
+	if err != nil {
+		return drafts, fmt.Errorf("failed to list drafts: %w", err)
+	}
+
+	// Only fetch details for drafts that belong to this thread
+	for _, draft := range draftsList.Drafts {
+		if draft.Message == nil || draft.Message.ThreadId != threadID {
+			continue
+		}
+
+		// Headers, snippet and the attachment parts are enough here, skip the body data
+		fullDraft, err := g.client.GetDraft(ctx, draft.Id, gmailclient.GetOptions{
+			Format: "full",
+			Fields: "id,message(id,threadId,snippet,internalDate,payload(headers,parts(filename,mimeType,headers,body(attachmentId,size),parts)))",
+		})
+		if err != nil {
+			continue // Skip drafts we can't access
+		}
+
+		if fullDraft.Message != nil {
+			draftInfo := map[string]interface{}{
+				"draftId":  fullDraft.Id,
+				"threadId": fullDraft.Message.ThreadId,
+			}
+
+			// Extract subject and recipients if available, so an agent knows what it's replacing
+			if fullDraft.Message.Payload != nil {
+				for _, header := range fullDraft.Message.Payload.Headers {
+					switch header.Name {
+					case "Subject":
+						draftInfo["subject"] = header.Value
+					case "To":
+						draftInfo["to"] = header.Value
+					case "Cc":
+						draftInfo["cc"] = header.Value
+					case "Bcc":
+						draftInfo["bcc"] = header.Value
+					}
+				}
+			}
+
+			// A draft's internal date is when it was last saved
+			if fullDraft.Message.InternalDate > 0 {
+				draftInfo["lastEdited"] = formatInternalDate(fullDraft.Message.InternalDate)
+			}
+
+			var attachmentNames []string
+			for _, attachment := range extract.AttachmentInfo(fullDraft.Message) {
+				attachmentNames = append(attachmentNames, attachment["filename"].(string))
+			}
+			draftInfo["hasAttachments"] = len(attachmentNames) > 0
+			if len(attachmentNames) > 0 {
+				draftInfo["attachments"] = attachmentNames
+			}
+
+			// Gmail's snippet is already a short plain-text preview of the draft body
+			if fullDraft.Message.Snippet != "" {
+				draftInfo["snippet"] = fullDraft.Message.Snippet
+			}
+
+			drafts = append(drafts, draftInfo)
+		}
+	}
+
+	return drafts, nil
+}
+
+// fetchChunkSize is how many threads fetch_email_bodies hydrates per round trip before streaming them
+const fetchChunkSize = 5
+
+// FetchEmailBodies fetches full email content for multiple threads.
+// Threads are hydrated in small chunks and each finished thread is streamed to the
+// client as a progress notification, so agents can start reading before all are loaded.
+func (g *GmailServer) FetchEmailBodies(ctx context.Context, threadIDs []string, includeInline bool, contextMode string, progress *progressReporter) (*mcp.CallToolResult, error) {
+	budget := newResponseBudget()
+	var fetched []fetchedThread
+
+	for start := 0; start < len(threadIDs); start += fetchChunkSize {
+		chunk := threadIDs[start:min(start+fetchChunkSize, len(threadIDs))]
+		fetched = append(fetched, g.fetchThreadBodies(ctx, chunk, includeInline, contextMode, budget, progress)...)
+	}
+
+	// Keep the combined bodies within the response budget, reporting what was trimmed
+	items := make([]*budgetItem, len(fetched))
+	for i, thread := range fetched {
+		items[i] = thread.budget
+	}
+	budget.fit(items)
+
+	var results []map[string]interface{}
+	for _, thread := range fetched {
+		thread.result["fullBody"] = thread.budget.body
+		if len(thread.budget.notes) > 0 {
+			thread.result["trimmed"] = thread.budget.notes
+		}
+		results = append(results, thread.result)
+	}
+
+	resultJSON, err := json.MarshalIndent(results, "", "  ")
+	if err != nil {
+		return toolerr.Result(err, "Failed to marshal results"), nil
+	}
+
+	return mcp.NewToolResultText(string(resultJSON)), nil
+}
+
+// deltaBody joins the bodies of messages a session hasn't seen yet, each under its
+// sender and date, and adds the OpenPGP status of any encrypted or signed ones to statuses
+func (g *GmailServer) deltaBody(ctx context.Context, messages []*gmail.Message, statuses map[string]*pgp.Status) string {
+	sections := make([]string, 0, len(messages))
+	for _, message := range messages {
+		body, status := g.messageBody(ctx, message)
+		if status != nil {
+			statuses[message.Id] = status
+		}
+		sections = append(sections, fmt.Sprintf("**From:** %s\n**Date:** %s\n\n%s",
+			messageHeader(message, "From"), messageHeader(message, "Date"), body))
+	}
+	return strings.Join(sections, "\n\n---\n\n")
+}
+
+// fetchedThread is one fetch_email_bodies result with its body's share of the response budget
+type fetchedThread struct {
+	result map[string]interface{}
+	budget *budgetItem
+}
+
+// fetchThreadBodies hydrates one chunk of threads and builds their full-body results
+func (g *GmailServer) fetchThreadBodies(ctx context.Context, threadIDs []string, includeInline bool, contextMode string, budget *responseBudget, progress *progressReporter) []fetchedThread {
+	var results []fetchedThread
+
+	// Hydrate the chunk in as few round trips as possible
+	threads := make([]*gmail.Thread, len(threadIDs))
+	for i, threadID := range threadIDs {
+		threads[i] = &gmail.Thread{Id: threadID}
+	}
+	threadDetails := g.hydrateThreads(ctx, threads)
+	pc := g.priorityContext(ctx)
+
+	for _, threadID := range threadIDs {
+		threadDetail, ok := threadDetails[threadID]
+		if !ok || len(threadDetail.Messages) == 0 {
+			progress.report(fmt.Sprintf("Skipped thread %s (not found or empty)", threadID), nil)
+			continue
+		}
+
+		// Extract details from the first message
+		firstMessage := threadDetail.Messages[0]
+		var subject, from string
+
+		// Extract headers
+		for _, header := range firstMessage.Payload.Headers {
+			switch header.Name {
+			case "Subject":
+				subject = header.Value
+			case "From":
+				from = header.Value
+			}
+		}
+
+		// Every fetch moves the session's cursor; delta mode only returns what's new since
+		newMessages, known := g.delta.newMessages(ctx, threadDetail)
+		delta := contextMode == "delta" && known
+
+		// Extract full email body content with markdown formatting. Encrypted and signed
+		// mail is decrypted and verified locally, when configured.
+		pgpStatuses := map[string]*pgp.Status{}
+		var fullBody string
+		age := firstMessage.InternalDate
+		if delta {
+			fullBody = g.deltaBody(ctx, newMessages, pgpStatuses)
+			age = threadDetail.Messages[len(threadDetail.Messages)-1].InternalDate
+		} else {
+			var status *pgp.Status
+			if fullBody, status = g.messageBody(ctx, firstMessage); status != nil {
+				pgpStatuses[firstMessage.Id] = status
+			}
+		}
+		language := extract.DetectLanguage(fullBody)
+
+		// A single body may never exceed the whole response budget
+		bodyBudget := &budgetItem{age: age}
+		if truncated, cut := budget.truncate(fullBody); cut {
+			bodyBudget.notes = append(bodyBudget.notes, fmt.Sprintf("body truncated from %d to %d chars to fit the response budget", len(fullBody), len(truncated)))
+			fullBody = truncated
+		}
+		bodyBudget.body = fullBody
+
+		attachmentSource := threadDetail
+		if delta {
+			attachmentSource = &gmail.Thread{Id: threadID, Messages: newMessages}
+		}
+		allAttachments, hiddenAttachments := threadAttachments(attachmentSource, includeInline)
+
+		// Get existing drafts for this thread; drafts aren't available offline
+		stale := staleAsOf(threadDetail.ServerResponse)
+		existingDrafts := []map[string]interface{}{}
+		if stale == "" {
+			var err error
+			existingDrafts, err = g.getThreadDrafts(ctx, threadID)
+			if err != nil {
+				log.Printf("Warning: Failed to get drafts for thread %s: %v", threadID, err)
+				existingDrafts = []map[string]interface{}{}
+			}
+		}
+
+		threadResult := map[string]interface{}{
+			"threadId":     threadID,
+			"subject":      subject,
+			"from":         from,
+			"date":         messageDate(firstMessage),
+			"fullBody":     fullBody,
+			"messageCount": len(threadDetail.Messages),
+			"messageIds":   threadMessageIDs(threadDetail),
+		}
+		threadResult["priority"], threadResult["priorityReasons"] = threadPriority(threadDetail, pc)
+		threadResult["reason"] = priorityReason(threadDetail, pc)
+		threadResult["gmailImportant"] = gmailImportant(threadDetail)
+		if language != "" {
+			threadResult["language"] = language
+		}
+		if stale != "" {
+			threadResult["staleAsOf"] = stale
+		}
+		if len(pgpStatuses) > 0 {
+			threadResult["pgp"] = pgpStatuses
+		}
+		if delta {
+			newMessageIDs := make([]string, len(newMessages))
+			for i, message := range newMessages {
+				newMessageIDs[i] = message.Id
+			}
+			threadResult["contextMode"] = "delta"
+			threadResult["newMessageIds"] = newMessageIDs
+			if len(newMessages) == 0 {
+				threadResult["unchanged"] = true
+			}
+		}
+
+		// Only include attachments if there are any
+		if len(allAttachments) > 0 {
+			threadResult["attachments"] = allAttachments
+		}
+		if hiddenAttachments > 0 {
+			threadResult["hiddenAttachments"] = hiddenAttachments
+		}
+
+		// Only include drafts if there are any
+		if len(existingDrafts) > 0 {
+			threadResult["drafts"] = existingDrafts
+		}
+
+		results = append(results, fetchedThread{result: threadResult, budget: bodyBudget})
+		progress.report(fmt.Sprintf("Fetched thread %s: %s", threadID, subject), threadResult)
+	}
+
+	return results
+}
+
+// threadAttachments collects the attachments of every message in a thread, each tagged
+// with its message ID, listing files repeated down a reply chain once. Noise attachments
+// are dropped unless includeInline is set; the second result is how many were hidden.
+func threadAttachments(thread *gmail.Thread, includeInline bool) ([]map[string]interface{}, int) {
+	var allAttachments []map[string]interface{}
+	for _, message := range thread.Messages {
+		for _, attachment := range extract.AttachmentInfo(message) {
+			// Add message ID to each attachment for reference
+			attachment["messageId"] = message.Id
+			allAttachments = append(allAttachments, attachment)
+		}
+	}
+
+	hidden := 0
+	if !includeInline {
+		allAttachments, hidden = extract.FilterNoiseAttachments(allAttachments)
+	}
+	return extract.DedupeAttachments(allAttachments), hidden
+}
@@ -0,0 +1,228 @@
+package tools
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"net/mail"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Default send limits. Gmail lets consumer accounts send to about 500 recipients a
+// day and flags accounts that send in bursts, so the defaults stay well below that.
+const (
+	defaultSendPerHour         = 60
+	defaultSendPerDay          = 400
+	defaultSendPerRecipientDay = 3
+	defaultBulkWarnRecipients  = 50
+)
+
+// sendLimits protect the account's sending reputation. They apply to everything the
+// outbox sends and are counted from its history, so mail sent outside this server
+// isn't included. Like Gmail's own quota, the hourly and daily limits count
+// recipients (To, Cc and Bcc), so a message to 50 people uses 50.
+type sendLimits struct {
+	PerHour         int // recipients per rolling hour
+	PerDay          int // recipients per rolling 24 hours
+	PerRecipientDay int // messages to one address per rolling 24 hours
+	WarnRecipients  int // bulk sends to more recipients than this get a warning
+}
+
+// loadSendLimits reads the limits from GMAIL_MCP_SEND_PER_HOUR, GMAIL_MCP_SEND_PER_DAY,
+// GMAIL_MCP_SEND_PER_RECIPIENT_DAY and GMAIL_MCP_BULK_WARN_RECIPIENTS
+func loadSendLimits() sendLimits {
+	return sendLimits{
+		PerHour:         envLimit("GMAIL_MCP_SEND_PER_HOUR", defaultSendPerHour),
+		PerDay:          envLimit("GMAIL_MCP_SEND_PER_DAY", defaultSendPerDay),
+		PerRecipientDay: envLimit("GMAIL_MCP_SEND_PER_RECIPIENT_DAY", defaultSendPerRecipientDay),
+		WarnRecipients:  envLimit("GMAIL_MCP_BULK_WARN_RECIPIENTS", defaultBulkWarnRecipients),
+	}
+}
+
+// envLimit reads a positive integer setting, falling back to def
+func envLimit(name string, def int) int {
+	value := os.Getenv(name)
+	if value == "" {
+		return def
+	}
+	if n, err := strconv.Atoi(value); err == nil && n > 0 {
+		return n
+	}
+	log.Printf("Warning: Invalid %s %q, using %d", name, value, def)
+	return def
+}
+
+// recipientAddresses returns the lowercase addresses in a To header
+func recipientAddresses(to string) []string {
+	addresses, err := mail.ParseAddressList(to)
+	if err != nil {
+		return []string{strings.ToLower(strings.TrimSpace(to))}
+	}
+	result := make([]string, len(addresses))
+	for i, address := range addresses {
+		result[i] = strings.ToLower(address.Address)
+	}
+	return result
+}
+
+// recipients returns the lowercase addresses the entry's message goes to, from its
+// To, Cc and Bcc headers, or from To alone when the message can't be read
+func (e outboxEntry) recipients() []string {
+	raw, err := base64.URLEncoding.DecodeString(e.Raw)
+	if err != nil {
+		return recipientAddresses(e.To)
+	}
+	message, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return recipientAddresses(e.To)
+	}
+	var result []string
+	for _, header := range []string{"To", "Cc", "Bcc"} {
+		if value := message.Header.Get(header); value != "" {
+			result = append(result, recipientAddresses(value)...)
+		}
+	}
+	if len(result) == 0 {
+		return recipientAddresses(e.To)
+	}
+	return result
+}
+
+// sentMessage is one message in the send history, with how many recipients it had
+type sentMessage struct {
+	at         time.Time
+	recipients int
+}
+
+// sendHistory is what the outbox sent recently, for checking the limits
+type sendHistory struct {
+	lastHour    []sentMessage
+	lastDay     []sentMessage
+	byRecipient map[string][]sentMessage // last 24 hours, one recipient each
+}
+
+// recentSends collects the outbox's sends of the past day. Entries being sent count
+// as sent now, so concurrent sends can't both take the last of a limit.
+func recentSends(entries []outboxEntry, now time.Time) sendHistory {
+	history := sendHistory{byRecipient: map[string][]sentMessage{}}
+	for _, entry := range entries {
+		at := entry.SentAt
+		switch entry.Status {
+		case outboxSent:
+		case outboxSending:
+			at = now
+		default:
+			continue
+		}
+		if now.Sub(at) >= 24*time.Hour {
+			continue
+		}
+		recipients := entry.recipients()
+		sent := sentMessage{at: at, recipients: len(recipients)}
+		history.lastDay = append(history.lastDay, sent)
+		if now.Sub(at) < time.Hour {
+			history.lastHour = append(history.lastHour, sent)
+		}
+		for _, address := range recipients {
+			history.byRecipient[address] = append(history.byRecipient[address], sentMessage{at: at, recipients: 1})
+		}
+	}
+	return history
+}
+
+// recipientCount adds up the recipients of the messages
+func recipientCount(sent []sentMessage) int {
+	total := 0
+	for _, message := range sent {
+		total += message.recipients
+	}
+	return total
+}
+
+// windowWait is how long until enough of the messages sent in a window of the given
+// length leave it for adding more recipients to fit within limit; zero while they
+// fit. A message with more recipients than the limit waits for an empty window.
+func windowWait(sent []sentMessage, adding, limit int, window time.Duration, now time.Time) time.Duration {
+	total := recipientCount(sent)
+	if total == 0 || total+adding <= limit {
+		return 0
+	}
+	oldestFirst := append([]sentMessage(nil), sent...)
+	sort.Slice(oldestFirst, func(i, j int) bool { return oldestFirst[i].at.Before(oldestFirst[j].at) })
+	for _, message := range oldestFirst {
+		total -= message.recipients
+		if total == 0 || total+adding <= limit {
+			return max(message.at.Add(window).Sub(now), time.Second)
+		}
+	}
+	return 0
+}
+
+// throttleDelay returns how long a send to the given recipients must wait to stay
+// within the limits, with the reason; zero means it can go now. The caller holds
+// outboxMu and records the send in the same step, so no other send can slip in between.
+func (l sendLimits) throttleDelay(entries []outboxEntry, recipients []string, now time.Time) (time.Duration, string) {
+	history := recentSends(entries, now)
+	if wait := windowWait(history.lastHour, len(recipients), l.PerHour, time.Hour, now); wait > 0 {
+		return wait, fmt.Sprintf("throttled: %d recipients in the last hour, %d more would pass the limit of %d", recipientCount(history.lastHour), len(recipients), l.PerHour)
+	}
+	if wait := windowWait(history.lastDay, len(recipients), l.PerDay, 24*time.Hour, now); wait > 0 {
+		return wait, fmt.Sprintf("throttled: %d recipients in the last 24 hours, %d more would pass the limit of %d", recipientCount(history.lastDay), len(recipients), l.PerDay)
+	}
+	for _, address := range recipients {
+		if wait := windowWait(history.byRecipient[address], 1, l.PerRecipientDay, 24*time.Hour, now); wait > 0 {
+			return wait, fmt.Sprintf("throttled: %d messages sent to %s in the last 24 hours (limit %d)", len(history.byRecipient[address]), address, l.PerRecipientDay)
+		}
+	}
+	return 0, ""
+}
+
+// bulkWarnings flags a bulk send that could hurt the account's reputation: too many
+// recipients, more than the daily limit has room for, or recipients already mailed
+// up to their limit today
+func (l sendLimits) bulkWarnings(entries []outboxEntry, recipients []string, now time.Time) []string {
+	var warnings []string
+	if len(recipients) > l.WarnRecipients {
+		warnings = append(warnings, fmt.Sprintf("%d recipients is a lot for one send; Gmail may flag bulk mail from a personal account as spam. Consider drafts, or a dedicated mailing service.", len(recipients)))
+	}
+
+	history := recentSends(entries, now)
+	if room := l.PerDay - recipientCount(history.lastDay); len(recipients) > room {
+		warnings = append(warnings, fmt.Sprintf("Only %d of %d recipients fit in the daily limit of %d; the rest will wait until earlier sends are 24 hours old.", max(room, 0), len(recipients), l.PerDay))
+	}
+	var saturated []string
+	for _, recipient := range recipients {
+		address := strings.ToLower(senderAddress(recipient))
+		if len(history.byRecipient[address]) >= l.PerRecipientDay {
+			saturated = append(saturated, address)
+		}
+	}
+	if len(saturated) > 0 {
+		warnings = append(warnings, fmt.Sprintf("Already sent %d or more messages today to: %s. Their sends will be held back.", l.PerRecipientDay, strings.Join(saturated, ", ")))
+	}
+	return warnings
+}
+
+// SendLimits returns the limits and how much of them the outbox used in the past day
+func (g *GmailServer) SendLimits() map[string]interface{} {
+	limits := loadSendLimits()
+	g.outboxMu.Lock()
+	entries, err := g.loadOutbox()
+	g.outboxMu.Unlock()
+	if err != nil {
+		log.Printf("Warning: %v", err)
+	}
+	history := recentSends(entries, time.Now())
+	return map[string]interface{}{
+		"perHour":            limits.PerHour,
+		"perDay":             limits.PerDay,
+		"perRecipientPerDay": limits.PerRecipientDay,
+		"recipientsLastHour": recipientCount(history.lastHour),
+		"recipientsLastDay":  recipientCount(history.lastDay),
+	}
+}
@@ -0,0 +1,113 @@
+package tools
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+)
+
+// sentEntry is an outbox entry for a message sent at the given time to the recipients
+// in its To and Cc headers
+func sentEntry(status string, at time.Time, to, cc string) outboxEntry {
+	raw := "To: " + to + "\r\n"
+	if cc != "" {
+		raw += "Cc: " + cc + "\r\n"
+	}
+	raw += "Subject: Update\r\n\r\nHello"
+	return outboxEntry{To: to, Raw: base64.URLEncoding.EncodeToString([]byte(raw)), Status: status, SentAt: at}
+}
+
+// addresses returns n distinct recipient addresses
+func addresses(n int) string {
+	list := make([]string, n)
+	for i := range list {
+		list[i] = "person" + strings.Repeat("x", i) + "@example.com"
+	}
+	return strings.Join(list, ", ")
+}
+
+func TestThrottleDelay(t *testing.T) {
+	now := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+	limits := sendLimits{PerHour: 10, PerDay: 20, PerRecipientDay: 2}
+	tests := []struct {
+		name       string
+		entries    []outboxEntry
+		recipients []string
+		want       time.Duration
+	}{
+		{"nothing sent", nil, []string{"alice@example.com"}, 0},
+		{
+			"one message to many recipients uses up the hour",
+			[]outboxEntry{sentEntry(outboxSent, now.Add(-20*time.Minute), addresses(6), addresses(4))},
+			[]string{"alice@example.com"},
+			40 * time.Minute,
+		},
+		{
+			"recipients still fit",
+			[]outboxEntry{sentEntry(outboxSent, now.Add(-20*time.Minute), addresses(5), "")},
+			strings.Split(addresses(5), ", "),
+			0,
+		},
+		{
+			"a message being sent counts",
+			[]outboxEntry{sentEntry(outboxSending, time.Time{}, addresses(10), "")},
+			[]string{"alice@example.com"},
+			time.Hour,
+		},
+		{
+			"queued and failed messages don't count",
+			[]outboxEntry{sentEntry(outboxQueued, time.Time{}, addresses(10), ""), sentEntry(outboxFailed, time.Time{}, addresses(10), "")},
+			[]string{"alice@example.com"},
+			0,
+		},
+		{
+			"daily limit waits for the oldest sends to leave",
+			[]outboxEntry{
+				sentEntry(outboxSent, now.Add(-20*time.Hour), addresses(8), ""),
+				sentEntry(outboxSent, now.Add(-10*time.Hour), addresses(8), ""),
+				sentEntry(outboxSent, now.Add(-2*time.Hour), addresses(3), ""),
+			},
+			strings.Split(addresses(3), ", "),
+			4 * time.Hour,
+		},
+		{
+			"per-recipient limit",
+			[]outboxEntry{
+				sentEntry(outboxSent, now.Add(-5*time.Hour), "alice@example.com", ""),
+				sentEntry(outboxSent, now.Add(-3*time.Hour), "bob@example.com", "Alice <alice@example.com>"),
+			},
+			[]string{"alice@example.com"},
+			19 * time.Hour,
+		},
+		{
+			"more recipients than the limit wait for an empty window",
+			[]outboxEntry{sentEntry(outboxSent, now.Add(-30*time.Minute), "alice@example.com", "")},
+			strings.Split(addresses(12), ", "),
+			30 * time.Minute,
+		},
+		{"more recipients than the limit go out alone", nil, strings.Split(addresses(12), ", "), 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wait, reason := limits.throttleDelay(tt.entries, tt.recipients, now)
+			if wait != tt.want {
+				t.Errorf("throttleDelay() = %v (%s), want %v", wait, reason, tt.want)
+			}
+			if (wait > 0) != (reason != "") {
+				t.Errorf("throttleDelay() reason = %q with wait %v", reason, wait)
+			}
+		})
+	}
+}
+
+func TestOutboxEntryRecipients(t *testing.T) {
+	entry := sentEntry(outboxSent, time.Time{}, "Alice <Alice@Example.com>, bob@example.com", "carol@example.com")
+	raw, _ := base64.URLEncoding.DecodeString(entry.Raw)
+	entry.Raw = base64.URLEncoding.EncodeToString([]byte("Bcc: dave@example.com\r\n" + string(raw)))
+
+	want := "alice@example.com,bob@example.com,carol@example.com,dave@example.com"
+	if got := strings.Join(entry.recipients(), ","); got != want {
+		t.Errorf("recipients() = %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,332 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"auto-gmail/internal/gmailclient"
+	"auto-gmail/internal/requestid"
+	"auto-gmail/internal/toolerr"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// fixtureDir holds the mailbox the fake Gmail client is loaded from
+const fixtureDir = "../gmailclient/testdata/gmail"
+
+// toolRecorder is a ToolAdder that keeps each tool's handler by name
+type toolRecorder map[string]server.ToolHandlerFunc
+
+func (r toolRecorder) AddTool(tool mcp.Tool, handler server.ToolHandlerFunc) {
+	r[tool.Name] = handler
+}
+
+// loadFake loads the fixture mailbox
+func loadFake(t *testing.T) *gmailclient.Fake {
+	t.Helper()
+	fake, err := gmailclient.LoadFake(fixtureDir)
+	if err != nil {
+		t.Fatalf("LoadFake() error = %v", err)
+	}
+	return fake
+}
+
+// newTestTools registers every tool, behind the error envelope middleware, for a
+// single-user server on client. Its state and the app data directory are kept in
+// temporary directories.
+func newTestTools(t *testing.T, client gmailclient.Client) toolRecorder {
+	t.Helper()
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("GMAIL_MCP_USERS_FILE", "")
+
+	pool, err := NewGmailServerPool(newGmailServerWithClient(client, t.TempDir()))
+	if err != nil {
+		t.Fatalf("NewGmailServerPool() error = %v", err)
+	}
+	tools := toolRecorder{}
+	RegisterTools(WithMiddleware(tools, requestid.Middleware(), toolerr.Middleware()), pool)
+	return tools
+}
+
+// call runs a tool with arguments and returns its result
+func (r toolRecorder) call(t *testing.T, name string, arguments map[string]interface{}) *mcp.CallToolResult {
+	t.Helper()
+	handler, ok := r[name]
+	if !ok {
+		t.Fatalf("no tool named %s", name)
+	}
+	req := mcp.CallToolRequest{}
+	req.Params.Name = name
+	req.Params.Arguments = arguments
+	result, err := handler(context.Background(), req)
+	if err != nil {
+		t.Fatalf("%s returned error %v", name, err)
+	}
+	return result
+}
+
+// text returns the text of a single-text tool result
+func text(t *testing.T, result *mcp.CallToolResult) string {
+	t.Helper()
+	output, ok := resultText(result)
+	if !ok {
+		t.Fatalf("result isn't a single text: %+v", result.Content)
+	}
+	return output
+}
+
+// decode runs a tool that must succeed and decodes its JSON output into v
+func (r toolRecorder) decode(t *testing.T, name string, arguments map[string]interface{}, v interface{}) {
+	t.Helper()
+	result := r.call(t, name, arguments)
+	if result.IsError {
+		t.Fatalf("%s failed: %s", name, text(t, result))
+	}
+	if err := json.Unmarshal([]byte(text(t, result)), v); err != nil {
+		t.Fatalf("%s output isn't JSON: %v\n%s", name, err, text(t, result))
+	}
+}
+
+// envelope runs a tool that must fail and returns its error envelope
+func (r toolRecorder) envelope(t *testing.T, name string, arguments map[string]interface{}) *toolerr.Error {
+	t.Helper()
+	result := r.call(t, name, arguments)
+	failure := toolerr.FromResult(result)
+	if failure == nil {
+		t.Fatalf("%s = %s, want an error envelope", name, text(t, result))
+	}
+	return failure
+}
+
+// threadResult is the part of a search_threads or fetch_email_bodies result the tests check
+type threadResult struct {
+	ThreadID     string `json:"threadId"`
+	Subject      string `json:"subject"`
+	From         string `json:"from"`
+	MessageCount int    `json:"messageCount"`
+	FullBody     string `json:"fullBody"`
+	Drafts       []struct {
+		DraftID string `json:"draftId"`
+	} `json:"drafts"`
+	Attachments []struct {
+		Filename string `json:"filename"`
+	} `json:"attachments"`
+}
+
+const (
+	planningThread = "18c1a2b3c4d5e6f7"
+	invoiceThread  = "18c2b3c4d5e6f708"
+	planningDraft  = "r-1234567890"
+)
+
+func TestSearchThreads(t *testing.T) {
+	tools := newTestTools(t, loadFake(t))
+	tests := []struct {
+		name  string
+		query string
+		sort  string
+		want  []string
+	}{
+		{"sender", "from:alice@example.com", "", []string{planningThread}},
+		{"free text", "invoice", "", []string{invoiceThread}},
+		{"unread", "is:unread", "", []string{planningThread}},
+		{"newest first", "to:me@example.com", "", []string{invoiceThread, planningThread}},
+		{"oldest first", "to:me@example.com", SortOldest, []string{planningThread, invoiceThread}},
+		{"no matches", "from:nobody@example.com", "", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var output struct {
+				Query       string         `json:"query"`
+				Sort        string         `json:"sort"`
+				ResultCount int            `json:"resultCount"`
+				Results     []threadResult `json:"results"`
+			}
+			tools.decode(t, "search_threads", map[string]interface{}{"query": tt.query, "sort": tt.sort}, &output)
+
+			var got []string
+			for _, result := range output.Results {
+				got = append(got, result.ThreadID)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("search_threads(%q) = %v, want %v", tt.query, got, tt.want)
+			}
+			if output.ResultCount != len(tt.want) || output.Query != tt.query {
+				t.Errorf("search_threads(%q) resultCount = %d, query = %q", tt.query, output.ResultCount, output.Query)
+			}
+		})
+	}
+
+	var output struct {
+		Results []threadResult `json:"results"`
+	}
+	tools.decode(t, "search_threads", map[string]interface{}{"query": "from:alice@example.com"}, &output)
+	result := output.Results[0]
+	if result.Subject != "Q3 planning" || result.MessageCount != 2 {
+		t.Errorf("search_threads result = %+v, want the Q3 planning thread with 2 messages", result)
+	}
+	if len(result.Drafts) != 1 || result.Drafts[0].DraftID != planningDraft {
+		t.Errorf("search_threads drafts = %+v, want %s", result.Drafts, planningDraft)
+	}
+	if len(result.Attachments) != 1 || result.Attachments[0].Filename != "q3-notes.txt" {
+		t.Errorf("search_threads attachments = %+v, want q3-notes.txt", result.Attachments)
+	}
+}
+
+func TestFetchEmailBodies(t *testing.T) {
+	tools := newTestTools(t, loadFake(t))
+
+	var output []threadResult
+	tools.decode(t, "fetch_email_bodies", map[string]interface{}{"thread_ids": planningThread + ", " + invoiceThread}, &output)
+	if len(output) != 2 {
+		t.Fatalf("fetch_email_bodies returned %d threads, want 2", len(output))
+	}
+	bodies := map[string]threadResult{}
+	for _, thread := range output {
+		bodies[thread.ThreadID] = thread
+	}
+	if body := bodies[planningThread].FullBody; !strings.Contains(body, "attaching my notes for Q3 planning") {
+		t.Errorf("fetch_email_bodies body = %q, want Alice's message", body)
+	}
+	if body := bodies[invoiceThread].FullBody; !strings.Contains(body, "Your June invoice is now available") {
+		t.Errorf("fetch_email_bodies body = %q, want the invoice notice", body)
+	}
+	if drafts := bodies[planningThread].Drafts; len(drafts) != 1 || drafts[0].DraftID != planningDraft {
+		t.Errorf("fetch_email_bodies drafts = %+v, want %s", drafts, planningDraft)
+	}
+}
+
+func TestCreateDraft(t *testing.T) {
+	tests := []struct {
+		name       string
+		arguments  map[string]interface{}
+		wantAction string
+		// wantDraft is the draft that must be overwritten; empty expects a new draft
+		wantDraft  string
+		wantDrafts int
+	}{
+		{
+			name:       "update the thread's draft",
+			arguments:  map[string]interface{}{"thread_id": planningThread},
+			wantAction: "updated",
+			wantDraft:  planningDraft,
+			wantDrafts: 1,
+		},
+		{
+			name:       "create another draft in the thread",
+			arguments:  map[string]interface{}{"thread_id": planningThread, "mode": DraftModeCreateNew},
+			wantAction: "created",
+			wantDrafts: 2,
+		},
+		{
+			name:       "fail_if_exists on a thread without drafts",
+			arguments:  map[string]interface{}{"thread_id": invoiceThread, "mode": DraftModeFailIfExists},
+			wantAction: "created",
+			wantDrafts: 2,
+		},
+		{
+			name:       "new conversation",
+			arguments:  map[string]interface{}{},
+			wantAction: "created",
+			wantDrafts: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := loadFake(t)
+			tools := newTestTools(t, fake)
+			arguments := map[string]interface{}{"to": "alice@example.com", "subject": "Re: Q3 planning", "body": "Notes look good, see you Friday."}
+			for key, value := range tt.arguments {
+				arguments[key] = value
+			}
+
+			var output struct {
+				DraftID  string `json:"draftId"`
+				Action   string `json:"action"`
+				Diff     string `json:"diff"`
+				Previous *struct {
+					Subject string `json:"subject"`
+				} `json:"previous"`
+			}
+			tools.decode(t, "create_draft", arguments, &output)
+			if output.Action != tt.wantAction {
+				t.Errorf("create_draft action = %q, want %q", output.Action, tt.wantAction)
+			}
+			if tt.wantDraft != "" {
+				if output.DraftID != tt.wantDraft {
+					t.Errorf("create_draft draftId = %q, want %q", output.DraftID, tt.wantDraft)
+				}
+				if output.Previous == nil || !strings.Contains(output.Diff, "+Notes look good") {
+					t.Errorf("create_draft diff = %q, previous = %+v, want the change from the old draft", output.Diff, output.Previous)
+				}
+			} else if output.DraftID == "" || output.DraftID == planningDraft {
+				t.Errorf("create_draft draftId = %q, want a new draft", output.DraftID)
+			}
+
+			drafts, err := fake.ListDrafts(context.Background())
+			if err != nil {
+				t.Fatalf("ListDrafts() error = %v", err)
+			}
+			if len(drafts.Drafts) != tt.wantDrafts {
+				t.Errorf("mailbox has %d drafts, want %d", len(drafts.Drafts), tt.wantDrafts)
+			}
+		})
+	}
+
+	t.Run("fail_if_exists on a thread with a draft", func(t *testing.T) {
+		fake := loadFake(t)
+		tools := newTestTools(t, fake)
+		failure := tools.envelope(t, "create_draft", map[string]interface{}{
+			"to": "alice@example.com", "subject": "Re: Q3 planning", "body": "Hello", "thread_id": planningThread, "mode": DraftModeFailIfExists,
+		})
+		if failure.Code != "draft_conflict" || failure.Category != toolerr.InvalidInput {
+			t.Errorf("create_draft error = %s/%s, want %s/draft_conflict", failure.Category, failure.Code, toolerr.InvalidInput)
+		}
+		existing, _ := failure.Details["existingDrafts"].([]interface{})
+		if len(existing) != 1 {
+			t.Errorf("create_draft error details = %v, want the thread's one draft", failure.Details)
+		}
+		if drafts, _ := fake.ListDrafts(context.Background()); len(drafts.Drafts) != 1 {
+			t.Errorf("mailbox has %d drafts after a conflict, want 1", len(drafts.Drafts))
+		}
+	})
+}
+
+func TestErrorEnvelope(t *testing.T) {
+	tools := newTestTools(t, loadFake(t))
+	tooMany := strings.TrimSuffix(strings.Repeat(planningThread+",", 21), ",")
+	tests := []struct {
+		name         string
+		tool         string
+		arguments    map[string]interface{}
+		wantCategory toolerr.Category
+		wantCode     string
+	}{
+		{"missing argument", "search_threads", map[string]interface{}{}, toolerr.InvalidInput, "invalid_argument"},
+		{"invalid sort", "search_threads", map[string]interface{}{"query": "invoice", "sort": "alphabetical"}, toolerr.InvalidInput, "invalid_argument"},
+		{"too many threads", "fetch_email_bodies", map[string]interface{}{"thread_ids": tooMany}, toolerr.InvalidInput, "invalid_argument"},
+		{"invalid draft mode", "create_draft", map[string]interface{}{"to": "alice@example.com", "subject": "Hi", "body": "Hi", "mode": "replace"}, toolerr.InvalidInput, "invalid_argument"},
+		{"unknown recipient group", "create_draft", map[string]interface{}{"to_group": "nobody", "subject": "Hi", "body": "Hi"}, toolerr.NotFound, "group_not_found"},
+		{"unknown thread", "export_thread_document", map[string]interface{}{"thread_id": "missing"}, toolerr.NotFound, "not_found"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			failure := tools.envelope(t, tt.tool, tt.arguments)
+			if failure.Category != tt.wantCategory || failure.Code != tt.wantCode {
+				t.Errorf("%s error = %s/%s, want %s/%s", tt.tool, failure.Category, failure.Code, tt.wantCategory, tt.wantCode)
+			}
+			if failure.Message == "" || failure.Hint == "" {
+				t.Errorf("%s error = %+v, want a message and a hint", tt.tool, failure)
+			}
+			if failure.Retryable {
+				t.Errorf("%s error is retryable, want it not to be", tt.tool)
+			}
+			if !strings.HasPrefix(failure.RequestID, "req-") {
+				t.Errorf("%s error requestId = %q, want the call's request ID", tt.tool, failure.RequestID)
+			}
+		})
+	}
+}
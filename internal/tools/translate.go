@@ -0,0 +1,112 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"auto-gmail/internal/extract"
+	"auto-gmail/internal/llm"
+	"auto-gmail/internal/redact"
+	"auto-gmail/internal/toolerr"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/openai/openai-go"
+	"google.golang.org/api/gmail/v1"
+)
+
+// maxTranslateChars caps how much of a body is sent for translation
+const maxTranslateChars = 20000
+
+// TranslateMessage renders a message's subject and body into targetLanguage with OpenAI
+func (g *GmailServer) TranslateMessage(ctx context.Context, messageID, targetLanguage string) (*mcp.CallToolResult, error) {
+	targetLanguage = strings.TrimSpace(targetLanguage)
+	if targetLanguage == "" {
+		targetLanguage = "English"
+	}
+	client, err := llm.NewClient()
+	if err != nil {
+		return toolerr.Result(err, "Translation is unavailable"), nil
+	}
+
+	message, err := g.getMessage(ctx, messageID)
+	if err != nil {
+		return toolerr.Result(err, "Failed to get message"), nil
+	}
+	subject := messageHeader(message, "Subject")
+	body := extract.EmailBody(message)
+	if strings.TrimSpace(body) == "" {
+		return toolerr.Invalid("Message has no text body to translate"), nil
+	}
+
+	truncated := len(body) > maxTranslateChars
+	if truncated {
+		body = truncateText(body, maxTranslateChars)
+	}
+
+	// Strip personal data before the text leaves the machine (GMAIL_MCP_REDACT=1)
+	redactor := redact.FromEnv()
+	names := messageNames(message)
+	promptSubject, redactions := redactor.Redact(subject, names...)
+	promptBody, bodyRedactions := redactor.Redact(body, names...)
+	redactions.Add(bodyRedactions)
+
+	prompt := fmt.Sprintf(`Translate the following email into %s. Keep the markdown formatting, links, names, numbers, dates and placeholders like [NAME] or [REDACTED_PHONE] as they are. Reply with the translated subject on the first line, prefixed with "Subject: ", then a blank line, then the translated body. Do not add any commentary.
+
+Subject: %s
+
+%s`, targetLanguage, promptSubject, promptBody)
+
+	completion, err := client.Chat.Completions.New(ctx, openai.ChatCompletionNewParams{
+		Messages: []openai.ChatCompletionMessageParamUnion{
+			{
+				OfUser: &openai.ChatCompletionUserMessageParam{
+					Content: openai.ChatCompletionUserMessageParamContentUnion{
+						OfString: openai.String(prompt),
+					},
+				},
+			},
+		},
+		Model:       llm.ChatModel(),
+		Temperature: openai.Float(0.1), // Translations should stay close to the original
+	})
+	if err != nil {
+		return toolerr.Result(err, "Failed to translate message"), nil
+	}
+	if len(completion.Choices) == 0 {
+		return toolerr.New(toolerr.Unavailable, "empty_model_response", "Failed to translate message: no response from OpenAI").Result(), nil
+	}
+
+	translation := strings.TrimSpace(completion.Choices[0].Message.Content)
+	translatedSubject := ""
+	if first, rest, ok := strings.Cut(translation, "\n"); ok && strings.HasPrefix(first, "Subject: ") {
+		translatedSubject = strings.TrimPrefix(first, "Subject: ")
+		translation = strings.TrimSpace(rest)
+	}
+
+	result := map[string]interface{}{
+		"messageId":         messageID,
+		"threadId":          message.ThreadId,
+		"subject":           subject,
+		"sourceLanguage":    extract.DetectLanguage(body),
+		"targetLanguage":    targetLanguage,
+		"translatedSubject": translatedSubject,
+		"translatedBody":    translation,
+	}
+	if len(redactions) > 0 {
+		result["redactions"] = redactions
+	}
+	if truncated {
+		result["trimmed"] = []string{fmt.Sprintf("only the first %d chars of the body were translated", maxTranslateChars)}
+	}
+
+	resultJSON, _ := json.MarshalIndent(result, "", "  ")
+	return mcp.NewToolResultText(string(resultJSON)), nil
+}
+
+// messageNames returns the From, To and Cc headers of a message, whose display
+// names the redaction names pass removes
+func messageNames(message *gmail.Message) []string {
+	return []string{messageHeader(message, "From"), messageHeader(message, "To"), messageHeader(message, "Cc")}
+}
@@ -0,0 +1,149 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"net/mail"
+	"sort"
+	"strings"
+	"time"
+
+	"google.golang.org/api/gmail/v1"
+)
+
+// Smart view sizes: how many matching threads are inspected, and how many listed
+const (
+	maxViewScan    = 50
+	maxViewListed  = 25
+	needsReplyDays = 14
+)
+
+// smartView is a live inbox listing exposed as a gmail://view/{name} resource. Its
+// query is built on every read, and keep, when set, drops threads the query can't
+// rule out.
+type smartView struct {
+	Name        string
+	Title       string
+	Description string
+	query       func(vips []string) string
+	keep        func(thread *gmail.Thread, me string) bool
+}
+
+// smartViews lists the views, in the order they're registered
+var smartViews = []smartView{
+	{
+		Name:        "needs-reply",
+		Title:       "Needs Reply",
+		Description: fmt.Sprintf("Inbox threads from the past %d days where a person wrote last to you and hasn't had a reply; mailing lists, notifications and auto-replies are left out", needsReplyDays),
+		query: func([]string) string {
+			return fmt.Sprintf("in:inbox newer_than:%dd -category:promotions -category:social", needsReplyDays)
+		},
+		keep: needsReply,
+	},
+	{
+		Name:        "today",
+		Title:       "Today",
+		Description: "Inbox threads with mail received today, in the user's time zone",
+		query: func([]string) string {
+			return "in:inbox after:" + startOfDay(userNow()).Format("2006/01/02")
+		},
+	},
+	{
+		Name:        "vip-unread",
+		Title:       "Unread from VIPs",
+		Description: "Unread threads from the VIP senders and domains set with set_vip",
+		query: func(vips []string) string {
+			if len(vips) == 0 {
+				return ""
+			}
+			senders := make([]string, len(vips))
+			for i, vip := range vips {
+				senders[i] = "from:" + strings.TrimPrefix(vip, "@")
+			}
+			return "is:unread {" + strings.Join(senders, " ") + "}"
+		},
+	},
+}
+
+// URI is the view's resource address
+func (v smartView) URI() string {
+	return "gmail://view/" + v.Name
+}
+
+// needsReply reports whether a thread's latest message is from a person, to or cc
+// the user, and nobody has answered it
+func needsReply(thread *gmail.Thread, me string) bool {
+	latest := latestThreadMessage(thread)
+	if latest == nil || hasLabelID(latest, "SENT") || latest.Payload == nil {
+		return false
+	}
+	if isAutomated(latest) || isAutoReply(latest) {
+		return false
+	}
+	return me == "" || addressedTo(messageHeader(latest, "To"), me) || addressedTo(messageHeader(latest, "Cc"), me)
+}
+
+// ViewMarkdown lists a smart view's threads as compact markdown, highest priority
+// first, each with its sender, latest activity and why it matters
+func (g *GmailServer) ViewMarkdown(ctx context.Context, view smartView) (string, error) {
+	me := g.userEmail(ctx)
+	vips := g.loadVIPs()
+	now := userNow()
+
+	var out strings.Builder
+	query := view.query(vips)
+	if query == "" {
+		fmt.Fprintf(&out, "# %s\n\nNo VIPs are set yet; add senders with the set_vip tool.\n", view.Title)
+		return out.String(), nil
+	}
+
+	listed, err := g.client.ListThreads(ctx, query, maxViewScan)
+	if err != nil {
+		return "", err
+	}
+	hydrated := g.hydrateThreads(ctx, listed.Threads)
+	pc := priorityContext{me: me, vips: vips, correspondents: g.correspondents(ctx)}
+
+	type viewEntry struct {
+		thread   *gmail.Thread
+		priority int
+	}
+	var entries []viewEntry
+	for _, listedThread := range listed.Threads {
+		thread, ok := hydrated[listedThread.Id]
+		if !ok || len(thread.Messages) == 0 || (view.keep != nil && !view.keep(thread, me)) {
+			continue
+		}
+		priority, _ := threadPriority(thread, pc)
+		entries = append(entries, viewEntry{thread: thread, priority: priority})
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].priority > entries[j].priority })
+
+	fmt.Fprintf(&out, "# %s (%d)\n\n", view.Title, len(entries))
+	fmt.Fprintf(&out, "_%s. Refreshed %s; query: `%s`_\n\n", view.Description, now.Format("2006-01-02 15:04 MST"), query)
+	if len(entries) == 0 {
+		out.WriteString("Nothing here right now.\n")
+	}
+	for i, entry := range entries {
+		if i == maxViewListed {
+			fmt.Fprintf(&out, "\n…and %d more; search with the query above to see them all.\n", len(entries)-maxViewListed)
+			break
+		}
+		first, latest := entry.thread.Messages[0], latestThreadMessage(entry.thread)
+		if latest == nil {
+			latest = first
+		}
+		from := messageHeader(latest, "From")
+		if parsed, err := mail.ParseAddress(from); err == nil && parsed.Name != "" {
+			from = parsed.Name
+		}
+		subject := messageHeader(first, "Subject")
+		if subject == "" {
+			subject = "(no subject)"
+		}
+		fmt.Fprintf(&out, "- **%s** from %s, %s (thread `%s`, priority %d): %s\n",
+			subject, from, time.UnixMilli(latest.InternalDate).In(now.Location()).Format("Jan 2 15:04"),
+			entry.thread.Id, entry.priority, priorityReason(entry.thread, pc))
+	}
+	return out.String(), nil
+}
@@ -0,0 +1,139 @@
+package tools
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+
+	"auto-gmail/internal/toolerr"
+)
+
+// vipFile is where this server's VIP senders are stored, next to its token
+func (g *GmailServer) vipFile() string {
+	return g.dataFile("vips.json")
+}
+
+// loadVIPs returns the VIP senders from the VIP file and GMAIL_MCP_VIPS (comma-separated).
+// Entries are lowercase addresses or "@domain" patterns.
+func (g *GmailServer) loadVIPs() []string {
+	var vips []string
+	if data, err := os.ReadFile(g.vipFile()); err == nil {
+		var stored struct {
+			Senders []string `json:"senders"`
+		}
+		if err := json.Unmarshal(data, &stored); err != nil {
+			log.Printf("Warning: Invalid VIP file %s: %v", g.vipFile(), err)
+		}
+		vips = append(vips, stored.Senders...)
+	}
+	for _, sender := range strings.Split(os.Getenv("GMAIL_MCP_VIPS"), ",") {
+		if vip := normalizeVIP(sender); vip != "" && !containsVIP(vips, vip) {
+			vips = append(vips, vip)
+		}
+	}
+	return vips
+}
+
+// SetVIP adds or removes a VIP sender and returns the resulting list.
+// action is "add", "remove" or "list".
+func (g *GmailServer) SetVIP(sender, action string) (*mcp.CallToolResult, error) {
+	var stored struct {
+		Senders []string `json:"senders"`
+	}
+	if data, err := os.ReadFile(g.vipFile()); err == nil {
+		if err := json.Unmarshal(data, &stored); err != nil {
+			return toolerr.Result(err, fmt.Sprintf("Failed to read VIP file %s", g.vipFile())), nil
+		}
+	}
+
+	vip := normalizeVIP(sender)
+	if action != "list" && vip == "" {
+		return toolerr.Invalid(fmt.Sprintf("Invalid sender %q: use an email address or @domain", sender)), nil
+	}
+
+	switch action {
+	case "list":
+	case "", "add":
+		action = "add"
+		if !containsVIP(stored.Senders, vip) {
+			stored.Senders = append(stored.Senders, vip)
+			sort.Strings(stored.Senders)
+		}
+	case "remove":
+		kept := stored.Senders[:0]
+		for _, existing := range stored.Senders {
+			if existing != vip {
+				kept = append(kept, existing)
+			}
+		}
+		stored.Senders = kept
+	default:
+		return toolerr.Invalid(fmt.Sprintf("Invalid action %q: use \"add\", \"remove\" or \"list\"", action)), nil
+	}
+
+	if action != "list" {
+		data, _ := json.MarshalIndent(stored, "", "  ")
+		if err := os.WriteFile(g.vipFile(), data, 0600); err != nil {
+			return toolerr.Result(err, "Failed to save VIP file"), nil
+		}
+	}
+
+	result := map[string]interface{}{
+		"action": action,
+		"vips":   g.loadVIPs(),
+	}
+	if vip != "" {
+		result["sender"] = vip
+	}
+	if os.Getenv("GMAIL_MCP_VIPS") != "" {
+		result["note"] = "Senders from GMAIL_MCP_VIPS are always VIPs and can't be removed with this tool."
+	}
+
+	resultJSON, _ := json.MarshalIndent(result, "", "  ")
+	return mcp.NewToolResultText(string(resultJSON)), nil
+}
+
+// normalizeVIP turns an address, From header or domain into a VIP entry ("" if invalid)
+func normalizeVIP(sender string) string {
+	sender = strings.ToLower(strings.TrimSpace(sender))
+	if sender == "" || (strings.ContainsAny(sender, " \t") && !strings.Contains(sender, "<")) {
+		return ""
+	}
+	if !strings.Contains(sender, "@") {
+		// A bare domain
+		if !strings.Contains(sender, ".") {
+			return ""
+		}
+		return "@" + sender
+	}
+	if strings.HasPrefix(sender, "@") {
+		return sender
+	}
+	return strings.ToLower(senderAddress(sender))
+}
+
+// containsVIP reports whether vips has the exact entry
+func containsVIP(vips []string, vip string) bool {
+	for _, existing := range vips {
+		if existing == vip {
+			return true
+		}
+	}
+	return false
+}
+
+// isVIP reports whether a From header matches a VIP address or domain
+func isVIP(from string, vips []string) bool {
+	address := strings.ToLower(senderAddress(from))
+	for _, vip := range vips {
+		if address == vip || (strings.HasPrefix(vip, "@") && strings.HasSuffix(address, vip)) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,149 @@
+package tools
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"auto-gmail/internal/extract"
+	"auto-gmail/internal/llm"
+	"auto-gmail/internal/redact"
+	"auto-gmail/internal/toolerr"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/openai/openai-go"
+	"google.golang.org/api/gmail/v1"
+)
+
+// maxVisionImageBytes is the largest image sent to the vision model
+const maxVisionImageBytes = 20 << 20
+
+// visionImageTypes are the image formats vision models accept, by extension
+var visionImageTypes = map[string]string{
+	".png":  "image/png",
+	".jpg":  "image/jpeg",
+	".jpeg": "image/jpeg",
+	".gif":  "image/gif",
+	".webp": "image/webp",
+}
+
+// visionPrompt is the default instruction when the caller doesn't ask a question
+const visionPrompt = `Describe this image, which was attached to an email, in a short paragraph. Then transcribe all readable text exactly as written, keeping line breaks, under a line "Text:". For receipts and invoices, list the merchant, date, line items and total. For whiteboards and handwritten notes, transcribe the content as a bulleted list. If there is no readable text, write "Text: none".`
+
+// AnalyzeImageAttachment sends an image attachment to the configured vision model and
+// returns its description and the text it reads from the image
+func (g *GmailServer) AnalyzeImageAttachment(ctx context.Context, messageID, filename, question string) (*mcp.CallToolResult, error) {
+	client, err := llm.NewClient()
+	if err != nil {
+		return toolerr.Result(err, "Image analysis is unavailable"), nil
+	}
+	// Redaction works on text; an image would reach the provider unredacted
+	if redact.FromEnv() != nil && !llm.IsLocal(llm.BaseURL()) {
+		return toolerr.New(toolerr.InvalidInput, "disabled_by_redaction", "Image analysis is disabled while GMAIL_MCP_REDACT=1 because images can't be redacted; set GMAIL_MCP_LLM_BASE_URL to a local vision model to use it").Result(), nil
+	}
+
+	message, err := g.getMessage(ctx, messageID)
+	if err != nil {
+		return toolerr.Result(err, "Failed to get message"), nil
+	}
+
+	var attachmentPart *gmail.MessagePart
+	allAttachments := extract.AttachmentInfo(message)
+	for _, attachment := range allAttachments {
+		if attachment["filename"] == filename {
+			extract.FindAttachmentPart(message.Payload.Parts, attachment["attachmentId"].(string), &attachmentPart)
+			break
+		}
+	}
+	if attachmentPart == nil {
+		availableFiles := make([]string, 0, len(allAttachments))
+		for _, att := range allAttachments {
+			availableFiles = append(availableFiles, att["filename"].(string))
+		}
+		return toolerr.New(toolerr.NotFound, "attachment_not_found", fmt.Sprintf("Attachment with filename '%s' not found. Available files: %v", filename, availableFiles)).Result(), nil
+	}
+
+	mimeType := strings.ToLower(attachmentPart.MimeType)
+	if !strings.HasPrefix(mimeType, "image/") || !containsValue(visionImageTypes, mimeType) {
+		// Gmail often labels images application/octet-stream; fall back to the extension
+		var ok bool
+		if mimeType, ok = visionImageTypes[strings.ToLower(filepath.Ext(filename))]; !ok {
+			return toolerr.Invalid(fmt.Sprintf("'%s' (%s) isn't a PNG, JPEG, GIF or WebP image; use render_attachment_preview or extract_attachment_by_filename for documents", filename, attachmentPart.MimeType)), nil
+		}
+	}
+	if attachmentPart.Body.Size > maxVisionImageBytes {
+		return toolerr.Invalid(fmt.Sprintf("'%s' is %d bytes, over the %d byte limit for image analysis", filename, attachmentPart.Body.Size, maxVisionImageBytes)), nil
+	}
+
+	data, release, err := g.downloadAttachment(ctx, messageID, attachmentPart.Body.AttachmentId, attachmentPart)
+	if err != nil {
+		return toolerr.Result(err, ""), nil
+	}
+	defer release()
+
+	prompt := visionPrompt
+	if question = strings.TrimSpace(question); question != "" {
+		prompt = fmt.Sprintf("This image was attached to an email. %s", question)
+	}
+
+	completion, err := client.Chat.Completions.New(ctx, openai.ChatCompletionNewParams{
+		Messages: []openai.ChatCompletionMessageParamUnion{
+			{
+				OfUser: &openai.ChatCompletionUserMessageParam{
+					Content: openai.ChatCompletionUserMessageParamContentUnion{
+						OfArrayOfContentParts: []openai.ChatCompletionContentPartUnionParam{
+							openai.TextContentPart(prompt),
+							openai.ImageContentPart(openai.ChatCompletionContentPartImageImageURLParam{
+								URL:    fmt.Sprintf("data:%s;base64,%s", mimeType, base64.StdEncoding.EncodeToString(data)),
+								Detail: "high",
+							}),
+						},
+					},
+				},
+			},
+		},
+		Model:       llm.VisionModel(),
+		Temperature: openai.Float(0.1), // Transcriptions should stick to what's in the image
+	})
+	if err != nil {
+		return toolerr.Result(err, "Failed to analyze image"), nil
+	}
+	if len(completion.Choices) == 0 {
+		return toolerr.New(toolerr.Unavailable, "empty_model_response", "Failed to analyze image: no response from the model").Result(), nil
+	}
+
+	analysis := strings.TrimSpace(completion.Choices[0].Message.Content)
+	result := map[string]interface{}{
+		"messageId": messageID,
+		"filename":  filename,
+		"mimeType":  mimeType,
+		"model":     llm.VisionModel(),
+	}
+	if question != "" {
+		result["question"] = question
+		result["answer"] = analysis
+	} else {
+		// Split the default answer into the description and the transcribed text
+		description, text, found := strings.Cut(analysis, "Text:")
+		result["description"] = strings.TrimSpace(description)
+		if found && !strings.EqualFold(strings.TrimSpace(text), "none") {
+			result["extractedText"] = strings.TrimSpace(text)
+		}
+	}
+
+	resultJSON, _ := json.MarshalIndent(result, "", "  ")
+	return mcp.NewToolResultText(string(resultJSON)), nil
+}
+
+// containsValue reports whether any value of m equals value
+func containsValue(m map[string]string, value string) bool {
+	for _, v := range m {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,96 @@
+package transport
+
+import (
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// defaultCORSOrigins only lets pages served from this machine call the server
+var defaultCORSOrigins = []string{"http://localhost:*", "https://localhost:*", "http://127.0.0.1:*", "https://127.0.0.1:*", "http://[::1]:*", "https://[::1]:*"}
+
+// corsHeaders are the request headers MCP clients in a browser send
+const corsHeaders = "Authorization, Content-Type, Accept, Mcp-Session-Id, Mcp-Protocol-Version, Last-Event-ID"
+
+// originAllowlist decides which browser origins may call the server. Entries are
+// origins such as "https://app.example.com"; a ":*" port matches any port, or no
+// port, and "*" allows every origin.
+type originAllowlist []string
+
+// corsOriginsFromEnv reads the comma-separated GMAIL_MCP_CORS_ORIGINS, defaulting to
+// localhost only
+func corsOriginsFromEnv() originAllowlist {
+	value := strings.TrimSpace(os.Getenv("GMAIL_MCP_CORS_ORIGINS"))
+	if value == "" {
+		return defaultCORSOrigins
+	}
+	var origins originAllowlist
+	for _, origin := range strings.Split(value, ",") {
+		if origin = strings.TrimRight(strings.TrimSpace(origin), "/"); origin != "" {
+			origins = append(origins, strings.ToLower(origin))
+		}
+	}
+	if len(origins) == 1 && origins[0] == "*" {
+		log.Printf("⚠️  GMAIL_MCP_CORS_ORIGINS=* lets any website in a browser on this network call the server")
+	}
+	return origins
+}
+
+// allows reports whether an Origin header value is on the list
+func (origins originAllowlist) allows(origin string) bool {
+	parsed, err := url.Parse(strings.ToLower(origin))
+	if err != nil || parsed.Scheme == "" || parsed.Host == "" {
+		return false
+	}
+	for _, allowed := range origins {
+		if allowed == "*" || allowed == parsed.Scheme+"://"+parsed.Host {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(allowed, ":*"); ok && prefix == parsed.Scheme+"://"+hostWithoutPort(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+// hostWithoutPort returns the URL's host, keeping the brackets around IPv6 addresses
+func hostWithoutPort(u *url.URL) string {
+	if strings.HasPrefix(u.Host, "[") {
+		return "[" + u.Hostname() + "]"
+	}
+	return u.Hostname()
+}
+
+// withCORS answers CORS preflights and rejects cross-origin requests from origins
+// that aren't allowed. That also stops DNS rebinding attacks, where a malicious page
+// reaches the local server under its own name. Requests without an Origin header,
+// such as from native MCP clients and browser navigations, pass through.
+func withCORS(next http.Handler, origins originAllowlist) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if !origins.allows(origin) {
+			log.Printf("Rejected request to %s from origin %s (see GMAIL_MCP_CORS_ORIGINS)", r.URL.Path, origin)
+			http.Error(w, "Origin not allowed", http.StatusForbidden)
+			return
+		}
+
+		header := w.Header()
+		header.Set("Access-Control-Allow-Origin", origin)
+		header.Add("Vary", "Origin")
+		header.Set("Access-Control-Expose-Headers", "Mcp-Session-Id")
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			header.Set("Access-Control-Allow-Methods", "GET, POST, DELETE, OPTIONS")
+			header.Set("Access-Control-Allow-Headers", corsHeaders)
+			header.Set("Access-Control-Max-Age", "600")
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,144 @@
+package transport
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestWithCORS(t *testing.T) {
+	origins := originAllowlist{"https://app.example.com", "http://localhost:*"}
+	tests := []struct {
+		name          string
+		method        string
+		origin        string
+		requestMethod string // Access-Control-Request-Method
+		wantStatus    int
+		wantNext      bool
+		wantHeaders   map[string]string
+	}{
+		{
+			name: "no origin passes through", method: http.MethodPost,
+			wantStatus: http.StatusOK, wantNext: true,
+			wantHeaders: map[string]string{"Access-Control-Allow-Origin": ""},
+		},
+		{
+			name: "allowed origin", method: http.MethodPost, origin: "https://app.example.com",
+			wantStatus: http.StatusOK, wantNext: true,
+			wantHeaders: map[string]string{
+				"Access-Control-Allow-Origin":   "https://app.example.com",
+				"Access-Control-Expose-Headers": "Mcp-Session-Id",
+				"Vary":                          "Origin",
+				"Access-Control-Allow-Methods":  "",
+			},
+		},
+		{
+			name: "any port on localhost", method: http.MethodGet, origin: "http://localhost:5173",
+			wantStatus: http.StatusOK, wantNext: true,
+			wantHeaders: map[string]string{"Access-Control-Allow-Origin": "http://localhost:5173"},
+		},
+		{
+			name: "preflight", method: http.MethodOptions, origin: "https://app.example.com", requestMethod: http.MethodPost,
+			wantStatus: http.StatusNoContent,
+			wantHeaders: map[string]string{
+				"Access-Control-Allow-Origin":  "https://app.example.com",
+				"Access-Control-Allow-Methods": "GET, POST, DELETE, OPTIONS",
+				"Access-Control-Allow-Headers": corsHeaders,
+				"Access-Control-Max-Age":       "600",
+			},
+		},
+		{
+			name: "options without a preflight", method: http.MethodOptions, origin: "https://app.example.com",
+			wantStatus: http.StatusOK, wantNext: true,
+			wantHeaders: map[string]string{"Access-Control-Allow-Methods": ""},
+		},
+		{
+			name: "disallowed origin", method: http.MethodPost, origin: "https://evil.example",
+			wantStatus:  http.StatusForbidden,
+			wantHeaders: map[string]string{"Access-Control-Allow-Origin": ""},
+		},
+		{
+			name: "disallowed preflight", method: http.MethodOptions, origin: "https://evil.example", requestMethod: http.MethodPost,
+			wantStatus:  http.StatusForbidden,
+			wantHeaders: map[string]string{"Access-Control-Allow-Methods": ""},
+		},
+		{
+			name: "other scheme", method: http.MethodPost, origin: "http://app.example.com",
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name: "rebound name", method: http.MethodPost, origin: "http://localhost.evil.example:8080",
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name: "opaque origin", method: http.MethodPost, origin: "null",
+			wantStatus: http.StatusForbidden,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			called := false
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				called = true
+			})
+			req := httptest.NewRequest(tt.method, "/mcp", nil)
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+			if tt.requestMethod != "" {
+				req.Header.Set("Access-Control-Request-Method", tt.requestMethod)
+			}
+			recorder := httptest.NewRecorder()
+			withCORS(next, origins).ServeHTTP(recorder, req)
+
+			if recorder.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", recorder.Code, tt.wantStatus)
+			}
+			if called != tt.wantNext {
+				t.Errorf("next handler called = %v, want %v", called, tt.wantNext)
+			}
+			for name, want := range tt.wantHeaders {
+				if got := recorder.Header().Get(name); got != want {
+					t.Errorf("%s = %q, want %q", name, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestOriginAllowlist(t *testing.T) {
+	tests := []struct {
+		origins originAllowlist
+		origin  string
+		want    bool
+	}{
+		{defaultCORSOrigins, "http://localhost:3000", true},
+		{defaultCORSOrigins, "http://localhost", true},
+		{defaultCORSOrigins, "https://127.0.0.1:8443", true},
+		{defaultCORSOrigins, "http://[::1]:3000", true},
+		{defaultCORSOrigins, "http://LOCALHOST:3000", true},
+		{defaultCORSOrigins, "http://192.168.1.5:3000", false},
+		{defaultCORSOrigins, "localhost:3000", false},
+		{originAllowlist{"https://app.example.com"}, "https://app.example.com:8443", false},
+		{originAllowlist{"*"}, "https://anything.example", true},
+		{originAllowlist{"*"}, "null", false},
+	}
+	for _, tt := range tests {
+		if got := tt.origins.allows(tt.origin); got != tt.want {
+			t.Errorf("%v.allows(%q) = %v, want %v", tt.origins, tt.origin, got, tt.want)
+		}
+	}
+}
+
+func TestCORSOriginsFromEnv(t *testing.T) {
+	t.Setenv("GMAIL_MCP_CORS_ORIGINS", "")
+	if got := corsOriginsFromEnv(); !reflect.DeepEqual(got, originAllowlist(defaultCORSOrigins)) {
+		t.Errorf("corsOriginsFromEnv() = %v, want the localhost defaults", got)
+	}
+	t.Setenv("GMAIL_MCP_CORS_ORIGINS", " https://App.example.com/ ,, http://localhost:* ")
+	want := originAllowlist{"https://app.example.com", "http://localhost:*"}
+	if got := corsOriginsFromEnv(); !reflect.DeepEqual(got, want) {
+		t.Errorf("corsOriginsFromEnv() = %v, want %v", got, want)
+	}
+}
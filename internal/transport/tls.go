@@ -0,0 +1,144 @@
+package transport
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"log"
+	"math/big"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"auto-gmail/internal/config"
+)
+
+// selfSignedValidity is how long a generated certificate lasts; it is regenerated
+// once less than selfSignedRenewal of that is left
+const (
+	selfSignedValidity = 365 * 24 * time.Hour
+	selfSignedRenewal  = 30 * 24 * time.Hour
+)
+
+// tlsConfigFromEnv returns the HTTPS configuration from GMAIL_MCP_TLS_CERT and
+// GMAIL_MCP_TLS_KEY, or a self-signed certificate with GMAIL_MCP_TLS=self-signed.
+// It returns nil when the server should use plain HTTP.
+func tlsConfigFromEnv() (*tls.Config, error) {
+	certFile := strings.TrimSpace(os.Getenv("GMAIL_MCP_TLS_CERT"))
+	keyFile := strings.TrimSpace(os.Getenv("GMAIL_MCP_TLS_KEY"))
+	mode := strings.ToLower(strings.TrimSpace(os.Getenv("GMAIL_MCP_TLS")))
+
+	switch {
+	case certFile != "" || keyFile != "":
+		if certFile == "" || keyFile == "" {
+			return nil, fmt.Errorf("GMAIL_MCP_TLS_CERT and GMAIL_MCP_TLS_KEY must be set together")
+		}
+	case mode == "self-signed" || mode == "auto":
+		certFile, keyFile = config.AppFilePath("tls-cert.pem"), config.AppFilePath("tls-key.pem")
+		if err := ensureSelfSigned(certFile, keyFile); err != nil {
+			return nil, fmt.Errorf("failed to create a self-signed certificate: %v", err)
+		}
+	case mode == "" || mode == "0" || mode == "off":
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("invalid GMAIL_MCP_TLS %q: use self-signed, or set GMAIL_MCP_TLS_CERT and GMAIL_MCP_TLS_KEY", mode)
+	}
+
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load TLS certificate: %v", err)
+	}
+	if len(cert.Certificate) > 0 {
+		fingerprint := sha256.Sum256(cert.Certificate[0])
+		log.Printf("🔒 TLS certificate %s (SHA-256 %s)", certFile, hex.EncodeToString(fingerprint[:]))
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
+
+// ensureSelfSigned generates a self-signed certificate for this machine's names and
+// addresses unless a current one already exists. It is a leaf certificate that can't
+// sign others, so a client that trusts it trusts only this server; a CA certificate
+// left by an older version is replaced.
+func ensureSelfSigned(certFile, keyFile string) error {
+	if cert, err := tls.LoadX509KeyPair(certFile, keyFile); err == nil && len(cert.Certificate) > 0 {
+		if parsed, err := x509.ParseCertificate(cert.Certificate[0]); err == nil && !parsed.IsCA && time.Until(parsed.NotAfter) > selfSignedRenewal {
+			return nil
+		}
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return err
+	}
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "Gmail MCP Server", Organization: []string{"auto-gmail"}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(selfSignedValidity),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  false,
+	}
+	template.DNSNames, template.IPAddresses = localNames()
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return err
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		return err
+	}
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644); err != nil {
+		return err
+	}
+	log.Printf("🔒 Generated a self-signed certificate for %s", strings.Join(template.DNSNames, ", "))
+	return nil
+}
+
+// localNames lists the names and addresses clients may use to reach this machine:
+// localhost, its hostname and the addresses of its network interfaces
+func localNames() ([]string, []net.IP) {
+	names := []string{"localhost"}
+	if hostname, err := os.Hostname(); err == nil && hostname != "" && hostname != "localhost" {
+		names = append(names, hostname)
+	}
+	addresses := []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback}
+	if interfaceAddresses, err := net.InterfaceAddrs(); err == nil {
+		for _, address := range interfaceAddresses {
+			if network, ok := address.(*net.IPNet); ok && !network.IP.IsLoopback() && !network.IP.IsLinkLocalUnicast() {
+				addresses = append(addresses, network.IP)
+			}
+		}
+	}
+	return names, addresses
+}
+
+// isLoopbackHost reports whether a listen host only accepts local connections;
+// an empty host listens on every interface
+func isLoopbackHost(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
@@ -0,0 +1,208 @@
+// Package transport serves an MCP server over stdio or HTTP.
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"auto-gmail/internal/config"
+	"auto-gmail/internal/hooks"
+	"auto-gmail/internal/tools"
+
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// ServeHTTP serves MCP on /mcp plus an info page, /health and the per-user
+// OAuth callback. /health includes toolHooks' metrics when they are enabled.
+// It listens on GMAIL_MCP_HTTP_HOST (default: every interface) and serves HTTPS when
+// a certificate is configured (see tlsConfigFromEnv). Browsers may only call it from
+// GMAIL_MCP_CORS_ORIGINS (default: localhost). It blocks until the server fails.
+func ServeHTTP(mcpServer *server.MCPServer, gmailServers *tools.GmailServerPool, toolHooks *hooks.Hooks, port string) error {
+	host := strings.TrimSpace(os.Getenv("GMAIL_MCP_HTTP_HOST"))
+	tlsConfig, err := tlsConfigFromEnv()
+	if err != nil {
+		return err
+	}
+	scheme := "http"
+	if tlsConfig != nil {
+		scheme = "https"
+	} else if !isLoopbackHost(host) {
+		log.Printf("⚠️  Mailbox content is served over plain HTTP to the network. Set GMAIL_MCP_TLS=self-signed (or GMAIL_MCP_TLS_CERT and GMAIL_MCP_TLS_KEY), or GMAIL_MCP_HTTP_HOST=127.0.0.1 to only accept local connections.")
+	}
+
+	log.Printf("Starting Gmail MCP Server in HTTP mode on port %s...", port)
+	log.Printf("✅ Server will run persistently at %s://localhost:%s", scheme, port)
+	log.Printf("   OAuth will only be required once!")
+	log.Printf("   (Use Ctrl+C to stop the server)")
+
+	gmailServer := gmailServers.Default()
+	if gmailServer.IsAuthenticated() {
+		// Test Gmail connection to ensure OAuth is working
+		_, err := gmailServer.Client().GetProfile(context.Background())
+		if err != nil {
+			return fmt.Errorf("Gmail authentication failed: %v", err)
+		}
+		log.Println("✅ Gmail authentication successful!")
+	} else {
+		log.Println("🔐 Gmail not authenticated yet. Call the authenticate tool to connect.")
+	}
+
+	// Create HTTP server; CORS for browser clients is limited to allowed origins
+	mux := http.NewServeMux()
+
+	// Add basic info endpoint
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprintf(w, `<!DOCTYPE html>
+<html>
+<head><title>Gmail MCP Server</title></head>
+<body>
+<h1>📧 Gmail MCP Server</h1>
+<p><strong>Status:</strong> Running in HTTP mode on port %s</p>
+<p><strong>Cursor Configuration:</strong></p>
+<pre>
+{
+  "mcpServers": {
+    "gmail-http": {
+      "url": "%s://localhost:%s/mcp"
+    }
+  }
+}
+</pre>
+<p><em>Copy the above configuration to your Cursor MCP settings.</em></p>
+<h2>Available Tools:</h2>
+<ul>
+<li>search_threads - Search Gmail with powerful query syntax</li>
+<li>count_matches - Estimate how many threads and messages match a query</li>
+<li>category_counts - Thread and unread counts per inbox tab</li>
+<li>build_query - Build and validate Gmail search queries from structured filters</li>
+<li>save_search / list_saved_searches / run_saved_search - Keep named queries and rerun them</li>
+<li>create_draft - Create/update email drafts</li>
+<li>mail_merge - Per-recipient drafts or scheduled sends from a template, after a dry-run preview</li>
+<li>import_eml - Add a .eml file to the mailbox or turn it into a draft</li>
+<li>backup_mailbox - Incremental mbox backups of selected labels, with attachments and restore instructions</li>
+<li>manage_groups - Named recipient groups for create_draft's to_group</li>
+<li>extract_attachment_by_filename - Extract text from attachments</li>
+<li>fetch_email_bodies - Get full email content</li>
+<li>list_labels - Label hierarchy with colors</li>
+<li>create_label - Create nested, colored labels</li>
+<li>mute_thread - Archive and label a thread as muted</li>
+<li>block_sender - Filter future mail from a sender</li>
+<li>cleanup_plan - Plan a retention cleanup and, once approved, move the matches to the trash</li>
+<li>manage_rules - Manage local automation rules for new mail</li>
+<li>run_rules_now - Run the automation rules immediately</li>
+<li>list_subscriptions - Rank newsletters and mailing lists by noise</li>
+<li>sender_history - Past correspondence and first-contact check for a sender</li>
+<li>set_vip - Manage VIP senders used for priority scoring</li>
+<li>explain_priority - Break down why a thread got its priority score, next to Gmail's importance marker</li>
+<li>search_attachments - Find attachments by name, type, size, date or sender</li>
+<li>find_similar - Find emails related to a message by subject, participants or content</li>
+<li>get_thread_participants - List everyone on a thread with their role and message counts</li>
+<li>export_thread_document - Export a thread as Markdown or PDF for sharing</li>
+<li>translate_message - Translate a message into another language</li>
+<li>analyze_image_attachment - Describe an image attachment and read its text with a vision model</li>
+<li>extract_entities - Pull amounts, dates, order/tracking numbers, flights and addresses from a message or attachment</li>
+<li>auto_label - Apply your existing labels to unlabeled threads with a language model</li>
+<li>collect_receipts - Build a JSON or CSV expense report from billing emails in a date range</li>
+<li>assemble_itinerary - Stitch flight, hotel and car confirmations into a chronological itinerary (optional .ics)</li>
+<li>extract_deadlines - List deadlines and commitments from recent mail in date order (optional .ics)</li>
+<li>unanswered_questions - List questions people asked you that you haven't replied to yet</li>
+<li>track_applications - Job search pipeline of recruiter and application threads by stage</li>
+<li>track_project - Group a project's threads and searches for the gmail://project/{name} status resource</li>
+<li>summarize_agreements - Decision log of who proposed, agreed to or rejected what in a thread or project</li>
+<li>remember_fact - Remember a preference or fact about the mailbox across sessions</li>
+<li>recall_facts - Recall remembered facts (also at gmail://memory)</li>
+<li>weekly_report - Weekly email activity report (volumes, top correspondents, unanswered threads, reply times)</li>
+<li>manage_digests - Email scheduled reports to yourself</li>
+<li>outbox_status - Show queued, sent and failed outgoing mail</li>
+<li>find_related_threads - Regroup one conversation split across several threads</li>
+<li>critique_draft - Score a draft against your style guide and suggest edits</li>
+<li>update_style_guide - Add your own corrections to the style guide (kept on regeneration)</li>
+<li>list_supported_formats - List the attachment formats that can be extracted</li>
+<li>render_attachment_preview - Render an attachment as page images for visual review</li>
+<li>get_personal_email_style_guide - Get writing style guide</li>
+<li>authenticate - Connect Gmail (if not yet authenticated)</li>
+<li>get_profile - Show the connected account, its totals and granted scopes</li>
+<li>server_version - Show the running build and whether an update is available</li>
+<li>telemetry_status - Show whether anonymous usage telemetry is on and what it would send</li>
+<li>session_stats - Time, Gmail quota units and LLM tokens each tool used in this session</li>
+</ul>
+</body>
+</html>`, port, scheme, port)
+	})
+
+	sessions := tools.NewSessionManager(gmailServers)
+
+	// Add health check endpoint
+	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		status := map[string]interface{}{
+			"status":              "healthy",
+			"server":              "Gmail MCP Server",
+			"version":             config.Version,
+			"timestamp":           time.Now().Format(time.RFC3339),
+			"gmail_authenticated": gmailServer.IsAuthenticated(),
+			"multi_user":          gmailServers.MultiUser(),
+			"sessions":            sessions.Count(),
+			"cache":               gmailServer.CacheStats(),
+		}
+		if toolStats := toolHooks.Stats(); toolStats != nil {
+			status["tools"] = toolStats
+		}
+
+		json.NewEncoder(w).Encode(status)
+	})
+
+	// Add MCP endpoint. The context function maps each request's bearer token to
+	// a Gmail account so tools run against that user's mailbox in multi-user mode,
+	// and each client gets its own session, bound to that token.
+	mcpHTTPServer := server.NewStreamableHTTPServer(mcpServer,
+		server.WithHTTPContextFunc(gmailServers.HTTPContext),
+		server.WithSessionIdManager(sessions),
+	)
+	mux.Handle("/mcp", sessions.Middleware(mcpHTTPServer))
+
+	// OAuth callback for per-user authentication started by the authenticate tool
+	mux.HandleFunc("/oauth2callback", gmailServers.HandleOAuth2Callback)
+
+	log.Printf("🌐 HTTP server starting on %s://localhost:%s", scheme, port)
+	log.Printf("📖 View server info: %s://localhost:%s", scheme, port)
+	log.Printf("🔍 Health check: %s://localhost:%s/health", scheme, port)
+	log.Println()
+	log.Println("🎯 TO CONNECT CURSOR:")
+	log.Printf("   Use MCP URL: %s://localhost:%s/mcp", scheme, port)
+	if gmailServers.MultiUser() {
+		log.Printf("   Multi-user mode: send 'Authorization: Bearer <token>' from the users file")
+		log.Printf("   REDIRECT_URL must point to %s://<host>:%s/oauth2callback", scheme, port)
+	}
+
+	// Start HTTP server
+	httpServer := &http.Server{
+		Addr:      net.JoinHostPort(host, port),
+		Handler:   withCORS(mux, corsOriginsFromEnv()),
+		TLSConfig: tlsConfig,
+	}
+
+	if tlsConfig != nil {
+		// The certificate is already in TLSConfig
+		return httpServer.ListenAndServeTLS("", "")
+	}
+	return httpServer.ListenAndServe()
+}
+
+// ServeStdio serves MCP over stdin/stdout until the client disconnects
+func ServeStdio(mcpServer *server.MCPServer) error {
+	log.Println("Starting Gmail MCP Server in stdio mode...")
+	log.Println("✅ Server ready! Waiting for MCP client connections via stdio...")
+	log.Println("   (Use Ctrl+C to stop the server)")
+
+	return server.ServeStdio(mcpServer)
+}
@@ -0,0 +1,238 @@
+// Package update reports which build of the server is running and, when enabled
+// with GMAIL_MCP_UPDATE_CHECK=1, checks GitHub releases at startup for a newer
+// version. The check is off by default so air-gapped installs never reach out.
+package update
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"auto-gmail/internal/config"
+)
+
+// defaultRepo is where releases are published; GMAIL_MCP_UPDATE_REPO overrides it
+// for forks
+const defaultRepo = "rajesh-chettiar/gmail-mcp-server"
+
+// checkTimeout bounds the release lookup so a slow network never delays anything
+const checkTimeout = 10 * time.Second
+
+// Build describes the running binary
+type Build struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit,omitempty"`
+	BuildDate string `json:"buildDate,omitempty"`
+	// Modified is set when the binary was built from a checkout with local changes
+	Modified  bool   `json:"modified,omitempty"`
+	GoVersion string `json:"goVersion"`
+	Platform  string `json:"platform"`
+}
+
+// CurrentBuild returns the version and, when known, the commit and build date
+func CurrentBuild() Build {
+	build := Build{
+		Version:   config.Version,
+		Commit:    config.Commit,
+		BuildDate: config.BuildDate,
+		GoVersion: runtime.Version(),
+		Platform:  runtime.GOOS + "/" + runtime.GOARCH,
+	}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range info.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				if build.Commit == "" {
+					build.Commit = setting.Value
+				}
+			case "vcs.time":
+				if build.BuildDate == "" {
+					build.BuildDate = setting.Value
+				}
+			case "vcs.modified":
+				build.Modified = setting.Value == "true"
+			}
+		}
+	}
+	return build
+}
+
+// release is the part of a GitHub release the check reads
+type release struct {
+	TagName     string    `json:"tag_name"`
+	Name        string    `json:"name"`
+	Body        string    `json:"body"`
+	HTMLURL     string    `json:"html_url"`
+	Draft       bool      `json:"draft"`
+	Prerelease  bool      `json:"prerelease"`
+	PublishedAt time.Time `json:"published_at"`
+}
+
+// Check is the outcome of the startup update check
+type Check struct {
+	CheckedAt       time.Time `json:"checkedAt"`
+	Latest          string    `json:"latest,omitempty"`
+	LatestURL       string    `json:"latestUrl,omitempty"`
+	UpdateAvailable bool      `json:"updateAvailable"`
+	// SecurityFixes lists newer releases whose notes mention security fixes
+	SecurityFixes []string `json:"securityFixes,omitempty"`
+	Error         string   `json:"error,omitempty"`
+}
+
+var (
+	mu        sync.Mutex
+	lastCheck *Check
+)
+
+// Enabled reports whether the startup check is turned on
+func Enabled() bool {
+	return os.Getenv("GMAIL_MCP_UPDATE_CHECK") == "1"
+}
+
+// CheckOnStartup looks for a newer release in the background when the check is
+// enabled, and logs if one is available
+func CheckOnStartup() {
+	if !Enabled() {
+		return
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), checkTimeout)
+		defer cancel()
+		check := checkReleases(ctx, config.Version)
+
+		mu.Lock()
+		lastCheck = check
+		mu.Unlock()
+
+		switch {
+		case check.Error != "":
+			log.Printf("Warning: Could not check for updates: %s", check.Error)
+		case len(check.SecurityFixes) > 0:
+			log.Printf("🔐 Gmail MCP Server %s is available and newer releases include security fixes (%s); you are running %s. Update soon: %s",
+				check.Latest, strings.Join(check.SecurityFixes, ", "), config.Version, check.LatestURL)
+		case check.UpdateAvailable:
+			log.Printf("⬆️  Gmail MCP Server %s is available (you are running %s): %s", check.Latest, config.Version, check.LatestURL)
+		default:
+			log.Printf("✅ Gmail MCP Server %s is the latest release", config.Version)
+		}
+	}()
+}
+
+// LastCheck returns the result of the startup check, or nil if it hasn't finished
+// or is disabled
+func LastCheck() *Check {
+	mu.Lock()
+	defer mu.Unlock()
+	return lastCheck
+}
+
+// checkReleases compares current with the repository's published releases
+func checkReleases(ctx context.Context, current string) *Check {
+	check := &Check{CheckedAt: time.Now().UTC()}
+	repo := os.Getenv("GMAIL_MCP_UPDATE_REPO")
+	if repo == "" {
+		repo = defaultRepo
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("https://api.github.com/repos/%s/releases?per_page=30", repo), nil)
+	if err != nil {
+		check.Error = err.Error()
+		return check
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("User-Agent", "gmail-mcp-server/"+current)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		check.Error = err.Error()
+		return check
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		check.Error = fmt.Sprintf("GitHub returned %s", resp.Status)
+		return check
+	}
+	var releases []release
+	if err := json.NewDecoder(resp.Body).Decode(&releases); err != nil {
+		check.Error = fmt.Sprintf("invalid releases response: %v", err)
+		return check
+	}
+
+	for _, r := range releases {
+		if r.Draft || r.Prerelease || !newer(r.TagName, current) {
+			continue
+		}
+		check.UpdateAvailable = true
+		if check.Latest == "" || newer(r.TagName, check.Latest) {
+			check.Latest, check.LatestURL = r.TagName, r.HTMLURL
+		}
+		if mentionsSecurity(r) {
+			check.SecurityFixes = append(check.SecurityFixes, r.TagName)
+		}
+	}
+	return check
+}
+
+// mentionsSecurity reports whether a release's title or notes announce security fixes
+func mentionsSecurity(r release) bool {
+	text := strings.ToLower(r.Name + "\n" + r.Body)
+	return strings.Contains(text, "security") || strings.Contains(text, "cve-")
+}
+
+// newer reports whether version a is later than b, comparing "v1.2.3"-style
+// versions numerically; anything after a "-" or "+" is ignored
+func newer(a, b string) bool {
+	pa, pb := versionParts(a), versionParts(b)
+	for i := range max(len(pa), len(pb)) {
+		var x, y int
+		if i < len(pa) {
+			x = pa[i]
+		}
+		if i < len(pb) {
+			y = pb[i]
+		}
+		if x != y {
+			return x > y
+		}
+	}
+	return false
+}
+
+// versionParts splits "v1.2.3-rc1" into [1 2 3]
+func versionParts(version string) []int {
+	version = strings.TrimPrefix(strings.TrimSpace(version), "v")
+	if i := strings.IndexAny(version, "-+"); i >= 0 {
+		version = version[:i]
+	}
+	var parts []int
+	for _, part := range strings.Split(version, ".") {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			break
+		}
+		parts = append(parts, n)
+	}
+	return parts
+}
+
+// Status is what the server_version tool reports
+func Status() map[string]interface{} {
+	status := map[string]interface{}{"build": CurrentBuild()}
+	switch check := LastCheck(); {
+	case !Enabled():
+		status["updateCheck"] = "off; set GMAIL_MCP_UPDATE_CHECK=1 to check GitHub releases at startup"
+	case check == nil:
+		status["updateCheck"] = "running"
+	default:
+		status["updateCheck"] = check
+	}
+	return status
+}
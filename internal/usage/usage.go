@@ -0,0 +1,299 @@
+// Package usage accounts for what each tool call costs within its MCP session:
+// wall-clock time, Gmail API requests and the quota units Google charges for them,
+// and the LLM tokens of any model calls. The totals are kept in memory per session
+// and tool, for the session_stats tool; nothing is written to disk or sent anywhere.
+package usage
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// sessionTTL is how long an idle session's totals are kept
+const sessionTTL = 24 * time.Hour
+
+// gmailUnits are the Gmail API's quota units per method, from Google's published
+// usage limits; methods not listed cost 5 units
+var gmailUnits = map[string]int64{
+	"profile":              1,
+	"history":              2,
+	"watch":                100,
+	"stop":                 50,
+	"labels.get":           1,
+	"labels.list":          1,
+	"settings.get":         1,
+	"messages.list":        5,
+	"messages.get":         5,
+	"messages.attachment":  5,
+	"messages.delete":      10,
+	"messages.send":        100,
+	"messages.import":      25,
+	"messages.insert":      25,
+	"messages.batchModify": 50,
+	"messages.batchDelete": 50,
+	"threads.list":         10,
+	"threads.get":          10,
+	"threads.modify":       10,
+	"threads.trash":        10,
+	"threads.untrash":      10,
+	"threads.delete":       20,
+	"drafts.create":        10,
+	"drafts.update":        15,
+	"drafts.delete":        10,
+	"drafts.send":          100,
+}
+
+// gmailActions are the methods called on a collection rather than an item, e.g.
+// messages/send
+var gmailActions = map[string]bool{"send": true, "import": true, "batchModify": true, "batchDelete": true}
+
+// GmailUnits is the quota cost of one Gmail API request, read from its method and
+// URL path; requests that aren't to the Gmail API, such as the batch envelope whose
+// sub-requests are counted on their own, cost nothing
+func GmailUnits(method, path string) int64 {
+	_, rest, ok := strings.Cut(strings.TrimPrefix(path, "/upload"), "/gmail/v1/users/")
+	if !ok {
+		return 0
+	}
+	rest, _, _ = strings.Cut(rest, "?")
+	parts := strings.Split(rest, "/")[1:] // drop the user ID
+	if len(parts) == 0 || parts[0] == "" {
+		return 0
+	}
+
+	var name string
+	switch resource := parts[0]; resource {
+	case "profile", "history", "watch", "stop":
+		name = resource
+	case "labels", "settings":
+		name = resource + ".update"
+		if method == "GET" {
+			name = resource + ".get"
+			if resource == "labels" && len(parts) == 1 {
+				name = "labels.list"
+			}
+		}
+	default:
+		// messages, threads and drafts: a collection, an item, or an action on either
+		switch {
+		case len(parts) == 1 && method == "GET":
+			name = resource + ".list"
+		case len(parts) == 1:
+			name = resource + ".create"
+		case len(parts) == 2 && gmailActions[parts[1]]:
+			name = resource + "." + parts[1]
+		case len(parts) == 2 && method == "GET":
+			name = resource + ".get"
+		case len(parts) == 2 && method == "DELETE":
+			name = resource + ".delete"
+		case len(parts) == 2:
+			name = resource + ".update"
+		case parts[2] == "attachments":
+			name = resource + ".attachment"
+		default:
+			name = resource + "." + parts[2]
+		}
+	}
+	if units, ok := gmailUnits[name]; ok {
+		return units
+	}
+	return 5
+}
+
+// meter collects the costs of one tool call; its counters are updated by the HTTP
+// clients the call uses, possibly from several goroutines
+type meter struct {
+	gmailRequests    atomic.Int64
+	gmailUnits       atomic.Int64
+	promptTokens     atomic.Int64
+	completionTokens atomic.Int64
+}
+
+type contextKey struct{}
+
+// AddGmailRequest records a Gmail API request made for the tool call ctx belongs to.
+// Calls outside a tool call, such as background syncing, aren't counted, and neither
+// is a batch envelope, whose sub-requests are recorded one by one.
+func AddGmailRequest(ctx context.Context, method, path string) {
+	m, ok := ctx.Value(contextKey{}).(*meter)
+	units := GmailUnits(method, path)
+	if !ok || units == 0 {
+		return
+	}
+	m.gmailRequests.Add(1)
+	m.gmailUnits.Add(units)
+}
+
+// AddTokens records the tokens of a model call made for the tool call ctx belongs to
+func AddTokens(ctx context.Context, prompt, completion int64) {
+	if m, ok := ctx.Value(contextKey{}).(*meter); ok {
+		m.promptTokens.Add(prompt)
+		m.completionTokens.Add(completion)
+	}
+}
+
+// ToolStats are one tool's totals within a session
+type ToolStats struct {
+	Tool             string `json:"tool"`
+	Calls            int    `json:"calls"`
+	Errors           int    `json:"errors,omitempty"`
+	TotalMs          int64  `json:"totalMs"`
+	AvgMs            int64  `json:"avgMs"`
+	MaxMs            int64  `json:"maxMs"`
+	GmailRequests    int64  `json:"gmailRequests"`
+	GmailUnits       int64  `json:"gmailUnits"`
+	PromptTokens     int64  `json:"promptTokens,omitempty"`
+	CompletionTokens int64  `json:"completionTokens,omitempty"`
+}
+
+// add counts another call into the totals
+func (s *ToolStats) add(other *ToolStats) {
+	s.Calls += other.Calls
+	s.Errors += other.Errors
+	s.TotalMs += other.TotalMs
+	s.MaxMs = max(s.MaxMs, other.MaxMs)
+	s.GmailRequests += other.GmailRequests
+	s.GmailUnits += other.GmailUnits
+	s.PromptTokens += other.PromptTokens
+	s.CompletionTokens += other.CompletionTokens
+	s.AvgMs = s.TotalMs / int64(max(s.Calls, 1))
+}
+
+// session is one MCP session's totals per tool
+type session struct {
+	started  time.Time
+	lastUsed time.Time
+	tools    map[string]*ToolStats
+}
+
+// Tracker keeps the per-session, per-tool totals
+type Tracker struct {
+	mu       sync.Mutex
+	sessions map[string]*session
+}
+
+var (
+	defaultOnce    sync.Once
+	defaultTracker *Tracker
+)
+
+// Default returns the process-wide tracker
+func Default() *Tracker {
+	defaultOnce.Do(func() {
+		defaultTracker = &Tracker{sessions: map[string]*session{}}
+	})
+	return defaultTracker
+}
+
+// SessionID identifies the calling MCP session; stdio has a single session
+func SessionID(ctx context.Context) string {
+	if s := server.ClientSessionFromContext(ctx); s != nil {
+		return s.SessionID()
+	}
+	return ""
+}
+
+// Middleware meters each tool call and adds it to its session's totals. Install it
+// just inside requestid's middleware so the time covers everything else.
+func (t *Tracker) Middleware() server.ToolHandlerMiddleware {
+	return func(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+		return func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			m := &meter{}
+			started := time.Now()
+			result, err := next(context.WithValue(ctx, contextKey{}, m), req)
+			elapsed := time.Since(started).Milliseconds()
+
+			call := &ToolStats{
+				Calls:            1,
+				TotalMs:          elapsed,
+				MaxMs:            elapsed,
+				GmailRequests:    m.gmailRequests.Load(),
+				GmailUnits:       m.gmailUnits.Load(),
+				PromptTokens:     m.promptTokens.Load(),
+				CompletionTokens: m.completionTokens.Load(),
+			}
+			if err != nil || result != nil && result.IsError {
+				call.Errors = 1
+			}
+			t.record(SessionID(ctx), req.Params.Name, call)
+			return result, err
+		}
+	}
+}
+
+// record adds a call to its session, dropping sessions idle for sessionTTL
+func (t *Tracker) record(sessionID, tool string, call *ToolStats) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	for id, s := range t.sessions {
+		if now.Sub(s.lastUsed) > sessionTTL {
+			delete(t.sessions, id)
+		}
+	}
+	s, ok := t.sessions[sessionID]
+	if !ok {
+		s = &session{started: now, tools: map[string]*ToolStats{}}
+		t.sessions[sessionID] = s
+	}
+	s.lastUsed = now
+	stats, ok := s.tools[tool]
+	if !ok {
+		stats = &ToolStats{Tool: tool}
+		s.tools[tool] = stats
+	}
+	stats.add(call)
+}
+
+// Report is a session's usage: totals, and each tool's share, most expensive first
+type Report struct {
+	Since  time.Time    `json:"since,omitempty"`
+	Totals ToolStats    `json:"totals"`
+	Tools  []*ToolStats `json:"tools"`
+}
+
+// Report returns the totals of a session's finished tool calls. Tools are sorted by
+// Gmail quota units, then time, the two things a workflow usually runs out of.
+func (t *Tracker) Report(sessionID string) Report {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	report := Report{Tools: []*ToolStats{}}
+	s, ok := t.sessions[sessionID]
+	if !ok {
+		return report
+	}
+	report.Since = s.started
+	for _, stats := range s.tools {
+		copied := *stats
+		report.Tools = append(report.Tools, &copied)
+		report.Totals.add(stats)
+	}
+	report.Totals.Tool = ""
+	sort.Slice(report.Tools, func(i, j int) bool {
+		a, b := report.Tools[i], report.Tools[j]
+		if a.GmailUnits != b.GmailUnits {
+			return a.GmailUnits > b.GmailUnits
+		}
+		if a.TotalMs != b.TotalMs {
+			return a.TotalMs > b.TotalMs
+		}
+		return a.Tool < b.Tool
+	})
+	return report
+}
+
+// Reset starts a session's totals over
+func (t *Tracker) Reset(sessionID string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.sessions, sessionID)
+}
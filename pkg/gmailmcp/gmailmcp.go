@@ -0,0 +1,303 @@
+// Package gmailmcp lets other Go programs embed the Gmail tools, resources and
+// prompts in their own MCP server instead of running the gmail-mcp-server binary.
+//
+//	mcpServer, gmailServer, err := gmailmcp.NewServer(gmailmcp.WithMCPServer(myServer))
+//
+// Configuration comes from the same environment variables as the binary
+// (GMAIL_MCP_*, OPENAI_API_KEY, Google OAuth credentials); call LoadEnv first to
+// read them from a .env file as well.
+package gmailmcp
+
+import (
+	"auto-gmail/internal/config"
+	"auto-gmail/internal/extract"
+	"auto-gmail/internal/gmailclient"
+	"auto-gmail/internal/hooks"
+	"auto-gmail/internal/requestid"
+	"auto-gmail/internal/telemetry"
+	"auto-gmail/internal/toolerr"
+	"auto-gmail/internal/tools"
+	"auto-gmail/internal/usage"
+
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// GmailServer is the Gmail account the tools act on
+type GmailServer = tools.GmailServer
+
+// Client is a Gmail backend; see WithClient
+type Client = gmailclient.Client
+
+// Servers resolves the Mailbox a request acts on; see WithRegister
+type Servers = tools.Servers
+
+// Mailbox is what the registered handlers use of the account a request acts on
+type Mailbox = tools.Mailbox
+
+// Hooks run around every tool call; see NewHooks and WithHooks
+type Hooks = hooks.Hooks
+
+// ToolCall describes the tool invocation a hook runs around
+type ToolCall = hooks.Call
+
+// Extractor turns one attachment format into text; see RegisterExtractor
+type Extractor = extract.Extractor
+
+// Renderer turns an attachment into page images for render_attachment_preview; see SetRenderer
+type Renderer = extract.Renderer
+
+// RenderedPage is one page image produced by a Renderer
+type RenderedPage = extract.RenderedPage
+
+// ToolAdder is where tools are registered: a *server.MCPServer, or one wrapped by WithMiddleware
+type ToolAdder = tools.ToolAdder
+
+// options collects what the Option values set
+type options struct {
+	mcpServer     *server.MCPServer
+	serverOptions []server.ServerOption
+	client        Client
+	demo          bool
+	offline       bool
+	register      func(*server.MCPServer, Servers)
+	hooks         *Hooks
+}
+
+// Option configures NewServer
+type Option func(*options)
+
+// WithMCPServer registers the Gmail tools on an existing MCP server instead of creating one
+func WithMCPServer(mcpServer *server.MCPServer) Option {
+	return func(o *options) {
+		o.mcpServer = mcpServer
+	}
+}
+
+// WithServerOptions adds options to the MCP server NewServer creates; ignored with WithMCPServer
+func WithServerOptions(serverOptions ...server.ServerOption) Option {
+	return func(o *options) {
+		o.serverOptions = append(o.serverOptions, serverOptions...)
+	}
+}
+
+// WithClient serves mail from client (e.g. a fake mailbox in tests) instead of the
+// Gmail API, already authenticated
+func WithClient(client Client) Option {
+	return func(o *options) {
+		o.client = client
+	}
+}
+
+// WithDemo serves the generated demo mailbox, like --demo
+func WithDemo() Option {
+	return func(o *options) {
+		o.demo = true
+	}
+}
+
+// WithOffline serves mail from the local snapshot, like GMAIL_MCP_OFFLINE=1
+func WithOffline() Option {
+	return func(o *options) {
+		o.offline = true
+	}
+}
+
+// WithRegister replaces registering every resource, prompt and tool with register,
+// which can add a subset (RegisterSearchTools, RegisterDraftTools, ...), wrap them
+// with WithMiddleware, or add the caller's own tools to the same server
+func WithRegister(register func(mcpServer *server.MCPServer, gmailServers Servers)) Option {
+	return func(o *options) {
+		o.register = register
+	}
+}
+
+// WithHooks runs h around every Gmail tool call instead of the hooks file
+// (hooks.json or GMAIL_MCP_HOOKS_FILE). With WithRegister, wrap the tools you add
+// with WithMiddleware(s, h.Middleware()) yourself when using WithMCPServer.
+func WithHooks(h *Hooks) Option {
+	return func(o *options) {
+		o.hooks = h
+	}
+}
+
+// NewHooks creates an empty set of hooks that sees each caller's Gmail address in
+// multi-user mode; add to it with AddBefore, AddAfter, AuditLog, RateLimit,
+// RedactResults and EnableMetrics
+func NewHooks() *Hooks {
+	return hooks.New(tools.PrincipalFromContext)
+}
+
+// LoadHooks creates hooks from a hooks file
+func LoadHooks(path string) (*Hooks, error) {
+	return hooks.Load(path, tools.PrincipalFromContext)
+}
+
+// NewServer creates the Gmail server and registers its tools, resources and prompts
+// on an MCP server, which it returns along with the Gmail server. The Gmail server
+// doesn't block on OAuth: without a cached token it starts unauthenticated until the
+// authenticate tool is called.
+func NewServer(opts ...Option) (*server.MCPServer, *GmailServer, error) {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	var gmailServer *GmailServer
+	switch {
+	case o.client != nil:
+		gmailServer = tools.NewGmailServerWithClient(o.client)
+	case o.demo:
+		gmailServer = tools.NewDemoGmailServer()
+	case o.offline:
+		gmailServer = tools.NewOfflineGmailServer()
+	default:
+		var err error
+		gmailServer, err = tools.NewGmailServer()
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	gmailServers, err := tools.NewGmailServerPool(gmailServer)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	toolHooks := o.hooks
+	if toolHooks == nil {
+		if toolHooks, err = hooks.FromEnv(tools.PrincipalFromContext); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	mcpServer := o.mcpServer
+	var adder ToolAdder = mcpServer
+	if mcpServer == nil {
+		serverOptions := append([]server.ServerOption{
+			server.WithToolCapabilities(true),
+			server.WithResourceCapabilities(true, true),
+			server.WithPromptCapabilities(true),
+			server.WithToolHandlerMiddleware(requestid.Middleware()),
+			server.WithToolHandlerMiddleware(usage.Default().Middleware()),
+			server.WithToolHandlerMiddleware(telemetry.Default().Middleware()),
+			server.WithToolHandlerMiddleware(toolerr.Middleware()),
+			server.WithRecovery(),
+		}, o.serverOptions...)
+		if !toolHooks.Empty() {
+			serverOptions = append(serverOptions, server.WithToolHandlerMiddleware(toolHooks.Middleware()))
+		}
+		mcpServer = server.NewMCPServer("Gmail MCP Server", config.Version, serverOptions...)
+		adder = mcpServer
+	} else {
+		// An existing server's middleware can't be changed, so wrap just the Gmail tools
+		middleware := []server.ToolHandlerMiddleware{requestid.Middleware(), usage.Default().Middleware(), telemetry.Default().Middleware(), toolerr.Middleware()}
+		if !toolHooks.Empty() {
+			middleware = append(middleware, toolHooks.Middleware())
+		}
+		adder = tools.WithMiddleware(mcpServer, middleware...)
+	}
+
+	if o.register != nil {
+		o.register(mcpServer, gmailServers)
+	} else {
+		tools.RegisterResources(mcpServer, gmailServers)
+		tools.RegisterPrompts(mcpServer, gmailServers)
+		tools.RegisterTools(adder, gmailServers)
+	}
+
+	return mcpServer, gmailServer, nil
+}
+
+// RegisterExtractor adds an attachment format (e.g. a proprietary report) that
+// extract_attachment_by_filename can read, replacing any extractor of the same name
+func RegisterExtractor(extractor Extractor) {
+	extract.Register(extractor)
+}
+
+// NewExtractor creates an Extractor for the given MIME types and extensions (".ext")
+// from a function
+func NewExtractor(name string, mimeTypes, extensions []string, fn func(data []byte) (string, error)) Extractor {
+	return extract.NewExtractor(name, mimeTypes, extensions, fn)
+}
+
+// DisableExtractors turns attachment extractors off by name, like GMAIL_MCP_DISABLED_EXTRACTORS
+func DisableExtractors(names ...string) {
+	extract.Disable(names...)
+}
+
+// SetRenderer replaces how render_attachment_preview turns attachments into page
+// images, e.g. to use a rendering service; nil restores the default
+func SetRenderer(renderer Renderer) {
+	extract.SetRenderer(renderer)
+}
+
+// LoadEnv reads environment variables from a .env file, as the binary does at startup
+func LoadEnv() {
+	config.LoadEnv()
+}
+
+// WithMiddleware wraps each tool added through the returned ToolAdder in middleware,
+// the first one outermost
+func WithMiddleware(adder ToolAdder, middleware ...server.ToolHandlerMiddleware) ToolAdder {
+	return tools.WithMiddleware(adder, middleware...)
+}
+
+// RegisterResources adds the style guide, memory, contact context and style example resources
+func RegisterResources(mcpServer *server.MCPServer, gmailServers Servers) {
+	tools.RegisterResources(mcpServer, gmailServers)
+}
+
+// RegisterPrompts adds the administrative and report prompts
+func RegisterPrompts(mcpServer *server.MCPServer, gmailServers Servers) {
+	tools.RegisterPrompts(mcpServer, gmailServers)
+}
+
+// RegisterTools adds every tool group
+func RegisterTools(adder ToolAdder, gmailServers Servers) {
+	tools.RegisterTools(adder, gmailServers)
+}
+
+// RegisterAuthTools adds the authenticate tool
+func RegisterAuthTools(adder ToolAdder, gmailServers Servers) {
+	tools.RegisterAuthTools(adder, gmailServers)
+}
+
+// RegisterSearchTools adds the tools that search and read mail
+func RegisterSearchTools(adder ToolAdder, gmailServers Servers) {
+	tools.RegisterSearchTools(adder, gmailServers)
+}
+
+// RegisterDraftTools adds the drafting tools
+func RegisterDraftTools(adder ToolAdder, gmailServers Servers) {
+	tools.RegisterDraftTools(adder, gmailServers)
+}
+
+// RegisterAttachmentTools adds the attachment tools
+func RegisterAttachmentTools(adder ToolAdder, gmailServers Servers) {
+	tools.RegisterAttachmentTools(adder, gmailServers)
+}
+
+// RegisterLabelTools adds the tools that label, filter and triage mail
+func RegisterLabelTools(adder ToolAdder, gmailServers Servers) {
+	tools.RegisterLabelTools(adder, gmailServers)
+}
+
+// RegisterAITools adds the tools that call a language model
+func RegisterAITools(adder ToolAdder, gmailServers Servers) {
+	tools.RegisterAITools(adder, gmailServers)
+}
+
+// RegisterInsightTools adds the receipts, itinerary, job application and report tools
+func RegisterInsightTools(adder ToolAdder, gmailServers Servers) {
+	tools.RegisterInsightTools(adder, gmailServers)
+}
+
+// RegisterStyleTools adds the personal email style guide tools
+func RegisterStyleTools(adder ToolAdder, gmailServers Servers) {
+	tools.RegisterStyleTools(adder, gmailServers)
+}
+
+// RegisterMemoryTools adds the tools that remember facts across sessions
+func RegisterMemoryTools(adder ToolAdder, gmailServers Servers) {
+	tools.RegisterMemoryTools(adder, gmailServers)
+}